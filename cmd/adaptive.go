@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adaptiveInterval is how often adaptive mode samples the system
+var adaptiveInterval = 5 * time.Second
+
+// systemLoad is a snapshot of the pressure on the machine
+type systemLoad struct {
+	// loadPerCPU is the 1-minute load average divided by the CPU count
+	loadPerCPU float64
+	// memAvailable is the fraction of memory still available
+	memAvailable float64
+	// ioWait is the fraction of CPU time spent waiting for I/O since the
+	// previous sample
+	ioWait float64
+}
+
+// adjustWorkers returns the worker count for the next interval: one fewer
+// under pressure, one more when the system is comfortably idle
+func adjustWorkers(current, min, max int, load systemLoad) int {
+	switch {
+	case load.loadPerCPU > 1.0 || load.memAvailable < 0.10 || load.ioWait > 0.30:
+		current--
+	case load.loadPerCPU < 0.7 && load.memAvailable > 0.20 && load.ioWait < 0.10:
+		current++
+	}
+	if current < min {
+		current = min
+	}
+	if current > max {
+		current = max
+	}
+	return current
+}
+
+// cpuTimes holds the total and iowait jiffies from /proc/stat
+type cpuTimes struct {
+	total  uint64
+	iowait uint64
+}
+
+// procSampler reads system load from Linux /proc files
+type procSampler struct {
+	root string
+	prev cpuTimes
+}
+
+// sample returns the current system load
+func (s *procSampler) sample() (systemLoad, error) {
+	var load systemLoad
+
+	data, err := os.ReadFile(s.root + "/loadavg")
+	if err != nil {
+		return load, err
+	}
+	if load.loadPerCPU, err = parseLoadAvg(string(data)); err != nil {
+		return load, err
+	}
+	load.loadPerCPU /= float64(runtime.NumCPU())
+
+	if data, err = os.ReadFile(s.root + "/meminfo"); err != nil {
+		return load, err
+	}
+	if load.memAvailable, err = parseMemAvailable(string(data)); err != nil {
+		return load, err
+	}
+
+	if data, err = os.ReadFile(s.root + "/stat"); err != nil {
+		return load, err
+	}
+	times, err := parseCPUTimes(string(data))
+	if err != nil {
+		return load, err
+	}
+	if s.prev.total > 0 && times.total > s.prev.total {
+		load.ioWait = float64(times.iowait-s.prev.iowait) / float64(times.total-s.prev.total)
+	}
+	s.prev = times
+	return load, nil
+}
+
+// parseLoadAvg returns the 1-minute load average from /proc/loadavg
+func parseLoadAvg(data string) (float64, error) {
+	fields := strings.Fields(data)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty loadavg")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// parseMemAvailable returns MemAvailable / MemTotal from /proc/meminfo
+func parseMemAvailable(data string) (float64, error) {
+	var total, available float64
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = value
+		case "MemAvailable:":
+			available = value
+		}
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("MemTotal not found in meminfo")
+	}
+	return available / total, nil
+}
+
+// parseCPUTimes returns the aggregate CPU times from /proc/stat
+func parseCPUTimes(data string) (cpuTimes, error) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[0] != "cpu" {
+			continue
+		}
+		var times cpuTimes
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return cpuTimes{}, err
+			}
+			times.total += value
+			// user nice system idle iowait ...
+			if i == 4 {
+				times.iowait = value
+			}
+		}
+		return times, nil
+	}
+	return cpuTimes{}, fmt.Errorf("cpu line not found in stat")
+}
+
+// adaptWorkers lowers the limiter to min, then samples the system every
+// interval and adjusts it until the returned stop function is called.
+// Systems the sampler cannot read keep the configured worker count.
+func adaptWorkers(limiter *workerLimiter, sampler *procSampler, min int, interval time.Duration) func() {
+	if _, err := sampler.sample(); err != nil {
+		logger.Warn("Adaptive workers unavailable on this system", "error", err)
+		return func() {}
+	}
+	limiter.setLimit(min)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				load, err := sampler.sample()
+				if err != nil {
+					continue
+				}
+				current := limiter.currentLimit()
+				if next := adjustWorkers(current, min, limiter.max, load); next != current {
+					limiter.setLimit(next)
+					if verbose {
+						logger.Info("Adjusted workers", "from", current, "to", next,
+							"load_per_cpu", load.loadPerCPU, "memory_available", load.memAvailable, "iowait", load.ioWait)
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdjustWorkers(t *testing.T) {
+	idle := systemLoad{loadPerCPU: 0.2, memAvailable: 0.6, ioWait: 0.01}
+	busy := systemLoad{loadPerCPU: 1.5, memAvailable: 0.6, ioWait: 0.01}
+	lowMemory := systemLoad{loadPerCPU: 0.2, memAvailable: 0.05, ioWait: 0.01}
+	ioBound := systemLoad{loadPerCPU: 0.2, memAvailable: 0.6, ioWait: 0.5}
+	moderate := systemLoad{loadPerCPU: 0.8, memAvailable: 0.6, ioWait: 0.01}
+
+	tests := []struct {
+		name     string
+		current  int
+		load     systemLoad
+		expected int
+	}{
+		{"Idle scales up", 2, idle, 3},
+		{"Idle capped at max", 4, idle, 4},
+		{"Busy scales down", 3, busy, 2},
+		{"Busy capped at min", 1, busy, 1},
+		{"Low memory scales down", 3, lowMemory, 2},
+		{"I/O wait scales down", 3, ioBound, 2},
+		{"Moderate load holds", 3, moderate, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := adjustWorkers(test.current, 1, 4, test.load); result != test.expected {
+				t.Errorf("adjustWorkers() = %d, expected %d", result, test.expected)
+			}
+		})
+	}
+}
+
+func TestProcSampler(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"loadavg": "0.00 0.50 0.75 1/200 12345\n",
+		"meminfo": "MemTotal:       16000000 kB\nMemFree:         1000000 kB\nMemAvailable:    4000000 kB\n",
+		"stat":    "cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 50 0 50 350 50 0 0 0 0 0\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	sampler := &procSampler{root: root}
+	load, err := sampler.sample()
+	if err != nil {
+		t.Fatalf("sample() error = %v", err)
+	}
+	if load.memAvailable != 0.25 {
+		t.Errorf("sample() memAvailable = %g, expected 0.25", load.memAvailable)
+	}
+	if load.ioWait != 0 {
+		t.Errorf("first sample() ioWait = %g, expected 0", load.ioWait)
+	}
+
+	// 100 more jiffies of which 50 were iowait
+	stat := "cpu  120 0 110 720 150 0 0 0 0 0\n"
+	if err := os.WriteFile(filepath.Join(root, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatalf("Failed to write stat: %v", err)
+	}
+	load, err = sampler.sample()
+	if err != nil {
+		t.Fatalf("sample() error = %v", err)
+	}
+	if load.ioWait != 0.5 {
+		t.Errorf("second sample() ioWait = %g, expected 0.5", load.ioWait)
+	}
+
+	if _, err := (&procSampler{root: filepath.Join(root, "missing")}).sample(); err == nil {
+		t.Error("sample() without /proc files expected error, got nil")
+	}
+}
+
+func TestAdaptWorkersUnavailable(t *testing.T) {
+	// Without /proc the configured worker count is kept
+	limiter := newWorkerLimiter(4)
+	stop := adaptWorkers(limiter, &procSampler{root: filepath.Join(t.TempDir(), "missing")}, 1, time.Hour)
+	stop()
+	if limit := limiter.currentLimit(); limit != 4 {
+		t.Errorf("currentLimit() = %d, expected the configured 4", limit)
+	}
+
+	// Once the system can be sampled, adaptive mode starts at the minimum
+	root := t.TempDir()
+	files := map[string]string{
+		"loadavg": "0.00 0.50 0.75 1/200 12345\n",
+		"meminfo": "MemTotal: 100 kB\nMemAvailable: 50 kB\n",
+		"stat":    "cpu  100 0 100 700 100 0 0 0 0 0\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	stop = adaptWorkers(limiter, &procSampler{root: root}, 1, time.Hour)
+	stop()
+	if limit := limiter.currentLimit(); limit != 1 {
+		t.Errorf("currentLimit() = %d, expected the minimum 1", limit)
+	}
+}
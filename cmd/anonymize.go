@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"os"
+	"sort"
+	"sync"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// anon names outputs by opaque IDs; nil means outputs keep their names
+var anon *anonymizer
+
+// anonymizer assigns opaque random IDs to input files. Outputs are always
+// re-encoded from pixels, so no EXIF, XMP or ICC data is carried over.
+type anonymizer struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func newAnonymizer() *anonymizer {
+	return &anonymizer{ids: make(map[string]string)}
+}
+
+// id returns the opaque ID for path, creating one on first use
+func (a *anonymizer) id(path string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if id, ok := a.ids[path]; ok {
+		return id, nil
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+	a.ids[path] = id
+	return id, nil
+}
+
+// wrap returns a processing function that names outputs by opaque ID
+func (a *anonymizer) wrap(process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		id, err := a.id(path)
+		if err != nil {
+			return processor.Result{InputPath: path}, err
+		}
+		config.OutputName = id
+		return process(path, config)
+	}
+}
+
+// writeMapping writes the private ID to original path mapping as CSV,
+// readable by the owner only
+func (a *anonymizer) writeMapping(path string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rows := make([][]string, 0, len(a.ids))
+	for original, id := range a.ids {
+		rows = append(rows, []string{id, original})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][1] < rows[j][1] })
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"id", "original"})
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestAnonymizer(t *testing.T) {
+	a := newAnonymizer()
+
+	first, err := a.id("/photos/IMG_0001.jpg")
+	if err != nil {
+		t.Fatalf("id() error = %v", err)
+	}
+	again, _ := a.id("/photos/IMG_0001.jpg")
+	other, _ := a.id("/photos/IMG_0002.jpg")
+
+	if first != again {
+		t.Errorf("id() not stable for the same path: %s != %s", first, again)
+	}
+	if first == other {
+		t.Error("id() returned the same ID for different paths")
+	}
+	if len(first) != 16 {
+		t.Errorf("id() = %s, expected 16 hex characters", first)
+	}
+
+	var seen processor.Config
+	process := a.wrap(func(path string, config processor.Config) (processor.Result, error) {
+		seen = config
+		return processor.Result{}, nil
+	})
+	if _, err := process("/photos/IMG_0002.jpg", processor.Config{}); err != nil {
+		t.Fatalf("wrapped process error = %v", err)
+	}
+	if seen.OutputName != other {
+		t.Errorf("wrapped process OutputName = %s, expected %s", seen.OutputName, other)
+	}
+
+	mapPath := filepath.Join(t.TempDir(), "map.csv")
+	if err := a.writeMapping(mapPath); err != nil {
+		t.Fatalf("writeMapping() error = %v", err)
+	}
+
+	info, err := os.Stat(mapPath)
+	if err != nil {
+		t.Fatalf("Failed to stat mapping: %v", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Errorf("mapping permissions = %v, expected owner only", info.Mode().Perm())
+	}
+
+	file, err := os.Open(mapPath)
+	if err != nil {
+		t.Fatalf("Failed to open mapping: %v", err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse mapping: %v", err)
+	}
+	if len(rows) != 3 || rows[1][0] != first || rows[1][1] != "/photos/IMG_0001.jpg" {
+		t.Errorf("mapping rows = %v, expected header plus 2 sorted rows", rows)
+	}
+}
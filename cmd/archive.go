@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+)
+
+// Zip layouts
+const (
+	zipLayoutFlat = "flat"
+	zipLayoutTree = "tree"
+)
+
+// archive receives outputs as they are produced; nil means no zip output
+var archive *zipArchive
+
+// zipArchive streams finished outputs into a zip file. All methods are safe
+// for concurrent use and on a nil receiver.
+type zipArchive struct {
+	mu     sync.Mutex
+	file   *os.File
+	crypt  io.WriteCloser
+	writer *zip.Writer
+	layout string
+	root   string
+	names  map[string]bool
+	// checksums holds "sha256  name" lines in the order entries were added
+	checksums []string
+}
+
+// createZipArchive creates the zip file at path. With the tree layout,
+// entries keep their source directory relative to root. When recipients
+// are given the whole zip is age-encrypted to them.
+func createZipArchive(path, layout, root string, recipients ...age.Recipient) (*zipArchive, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = file
+	var crypt io.WriteCloser
+	if len(recipients) > 0 {
+		crypt, err = age.Encrypt(file, recipients...)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		w = crypt
+	}
+	a := newZipArchive(w, layout, root)
+	a.file, a.crypt = file, crypt
+	return a, nil
+}
+
+// newZipArchive streams a zip into w, which Close leaves open
+func newZipArchive(w io.Writer, layout, root string) *zipArchive {
+	return &zipArchive{
+		writer: zip.NewWriter(w),
+		layout: layout,
+		root:   root,
+		names:  make(map[string]bool),
+	}
+}
+
+// zipRecipients builds the age recipients from public keys and an optional
+// environment variable holding a passphrase
+func zipRecipients(keys []string, passphraseEnv string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, key := range keys {
+		r, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	if passphraseEnv != "" {
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("environment variable %s is empty", passphraseEnv)
+		}
+		// age only allows a passphrase as the sole recipient
+		if len(recipients) > 0 {
+			return nil, fmt.Errorf("a passphrase cannot be combined with recipients")
+		}
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// entryName returns a unique name inside the archive for an output
+func (a *zipArchive) entryName(inputPath, outputPath string) string {
+	name := filepath.Base(outputPath)
+	if a.layout == zipLayoutTree {
+		if rel, err := filepath.Rel(a.root, filepath.Dir(inputPath)); err == nil && !strings.HasPrefix(rel, "..") {
+			name = path.Join(filepath.ToSlash(rel), name)
+		}
+	}
+
+	// Never write two entries with the same name
+	unique := name
+	ext := path.Ext(name)
+	for i := 1; a.names[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	a.names[unique] = true
+	return unique
+}
+
+// add copies the output file into the archive
+func (a *zipArchive) add(inputPath, outputPath string) error {
+	if a == nil {
+		return nil
+	}
+	_, err := a.addEntry(inputPath, outputPath)
+	return err
+}
+
+// addEntry copies the output file into the archive and returns its name
+// there
+func (a *zipArchive) addEntry(inputPath, outputPath string) (string, error) {
+	src, err := os.Open(outputPath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return "", err
+	}
+	header.Name = a.entryName(inputPath, outputPath)
+	// Already compressed image formats gain nothing from deflate
+	header.Method = zip.Store
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".bmp", ".tif", ".tiff":
+		header.Method = zip.Deflate
+	}
+
+	w, err := a.writer.CreateHeader(header)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), src); err != nil {
+		return "", err
+	}
+	a.checksums = append(a.checksums, fmt.Sprintf("%x  %s", hash.Sum(nil), header.Name))
+	return header.Name, nil
+}
+
+// writeManifest adds a SHA256SUMS file, in sha256sum format, and the given
+// README text to the archive
+func (a *zipArchive) writeManifest(readme string) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sums := strings.Join(a.checksums, "\n")
+	if sums != "" {
+		sums += "\n"
+	}
+	files := []struct{ name, content string }{
+		{"SHA256SUMS", sums},
+		{"README.txt", readme},
+	}
+	for _, f := range files {
+		if err := a.create(f.name, f.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile adds a file named name holding content to the archive
+func (a *zipArchive) writeFile(name, content string) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.create(name, content)
+}
+
+// create adds a file with the lock held
+func (a *zipArchive) create(name, content string) error {
+	w, err := a.writer.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, content)
+	return err
+}
+
+// Close finishes the zip file
+func (a *zipArchive) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.writer.Close(); err != nil {
+		if a.file != nil {
+			a.file.Close()
+		}
+		return err
+	}
+	if a.file == nil {
+		return nil
+	}
+	if a.crypt != nil {
+		if err := a.crypt.Close(); err != nil {
+			a.file.Close()
+			return err
+		}
+	}
+	return a.file.Close()
+}
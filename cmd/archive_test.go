@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestZipArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	inputRoot := filepath.Join(tempDir, "in")
+	outputDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	outputs := map[string]string{"a.jpg": "aaa", "b.jpg": "bbb"}
+	for name, content := range outputs {
+		if err := os.WriteFile(filepath.Join(outputDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create output: %v", err)
+		}
+	}
+
+	tests := []struct {
+		layout   string
+		expected []string
+	}{
+		{zipLayoutFlat, []string{"a.jpg", "b.jpg", "b_1.jpg"}},
+		{zipLayoutTree, []string{"a.jpg", "x/b.jpg", "y/b.jpg"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.layout, func(t *testing.T) {
+			zipPath := filepath.Join(tempDir, test.layout+".zip")
+			a, err := createZipArchive(zipPath, test.layout, inputRoot)
+			if err != nil {
+				t.Fatalf("createZipArchive() error = %v", err)
+			}
+
+			adds := [][2]string{
+				{filepath.Join(inputRoot, "a.png"), filepath.Join(outputDir, "a.jpg")},
+				{filepath.Join(inputRoot, "x", "b.png"), filepath.Join(outputDir, "b.jpg")},
+				{filepath.Join(inputRoot, "y", "b.png"), filepath.Join(outputDir, "b.jpg")},
+			}
+			for _, add := range adds {
+				if err := a.add(add[0], add[1]); err != nil {
+					t.Fatalf("add() error = %v", err)
+				}
+			}
+			if err := a.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			r, err := zip.OpenReader(zipPath)
+			if err != nil {
+				t.Fatalf("zip.OpenReader() error = %v", err)
+			}
+			defer r.Close()
+
+			if len(r.File) != len(test.expected) {
+				t.Fatalf("zip has %d entries, expected %d", len(r.File), len(test.expected))
+			}
+			for i, f := range r.File {
+				if f.Name != test.expected[i] {
+					t.Errorf("zip entry %d = %s, expected %s", i, f.Name, test.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestZipArchiveNil(t *testing.T) {
+	var a *zipArchive
+	if err := a.add("in.jpg", "out.jpg"); err != nil {
+		t.Errorf("nil zipArchive add() error = %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("nil zipArchive Close() error = %v", err)
+	}
+}
+
+func TestZipArchiveManifest(t *testing.T) {
+	tempDir := t.TempDir()
+	outputPath := filepath.Join(tempDir, "a.jpg")
+	if err := os.WriteFile(outputPath, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Failed to create output: %v", err)
+	}
+
+	zipPath := filepath.Join(tempDir, "album.zip")
+	a, err := createZipArchive(zipPath, zipLayoutFlat, tempDir)
+	if err != nil {
+		t.Fatalf("createZipArchive() error = %v", err)
+	}
+	if err := a.add(filepath.Join(tempDir, "a.png"), outputPath); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	if err := a.writeManifest("summary\n"); err != nil {
+		t.Fatalf("writeManifest() error = %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatalf("zip.OpenReader() error = %v", err)
+	}
+	defer r.Close()
+
+	contents := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(data)
+	}
+
+	// sha256("hello")
+	expected := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  a.jpg\n"
+	if contents["SHA256SUMS"] != expected {
+		t.Errorf("SHA256SUMS = %q, expected %q", contents["SHA256SUMS"], expected)
+	}
+	if contents["README.txt"] != "summary\n" {
+		t.Errorf("README.txt = %q, expected %q", contents["README.txt"], "summary\n")
+	}
+}
+
+func TestZipArchiveEncrypted(t *testing.T) {
+	tempDir := t.TempDir()
+	outputPath := filepath.Join(tempDir, "a.jpg")
+	if err := os.WriteFile(outputPath, []byte("secret photo"), 0644); err != nil {
+		t.Fatalf("Failed to create output: %v", err)
+	}
+
+	t.Setenv("TEST_ZIP_PASS", "correct horse battery staple")
+	recipients, err := zipRecipients(nil, "TEST_ZIP_PASS")
+	if err != nil {
+		t.Fatalf("zipRecipients() error = %v", err)
+	}
+
+	zipPath := filepath.Join(tempDir, "album.zip.age")
+	a, err := createZipArchive(zipPath, zipLayoutFlat, tempDir, recipients...)
+	if err != nil {
+		t.Fatalf("createZipArchive() error = %v", err)
+	}
+	if err := a.add(outputPath, outputPath); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	encrypted, err := os.ReadFile(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to read encrypted zip: %v", err)
+	}
+	if bytes.Contains(encrypted, []byte("secret photo")) {
+		t.Error("encrypted zip contains plaintext")
+	}
+
+	identity, err := age.NewScryptIdentity("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("age.NewScryptIdentity() error = %v", err)
+	}
+	plain, err := age.Decrypt(bytes.NewReader(encrypted), identity)
+	if err != nil {
+		t.Fatalf("age.Decrypt() error = %v", err)
+	}
+	data, err := io.ReadAll(plain)
+	if err != nil {
+		t.Fatalf("Failed to decrypt zip: %v", err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	if len(r.File) != 1 || r.File[0].Name != "a.jpg" {
+		t.Errorf("decrypted zip entries = %d, expected a.jpg", len(r.File))
+	}
+}
+
+func TestZipRecipients(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("age.GenerateX25519Identity() error = %v", err)
+	}
+	key := identity.Recipient().String()
+
+	if recipients, err := zipRecipients([]string{key}, ""); err != nil || len(recipients) != 1 {
+		t.Errorf("zipRecipients(key) = %d, %v, expected 1 recipient", len(recipients), err)
+	}
+	if _, err := zipRecipients([]string{"not-a-key"}, ""); err == nil {
+		t.Error("zipRecipients(invalid key) expected error, got nil")
+	}
+	if _, err := zipRecipients(nil, "TEST_ZIP_PASS_UNSET"); err == nil {
+		t.Error("zipRecipients(empty env) expected error, got nil")
+	}
+
+	t.Setenv("TEST_ZIP_PASS", "pass")
+	if _, err := zipRecipients([]string{key}, "TEST_ZIP_PASS"); err == nil {
+		t.Error("zipRecipients(key and passphrase) expected error, got nil")
+	}
+}
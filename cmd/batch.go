@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// maxBatchFiles is the most images an archive POSTed to /batch may hold
+const maxBatchFiles = 10000
+
+// batchResults is the name of the results in the archive /batch returns,
+// one line of --json per image
+const batchResults = "results.json"
+
+// batchHandler processes the images of zip archives POSTed to /batch and
+// streams back a zip of the outputs
+type batchHandler struct {
+	secret  []byte
+	config  processor.Config
+	process func(string, processor.Config) (processor.Result, error)
+	limits  serveLimits
+	// archive is the largest archive accepted, in bytes
+	archive int64
+	// slots is shared with the webhook handler
+	slots chan struct{}
+}
+
+// newBatchHandler returns a handler for archives verified with secret and
+// processed with config, one image at a time in the slots of webhook
+func newBatchHandler(webhook *webhookHandler, archive int64) *batchHandler {
+	return &batchHandler{
+		secret:  webhook.secret,
+		config:  webhook.config,
+		process: webhook.process,
+		limits:  webhook.limits,
+		archive: archive,
+		slots:   webhook.slots,
+	}
+}
+
+func (h *batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	preset := r.URL.Query().Get("preset")
+	if err := validatePreset(preset); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mac, err := newRequestMAC(h.secret, r.Header.Get(timestampHeader), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "picture-resize-batch-")
+	if err != nil {
+		http.Error(w, "temporary directory cannot be created", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// The archive is spooled to disk while its signature is computed
+	body, err := os.Create(filepath.Join(dir, "request.zip"))
+	if err != nil {
+		http.Error(w, "temporary file cannot be created", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+	size, err := io.Copy(io.MultiWriter(body, mac), http.MaxBytesReader(w, r.Body, h.archive))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("archive is larger than %s", formatBytes(h.archive)), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "archive cannot be read", http.StatusBadRequest)
+		return
+	}
+	if !matchesSignature(mac.Sum(nil), r.Header.Get(signatureHeader)) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	reader, err := zip.NewReader(body, size)
+	if err != nil {
+		http.Error(w, "body must be a zip archive", http.StatusBadRequest)
+		return
+	}
+	entries, err := h.entries(reader)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errSourceTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	inDir, outDir := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		http.Error(w, "temporary directory cannot be created", http.StatusInternalServerError)
+		return
+	}
+	config := h.config
+	config.OutputDir = outDir
+	process := structureProcessor(inDir, safeNames, h.process)
+
+	// Errors after the first byte can only be reported in the results
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="results.zip"`)
+	out := newZipArchive(w, zipLayoutTree, inDir)
+	flusher, _ := w.(http.Flusher)
+	var results bytes.Buffer
+	encoder := json.NewEncoder(&results)
+	var failed int
+	for _, entry := range entries {
+		file := h.processEntry(entry, inDir, preset, config, process, out)
+		if file.Error != "" {
+			failed++
+		}
+		encoder.Encode(file)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if err := out.writeFile(batchResults, results.String()); err != nil {
+		logger.Error("Failed to write batch results", "error", err)
+	}
+	if err := out.Close(); err != nil {
+		logger.Error("Failed to finish batch archive", "error", err)
+	}
+	logger.Info("Processed batch", "images", len(entries), "failed", failed)
+}
+
+// entries returns the images of an archive, rejecting archives with too
+// many of them, with larger ones than a download or with names leading out
+// of it. Other files are left out.
+func (h *batchHandler) entries(reader *zip.Reader) ([]*zip.File, error) {
+	var entries []*zip.File
+	for _, f := range reader.File {
+		name := f.Name
+		if f.FileInfo().IsDir() || !isInputExtension(filepath.Ext(name)) {
+			continue
+		}
+		// Resource forks of archives made on macOS
+		if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(filepath.Base(name), "._") {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) || strings.Contains(name, `\`) {
+			return nil, fmt.Errorf("archive entry %s is outside the archive", name)
+		}
+		if f.UncompressedSize64 > uint64(h.limits.download) {
+			return nil, fmt.Errorf("%w: %s is larger than %s", errSourceTooLarge, name, formatBytes(h.limits.download))
+		}
+		if entries = append(entries, f); len(entries) > maxBatchFiles {
+			return nil, fmt.Errorf("archive holds more than %d images", maxBatchFiles)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("archive holds no supported images")
+	}
+	return entries, nil
+}
+
+// processEntry extracts an image of the archive into inDir, processes it
+// with the preset and adds its outputs to out. Outputs are removed once
+// added.
+func (h *batchHandler) processEntry(entry *zip.File, inDir, preset string, config processor.Config, process func(string, processor.Config) (processor.Result, error), out *zipArchive) jsonFile {
+	start := time.Now()
+	path := filepath.Join(inDir, filepath.FromSlash(entry.Name))
+	result, err := h.extract(entry, path)
+	if err == nil {
+		// Each image keeps its format like a webhook source
+		ext := strings.ToLower(filepath.Ext(path))
+		config.KeepFormat = !forceConvert && ext != ".heic" && ext != ".heif"
+		if p, ok := presets[preset]; ok {
+			config = p.applyConfig(config)
+		}
+		h.slots <- struct{}{}
+		result, err = process(path, h.limits.clamp(config))
+		<-h.slots
+	}
+	os.Remove(path)
+
+	file := newJSONFile(fileResult{Result: result, path: entry.Name, duration: time.Since(start), err: err})
+	if err != nil {
+		logger.Error("Processing failed", "source", entry.Name, "error", err)
+		return file
+	}
+	// Outputs are named as in the returned archive
+	names := make(map[string]string)
+	for _, output := range result.Outputs() {
+		name, err := out.addEntry(path, output)
+		os.Remove(output)
+		if err != nil {
+			file.Error = err.Error()
+			return file
+		}
+		names[output] = name
+	}
+	file.Output = names[file.Output]
+	for i, page := range file.Pages {
+		file.Pages[i] = names[page]
+	}
+	for i, sidecar := range file.Sidecars {
+		file.Sidecars[i] = names[sidecar]
+	}
+	return file
+}
+
+// extract writes the archive entry to path, failing with errSourceTooLarge
+// if it holds more than a download may
+func (h *batchHandler) extract(entry *zip.File, path string) (processor.Result, error) {
+	result := processor.Result{InputPath: path}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return result, err
+	}
+	src, err := entry.Open()
+	if err != nil {
+		return result, err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return result, err
+	}
+	// The size in the header may lie
+	n, err := io.Copy(dst, io.LimitReader(src, h.limits.download+1))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > h.limits.download {
+		err = fmt.Errorf("%w: %s is larger than %s", errSourceTooLarge, entry.Name, formatBytes(h.limits.download))
+	}
+	result.InputSize = n
+	return result, err
+}
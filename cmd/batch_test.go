@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// zipOf returns a zip archive of the named files
+func zipOf(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		f.Write(content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBatchHandler(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewNRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	secret := []byte("secret")
+	config := processor.Config{OutputFormat: "jpg", MaxWidth: 100, MaxHeight: 100, Quality: 90, OutputDir: t.TempDir()}
+	handler := newBatchHandler(newWebhookHandler(t.TempDir(), secret, config), 1<<20)
+
+	images := zipOf(t, map[string][]byte{"a.png": img.Bytes(), "day1/b.png": img.Bytes(), "broken.png": []byte("not a png"), "notes.txt": []byte("skipped")})
+	tests := []struct {
+		name    string
+		target  string
+		body    []byte
+		signed  bool
+		limit   int64
+		status  int
+		outputs []string
+	}{
+		{"Archive with a preset", "/batch?preset=email", images, true, 1 << 20, http.StatusOK, []string{"a.jpg", "day1/b.jpg"}},
+		{"Unsigned", "/batch", images, false, 1 << 20, http.StatusUnauthorized, nil},
+		{"Unknown preset", "/batch?preset=poster", images, true, 1 << 20, http.StatusBadRequest, nil},
+		{"Archive too large", "/batch", images, true, 100, http.StatusRequestEntityTooLarge, nil},
+		{"Not a zip", "/batch", []byte("a.png"), true, 1 << 20, http.StatusBadRequest, nil},
+		{"Outside the archive", "/batch", zipOf(t, map[string][]byte{"../a.png": img.Bytes()}), true, 1 << 20, http.StatusBadRequest, nil},
+		{"No images", "/batch", zipOf(t, map[string][]byte{"notes.txt": nil}), true, 1 << 20, http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		handler.archive = test.limit
+		req := httptest.NewRequest(http.MethodPost, test.target, bytes.NewReader(test.body))
+		if test.signed {
+			signRequest(req, secret, test.body)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s: status = %d, expected %d (%s)", test.name, rec.Code, test.status, rec.Body.String())
+			continue
+		}
+		if test.outputs == nil {
+			continue
+		}
+
+		reader, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if err != nil {
+			t.Fatalf("%s: response is not a zip: %v", test.name, err)
+		}
+		var names []string
+		var results []jsonFile
+		for _, f := range reader.File {
+			if f.Name != batchResults {
+				names = append(names, f.Name)
+				continue
+			}
+			rc, _ := f.Open()
+			scanner := bufio.NewScanner(rc)
+			for scanner.Scan() {
+				var file jsonFile
+				if err := json.Unmarshal(scanner.Bytes(), &file); err != nil {
+					t.Fatalf("%s: result is not JSON: %v", test.name, err)
+				}
+				results = append(results, file)
+			}
+			rc.Close()
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, test.outputs) {
+			t.Errorf("%s: entries = %v, expected %v", test.name, names, test.outputs)
+		}
+		var failed []string
+		for _, file := range results {
+			if file.Error != "" {
+				failed = append(failed, file.Input)
+			} else if !slices.Contains(test.outputs, file.Output) {
+				t.Errorf("%s: output of %s = %q, expected an entry", test.name, file.Input, file.Output)
+			}
+		}
+		if len(results) != 3 || !slices.Equal(failed, []string{"broken.png"}) {
+			t.Errorf("%s: %d results with failures %v, expected 3 with broken.png", test.name, len(results), failed)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// cameraRules apply presets to files by the camera model in their EXIF
+// data; nil means none
+var cameraRules []cameraRule
+
+// cameraRule applies a preset to the files of matching cameras
+type cameraRule struct {
+	// pattern matches the lower-case camera model, with * and ? wildcards
+	pattern string
+	preset  string
+}
+
+// parseCameraRules parses --camera-preset values of the form MODEL=PRESET,
+// such as "iPhone 15*=email"
+func parseCameraRules(values []string) ([]cameraRule, error) {
+	var rules []cameraRule
+	for _, value := range values {
+		model, name, ok := strings.Cut(value, "=")
+		model, name = strings.TrimSpace(model), strings.TrimSpace(name)
+		if !ok || model == "" || name == "" {
+			return nil, fmt.Errorf("%q is not MODEL=PRESET", value)
+		}
+		pattern := strings.ToLower(model)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q has an invalid model pattern", value)
+		}
+		if err := validatePreset(name); err != nil {
+			return nil, err
+		}
+		rules = append(rules, cameraRule{pattern: pattern, preset: name})
+	}
+	return rules, nil
+}
+
+// matchCameraRule returns the preset of the first rule matching model
+func matchCameraRule(rules []cameraRule, model string) (preset, bool) {
+	if model == "" {
+		return preset{}, false
+	}
+	model = strings.ToLower(model)
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.pattern, model); ok {
+			return presets[rule.preset], true
+		}
+	}
+	return preset{}, false
+}
+
+// cameraProcessor wraps process to apply the preset matching the camera
+// model of each file. Files without a model or a match keep the batch
+// settings.
+func cameraProcessor(rules []cameraRule, process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		model, _ := processor.CameraModel(path)
+		if p, ok := matchCameraRule(rules, model); ok {
+			config = p.applyConfig(config)
+		}
+		return process(path, config)
+	}
+}
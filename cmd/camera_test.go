@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestParseCameraRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		wantErr bool
+	}{
+		{"None", nil, false},
+		{"Exact and wildcard", []string{"iPhone 15 Pro=email", " Perfection V* = email"}, false},
+		{"Missing preset", []string{"iPhone 15 Pro"}, true},
+		{"Empty model", []string{"=email"}, true},
+		{"Unknown preset", []string{"iPhone 15 Pro=hdr"}, true},
+		{"Bad pattern", []string{"iPhone [15=email"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseCameraRules(test.values)
+			if (err != nil) != test.wantErr {
+				t.Errorf("parseCameraRules(%q) error = %v, wantErr %v", test.values, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchCameraRule(t *testing.T) {
+	rules, err := parseCameraRules([]string{"iPhone 15*=email"})
+	if err != nil {
+		t.Fatalf("parseCameraRules() error = %v", err)
+	}
+
+	tests := []struct {
+		model string
+		match bool
+	}{
+		{"iPhone 15 Pro", true},
+		{"IPHONE 15", true},
+		{"iPhone 14", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if p, ok := matchCameraRule(rules, test.model); ok != test.match || (ok && p.maxWidth != presets["email"].maxWidth) {
+			t.Errorf("matchCameraRule(%q) = %+v, %t, expected %t", test.model, p, ok, test.match)
+		}
+	}
+}
+
+func TestCameraProcessor(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A JPEG whose EXIF data only has the model
+	tiff := binary.LittleEndian.AppendUint32([]byte("II*\x00"), 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	for _, v := range []uint16{272, 2} {
+		tiff = binary.LittleEndian.AppendUint16(tiff, v)
+	}
+	for _, v := range []uint32{14, 26, 0} {
+		tiff = binary.LittleEndian.AppendUint32(tiff, v)
+	}
+	tiff = append(tiff, "iPhone 15 Pro\x00"...)
+	iphone := filepath.Join(tempDir, "iphone.jpg")
+	if err := os.WriteFile(iphone, append([]byte("\xff\xd8\xff\xe1\x00\x00Exif\x00\x00"), tiff...), 0644); err != nil {
+		t.Fatalf("Failed to create JPEG: %v", err)
+	}
+	other := filepath.Join(tempDir, "other.jpg")
+	if err := os.WriteFile(other, []byte("\xff\xd8\xff\xd9"), 0644); err != nil {
+		t.Fatalf("Failed to create JPEG: %v", err)
+	}
+
+	rules, _ := parseCameraRules([]string{"iphone 15*=email"})
+	var seen processor.Config
+	process := cameraProcessor(rules, func(path string, config processor.Config) (processor.Result, error) {
+		seen = config
+		return processor.Result{}, nil
+	})
+	batch := processor.Config{OutputFormat: "png", MaxWidth: 4000, MaxHeight: 4000, Quality: 95, KeepFormat: true}
+
+	process(iphone, batch)
+	email := presets["email"]
+	if seen.MaxWidth != email.maxWidth || seen.Quality != email.quality || seen.OutputFormat != email.format || seen.KeepFormat {
+		t.Errorf("config of iphone.jpg = %+v, expected the email preset", seen)
+	}
+
+	process(other, batch)
+	if seen.MaxWidth != 4000 || seen.Quality != 95 || !seen.KeepFormat {
+		t.Errorf("config of other.jpg = %+v, expected the batch settings", seen)
+	}
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// timeFix corrects the capture times read from EXIF data; nil leaves them
+// as recorded
+var timeFix *timeCorrection
+
+// timeCorrection fixes capture times of cameras with wrong clocks
+type timeCorrection struct {
+	// shift is added to the clock reading
+	shift time.Duration
+	// zone is the time zone the camera clock was set to; nil keeps the
+	// recorded offset or the local zone
+	zone *time.Location
+}
+
+// parseTimeCorrection parses --shift-time and --set-timezone, returning
+// nil when both are empty
+func parseTimeCorrection(shift, zone string) (*timeCorrection, error) {
+	if shift == "" && zone == "" {
+		return nil, nil
+	}
+	fix := &timeCorrection{}
+	if shift != "" {
+		d, err := time.ParseDuration(shift)
+		if err != nil {
+			return nil, fmt.Errorf("shift time must be a duration such as +8h or -1h30m, got: %s", shift)
+		}
+		fix.shift = d
+	}
+	if zone != "" {
+		location, err := parseTimezone(zone)
+		if err != nil {
+			return nil, fmt.Errorf("timezone must be an offset such as +08:00 or a zone name such as Asia/Shanghai, got: %s", zone)
+		}
+		fix.zone = location
+	}
+	return fix, nil
+}
+
+// parseTimezone parses a UTC offset such as "+08:00" or "-0530", or an
+// IANA zone name such as "Asia/Shanghai"
+func parseTimezone(zone string) (*time.Location, error) {
+	if strings.HasPrefix(zone, "+") || strings.HasPrefix(zone, "-") {
+		for _, layout := range []string{"-07:00", "-0700", "-07"} {
+			if t, err := time.Parse(layout, zone); err == nil {
+				_, offset := t.Zone()
+				return time.FixedZone(t.Format("-07:00"), offset), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid offset %q", zone)
+	}
+	return time.LoadLocation(zone)
+}
+
+// apply shifts the clock reading of t and then places it in the zone of
+// the correction, keeping the reading
+func (c *timeCorrection) apply(t time.Time) time.Time {
+	t = t.Add(c.shift)
+	if c.zone != nil {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), c.zone)
+	}
+	return t
+}
+
+// captureTime returns when the image at path was taken, corrected by
+// timeFix, or the zero time if its EXIF data has none
+func captureTime(path string) (time.Time, error) {
+	t, err := processor.CaptureTime(path)
+	if err != nil || t.IsZero() || timeFix == nil {
+		return t, err
+	}
+	return timeFix.apply(t), nil
+}
+
+// captureTimeProcessor wraps process to record the corrected capture time
+// of each file in its outputs. Files without one are left as they are.
+func captureTimeProcessor(process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		captured, err := captureTime(path)
+		switch {
+		case err != nil:
+			return processor.Result{InputPath: path}, err
+		case captured.IsZero():
+			logger.Warn("No capture time to correct", "file", path)
+		default:
+			logger.Debug("Capture time corrected", "file", path, "time", captured.Format(time.RFC3339))
+			config.CaptureTime = captured
+		}
+		return process(path, config)
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeCorrection(t *testing.T) {
+	tests := []struct {
+		name    string
+		shift   string
+		zone    string
+		isNil   bool
+		wantErr bool
+	}{
+		{"None", "", "", true, false},
+		{"Positive shift", "+8h", "", false, false},
+		{"Negative shift", "-1h30m", "", false, false},
+		{"Offset", "", "+08:00", false, false},
+		{"Offset without colon", "", "-0530", false, false},
+		{"Zone name", "", "Asia/Shanghai", false, false},
+		{"UTC", "", "UTC", false, false},
+		{"Shift without unit", "8", "", false, true},
+		{"Days", "+1d", "", false, true},
+		{"Offset out of range", "", "+25:00", false, true},
+		{"Unknown zone", "", "Mars/Olympus", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fix, err := parseTimeCorrection(test.shift, test.zone)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseTimeCorrection(%q, %q) error = %v, wantErr %v", test.shift, test.zone, err, test.wantErr)
+			}
+			if err == nil && (fix == nil) != test.isNil {
+				t.Errorf("parseTimeCorrection(%q, %q) = %v, expected nil %t", test.shift, test.zone, fix, test.isNil)
+			}
+		})
+	}
+}
+
+func TestTimeCorrectionApply(t *testing.T) {
+	// A camera clock set to UTC+2 while travelling in UTC+8
+	recorded := time.Date(2024, 5, 1, 3, 30, 0, 0, time.FixedZone("+02:00", 2*3600))
+
+	tests := []struct {
+		name     string
+		shift    string
+		zone     string
+		expected string
+	}{
+		{"Shift keeps the recorded offset", "+6h", "", "2024-05-01T09:30:00+02:00"},
+		{"Shift across midnight", "-4h", "", "2024-04-30T23:30:00+02:00"},
+		{"Zone keeps the clock reading", "", "+08:00", "2024-05-01T03:30:00+08:00"},
+		{"Shift then zone", "+6h", "+08:00", "2024-05-01T09:30:00+08:00"},
+		{"Zone name", "+6h", "Asia/Shanghai", "2024-05-01T09:30:00+08:00"},
+		{"Zone name with daylight saving", "", "Europe/Berlin", "2024-05-01T03:30:00+02:00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fix, err := parseTimeCorrection(test.shift, test.zone)
+			if err != nil {
+				t.Fatalf("parseTimeCorrection() error = %v", err)
+			}
+			if got := fix.apply(recorded).Format(time.RFC3339); got != test.expected {
+				t.Errorf("apply() = %s, expected %s", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// checkpointFileName is the file in the output directory that records the
+// inputs whose outputs have been flushed and verified
+const checkpointFileName = ".picture-resize-checkpoint.json"
+
+// checkpoints commits outputs in chunks for the current run; nil disables
+var checkpoints *checkpointer
+
+// checkpointState is the content of the checkpoint file
+type checkpointState struct {
+	KeepFormat bool     `json:"keep_format"`
+	Chunks     int      `json:"chunks"`
+	Files      []string `json:"files"`
+}
+
+// pendingOutput is an output written since the last checkpoint
+type pendingOutput struct {
+	input  string
+	output string
+	size   int64
+}
+
+// checkpointer flushes and verifies outputs in chunks of size files and
+// records the committed inputs, so an interrupted run loses at most one
+// chunk. All methods are safe on a nil receiver.
+type checkpointer struct {
+	mu      sync.Mutex
+	dir     string
+	size    int
+	state   checkpointState
+	pending []pendingOutput
+	failed  map[string]bool
+}
+
+// newCheckpointer creates a checkpointer writing to dir that continues
+// after the files already committed in state
+func newCheckpointer(dir string, size int, state checkpointState) *checkpointer {
+	if size <= 0 {
+		return nil
+	}
+	return &checkpointer{dir: dir, size: size, state: state, failed: make(map[string]bool)}
+}
+
+// record adds a written output and commits the chunk once it is full
+func (c *checkpointer) record(input, output string, size int64) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = append(c.pending, pendingOutput{input: input, output: output, size: size})
+	if len(c.pending) < c.size {
+		return nil
+	}
+	return c.commit()
+}
+
+// flush commits the outputs of a partial chunk
+func (c *checkpointer) flush() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) == 0 {
+		return nil
+	}
+	return c.commit()
+}
+
+// unverified reports whether the output of input failed verification
+func (c *checkpointer) unverified(input string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.failed[input]
+}
+
+// commit syncs and verifies the pending outputs and writes the checkpoint.
+// Outputs that fail verification are left out so a resumed run redoes them.
+func (c *checkpointer) commit() error {
+	for _, p := range c.pending {
+		if err := syncAndVerify(p.output, p.size); err != nil {
+			logger.Error("Checkpoint verification failed", "file", p.output, "error", err)
+			c.failed[p.input] = true
+			continue
+		}
+		delete(c.failed, p.input)
+		c.state.Files = append(c.state.Files, p.input)
+	}
+	c.pending = nil
+	c.state.Chunks++
+	return saveCheckpoint(c.dir, c.state)
+}
+
+// syncAndVerify flushes path to stable storage and checks its size. It is
+// opened read-only, outputs may have been written without write permission.
+func syncAndVerify(path string, size int64) error {
+	file, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != size {
+		return fmt.Errorf("size is %d bytes, expected %d", info.Size(), size)
+	}
+	return nil
+}
+
+// loadCheckpoint reads the checkpoint file from dir. It returns nil when
+// there is no checkpoint.
+func loadCheckpoint(dir string) (*checkpointState, error) {
+	data, err := os.ReadFile(filepath.Join(dir, checkpointFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file: %v", err)
+	}
+	return &state, nil
+}
+
+// saveCheckpoint replaces the checkpoint file in dir. The new content is
+// synced before the rename so the file is never seen half-written.
+func saveCheckpoint(dir string, state checkpointState) error {
+	// Files processed again by an attachment limit retry appear only once
+	sort.Strings(state.Files)
+	files := state.Files[:0]
+	for i, f := range state.Files {
+		if i == 0 || f != state.Files[i-1] {
+			files = append(files, f)
+		}
+	}
+	state.Files = files
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, checkpointFileName)
+	tmp, err := os.CreateTemp(dir, checkpointFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeCheckpoint deletes the checkpoint file from dir
+func removeCheckpoint(dir string) error {
+	err := os.Remove(filepath.Join(dir, checkpointFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// remainingFiles returns the files that are not in done
+func remainingFiles(files, done []string) []string {
+	skip := make(map[string]bool, len(done))
+	for _, f := range done {
+		skip[f] = true
+	}
+	var remaining []string
+	for _, f := range files {
+		if !skip[f] {
+			remaining = append(remaining, f)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpointer(t *testing.T) {
+	var disabled *checkpointer
+	if err := disabled.record("a.jpg", "out/a.jpg", 1); err != nil || disabled.unverified("a.jpg") {
+		t.Error("nil checkpointer should ignore records")
+	}
+	if newCheckpointer(t.TempDir(), 0, checkpointState{}) != nil {
+		t.Error("newCheckpointer() with size 0 should return nil")
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	a := write("a.jpg", "aaaa")
+	b := write("b.jpg", "bb")
+	c := write("c.jpg", "c")
+
+	cp := newCheckpointer(dir, 2, checkpointState{KeepFormat: true, Chunks: 1, Files: []string{"in/old.jpg"}})
+	if err := cp.record("in/a.jpg", a, 4); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+	if state, _ := loadCheckpoint(dir); state != nil {
+		t.Fatal("checkpoint written before the chunk was full")
+	}
+
+	// The size mismatch stands in for an output lost on the way to the server
+	if err := cp.record("in/b.jpg", b, 3); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+	if !cp.unverified("in/b.jpg") || cp.unverified("in/a.jpg") {
+		t.Error("unverified() should report only in/b.jpg")
+	}
+
+	if err := cp.record("in/c.jpg", c, 1); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+	if err := cp.record("in/a.jpg", a, 4); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+	if err := cp.flush(); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+
+	state, err := loadCheckpoint(dir)
+	if err != nil || state == nil {
+		t.Fatalf("loadCheckpoint() = %v, %v", state, err)
+	}
+	expected := checkpointState{KeepFormat: true, Chunks: 3, Files: []string{"in/a.jpg", "in/c.jpg", "in/old.jpg"}}
+	if !reflect.DeepEqual(*state, expected) {
+		t.Errorf("loadCheckpoint() = %+v, expected %+v", *state, expected)
+	}
+
+	if err := removeCheckpoint(dir); err != nil {
+		t.Fatalf("removeCheckpoint() error = %v", err)
+	}
+	if state, _ := loadCheckpoint(dir); state != nil {
+		t.Error("checkpoint still present after removeCheckpoint()")
+	}
+}
+
+func TestSyncAndVerifyReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.jpg")
+	if err := os.WriteFile(path, []byte("aaaa"), 0444); err != nil {
+		t.Fatalf("Failed to write output: %v", err)
+	}
+	if err := syncAndVerify(path, 4); err != nil {
+		t.Errorf("syncAndVerify() error = %v for a read-only output", err)
+	}
+	if err := syncAndVerify(path, 3); err == nil {
+		t.Error("syncAndVerify() expected a size mismatch error, got nil")
+	}
+}
+
+func TestRemainingFiles(t *testing.T) {
+	remaining := remainingFiles([]string{"a.jpg", "b.jpg", "c.jpg"}, []string{"b.jpg", "x.jpg"})
+	if !reflect.DeepEqual(remaining, []string{"a.jpg", "c.jpg"}) {
+		t.Errorf("remainingFiles() = %v, expected [a.jpg c.jpg]", remaining)
+	}
+}
@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"image"
+	"image/png"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"testing"
+
+	"github.com/spf13/cobra"
 )
 
 func TestValidateInputs(t *testing.T) {
@@ -33,10 +39,10 @@ func TestValidateInputs(t *testing.T) {
 			name: "Invalid output format",
 			setupFunc: func() {
 				inputDir = tempDir
-				outputFormat = "gif"
+				outputFormat = "bmp"
 			},
 			expectError: true,
-			errorMsg:    "output format must be jpg or png",
+			errorMsg:    "output format must be one of jpg, png, avif, heic, gif, webp",
 		},
 		{
 			name: "Nonexistent input directory",
@@ -91,6 +97,685 @@ func TestValidateInputs(t *testing.T) {
 			expectError: true,
 			errorMsg:    "worker count must be positive",
 		},
+		{
+			name: "Invalid max output size",
+			setupFunc: func() {
+				inputDir = tempDir
+				maxOutputSize = "lots"
+			},
+			expectError: true,
+			errorMsg:    "max output size is invalid",
+		},
+		{
+			name: "Zero max output size",
+			setupFunc: func() {
+				inputDir = tempDir
+				maxOutputSize = "0MB"
+			},
+			expectError: true,
+			errorMsg:    "max output size must be more than 0 bytes",
+		},
+		{
+			name: "Unknown preset",
+			setupFunc: func() {
+				inputDir = tempDir
+				presetName = "poster"
+			},
+			expectError: true,
+			errorMsg:    "unknown preset poster",
+		},
+		{
+			name: "Invalid attachment limit",
+			setupFunc: func() {
+				inputDir = tempDir
+				attachLimit = "huge"
+			},
+			expectError: true,
+			errorMsg:    "attachment limit is invalid",
+		},
+		{
+			name: "Zero attachment limit",
+			setupFunc: func() {
+				inputDir = tempDir
+				attachLimit = "0"
+			},
+			expectError: true,
+			errorMsg:    "attachment limit must be more than 0 bytes",
+		},
+		{
+			name: "Invalid zip layout",
+			setupFunc: func() {
+				inputDir = tempDir
+				zipLayout = "nested"
+			},
+			expectError: true,
+			errorMsg:    "zip layout must be flat or tree",
+		},
+		{
+			name: "Anonymize without map",
+			setupFunc: func() {
+				inputDir = tempDir
+				anonymize = true
+			},
+			expectError: true,
+			errorMsg:    "anonymize requires --anonymize-map",
+		},
+		{
+			name: "Invalid minimum workers",
+			setupFunc: func() {
+				inputDir = tempDir
+				adaptiveWorkers = true
+				minWorkers = 8
+			},
+			expectError: true,
+			errorMsg:    "minimum workers must be between 1 and 4",
+		},
+		{
+			name: "Negative battery workers",
+			setupFunc: func() {
+				inputDir = tempDir
+				batteryWorkers = -1
+			},
+			expectError: true,
+			errorMsg:    "battery workers must not be negative",
+		},
+		{
+			name: "Invalid chmod",
+			setupFunc: func() {
+				inputDir = tempDir
+				chmodMode = "0999"
+			},
+			expectError: true,
+			errorMsg:    "invalid --chmod",
+		},
+		{
+			name: "Invalid chown",
+			setupFunc: func() {
+				inputDir = tempDir
+				chownOwner = ":"
+			},
+			expectError: true,
+			errorMsg:    "invalid --chown",
+		},
+		{
+			name: "Invalid speed",
+			setupFunc: func() {
+				inputDir = tempDir
+				speed = 10
+			},
+			expectError: true,
+			errorMsg:    "speed must be between 0 (encoder default) and 9",
+		},
+		{
+			name: "Invalid effort",
+			setupFunc: func() {
+				inputDir = tempDir
+				effort = 11
+			},
+			expectError: true,
+			errorMsg:    "effort must be between 0 (encoder default) and 10",
+		},
+		{
+			name: "Carve mode",
+			setupFunc: func() {
+				inputDir = tempDir
+				resizeMode = "carve"
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid mode",
+			setupFunc: func() {
+				inputDir = tempDir
+				resizeMode = "squash"
+			},
+			expectError: true,
+			errorMsg:    "mode must be fit, fill, carve, stretch or pad",
+		},
+		{
+			name: "Pad mode",
+			setupFunc: func() {
+				inputDir = tempDir
+				resizeMode = "pad"
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid pad color",
+			setupFunc: func() {
+				inputDir = tempDir
+				resizeMode = "pad"
+				padColor = "black"
+			},
+			expectError: true,
+			errorMsg:    "invalid --pad-color",
+		},
+		{
+			name: "Invalid gravity",
+			setupFunc: func() {
+				inputDir = tempDir
+				gravity = "north"
+			},
+			expectError: true,
+			errorMsg:    "gravity must be center, top, bottom, left, right or smart",
+		},
+		{
+			name: "Invalid page mode",
+			setupFunc: func() {
+				inputDir = tempDir
+				pageMode = "odd"
+			},
+			expectError: true,
+			errorMsg:    "pages must be first or all",
+		},
+		{
+			name: "Invalid white balance",
+			setupFunc: func() {
+				inputDir = tempDir
+				whiteBalance = "10,20,30"
+			},
+			expectError: true,
+			errorMsg:    "invalid --white-balance",
+		},
+		{
+			name: "Exposure level without white balance",
+			setupFunc: func() {
+				inputDir = tempDir
+				exposureLevel = 118
+			},
+			expectError: true,
+			errorMsg:    "exposure level needs --white-balance",
+		},
+		{
+			name: "Exposure level out of range",
+			setupFunc: func() {
+				inputDir = tempDir
+				whiteBalance = "auto"
+				exposureLevel = 300
+			},
+			expectError: true,
+			errorMsg:    "exposure level must be between 0 and 255",
+		},
+		{
+			name: "Clip threshold out of range",
+			setupFunc: func() {
+				inputDir = tempDir
+				clipThreshold = 101
+			},
+			expectError: true,
+			errorMsg:    "clip threshold must be between 0 and 100",
+		},
+		{
+			name: "PDF DPI out of range",
+			setupFunc: func() {
+				inputDir = tempDir
+				pdfDPI = -1
+			},
+			expectError: true,
+			errorMsg:    "PDF DPI must be between 0 and 2400",
+		},
+		{
+			name: "Unknown assumed profile",
+			setupFunc: func() {
+				inputDir = tempDir
+				assumeProfile = filepath.Join(tempDir, "missing.icc")
+			},
+			expectError: true,
+			errorMsg:    "invalid --assume-profile",
+		},
+		{
+			name: "Built-in assumed profile",
+			setupFunc: func() {
+				inputDir = tempDir
+				assumeProfile = "AdobeRGB"
+			},
+			expectError: false,
+		},
+		{
+			name: "Watermark that is no image",
+			setupFunc: func() {
+				inputDir = tempDir
+				watermark = filepath.Join(tempDir, "missing.png")
+			},
+			expectError: true,
+			errorMsg:    "invalid --watermark",
+		},
+		{
+			name: "Unknown watermark position",
+			setupFunc: func() {
+				inputDir = tempDir
+				watermark = filepath.Join(tempDir, "logo.png")
+				logo, _ := os.Create(watermark)
+				png.Encode(logo, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+				logo.Close()
+				watermarkPos = "middle"
+			},
+			expectError: true,
+			errorMsg:    "watermark position must be top-left, top,",
+		},
+		{
+			name: "Watermark text with a watermark",
+			setupFunc: func() {
+				inputDir = tempDir
+				watermark = filepath.Join(tempDir, "logo.png")
+				watermarkText = "© {year}"
+			},
+			expectError: true,
+			errorMsg:    "watermark text cannot be combined with --watermark",
+		},
+		{
+			name: "Watermark text in a missing font",
+			setupFunc: func() {
+				inputDir = tempDir
+				watermarkText = "© {year}"
+				watermarkFont = filepath.Join(tempDir, "missing.ttf")
+			},
+			expectError: true,
+			errorMsg:    "invalid --watermark-font",
+		},
+		{
+			name: "Watermark text in an invalid color",
+			setupFunc: func() {
+				inputDir = tempDir
+				watermarkText = "© {year}"
+				watermarkColor = "white"
+			},
+			expectError: true,
+			errorMsg:    "invalid --watermark-color",
+		},
+		{
+			name: "Processing log with stripped metadata",
+			setupFunc: func() {
+				inputDir = tempDir
+				stripMetadata = true
+				processingLog = true
+			},
+			expectError: true,
+			errorMsg:    "strip metadata cannot be combined with --processing-log",
+		},
+		{
+			name: "Copyright with stripped metadata",
+			setupFunc: func() {
+				inputDir = tempDir
+				stripMetadata = true
+				setCopyright = "© 2026 Jane Doe"
+			},
+			expectError: true,
+			errorMsg:    "set artist or copyright cannot be combined with --strip-metadata",
+		},
+		{
+			name: "Sidecars with anonymize",
+			setupFunc: func() {
+				inputDir = tempDir
+				anonymize = true
+				anonymizeMap = filepath.Join(tempDir, "map.csv")
+				copySidecars = true
+			},
+			expectError: true,
+			errorMsg:    "copy sidecars cannot be combined with --strip-metadata or --anonymize",
+		},
+		{
+			name: "Scrubbing GPS without EXIF data",
+			setupFunc: func() {
+				inputDir = tempDir
+				stripGPS = true
+				keepEXIF = false
+			},
+			expectError: true,
+			errorMsg:    "strip gps needs --keep-exif",
+		},
+		{
+			name: "Processing log with anonymize",
+			setupFunc: func() {
+				inputDir = tempDir
+				anonymize = true
+				anonymizeMap = filepath.Join(tempDir, "map.csv")
+				processingLog = true
+			},
+			expectError: true,
+			errorMsg:    "anonymize cannot be combined with --processing-log",
+		},
+		{
+			name: "Negative checkpoint size",
+			setupFunc: func() {
+				inputDir = tempDir
+				checkpointSize = -1
+			},
+			expectError: true,
+			errorMsg:    "checkpoint size must not be negative",
+		},
+		{
+			name: "Negative slow factor",
+			setupFunc: func() {
+				inputDir = tempDir
+				slowFactor = -1
+			},
+			expectError: true,
+			errorMsg:    "slow factor must not be negative",
+		},
+		{
+			name: "Unknown progress output",
+			setupFunc: func() {
+				inputDir = tempDir
+				progressMode = "dots"
+			},
+			expectError: true,
+			errorMsg:    "progress must be auto, bar or lines",
+		},
+		{
+			name: "HTML report without .html",
+			setupFunc: func() {
+				inputDir = tempDir
+				htmlReport = "report.pdf"
+			},
+			expectError: true,
+			errorMsg:    "html report must be an .html file",
+		},
+		{
+			name: "HTML report page size zero",
+			setupFunc: func() {
+				inputDir = tempDir
+				htmlReport = "report.html"
+				htmlReportPage = 0
+			},
+			expectError: true,
+			errorMsg:    "html report page size must be at least 1",
+		},
+		{
+			name: "Camera preset without preset",
+			setupFunc: func() {
+				inputDir = tempDir
+				cameraPreset = []string{"iPhone 15 Pro"}
+			},
+			expectError: true,
+			errorMsg:    "camera preset is invalid",
+		},
+		{
+			name: "Valid time correction",
+			setupFunc: func() {
+				inputDir = tempDir
+				shiftTime = "+8h"
+				setTimezone = "Asia/Shanghai"
+			},
+			expectError: false,
+		},
+		{
+			name: "Shift time without unit",
+			setupFunc: func() {
+				inputDir = tempDir
+				shiftTime = "8"
+			},
+			expectError: true,
+			errorMsg:    "shift time must be a duration",
+		},
+		{
+			name: "Unknown timezone",
+			setupFunc: func() {
+				inputDir = tempDir
+				setTimezone = "Mars/Olympus"
+			},
+			expectError: true,
+			errorMsg:    "timezone must be an offset",
+		},
+		{
+			name: "Anonymize with time correction",
+			setupFunc: func() {
+				inputDir = tempDir
+				anonymize = true
+				anonymizeMap = filepath.Join(tempDir, "map.csv")
+				shiftTime = "-1h"
+			},
+			expectError: true,
+			errorMsg:    "anonymize cannot be combined with --shift-time",
+		},
+		{
+			name: "Anonymize with flatten",
+			setupFunc: func() {
+				inputDir = tempDir
+				anonymize = true
+				anonymizeMap = filepath.Join(tempDir, "map.csv")
+				flatten = true
+			},
+			expectError: true,
+			errorMsg:    "anonymize cannot be combined with --flatten",
+		},
+		{
+			name: "Unknown safe names",
+			setupFunc: func() {
+				inputDir = tempDir
+				safeNames = "fat"
+			},
+			expectError: true,
+			errorMsg:    "safe names must be ascii or 8.3",
+		},
+		{
+			name: "8.3 names with WebP",
+			setupFunc: func() {
+				inputDir = tempDir
+				safeNames = "8.3"
+				outputFormat = "webp"
+			},
+			expectError: true,
+			errorMsg:    "8.3 names need the jpg, png or gif format",
+		},
+		{
+			name: "Split events without unit",
+			setupFunc: func() {
+				inputDir = tempDir
+				splitEvents = "4"
+			},
+			expectError: true,
+			errorMsg:    "split events gap must be a positive duration",
+		},
+		{
+			name: "Skip existing",
+			setupFunc: func() {
+				inputDir = tempDir
+				skipExisting = true
+			},
+			expectError: false,
+		},
+		{
+			name: "Skip existing with overwrite",
+			setupFunc: func() {
+				inputDir = tempDir
+				skipExisting = true
+				overwrite = true
+			},
+			expectError: true,
+			errorMsg:    "only one of --skip-existing, --if-newer and --overwrite",
+		},
+		{
+			name: "If newer with deterministic",
+			setupFunc: func() {
+				inputDir = tempDir
+				ifNewer = true
+				deterministic = true
+			},
+			expectError: true,
+			errorMsg:    "if newer cannot be combined with --deterministic",
+		},
+		{
+			name: "Skip existing with attachment limit",
+			setupFunc: func() {
+				inputDir = tempDir
+				skipExisting = true
+				attachLimit = "25MB"
+			},
+			expectError: true,
+			errorMsg:    "attachment limit cannot be combined with --skip-existing",
+		},
+		{
+			name: "Anonymize with if newer",
+			setupFunc: func() {
+				inputDir = tempDir
+				anonymize = true
+				anonymizeMap = filepath.Join(tempDir, "map.csv")
+				ifNewer = true
+			},
+			expectError: true,
+			errorMsg:    "anonymize cannot be combined with --skip-existing or --if-newer",
+		},
+		{
+			name: "Flatten with preserve structure",
+			setupFunc: func() {
+				inputDir = tempDir
+				flatten = true
+				keepStructure = true
+			},
+			expectError: true,
+			errorMsg:    "flatten cannot be combined with --preserve-structure",
+		},
+		{
+			name: "Anonymize with preserve structure",
+			setupFunc: func() {
+				inputDir = tempDir
+				anonymize = true
+				anonymizeMap = filepath.Join(tempDir, "map.csv")
+				keepStructure = true
+			},
+			expectError: true,
+			errorMsg:    "anonymize cannot be combined with --preserve-structure",
+		},
+		{
+			name: "Unknown collision strategy",
+			setupFunc: func() {
+				inputDir = tempDir
+				onCollision = "rename"
+			},
+			expectError: true,
+			errorMsg:    "on collision must be suffix, hash, path or overwrite",
+		},
+		{
+			name: "Name template",
+			setupFunc: func() {
+				inputDir = tempDir
+				nameTemplate = "holiday_{counter:04}_{width}x{height}.jpg"
+			},
+			expectError: false,
+		},
+		{
+			name: "Unknown name template placeholder",
+			setupFunc: func() {
+				inputDir = tempDir
+				nameTemplate = "{name}_{camera}"
+			},
+			expectError: true,
+			errorMsg:    "name template placeholder must be {name}, {ext}, {width}, {height}, {date}, {counter} or {parent}",
+		},
+		{
+			name: "Name template with flatten",
+			setupFunc: func() {
+				inputDir = tempDir
+				nameTemplate = "{parent}_{name}"
+				flatten = true
+			},
+			expectError: true,
+			errorMsg:    "name template cannot be combined with --flatten or --safe-names",
+		},
+		{
+			name: "Anonymize with name template",
+			setupFunc: func() {
+				inputDir = tempDir
+				anonymize = true
+				anonymizeMap = filepath.Join(tempDir, "map.csv")
+				nameTemplate = "{counter}"
+			},
+			expectError: true,
+			errorMsg:    "anonymize cannot be combined with --name-template",
+		},
+		{
+			name: "Mipmaps into KTX2",
+			setupFunc: func() {
+				inputDir = tempDir
+				mipmaps = "ktx2"
+			},
+			expectError: false,
+		},
+		{
+			name: "Unknown mipmaps",
+			setupFunc: func() {
+				inputDir = tempDir
+				mipmaps = "pvr"
+			},
+			expectError: true,
+			errorMsg:    "mipmaps must be images, dds or ktx2",
+		},
+		{
+			name: "Mipmaps of all pages",
+			setupFunc: func() {
+				inputDir = tempDir
+				mipmaps = "images"
+				pageMode = "all"
+			},
+			expectError: true,
+			errorMsg:    "mipmaps cannot be combined with --pages all",
+		},
+		{
+			name: "Mipmaps of spreads",
+			setupFunc: func() {
+				inputDir = tempDir
+				mipmaps = "images"
+				splitSpreads = true
+			},
+			expectError: true,
+			errorMsg:    "mipmaps cannot be combined with --split-spreads",
+		},
+		{
+			name: "Unknown color tag",
+			setupFunc: func() {
+				inputDir = tempDir
+				colorTag = "p3"
+			},
+			expectError: true,
+			errorMsg:    "color tag must be srgb, cicp or none",
+		},
+		{
+			name: "Unknown document mode",
+			setupFunc: func() {
+				inputDir = tempDir
+				document = "sepia"
+			},
+			expectError: true,
+			errorMsg:    "document must be bw, gray or color",
+		},
+		{
+			name: "Dither for e-ink",
+			setupFunc: func() {
+				inputDir = tempDir
+				ditherMethod = "ordered"
+				grayLevels = 4
+				contrast = 20
+			},
+			expectError: false,
+		},
+		{
+			name: "Unknown dither",
+			setupFunc: func() {
+				inputDir = tempDir
+				ditherMethod = "atkinson"
+			},
+			expectError: true,
+			errorMsg:    "dither must be floyd-steinberg or ordered",
+		},
+		{
+			name: "One gray level",
+			setupFunc: func() {
+				inputDir = tempDir
+				grayLevels = 1
+			},
+			expectError: true,
+			errorMsg:    "gray levels must be between 2 and 256",
+		},
+		{
+			name: "Contrast too low",
+			setupFunc: func() {
+				inputDir = tempDir
+				contrast = -150
+			},
+			expectError: true,
+			errorMsg:    "contrast must be between -100 and 100",
+		},
 	}
 
 	for _, test := range tests {
@@ -103,6 +788,78 @@ func TestValidateInputs(t *testing.T) {
 			maxWidth = 1920
 			maxHeight = 1920
 			workers = 4
+			slowFactor = 5
+			maxOutputSize = ""
+			presetName = ""
+			attachLimit = ""
+			zipLayout = "flat"
+			anonymize = false
+			anonymizeMap = ""
+			adaptiveWorkers = false
+			minWorkers = 1
+			batteryWorkers = 0
+			pauseOnBattery = false
+			maxTemperature = 0
+			checkpointSize = 0
+			chmodMode = ""
+			chownOwner = ""
+			speed = 0
+			effort = 0
+			resizeMode = "fit"
+			padColor = "#ffffff"
+			gravity = "center"
+			assumeProfile = ""
+			pageMode = "first"
+			whiteBalance = ""
+			exposureLevel = 0
+			clipThreshold = 5
+			pdfDPI = 0
+			processingLog = false
+			progressMode = "auto"
+			htmlReport = ""
+			htmlReportPage = 50
+			jsonOutput = false
+			cameraPreset = nil
+			shiftTime = ""
+			setTimezone = ""
+			splitEvents = ""
+			flatten = false
+			keepStructure = false
+			onCollision = "suffix"
+			nameTemplate = ""
+			safeNames = ""
+			skipExisting = false
+			overwrite = false
+			ifNewer = false
+			deterministic = false
+			contrast = 0
+			watermark = ""
+			watermarkPos = "bottom-right"
+			watermarkScale = 20
+			watermarkMargin = 2
+			watermarkAlpha = 100
+			watermarkText = ""
+			watermarkFont = ""
+			watermarkSize = 4
+			watermarkColor = "#ffffff"
+			grayscale = false
+			ditherMethod = ""
+			grayLevels = 16
+			mipmaps = ""
+			colorTag = "srgb"
+			document = ""
+			keepEXIF = false
+			keepCatalog = true
+			stripGPS = false
+			setArtist = ""
+			setCopyright = ""
+			copySidecars = false
+			splitSpreads = false
+			deskew = false
+			stripMetadata = false
+			linearResize = false
+			preserveAttrs = false
+			autoOrient = true
 
 			// Apply test-specific setup
 			test.setupFunc()
@@ -136,6 +893,10 @@ func TestGetImageFiles(t *testing.T) {
 		"image3.bmp":        "bmp content",
 		"image4.tiff":       "tiff content",
 		"image5.heic":       "heic content",
+		"image7.webp":       "webp content",
+		"image8.avif":       "avif content",
+		"image9.gif":        "gif content",
+		"document.pdf":      "pdf content",
 		"not_image.txt":     "text content",
 		"subdir/image6.jpg": "jpg content in subdir",
 	}
@@ -164,13 +925,13 @@ func TestGetImageFiles(t *testing.T) {
 			name:      "Non-recursive scan",
 			dir:       tempDir,
 			recursive: false,
-			expected:  5, // image1.jpg, image2.png, image3.bmp, image4.tiff, image5.heic
+			expected:  8, // image1.jpg, image2.png, image3.bmp, image4.tiff, image5.heic, image7.webp, image8.avif, image9.gif
 		},
 		{
 			name:      "Recursive scan",
 			dir:       tempDir,
 			recursive: true,
-			expected:  6, // + subdir/image6.jpg
+			expected:  9, // + subdir/image6.jpg
 		},
 		{
 			name:      "Subdir only non-recursive",
@@ -193,6 +954,14 @@ func TestGetImageFiles(t *testing.T) {
 			}
 		})
 	}
+
+	// PDFs are picked up when they are rendered
+	pdfDPI = 150
+	defer func() { pdfDPI = 0 }()
+	files, err := getImageFiles(tempDir, false)
+	if err != nil || len(files) != 9 {
+		t.Errorf("getImageFiles() with --pdf-dpi = %d files, %v, expected 9", len(files), err)
+	}
 }
 
 func TestSeparateImageFiles(t *testing.T) {
@@ -259,21 +1028,17 @@ func TestRootCmd(t *testing.T) {
 		t.Error("rootCmd missing 'workers' flag")
 	} else {
 		// Check that the flag has the correct default value
-		if workersFlag.DefValue != "4" {
-			t.Errorf("workers flag default = %s, expected '4'", workersFlag.DefValue)
+		if workersFlag.DefValue != strconv.Itoa(runtime.NumCPU()) {
+			t.Errorf("workers flag default = %s, expected the number of CPUs %d", workersFlag.DefValue, runtime.NumCPU())
 		}
 	}
 }
 
 func TestProcessCmd(t *testing.T) {
 	// Test that process command is properly added to root
-	if len(rootCmd.Commands()) != 1 {
-		t.Errorf("rootCmd should have 1 subcommand, got %d", len(rootCmd.Commands()))
-	}
-
-	processCmd := rootCmd.Commands()[0]
-	if processCmd.Use != "process" {
-		t.Errorf("processCmd.Use = %s, expected 'process'", processCmd.Use)
+	processCmd := findCommand("process")
+	if processCmd == nil {
+		t.Fatal("rootCmd missing 'process' subcommand")
 	}
 
 	if processCmd.Short != "Start batch processing images" {
@@ -281,6 +1046,24 @@ func TestProcessCmd(t *testing.T) {
 	}
 }
 
+func TestSubcommands(t *testing.T) {
+	for _, name := range []string{"doctor", "version", "review", "preview", "control", "sequence", "topdf", "favicon", "icons", "migrate-config", "serve"} {
+		if findCommand(name) == nil {
+			t.Errorf("rootCmd missing '%s' subcommand", name)
+		}
+	}
+}
+
+// findCommand returns the root subcommand with the given name, or nil
+func findCommand(name string) *cobra.Command {
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
 func TestExecute(t *testing.T) {
 	// Test that Execute function exists and can be called
 	// We can't easily test the full execution without mocking file system
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"picture-resize-tools/pkg/pool"
+	"picture-resize-tools/pkg/processor"
+)
+
+// Values of --on-collision
+const (
+	collisionSuffix    = "suffix"
+	collisionHash      = "hash"
+	collisionPath      = "path"
+	collisionOverwrite = "overwrite"
+)
+
+// collisionStrategies lists the values of --on-collision
+var collisionStrategies = []string{collisionSuffix, collisionHash, collisionPath, collisionOverwrite}
+
+// collisionHashLength is the number of hex digits of hash suffixes
+const collisionHashLength = 8
+
+// collisionNames maps input paths to the names that keep their outputs from
+// replacing another's; nil renames nothing
+var collisionNames map[string]string
+
+// validateCollision checks the --on-collision strategy
+func validateCollision(strategy string) error {
+	for _, s := range collisionStrategies {
+		if s == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("on collision must be %s, got: %s", joinChoices(collisionStrategies), strategy)
+}
+
+// plannedOutputs returns the output path of each of files with config,
+// as the wrappers of the run name them
+func plannedOutputs(files []string, config processor.Config) map[string]string {
+	plan := outputWrappers(func(path string, config processor.Config) (processor.Result, error) {
+		return processor.Result{InputPath: path, OutputPath: processor.OutputPath(path, config)}, nil
+	})
+	results, _ := pool.Map(context.Background(), &pool.Pool{Workers: workers}, files, func(_ context.Context, _ int, path string) (processor.Result, error) {
+		return plan(path, config)
+	})
+
+	outputs := make(map[string]string, len(files))
+	for _, r := range results {
+		if r.OutputPath != "" {
+			outputs[r.InputPath] = r.OutputPath
+		}
+	}
+	return outputs
+}
+
+// planCollisions finds the inputs whose output path, ignoring case, is
+// that of an earlier input in sorted order and names their outputs with
+// strategy: name_1, name_2, ... for suffix, name_ followed by a hash of
+// the input path relative to root for hash, and the relative directory as a
+// prefix, like --flatten, for path. Names that are still taken get a
+// suffix. It returns the new names by input path.
+func planCollisions(outputs map[string]string, root, strategy string) map[string]string {
+	inputs := make([]string, 0, len(outputs))
+	taken := make(map[string]bool, len(outputs))
+	for input, output := range outputs {
+		inputs = append(inputs, input)
+		taken[strings.ToLower(output)] = true
+	}
+	sort.Strings(inputs)
+
+	names := make(map[string]string)
+	claimed := make(map[string]bool, len(outputs))
+	for _, input := range inputs {
+		output := outputs[input]
+		if !claimed[strings.ToLower(output)] {
+			claimed[strings.ToLower(output)] = true
+			continue
+		}
+
+		dir, ext := filepath.Dir(output), filepath.Ext(output)
+		base := strings.TrimSuffix(filepath.Base(output), ext)
+		switch strategy {
+		case collisionHash:
+			base += "_" + inputHash(root, input)
+		case collisionPath:
+			if prefixed := flatName(root, input); !strings.EqualFold(prefixed, base) {
+				base = prefixed
+			} else {
+				// Inputs of the same folder differ by their extension
+				base += "_" + strings.TrimPrefix(strings.ToLower(filepath.Ext(input)), ".")
+			}
+		}
+
+		name := base
+		free := func(name string) bool {
+			key := strings.ToLower(filepath.Join(dir, name+ext))
+			return !claimed[key] && !taken[key]
+		}
+		if strategy == collisionSuffix || !free(name) {
+			for n := 1; n == 1 || !free(name); n++ {
+				name = fmt.Sprintf("%s_%d", base, n)
+			}
+		}
+		claimed[strings.ToLower(filepath.Join(dir, name+ext))] = true
+		names[input] = name
+	}
+	return names
+}
+
+// inputHash returns a short hash of the path of input relative to root
+func inputHash(root, input string) string {
+	rel, err := filepath.Rel(root, input)
+	if err != nil {
+		rel = input
+	}
+	sum := sha256.Sum256([]byte(filepath.ToSlash(rel)))
+	return hex.EncodeToString(sum[:])[:collisionHashLength]
+}
+
+// collisionProcessor wraps process to name the outputs of files as
+// planned by planCollisions
+func collisionProcessor(names map[string]string, process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		if name, ok := names[path]; ok {
+			config.OutputName = name
+		}
+		return process(path, config)
+	}
+}
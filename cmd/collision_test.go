@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestPlanCollisions(t *testing.T) {
+	out := func(name string) string { return filepath.Join("output", name) }
+	// a/img.jpg and b/img.jpg collide, as do x.png and x.heic, and the
+	// suffixed name of one would collide with another input's output
+	outputs := map[string]string{
+		filepath.Join("in", "a", "img.jpg"): out("img.jpg"),
+		filepath.Join("in", "b", "img.jpg"): out("img.jpg"),
+		filepath.Join("in", "x.png"):        out("x.jpg"),
+		filepath.Join("in", "x.heic"):       out("X.jpg"),
+		filepath.Join("in", "x_1.jpg"):      out("x_1.jpg"),
+		filepath.Join("in", "other.jpg"):    out("other.jpg"),
+	}
+
+	tests := []struct {
+		strategy string
+		expected map[string]string
+	}{
+		{collisionSuffix, map[string]string{
+			filepath.Join("in", "b", "img.jpg"): "img_1",
+			filepath.Join("in", "x.png"):        "x_2",
+		}},
+		{collisionHash, map[string]string{
+			filepath.Join("in", "b", "img.jpg"): "img_" + inputHash("in", filepath.Join("in", "b", "img.jpg")),
+			filepath.Join("in", "x.png"):        "x_" + inputHash("in", filepath.Join("in", "x.png")),
+		}},
+		{collisionPath, map[string]string{
+			filepath.Join("in", "b", "img.jpg"): "b_img",
+			filepath.Join("in", "x.png"):        "x_png",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.strategy, func(t *testing.T) {
+			names := planCollisions(outputs, "in", test.strategy)
+			if len(names) != len(test.expected) {
+				t.Errorf("planCollisions() = %v, expected %v", names, test.expected)
+			}
+			for input, name := range test.expected {
+				if names[input] != name {
+					t.Errorf("name of %s = %q, expected %q", input, names[input], name)
+				}
+			}
+		})
+	}
+}
+
+func TestInputHash(t *testing.T) {
+	a, b := inputHash("in", filepath.Join("in", "a", "img.jpg")), inputHash("in", filepath.Join("in", "b", "img.jpg"))
+	if len(a) != collisionHashLength || a == b {
+		t.Errorf("inputHash() = %q and %q, expected distinct %d digit hashes", a, b, collisionHashLength)
+	}
+	if again := inputHash("in", filepath.Join("in", "a", "img.jpg")); again != a {
+		t.Errorf("inputHash() = %q then %q, expected stable hashes", a, again)
+	}
+}
+
+func TestCollisionProcessor(t *testing.T) {
+	var names []string
+	process := collisionProcessor(map[string]string{"b/img.jpg": "img_1"}, func(path string, config processor.Config) (processor.Result, error) {
+		names = append(names, config.OutputName)
+		return processor.Result{InputPath: path}, nil
+	})
+	for _, path := range []string{"a/img.jpg", "b/img.jpg"} {
+		if _, err := process(path, processor.Config{}); err != nil {
+			t.Fatalf("process(%s) error = %v", path, err)
+		}
+	}
+	if names[0] != "" || names[1] != "img_1" {
+		t.Errorf("output names = %q, expected the planned name for b/img.jpg only", names)
+	}
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+var controlSocket string
+
+// settingsMu guards the per-file settings that a control client can reload
+var settingsMu sync.RWMutex
+
+// progress describes the batch being processed, nil between batches
+var progress atomic.Pointer[batchProgress]
+
+// batchProgress counts the files of a batch for control clients
+type batchProgress struct {
+	total   int
+	done    atomic.Int64
+	failed  atomic.Int64
+	tracker *inFlightTracker
+	limiter *workerLimiter
+}
+
+// controlStatus is the reply to the status command
+type controlStatus struct {
+	State    string           `json:"state"`
+	Total    int              `json:"total"`
+	Done     int64            `json:"done"`
+	Failed   int64            `json:"failed"`
+	Workers  int              `json:"workers"`
+	InFlight []inFlightStatus `json:"in_flight"`
+}
+
+// inFlightStatus is a file being processed, as reported by status
+type inFlightStatus struct {
+	Worker  int     `json:"worker"`
+	File    string  `json:"file"`
+	Seconds float64 `json:"seconds"`
+}
+
+var controlCmd = &cobra.Command{
+	Use:   "control <status|pause|resume|reload|drain>",
+	Short: "Send a command to a run started with --control-socket",
+	Args:  cobra.ExactArgs(1),
+	Run:   func(cmd *cobra.Command, args []string) { runControl(args[0]) },
+}
+
+func init() {
+	rootCmd.AddCommand(controlCmd)
+}
+
+func runControl(command string) {
+	if controlSocket == "" {
+		logger.Error("Control socket not set, use --control-socket")
+		os.Exit(1)
+	}
+
+	reply, err := sendControlCommand(controlSocket, command)
+	if err != nil {
+		logger.Error("Failed to reach control socket", "socket", controlSocket, "error", err)
+		os.Exit(1)
+	}
+	fmt.Println(reply)
+	if strings.HasPrefix(reply, "error") {
+		os.Exit(1)
+	}
+}
+
+// sendControlCommand sends one command to the socket at path and returns
+// the reply
+func sendControlCommand(path, command string) (string, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(reply), nil
+}
+
+// serveControl answers commands on a Unix domain socket at path, one per
+// line, until the returned stop function is called
+func serveControl(path string) (func(), error) {
+	// A socket left behind by a crashed run is replaced, a live one is
+	// not, and neither is any other file such as a mistyped report
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another run is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Only the owner may control the run. The socket is created in a
+	// directory only the owner may enter and moved into place once it is
+	// private, so that no one can connect before.
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".control-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, "socket")
+	listener, err := net.Listen("unix", private)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(private, 0600); err == nil {
+		err = os.Rename(private, path)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveControlConn(conn)
+		}
+	}()
+
+	return func() {
+		listener.Close()
+		wg.Wait()
+		// The listener only removes the name it was created with
+		os.Remove(path)
+	}, nil
+}
+
+// serveControlConn answers the commands sent over one connection
+func serveControlConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		command := strings.TrimSpace(scanner.Text())
+		if command == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(conn, handleControlCommand(command)); err != nil {
+			return
+		}
+	}
+}
+
+// handleControlCommand executes a control command and returns the reply
+func handleControlCommand(command string) string {
+	switch command {
+	case "status":
+		data, err := json.Marshal(currentStatus())
+		if err != nil {
+			return fmt.Sprintf("error: %v", err)
+		}
+		return string(data)
+	case "pause":
+		if !gate.pause() {
+			return "ok: already paused"
+		}
+		logger.Info("Paused: in-flight files will finish, no new files are started")
+		return "ok: paused"
+	case "resume":
+		if !gate.resume() {
+			return "ok: not paused"
+		}
+		logger.Info("Resumed")
+		return "ok: resumed"
+	case "drain":
+		if !startDrain("Drain requested") {
+			return "ok: already draining"
+		}
+		return "ok: draining"
+	case "reload":
+		if err := reloadSettings(); err != nil {
+			return fmt.Sprintf("error: %v", err)
+		}
+		logger.Info("Reloaded stamp CSV and manifest")
+		return "ok: reloaded"
+	}
+	return fmt.Sprintf("error: unknown command %q", command)
+}
+
+// currentStatus describes the state of the run
+func currentStatus() controlStatus {
+	status := controlStatus{State: "idle", InFlight: []inFlightStatus{}}
+	batch := progress.Load()
+	if batch == nil {
+		return status
+	}
+
+	status.State = "running"
+	if drainer.active() {
+		status.State = "draining"
+	} else if gate.isPaused() {
+		status.State = "paused"
+	}
+	status.Total = batch.total
+	status.Done = batch.done.Load()
+	status.Failed = batch.failed.Load()
+	status.Workers = batch.limiter.currentLimit()
+	for _, f := range batch.tracker.runningLongerThan(0) {
+		status.InFlight = append(status.InFlight, inFlightStatus{
+			Worker:  f.worker,
+			File:    f.path,
+			Seconds: time.Since(f.start).Round(time.Millisecond).Seconds(),
+		})
+	}
+	return status
+}
+
+// reloadSettings reads the stamp CSV and manifest again. Files that have
+// not been started yet use the new settings.
+func reloadSettings() error {
+	var newStamps map[string]string
+	if stampCSV != "" {
+		var err error
+		if newStamps, err = loadStampCSV(stampCSV); err != nil {
+			return fmt.Errorf("stamp CSV '%s': %v", stampCSV, err)
+		}
+	}
+	var newManifest map[string]manifestEntry
+	if manifestPath != "" {
+		var err error
+		if newManifest, err = loadManifest(manifestPath); err != nil {
+			return fmt.Errorf("manifest '%s': %v", manifestPath, err)
+		}
+	}
+
+	settingsMu.Lock()
+	stamps, manifest = newStamps, newManifest
+	settingsMu.Unlock()
+	return nil
+}
+
+// reloadableProcessor processes one file with the current per-file
+// settings, so a reload applies to files that have not been started yet
+func reloadableProcessor(path string, config processor.Config) (processor.Result, error) {
+	settingsMu.RLock()
+	process := fileProcessor()
+	settingsMu.RUnlock()
+	return process(path, config)
+}
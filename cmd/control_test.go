@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleControlCommand(t *testing.T) {
+	gate, drainer = newPauseGate(), newDrainSwitch()
+	defer func() { gate, drainer = newPauseGate(), newDrainSwitch() }()
+
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"pause", "ok: paused"},
+		{"pause", "ok: already paused"},
+		{"resume", "ok: resumed"},
+		{"resume", "ok: not paused"},
+		{"reload", "ok: reloaded"},
+		{"drain", "ok: draining"},
+		{"drain", "ok: already draining"},
+		{"explode", `error: unknown command "explode"`},
+	}
+
+	for _, test := range tests {
+		if reply := handleControlCommand(test.command); reply != test.expected {
+			t.Errorf("handleControlCommand(%q) = %q, expected %q", test.command, reply, test.expected)
+		}
+	}
+}
+
+func TestControlStatus(t *testing.T) {
+	gate = newPauseGate()
+	defer func() { gate = newPauseGate() }()
+
+	if status := currentStatus(); status.State != "idle" {
+		t.Errorf("currentStatus() state = %q without a batch, expected idle", status.State)
+	}
+
+	tracker := newInFlightTracker()
+	tracker.start(2, "photos/a.jpg")
+	batch := &batchProgress{total: 10, tracker: tracker, limiter: newWorkerLimiter(4)}
+	batch.done.Add(3)
+	batch.failed.Add(1)
+	progress.Store(batch)
+	defer progress.Store(nil)
+	gate.pause()
+
+	var status controlStatus
+	if err := json.Unmarshal([]byte(handleControlCommand("status")), &status); err != nil {
+		t.Fatalf("status reply is not JSON: %v", err)
+	}
+	if status.State != "paused" || status.Total != 10 || status.Done != 3 || status.Failed != 1 || status.Workers != 4 {
+		t.Errorf("status = %+v, expected paused, 10 total, 3 done, 1 failed, 4 workers", status)
+	}
+	if len(status.InFlight) != 1 || status.InFlight[0].Worker != 2 || status.InFlight[0].File != "photos/a.jpg" {
+		t.Errorf("status in flight = %+v, expected worker 2 on photos/a.jpg", status.InFlight)
+	}
+}
+
+func TestReloadSettings(t *testing.T) {
+	defer func() { stampCSV, manifestPath, stamps, manifest = "", "", nil, nil }()
+
+	csvPath := filepath.Join(t.TempDir(), "stamps.csv")
+	if err := os.WriteFile(csvPath, []byte("a.jpg,Case 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write stamp CSV: %v", err)
+	}
+	stampCSV = csvPath
+
+	if err := reloadSettings(); err != nil {
+		t.Fatalf("reloadSettings() error = %v", err)
+	}
+	if stamps["a.jpg"] != "Case 1" {
+		t.Errorf("stamps after reload = %v, expected a.jpg: Case 1", stamps)
+	}
+
+	// A broken file keeps the previous settings
+	manifestPath = filepath.Join(t.TempDir(), "missing.json")
+	if err := reloadSettings(); err == nil {
+		t.Error("reloadSettings() with a missing manifest expected error, got nil")
+	}
+	if stamps["a.jpg"] != "Case 1" {
+		t.Errorf("stamps after failed reload = %v, expected them unchanged", stamps)
+	}
+}
+
+func TestServeControl(t *testing.T) {
+	gate = newPauseGate()
+	defer func() { gate = newPauseGate() }()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "control.sock")
+	stop, err := serveControl(path)
+	if err != nil {
+		t.Fatalf("serveControl() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Errorf("socket not created: %v", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, expected 0600", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files next to the socket, expected it alone", len(entries))
+	}
+
+	if _, err := serveControl(path); err == nil || !strings.Contains(err.Error(), "another run") {
+		t.Errorf("second serveControl() error = %v, expected another run is listening", err)
+	}
+
+	reply, err := sendControlCommand(path, "pause")
+	if err != nil || reply != "ok: paused" {
+		t.Errorf("sendControlCommand(pause) = %q, %v, expected ok: paused", reply, err)
+	}
+	if !gate.isPaused() {
+		t.Error("run not paused after the pause command")
+	}
+	stop()
+
+	if _, err := sendControlCommand(path, "status"); err == nil {
+		t.Error("sendControlCommand() after stop expected error, got nil")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket left behind after stop: %v", err)
+	}
+}
+
+func TestServeControlKeepsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.html")
+	if err := os.WriteFile(path, []byte("report"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := serveControl(path); err == nil || !strings.Contains(err.Error(), "is not a socket") {
+		t.Errorf("serveControl() error = %v, expected exists and is not a socket", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "report" {
+		t.Errorf("file at the socket path = %q, %v, expected it unchanged", data, err)
+	}
+}
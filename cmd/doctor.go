@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+const (
+	statusOK   = "OK"
+	statusWarn = "WARN"
+	statusFail = "FAIL"
+)
+
+// doctorCheck is the outcome of a single environment check
+type doctorCheck struct {
+	name   string
+	status string
+	detail string
+	hint   string
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the environment for common problems",
+	Run:   func(cmd *cobra.Command, args []string) { runDoctor() },
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor() {
+	checks := []doctorCheck{
+		{name: "Go runtime", status: statusOK, detail: fmt.Sprintf("%s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH)},
+		checkLibheif(),
+		checkHeifEncoder("heic", "HEVC", "install an HEVC plugin of libheif (e.g. apt install libheif-plugin-x265) to write HEIC"),
+		checkHeifEncoder("avif", "AV1", "install an AV1 plugin of libheif (e.g. apt install libheif-plugin-aomenc) to write AVIF"),
+		checkWritableDir("Temp directory", os.TempDir()),
+		checkWritableDir("Output directory", outputDir),
+		checkICCProfiles(),
+		checkExecutable("ffmpeg", "optional, install ffmpeg for video integrations"),
+		checkExecutable("tesseract", "optional, install tesseract for OCR integrations"),
+		checkExecutable("pdftoppm", "optional, install poppler-utils to process PDFs with --pdf-dpi"),
+		checkComicExtractor(),
+	}
+
+	failed := false
+	for _, c := range checks {
+		fmt.Printf("[%-4s] %-18s %s\n", c.status, c.name, c.detail)
+		if c.hint != "" && c.status != statusOK {
+			fmt.Printf("       %-18s -> %s\n", "", c.hint)
+		}
+		if c.status == statusFail {
+			failed = true
+		}
+	}
+
+	if failed {
+		fmt.Println("Some checks failed, see the hints above")
+		os.Exit(1)
+	}
+	fmt.Println("Environment looks good")
+}
+
+// checkLibheif verifies that libheif is linked and reports its version
+func checkLibheif() doctorCheck {
+	version := processor.HeifVersion()
+	if version == "" {
+		return doctorCheck{name: "libheif", status: statusFail, detail: "unknown version", hint: "reinstall libheif (e.g. apt install libheif1, brew install libheif)"}
+	}
+	return doctorCheck{name: "libheif", status: statusOK, detail: "version " + version}
+}
+
+// checkHeifEncoder reports whether libheif can write format, which needs
+// an encoder for codec
+func checkHeifEncoder(format, codec, hint string) doctorCheck {
+	name := strings.ToUpper(format) + " encoder"
+	if !processor.HasHeifEncoder(format) {
+		return doctorCheck{name: name, status: statusWarn, detail: "libheif has no " + codec + " encoder", hint: hint}
+	}
+	return doctorCheck{name: name, status: statusOK, detail: codec}
+}
+
+// checkWritableDir verifies that files can be created in dir. A missing
+// directory is fine as long as its nearest existing parent is writable.
+func checkWritableDir(name, dir string) doctorCheck {
+	target := dir
+	for {
+		info, err := os.Stat(target)
+		if err == nil {
+			if !info.IsDir() {
+				return doctorCheck{name: name, status: statusFail, detail: dir + " is not a directory", hint: "choose a different path"}
+			}
+			break
+		}
+		parent := filepath.Dir(target)
+		if parent == target {
+			return doctorCheck{name: name, status: statusFail, detail: dir + " has no existing parent", hint: "check the path"}
+		}
+		target = parent
+	}
+
+	f, err := os.CreateTemp(target, ".doctor-*")
+	if err != nil {
+		return doctorCheck{name: name, status: statusFail, detail: fmt.Sprintf("%s is not writable: %v", target, err), hint: "fix the permissions or choose a different path"}
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	detail := dir + " is writable"
+	if target != dir {
+		detail = fmt.Sprintf("%s will be created in %s", dir, target)
+	}
+	return doctorCheck{name: name, status: statusOK, detail: detail}
+}
+
+// iccProfileDirs lists the usual system locations of ICC color profiles
+var iccProfileDirs = []string{
+	"/usr/share/color/icc",
+	"/usr/local/share/color/icc",
+	"/System/Library/ColorSync/Profiles",
+	"/Library/ColorSync/Profiles",
+	`C:\Windows\System32\spool\drivers\color`,
+}
+
+// checkICCProfiles reports whether any system ICC profiles are installed
+func checkICCProfiles() doctorCheck {
+	for _, dir := range iccProfileDirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.ic[cm]"))
+		if len(matches) > 0 {
+			return doctorCheck{name: "ICC profiles", status: statusOK, detail: fmt.Sprintf("%d found in %s", len(matches), dir)}
+		}
+	}
+	return doctorCheck{name: "ICC profiles", status: statusWarn, detail: "no system profiles found", hint: "install a color profile package (e.g. icc-profiles-free)"}
+}
+
+// checkComicExtractor reports whether CBR comic archives can be unpacked
+func checkComicExtractor() doctorCheck {
+	path, err := processor.ComicExtractor()
+	if err != nil {
+		return doctorCheck{name: "CBR extractor", status: statusWarn, detail: "none found in PATH", hint: "optional, install unrar, 7z or bsdtar to process .cbr comic archives"}
+	}
+	return doctorCheck{name: "CBR extractor", status: statusOK, detail: path}
+}
+
+// checkExecutable reports whether an optional external tool is on PATH
+func checkExecutable(name, purpose string) doctorCheck {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return doctorCheck{name: name, status: statusWarn, detail: "not found in PATH", hint: purpose}
+	}
+	return doctorCheck{name: name, status: statusOK, detail: path}
+}
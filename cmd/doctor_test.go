@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestCheckWritableDir(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "file.txt")
+	if err := os.WriteFile(filePath, []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		dir      string
+		expected string
+	}{
+		{"Existing directory", tempDir, statusOK},
+		{"Missing directory with writable parent", filepath.Join(tempDir, "a", "b"), statusOK},
+		{"Path is a file", filePath, statusFail},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := checkWritableDir("dir", test.dir)
+			if result.status != test.expected {
+				t.Errorf("checkWritableDir(%s) status = %s, expected %s (%s)", test.dir, result.status, test.expected, result.detail)
+			}
+		})
+	}
+
+	// The check must not leave anything behind
+	entries, _ := os.ReadDir(tempDir)
+	if len(entries) != 1 {
+		t.Errorf("checkWritableDir() left %d entries in %s, expected 1", len(entries), tempDir)
+	}
+}
+
+func TestCheckExecutable(t *testing.T) {
+	if result := checkExecutable("go", "build"); result.status != statusOK {
+		t.Errorf("checkExecutable(go) status = %s, expected %s", result.status, statusOK)
+	}
+
+	result := checkExecutable("definitely-not-a-real-tool", "testing")
+	if result.status != statusWarn {
+		t.Errorf("checkExecutable(missing) status = %s, expected %s", result.status, statusWarn)
+	}
+	if result.hint != "testing" {
+		t.Errorf("checkExecutable(missing) hint = %s, expected 'testing'", result.hint)
+	}
+}
+
+func TestCheckLibheif(t *testing.T) {
+	result := checkLibheif()
+	if result.status != statusOK {
+		t.Errorf("checkLibheif() status = %s, expected %s (%s)", result.status, statusOK, result.detail)
+	}
+}
+
+func TestCheckHeifEncoder(t *testing.T) {
+	for _, format := range []string{"heic", "avif"} {
+		result := checkHeifEncoder(format, "codec", "hint")
+		expected := statusWarn
+		if processor.HasHeifEncoder(format) {
+			expected = statusOK
+		}
+		if result.status != expected {
+			t.Errorf("checkHeifEncoder(%s) status = %s, expected %s (%s)", format, result.status, expected, result.detail)
+		}
+	}
+	if processor.HasHeifEncoder("png") {
+		t.Error("HasHeifEncoder(png) = true, expected false")
+	}
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// drainer stops the scheduling of new files once the run is draining
+var drainer = newDrainSwitch()
+
+// drainSwitch records whether the run is draining and which files were
+// left unstarted because of it
+type drainSwitch struct {
+	mu       sync.Mutex
+	draining bool
+	skipped  []string
+}
+
+func newDrainSwitch() *drainSwitch {
+	return &drainSwitch{}
+}
+
+// start begins draining: no new files are started, in-flight files finish.
+// It returns false if the run was already draining.
+func (d *drainSwitch) start() bool {
+	d.mu.Lock()
+	if d.draining {
+		d.mu.Unlock()
+		return false
+	}
+	d.draining = true
+	d.mu.Unlock()
+
+	// Workers held back by a pause must wake up to skip their files
+	gate.resume()
+	return true
+}
+
+// active reports whether the run is draining
+func (d *drainSwitch) active() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// skip records a file that was not started because of draining
+func (d *drainSwitch) skip(path string) {
+	d.mu.Lock()
+	d.skipped = append(d.skipped, path)
+	d.mu.Unlock()
+}
+
+// skippedFiles returns the files left unstarted in sorted order
+func (d *drainSwitch) skippedFiles() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	files := append([]string(nil), d.skipped...)
+	sort.Strings(files)
+	return files
+}
+
+// forget drops the files left unstarted, for when they still have the
+// outputs of an earlier pass over the same files
+func (d *drainSwitch) forget() {
+	d.mu.Lock()
+	d.skipped = nil
+	d.mu.Unlock()
+}
+
+// startDrain drains the run and tells the user
+func startDrain(reason string) bool {
+	if !drainer.start() {
+		return false
+	}
+	logger.Info("Draining, in-flight files will finish and the rest is left for --resume", "reason", reason)
+	return true
+}
+
+// watchDrainSignals drains the run on the first SIGINT or SIGTERM and
+// exits on the second, until the returned stop function is called
+func watchDrainSignals() func() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-signals:
+				if !startDrain(fmt.Sprintf("Received %v", sig)) {
+					logger.Warn("Interrupted again, exiting without finishing in-flight files")
+					os.Exit(130)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
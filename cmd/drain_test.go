@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDrainSwitch(t *testing.T) {
+	gate = newPauseGate()
+	defer func() { gate = newPauseGate() }()
+
+	d := newDrainSwitch()
+	if d.active() {
+		t.Fatal("new drainSwitch should not be draining")
+	}
+
+	// A paused worker must be released by draining
+	gate.pause()
+	released := make(chan struct{})
+	go func() {
+		gate.wait()
+		close(released)
+	}()
+
+	if !d.start() {
+		t.Error("start() = false, expected true on the first call")
+	}
+	if d.start() {
+		t.Error("start() = true, expected false when already draining")
+	}
+	if !d.active() {
+		t.Error("active() = false after start()")
+	}
+
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("paused worker was not released by draining")
+	}
+
+	d.skip("b.jpg")
+	d.skip("a.jpg")
+	if skipped := d.skippedFiles(); !reflect.DeepEqual(skipped, []string{"a.jpg", "b.jpg"}) {
+		t.Errorf("skippedFiles() = %v, expected [a.jpg b.jpg]", skipped)
+	}
+	d.forget()
+	if skipped := d.skippedFiles(); len(skipped) != 0 {
+		t.Errorf("skippedFiles() after forget() = %v, expected none", skipped)
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"picture-resize-tools/pkg/pool"
+	"picture-resize-tools/pkg/processor"
+)
+
+// undatedEvent is the folder of files without a capture time
+const undatedEvent = "undated"
+
+// events maps input paths to the event folder their outputs go into; nil
+// means outputs are not grouped
+var events map[string]string
+
+// eventFile is an input with its capture time
+type eventFile struct {
+	path     string
+	captured time.Time
+}
+
+// parseEventGap parses --split-events
+func parseEventGap(value string) (time.Duration, error) {
+	gap, err := time.ParseDuration(value)
+	if err != nil || gap <= 0 {
+		return 0, fmt.Errorf("split events gap must be a positive duration such as 4h, got: %s", value)
+	}
+	return gap, nil
+}
+
+// planEvents reads the corrected capture times of files and groups them
+// into events, starting a new one after a gap longer than gap
+func planEvents(files []string, gap time.Duration) map[string]string {
+	dated, _ := pool.Map(context.Background(), &pool.Pool{Workers: workers}, files, func(_ context.Context, _ int, path string) (eventFile, error) {
+		captured, _ := captureTime(path)
+		return eventFile{path: path, captured: captured}, nil
+	})
+	return groupEvents(dated, gap)
+}
+
+// groupEvents sorts files by capture time and names a folder for each run
+// of files no more than gap apart after its date range: 2024-05-01, or
+// 2024-05-01_2024-05-03 when it spans days. Events of the same range are
+// numbered 2024-05-01_2, ... and files without a capture time are undated.
+func groupEvents(files []eventFile, gap time.Duration) map[string]string {
+	sorted := make([]eventFile, len(files))
+	copy(sorted, files)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].captured.Before(sorted[j].captured) })
+
+	folders := make(map[string]string, len(files))
+	used := make(map[string]int)
+	for start := 0; start < len(sorted); {
+		if sorted[start].captured.IsZero() {
+			folders[sorted[start].path] = undatedEvent
+			start++
+			continue
+		}
+		end := start + 1
+		for end < len(sorted) && sorted[end].captured.Sub(sorted[end-1].captured) <= gap {
+			end++
+		}
+
+		name := eventName(sorted[start].captured, sorted[end-1].captured)
+		used[name]++
+		if used[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, used[name])
+		}
+		for _, f := range sorted[start:end] {
+			folders[f.path] = name
+		}
+		start = end
+	}
+	return folders
+}
+
+// countEvents returns the number of event folders
+func countEvents(folders map[string]string) int {
+	names := make(map[string]bool)
+	for _, name := range folders {
+		names[name] = true
+	}
+	return len(names)
+}
+
+// eventName names an event after the days of its first and last capture
+func eventName(first, last time.Time) string {
+	from, to := first.Format(time.DateOnly), last.Format(time.DateOnly)
+	if from == to {
+		return from
+	}
+	return from + "_" + to
+}
+
+// eventProcessor wraps process to write the outputs of each file into the
+// folder of its event
+func eventProcessor(folders map[string]string, process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		if folder, ok := folders[path]; ok {
+			config.OutputDir = filepath.Join(config.OutputDir, folder)
+			if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+				return processor.Result{InputPath: path}, err
+			}
+		}
+		return process(path, config)
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestParseEventGap(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"4h", false},
+		{"90m", false},
+		{"0s", true},
+		{"-4h", true},
+		{"4", true},
+	}
+
+	for _, test := range tests {
+		if _, err := parseEventGap(test.value); (err != nil) != test.wantErr {
+			t.Errorf("parseEventGap(%q) error = %v, wantErr %v", test.value, err, test.wantErr)
+		}
+	}
+}
+
+func TestGroupEvents(t *testing.T) {
+	at := func(day, hour int) time.Time { return time.Date(2024, 5, day, hour, 0, 0, 0, time.UTC) }
+	files := []eventFile{
+		{"trip/4.jpg", at(3, 1)},
+		{"trip/1.jpg", at(1, 9)},
+		{"trip/2.jpg", at(1, 12)},
+		{"scan.png", time.Time{}},
+		{"trip/3.jpg", at(2, 23)},
+		{"party/1.jpg", at(5, 9)},
+		{"party/2.jpg", at(5, 20)},
+	}
+
+	folders := groupEvents(files, 4*time.Hour)
+
+	expected := map[string]string{
+		"trip/1.jpg":  "2024-05-01",
+		"trip/2.jpg":  "2024-05-01",
+		"trip/3.jpg":  "2024-05-02_2024-05-03",
+		"trip/4.jpg":  "2024-05-02_2024-05-03",
+		"party/1.jpg": "2024-05-05",
+		"party/2.jpg": "2024-05-05_2",
+		"scan.png":    undatedEvent,
+	}
+	for path, folder := range expected {
+		if folders[path] != folder {
+			t.Errorf("folder of %s = %q, expected %q", path, folders[path], folder)
+		}
+	}
+	if n := countEvents(folders); n != 5 {
+		t.Errorf("countEvents() = %d, expected 5", n)
+	}
+}
+
+func TestEventProcessor(t *testing.T) {
+	tempDir := t.TempDir()
+	folders := map[string]string{"a.jpg": "2024-05-01"}
+
+	var outputDirs []string
+	process := eventProcessor(folders, func(path string, config processor.Config) (processor.Result, error) {
+		outputDirs = append(outputDirs, config.OutputDir)
+		return processor.Result{InputPath: path}, nil
+	})
+
+	for _, path := range []string{"a.jpg", "b.jpg"} {
+		if _, err := process(path, processor.Config{OutputDir: tempDir}); err != nil {
+			t.Fatalf("process(%s) error = %v", path, err)
+		}
+	}
+	if outputDirs[0] != filepath.Join(tempDir, "2024-05-01") || outputDirs[1] != tempDir {
+		t.Errorf("output directories = %v", outputDirs)
+	}
+	if info, err := os.Stat(outputDirs[0]); err != nil || !info.IsDir() {
+		t.Errorf("event folder not created: %v", err)
+	}
+}
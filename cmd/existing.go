@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// existingPolicy returns the policy for outputs of an earlier run selected
+// by --skip-existing, --if-newer and --overwrite. Without any of them
+// outputs are replaced, with a warning at the end of the run.
+func existingPolicy(skip, ifNewer, overwrite bool) (processor.ExistingPolicy, error) {
+	chosen := 0
+	for _, set := range []bool{skip, ifNewer, overwrite} {
+		if set {
+			chosen++
+		}
+	}
+	switch {
+	case chosen > 1:
+		return 0, fmt.Errorf("only one of --skip-existing, --if-newer and --overwrite can be used")
+	case skip:
+		return processor.ExistingSkip, nil
+	case ifNewer:
+		return processor.ExistingIfNewer, nil
+	}
+	return processor.ExistingOverwrite, nil
+}
+
+// countReplaced returns the number of results that overwrote an output of
+// an earlier run
+func countReplaced(results []fileResult) int {
+	replaced := 0
+	for _, r := range results {
+		if r.err == nil && r.Replaced {
+			replaced++
+		}
+	}
+	return replaced
+}
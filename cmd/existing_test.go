@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestExistingPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		skip      bool
+		ifNewer   bool
+		overwrite bool
+		expected  processor.ExistingPolicy
+		wantErr   bool
+	}{
+		{"Default", false, false, false, processor.ExistingOverwrite, false},
+		{"Skip existing", true, false, false, processor.ExistingSkip, false},
+		{"If newer", false, true, false, processor.ExistingIfNewer, false},
+		{"Overwrite", false, false, true, processor.ExistingOverwrite, false},
+		{"Skip and if newer", true, true, false, 0, true},
+		{"If newer and overwrite", false, true, true, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := existingPolicy(test.skip, test.ifNewer, test.overwrite)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("existingPolicy() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && policy != test.expected {
+				t.Errorf("existingPolicy() = %v, expected %v", policy, test.expected)
+			}
+		})
+	}
+}
+
+func TestCountReplaced(t *testing.T) {
+	results := []fileResult{
+		{path: "a.jpg", Result: processor.Result{Replaced: true}},
+		{path: "b.jpg"},
+		{path: "c.jpg", Result: processor.Result{Skipped: true}},
+		{path: "d.jpg", Result: processor.Result{Replaced: true}, err: errors.New("failed")},
+	}
+	if n := countReplaced(results); n != 1 {
+		t.Errorf("countReplaced() = %d, expected 1", n)
+	}
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+var faviconCmd = &cobra.Command{
+	Use:   "favicon <image>",
+	Short: "Generate favicon.ico and PNG favicons from one image",
+	Long: `Writes favicon.ico (16, 32 and 48 pixels) and favicon-NxN.png for the standard
+favicon sizes (16, 32, 48, 180, 192 and 512) into the output directory. Non-square
+images are centered on a transparent square, or cropped to one with --mode fill.`,
+	Args: cobra.ExactArgs(1),
+	Run:  func(cmd *cobra.Command, args []string) { runFavicon(args[0]) },
+}
+
+func init() {
+	rootCmd.AddCommand(faviconCmd)
+}
+
+func runFavicon(inputPath string) {
+	if err := validateInputs(); err != nil {
+		logger.Error("Input validation failed", "error", err)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		logger.Error("Failed to create output directory", "dir", outputDir, "error", err)
+		os.Exit(1)
+	}
+
+	config := processor.Config{
+		OutputDir:     outputDir,
+		Deterministic: deterministic,
+		Fill:          resizeMode == "fill",
+		Gravity:       gravity,
+		Logger:        logger,
+	}
+	if chmodMode != "" {
+		config.Mode, _ = parseChmod(chmodMode)
+	}
+	if chownOwner != "" {
+		config.Owner, _ = parseChown(chownOwner)
+	}
+	if whiteBalance != "" {
+		config.WhiteBalance, _ = parseWhiteBalance(whiteBalance, exposureLevel)
+	}
+	if assumeProfile != "" {
+		config.AssumeProfile, _ = processor.OpenColorProfile(assumeProfile)
+	}
+
+	outputs, err := processor.Favicon(inputPath, config)
+	if err != nil {
+		logger.Error("Failed to generate favicons", "file", inputPath, "error", err)
+		os.Exit(1)
+	}
+	for _, output := range outputs {
+		logger.Info("Wrote", "file", output)
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// flattenSeparator joins the directories and name of flattened outputs
+const flattenSeparator = "_"
+
+// flatName returns the output name of the input at path under root with
+// its relative directories as a prefix, such as vacation_day1_IMG01 for
+// vacation/day1/IMG01.jpg, without extension
+func flatName(root, path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return name
+	}
+	parts := append(strings.Split(filepath.ToSlash(rel), "/"), name)
+	return strings.Join(parts, flattenSeparator)
+}
+
+// flattenProcessor wraps process to name the outputs of files in
+// subdirectories of root after their relative path, so that a tree can be
+// written into one folder without name clashes
+func flattenProcessor(root string, process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		config.OutputName = flatName(root, path)
+		return process(path, config)
+	}
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestFlatName(t *testing.T) {
+	root := filepath.Join("photos", "2024")
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{filepath.Join(root, "IMG01.jpg"), "IMG01"},
+		{filepath.Join(root, "vacation", "IMG01.jpg"), "vacation_IMG01"},
+		{filepath.Join(root, "vacation", "day1", "IMG01.heic"), "vacation_day1_IMG01"},
+		{filepath.Join(root, "my trip", "a.b.png"), "my trip_a.b"},
+		{filepath.Join("elsewhere", "IMG02.jpg"), "IMG02"},
+	}
+
+	for _, test := range tests {
+		if got := flatName(root, test.path); got != test.expected {
+			t.Errorf("flatName(%q) = %q, expected %q", test.path, got, test.expected)
+		}
+	}
+}
+
+func TestFlattenProcessor(t *testing.T) {
+	var name string
+	process := flattenProcessor("in", func(path string, config processor.Config) (processor.Result, error) {
+		name = config.OutputName
+		return processor.Result{InputPath: path}, nil
+	})
+	if _, err := process(filepath.Join("in", "day1", "IMG01.jpg"), processor.Config{}); err != nil {
+		t.Fatalf("process() error = %v", err)
+	}
+	if name != "day1_IMG01" {
+		t.Errorf("OutputName = %q, expected day1_IMG01", name)
+	}
+}
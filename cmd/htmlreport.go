@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+
+	"picture-resize-tools/pkg/pool"
+	"picture-resize-tools/pkg/processor"
+)
+
+// Sizes of the images in the HTML report: thumbnails are shown, SSIM is
+// computed at the larger comparison size
+const (
+	reportThumbnailSize = 240
+	reportCompareSize   = 512
+)
+
+// reportEntry is one file of the HTML report
+type reportEntry struct {
+	Name       string
+	Before     template.URL
+	After      template.URL
+	InputSize  string
+	OutputSize string
+	Saved      string
+	SSIM       string
+	Err        string
+}
+
+// reportPage is one page of the HTML report
+type reportPage struct {
+	Version  string
+	Settings string
+	Summary  string
+	Page     int
+	Pages    int
+	Prev     string
+	Next     string
+	Entries  []reportEntry
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Processing report{{if gt .Pages 1}} ({{.Page}}/{{.Pages}}){{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.5em; text-align: left; vertical-align: middle; }
+td img { display: block; max-width: 240px; max-height: 240px; }
+.error { color: #b00020; }
+nav { margin: 1em 0; }
+</style>
+</head>
+<body>
+<h1>Processing report</h1>
+<p>{{.Settings}}<br>{{.Summary}}</p>
+{{define "nav"}}{{if gt .Pages 1}}<nav>{{if .Prev}}<a href="{{.Prev}}">&larr; Previous</a> {{end}}Page {{.Page}} of {{.Pages}}{{if .Next}} <a href="{{.Next}}">Next &rarr;</a>{{end}}</nav>{{end}}{{end}}
+{{template "nav" .}}
+<table>
+<tr><th>File</th><th>Before</th><th>After</th><th>Size</th><th>SSIM</th></tr>
+{{range .Entries}}<tr>
+<td>{{.Name}}</td>
+{{if .Err}}<td colspan="4" class="error">{{.Err}}</td>
+{{else}}<td>{{if .Before}}<img src="{{.Before}}" alt="Original">{{end}}</td>
+<td>{{if .After}}<img src="{{.After}}" alt="Processed">{{end}}</td>
+<td>{{.InputSize}} &rarr; {{.OutputSize}}<br>{{.Saved}}</td>
+<td>{{.SSIM}}</td>
+{{end}}</tr>
+{{end}}</table>
+{{template "nav" .}}
+<p><small>SSIM compares the original scaled to the output with the output, 1 meaning no visible difference.
+Generated by picture-resize-tools {{.Version}}.</small></p>
+</body>
+</html>
+`))
+
+// writeHTMLReport writes an HTML report of results with before and after
+// thumbnails, sizes and SSIM, pageSize files per page, and returns the
+// number of pages. The first page is path, the others are numbered after
+// it: report.html, report-2.html, ...
+func writeHTMLReport(path string, pageSize int, results []fileResult, config processor.Config) (int, error) {
+	entries, _ := pool.Map(context.Background(), &pool.Pool{Workers: workers}, results, func(_ context.Context, _ int, r fileResult) (reportEntry, error) {
+		return newReportEntry(r), nil
+	})
+
+	format := config.OutputFormat
+	if config.KeepFormat {
+		format = "original format"
+	}
+	settings := fmt.Sprintf("Settings: %s, maximum %dx%d, quality %d", format, config.MaxWidth, config.MaxHeight, config.Quality)
+	summary := summarizeRun(results, 0, 0)
+	totals := fmt.Sprintf("%d files, %s → %s", summary.succeeded, formatBytes(summary.inputSize), formatBytes(summary.outputSize))
+	if summary.failed > 0 {
+		totals += fmt.Sprintf(", %d failed", summary.failed)
+	}
+
+	pages := max(1, (len(entries)+pageSize-1)/pageSize)
+	for page := 1; page <= pages; page++ {
+		data := reportPage{
+			Version:  version,
+			Settings: settings,
+			Summary:  totals,
+			Page:     page,
+			Pages:    pages,
+			Entries:  entries[(page-1)*pageSize : min(page*pageSize, len(entries))],
+		}
+		if page > 1 {
+			data.Prev = filepath.Base(reportPagePath(path, page-1))
+		}
+		if page < pages {
+			data.Next = filepath.Base(reportPagePath(path, page+1))
+		}
+
+		var b bytes.Buffer
+		if err := reportTemplate.Execute(&b, data); err != nil {
+			return 0, err
+		}
+		if err := os.WriteFile(reportPagePath(path, page), b.Bytes(), 0644); err != nil {
+			return 0, err
+		}
+	}
+	return pages, nil
+}
+
+// reportPagePath returns the file of page of the report at path
+func reportPagePath(path string, page int) string {
+	if page == 1 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), page, ext)
+}
+
+// newReportEntry compares the input and output of r. Anonymized runs show
+// the output names only.
+func newReportEntry(r fileResult) reportEntry {
+	entry := reportEntry{Name: r.path}
+	if rel, err := filepath.Rel(inputDir, r.path); err == nil {
+		entry.Name = filepath.ToSlash(rel)
+	}
+	if anon != nil {
+		entry.Name = filepath.Base(r.OutputPath)
+	}
+	if r.err != nil {
+		entry.Err = r.err.Error()
+		return entry
+	}
+
+	entry.InputSize = formatBytes(r.InputSize)
+	entry.OutputSize = formatBytes(r.OutputSize)
+	entry.Saved = fmt.Sprintf("%.1f%% saved", groupStats{inputSize: r.InputSize, outputSize: r.OutputSize}.savedPercent())
+
+	// Files that cannot be compared still show their sizes
+	before, after, ssim, err := compareOutput(r.path, r.OutputPath)
+	entry.SSIM = "n/a"
+	if err == nil {
+		entry.SSIM = fmt.Sprintf("%.4f", ssim)
+	}
+	entry.Before = thumbnailURL(before)
+	entry.After = thumbnailURL(after)
+	return entry
+}
+
+// compareOutput loads the input and output at the comparison size and
+// returns them with the SSIM of the input scaled and cropped to the output
+func compareOutput(inputPath, outputPath string) (image.Image, image.Image, float64, error) {
+	before, err := processor.Thumbnail(inputPath, reportCompareSize)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	after, err := processor.Thumbnail(outputPath, reportCompareSize)
+	if err != nil {
+		return before, nil, 0, err
+	}
+
+	scaled := imaging.Fill(before, after.Bounds().Dx(), after.Bounds().Dy(), imaging.Center, imaging.Lanczos)
+	ssim, err := processor.SSIM(scaled, after)
+	return before, after, ssim, err
+}
+
+// thumbnailURL encodes img as a JPEG data URL, flattened onto white, or
+// returns an empty URL for a nil img
+func thumbnailURL(img image.Image) template.URL {
+	if img == nil {
+		return ""
+	}
+	thumbnail := imaging.Fit(img, reportThumbnailSize, reportThumbnailSize, imaging.Lanczos)
+	flat := imaging.New(thumbnail.Bounds().Dx(), thumbnail.Bounds().Dy(), color.White)
+	flat = imaging.Overlay(flat, thumbnail, image.Point{}, 1)
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, flat, &jpeg.Options{Quality: 80}); err != nil {
+		return ""
+	}
+	return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(b.Bytes()))
+}
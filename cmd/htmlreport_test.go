@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestReportPagePath(t *testing.T) {
+	tests := []struct {
+		page     int
+		expected string
+	}{
+		{1, "out/report.html"},
+		{2, "out/report-2.html"},
+		{12, "out/report-12.html"},
+	}
+
+	for _, test := range tests {
+		if got := reportPagePath("out/report.html", test.page); got != test.expected {
+			t.Errorf("reportPagePath(%d) = %s, expected %s", test.page, got, test.expected)
+		}
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	tempDir := t.TempDir()
+	oldInput := inputDir
+	inputDir = tempDir
+	defer func() { inputDir = oldInput }()
+
+	// An input and its smaller output, and one that looks nothing like it
+	input := imaging.New(400, 300, color.White)
+	for x := 0; x < 400; x += 20 {
+		input = imaging.Paste(input, imaging.New(10, 300, color.Black), image.Pt(x, 0))
+	}
+	inputPath := filepath.Join(tempDir, "stripes.png")
+	outputPath := filepath.Join(tempDir, "stripes.jpg")
+	grayPath := filepath.Join(tempDir, "gray.jpg")
+	for path, img := range map[string]image.Image{
+		inputPath:  input,
+		outputPath: imaging.Resize(input, 200, 150, imaging.Lanczos),
+		grayPath:   imaging.New(200, 150, color.Gray{128}),
+	} {
+		if err := imaging.Save(img, path); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	results := []fileResult{
+		{path: inputPath, Result: processor.Result{OutputPath: outputPath, InputSize: 4000, OutputSize: 1000}},
+		{path: inputPath, Result: processor.Result{OutputPath: grayPath, InputSize: 4000, OutputSize: 500}},
+		{path: filepath.Join(tempDir, "broken.heic"), err: errors.New("decode <error>")},
+	}
+
+	reportPath := filepath.Join(tempDir, "report.html")
+	config := processor.Config{OutputFormat: "jpg", MaxWidth: 200, MaxHeight: 200, Quality: 80}
+	pages, err := writeHTMLReport(reportPath, 2, results, config)
+	if err != nil {
+		t.Fatalf("writeHTMLReport() error = %v", err)
+	}
+	if pages != 2 {
+		t.Fatalf("writeHTMLReport() = %d pages, expected 2", pages)
+	}
+
+	first, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Failed to read first page: %v", err)
+	}
+	second, err := os.ReadFile(filepath.Join(tempDir, "report-2.html"))
+	if err != nil {
+		t.Fatalf("Failed to read second page: %v", err)
+	}
+
+	for _, want := range []string{"stripes.png", "data:image/jpeg;base64,", "3.9 KiB", "75.0% saved", `href="report-2.html"`, "Page 1 of 2", "jpg, maximum 200x200, quality 80"} {
+		if !strings.Contains(string(first), want) {
+			t.Errorf("first page is missing %q", want)
+		}
+	}
+	for _, want := range []string{"broken.heic", "decode &lt;error&gt;", `href="report.html"`, "Page 2 of 2"} {
+		if !strings.Contains(string(second), want) {
+			t.Errorf("second page is missing %q", want)
+		}
+	}
+
+	// The faithful output scores higher than the unrelated one
+	_, _, faithful, err := compareOutput(inputPath, outputPath)
+	if err != nil {
+		t.Fatalf("compareOutput() error = %v", err)
+	}
+	_, _, unrelated, _ := compareOutput(inputPath, grayPath)
+	if faithful < 0.9 || unrelated >= faithful {
+		t.Errorf("compareOutput() SSIM = %g and %g, expected the first above 0.9 and higher", faithful, unrelated)
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+var (
+	iconPlatforms    []string
+	iconContentsJSON bool
+	iconBackground   string
+)
+
+var iconsCmd = &cobra.Command{
+	Use:   "icons <image>",
+	Short: "Generate iOS, Android and PWA app icon sets from one image",
+	Long: `Writes every icon size a platform requires into the output directory:
+AppIcon.appiconset for iOS, android/mipmap-*/ic_launcher.png and the Play Store icon,
+and pwa/icon-NxN.png for web app manifests. Non-square images are centered on a
+transparent square, or cropped to one with --mode fill. iOS icons may not be
+transparent and are flattened onto --background.`,
+	Args: cobra.ExactArgs(1),
+	Run:  func(cmd *cobra.Command, args []string) { runIcons(args[0]) },
+}
+
+func init() {
+	iconsCmd.Flags().StringSliceVar(&iconPlatforms, "platforms", processor.IconPlatforms(), "Icon sets to generate: "+strings.Join(processor.IconPlatforms(), ", "))
+	iconsCmd.Flags().BoolVar(&iconContentsJSON, "contents-json", false, "Write the Contents.json Xcode needs to import the iOS icon set")
+	iconsCmd.Flags().StringVar(&iconBackground, "background", "#ffffff", "Background of the iOS icons as #rrggbb")
+	rootCmd.AddCommand(iconsCmd)
+}
+
+// parseHexColor parses an opaque #rrggbb color; the # is optional
+func parseHexColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return nil, fmt.Errorf("color must be #rrggbb, got: %s", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("color must be #rrggbb, got: %s", s)
+	}
+	return color.NRGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
+
+// validateIcons validates the icons options
+func validateIcons() error {
+	if len(iconPlatforms) == 0 {
+		return fmt.Errorf("at least one platform is required")
+	}
+	for _, platform := range iconPlatforms {
+		if !slices.Contains(processor.IconPlatforms(), platform) {
+			return fmt.Errorf("platform must be one of %s, got: %s", strings.Join(processor.IconPlatforms(), ", "), platform)
+		}
+	}
+	if _, err := parseHexColor(iconBackground); err != nil {
+		return err
+	}
+	return nil
+}
+
+func runIcons(inputPath string) {
+	if err := validateInputs(); err != nil {
+		logger.Error("Input validation failed", "error", err)
+		os.Exit(1)
+	}
+	if err := validateIcons(); err != nil {
+		logger.Error("Input validation failed", "error", err)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		logger.Error("Failed to create output directory", "dir", outputDir, "error", err)
+		os.Exit(1)
+	}
+
+	config := processor.Config{
+		OutputDir:     outputDir,
+		Deterministic: deterministic,
+		Fill:          resizeMode == "fill",
+		Gravity:       gravity,
+		Logger:        logger,
+	}
+	if chmodMode != "" {
+		config.Mode, _ = parseChmod(chmodMode)
+	}
+	if chownOwner != "" {
+		config.Owner, _ = parseChown(chownOwner)
+	}
+	if whiteBalance != "" {
+		config.WhiteBalance, _ = parseWhiteBalance(whiteBalance, exposureLevel)
+	}
+	if assumeProfile != "" {
+		config.AssumeProfile, _ = processor.OpenColorProfile(assumeProfile)
+	}
+
+	options := processor.IconOptions{
+		Platforms:    iconPlatforms,
+		ContentsJSON: iconContentsJSON,
+	}
+	options.Background, _ = parseHexColor(iconBackground)
+
+	outputs, err := processor.Icons(inputPath, options, config)
+	if err != nil {
+		logger.Error("Failed to generate icons", "file", inputPath, "error", err)
+		os.Exit(1)
+	}
+	for _, output := range outputs {
+		logger.Info("Wrote", "file", output)
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected color.Color
+		ok       bool
+	}{
+		{"#ffffff", color.NRGBA{255, 255, 255, 255}, true},
+		{"1a2B3c", color.NRGBA{0x1a, 0x2b, 0x3c, 255}, true},
+		{"#fff", nil, false},
+		{"#gggggg", nil, false},
+		{"", nil, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseHexColor(test.input)
+		if (err == nil) != test.ok {
+			t.Errorf("parseHexColor(%q) error = %v, expected ok %v", test.input, err, test.ok)
+			continue
+		}
+		if test.ok && got != test.expected {
+			t.Errorf("parseHexColor(%q) = %v, expected %v", test.input, got, test.expected)
+		}
+	}
+}
+
+func TestValidateIcons(t *testing.T) {
+	defer func() { iconPlatforms, iconBackground = []string{"android", "ios", "pwa"}, "#ffffff" }()
+
+	tests := []struct {
+		name       string
+		platforms  []string
+		background string
+		errorMsg   string
+	}{
+		{"Defaults", []string{"android", "ios", "pwa"}, "#ffffff", ""},
+		{"iOS only", []string{"ios"}, "000000", ""},
+		{"No platforms", nil, "#ffffff", "at least one platform is required"},
+		{"Unknown platform", []string{"ios", "windows"}, "#ffffff", "platform must be one of android, ios, pwa"},
+		{"Bad background", []string{"ios"}, "white", "color must be #rrggbb"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			iconPlatforms, iconBackground = test.platforms, test.background
+			err := validateIcons()
+			if test.errorMsg == "" {
+				if err != nil {
+					t.Errorf("validateIcons() error = %v, expected nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), test.errorMsg) {
+				t.Errorf("validateIcons() error = %v, expected %q", err, test.errorMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// slowReportInterval is how often verbose mode reports files still being processed
+var slowReportInterval = 10 * time.Second
+
+// inFlightFile is a file currently being processed by a worker
+type inFlightFile struct {
+	worker int
+	path   string
+	start  time.Time
+	// stage is the processing step the file is in, if reported
+	stage processor.Stage
+}
+
+// inFlightTracker records which worker is processing which file
+type inFlightTracker struct {
+	mu    sync.Mutex
+	files map[int]inFlightFile
+}
+
+func newInFlightTracker() *inFlightTracker {
+	return &inFlightTracker{files: make(map[int]inFlightFile)}
+}
+
+// start marks path as being processed by worker and returns the start time
+func (t *inFlightTracker) start(worker int, path string) time.Time {
+	now := time.Now()
+	t.mu.Lock()
+	t.files[worker] = inFlightFile{worker: worker, path: path, start: now}
+	t.mu.Unlock()
+	return now
+}
+
+// setStage records the processing step of the file of worker
+func (t *inFlightTracker) setStage(worker int, stage processor.Stage) {
+	t.mu.Lock()
+	if f, ok := t.files[worker]; ok {
+		f.stage = stage
+		t.files[worker] = f
+	}
+	t.mu.Unlock()
+}
+
+// finish marks worker as idle
+func (t *inFlightTracker) finish(worker int) {
+	t.mu.Lock()
+	delete(t.files, worker)
+	t.mu.Unlock()
+}
+
+// runningLongerThan returns the in-flight files that started more than d ago,
+// ordered by worker ID
+func (t *inFlightTracker) runningLongerThan(d time.Duration) []inFlightFile {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var files []inFlightFile
+	for _, f := range t.files {
+		if time.Since(f.start) >= d {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].worker < files[j].worker })
+	return files
+}
+
+// reportPeriodically prints files that have been running for at least
+// interval, every interval, until the returned stop function is called
+func (t *inFlightTracker) reportPeriodically(interval time.Duration) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, f := range t.runningLongerThan(interval) {
+					elapsed := time.Since(f.start).Round(time.Second).String()
+					if f.stage != "" {
+						elapsed += ", " + string(f.stage)
+					}
+					logger.Info("Still processing", "worker", f.worker, "file", f.path, "elapsed", elapsed)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestInFlightTracker(t *testing.T) {
+	tracker := newInFlightTracker()
+
+	tracker.start(2, "b.jpg")
+	tracker.start(1, "a.jpg")
+	tracker.files[1] = inFlightFile{worker: 1, path: "a.jpg", start: time.Now().Add(-time.Minute)}
+
+	slow := tracker.runningLongerThan(30 * time.Second)
+	if len(slow) != 1 || slow[0].path != "a.jpg" {
+		t.Errorf("runningLongerThan() = %v, expected only a.jpg", slow)
+	}
+
+	all := tracker.runningLongerThan(0)
+	if len(all) != 2 || all[0].worker != 1 || all[1].worker != 2 {
+		t.Errorf("runningLongerThan(0) = %v, expected workers 1 and 2 in order", all)
+	}
+
+	tracker.setStage(2, processor.StageEncode)
+	tracker.setStage(3, processor.StageDecode)
+	if all := tracker.runningLongerThan(0); len(all) != 2 || all[1].stage != processor.StageEncode {
+		t.Errorf("runningLongerThan(0) = %v, expected b.jpg in the encode stage", all)
+	}
+
+	tracker.finish(1)
+	tracker.finish(2)
+	if remaining := tracker.runningLongerThan(0); len(remaining) != 0 {
+		t.Errorf("runningLongerThan() after finish = %v, expected none", remaining)
+	}
+}
+
+func TestProcessImagesConcurrentlyWorkerIDs(t *testing.T) {
+	oldWorkers, oldVerbose := workers, verbose
+	defer func() { workers, verbose = oldWorkers, oldVerbose }()
+	workers = 3
+	verbose = false
+
+	files := make([]string, 20)
+	for i := range files {
+		files[i] = "file.jpg"
+	}
+
+	var mu sync.Mutex
+	active := 0
+	maxActive := 0
+	process := func(path string, _ processor.Config) (processor.Result, error) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return processor.Result{}, nil
+	}
+
+	processImagesConcurrentlyWithFunc(files, processor.Config{}, process)
+
+	if maxActive > workers {
+		t.Errorf("processImagesConcurrentlyWithFunc() ran %d files at once, expected at most %d", maxActive, workers)
+	}
+}
+
+func TestProcessImagesConcurrentlyRecoversPanics(t *testing.T) {
+	oldWorkers, oldVerbose := workers, verbose
+	defer func() { workers, verbose = oldWorkers, oldVerbose }()
+	workers = 2
+	verbose = false
+
+	process := func(path string, _ processor.Config) (processor.Result, error) {
+		if path == "bad.tif" {
+			var pixels []byte
+			_ = pixels[1]
+		}
+		return processor.Result{InputPath: path}, nil
+	}
+
+	results := processImagesConcurrentlyWithFunc([]string{"a.jpg", "bad.tif", "c.jpg"}, processor.Config{}, process)
+	if len(results) != 3 {
+		t.Fatalf("processImagesConcurrentlyWithFunc() returned %d results, expected 3", len(results))
+	}
+	for _, result := range results {
+		failed := result.err != nil
+		if failed != (result.path == "bad.tif") {
+			t.Errorf("%s: err = %v", result.path, result.err)
+		}
+		if failed && !strings.HasPrefix(result.err.Error(), "panic: ") {
+			t.Errorf("%s: err = %v, expected the recovered panic", result.path, result.err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// journalFileName is the file in the output directory that records the
+// outputs being written
+const journalFileName = ".picture-resize-journal"
+
+// journal records outputs being written; nil disables it
+var journal *writeJournal
+
+// journalEntry is one line of the journal. A begin entry without a
+// matching end entry marks an output that may be half-written.
+type journalEntry struct {
+	Op         string `json:"op"`
+	Input      string `json:"input,omitempty"`
+	Output     string `json:"output,omitempty"`
+	KeepFormat bool   `json:"keep_format,omitempty"`
+}
+
+// writeJournal appends begin and end entries around each output write
+type writeJournal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// openJournal starts a new journal in dir for a run that keeps the input
+// formats or not
+func openJournal(dir string, keepFormat bool) (*writeJournal, error) {
+	path := filepath.Join(dir, journalFileName)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j := &writeJournal{path: path, file: file}
+	if err := j.append(journalEntry{Op: "run", KeepFormat: keepFormat}, true); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// append writes entry, syncing it to disk when sync is set
+func (j *writeJournal) append(entry journalEntry, sync bool) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if sync {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+// wrap returns a processing function that journals the output write. The
+// begin entry is on disk before the output is touched; a lost end entry
+// only means a finished file is redone.
+func (j *writeJournal) wrap(process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		config.BeforeWrite = func(outputPath string) error {
+			return j.append(journalEntry{Op: "begin", Input: path, Output: outputPath}, true)
+		}
+		result, err := process(path, config)
+		if err == nil {
+			err = j.append(journalEntry{Op: "end", Input: path}, false)
+		}
+		return result, err
+	}
+}
+
+// close closes the journal and removes it, as nothing is in progress
+func (j *writeJournal) close() error {
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(j.path)
+}
+
+// recoverJournal removes the outputs an interrupted run left half-written
+// in dir and returns their inputs for a resumed run. It returns nil when
+// no output was interrupted.
+func recoverJournal(dir string) (*resumeState, error) {
+	path := filepath.Join(dir, journalFileName)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state resumeState
+	open := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry journalEntry
+		// A crash can cut off the last line
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		switch entry.Op {
+		case "run":
+			state.KeepFormat = entry.KeepFormat
+		case "begin":
+			open[entry.Input] = entry.Output
+		case "end":
+			delete(open, entry.Input)
+		}
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for input, output := range open {
+		if err := os.Remove(output); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		state.Files = append(state.Files, input)
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+	if len(state.Files) == 0 {
+		return nil, nil
+	}
+	sort.Strings(state.Files)
+	return &state, nil
+}
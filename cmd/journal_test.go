@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestWriteJournal(t *testing.T) {
+	dir := t.TempDir()
+	j, err := openJournal(dir, true)
+	if err != nil {
+		t.Fatalf("openJournal() error = %v", err)
+	}
+
+	// Fake processing that writes its output after BeforeWrite, and
+	// crashes halfway through for b.jpg
+	crash := errors.New("crash")
+	process := j.wrap(func(path string, config processor.Config) (processor.Result, error) {
+		output := filepath.Join(dir, filepath.Base(path))
+		if err := config.BeforeWrite(output); err != nil {
+			return processor.Result{}, err
+		}
+		if err := os.WriteFile(output, []byte("partial"), 0644); err != nil {
+			return processor.Result{}, err
+		}
+		if filepath.Base(path) == "b.jpg" {
+			return processor.Result{}, crash
+		}
+		return processor.Result{InputPath: path, OutputPath: output}, nil
+	})
+
+	if _, err := process("in/a.jpg", processor.Config{}); err != nil {
+		t.Fatalf("process(a.jpg) error = %v", err)
+	}
+	if _, err := process("in/b.jpg", processor.Config{}); err != crash {
+		t.Fatalf("process(b.jpg) error = %v, expected crash", err)
+	}
+
+	// Simulate a torn last line from a crash during the journal write
+	f, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	f.WriteString(`{"op":"be`)
+	f.Close()
+
+	state, err := recoverJournal(dir)
+	if err != nil {
+		t.Fatalf("recoverJournal() error = %v", err)
+	}
+	expected := resumeState{KeepFormat: true, Files: []string{"in/b.jpg"}}
+	if state == nil || !reflect.DeepEqual(*state, expected) {
+		t.Errorf("recoverJournal() = %+v, expected %+v", state, expected)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.jpg")); !os.IsNotExist(err) {
+		t.Error("recoverJournal() did not remove the half-written b.jpg")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.jpg")); err != nil {
+		t.Errorf("recoverJournal() removed the finished a.jpg: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, journalFileName)); !os.IsNotExist(err) {
+		t.Error("recoverJournal() left the journal behind")
+	}
+
+	if state, err := recoverJournal(dir); state != nil || err != nil {
+		t.Errorf("recoverJournal() without journal = %v, %v, expected nil, nil", state, err)
+	}
+}
+
+func TestWriteJournalClose(t *testing.T) {
+	dir := t.TempDir()
+	j, err := openJournal(dir, false)
+	if err != nil {
+		t.Fatalf("openJournal() error = %v", err)
+	}
+	if err := j.close(); err != nil {
+		t.Fatalf("close() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, journalFileName)); !os.IsNotExist(err) {
+		t.Error("close() left the journal behind")
+	}
+}
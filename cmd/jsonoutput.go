@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Types of the objects written with --json
+const (
+	jsonTypeFile    = "file"
+	jsonTypeSummary = "summary"
+)
+
+// jsonFile is the result of one file written with --json
+type jsonFile struct {
+	Type       string   `json:"type"`
+	Input      string   `json:"input"`
+	Output     string   `json:"output,omitempty"`
+	Pages      []string `json:"pages,omitempty"`
+	Sidecars   []string `json:"sidecars,omitempty"`
+	Scrubbed   []string `json:"scrubbed,omitempty"`
+	Width      int      `json:"width,omitempty"`
+	Height     int      `json:"height,omitempty"`
+	Skew       float64  `json:"skew,omitempty"`
+	InputSize  int64    `json:"input_size"`
+	OutputSize int64    `json:"output_size"`
+	DurationMS int64    `json:"duration_ms"`
+	Skipped    bool     `json:"skipped,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// jsonSlowFile is one of the slowest files of the summary
+type jsonSlowFile struct {
+	Input      string `json:"input"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// jsonSummary is the summary of a run written with --json
+type jsonSummary struct {
+	Type       string         `json:"type"`
+	Succeeded  int            `json:"succeeded"`
+	Failed     int            `json:"failed"`
+	Skipped    int            `json:"skipped"`
+	InputSize  int64          `json:"input_size"`
+	OutputSize int64          `json:"output_size"`
+	Ratio      float64        `json:"ratio"`
+	WallMS     int64          `json:"wall_ms"`
+	Slowest    []jsonSlowFile `json:"slowest"`
+}
+
+// newJSONFile converts a result for --json
+func newJSONFile(r fileResult) jsonFile {
+	file := jsonFile{
+		Type:       jsonTypeFile,
+		Input:      r.path,
+		DurationMS: r.duration.Milliseconds(),
+		InputSize:  r.InputSize,
+	}
+	if r.err != nil {
+		file.Error = r.err.Error()
+		return file
+	}
+	file.Output = r.OutputPath
+	file.Pages = r.Pages
+	file.Sidecars = r.Sidecars
+	file.Width, file.Height = r.Width, r.Height
+	file.Skew = r.Skew
+	file.Scrubbed = r.Scrubbed
+	file.OutputSize = r.OutputSize
+	file.Skipped = r.Skipped
+	return file
+}
+
+// newJSONSummary converts a summary for --json
+func newJSONSummary(s runSummary) jsonSummary {
+	summary := jsonSummary{
+		Type:       jsonTypeSummary,
+		Succeeded:  s.succeeded,
+		Failed:     s.failed,
+		Skipped:    s.skipped,
+		InputSize:  s.inputSize,
+		OutputSize: s.outputSize,
+		Ratio:      s.ratio(),
+		WallMS:     s.wall.Milliseconds(),
+		Slowest:    []jsonSlowFile{},
+	}
+	for _, r := range s.slowest {
+		summary.Slowest = append(summary.Slowest, jsonSlowFile{Input: r.path, DurationMS: r.duration.Milliseconds()})
+	}
+	return summary
+}
+
+// writeJSONResults writes a line per result in file order, then one with
+// the summary
+func writeJSONResults(w io.Writer, results []fileResult, summary runSummary) error {
+	encoder := json.NewEncoder(w)
+	for _, r := range results {
+		if err := encoder.Encode(newJSONFile(r)); err != nil {
+			return err
+		}
+	}
+	return encoder.Encode(newJSONSummary(summary))
+}
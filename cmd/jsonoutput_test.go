@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestWriteJSONResults(t *testing.T) {
+	results := []fileResult{
+		{path: "in/a.heic", duration: 1500 * time.Millisecond, Result: processor.Result{OutputPath: "out/a.jpg", Width: 800, Height: 600, InputSize: 4000, OutputSize: 1000}},
+		{path: "in/b.png", duration: time.Second, Result: processor.Result{InputSize: 999}, err: errors.New("truncated")},
+	}
+	var out bytes.Buffer
+	if err := writeJSONResults(&out, results, summarizeRun(results, 2, 3*time.Second)); err != nil {
+		t.Fatalf("writeJSONResults() error = %v", err)
+	}
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("writeJSONResults() wrote %d lines, expected 3", len(lines))
+	}
+
+	expected := []map[string]any{
+		{"type": "file", "input": "in/a.heic", "output": "out/a.jpg", "width": 800.0, "height": 600.0, "input_size": 4000.0, "output_size": 1000.0, "duration_ms": 1500.0},
+		{"type": "file", "input": "in/b.png", "input_size": 999.0, "output_size": 0.0, "duration_ms": 1000.0, "error": "truncated"},
+	}
+	for i, want := range expected {
+		if len(lines[i]) != len(want) {
+			t.Errorf("line %d = %v, expected %v", i, lines[i], want)
+			continue
+		}
+		for key, value := range want {
+			if lines[i][key] != value {
+				t.Errorf("line %d %s = %v, expected %v", i, key, lines[i][key], value)
+			}
+		}
+	}
+
+	summary := lines[2]
+	if summary["type"] != "summary" || summary["succeeded"] != 1.0 || summary["failed"] != 1.0 || summary["skipped"] != 2.0 ||
+		summary["ratio"] != 4.0 || summary["wall_ms"] != 3000.0 {
+		t.Errorf("summary = %v", summary)
+	}
+	if slowest, _ := summary["slowest"].([]any); len(slowest) != 1 {
+		t.Errorf("summary slowest = %v, expected a.heic", summary["slowest"])
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import "sync"
+
+// workerLimiter hands out worker IDs while fewer than limit workers are
+// active. The limit can be changed while files are being processed, and
+// a separate ceiling caps it independently.
+type workerLimiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	ceiling int
+	max     int
+	active  int
+	free    []int
+}
+
+// newWorkerLimiter creates a limiter for at most max workers, all allowed
+func newWorkerLimiter(max int) *workerLimiter {
+	l := &workerLimiter{limit: max, ceiling: max, max: max}
+	l.cond = sync.NewCond(&l.mu)
+	for id := max; id >= 1; id-- {
+		l.free = append(l.free, id)
+	}
+	return l
+}
+
+// Acquire blocks until a worker may start and returns its ID
+func (l *workerLimiter) Acquire() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit || l.active >= l.ceiling {
+		l.cond.Wait()
+	}
+	l.active++
+	id := l.free[len(l.free)-1]
+	l.free = l.free[:len(l.free)-1]
+	return id
+}
+
+// Release returns a worker ID
+func (l *workerLimiter) Release(id int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.free = append(l.free, id)
+	l.cond.Signal()
+}
+
+// setLimit changes the number of workers allowed to run at once, clamped
+// to between 1 and max. Running workers finish their current file.
+func (l *workerLimiter) setLimit(n int) int {
+	if n < 1 {
+		n = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n > l.max {
+		n = l.max
+	}
+	l.limit = n
+	l.cond.Broadcast()
+	return n
+}
+
+// currentLimit returns the number of workers allowed to run at once
+func (l *workerLimiter) currentLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// setCeiling caps the limit at n workers, clamped to between 1 and max,
+// without changing the limit itself
+func (l *workerLimiter) setCeiling(n int) {
+	if n < 1 {
+		n = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n > l.max {
+		n = l.max
+	}
+	l.ceiling = n
+	l.cond.Broadcast()
+}
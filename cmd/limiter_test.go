@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerLimiter(t *testing.T) {
+	l := newWorkerLimiter(3)
+
+	ids := map[int]bool{}
+	for i := 0; i < 3; i++ {
+		ids[l.Acquire()] = true
+	}
+	if len(ids) != 3 || !ids[1] || !ids[2] || !ids[3] {
+		t.Errorf("acquire() IDs = %v, expected 1, 2 and 3", ids)
+	}
+
+	// Lowering the limit blocks new workers until enough have finished
+	if n := l.setLimit(1); n != 1 {
+		t.Errorf("setLimit(1) = %d, expected 1", n)
+	}
+	acquired := make(chan int)
+	go func() { acquired <- l.Acquire() }()
+
+	l.Release(1)
+	l.Release(2)
+	select {
+	case <-acquired:
+		t.Fatal("acquire() returned while above the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.Release(3)
+	select {
+	case id := <-acquired:
+		if id < 1 || id > 3 {
+			t.Errorf("acquire() = %d, expected an ID between 1 and 3", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire() did not return after release")
+	}
+
+	if n := l.setLimit(10); n != 3 {
+		t.Errorf("setLimit(10) = %d, expected clamp to 3", n)
+	}
+	if n := l.setLimit(0); n != 1 {
+		t.Errorf("setLimit(0) = %d, expected clamp to 1", n)
+	}
+}
+
+func TestWorkerLimiterCeiling(t *testing.T) {
+	l := newWorkerLimiter(4)
+	l.setCeiling(1)
+
+	id := l.Acquire()
+	acquired := make(chan int)
+	go func() { acquired <- l.Acquire() }()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire() returned above the ceiling")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Raising the ceiling lets the waiting worker start
+	l.setCeiling(4)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("acquire() did not return after the ceiling was raised")
+	}
+	l.Release(id)
+
+	if l.currentLimit() != 4 {
+		t.Errorf("currentLimit() = %d, expected the ceiling to leave the limit at 4", l.currentLimit())
+	}
+}
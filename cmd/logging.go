@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// Log formats
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logLevels maps the values of --log-level to levels
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// logOutput receives the logs, written to standard error
+var logOutput = &logWriter{w: os.Stderr}
+
+// logger receives the diagnostics of the commands, set up from --log-level
+// and --log-format. Reports such as the summary of a run are printed to
+// standard output instead.
+var logger = slog.New(slog.NewTextHandler(logOutput, nil))
+
+// logWriter writes logs to w, above the progress bar while one is drawn
+type logWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	bar *progressBar
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.bar != nil {
+		return l.bar.writeAbove(l.w, p)
+	}
+	return l.w.Write(p)
+}
+
+// setBar makes logs keep clear of bar, or stops that for nil
+func (l *logWriter) setBar(bar *progressBar) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bar = bar
+}
+
+// newLogger returns a logger writing records of at least level to w in
+// format
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	minLevel, ok := logLevels[level]
+	if !ok {
+		return nil, fmt.Errorf("log level must be debug, info, warn or error, got: %s", level)
+	}
+	options := &slog.HandlerOptions{Level: minLevel}
+	switch format {
+	case logFormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("log format must be text or json, got: %s", format)
+}
+
+// outputLevel returns the log level of a run: errors only with --quiet,
+// debug records with --verbose unless a level is given, otherwise level
+func outputLevel(level string, quiet, verbose, levelChanged bool) (string, error) {
+	switch {
+	case quiet && verbose:
+		return "", fmt.Errorf("quiet cannot be combined with --verbose")
+	case quiet:
+		return "error", nil
+	case verbose && !levelChanged:
+		return "debug", nil
+	}
+	return level, nil
+}
+
+// setupLogging replaces logger according to --log-level, --log-format,
+// --quiet and --verbose as given to cmd
+func setupLogging(cmd *cobra.Command) error {
+	level, err := outputLevel(logLevel, quiet, verbose, cmd.Flags().Changed("log-level"))
+	if err != nil {
+		return err
+	}
+	l, err := newLogger(logOutput, level, logFormat)
+	if err != nil {
+		return err
+	}
+	logger = l
+	return nil
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    string
+		format   string
+		wantErr  string
+		expected []string
+	}{
+		{"Text at info", "info", "text", "", []string{"level=INFO", "level=WARN"}},
+		{"JSON at warn", "warn", "json", "", []string{`"level":"WARN"`}},
+		{"Debug", "debug", "text", "", []string{"level=DEBUG", "level=INFO", "level=WARN"}},
+		{"Unknown level", "verbose", "text", "log level must be debug, info, warn or error", nil},
+		{"Unknown format", "info", "logfmt", "log format must be text or json", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l, err := newLogger(&buf, test.level, test.format)
+			if test.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+					t.Fatalf("newLogger() error = %v, expected %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newLogger() error = %v", err)
+			}
+
+			l.Debug("debug message")
+			l.Info("info message", "file", "a.jpg")
+			l.Warn("warn message")
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != len(test.expected) {
+				t.Fatalf("logged %d lines, expected %d: %q", len(lines), len(test.expected), buf.String())
+			}
+			for i, want := range test.expected {
+				if !strings.Contains(lines[i], want) {
+					t.Errorf("line %d = %q, expected %s", i, lines[i], want)
+				}
+				if test.format == logFormatJSON && !json.Valid([]byte(lines[i])) {
+					t.Errorf("line %d = %q is not JSON", i, lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLogWriterAboveBar(t *testing.T) {
+	var barOut, logOut bytes.Buffer
+	bar := newProgressBar(&barOut, 2)
+	w := &logWriter{w: &logOut}
+
+	w.Write([]byte("before\n"))
+	w.setBar(bar)
+	w.Write([]byte("during\n"))
+	w.setBar(nil)
+	w.Write([]byte("after\n"))
+
+	if logOut.String() != "before\nduring\nafter\n" {
+		t.Errorf("logs = %q", logOut.String())
+	}
+	// Only the log written while the bar was shown clears and redraws it
+	if strings.Count(barOut.String(), "\r\x1b[K") != 1 || !strings.Contains(barOut.String(), "0/2") {
+		t.Errorf("bar output = %q, expected it cleared and redrawn once", barOut.String())
+	}
+}
+
+func TestOutputLevel(t *testing.T) {
+	tests := []struct {
+		name         string
+		level        string
+		quiet        bool
+		verbose      bool
+		levelChanged bool
+		expected     string
+		wantErr      bool
+	}{
+		{"Default", "info", false, false, false, "info", false},
+		{"Quiet", "info", true, false, false, "error", false},
+		{"Quiet over level", "debug", true, false, true, "error", false},
+		{"Verbose", "info", false, true, false, "debug", false},
+		{"Verbose with level", "warn", false, true, true, "warn", false},
+		{"Quiet and verbose", "info", true, true, false, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			level, err := outputLevel(test.level, test.quiet, test.verbose, test.levelChanged)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("outputLevel() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if level != test.expected {
+				t.Errorf("outputLevel() = %q, expected %q", level, test.expected)
+			}
+		})
+	}
+}
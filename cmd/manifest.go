@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// manifest holds per-file overrides; nil means batch defaults only
+var manifest map[string]manifestEntry
+
+// cropRect is a crop region in source pixels
+type cropRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// focusPoint is a focal point as fractions of the image width and height
+type focusPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// manifestDocument is a JSON manifest, see schema/manifest.v1.json
+type manifestDocument struct {
+	Version int             `json:"version"`
+	Files   []manifestEntry `json:"files"`
+}
+
+// manifestEntry overrides the batch settings for one input file. Zero
+// values keep the batch default.
+type manifestEntry struct {
+	File    string      `json:"file"`
+	Crop    *cropRect   `json:"crop,omitempty"`
+	Focus   *focusPoint `json:"focus,omitempty"`
+	Width   int         `json:"width,omitempty"`
+	Height  int         `json:"height,omitempty"`
+	Quality int         `json:"quality,omitempty"`
+	Name    string      `json:"name,omitempty"`
+}
+
+// validate checks the values of an entry
+func (e manifestEntry) validate() error {
+	if e.File == "" {
+		return fmt.Errorf("missing file")
+	}
+	if e.Width < 0 || e.Height < 0 {
+		return fmt.Errorf("%s: target size must not be negative", e.File)
+	}
+	if e.Quality != 0 && (e.Quality < 1 || e.Quality > 100) {
+		return fmt.Errorf("%s: quality must be between 1 and 100", e.File)
+	}
+	if e.Crop != nil && (e.Crop.Width <= 0 || e.Crop.Height <= 0 || e.Crop.X < 0 || e.Crop.Y < 0) {
+		return fmt.Errorf("%s: crop must have a positive size and offset", e.File)
+	}
+	if e.Focus != nil && (e.Focus.X < 0 || e.Focus.X > 1 || e.Focus.Y < 0 || e.Focus.Y > 1) {
+		return fmt.Errorf("%s: focus must be between 0 and 1", e.File)
+	}
+	if strings.ContainsAny(e.Name, `/\`) {
+		return fmt.Errorf("%s: output name must not contain a path", e.File)
+	}
+	return nil
+}
+
+// apply overrides config with the entry's settings
+func (e manifestEntry) apply(config processor.Config) processor.Config {
+	if e.Crop != nil {
+		config.Crop = image.Rect(e.Crop.X, e.Crop.Y, e.Crop.X+e.Crop.Width, e.Crop.Y+e.Crop.Height)
+	}
+	if e.Focus != nil {
+		config.Focus = &processor.FocalPoint{X: e.Focus.X, Y: e.Focus.Y}
+	}
+	if e.Width > 0 {
+		config.MaxWidth = e.Width
+	}
+	if e.Height > 0 {
+		config.MaxHeight = e.Height
+	}
+	if e.Quality > 0 {
+		config.Quality = e.Quality
+	}
+	if e.Name != "" {
+		config.OutputName = e.Name
+	}
+	return config
+}
+
+// loadManifest reads per-file overrides from a .json file or a .csv file
+// with a header naming the columns file, crop_x, crop_y, crop_width,
+// crop_height, focus_x, focus_y, width, height, quality and name.
+// Entries are keyed by their file path in slash form.
+func loadManifest(path string) (map[string]manifestEntry, error) {
+	entries, err := readManifestEntries(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]manifestEntry, len(entries))
+	for _, e := range entries {
+		if err := e.validate(); err != nil {
+			return nil, err
+		}
+		result[filepath.ToSlash(filepath.Clean(e.File))] = e
+	}
+	return result, nil
+}
+
+// readManifestEntries reads the entries of the manifest at path in the
+// order they are listed
+func readManifestEntries(path string) ([]manifestEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		return parseManifestJSON(data)
+	case ".csv":
+		return readManifestCSV(file)
+	}
+	return nil, fmt.Errorf("manifest must be a .json or .csv file")
+}
+
+// parseManifestJSON parses a versioned manifest document, or the bare
+// array of entries of earlier releases
+func parseManifestJSON(data []byte) ([]manifestEntry, error) {
+	version, err := documentVersion(data, "manifest", manifestSchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		var entries []manifestEntry
+		err := json.Unmarshal(data, &entries)
+		return entries, err
+	}
+	var doc manifestDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Files, nil
+}
+
+// readManifestCSV parses manifest entries from CSV with a header row
+func readManifestCSV(r io.Reader) ([]manifestEntry, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["file"]; !ok {
+		return nil, fmt.Errorf("manifest CSV needs a 'file' column")
+	}
+
+	var entries []manifestEntry
+	for line, row := range rows[1:] {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		number := func(name string) (int, error) {
+			value := field(name)
+			if value == "" {
+				return 0, nil
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return 0, fmt.Errorf("line %d: invalid %s: %s", line+2, name, value)
+			}
+			return n, nil
+		}
+
+		var values [7]int
+		for i, name := range []string{"crop_x", "crop_y", "crop_width", "crop_height", "width", "height", "quality"} {
+			if values[i], err = number(name); err != nil {
+				return nil, err
+			}
+		}
+
+		entry := manifestEntry{File: field("file"), Width: values[4], Height: values[5], Quality: values[6], Name: field("name")}
+		if values[2] != 0 || values[3] != 0 {
+			entry.Crop = &cropRect{X: values[0], Y: values[1], Width: values[2], Height: values[3]}
+		}
+		if fx, fy := field("focus_x"), field("focus_y"); fx != "" || fy != "" {
+			x, errX := strconv.ParseFloat(fx, 64)
+			y, errY := strconv.ParseFloat(fy, 64)
+			if errX != nil || errY != nil {
+				return nil, fmt.Errorf("line %d: invalid focus: %s,%s", line+2, fx, fy)
+			}
+			entry.Focus = &focusPoint{X: x, Y: y}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// lookupManifest finds the entry for path, matching its path relative to
+// root first and its base name second
+func lookupManifest(entries map[string]manifestEntry, root, path string) (manifestEntry, bool) {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		if e, ok := entries[filepath.ToSlash(rel)]; ok {
+			return e, true
+		}
+	}
+	e, ok := entries[filepath.Base(path)]
+	return e, ok
+}
+
+// manifestProcessor returns a processing function that applies the
+// manifest entry of each file
+func manifestProcessor(entries map[string]manifestEntry, root string, process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		if e, ok := lookupManifest(entries, root, path); ok {
+			config = e.apply(config)
+		}
+		return process(path, config)
+	}
+}
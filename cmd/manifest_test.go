@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestLoadManifest(t *testing.T) {
+	tempDir := t.TempDir()
+
+	csvPath := filepath.Join(tempDir, "manifest.csv")
+	csvContent := "file,crop_x,crop_y,crop_width,crop_height,focus_x,focus_y,width,height,quality,name\n" +
+		"album/IMG_0001.jpg,100,50,2000,1500,,,,,,cover\n" +
+		"IMG_0002.heic,,,,,0.3,0.25,800,600,95,\n"
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+
+	jsonPath := filepath.Join(tempDir, "manifest.json")
+	jsonContent := `[
+		{"file": "album/IMG_0001.jpg", "crop": {"x": 100, "y": 50, "width": 2000, "height": 1500}, "name": "cover"},
+		{"file": "IMG_0002.heic", "focus": {"x": 0.3, "y": 0.25}, "width": 800, "height": 600, "quality": 95}
+	]`
+	if err := os.WriteFile(jsonPath, []byte(jsonContent), 0644); err != nil {
+		t.Fatalf("Failed to create JSON: %v", err)
+	}
+
+	v1Path := filepath.Join(tempDir, "manifest.v1.json")
+	v1Content := `{"version": 1, "files": [
+		{"file": "album/IMG_0001.jpg", "crop": {"x": 100, "y": 50, "width": 2000, "height": 1500}, "name": "cover"},
+		{"file": "IMG_0002.heic", "focus": {"x": 0.3, "y": 0.25}, "width": 800, "height": 600, "quality": 95}
+	]}`
+	if err := os.WriteFile(v1Path, []byte(v1Content), 0644); err != nil {
+		t.Fatalf("Failed to create JSON: %v", err)
+	}
+
+	for _, path := range []string{csvPath, jsonPath, v1Path} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			entries, err := loadManifest(path)
+			if err != nil {
+				t.Fatalf("loadManifest() error = %v", err)
+			}
+			if len(entries) != 2 {
+				t.Fatalf("loadManifest() = %d entries, expected 2", len(entries))
+			}
+
+			cover := entries["album/IMG_0001.jpg"]
+			if cover.Crop == nil || *cover.Crop != (cropRect{100, 50, 2000, 1500}) || cover.Name != "cover" {
+				t.Errorf("album/IMG_0001.jpg entry = %+v", cover)
+			}
+			second := entries["IMG_0002.heic"]
+			if second.Crop != nil || second.Focus == nil || *second.Focus != (focusPoint{0.3, 0.25}) || second.Width != 800 || second.Height != 600 || second.Quality != 95 {
+				t.Errorf("IMG_0002.heic entry = %+v", second)
+			}
+		})
+	}
+}
+
+func TestLoadManifestInvalid(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"Unknown extension", "manifest.txt", "file\n"},
+		{"Missing file column", "manifest.csv", "name,width\nx,1\n"},
+		{"Bad number", "manifest.csv", "file,width\na.jpg,wide\n"},
+		{"Bad quality", "manifest.json", `[{"file": "a.jpg", "quality": 150}]`},
+		{"Bad crop", "manifest.json", `[{"file": "a.jpg", "crop": {"x": 0, "y": 0, "width": 0, "height": 10}}]`},
+		{"Name with path", "manifest.json", `[{"file": "a.jpg", "name": "../escape"}]`},
+		{"Focus outside image", "manifest.json", `[{"file": "a.jpg", "focus": {"x": 1.5, "y": 0.5}}]`},
+		{"Half a focus", "manifest.csv", "file,focus_x\na.jpg,0.5\n"},
+		{"No version", "manifest.json", `{"files": [{"file": "a.jpg"}]}`},
+		{"Newer version", "manifest.json", `{"version": 2, "files": [{"file": "a.jpg"}]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, test.file)
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatalf("Failed to create manifest: %v", err)
+			}
+			if _, err := loadManifest(path); err == nil {
+				t.Error("loadManifest() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestManifestProcessor(t *testing.T) {
+	entries := map[string]manifestEntry{
+		"album/IMG_0001.jpg": {File: "album/IMG_0001.jpg", Crop: &cropRect{10, 20, 30, 40}, Name: "cover"},
+		"IMG_0002.heic":      {File: "IMG_0002.heic", Width: 800, Quality: 95},
+	}
+
+	var seen processor.Config
+	process := manifestProcessor(entries, "/in", func(path string, config processor.Config) (processor.Result, error) {
+		seen = config
+		return processor.Result{}, nil
+	})
+	defaults := processor.Config{MaxWidth: 1920, MaxHeight: 1920, Quality: 90}
+
+	process("/in/album/IMG_0001.jpg", defaults)
+	if seen.Crop != image.Rect(10, 20, 40, 60) || seen.OutputName != "cover" || seen.MaxWidth != 1920 {
+		t.Errorf("config for album/IMG_0001.jpg = %+v", seen)
+	}
+
+	// Matched by base name from any directory
+	process("/in/other/IMG_0002.heic", defaults)
+	if seen.MaxWidth != 800 || seen.MaxHeight != 1920 || seen.Quality != 95 {
+		t.Errorf("config for other/IMG_0002.heic = %+v", seen)
+	}
+
+	process("/in/IMG_0003.jpg", defaults)
+	if !reflect.DeepEqual(seen, defaults) {
+		t.Errorf("config for unlisted file = %+v, expected defaults", seen)
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var migrateTo string
+
+var migrateConfigCmd = &cobra.Command{
+	Use:   "migrate-config <manifest>",
+	Short: "Upgrade a manifest to the current schema version",
+	Long: `Reads a manifest written for an earlier release (a JSON array of entries or a CSV
+file) or the current one, and writes it as a versioned JSON manifest following
+schema/manifest.v1.json, to standard output or the file given with --to.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runMigrateConfig(args[0], migrateTo, cmd.OutOrStdout()); err != nil {
+			logger.Error("Failed to migrate", "file", args[0], "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	migrateConfigCmd.Flags().StringVar(&migrateTo, "to", "", "File to write the migrated manifest to (default standard output)")
+	rootCmd.AddCommand(migrateConfigCmd)
+}
+
+// runMigrateConfig migrates the manifest at path into the file to, or out
+// when to is empty. The manifest is read completely first, so to may be path.
+func runMigrateConfig(path, to string, out io.Writer) error {
+	entries, err := readManifestEntries(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := e.validate(); err != nil {
+			return err
+		}
+	}
+	if entries == nil {
+		entries = []manifestEntry{}
+	}
+
+	data, err := json.MarshalIndent(manifestDocument{Version: manifestSchemaVersion, Files: entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if to == "" {
+		_, err := out.Write(data)
+		return err
+	}
+	return os.WriteFile(to, data, 0644)
+}
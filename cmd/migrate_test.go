@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunMigrateConfig(t *testing.T) {
+	tempDir := t.TempDir()
+
+	csvPath := filepath.Join(tempDir, "manifest.csv")
+	csvContent := "file,crop_x,crop_y,crop_width,crop_height,width,name\n" +
+		"album/IMG_0001.jpg,100,50,2000,1500,,cover\n" +
+		"IMG_0002.heic,,,,,800,\n"
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+	legacyPath := filepath.Join(tempDir, "manifest.json")
+	legacyContent := `[
+		{"file": "album/IMG_0001.jpg", "crop": {"x": 100, "y": 50, "width": 2000, "height": 1500}, "name": "cover"},
+		{"file": "IMG_0002.heic", "width": 800}
+	]`
+	if err := os.WriteFile(legacyPath, []byte(legacyContent), 0644); err != nil {
+		t.Fatalf("Failed to create JSON: %v", err)
+	}
+
+	want := manifestDocument{Version: manifestSchemaVersion, Files: []manifestEntry{
+		{File: "album/IMG_0001.jpg", Crop: &cropRect{100, 50, 2000, 1500}, Name: "cover"},
+		{File: "IMG_0002.heic", Width: 800},
+	}}
+
+	for _, path := range []string{csvPath, legacyPath} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			var out bytes.Buffer
+			if err := runMigrateConfig(path, "", &out); err != nil {
+				t.Fatalf("runMigrateConfig() error = %v", err)
+			}
+			var got manifestDocument
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("migrated manifest is not JSON: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("runMigrateConfig() = %+v, expected %+v", got, want)
+			}
+		})
+	}
+
+	// Migrating in place, after which the manifest migrates to itself
+	if err := runMigrateConfig(legacyPath, legacyPath, nil); err != nil {
+		t.Fatalf("runMigrateConfig() in place error = %v", err)
+	}
+	migrated, _ := os.ReadFile(legacyPath)
+	var out bytes.Buffer
+	if err := runMigrateConfig(legacyPath, "", &out); err != nil {
+		t.Fatalf("runMigrateConfig() of a migrated manifest error = %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), migrated) {
+		t.Errorf("migrating twice changed the manifest:\n%s\n%s", migrated, out.Bytes())
+	}
+	if entries, err := loadManifest(legacyPath); err != nil || len(entries) != 2 {
+		t.Errorf("loadManifest() of the migrated manifest = %v, %v", entries, err)
+	}
+}
+
+func TestRunMigrateConfigInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(path, []byte(`[{"file": "a.jpg", "quality": 150}]`), 0644); err != nil {
+		t.Fatalf("Failed to create JSON: %v", err)
+	}
+	if err := runMigrateConfig(path, path, nil); err == nil {
+		t.Error("runMigrateConfig() expected error, got nil")
+	}
+	if data, _ := os.ReadFile(path); string(data) != `[{"file": "a.jpg", "quality": 150}]` {
+		t.Error("runMigrateConfig() should leave an invalid manifest unchanged")
+	}
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"picture-resize-tools/pkg/pool"
+	"picture-resize-tools/pkg/processor"
+)
+
+// templateFields are the placeholders of --name-template
+var templateFields = []string{"name", "ext", "width", "height", "date", "counter", "parent"}
+
+// templateNumbers are the placeholders that can be zero-padded, as in
+// {counter:04}
+var templateNumbers = []string{"width", "height", "counter"}
+
+// maxTemplateWidth is the widest padding of a placeholder, enough for any
+// counter or size
+const maxTemplateWidth = 10
+
+// placeholderPattern matches a placeholder of --name-template with its
+// optional width
+var placeholderPattern = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+
+// templateName is the output name expanded from --name-template for a
+// file, or why it could not be expanded
+type templateName struct {
+	name string
+	err  error
+}
+
+// templateNames maps input paths to their names expanded from
+// --name-template; nil keeps the names
+var templateNames map[string]templateName
+
+// templateValues are the values of the placeholders for one file
+type templateValues struct {
+	name, ext, parent, date string
+	width, height, counter  int
+}
+
+// validateNameTemplate checks the placeholders of template and that it
+// names a file in the output directory
+func validateNameTemplate(template string) error {
+	if strings.ContainsAny(template, `/\`) {
+		return fmt.Errorf("name template must not contain path separators, got: %s", template)
+	}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+		if !slices.Contains(templateFields, m[1]) {
+			return fmt.Errorf("name template placeholder must be %s, got: %s", joinChoices(wrapFields(templateFields)), m[0])
+		}
+		if m[2] != "" && !slices.Contains(templateNumbers, m[1]) {
+			return fmt.Errorf("name template can only pad %s, got: %s", joinChoices(wrapFields(templateNumbers)), m[0])
+		}
+		if width, err := strconv.Atoi(m[2]); m[2] != "" && (err != nil || width < 1 || width > maxTemplateWidth) {
+			return fmt.Errorf("name template padding must be 1 to %d digits, got: %s", maxTemplateWidth, m[0])
+		}
+	}
+	if strings.ContainsAny(placeholderPattern.ReplaceAllString(template, ""), "{}") {
+		return fmt.Errorf("name template has an unclosed or malformed placeholder, got: %s", template)
+	}
+	if trimTemplateExtension(template) == "" {
+		return fmt.Errorf("name template must name the file, got: %s", template)
+	}
+	return nil
+}
+
+// wrapFields returns fields as placeholders, such as {name}
+func wrapFields(fields []string) []string {
+	wrapped := make([]string, len(fields))
+	for i, field := range fields {
+		wrapped[i] = "{" + field + "}"
+	}
+	return wrapped
+}
+
+// templateExtensions are the extensions trimTemplateExtension drops
+// besides those of the output formats
+var templateExtensions = []string{"jpeg", "tif", "jxl", "cbz", processor.MipmapDDS, processor.MipmapKTX2}
+
+// trimTemplateExtension drops an image extension written at the end of
+// template, such as .jpg, as outputs keep the extension of their format
+func trimTemplateExtension(template string) string {
+	ext := filepath.Ext(template)
+	format := strings.ToLower(strings.TrimPrefix(ext, "."))
+	if processor.IsSupportedOutputFormat(format) || slices.Contains(templateExtensions, format) {
+		return strings.TrimSuffix(template, ext)
+	}
+	return template
+}
+
+// usesField reports whether template has a placeholder for field
+func usesField(template, field string) bool {
+	for _, m := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+		if m[1] == field {
+			return true
+		}
+	}
+	return false
+}
+
+// expandNameTemplate returns template with its placeholders replaced by
+// values, numbers zero-padded to the width after the colon
+func expandNameTemplate(template string, values templateValues) string {
+	return placeholderPattern.ReplaceAllStringFunc(trimTemplateExtension(template), func(placeholder string) string {
+		m := placeholderPattern.FindStringSubmatch(placeholder)
+		width, _ := strconv.Atoi(m[2])
+		switch m[1] {
+		case "name":
+			return values.name
+		case "ext":
+			return values.ext
+		case "parent":
+			return values.parent
+		case "date":
+			return values.date
+		case "width":
+			return fmt.Sprintf("%0*d", width, values.width)
+		case "height":
+			return fmt.Sprintf("%0*d", width, values.height)
+		case "counter":
+			return fmt.Sprintf("%0*d", width, values.counter)
+		}
+		return placeholder
+	})
+}
+
+// planNameTemplate expands template for files. Files are counted from 1
+// in sorted order; {width} and {height} are the output size with config
+// and {date} the corrected capture date, or the modification date of
+// files without one. Files whose size cannot be read fail when processed.
+func planNameTemplate(files []string, template string, config processor.Config) map[string]templateName {
+	sorted := append([]string(nil), files...)
+	sort.Strings(sorted)
+
+	var sizes map[string]processor.Result
+	var sizeErrs map[string]error
+	if usesField(template, "width") || usesField(template, "height") {
+		sizes, sizeErrs = plannedSizes(sorted, config)
+	}
+	dates := make([]string, len(sorted))
+	if usesField(template, "date") {
+		dates, _ = pool.Map(context.Background(), &pool.Pool{Workers: workers}, sorted, func(_ context.Context, _ int, path string) (string, error) {
+			return templateDate(path), nil
+		})
+	}
+
+	names := make(map[string]templateName, len(sorted))
+	for i, path := range sorted {
+		if err := sizeErrs[path]; err != nil {
+			names[path] = templateName{err: err}
+			continue
+		}
+		ext := filepath.Ext(path)
+		names[path] = templateName{name: expandNameTemplate(template, templateValues{
+			name:    strings.TrimSuffix(filepath.Base(path), ext),
+			ext:     strings.ToLower(strings.TrimPrefix(ext, ".")),
+			parent:  filepath.Base(filepath.Dir(path)),
+			date:    dates[i],
+			width:   sizes[path].Width,
+			height:  sizes[path].Height,
+			counter: i + 1,
+		})}
+	}
+	return names
+}
+
+// plannedSizes returns the output size of each of files with config, with
+// the settings the wrappers of the run give each file, and the errors of
+// those whose size cannot be read
+func plannedSizes(files []string, config processor.Config) (map[string]processor.Result, map[string]error) {
+	plan := outputWrappers(func(path string, config processor.Config) (processor.Result, error) {
+		size, err := processor.OutputSize(path, config)
+		return processor.Result{InputPath: path, Width: size.X, Height: size.Y}, err
+	})
+	results, errs := pool.Map(context.Background(), &pool.Pool{Workers: workers}, files, func(_ context.Context, _ int, path string) (processor.Result, error) {
+		return plan(path, config)
+	})
+
+	sizes := make(map[string]processor.Result, len(files))
+	failed := make(map[string]error)
+	for i, path := range files {
+		if errs[i] != nil {
+			failed[path] = errs[i]
+			continue
+		}
+		sizes[path] = results[i]
+	}
+	return sizes, failed
+}
+
+// templateDate returns the day the image at path was taken, or else last
+// modified, as 2024-05-01
+func templateDate(path string) string {
+	if captured, err := captureTime(path); err == nil && !captured.IsZero() {
+		return captured.Format(time.DateOnly)
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime().Format(time.DateOnly)
+	}
+	return ""
+}
+
+// templateProcessor wraps process to name the output of each file as
+// planned by planNameTemplate
+func templateProcessor(names map[string]templateName, process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		if name, ok := names[path]; ok {
+			if name.err != nil {
+				return processor.Result{InputPath: path}, fmt.Errorf("name template: %v", name.err)
+			}
+			config.OutputName = name.name
+		}
+		return process(path, config)
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestValidateNameTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		errorMsg string
+	}{
+		{"holiday_{counter:04}_{width}x{height}.jpg", ""},
+		{"{date}_{parent}_{name}_{ext}", ""},
+		{"{name}/{counter}", "name template must not contain path separators"},
+		{"{name}_{camera}", "name template placeholder must be"},
+		{"{name:03}", "name template can only pad {width}, {height} or {counter}"},
+		{"{counter:010}", ""},
+		{"{counter:999999999}", "name template padding must be 1 to 10 digits"},
+		{"{counter:0}", "name template padding must be 1 to 10 digits"},
+		{"{name", "name template has an unclosed or malformed placeholder"},
+		{"{counter:x}", "name template has an unclosed or malformed placeholder"},
+		{".png", "name template must name the file"},
+	}
+	for _, test := range tests {
+		err := validateNameTemplate(test.template)
+		if test.errorMsg == "" {
+			if err != nil {
+				t.Errorf("validateNameTemplate(%q) error = %v, expected nil", test.template, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.errorMsg) {
+			t.Errorf("validateNameTemplate(%q) error = %v, expected %q", test.template, err, test.errorMsg)
+		}
+	}
+}
+
+func TestExpandNameTemplate(t *testing.T) {
+	values := templateValues{name: "IMG_01", ext: "heic", parent: "day1", date: "2024-05-01", width: 1920, height: 1080, counter: 7}
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"holiday_{counter:04}_{width}x{height}.jpg", "holiday_0007_1920x1080"},
+		{"{date}_{parent}_{name}.{ext}", "2024-05-01_day1_IMG_01.heic"},
+		{"{counter}", "7"},
+		{"{name}.JPEG", "IMG_01"},
+		{"{name}.v2", "IMG_01.v2"},
+	}
+	for _, test := range tests {
+		if got := expandNameTemplate(test.template, values); got != test.expected {
+			t.Errorf("expandNameTemplate(%q) = %q, expected %q", test.template, got, test.expected)
+		}
+	}
+}
+
+func TestPlanNameTemplate(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.png", "a.png"} {
+		if err := imaging.Save(image.NewNRGBA(image.Rect(0, 0, 400, 200)), filepath.Join(dir, name)); err != nil {
+			t.Fatalf("Failed to save test image: %v", err)
+		}
+	}
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	if err := os.Chtimes(filepath.Join(dir, "a.png"), modified, modified); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	comic := filepath.Join(dir, "c.cbz")
+	if err := os.WriteFile(comic, nil, 0644); err != nil {
+		t.Fatalf("Failed to write comic: %v", err)
+	}
+
+	config := processor.Config{MaxWidth: 100, MaxHeight: 100}
+	names := planNameTemplate([]string{filepath.Join(dir, "b.png"), comic, filepath.Join(dir, "a.png")}, "{counter:02}_{width}x{height}_{date}", config)
+	// Counted in sorted order, at the size the output is resized to
+	if name := names[filepath.Join(dir, "a.png")]; name.err != nil || name.name != "01_100x50_2024-05-01" {
+		t.Errorf("name of a.png = %+v, expected 01_100x50_2024-05-01", name)
+	}
+	if name := names[filepath.Join(dir, "b.png")]; name.err != nil || !strings.HasPrefix(name.name, "02_100x50_") {
+		t.Errorf("name of b.png = %+v, expected 02_100x50_...", name)
+	}
+	// Comic pages are only sized once unpacked
+	if name := names[comic]; name.err == nil {
+		t.Errorf("name of c.cbz = %+v, expected an error", name)
+	}
+}
+
+func TestTemplateProcessor(t *testing.T) {
+	var names []string
+	process := templateProcessor(map[string]templateName{
+		"a.jpg": {name: "holiday_0001"},
+		"b.pdf": {err: errors.New("no size")},
+	}, func(path string, config processor.Config) (processor.Result, error) {
+		names = append(names, config.OutputName)
+		return processor.Result{InputPath: path}, nil
+	})
+	if _, err := process("a.jpg", processor.Config{}); err != nil {
+		t.Fatalf("process(a.jpg) error = %v", err)
+	}
+	if _, err := process("b.pdf", processor.Config{}); err == nil {
+		t.Error("process(b.pdf) error = nil, expected the planning error")
+	}
+	if len(names) != 1 || names[0] != "holiday_0001" {
+		t.Errorf("output names = %q, expected holiday_0001 only", names)
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// parseChmod parses an octal permission mode such as 0644
+func parseChmod(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode: %s", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// parseChown parses user:group, user or :group into an owner. Names are
+// looked up on this system and numeric IDs are used as they are.
+func parseChown(s string) (*processor.Owner, error) {
+	name, group, hasGroup := strings.Cut(s, ":")
+	if name == "" && group == "" {
+		return nil, fmt.Errorf("invalid owner: %s", s)
+	}
+
+	owner := &processor.Owner{UID: -1, GID: -1}
+	if name != "" {
+		uid, err := lookupID(name, func(n string) (string, error) {
+			u, err := user.Lookup(n)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unknown user: %s", name)
+		}
+		owner.UID = uid
+	}
+	if hasGroup && group != "" {
+		gid, err := lookupID(group, func(n string) (string, error) {
+			g, err := user.LookupGroup(n)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unknown group: %s", group)
+		}
+		owner.GID = gid
+	}
+	return owner, nil
+}
+
+// lookupID returns the numeric ID for name, resolving non-numeric names
+// with lookup
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestParseChmod(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    os.FileMode
+		expectError bool
+	}{
+		{"0644", 0644, false},
+		{"664", 0664, false},
+		{"0755", 0755, false},
+		{"0", 0, true},
+		{"0888", 0, true},
+		{"1777", 0, true},
+		{"rw-r--r--", 0, true},
+	}
+
+	for _, test := range tests {
+		mode, err := parseChmod(test.input)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("parseChmod(%q) expected error, got %v", test.input, mode)
+			}
+			continue
+		}
+		if err != nil || mode != test.expected {
+			t.Errorf("parseChmod(%q) = %v, %v, expected %v", test.input, mode, err, test.expected)
+		}
+	}
+}
+
+func TestParseChown(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    processor.Owner
+		expectError bool
+	}{
+		{"1000:100", processor.Owner{UID: 1000, GID: 100}, false},
+		{"1000", processor.Owner{UID: 1000, GID: -1}, false},
+		{":100", processor.Owner{UID: -1, GID: 100}, false},
+		{"0:0", processor.Owner{UID: 0, GID: 0}, false},
+		{":", processor.Owner{}, true},
+		{"", processor.Owner{}, true},
+		{"no-such-user-here:100", processor.Owner{}, true},
+		{"1000:no-such-group-here", processor.Owner{}, true},
+	}
+
+	for _, test := range tests {
+		owner, err := parseChown(test.input)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("parseChown(%q) expected error, got %+v", test.input, owner)
+			}
+			continue
+		}
+		if err != nil || *owner != test.expected {
+			t.Errorf("parseChown(%q) = %+v, %v, expected %+v", test.input, owner, err, test.expected)
+		}
+	}
+}
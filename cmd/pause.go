@@ -0,0 +1,72 @@
+package cmd
+
+import "sync"
+
+// gate holds back the scheduling of new files while the run is paused
+var gate = newPauseGate()
+
+// pauseGate blocks workers from starting new files while paused. Files
+// that are already being processed are not affected.
+type pauseGate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+}
+
+func newPauseGate() *pauseGate {
+	g := &pauseGate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// pause stops new files from being started. It returns false if the gate
+// was already paused.
+func (g *pauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return false
+	}
+	g.paused = true
+	return true
+}
+
+// resume lets waiting workers continue. It returns false if the gate was
+// not paused.
+func (g *pauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return false
+	}
+	g.paused = false
+	g.cond.Broadcast()
+	return true
+}
+
+// isPaused reports whether the gate is paused
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// wait blocks while the gate is paused
+func (g *pauseGate) wait() {
+	g.mu.Lock()
+	for g.paused {
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+}
+
+// handlePauseSignal pauses or resumes the run in response to a signal
+func handlePauseSignal(pause bool) {
+	if pause {
+		if gate.pause() {
+			logger.Info("Paused: in-flight files will finish, no new files are started")
+		}
+	} else if gate.resume() {
+		logger.Info("Resumed")
+	}
+}
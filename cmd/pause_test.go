@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPauseGate(t *testing.T) {
+	g := newPauseGate()
+
+	// An open gate does not block
+	g.wait()
+
+	if !g.pause() || g.pause() {
+		t.Error("pause() should report only the first transition")
+	}
+	if !g.isPaused() {
+		t.Error("isPaused() = false after pause()")
+	}
+
+	var passed atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		g.wait()
+		passed.Store(true)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if passed.Load() {
+		t.Fatal("wait() returned while paused")
+	}
+
+	if !g.resume() || g.resume() {
+		t.Error("resume() should report only the first transition")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wait() did not return after resume()")
+	}
+}
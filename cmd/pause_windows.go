@@ -0,0 +1,8 @@
+//go:build windows
+
+package cmd
+
+// watchPauseSignals is a no-op on Windows, which has no user signals
+func watchPauseSignals() func() {
+	return func() {}
+}
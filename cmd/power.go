@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// powerInterval is how often the power and thermal state is checked
+var powerInterval = 30 * time.Second
+
+// powerState describes how the machine is powered and how hot it runs
+type powerState struct {
+	onBattery bool
+	// temperature is the hottest sensor in degrees Celsius, 0 if unknown
+	temperature float64
+	// throttled reports thermal throttling signalled by the OS
+	throttled bool
+}
+
+// powerPolicy decides how many workers may run in a given power state
+type powerPolicy struct {
+	batteryWorkers int
+	pauseOnBattery bool
+	maxTemperature float64
+}
+
+// enabled reports whether any power-aware option is set
+func (p powerPolicy) enabled() bool {
+	return p.batteryWorkers > 0 || p.pauseOnBattery || p.maxTemperature > 0
+}
+
+// decide returns the worker ceiling and whether scheduling should pause
+func (p powerPolicy) decide(state powerState, max int) (int, bool) {
+	ceiling := max
+	if state.onBattery {
+		if p.pauseOnBattery {
+			return ceiling, true
+		}
+		if p.batteryWorkers > 0 && p.batteryWorkers < ceiling {
+			ceiling = p.batteryWorkers
+		}
+	}
+	if p.maxTemperature > 0 && (state.throttled || state.temperature > p.maxTemperature) {
+		ceiling = 1
+	}
+	return ceiling, false
+}
+
+// readPowerState returns the current power state of this machine
+func readPowerState() (powerState, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return readLinuxPowerState("/sys/class")
+	case "darwin":
+		batt, err := exec.Command("pmset", "-g", "batt").Output()
+		if err != nil {
+			return powerState{}, err
+		}
+		therm, _ := exec.Command("pmset", "-g", "therm").Output()
+		return parsePmset(string(batt), string(therm)), nil
+	}
+	return powerState{}, fmt.Errorf("power state is not available on %s", runtime.GOOS)
+}
+
+// readLinuxPowerState reads power supplies and thermal zones from sysfs
+func readLinuxPowerState(root string) (powerState, error) {
+	var state powerState
+
+	supplies, _ := filepath.Glob(filepath.Join(root, "power_supply", "*"))
+	if len(supplies) == 0 {
+		return state, fmt.Errorf("no power supplies found")
+	}
+
+	hasMains, mainsOnline, discharging := false, false, false
+	for _, supply := range supplies {
+		switch readSysfs(filepath.Join(supply, "type")) {
+		case "Mains":
+			hasMains = true
+			mainsOnline = mainsOnline || readSysfs(filepath.Join(supply, "online")) == "1"
+		case "Battery":
+			discharging = discharging || readSysfs(filepath.Join(supply, "status")) == "Discharging"
+		}
+	}
+	state.onBattery = discharging || (hasMains && !mainsOnline)
+
+	zones, _ := filepath.Glob(filepath.Join(root, "thermal", "thermal_zone*", "temp"))
+	for _, zone := range zones {
+		milli, err := strconv.ParseFloat(readSysfs(zone), 64)
+		if err == nil && milli/1000 > state.temperature {
+			state.temperature = milli / 1000
+		}
+	}
+	return state, nil
+}
+
+// readSysfs returns the trimmed content of a sysfs attribute
+func readSysfs(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+var cpuSpeedLimit = regexp.MustCompile(`CPU_Speed_Limit\s*=\s*(\d+)`)
+
+// parsePmset interprets the output of "pmset -g batt" and "pmset -g therm"
+func parsePmset(batt, therm string) powerState {
+	state := powerState{onBattery: strings.Contains(batt, "'Battery Power'")}
+	if m := cpuSpeedLimit.FindStringSubmatch(therm); m != nil {
+		limit, _ := strconv.Atoi(m[1])
+		state.throttled = limit < 100
+	}
+	return state
+}
+
+// watchPower applies policy to the limiter and pause gate until the
+// returned stop function is called
+func watchPower(policy powerPolicy, limiter *workerLimiter, interval time.Duration) func() {
+	if _, err := readPowerState(); err != nil {
+		logger.Warn("Power-aware throttling unavailable", "error", err)
+		return func() {}
+	}
+
+	pausedByPower := false
+	apply := func() {
+		state, err := readPowerState()
+		if err != nil {
+			return
+		}
+		ceiling, pause := policy.decide(state, limiter.max)
+		limiter.setCeiling(ceiling)
+		if pause && !pausedByPower {
+			if gate.pause() {
+				pausedByPower = true
+				logger.Info("Running on battery, paused until power is connected")
+			}
+		} else if !pause && pausedByPower {
+			pausedByPower = false
+			if gate.resume() {
+				logger.Info("Power connected, resumed")
+			}
+		}
+	}
+	apply()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				apply()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		if pausedByPower {
+			gate.resume()
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPowerPolicyDecide(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        powerPolicy
+		state         powerState
+		expected      int
+		expectedPause bool
+	}{
+		{"On mains", powerPolicy{batteryWorkers: 2}, powerState{}, 8, false},
+		{"Battery workers", powerPolicy{batteryWorkers: 2}, powerState{onBattery: true}, 2, false},
+		{"Pause on battery", powerPolicy{pauseOnBattery: true}, powerState{onBattery: true}, 8, true},
+		{"Too hot", powerPolicy{maxTemperature: 85}, powerState{temperature: 92}, 1, false},
+		{"Throttled", powerPolicy{maxTemperature: 85}, powerState{throttled: true}, 1, false},
+		{"Warm but fine", powerPolicy{maxTemperature: 85}, powerState{temperature: 70}, 8, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ceiling, pause := test.policy.decide(test.state, 8)
+			if ceiling != test.expected || pause != test.expectedPause {
+				t.Errorf("decide() = %d, %t, expected %d, %t", ceiling, pause, test.expected, test.expectedPause)
+			}
+		})
+	}
+}
+
+func TestReadLinuxPowerState(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"power_supply/AC/type":                  "Mains\n",
+		"power_supply/AC/online":                "0\n",
+		"power_supply/BAT0/type":                "Battery\n",
+		"power_supply/BAT0/status":              "Discharging\n",
+		"thermal/thermal_zone0/temp":            "45000\n",
+		"thermal/thermal_zone1/temp":            "88500\n",
+		"thermal/thermal_zone2/not-a-zone-temp": "99000\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	state, err := readLinuxPowerState(root)
+	if err != nil {
+		t.Fatalf("readLinuxPowerState() error = %v", err)
+	}
+	if !state.onBattery {
+		t.Error("readLinuxPowerState() onBattery = false, expected true")
+	}
+	if state.temperature != 88.5 {
+		t.Errorf("readLinuxPowerState() temperature = %g, expected 88.5", state.temperature)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "power_supply/AC/online"), []byte("1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write online: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "power_supply/BAT0/status"), []byte("Charging\n"), 0644); err != nil {
+		t.Fatalf("Failed to write status: %v", err)
+	}
+	if state, _ := readLinuxPowerState(root); state.onBattery {
+		t.Error("readLinuxPowerState() onBattery = true on mains, expected false")
+	}
+
+	if _, err := readLinuxPowerState(filepath.Join(root, "missing")); err == nil {
+		t.Error("readLinuxPowerState() without power supplies expected error, got nil")
+	}
+}
+
+func TestParsePmset(t *testing.T) {
+	batt := "Now drawing from 'Battery Power'\n -InternalBattery-0 (id=1234)	85%; discharging; 4:12 remaining present: true\n"
+	therm := "Note: No thermal warning level has been recorded\nCPU_Scheduler_Limit 	= 100\nCPU_Available_CPUs 	= 8\nCPU_Speed_Limit 	= 70\n"
+
+	state := parsePmset(batt, therm)
+	if !state.onBattery || !state.throttled {
+		t.Errorf("parsePmset() = %+v, expected on battery and throttled", state)
+	}
+
+	state = parsePmset("Now drawing from 'AC Power'\n", "CPU_Speed_Limit = 100\n")
+	if state.onBattery || state.throttled {
+		t.Errorf("parsePmset() = %+v, expected on AC and not throttled", state)
+	}
+}
@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// minSearchQuality is the lowest quality tried when fitting outputs into a size limit
+const minSearchQuality = 30
+
+// preset is a named bundle of processing settings
+type preset struct {
+	description string
+	maxWidth    int
+	maxHeight   int
+	quality     int
+	format      string
+	// convert forces conversion to format even when no HEIC files are present
+	convert bool
+	// fill crops to the aspect ratio of the size and upscale enlarges
+	// smaller images, so that outputs are exactly that size
+	fill    bool
+	upscale bool
+	// autoOrient bakes the EXIF orientation into the pixels, toSRGB
+	// converts embedded color profiles
+	autoOrient bool
+	toSRGB     bool
+	// names sanitizes output names like --safe-names
+	names string
+	// grayscale, dither and contrast prepare outputs for e-ink screens
+	grayscale bool
+	dither    string
+	contrast  float64
+	// document turns photos of paper into scans like --document,
+	// splitSpreads splits two-page spreads like --split-spreads and deskew
+	// straightens skewed scans like --deskew
+	document     string
+	splitSpreads bool
+	deskew       bool
+}
+
+// presets lists the built-in presets by name
+var presets = map[string]preset{
+	"email": {
+		description: "1600px JPEGs suitable for mail attachments",
+		maxWidth:    1600,
+		maxHeight:   1600,
+		quality:     80,
+		format:      "jpg",
+		convert:     true,
+	},
+	"frame": {
+		description: "Exact 1920x1080 upright sRGB JPEGs with ASCII names for photo frames and TVs",
+		maxWidth:    1920,
+		maxHeight:   1080,
+		quality:     85,
+		format:      "jpg",
+		convert:     true,
+		fill:        true,
+		upscale:     true,
+		autoOrient:  true,
+		toSRGB:      true,
+		names:       safeNamesASCII,
+	},
+	"eink": {
+		description: "1072x1448 upright grayscale PNGs dithered to 16 shades for e-readers",
+		maxWidth:    1072,
+		maxHeight:   1448,
+		quality:     90,
+		format:      "png",
+		convert:     true,
+		upscale:     true,
+		autoOrient:  true,
+		toSRGB:      true,
+		grayscale:   true,
+		dither:      processor.DitherFloydSteinberg,
+		contrast:    15,
+	},
+	"document": {
+		description:  "A4 pages at 300 DPI from photos and scans of paper, straightened and deskewed, in gray and split from two-page spreads",
+		maxWidth:     2480,
+		maxHeight:    3508,
+		quality:      85,
+		format:       "jpg",
+		convert:      true,
+		autoOrient:   true,
+		document:     processor.DocumentGray,
+		splitSpreads: true,
+		deskew:       true,
+	},
+}
+
+// presetNames returns the names of the built-in presets in sorted order
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPreset overrides the processing settings with the named preset.
+// Flags given explicitly on the command line take precedence.
+func applyPreset(name string) {
+	p, ok := presets[name]
+	if !ok {
+		return
+	}
+
+	flags := rootCmd.PersistentFlags()
+	if !flags.Changed("width") {
+		maxWidth = p.maxWidth
+	}
+	if !flags.Changed("height") {
+		maxHeight = p.maxHeight
+	}
+	if !flags.Changed("quality") {
+		quality = p.quality
+	}
+	if !flags.Changed("format") {
+		outputFormat = p.format
+	}
+	if p.fill && !flags.Changed("mode") {
+		resizeMode = "fill"
+	}
+	if p.names != "" && !flags.Changed("safe-names") {
+		safeNames = p.names
+	}
+	if p.dither != "" && !flags.Changed("dither") {
+		ditherMethod = p.dither
+	}
+	if p.contrast != 0 && !flags.Changed("contrast") {
+		contrast = p.contrast
+	}
+	if p.document != "" && !flags.Changed("document") {
+		document = p.document
+	}
+	if p.splitSpreads && !flags.Changed("split-spreads") {
+		splitSpreads = true
+	}
+	if p.deskew && !flags.Changed("deskew") {
+		deskew = true
+	}
+	forceConvert = forceConvert || p.convert
+}
+
+// applyOptions sets the processing options of the preset that have no
+// flag in config
+func (p preset) applyOptions(config processor.Config) processor.Config {
+	config.Upscale = config.Upscale || p.upscale
+	config.AutoOrient = config.AutoOrient || p.autoOrient
+	config.ToSRGB = config.ToSRGB || p.toSRGB
+	config.Grayscale = config.Grayscale || p.grayscale
+	return config
+}
+
+// applyConfig overrides the settings of one file's config with the preset,
+// like applyPreset
+func (p preset) applyConfig(config processor.Config) processor.Config {
+	flags := rootCmd.PersistentFlags()
+	if !flags.Changed("width") {
+		config.MaxWidth = p.maxWidth
+	}
+	if !flags.Changed("height") {
+		config.MaxHeight = p.maxHeight
+	}
+	if !flags.Changed("quality") {
+		config.Quality = p.quality
+	}
+	if !flags.Changed("format") {
+		config.OutputFormat = p.format
+	}
+	if p.fill && !flags.Changed("mode") {
+		config.Fill = true
+	}
+	if p.dither != "" && !flags.Changed("dither") {
+		config.Dither = p.dither
+	}
+	if p.contrast != 0 && !flags.Changed("contrast") {
+		config.Contrast = p.contrast
+	}
+	if p.document != "" && !flags.Changed("document") {
+		config.Document = p.document
+	}
+	if p.splitSpreads && !flags.Changed("split-spreads") {
+		config.SplitSpreads = true
+	}
+	if p.deskew && !flags.Changed("deskew") {
+		config.Deskew = true
+	}
+	if p.convert {
+		config.KeepFormat = false
+	}
+	return p.applyOptions(config)
+}
+
+// validatePreset checks that name refers to a built-in preset
+func validatePreset(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := presets[name]; !ok {
+		return fmt.Errorf("unknown preset %s, available: %s", name, strings.Join(presetNames(), ", "))
+	}
+	return nil
+}
+
+// totalOutputSize sums the output sizes of successful results
+func totalOutputSize(results []fileResult) int64 {
+	var total int64
+	for _, r := range results {
+		if r.err == nil {
+			total += r.OutputSize
+		}
+	}
+	return total
+}
+
+// fitToLimit searches for the highest quality below startQuality at which
+// the total output size stays within limit. run processes the whole batch
+// at the given quality, and drained reports whether the run was drained
+// meanwhile. It returns the results describing the outputs on disk, their
+// quality, and whether they meet the limit.
+//
+// A drained pass ends the search. The files it skipped keep the outputs
+// of the last complete pass, and the results are those of that pass with
+// the files the drained pass processed replaced.
+func fitToLimit(results []fileResult, startQuality int, limit int64, run func(quality int) []fileResult, drained func() bool) ([]fileResult, int, bool) {
+	if totalOutputSize(results) <= limit {
+		return results, startQuality, true
+	}
+
+	best, bestResults := -1, []fileResult(nil)
+	current, currentQuality := results, startQuality
+	lo, hi := minSearchQuality, startQuality-1
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		probe := run(mid)
+		if drained() {
+			merged := mergeResults(current, probe)
+			return merged, currentQuality, totalOutputSize(merged) <= limit
+		}
+		current, currentQuality = probe, mid
+		if totalOutputSize(probe) <= limit {
+			best, bestResults = mid, probe
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	// The outputs on disk are those of the last pass
+	if best < 0 {
+		return current, currentQuality, false
+	}
+	if currentQuality != best {
+		probe := run(best)
+		if drained() {
+			merged := mergeResults(current, probe)
+			return merged, currentQuality, totalOutputSize(merged) <= limit
+		}
+		bestResults = probe
+	}
+	return bestResults, best, true
+}
+
+// mergeResults returns results with the result of each file in newer
+// replacing its own
+func mergeResults(results, newer []fileResult) []fileResult {
+	byPath := make(map[string]fileResult, len(newer))
+	for _, r := range newer {
+		byPath[r.path] = r
+	}
+	merged := make([]fileResult, len(results))
+	for i, r := range results {
+		if n, ok := byPath[r.path]; ok {
+			r = n
+		}
+		merged[i] = r
+	}
+	return merged
+}
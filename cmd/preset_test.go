@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestValidatePreset(t *testing.T) {
+	if err := validatePreset(""); err != nil {
+		t.Errorf("validatePreset(\"\") error = %v", err)
+	}
+	if err := validatePreset("email"); err != nil {
+		t.Errorf("validatePreset(email) error = %v", err)
+	}
+	if err := validatePreset("nope"); err == nil {
+		t.Error("validatePreset(nope) expected error, got nil")
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	oldWidth, oldHeight, oldQuality, oldFormat, oldConvert := maxWidth, maxHeight, quality, outputFormat, forceConvert
+	defer func() {
+		maxWidth, maxHeight, quality, outputFormat, forceConvert = oldWidth, oldHeight, oldQuality, oldFormat, oldConvert
+		rootCmd.PersistentFlags().Lookup("quality").Changed = false
+	}()
+
+	// An explicitly set flag wins over the preset
+	if err := rootCmd.PersistentFlags().Set("quality", "95"); err != nil {
+		t.Fatalf("Failed to set quality flag: %v", err)
+	}
+	maxWidth, maxHeight, forceConvert = 4000, 4000, false
+
+	applyPreset("email")
+
+	if maxWidth != 1600 || maxHeight != 1600 {
+		t.Errorf("applyPreset(email) size = %dx%d, expected 1600x1600", maxWidth, maxHeight)
+	}
+	if quality != 95 {
+		t.Errorf("applyPreset(email) quality = %d, expected explicit 95", quality)
+	}
+	if !forceConvert {
+		t.Error("applyPreset(email) should force format conversion")
+	}
+}
+
+func TestApplyFramePreset(t *testing.T) {
+	oldWidth, oldHeight, oldQuality, oldFormat, oldConvert, oldMode, oldNames := maxWidth, maxHeight, quality, outputFormat, forceConvert, resizeMode, safeNames
+	defer func() {
+		maxWidth, maxHeight, quality, outputFormat, forceConvert, resizeMode, safeNames = oldWidth, oldHeight, oldQuality, oldFormat, oldConvert, oldMode, oldNames
+	}()
+	resizeMode, safeNames = "fit", ""
+
+	applyPreset("frame")
+
+	if maxWidth != 1920 || maxHeight != 1080 || resizeMode != "fill" || safeNames != safeNamesASCII {
+		t.Errorf("applyPreset(frame) = %dx%d mode %s names %q, expected 1920x1080 fill ascii", maxWidth, maxHeight, resizeMode, safeNames)
+	}
+
+	config := presets["frame"].applyConfig(processor.Config{KeepFormat: true})
+	if !config.Fill || !config.Upscale || !config.AutoOrient || !config.ToSRGB || config.KeepFormat {
+		t.Errorf("frame preset config = %+v, expected fill, upscale, auto-orient and sRGB", config)
+	}
+	if config := presets["email"].applyOptions(processor.Config{}); config.Upscale || config.AutoOrient || config.ToSRGB {
+		t.Errorf("email preset options = %+v, expected none", config)
+	}
+}
+
+func TestApplyEinkPreset(t *testing.T) {
+	oldWidth, oldHeight, oldQuality, oldFormat, oldConvert, oldDither, oldContrast := maxWidth, maxHeight, quality, outputFormat, forceConvert, ditherMethod, contrast
+	defer func() {
+		maxWidth, maxHeight, quality, outputFormat, forceConvert, ditherMethod, contrast = oldWidth, oldHeight, oldQuality, oldFormat, oldConvert, oldDither, oldContrast
+	}()
+	ditherMethod, contrast = "", 0
+
+	applyPreset("eink")
+
+	if maxWidth != 1072 || maxHeight != 1448 || outputFormat != "png" || ditherMethod != processor.DitherFloydSteinberg || contrast != 15 {
+		t.Errorf("applyPreset(eink) = %dx%d %s dither %q contrast %g, expected 1072x1448 png floyd-steinberg 15", maxWidth, maxHeight, outputFormat, ditherMethod, contrast)
+	}
+
+	// Camera presets set the same options per file, fitting the whole page
+	config := presets["eink"].applyConfig(processor.Config{})
+	if !config.Grayscale || config.Dither != processor.DitherFloydSteinberg || config.Contrast != 15 || !config.Upscale || config.Fill {
+		t.Errorf("eink preset config = %+v, expected grayscale, dithered and enlarged to fit", config)
+	}
+}
+
+func TestApplyDocumentPreset(t *testing.T) {
+	oldWidth, oldHeight, oldQuality, oldFormat, oldConvert, oldDocument, oldSplit, oldDeskew := maxWidth, maxHeight, quality, outputFormat, forceConvert, document, splitSpreads, deskew
+	defer func() {
+		maxWidth, maxHeight, quality, outputFormat, forceConvert, document, splitSpreads, deskew = oldWidth, oldHeight, oldQuality, oldFormat, oldConvert, oldDocument, oldSplit, oldDeskew
+	}()
+	document, splitSpreads, deskew = "", false, false
+
+	applyPreset("document")
+
+	if maxWidth != 2480 || maxHeight != 3508 || document != processor.DocumentGray || !splitSpreads || !deskew {
+		t.Errorf("applyPreset(document) = %dx%d document %q split %v deskew %v, expected 2480x3508 gray split deskewed", maxWidth, maxHeight, document, splitSpreads, deskew)
+	}
+
+	config := presets["document"].applyConfig(processor.Config{})
+	if config.Document != processor.DocumentGray || !config.SplitSpreads || !config.Deskew || !config.AutoOrient {
+		t.Errorf("document preset config = %+v, expected deskewed gray documents split from spreads", config)
+	}
+}
+
+func TestFitToLimit(t *testing.T) {
+	// Output size grows linearly with quality
+	run := func(quality int) []fileResult {
+		return []fileResult{
+			{Result: processor.Result{OutputSize: int64(quality) * 10}},
+			{Result: processor.Result{OutputSize: int64(quality) * 10}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		limit    int64
+		expected int
+		ok       bool
+	}{
+		{"Already fits", 10000, 90, true},
+		{"Needs lower quality", 1500, 75, true},
+		{"Cannot fit", 100, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lastRun int
+			results, chosen, ok := fitToLimit(run(90), 90, test.limit, func(q int) []fileResult {
+				lastRun = q
+				return run(q)
+			}, func() bool { return false })
+
+			if ok != test.ok {
+				t.Fatalf("fitToLimit() ok = %t, expected %t", ok, test.ok)
+			}
+			if !ok {
+				// The results describe the outputs of the last pass
+				if chosen != lastRun || totalOutputSize(results) != totalOutputSize(run(lastRun)) {
+					t.Errorf("fitToLimit() = quality %d total %d, expected the last pass at quality %d", chosen, totalOutputSize(results), lastRun)
+				}
+				return
+			}
+			if chosen != test.expected {
+				t.Errorf("fitToLimit() quality = %d, expected %d", chosen, test.expected)
+			}
+			if totalOutputSize(results) > test.limit {
+				t.Errorf("fitToLimit() total = %d, exceeds limit %d", totalOutputSize(results), test.limit)
+			}
+			if lastRun != 0 && lastRun != chosen {
+				t.Errorf("fitToLimit() last encoded at quality %d, expected %d", lastRun, chosen)
+			}
+		})
+	}
+}
+
+func TestFitToLimitDrained(t *testing.T) {
+	run := func(quality int) []fileResult {
+		return []fileResult{
+			{Result: processor.Result{OutputSize: int64(quality) * 10}, path: "a.jpg"},
+			{Result: processor.Result{OutputSize: int64(quality) * 10}, path: "b.jpg"},
+		}
+	}
+
+	// The first retry is drained after a.jpg, b.jpg keeps its output of the
+	// complete pass at quality 90
+	drained := false
+	results, chosen, ok := fitToLimit(run(90), 90, 1500, func(q int) []fileResult {
+		drained = true
+		return run(q)[:1]
+	}, func() bool { return drained })
+
+	if len(results) != 2 || results[1].OutputSize != 900 || results[0].OutputSize >= 900 {
+		t.Fatalf("fitToLimit() results = %+v, expected a.jpg retried and b.jpg at quality 90", results)
+	}
+	if chosen != 90 || ok != (totalOutputSize(results) <= 1500) {
+		t.Errorf("fitToLimit() = quality %d ok %t, expected 90 and whether %d fits", chosen, ok, totalOutputSize(results))
+	}
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// Terminal graphics protocols
+const (
+	protocolAuto   = "auto"
+	protocolKitty  = "kitty"
+	protocolITerm2 = "iterm2"
+	protocolSixel  = "sixel"
+)
+
+var (
+	previewProtocol string
+	previewSize     int
+)
+
+var previewCmd = &cobra.Command{
+	Use:   "preview [files...]",
+	Short: "Show image thumbnails inline in the terminal",
+	Long: `Renders thumbnails of the given files, or of the images in the input directory,
+using the kitty, iTerm2 or sixel graphics protocol`,
+	Run: func(cmd *cobra.Command, args []string) { runPreview(args) },
+}
+
+func init() {
+	previewCmd.Flags().StringVar(&previewProtocol, "protocol", protocolAuto, "Graphics protocol (auto, kitty, iterm2, sixel)")
+	previewCmd.Flags().IntVar(&previewSize, "size", 256, "Maximum thumbnail size in pixels")
+	rootCmd.AddCommand(previewCmd)
+}
+
+func runPreview(files []string) {
+	if previewSize <= 0 {
+		logger.Error("Thumbnail size must be positive", "size", previewSize)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		var err error
+		files, err = getImageFiles(inputDir, recursive)
+		if err != nil {
+			logger.Error("Failed to scan image files", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	protocol := detectProtocol(previewProtocol)
+	for _, file := range files {
+		fmt.Println(file)
+		if err := previewFile(os.Stdout, file, protocol, previewSize); err != nil {
+			fmt.Printf("  Preview failed: %v\n", err)
+		}
+	}
+}
+
+// detectProtocol resolves "auto" from the environment of the terminal.
+// Terminals without kitty or iTerm2 support get sixel.
+func detectProtocol(protocol string) string {
+	if protocol != protocolAuto {
+		return protocol
+	}
+	if os.Getenv("KITTY_WINDOW_ID") != "" || strings.Contains(os.Getenv("TERM"), "kitty") {
+		return protocolKitty
+	}
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm":
+		return protocolITerm2
+	}
+	return protocolSixel
+}
+
+// previewFile writes a thumbnail of path to w using protocol
+func previewFile(w io.Writer, path, protocol string, size int) error {
+	thumb, err := processor.Thumbnail(path, size)
+	if err != nil {
+		return err
+	}
+
+	switch protocol {
+	case protocolKitty:
+		err = writeKitty(w, thumb)
+	case protocolITerm2:
+		err = writeITerm2(w, thumb, filepath.Base(path))
+	case protocolSixel:
+		err = writeSixel(w, thumb)
+	default:
+		return fmt.Errorf("unknown protocol %s", protocol)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+// encodePNGBase64 returns img as base64 encoded PNG
+func encodePNGBase64(img image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// writeKitty transmits img with the kitty graphics protocol, in chunks of
+// at most 4096 bytes of payload
+func writeKitty(w io.Writer, img image.Image) error {
+	data, err := encodePNGBase64(img)
+	if err != nil {
+		return err
+	}
+
+	const chunkSize = 4096
+	for first := true; first || len(data) > 0; first = false {
+		n := len(data)
+		if n > chunkSize {
+			n = chunkSize
+		}
+		chunk := data[:n]
+		data = data[n:]
+
+		more := 0
+		if len(data) > 0 {
+			more = 1
+		}
+		control := fmt.Sprintf("m=%d", more)
+		if first {
+			control = "f=100,a=T," + control
+		}
+		if _, err := fmt.Fprintf(w, "\x1b_G%s;%s\x1b\\", control, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeITerm2 transmits img with the iTerm2 inline image protocol
+func writeITerm2(w io.Writer, img image.Image, name string) error {
+	data, err := encodePNGBase64(img)
+	if err != nil {
+		return err
+	}
+	encodedName := base64.StdEncoding.EncodeToString([]byte(name))
+	_, err = fmt.Fprintf(w, "\x1b]1337;File=name=%s;inline=1;preserveAspectRatio=1:%s\a", encodedName, data)
+	return err
+}
+
+// writeSixel transmits img as sixel graphics using a fixed 6x6x6 color cube
+func writeSixel(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Quantize every pixel to the color cube
+	indices := make([]int, width*height)
+	used := make([]bool, 216)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			i := int(r>>8*6/256)*36 + int(g>>8*6/256)*6 + int(b>>8*6/256)
+			indices[y*width+x] = i
+			used[i] = true
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\x1bPq\"1;1;%d;%d", width, height)
+	for i, ok := range used {
+		if ok {
+			// Palette components are percentages
+			fmt.Fprintf(&buf, "#%d;2;%d;%d;%d", i, i/36*20, i/6%6*20, i%6*20)
+		}
+	}
+
+	// Each band covers six rows; each color is drawn over the band in turn
+	row := make([]byte, width)
+	for top := 0; top < height; top += 6 {
+		for color, ok := range used {
+			if !ok {
+				continue
+			}
+			present := false
+			for x := 0; x < width; x++ {
+				var bits byte
+				for dy := 0; dy < 6 && top+dy < height; dy++ {
+					if indices[(top+dy)*width+x] == color {
+						bits |= 1 << dy
+					}
+				}
+				row[x] = 63 + bits
+				present = present || bits != 0
+			}
+			if !present {
+				continue
+			}
+			fmt.Fprintf(&buf, "#%d", color)
+			writeSixelRun(&buf, row)
+			buf.WriteByte('$')
+		}
+		buf.WriteByte('-')
+	}
+	buf.WriteString("\x1b\\")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeSixelRun writes sixel characters with run-length encoding
+func writeSixelRun(buf *bytes.Buffer, row []byte) {
+	for i := 0; i < len(row); {
+		j := i
+		for j < len(row) && row[j] == row[i] {
+			j++
+		}
+		if n := j - i; n > 3 {
+			fmt.Fprintf(buf, "!%d%c", n, row[i])
+		} else {
+			buf.Write(row[i:j])
+		}
+		i = j
+	}
+}
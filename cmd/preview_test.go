@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDetectProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{"Kitty", map[string]string{"KITTY_WINDOW_ID": "1"}, protocolKitty},
+		{"Kitty TERM", map[string]string{"TERM": "xterm-kitty"}, protocolKitty},
+		{"iTerm2", map[string]string{"TERM_PROGRAM": "iTerm.app"}, protocolITerm2},
+		{"Fallback", map[string]string{"TERM": "xterm-256color"}, protocolSixel},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("KITTY_WINDOW_ID", "")
+			t.Setenv("TERM", "")
+			t.Setenv("TERM_PROGRAM", "")
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			if result := detectProtocol(protocolAuto); result != test.expected {
+				t.Errorf("detectProtocol() = %s, expected %s", result, test.expected)
+			}
+		})
+	}
+
+	if result := detectProtocol(protocolSixel); result != protocolSixel {
+		t.Errorf("detectProtocol(sixel) = %s, expected explicit sixel", result)
+	}
+}
+
+func TestWriteKitty(t *testing.T) {
+	// A noisy image produces a PNG larger than one chunk
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+
+	var buf bytes.Buffer
+	if err := writeKitty(&buf, img); err != nil {
+		t.Fatalf("writeKitty() error = %v", err)
+	}
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "\x1b_Gf=100,a=T,m=1;") {
+		t.Errorf("writeKitty() first chunk header = %q", out[:20])
+	}
+	if !strings.Contains(out, "\x1b_Gm=0;") {
+		t.Error("writeKitty() missing final chunk")
+	}
+}
+
+func TestWriteITerm2(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeITerm2(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)), "a.jpg"); err != nil {
+		t.Fatalf("writeITerm2() error = %v", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "\x1b]1337;File=name=YS5qcGc=;inline=1") || !strings.HasSuffix(out, "\a") {
+		t.Errorf("writeITerm2() = %q", out)
+	}
+}
+
+func TestWriteSixel(t *testing.T) {
+	// 2x2: red top row, blue bottom row
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(0, 1, color.RGBA{0, 0, 255, 255})
+	img.Set(1, 1, color.RGBA{0, 0, 255, 255})
+
+	var buf bytes.Buffer
+	if err := writeSixel(&buf, img); err != nil {
+		t.Fatalf("writeSixel() error = %v", err)
+	}
+
+	// Blue is cube index 5, red is 180; bit 0 is the top row, bit 1 the second
+	expected := "\x1bPq\"1;1;2;2#5;2;0;0;100#180;2;100;0;0#5AA$#180@@$-\x1b\\"
+	if buf.String() != expected {
+		t.Errorf("writeSixel() = %q, expected %q", buf.String(), expected)
+	}
+}
+
+func TestWriteSixelRun(t *testing.T) {
+	var buf bytes.Buffer
+	writeSixelRun(&buf, []byte("??????AB"))
+	if buf.String() != "!6?AB" {
+		t.Errorf("writeSixelRun() = %q, expected %q", buf.String(), "!6?AB")
+	}
+}
@@ -1,14 +1,19 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sort"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"picture-resize-tools/pkg/pool"
 	"picture-resize-tools/pkg/processor"
 )
 
@@ -25,8 +30,11 @@ func init() {
 // validateInputs validates command line inputs
 func validateInputs() error {
 	// Validate output format
-	if outputFormat != "jpg" && outputFormat != "png" {
-		return fmt.Errorf("output format must be jpg or png, got: %s", outputFormat)
+	if outputFormat == "jxl" && !processor.IsSupportedOutputFormat(outputFormat) {
+		return fmt.Errorf("output format jxl needs a build with -tags jxl")
+	}
+	if !processor.IsSupportedOutputFormat(outputFormat) {
+		return fmt.Errorf("output format must be one of %s, got: %s", strings.Join(processor.OutputFormats(), ", "), outputFormat)
 	}
 
 	// Validate input directory exists
@@ -49,68 +57,811 @@ func validateInputs() error {
 		return fmt.Errorf("worker count must be positive, got: %d", workers)
 	}
 
+	// Validate output size limit
+	if maxOutputSize != "" {
+		if size, err := parseSize(maxOutputSize); err != nil {
+			return fmt.Errorf("max output size is invalid: %v", err)
+		} else if size < 1 {
+			return fmt.Errorf("max output size must be more than 0 bytes, got: %s", maxOutputSize)
+		}
+	}
+
+	// Validate preset and attachment limit
+	if err := validatePreset(presetName); err != nil {
+		return err
+	}
+	if err := validateSafeNames(safeNames, outputFormat); err != nil {
+		return err
+	}
+	if _, err := parseCameraRules(cameraPreset); err != nil {
+		return fmt.Errorf("camera preset is invalid: %v", err)
+	}
+	if _, err := parseTimeCorrection(shiftTime, setTimezone); err != nil {
+		return err
+	}
+	if splitEvents != "" {
+		if _, err := parseEventGap(splitEvents); err != nil {
+			return err
+		}
+	}
+	if attachLimit != "" {
+		if size, err := parseSize(attachLimit); err != nil {
+			return fmt.Errorf("attachment limit is invalid: %v", err)
+		} else if size < 1 {
+			return fmt.Errorf("attachment limit must be more than 0 bytes, got: %s", attachLimit)
+		}
+		if maxOutputSize != "" {
+			return fmt.Errorf("attachment limit cannot be combined with max output size")
+		}
+		if skipExisting || ifNewer {
+			return fmt.Errorf("attachment limit cannot be combined with --skip-existing or --if-newer, retries re-encode every output")
+		}
+	}
+
+	if flatten && keepStructure {
+		return fmt.Errorf("flatten cannot be combined with --preserve-structure, pick one layout")
+	}
+
+	if err := validateCollision(onCollision); err != nil {
+		return err
+	}
+
+	// Validate the output name template
+	if nameTemplate != "" {
+		if err := validateNameTemplate(nameTemplate); err != nil {
+			return err
+		}
+		if flatten || safeNames != "" {
+			return fmt.Errorf("name template cannot be combined with --flatten or --safe-names, pick one naming")
+		}
+	}
+
+	// Validate the policy for existing outputs
+	if _, err := existingPolicy(skipExisting, ifNewer, overwrite); err != nil {
+		return err
+	}
+	if ifNewer && (deterministic || shiftTime != "" || setTimezone != "") {
+		return fmt.Errorf("if newer cannot be combined with --deterministic, --shift-time or --set-timezone, outputs do not keep the time they were written")
+	}
+
+	// Validate zip layout
+	if zipLayout != zipLayoutFlat && zipLayout != zipLayoutTree {
+		return fmt.Errorf("zip layout must be flat or tree, got: %s", zipLayout)
+	}
+
+	// Validate zip encryption
+	if len(zipRecipient) > 0 || zipPassEnv != "" {
+		if zipOutput == "" {
+			return fmt.Errorf("zip encryption requires --zip-output")
+		}
+		if _, err := zipRecipients(zipRecipient, zipPassEnv); err != nil {
+			return fmt.Errorf("zip encryption is invalid: %v", err)
+		}
+	}
+
+	// Validate metadata stripping
+	if stripMetadata && processingLog {
+		return fmt.Errorf("strip metadata cannot be combined with --processing-log, it is XMP metadata")
+	}
+	if (stripMetadata || anonymize) && (setArtist != "" || setCopyright != "") {
+		return fmt.Errorf("set artist or copyright cannot be combined with --strip-metadata or --anonymize, it is EXIF data")
+	}
+	if (stripMetadata || anonymize) && copySidecars {
+		return fmt.Errorf("copy sidecars cannot be combined with --strip-metadata or --anonymize, sidecars are metadata")
+	}
+	if stripGPS && !keepEXIF {
+		return fmt.Errorf("strip gps needs --keep-exif, without it there is no EXIF data left to scrub")
+	}
+
+	// Validate anonymization
+	if anonymize {
+		if anonymizeMap == "" {
+			return fmt.Errorf("anonymize requires --anonymize-map for the private name mapping")
+		}
+		if zipLayout == zipLayoutTree {
+			return fmt.Errorf("anonymize cannot be combined with the tree zip layout")
+		}
+		if processingLog {
+			return fmt.Errorf("anonymize cannot be combined with --processing-log, outputs carry no metadata")
+		}
+		if shiftTime != "" || setTimezone != "" {
+			return fmt.Errorf("anonymize cannot be combined with --shift-time or --set-timezone, outputs carry no capture time")
+		}
+		if splitEvents != "" {
+			return fmt.Errorf("anonymize cannot be combined with --split-events, folder names reveal capture dates")
+		}
+		if flatten {
+			return fmt.Errorf("anonymize cannot be combined with --flatten, outputs are named by opaque IDs")
+		}
+		if skipExisting || ifNewer {
+			return fmt.Errorf("anonymize cannot be combined with --skip-existing or --if-newer, opaque IDs change every run")
+		}
+		if keepStructure {
+			return fmt.Errorf("anonymize cannot be combined with --preserve-structure, folder names reveal the source tree")
+		}
+		if nameTemplate != "" {
+			return fmt.Errorf("anonymize cannot be combined with --name-template, outputs are named by opaque IDs")
+		}
+	}
+
+	// Validate adaptive worker bounds
+	if adaptiveWorkers && (minWorkers < 1 || minWorkers > workers) {
+		return fmt.Errorf("minimum workers must be between 1 and %d, got: %d", workers, minWorkers)
+	}
+
+	// Validate power-aware throttling
+	if batteryWorkers < 0 {
+		return fmt.Errorf("battery workers must not be negative, got: %d", batteryWorkers)
+	}
+	if maxTemperature < 0 {
+		return fmt.Errorf("maximum temperature must not be negative, got: %g", maxTemperature)
+	}
+
+	// Validate output permissions and ownership
+	if chmodMode != "" {
+		if _, err := parseChmod(chmodMode); err != nil {
+			return fmt.Errorf("invalid --chmod: %v", err)
+		}
+	}
+	if chownOwner != "" {
+		if _, err := parseChown(chownOwner); err != nil {
+			return fmt.Errorf("invalid --chown: %v", err)
+		}
+	}
+
+	// Validate assumed color profile
+	if assumeProfile != "" {
+		if _, err := processor.OpenColorProfile(assumeProfile); err != nil {
+			return fmt.Errorf("invalid --assume-profile: %v", err)
+		}
+	}
+
+	// Validate the watermark
+	if watermark != "" && watermarkText != "" {
+		return fmt.Errorf("watermark text cannot be combined with --watermark, composite one of them")
+	}
+	if watermark != "" {
+		if _, err := processor.OpenWatermark(watermark); err != nil {
+			return fmt.Errorf("invalid --watermark: %v", err)
+		}
+	}
+	if watermarkText != "" {
+		if _, err := processor.NewTextWatermark(watermarkText, watermarkFont); err != nil {
+			return fmt.Errorf("invalid --watermark-font: %v", err)
+		}
+		if watermarkSize <= 0 || watermarkSize > 50 {
+			return fmt.Errorf("watermark size must be above 0 and at most 50, got: %g", watermarkSize)
+		}
+		if _, err := parseHexColor(watermarkColor); err != nil {
+			return fmt.Errorf("invalid --watermark-color: %v", err)
+		}
+	}
+	if watermark != "" || watermarkText != "" {
+		if !processor.IsSupportedWatermarkPosition(watermarkPos) {
+			return fmt.Errorf("watermark position must be %s, got: %s", joinChoices(processor.WatermarkPositions()), watermarkPos)
+		}
+		if watermarkScale < 0 || watermarkScale > 100 {
+			return fmt.Errorf("watermark scale must be between 0 and 100, got: %g", watermarkScale)
+		}
+		if watermarkMargin < 0 || watermarkMargin >= 50 {
+			return fmt.Errorf("watermark margin must be at least 0 and below 50, got: %g", watermarkMargin)
+		}
+		if watermarkAlpha <= 0 || watermarkAlpha > 100 {
+			return fmt.Errorf("watermark opacity must be above 0 and at most 100, got: %g", watermarkAlpha)
+		}
+	}
+
+	// Validate white balance and exposure
+	if exposureLevel < 0 || exposureLevel > 255 {
+		return fmt.Errorf("exposure level must be between 0 and 255, got: %d", exposureLevel)
+	}
+	if whiteBalance != "" {
+		if _, err := parseWhiteBalance(whiteBalance, exposureLevel); err != nil {
+			return fmt.Errorf("invalid --white-balance: %v", err)
+		}
+	} else if exposureLevel != 0 {
+		return fmt.Errorf("exposure level needs --white-balance")
+	}
+
+	// Validate encoder speed
+	if speed < 0 || speed > 9 {
+		return fmt.Errorf("speed must be between 0 (encoder default) and 9, got: %d", speed)
+	}
+	if effort < 0 || effort > 10 {
+		return fmt.Errorf("effort must be between 0 (encoder default) and 10, got: %d", effort)
+	}
+
+	// Validate resize mode
+	if !slices.Contains(resizeModes, resizeMode) {
+		return fmt.Errorf("mode must be %s, got: %s", joinChoices(resizeModes), resizeMode)
+	}
+	if _, err := parseHexColor(padColor); err != nil {
+		return fmt.Errorf("invalid --pad-color: %v", err)
+	}
+
+	// Validate tone adjustments
+	if contrast < -100 || contrast > 100 {
+		return fmt.Errorf("contrast must be between -100 and 100, got: %g", contrast)
+	}
+	if ditherMethod != "" && !processor.IsSupportedDither(ditherMethod) {
+		return fmt.Errorf("dither must be %s, got: %s", joinChoices(processor.Dithers()), ditherMethod)
+	}
+	if grayLevels < 2 || grayLevels > 256 {
+		return fmt.Errorf("gray levels must be between 2 and 256, got: %d", grayLevels)
+	}
+
+	// Validate page mode
+	if pageMode != "first" && pageMode != "all" {
+		return fmt.Errorf("pages must be first or all, got: %s", pageMode)
+	}
+
+	// Validate mipmap output
+	if mipmaps != "" && !processor.IsSupportedMipmaps(mipmaps) {
+		return fmt.Errorf("mipmaps must be %s, got: %s", joinChoices(processor.MipmapModes()), mipmaps)
+	}
+	if document != "" && !processor.IsSupportedDocument(document) {
+		return fmt.Errorf("document must be %s, got: %s", joinChoices(processor.DocumentModes()), document)
+	}
+	if !processor.IsSupportedColorTag(colorTag) {
+		return fmt.Errorf("color tag must be %s, got: %s", joinChoices(processor.ColorTags()), colorTag)
+	}
+	if mipmaps != "" && pageMode == "all" {
+		return fmt.Errorf("mipmaps cannot be combined with --pages all, a mipmap chain is built from one image")
+	}
+	if mipmaps != "" && splitSpreads {
+		return fmt.Errorf("mipmaps cannot be combined with --split-spreads, a mipmap chain is built from one image")
+	}
+
+	// Validate PDF rendering
+	if pdfDPI < 0 || pdfDPI > 2400 {
+		return fmt.Errorf("PDF DPI must be between 0 and 2400, got: %d", pdfDPI)
+	}
+	if pdfDPI > 0 {
+		if _, err := processor.PDFRasterizer(); err != nil {
+			return fmt.Errorf("--pdf-dpi: %v", err)
+		}
+	}
+
+	// Validate fill gravity
+	if !processor.IsSupportedGravity(gravity) {
+		return fmt.Errorf("gravity must be %s, got: %s", joinChoices(processor.Gravities()), gravity)
+	}
+
+	// Validate checkpoint size
+	if checkpointSize < 0 {
+		return fmt.Errorf("checkpoint size must not be negative, got: %d", checkpointSize)
+	}
+
+	// Validate clipping threshold
+	if clipThreshold < 0 || clipThreshold > 100 {
+		return fmt.Errorf("clip threshold must be between 0 and 100, got: %g", clipThreshold)
+	}
+
+	// Validate slow file factor
+	if slowFactor < 0 {
+		return fmt.Errorf("slow factor must not be negative, got: %g", slowFactor)
+	}
+
+	// Validate HTML report
+	if htmlReport != "" {
+		if ext := strings.ToLower(filepath.Ext(htmlReport)); ext != ".html" && ext != ".htm" {
+			return fmt.Errorf("html report must be an .html file, got: %s", htmlReport)
+		}
+	}
+	if htmlReportPage < 1 {
+		return fmt.Errorf("html report page size must be at least 1, got: %d", htmlReportPage)
+	}
+
+	// Validate progress output
+	if progressMode != progressModeAuto && progressMode != progressModeBar && progressMode != progressModeLines {
+		return fmt.Errorf("progress must be auto, bar or lines, got: %s", progressMode)
+	}
+
 	return nil
 }
 
+// messageOutput returns where a run writes its reports and progress bar:
+// standard output, or standard error with --json, which keeps standard
+// output for the results
+func messageOutput() *os.File {
+	if jsonOutput {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
 func runProcess() {
+	start := time.Now()
+
 	// Validate inputs
 	if err := validateInputs(); err != nil {
-		fmt.Printf("Input validation failed: %v\n", err)
+		logger.Error("Input validation failed", "error", err)
 		os.Exit(1)
 	}
 
+	// Apply preset settings
+	applyPreset(presetName)
+
+	// An explicitly chosen format applies to all images, as do 8.3 names,
+	// which need its three letter extension
+	if rootCmd.PersistentFlags().Changed("format") || safeNames == safeNames83 {
+		forceConvert = true
+	}
+
 	// Create output directory
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		fmt.Printf("Failed to create output directory '%s': %v\n", outputDir, err)
+		logger.Error("Failed to create output directory", "dir", outputDir, "error", err)
 		os.Exit(1)
 	}
 
-	// Get all image files
-	imageFiles, err := getImageFiles(inputDir, recursive)
+	config := processConfig()
+
+	// Remove the outputs a crashed run left half-written
+	crashed, err := recoverJournal(outputDir)
 	if err != nil {
-		fmt.Printf("Failed to scan image files: %v\n", err)
+		logger.Error("Failed to read journal", "error", err)
 		os.Exit(1)
 	}
+	if crashed != nil {
+		logger.Info("Removed half-written outputs of an interrupted run", "count", len(crashed.Files))
+	}
 
-	if len(imageFiles) == 0 {
-		fmt.Println("No image files found")
-		return
+	var files []string
+	var keepFormat bool
+	var done checkpointState
+	if resume {
+		// Continue with the files left over by a previous run
+		state, err := loadResumeState(outputDir)
+		if err != nil {
+			logger.Error("Failed to read resume file", "error", err)
+			os.Exit(1)
+		}
+		cp, err := loadCheckpoint(outputDir)
+		if err != nil {
+			logger.Error("Failed to read checkpoint file", "error", err)
+			os.Exit(1)
+		}
+
+		switch {
+		case state != nil:
+			files, keepFormat = state.Files, state.KeepFormat
+		case cp != nil:
+			// An interrupted run left only a checkpoint, start over from the input
+			imageFiles, err := getImageFiles(inputDir, recursive)
+			if err != nil {
+				logger.Error("Failed to scan image files", "error", err)
+				os.Exit(1)
+			}
+			files, keepFormat = imageFiles, cp.KeepFormat
+			if keepFormat {
+				_, files = separateImageFiles(imageFiles)
+			}
+		case crashed != nil:
+			// Only the journal is left, redo exactly the interrupted files
+			files, keepFormat = crashed.Files, crashed.KeepFormat
+		default:
+			logger.Info("Nothing to resume")
+			return
+		}
+
+		// Skip the files committed before the previous run was interrupted
+		if cp != nil {
+			files = remainingFiles(files, cp.Files)
+			done = *cp
+			logger.Info("Skipping image files committed in checkpoints", "files", len(cp.Files), "checkpoints", cp.Chunks)
+		}
+		logger.Info("Resuming image files left over by a previous run", "files", len(files))
+	} else {
+		// A new run makes any earlier checkpoint meaningless
+		if err := removeCheckpoint(outputDir); err != nil {
+			logger.Error("Failed to remove checkpoint file", "error", err)
+			os.Exit(1)
+		}
+
+		// Get all image files
+		imageFiles, err := getImageFiles(inputDir, recursive)
+		if err != nil {
+			logger.Error("Failed to scan image files", "error", err)
+			os.Exit(1)
+		}
+
+		if len(imageFiles) == 0 {
+			logger.Info("No image files found", "dir", inputDir)
+			return
+		}
+
+		// Separate HEIC and regular images
+		heicFiles, regularFiles := separateImageFiles(imageFiles)
+
+		logger.Info("Found image files, starting processing", "files", len(imageFiles), "heic", len(heicFiles), "regular", len(regularFiles))
+
+		// If there are HEIC files, process all images with format conversion
+		if len(heicFiles) > 0 || forceConvert {
+			if len(heicFiles) > 0 {
+				logger.Info("HEIC files found, processing all images with format conversion", "format", outputFormat)
+			} else {
+				logger.Info("Converting all images", "format", outputFormat)
+			}
+			files = imageFiles
+		} else {
+			// No HEIC files, only resize regular images and keep original format
+			logger.Info("No HEIC files found, only resizing regular images and keeping original format")
+			files, keepFormat = regularFiles, true
+		}
 	}
 
-	// Separate HEIC and regular images
-	heicFiles, regularFiles := separateImageFiles(imageFiles)
+	config.KeepFormat = keepFormat
 
-	fmt.Printf("Found %d image files (%d HEIC, %d regular), starting processing...\n", len(imageFiles), len(heicFiles), len(regularFiles))
+	// Group outputs into events and plan their names. The whole input is
+	// planned, so resumed runs give files the same folders and names.
+	events, outputNames = nil, nil
+	if splitEvents != "" || safeNames != "" {
+		imageFiles, err := getImageFiles(inputDir, recursive)
+		if err != nil {
+			logger.Error("Failed to scan image files", "error", err)
+			os.Exit(1)
+		}
+		if splitEvents != "" {
+			gap, _ := parseEventGap(splitEvents)
+			events = planEvents(imageFiles, gap)
+			logger.Info("Grouped image files into events", "events", countEvents(events), "gap", gap)
+		}
+		if safeNames != "" {
+			outputNames = planSafeNames(imageFiles, inputDir, safeNames, flatten)
+		}
+	}
 
-	// Configure processor
-	config := processor.Config{
-		OutputFormat: outputFormat,
-		MaxWidth:     maxWidth,
-		MaxHeight:    maxHeight,
-		Quality:      quality,
-		OutputDir:    outputDir,
+	// Commit outputs in chunks so an interrupted run can be resumed
+	done.KeepFormat = keepFormat
+	checkpoints = newCheckpointer(outputDir, checkpointSize, done)
+
+	// Journal the outputs being written so a crash can be cleaned up
+	journal, err = openJournal(outputDir, keepFormat)
+	if err != nil {
+		logger.Error("Failed to create journal", "error", err)
+		os.Exit(1)
+	}
+
+	// Load the text to burn into each image
+	stamps = nil
+	if stampCSV != "" {
+		var err error
+		stamps, err = loadStampCSV(stampCSV)
+		if err != nil {
+			logger.Error("Failed to read stamp CSV", "file", stampCSV, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Load per-file overrides
+	manifest = nil
+	if manifestPath != "" {
+		var err error
+		manifest, err = loadManifest(manifestPath)
+		if err != nil {
+			logger.Error("Failed to read manifest", "file", manifestPath, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Apply presets by camera model
+	cameraRules, _ = parseCameraRules(cameraPreset)
+
+	// Correct capture times
+	timeFix, _ = parseTimeCorrection(shiftTime, setTimezone)
+
+	// Name outputs by opaque IDs
+	anon = nil
+	if anonymize {
+		anon = newAnonymizer()
+	}
+
+	// Name outputs after the template. Sizes are planned with the settings
+	// of each file, so the template is left out while they are read.
+	templateNames = nil
+	if nameTemplate != "" {
+		imageFiles, err := getImageFiles(inputDir, recursive)
+		if err != nil {
+			logger.Error("Failed to scan image files", "error", err)
+			os.Exit(1)
+		}
+		templateNames = planNameTemplate(imageFiles, nameTemplate, config)
 	}
 
-	// If there are HEIC files, process all images with format conversion
-	if len(heicFiles) > 0 {
-		fmt.Println("HEIC files found, processing all images with format conversion...")
-		processImagesConcurrently(imageFiles, config)
+	// Give outputs that would replace each other unique names. The whole
+	// input is planned, so resumed runs give files the same names.
+	// Anonymized outputs have unique names already.
+	collisionNames = nil
+	if onCollision != collisionOverwrite && anon == nil {
+		imageFiles, err := getImageFiles(inputDir, recursive)
+		if err != nil {
+			logger.Error("Failed to scan image files", "error", err)
+			os.Exit(1)
+		}
+		collisionNames = planCollisions(plannedOutputs(imageFiles, config), inputDir, onCollision)
+		if len(collisionNames) > 0 {
+			logger.Info("Renamed outputs that would replace each other", "files", len(collisionNames), "strategy", onCollision)
+		}
+	}
+
+	// No output may replace one of the run's inputs, whatever the
+	// collision and existing-output settings
+	config.IsSource = newSourceSet(files).contains
+
+	// Limit the cumulative output size
+	limit, _ := parseSize(maxOutputSize)
+	quota = newOutputQuota(limit)
+
+	// Stream outputs into a zip as they are produced. With an attachment
+	// limit the outputs may be re-encoded, so the zip is written at the end.
+	var zipFile *zipArchive
+	if zipOutput != "" {
+		recipients, err := zipRecipients(zipRecipient, zipPassEnv)
+		if err != nil {
+			logger.Error("Invalid zip encryption settings", "error", err)
+			os.Exit(1)
+		}
+		zipFile, err = createZipArchive(zipOutput, zipLayout, inputDir, recipients...)
+		if err != nil {
+			logger.Error("Failed to create zip file", "file", zipOutput, "error", err)
+			os.Exit(1)
+		}
+		if attachLimit == "" {
+			archive = zipFile
+		}
+	}
+
+	// Allow pausing and draining the run from outside
+	drainer = newDrainSwitch()
+	stopPauseSignals := watchPauseSignals()
+	defer stopPauseSignals()
+	stopDrainSignals := watchDrainSignals()
+	defer stopDrainSignals()
+	if controlSocket != "" {
+		stopControl, err := serveControl(controlSocket)
+		if err != nil {
+			logger.Error("Failed to open control socket", "socket", controlSocket, "error", err)
+			os.Exit(1)
+		}
+		defer stopControl()
+	}
+
+	var results []fileResult
+	if keepFormat {
+		results = processImagesWithSameFormat(files, config)
 	} else {
-		// No HEIC files, only resize regular images and keep original format
-		fmt.Println("No HEIC files found, only resizing regular images and keeping original format...")
-		processImagesWithSameFormat(regularFiles, config)
+		results = processImagesConcurrently(files, config)
+	}
+	// Retries for the attachment limit replace the outputs of this run
+	replaced := countReplaced(results)
+
+	// Lower the quality until the outputs fit into the attachment limit
+	if attachLimit != "" && !drainer.active() {
+		limit, _ := parseSize(attachLimit)
+		var ok bool
+		var chosen int
+		results, chosen, ok = fitToLimit(results, config.Quality, limit, func(q int) []fileResult {
+			logger.Info("Outputs exceed the attachment limit, retrying", "limit", attachLimit, "quality", q)
+			config.Quality = q
+			if keepFormat {
+				return processImagesWithSameFormat(files, config)
+			}
+			return processImagesConcurrently(files, config)
+		}, drainer.active)
+		if drainer.active() {
+			// The files drained from a pass keep the outputs of the one before
+			drainer.forget()
+			logger.Warn("Drained while fitting into the attachment limit, outputs are of the last passes", "limit", attachLimit, "fits", ok)
+		} else if !ok {
+			logger.Warn("Outputs do not fit into the attachment limit, select fewer files or lower the maximum size", "limit", attachLimit, "quality", minSearchQuality)
+		} else if chosen != quality {
+			logger.Info("Outputs fit into the attachment limit", "limit", attachLimit, "quality", chosen, "size", formatBytes(totalOutputSize(results)))
+		}
+	}
+
+	// Keep the private mapping of opaque IDs
+	if anon != nil {
+		if err := anon.writeMapping(anonymizeMap); err != nil {
+			logger.Error("Failed to write anonymize map", "file", anonymizeMap, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Anonymize map written, keep it private", "file", anonymizeMap)
+	}
+
+	// Finish the zip file
+	if zipFile != nil {
+		if archive == nil {
+			for _, r := range results {
+				if r.err != nil {
+					continue
+				}
+				for _, output := range r.Outputs() {
+					if err := zipFile.add(r.path, output); err != nil {
+						logger.Error("Failed to add output to zip", "file", output, "error", err)
+					}
+				}
+			}
+		}
+		archive = nil
+		if zipManifest {
+			if err := zipFile.writeManifest(runReadme(results, config)); err != nil {
+				logger.Error("Failed to add manifest to zip", "error", err)
+			}
+		}
+		if err := zipFile.Close(); err != nil {
+			logger.Error("Failed to write zip file", "file", zipOutput, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Zip file written", "file", zipOutput)
+	}
+
+	// Record failures for the review command
+	if err := recordFailures(outputDir, results, keepFormat); err != nil {
+		logger.Error("Failed to record failures", "error", err)
 	}
 
-	fmt.Println("All images processed!")
+	// Record the files that did not fit into the quota or were drained
+	deferred := quota.deferredFiles()
+	drained := drainer.skippedFiles()
+	if len(drained) > 0 {
+		deferred = append(deferred, drained...)
+		sort.Strings(deferred)
+	}
+	if len(deferred) > 0 || resume {
+		if err := saveResumeState(outputDir, resumeState{KeepFormat: keepFormat, Files: deferred}); err != nil {
+			logger.Error("Failed to write resume file", "error", err)
+			os.Exit(1)
+		}
+	}
+	// The run is complete, so the checkpoint and journal are no longer needed
+	if err := removeCheckpoint(outputDir); err != nil {
+		logger.Error("Failed to remove checkpoint file", "error", err)
+	}
+	if err := journal.close(); err != nil {
+		logger.Error("Failed to remove journal", "error", err)
+	}
+	journal = nil
+	if len(drained) > 0 {
+		logger.Info("Drained, files left for a later run (use --resume)", "files", len(drained))
+	}
+	if len(deferred) > len(drained) {
+		logger.Info("Output size limit reached, files left for a later run (use --resume)", "limit", maxOutputSize, "files", len(deferred)-len(drained))
+	}
+
+	if htmlReport != "" {
+		if pages, err := writeHTMLReport(htmlReport, htmlReportPage, results, config); err != nil {
+			logger.Error("Failed to write HTML report", "file", htmlReport, "error", err)
+		} else {
+			logger.Info("HTML report written", "file", htmlReport, "pages", pages)
+		}
+	}
+
+	logger.Info("All images processed")
+	summary := summarizeRun(results, len(deferred), time.Since(start))
+	if jsonOutput {
+		if err := writeJSONResults(os.Stdout, results, summary); err != nil {
+			logger.Error("Failed to write JSON results", "error", err)
+		}
+	}
+	if failed := countFailures(results); failed > 0 {
+		logger.Warn("Files failed, run 'review' to retry or ignore them", "files", failed)
+	}
+	if replaced > 0 && !overwrite {
+		logger.Warn("Replaced outputs of an earlier run, use --skip-existing or --if-newer to keep them or --overwrite to silence this", "files", replaced)
+	}
+
+	// Quiet runs leave out the reports, errors were logged
+	if quiet {
+		return
+	}
+	out := messageOutput()
+	printSummary(out, summary)
+	printBreakdown(out, "By format", groupResults(results, formatKey))
+	if groups := groupResults(results, directoryKey(inputDir)); len(groups) > 1 {
+		printBreakdown(out, "By directory", groups)
+	}
+	printSlowFiles(out, findSlowFiles(results, slowFactor), slowFactor)
+	printClippedFiles(out, findClippedFiles(results, clipThreshold), clipThreshold)
+}
+
+// joinChoices lists choices as "a, b or c"
+func joinChoices(choices []string) string {
+	if len(choices) < 2 {
+		return strings.Join(choices, "")
+	}
+	return strings.Join(choices[:len(choices)-1], ", ") + " or " + choices[len(choices)-1]
+}
+
+// resizeModes are the values of --mode
+var resizeModes = []string{"fit", "fill", "carve", "stretch", "pad"}
+
+// processConfig returns the processor settings of the command line and
+// preset shared by all files of a run
+func processConfig() processor.Config {
+	config := processor.Config{
+		OutputFormat:  outputFormat,
+		MaxWidth:      maxWidth,
+		MaxHeight:     maxHeight,
+		Quality:       quality,
+		Speed:         speed,
+		Effort:        effort,
+		OutputDir:     outputDir,
+		Deterministic: deterministic,
+		Fill:          resizeMode == "fill",
+		Carve:         resizeMode == "carve",
+		Stretch:       resizeMode == "stretch",
+		Pad:           resizeMode == "pad",
+		Gravity:       gravity,
+		AutoOrient:    autoOrient,
+		LinearResize:  linearResize,
+		PreserveAttrs: preserveAttrs,
+		Contrast:      contrast,
+		Grayscale:     grayscale,
+		Dither:        ditherMethod,
+		GrayLevels:    grayLevels,
+		Mipmaps:       mipmaps,
+		ColorTag:      colorTag,
+		Document:      document,
+		AllPages:      pageMode == "all",
+		SplitSpreads:  splitSpreads,
+		Deskew:        deskew,
+		PDFDPI:        pdfDPI,
+		Histogram:     clipThreshold > 0,
+		KeepEXIF:      keepEXIF,
+		KeepCatalog:   keepCatalog,
+		StripGPS:      stripGPS,
+		Artist:        setArtist,
+		Copyright:     setCopyright,
+		CopySidecars:  copySidecars,
+		StripMetadata: stripMetadata || anonymize,
+		ProcessingLog: processingLog,
+		Software:      "picture-resize-tools " + version,
+		Logger:        logger,
+	}
+	if p, ok := presets[presetName]; ok {
+		config = p.applyOptions(config)
+	}
+	config.Existing, _ = existingPolicy(skipExisting, ifNewer, overwrite)
+	if chmodMode != "" {
+		config.Mode, _ = parseChmod(chmodMode)
+	}
+	if chownOwner != "" {
+		config.Owner, _ = parseChown(chownOwner)
+	}
+	if whiteBalance != "" {
+		config.WhiteBalance, _ = parseWhiteBalance(whiteBalance, exposureLevel)
+	}
+	config.PadColor, _ = parseHexColor(padColor)
+	if watermark != "" {
+		config.Watermark, _ = processor.OpenWatermark(watermark)
+	}
+	if watermarkText != "" {
+		config.Watermark, _ = processor.NewTextWatermark(watermarkText, watermarkFont)
+		config.Watermark.Size = watermarkSize / 100
+		config.Watermark.Color, _ = parseHexColor(watermarkColor)
+	}
+	if config.Watermark != nil {
+		config.Watermark.Position = watermarkPos
+		config.Watermark.Scale = watermarkScale / 100
+		config.Watermark.Margin = watermarkMargin / 100
+		config.Watermark.Opacity = watermarkAlpha / 100
+	}
+	if assumeProfile != "" {
+		config.AssumeProfile, _ = processor.OpenColorProfile(assumeProfile)
+		logger.Info("Assuming a color profile for images without one", "profile", config.AssumeProfile.Name)
+	}
+	return config
 }
 
 func getImageFiles(dir string, recursive bool) ([]string, error) {
 	var files []string
-	exts := map[string]bool{
-		".heic": true, ".heif": true,
-		".jpg": true, ".jpeg": true,
-		".png": true, ".bmp": true,
-		".tiff": true, ".tif": true,
+	exts := make(map[string]bool)
+	for _, ext := range processor.InputExtensions() {
+		exts[ext] = true
+	}
+	// PDFs are only picked up when they are rendered
+	if pdfDPI > 0 {
+		exts[".pdf"] = true
 	}
 
 	walkFunc := func(path string, info os.FileInfo, err error) error {
@@ -150,34 +901,229 @@ func separateImageFiles(files []string) ([]string, []string) {
 }
 
 // Process images concurrently with custom processing function
-func processImagesConcurrentlyWithFunc(files []string, config processor.Config, processFunc func(string, processor.Config) error) {
-	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, workers)
+func processImagesConcurrentlyWithFunc(files []string, config processor.Config, processFunc func(string, processor.Config) (processor.Result, error)) []fileResult {
+	processFunc = recoverPanics(processFunc)
 
-	for _, file := range files {
-		wg.Add(1)
-		go func(filePath string) {
-			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			if err := processFunc(filePath, config); err != nil {
-				fmt.Printf("Processing failed %s: %v\n", filePath, err)
-			} else {
-				fmt.Printf("Processing completed: %s\n", filepath.Base(filePath))
+	// Each worker gets an ID so verbose output can tell workers apart
+	limiter := newWorkerLimiter(workers)
+	if adaptiveWorkers {
+		stop := adaptWorkers(limiter, &procSampler{root: "/proc"}, minWorkers, adaptiveInterval)
+		defer stop()
+	}
+	if policy := (powerPolicy{batteryWorkers: batteryWorkers, pauseOnBattery: pauseOnBattery, maxTemperature: maxTemperature}); policy.enabled() {
+		stop := watchPower(policy, limiter, powerInterval)
+		defer stop()
+	}
+
+	tracker := newInFlightTracker()
+	if verbose {
+		stop := tracker.reportPeriodically(slowReportInterval)
+		defer stop()
+	}
+
+	// Report progress to control clients
+	batch := &batchProgress{total: len(files), tracker: tracker, limiter: limiter}
+	progress.Store(batch)
+	defer progress.Store(nil)
+
+	// A bar replaces the line per file; logs are written above it
+	var bar *progressBar
+	if out := messageOutput(); useProgressBar(progressMode, out) {
+		bar = newProgressBar(out, len(files))
+		logOutput.setBar(bar)
+		defer logOutput.setBar(nil)
+	}
+
+	// Results are kept in file order; skipped files have none
+	ordered := make([]*fileResult, len(files))
+	workerPool := &pool.Pool{Workers: workers, Limiter: limiter}
+	workerPool.Run(context.Background(), len(files), func(_ context.Context, id, index int) error {
+		filePath := files[index]
+
+		// Hold back new files while the run is paused
+		gate.wait()
+
+		// Leave the remaining files for a later run once draining
+		if drainer.active() {
+			drainer.skip(filePath)
+			return nil
+		}
+
+		if quota.exhausted() {
+			quota.deferFile(filePath)
+			return nil
+		}
+
+		start := tracker.start(id, filePath)
+		fileConfig := config
+		if verbose {
+			logger.Info("Processing", "worker", id, "file", filePath)
+			// Slow files are reported with the step they are in
+			fileConfig.OnProgress = func(event processor.Event) { tracker.setStage(id, event.Stage) }
+		}
+
+		result, err := processFunc(filePath, fileConfig)
+		tracker.finish(id)
+
+		// Drop outputs that would exceed the size limit so the total stays
+		// below it, never the kept outputs of an earlier run
+		if err == nil && !result.Skipped && !quota.reserve(result.OutputSize) {
+			for _, output := range result.Outputs() {
+				os.Remove(output)
+			}
+			quota.deferFile(filePath)
+			return nil
+		}
+
+		if err == nil {
+			for _, output := range result.Outputs() {
+				if zipErr := archive.add(filePath, output); zipErr != nil {
+					logger.Error("Failed to add output to zip", "file", output, "error", zipErr)
+				}
+				if cpErr := checkpoints.record(filePath, output, outputSize(result, output)); cpErr != nil {
+					logger.Error("Failed to write checkpoint", "error", cpErr)
+				}
 			}
-		}(file)
+		}
+
+		ordered[index] = &fileResult{Result: result, path: filePath, duration: time.Since(start), err: err}
+		batch.done.Add(1)
+		if err != nil {
+			batch.failed.Add(1)
+		}
+
+		switch {
+		case err != nil:
+			logger.Error("Processing failed", "file", filePath, "error", err)
+		case result.Skipped:
+			if bar == nil {
+				logger.Info("Kept existing output", "file", filepath.Base(filePath), "output", result.OutputPath)
+			}
+		case verbose:
+			logger.Info("Processing completed", "worker", id, "file", filepath.Base(filePath), "duration", time.Since(start).Round(time.Millisecond))
+		case bar == nil:
+			logger.Info("Processing completed", "file", filepath.Base(filePath))
+		}
+		if err == nil && len(result.Scrubbed) > 0 {
+			logger.Info("Scrubbed location from EXIF data", "file", filepath.Base(filePath), "tags", strings.Join(result.Scrubbed, ", "))
+		}
+		if err == nil && result.Skew != 0 {
+			logger.Info("Straightened skewed scan", "file", filepath.Base(filePath), "degrees", result.Skew)
+		}
+		if bar != nil {
+			bar.add(err != nil)
+		}
+		return err
+	})
+
+	if bar != nil {
+		bar.finish()
+	}
+
+	results := make([]fileResult, 0, len(files))
+	for _, result := range ordered {
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+
+	// Commit the last partial chunk and fail outputs that did not verify
+	if err := checkpoints.flush(); err != nil {
+		logger.Error("Failed to write checkpoint", "error", err)
+	}
+	for i := range results {
+		if results[i].err == nil && checkpoints.unverified(results[i].path) {
+			results[i].err = fmt.Errorf("output %s failed checkpoint verification", results[i].OutputPath)
+		}
+	}
+	return results
+}
+
+// recoverPanics wraps processFunc so that a panic, such as a decoder's on a
+// malformed file, fails that file instead of ending the run
+func recoverPanics(processFunc func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (result processor.Result, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				result, err = processor.Result{InputPath: path}, fmt.Errorf("panic: %v", r)
+				logger.Debug("Panic processing", "file", path, "panic", r, "stack", string(debug.Stack()))
+			}
+		}()
+		return processFunc(path, config)
+	}
+}
+
+// outputSize returns the size of one output of result. Only inputs split
+// into pages have several outputs, whose sizes are read back.
+func outputSize(result processor.Result, output string) int64 {
+	if len(result.Pages) == 0 && output == result.OutputPath {
+		return result.OutputSize
+	}
+	info, err := os.Stat(output)
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+// fileProcessor returns the per-file processing function for the current
+// run. Wrappers closer to processor.Process apply their settings last.
+func fileProcessor() func(string, processor.Config) (processor.Result, error) {
+	process := processor.Process
+	if collisionNames != nil {
+		process = collisionProcessor(collisionNames, process)
+	}
+	process = outputWrappers(process)
+	if timeFix != nil {
+		process = captureTimeProcessor(process)
 	}
+	if journal != nil {
+		process = journal.wrap(process)
+	}
+	return process
+}
 
-	wg.Wait()
+// outputWrappers wraps process with the per-file settings of the current
+// run, which decide among others where outputs are written
+func outputWrappers(process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	if anon != nil {
+		process = anon.wrap(process)
+	}
+	if stamps != nil {
+		process = stampProcessor(stamps, process)
+	}
+	if manifest != nil {
+		process = manifestProcessor(manifest, inputDir, process)
+	}
+	if templateNames != nil {
+		process = templateProcessor(templateNames, process)
+	}
+	if outputNames != nil {
+		process = safeNameProcessor(outputNames, process)
+	}
+	if flatten {
+		process = flattenProcessor(inputDir, process)
+	}
+	if keepStructure {
+		process = structureProcessor(inputDir, safeNames, process)
+	}
+	if cameraRules != nil {
+		process = cameraProcessor(cameraRules, process)
+	}
+	if events != nil {
+		process = eventProcessor(events, process)
+	}
+	return process
 }
 
 // Process images concurrently
-func processImagesConcurrently(files []string, config processor.Config) {
-	processImagesConcurrentlyWithFunc(files, config, processor.ProcessImage)
+func processImagesConcurrently(files []string, config processor.Config) []fileResult {
+	config.KeepFormat = false
+	return processImagesConcurrentlyWithFunc(files, config, reloadableProcessor)
 }
 
 // Process images concurrently while keeping the same format
-func processImagesWithSameFormat(files []string, config processor.Config) {
-	processImagesConcurrentlyWithFunc(files, config, processor.ProcessImageWithSameFormat)
+func processImagesWithSameFormat(files []string, config processor.Config) []fileResult {
+	config.KeepFormat = true
+	return processImagesConcurrentlyWithFunc(files, config, reloadableProcessor)
 }
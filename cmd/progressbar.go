@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress output modes
+const (
+	progressModeAuto  = "auto"
+	progressModeBar   = "bar"
+	progressModeLines = "lines"
+)
+
+// progressRedrawInterval limits how often the bar is redrawn
+const progressRedrawInterval = 100 * time.Millisecond
+
+// progressBarWidth is the number of cells of the bar itself
+const progressBarWidth = 30
+
+// progressBar draws a single line with the files done out of total, the
+// throughput and the estimated time left, redrawn in place
+type progressBar struct {
+	mu     sync.Mutex
+	w      io.Writer
+	total  int
+	done   int
+	failed int
+	start  time.Time
+	drawn  time.Time
+	// finished shows the elapsed time, also when files were left for a
+	// later run
+	finished bool
+}
+
+func newProgressBar(w io.Writer, total int) *progressBar {
+	return &progressBar{w: w, total: total, start: time.Now()}
+}
+
+// useProgressBar reports whether the run shows a bar on out instead of a
+// line per file: on terminals in auto mode, unless verbose or quiet
+func useProgressBar(mode string, out *os.File) bool {
+	switch mode {
+	case progressModeBar:
+		return true
+	case progressModeAuto:
+		return !verbose && !quiet && isTerminal(out)
+	}
+	return false
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// add counts a finished file and redraws the bar
+func (b *progressBar) add(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done++
+	if failed {
+		b.failed++
+	}
+	now := time.Now()
+	if b.done == b.total || now.Sub(b.drawn) >= progressRedrawInterval {
+		b.draw(now)
+	}
+}
+
+// writeAbove writes p, whole lines, to w above the bar. w may be the
+// writer of the bar.
+func (b *progressBar) writeAbove(w io.Writer, p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fmt.Fprint(b.w, "\r\x1b[K")
+	n, err := w.Write(p)
+	b.draw(time.Now())
+	return n, err
+}
+
+// finish draws the final state and ends the line of the bar
+func (b *progressBar) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.finished = true
+	b.draw(time.Now())
+	fmt.Fprintln(b.w)
+}
+
+// draw replaces the current line with the bar
+func (b *progressBar) draw(now time.Time) {
+	fmt.Fprintf(b.w, "\r%s\x1b[K", b.line(now))
+	b.drawn = now
+}
+
+// line renders the bar as of now, e.g.
+// [=========>                    ]  1200/4000  30%  52.1 files/s  ETA 53s
+func (b *progressBar) line(now time.Time) string {
+	fraction := 1.0
+	if b.total > 0 {
+		fraction = float64(b.done) / float64(b.total)
+	}
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+
+	line := fmt.Sprintf("[%s] %*d/%d %3d%%", bar, len(fmt.Sprint(b.total)), b.done, b.total, int(fraction*100))
+	if b.failed > 0 {
+		line += fmt.Sprintf("  %d failed", b.failed)
+	}
+
+	elapsed := now.Sub(b.start)
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(b.done) / elapsed.Seconds()
+	}
+	line += fmt.Sprintf("  %.1f files/s", rate)
+	switch {
+	case b.finished || b.done == b.total:
+		line += "  " + elapsed.Round(time.Second).String()
+	case rate > 0:
+		left := time.Duration(float64(b.total-b.done) / rate * float64(time.Second))
+		line += "  ETA " + left.Round(time.Second).String()
+	default:
+		line += "  ETA --"
+	}
+	return line
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressBarLine(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		done     int
+		failed   int
+		elapsed  time.Duration
+		finished bool
+		expected string
+	}{
+		{"Nothing done", 0, 0, 0, false, "[>                             ]    0/4000   0%  0.0 files/s  ETA --"},
+		{"Under way", 1200, 0, 24 * time.Second, false, "[=========>                    ] 1200/4000  30%  50.0 files/s  ETA 56s"},
+		{"With failures", 2000, 3, 10 * time.Minute, false, "[===============>              ] 2000/4000  50%  3 failed  3.3 files/s  ETA 10m0s"},
+		{"Done", 4000, 0, 80 * time.Second, false, "[==============================] 4000/4000 100%  50.0 files/s  1m20s"},
+		{"Finished with files left", 3000, 0, 60 * time.Second, true, "[======================>       ] 3000/4000  75%  50.0 files/s  1m0s"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &progressBar{total: 4000, done: test.done, failed: test.failed, start: start, finished: test.finished}
+			if got := b.line(start.Add(test.elapsed)); got != test.expected {
+				t.Errorf("line() = %q\n  expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestProgressBarOutput(t *testing.T) {
+	var buf bytes.Buffer
+	b := newProgressBar(&buf, 2)
+	b.add(false)
+	b.writeAbove(&buf, []byte("Processing failed b.jpg: broken\n"))
+	b.add(true)
+	b.finish()
+
+	out := buf.String()
+	// The message clears the bar's line and the bar is drawn again below it
+	if !strings.Contains(out, "\r\x1b[KProcessing failed b.jpg: broken\n\r[") {
+		t.Errorf("message not printed above the bar: %q", out)
+	}
+	last := out[strings.LastIndex(out, "\r")+1:]
+	if !strings.Contains(last, "] 2/2 100%  1 failed") || !strings.HasSuffix(last, "\x1b[K\n") {
+		t.Errorf("final bar = %q, expected 2/2 with 1 failed", last)
+	}
+	if strings.Count(out, "\n") != 2 {
+		t.Errorf("output has %d lines, expected the message and the bar", strings.Count(out, "\n"))
+	}
+}
@@ -0,0 +1,455 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// proxyMaxAge is how long browsers and caches may keep proxied images
+const proxyMaxAge = 24 * time.Hour
+
+// maxDPR is the largest device pixel ratio w is scaled by
+const maxDPR = 4
+
+// defaultProxyWidths are the widths /proxy renders without --proxy-widths,
+// those of common phone, tablet and desktop screens at 1x to 3x
+var defaultProxyWidths = []int{160, 320, 480, 640, 750, 828, 1080, 1280, 1600, 1920, 2560, 3840}
+
+// contentTypes are the media types of the output formats
+var contentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".avif": "image/avif",
+	".heic": "image/heic",
+	".tiff": "image/tiff",
+	".jxl":  "image/jxl",
+	".cbz":  "application/vnd.comicbook+zip",
+}
+
+// negotiatedFormats are the formats /proxy offers browsers with
+// --negotiate, best first, before JPEG which all of them show
+var negotiatedFormats = []struct{ mediaType, format string }{
+	{"image/avif", "avif"},
+	{"image/webp", "webp"},
+}
+
+// proxyHandler fetches images from allowlisted hosts on demand, resizes
+// them and serves them from a cache on disk
+type proxyHandler struct {
+	hosts    []string
+	cacheDir string
+	config   processor.Config
+	process  func(string, processor.Config) (processor.Result, error)
+	client   *http.Client
+	limits   serveLimits
+	// slots limits the images processed at once to --workers
+	slots chan struct{}
+	// negotiate picks the output format from the Accept header of each
+	// request rather than the configured one
+	negotiate bool
+	// widths, if set, are the only widths rendered, ascending. Requests
+	// get the smallest at least as wide as they asked for, so that no one
+	// can fill the cache with arbitrary sizes.
+	widths []int
+	// cacheLimit is the most bytes of renditions cached, the oldest are
+	// evicted beyond it. 0 keeps them all.
+	cacheLimit int64
+	cacheMu    sync.Mutex
+	// cacheUsed is the bytes the cache holds, -1 until it is counted
+	cacheUsed int64
+}
+
+// newProxyHandler returns a handler for images of hosts, processed with
+// config and cached in cacheDir
+func newProxyHandler(hosts []string, cacheDir string, config processor.Config) *proxyHandler {
+	limits := currentServeLimits()
+	h := &proxyHandler{
+		hosts:     hosts,
+		cacheDir:  cacheDir,
+		config:    limits.clamp(config),
+		process:   recoverPanics(processor.Process),
+		limits:    limits,
+		slots:     make(chan struct{}, max(workers, 1)),
+		cacheUsed: -1,
+	}
+	h.widths = proxyWidthLadder(nil, h.config.MaxWidth)
+	// Redirects may not lead away from the allowlist
+	h.client = &http.Client{Timeout: downloadTimeout, CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if !allowedHost(h.hosts, req.URL.Hostname()) {
+			return fmt.Errorf("redirect to %s is not allowed", req.URL.Hostname())
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}}
+	return h
+}
+
+// proxyWidthLadder returns the widths /proxy renders, ascending: widths,
+// or without them defaultProxyWidths, each at most limit, and limit itself
+// unless widths are given
+func proxyWidthLadder(widths []int, limit int) []int {
+	var ladder []int
+	if len(widths) == 0 {
+		widths = append(slices.Clone(defaultProxyWidths), limit)
+	}
+	for _, width := range widths {
+		ladder = append(ladder, min(width, limit))
+	}
+	slices.Sort(ladder)
+	return slices.Compact(ladder)
+}
+
+// validateProxyHosts checks that the allowlist holds host names or
+// wildcards of subdomains such as *.example.com
+func validateProxyHosts(hosts []string) error {
+	for _, host := range hosts {
+		name := strings.TrimPrefix(host, "*.")
+		if name == "" || strings.ContainsAny(name, "/:*@?# ") {
+			return fmt.Errorf("proxy host must be a host name such as images.example.com or *.example.com, got: %s", host)
+		}
+	}
+	return nil
+}
+
+// allowedHost reports whether host is on the allowlist hosts. A wildcard
+// *.example.com allows the subdomains of example.com, not itself.
+func allowedHost(hosts []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "only GET and HEAD are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	u, err := url.Parse(query.Get("url"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if !allowedHost(h.hosts, u.Hostname()) {
+		http.Error(w, fmt.Sprintf("host %s is not allowed", u.Hostname()), http.StatusForbidden)
+		return
+	}
+	// Browsers send the hints once asked to
+	w.Header().Set("Accept-CH", "Sec-CH-Width, Sec-CH-DPR")
+	width, hint, err := h.requestWidth(r)
+	if err != nil {
+		http.Error(w, "w "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if hint != "" {
+		w.Header().Add("Vary", "Sec-CH-"+hint+", "+hint)
+	}
+	if query.Get("h") != "" {
+		http.Error(w, "h is not accepted, images are rendered in a fixed set of widths", http.StatusBadRequest)
+		return
+	}
+	height := h.config.MaxHeight
+
+	// Caches must keep a rendition per Accept header
+	format := ""
+	if h.negotiate {
+		format = negotiateFormat(r.Header.Get("Accept"))
+		w.Header().Add("Vary", "Accept")
+	}
+
+	key := proxyKey(u.String(), width, height, format)
+	path, err := h.cached(key)
+	if err != nil {
+		http.Error(w, "cache is unreadable", http.StatusInternalServerError)
+		return
+	}
+	if path == "" {
+		if path, err = h.render(r, u, key, width, height, format); err != nil {
+			logger.Error("Failed to proxy image", "url", u.Redacted(), "error", err)
+			if errors.Is(err, errSourceTooLarge) || errors.Is(err, processor.ErrTooManyPixels) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "image could not be fetched or processed", http.StatusBadGateway)
+			return
+		}
+	}
+	h.serveFile(w, r, path)
+}
+
+// proxyDimension parses a requested width, from 1 to limit, or limit when
+// it is not given
+func proxyDimension(value string, limit int) (int, error) {
+	if value == "" {
+		return limit, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > limit {
+		return 0, fmt.Errorf("must be between 1 and %d, got: %s", limit, value)
+	}
+	return n, nil
+}
+
+// requestWidth returns the width to render for r and the client hint it
+// depends on, if any: w in CSS pixels times the DPR hint, or without w the
+// Width hint in device pixels, or else the maximum width. With widths it
+// is rounded up to one of them.
+func (h *proxyHandler) requestWidth(r *http.Request) (int, string, error) {
+	limit := h.config.MaxWidth
+	value := r.URL.Query().Get("w")
+	width, err := proxyDimension(value, limit)
+	if err != nil {
+		return 0, "", err
+	}
+	hint := "Width"
+	if value != "" {
+		hint = "DPR"
+	}
+	if scale := clientHint(r, hint); scale > 0 {
+		if value != "" {
+			scale = float64(width) * min(scale, maxDPR)
+		}
+		width = int(math.Ceil(min(scale, float64(limit))))
+	}
+	width = max(width, 1)
+
+	if len(h.widths) > 0 {
+		i := sort.SearchInts(h.widths, width)
+		width = h.widths[min(i, len(h.widths)-1)]
+	}
+	return width, hint, nil
+}
+
+// clientHint returns the value of the client hint name, sent as
+// Sec-CH-<name> or as the older <name> header, or 0 if it has none
+func clientHint(r *http.Request, name string) float64 {
+	for _, header := range []string{"Sec-CH-" + name, name} {
+		value, err := strconv.ParseFloat(strings.TrimSpace(r.Header.Get(header)), 64)
+		if err == nil && value > 0 && !math.IsInf(value, 0) {
+			return value
+		}
+	}
+	return 0
+}
+
+// negotiateFormat returns the best output format the Accept header accept
+// allows: AVIF, then WebP, then JPEG. Wildcards do not count, browsers
+// send them whatever they can show.
+func negotiateFormat(accept string) string {
+	for _, offer := range negotiatedFormats {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil || mediaType != offer.mediaType {
+				continue
+			}
+			if q, ok := params["q"]; ok {
+				if weight, err := strconv.ParseFloat(q, 64); err != nil || weight <= 0 {
+					continue
+				}
+			}
+			return offer.format
+		}
+	}
+	return "jpg"
+}
+
+// proxyKey names the cached rendition of source at width x height in
+// format, "" for the configured one
+func proxyKey(source string, width, height int, format string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%dx%d\x00%s", source, width, height, format)))
+	return hex.EncodeToString(sum[:])
+}
+
+// cached returns the path of the cached rendition key, or "" if there is
+// none. Its extension is that of the output format.
+func (h *proxyHandler) cached(key string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(h.cacheDir, key[:2], key+".*"))
+	if err != nil || len(matches) == 0 {
+		return "", err
+	}
+	return matches[0], nil
+}
+
+// render fetches and processes u into the cache as rendition key, in
+// format unless it is ""
+func (h *proxyHandler) render(r *http.Request, u *url.URL, key string, width, height int, format string) (string, error) {
+	h.slots <- struct{}{}
+	defer func() { <-h.slots }()
+
+	// Another request may have rendered it meanwhile
+	if path, err := h.cached(key); path != "" || err != nil {
+		return path, err
+	}
+
+	source, err := download(r.Context(), h.client, u, h.limits.download)
+	if err != nil {
+		return "", err
+	}
+	defer source.cleanup()
+
+	// Outputs are written next to the cache, then moved into it whole
+	dir := filepath.Join(h.cacheDir, key[:2])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tempDir, err := os.MkdirTemp(h.cacheDir, "render-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := h.config
+	ext := strings.ToLower(filepath.Ext(source.path))
+	config.KeepFormat = !forceConvert && ext != ".heic" && ext != ".heif"
+	if format != "" {
+		config.OutputFormat, config.KeepFormat = format, false
+	}
+	config.MaxWidth, config.MaxHeight = width, height
+	config.OutputDir = tempDir
+	config.OutputName = key
+	config.MaxPixels = h.limits.sourcePixels
+	result, err := h.process(source.path, config)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, key+filepath.Ext(result.OutputPath))
+	if err := os.Rename(result.OutputPath, path); err != nil {
+		return "", err
+	}
+	h.addToCache(result.OutputSize)
+	logger.Info("Proxied image", "url", u.Redacted(), "width", result.Width, "height", result.Height)
+	return path, nil
+}
+
+// addToCache counts size more bytes in the cache and evicts the oldest
+// renditions once it holds more than cacheLimit
+func (h *proxyHandler) addToCache(size int64) {
+	if h.cacheLimit == 0 {
+		return
+	}
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+	if h.cacheUsed >= 0 {
+		h.cacheUsed += size
+	}
+	if h.cacheUsed >= 0 && h.cacheUsed <= h.cacheLimit {
+		return
+	}
+	used, err := evictCache(h.cacheDir, h.cacheLimit)
+	if err != nil {
+		logger.Warn("Failed to evict proxied images", "dir", h.cacheDir, "error", err)
+		used = -1
+	}
+	h.cacheUsed = used
+}
+
+// evictCache removes the renditions in the cache at dir that were rendered
+// first until it holds at most nine tenths of limit, so that eviction does
+// not run again on the next render, and returns the bytes left. Other
+// files are neither counted nor removed.
+func evictCache(dir string, limit int64) (int64, error) {
+	type rendition struct {
+		path     string
+		size     int64
+		rendered time.Time
+	}
+	var renditions []rendition
+	var used int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if !d.Type().IsRegular() || !isRendition(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		renditions = append(renditions, rendition{path, info.Size(), info.ModTime()})
+		used += info.Size()
+		return nil
+	})
+	if err != nil || used <= limit {
+		return used, err
+	}
+
+	sort.Slice(renditions, func(i, j int) bool { return renditions[i].rendered.Before(renditions[j].rendered) })
+	target := limit - limit/10
+	for _, r := range renditions {
+		if used <= target {
+			break
+		}
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return used, err
+		}
+		used -= r.size
+	}
+	return used, nil
+}
+
+// isRendition reports whether rel, relative to the cache directory, names
+// a rendition: <first two of key>/<key>.<ext> with a proxyKey key
+func isRendition(rel string) bool {
+	dir, name, ok := strings.Cut(filepath.ToSlash(rel), "/")
+	key := strings.TrimSuffix(name, filepath.Ext(name))
+	if !ok || len(key) != sha256.Size*2 || !strings.HasPrefix(key, dir) || len(dir) != 2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// serveFile writes the cached rendition at path
+func (h *proxyHandler) serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "cache is unreadable", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, "cache is unreadable", http.StatusInternalServerError)
+		return
+	}
+	if contentType, ok := contentTypes[filepath.Ext(path)]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(proxyMaxAge.Seconds())))
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
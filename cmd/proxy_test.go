@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestAllowedHost(t *testing.T) {
+	hosts := []string{"images.example.com", "*.cdn.example.net"}
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"images.example.com", true},
+		{"IMAGES.example.com.", true},
+		{"example.com", false},
+		{"evil-images.example.com", false},
+		{"eu.cdn.example.net", true},
+		{"a.b.cdn.example.net", true},
+		{"cdn.example.net", false},
+		{"xcdn.example.net", false},
+	}
+	for _, test := range tests {
+		if got := allowedHost(hosts, test.host); got != test.allowed {
+			t.Errorf("allowedHost(%q) = %v, expected %v", test.host, got, test.allowed)
+		}
+	}
+}
+
+func TestValidateServe(t *testing.T) {
+	defer func() { serveListen, proxyHosts, proxyWidths = "127.0.0.1:8080", nil, nil }()
+	t.Setenv("PICTURE_WEBHOOK_SECRET", "")
+
+	tests := []struct {
+		name     string
+		secret   string
+		hosts    []string
+		listen   string
+		errorMsg string
+	}{
+		{"Webhooks", "secret", nil, "127.0.0.1:8080", ""},
+		{"Proxy only", "", []string{"*.example.com"}, ":8080", ""},
+		{"Nothing to serve", "", nil, ":8080", "serve requires a webhook secret"},
+		{"Host with a path", "secret", []string{"example.com/images"}, ":8080", "proxy host must be a host name"},
+		{"Bare wildcard", "secret", []string{"*"}, ":8080", "proxy host must be a host name"},
+		{"Listen without port", "secret", nil, "localhost", "listen address is invalid"},
+	}
+	for _, test := range tests {
+		t.Setenv("PICTURE_WEBHOOK_SECRET", test.secret)
+		proxyHosts, serveListen = test.hosts, test.listen
+		err := validateServe()
+		if test.errorMsg == "" && err != nil {
+			t.Errorf("%s: validateServe() error = %v, expected nil", test.name, err)
+		}
+		if test.errorMsg != "" && (err == nil || !strings.HasPrefix(err.Error(), test.errorMsg)) {
+			t.Errorf("%s: validateServe() error = %v, expected %q", test.name, err, test.errorMsg)
+		}
+	}
+
+	serveListen, proxyWidths = ":8080", []int{640, maxWidth + 1}
+	if err := validateServe(); err == nil || !strings.HasPrefix(err.Error(), "proxy widths must be between 1 and the maximum width") {
+		t.Errorf("validateServe() of a width above the maximum error = %v", err)
+	}
+	proxyWidths, maxBody = nil, "lots"
+	if err := validateServe(); err == nil || !strings.HasPrefix(err.Error(), "max body must be a size") {
+		t.Errorf("validateServe() of an invalid body size error = %v", err)
+	}
+	maxBody, maxArchive = "1MB", "0"
+	if err := validateServe(); err == nil || !strings.HasPrefix(err.Error(), "max archive must be a size") {
+		t.Errorf("validateServe() of an empty archive size error = %v", err)
+	}
+	maxArchive, proxyCache = "1GB", "big"
+	if err := validateServe(); err == nil || !strings.HasPrefix(err.Error(), "proxy cache size must be a size") {
+		t.Errorf("validateServe() of an invalid cache size error = %v", err)
+	}
+	proxyCache, rateLimit = "1GB", -1
+	if err := validateServe(); err == nil || !strings.HasPrefix(err.Error(), "rate limit must be 0 or more") {
+		t.Errorf("validateServe() of a negative rate limit error = %v", err)
+	}
+	rateLimit = 60
+}
+
+func TestRequestWidth(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		headers map[string]string
+		widths  []int
+		width   int
+		hint    string
+	}{
+		{"Maximum", "", nil, nil, 1000, "Width"},
+		{"Requested", "w=300", nil, nil, 300, "DPR"},
+		{"Scaled by DPR", "w=300", map[string]string{"Sec-CH-DPR": "2.5"}, nil, 750, "DPR"},
+		{"Older DPR header", "w=300", map[string]string{"DPR": "2"}, nil, 600, "DPR"},
+		{"DPR up to 4", "w=100", map[string]string{"Sec-CH-DPR": "10"}, nil, 400, "DPR"},
+		{"Scaled up to the maximum", "w=800", map[string]string{"Sec-CH-DPR": "3"}, nil, 1000, "DPR"},
+		{"Width hint", "", map[string]string{"Sec-CH-Width": "412"}, nil, 412, "Width"},
+		{"Width hint above the maximum", "", map[string]string{"Width": "1e12"}, nil, 1000, "Width"},
+		{"Invalid hint", "", map[string]string{"Sec-CH-Width": "NaN"}, nil, 1000, "Width"},
+		{"Rounded up to a listed width", "w=300", nil, []int{320, 640, 960}, 320, "DPR"},
+		{"Listed width", "w=300", map[string]string{"Sec-CH-DPR": "2"}, []int{320, 640, 960}, 640, "DPR"},
+		{"Largest listed width", "", nil, []int{320, 640, 960}, 960, "Width"},
+	}
+	for _, test := range tests {
+		handler := &proxyHandler{config: processor.Config{MaxWidth: 1000}, widths: test.widths}
+		r := httptest.NewRequest(http.MethodGet, "/proxy?"+test.query, nil)
+		for name, value := range test.headers {
+			r.Header.Set(name, value)
+		}
+		width, hint, err := handler.requestWidth(r)
+		if err != nil {
+			t.Fatalf("%s: requestWidth() error = %v", test.name, err)
+		}
+		if width != test.width || hint != test.hint {
+			t.Errorf("%s: requestWidth() = %d, %q, expected %d, %q", test.name, width, hint, test.width, test.hint)
+		}
+	}
+	handler := &proxyHandler{config: processor.Config{MaxWidth: 1000}}
+	if _, _, err := handler.requestWidth(httptest.NewRequest(http.MethodGet, "/proxy?w=1001", nil)); err == nil {
+		t.Error("requestWidth() of a width above the maximum succeeded")
+	}
+}
+
+func TestProxyHandler(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewNRGBA(image.Rect(0, 0, 400, 200))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/photo.png":
+			fetches.Add(1)
+			w.Write(img.Bytes())
+		case "/away.png":
+			http.Redirect(w, r, "http://localhost:1/photo.png", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer origin.Close()
+	host := strings.Split(strings.TrimPrefix(origin.URL, "http://"), ":")[0]
+
+	config := processor.Config{OutputFormat: "jpg", MaxWidth: 300, MaxHeight: 300, Quality: 90}
+	handler := newProxyHandler([]string{host}, t.TempDir(), config)
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy?"+query, nil))
+		return rec
+	}
+	photo := "url=" + url.QueryEscape(origin.URL+"/photo.png")
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		width  int
+	}{
+		{"Within the maximum size", photo, http.StatusOK, 300},
+		{"Rounded up to the width ladder", photo + "&w=100", http.StatusOK, 160},
+		{"Cached", photo + "&w=150", http.StatusOK, 160},
+		{"Wider than the maximum", photo + "&w=301", http.StatusBadRequest, 0},
+		{"Height", photo + "&w=100&h=50", http.StatusBadRequest, 0},
+		{"Host not allowed", "url=" + url.QueryEscape("http://example.com/photo.png"), http.StatusForbidden, 0},
+		{"Redirect away from the allowlist", "url=" + url.QueryEscape(origin.URL+"/away.png"), http.StatusBadGateway, 0},
+		{"Missing image", "url=" + url.QueryEscape(origin.URL+"/gone.png"), http.StatusBadGateway, 0},
+		{"Not a URL", "url=photo.png", http.StatusBadRequest, 0},
+	}
+	for _, test := range tests {
+		rec := get(test.query)
+		if rec.Code != test.status {
+			t.Errorf("%s: status = %d, expected %d (%s)", test.name, rec.Code, test.status, rec.Body.String())
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != "image/png" {
+			t.Errorf("%s: content type = %q, expected image/png", test.name, contentType)
+		}
+		got, err := png.Decode(rec.Body)
+		if err != nil {
+			t.Fatalf("%s: response is not a PNG: %v", test.name, err)
+		}
+		if got.Bounds().Dx() != test.width {
+			t.Errorf("%s: width = %d, expected %d", test.name, got.Bounds().Dx(), test.width)
+		}
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("origin fetched %d times, expected 2 with the cached rendition reused", n)
+	}
+}
+
+func TestEvictCache(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	write := func(rel string, size int, age int) string {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rendered := start.Add(time.Duration(age) * time.Minute)
+		if err := os.Chtimes(path, rendered, rendered); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	var renditions []string
+	for i, source := range []string{"a", "b", "c", "d"} {
+		key := proxyKey(source, 100, 100, "")
+		renditions = append(renditions, write(filepath.Join(key[:2], key+".jpg"), 100, i))
+	}
+	// Files that are no renditions are left alone, however old
+	other := write("notes.txt", 1000, -10)
+
+	used, err := evictCache(dir, 300)
+	if err != nil {
+		t.Fatalf("evictCache() error = %v", err)
+	}
+	if used != 200 {
+		t.Errorf("evictCache() = %d bytes left, expected 200", used)
+	}
+	for i, path := range append(renditions, other) {
+		_, err := os.Stat(path)
+		if kept := i >= 2; kept != (err == nil) {
+			t.Errorf("%s kept = %v, expected %v", filepath.Base(path), err == nil, kept)
+		}
+	}
+
+	if used, err := evictCache(dir, 1000); err != nil || used != 200 {
+		t.Errorf("evictCache() within the limit = %d, %v, expected 200 bytes untouched", used, err)
+	}
+}
+
+func TestProxyWidthLadder(t *testing.T) {
+	tests := []struct {
+		name   string
+		widths []int
+		limit  int
+		ladder []int
+	}{
+		{"Default", nil, 700, []int{160, 320, 480, 640, 700}},
+		{"Default up to the largest", nil, 5000, append(slices.Clone(defaultProxyWidths), 5000)},
+		{"Listed", []int{960, 320, 640}, 1000, []int{320, 640, 960}},
+		{"Listed beyond the limit", []int{320, 640, 960}, 500, []int{320, 500}},
+	}
+	for _, test := range tests {
+		if ladder := proxyWidthLadder(test.widths, test.limit); !slices.Equal(ladder, test.ladder) {
+			t.Errorf("%s: proxyWidthLadder() = %v, expected %v", test.name, ladder, test.ladder)
+		}
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		format string
+	}{
+		{"image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", "avif"},
+		{"image/webp,*/*", "webp"},
+		{"image/avif;q=0, image/webp;q=0.9", "webp"},
+		{"image/png,image/*;q=0.8,*/*;q=0.5", "jpg"},
+		{"*/*", "jpg"},
+		{"", "jpg"},
+	}
+	for _, test := range tests {
+		if got := negotiateFormat(test.accept); got != test.format {
+			t.Errorf("negotiateFormat(%q) = %q, expected %q", test.accept, got, test.format)
+		}
+	}
+}
+
+func TestProxyNegotiate(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewNRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(img.Bytes()) }))
+	defer origin.Close()
+	host := strings.Split(strings.TrimPrefix(origin.URL, "http://"), ":")[0]
+
+	config := processor.Config{OutputFormat: "png", MaxWidth: 300, MaxHeight: 300, Quality: 90}
+	handler := newProxyHandler([]string{host}, t.TempDir(), config)
+	handler.negotiate = true
+	target := "/proxy?url=" + url.QueryEscape(origin.URL+"/photo.png")
+
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"image/webp,*/*", "image/webp"},
+		{"image/webp;q=0,*/*", "image/jpeg"},
+		// A rendition of its own, not the WebP one
+		{"", "image/jpeg"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", test.accept)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Accept %q: status = %d (%s)", test.accept, rec.Code, rec.Body.String())
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Errorf("Accept %q: content type = %q, expected %q", test.accept, contentType, test.contentType)
+		}
+		if vary := rec.Header().Values("Vary"); !slices.Contains(vary, "Accept") {
+			t.Errorf("Accept %q: Vary = %q, expected Accept among them", test.accept, vary)
+		}
+	}
+}
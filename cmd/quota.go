@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// resumeFileName is the file in the output directory that records the
+// files left over when a run stops early
+const resumeFileName = ".picture-resize-resume.json"
+
+// quota limits the cumulative output size of the current run; nil means unlimited
+var quota *outputQuota
+
+// outputQuota tracks cumulative output bytes against a limit. All methods
+// are safe on a nil receiver, which behaves as an unlimited quota.
+type outputQuota struct {
+	mu       sync.Mutex
+	limit    int64
+	used     int64
+	full     bool
+	deferred []string
+}
+
+func newOutputQuota(limit int64) *outputQuota {
+	if limit <= 0 {
+		return nil
+	}
+	return &outputQuota{limit: limit}
+}
+
+// exhausted reports whether no further files should be started
+func (q *outputQuota) exhausted() bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.full
+}
+
+// reserve accounts size bytes against the quota. It returns false, and
+// marks the quota as exhausted, if the output does not fit.
+func (q *outputQuota) reserve(size int64) bool {
+	if q == nil {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.used+size > q.limit {
+		q.full = true
+		return false
+	}
+	q.used += size
+	if q.used == q.limit {
+		q.full = true
+	}
+	return true
+}
+
+// deferFile records a file that was left for a later run
+func (q *outputQuota) deferFile(path string) {
+	q.mu.Lock()
+	q.deferred = append(q.deferred, path)
+	q.mu.Unlock()
+}
+
+// deferredFiles returns the files left for a later run in sorted order
+func (q *outputQuota) deferredFiles() []string {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	files := append([]string(nil), q.deferred...)
+	sort.Strings(files)
+	return files
+}
+
+// resumeState is the content of the resume file
+type resumeState struct {
+	KeepFormat bool     `json:"keep_format"`
+	Files      []string `json:"files"`
+}
+
+// loadResumeState reads the resume file from dir. It returns nil when there
+// is nothing to resume.
+func loadResumeState(dir string) (*resumeState, error) {
+	data, err := os.ReadFile(filepath.Join(dir, resumeFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state resumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid resume file: %v", err)
+	}
+	return &state, nil
+}
+
+// saveResumeState writes the resume file to dir, or removes it when there
+// are no files left
+func saveResumeState(dir string, state resumeState) error {
+	path := filepath.Join(dir, resumeFileName)
+	if len(state.Files) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// parseSize parses sizes like "500MB", "15GB", "1.5GiB" or plain bytes.
+// Decimal suffixes use powers of 1000 and binary suffixes powers of 1024.
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+		{"B", 1},
+	}
+
+	value := strings.ToUpper(strings.TrimSpace(s))
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(value, u.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+
+	// ParseFloat also takes inf and nan, which have no size in bytes
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) || n*factor >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return int64(n * factor), nil
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    int64
+		expectError bool
+	}{
+		{"1024", 1024, false},
+		{"500MB", 500_000_000, false},
+		{"15gb", 15_000_000_000, false},
+		{"1.5GiB", 1610612736, false},
+		{"25 MB", 25_000_000, false},
+		{"10K", 10_000, false},
+		{"abc", 0, true},
+		{"-5MB", 0, true},
+		{"inf", 0, true},
+		{"infinity", 0, true},
+		{"NaN", 0, true},
+		{"1e30", 0, true},
+		{"10000000TB", 0, true},
+		{"", 0, true},
+	}
+
+	for _, test := range tests {
+		result, err := parseSize(test.input)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("parseSize(%q) expected error, got %d", test.input, result)
+			}
+			continue
+		}
+		if err != nil || result != test.expected {
+			t.Errorf("parseSize(%q) = %d, %v, expected %d", test.input, result, err, test.expected)
+		}
+	}
+}
+
+func TestOutputQuota(t *testing.T) {
+	var unlimited *outputQuota
+	if unlimited.exhausted() || !unlimited.reserve(1<<40) || unlimited.deferredFiles() != nil {
+		t.Error("nil outputQuota should behave as unlimited")
+	}
+
+	if newOutputQuota(0) != nil {
+		t.Error("newOutputQuota(0) should return an unlimited quota")
+	}
+
+	q := newOutputQuota(100)
+	if !q.reserve(60) {
+		t.Error("reserve(60) of 100 should fit")
+	}
+	if q.exhausted() {
+		t.Error("quota should not be exhausted after 60 of 100")
+	}
+	if q.reserve(50) {
+		t.Error("reserve(50) with 40 left should not fit")
+	}
+	if !q.exhausted() {
+		t.Error("quota should be exhausted after an output did not fit")
+	}
+
+	q.deferFile("b.jpg")
+	q.deferFile("a.jpg")
+	deferred := q.deferredFiles()
+	if len(deferred) != 2 || deferred[0] != "a.jpg" {
+		t.Errorf("deferredFiles() = %v, expected [a.jpg b.jpg]", deferred)
+	}
+}
+
+func TestResumeState(t *testing.T) {
+	tempDir := t.TempDir()
+
+	state, err := loadResumeState(tempDir)
+	if err != nil || state != nil {
+		t.Fatalf("loadResumeState() without file = %v, %v, expected nil, nil", state, err)
+	}
+
+	saved := resumeState{KeepFormat: true, Files: []string{"a.jpg", "b.png"}}
+	if err := saveResumeState(tempDir, saved); err != nil {
+		t.Fatalf("saveResumeState() error = %v", err)
+	}
+
+	state, err = loadResumeState(tempDir)
+	if err != nil {
+		t.Fatalf("loadResumeState() error = %v", err)
+	}
+	if !state.KeepFormat || len(state.Files) != 2 || state.Files[1] != "b.png" {
+		t.Errorf("loadResumeState() = %+v, expected %+v", state, saved)
+	}
+
+	// Saving an empty list removes the file
+	if err := saveResumeState(tempDir, resumeState{}); err != nil {
+		t.Fatalf("saveResumeState() empty error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, resumeFileName)); !os.IsNotExist(err) {
+		t.Error("saveResumeState() with no files should remove the resume file")
+	}
+}
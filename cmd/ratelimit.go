@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRateClients is the number of clients the rate limiter tracks before
+// it forgets some of them
+var maxRateClients = 10000
+
+// rateLimiter passes at most perMinute requests a minute from each client
+// address to next, in bursts of up to perMinute
+type rateLimiter struct {
+	perMinute int
+	next      http.Handler
+	now       func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*rateBucket
+}
+
+// rateBucket holds the requests a client may still make
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter limits the requests to next to perMinute per client
+func newRateLimiter(perMinute int, next http.Handler) *rateLimiter {
+	return &rateLimiter{perMinute: perMinute, next: next, now: time.Now, clients: make(map[string]*rateBucket)}
+}
+
+func (l *rateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The address of the connection, headers are set by the client
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	if wait := l.take(client); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+	l.next.ServeHTTP(w, r)
+}
+
+// take uses up a request of client and returns 0, or how long the client
+// has to wait if it has none left
+func (l *rateLimiter) take(client string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	rate := float64(l.perMinute) / time.Minute.Seconds()
+
+	bucket, ok := l.clients[client]
+	if !ok {
+		if len(l.clients) >= maxRateClients {
+			l.forget(now)
+		}
+		bucket = &rateBucket{tokens: float64(l.perMinute), last: now}
+		l.clients[client] = bucket
+	}
+	bucket.tokens = min(bucket.tokens+now.Sub(bucket.last).Seconds()*rate, float64(l.perMinute))
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return 0
+}
+
+// forget drops the clients idle for a minute, whose buckets are full again.
+// If too few of them are, as under a flood from rotating addresses, the
+// tenth of the clients seen longest ago is dropped as well.
+func (l *rateLimiter) forget(now time.Time) {
+	for client, bucket := range l.clients {
+		if now.Sub(bucket.last) >= time.Minute {
+			delete(l.clients, client)
+		}
+	}
+	if len(l.clients) < maxRateClients {
+		return
+	}
+	clients := make([]string, 0, len(l.clients))
+	for client := range l.clients {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return l.clients[clients[i]].last.Before(l.clients[clients[j]].last) })
+	for _, client := range clients[:len(clients)/10+1] {
+		delete(l.clients, client)
+	}
+}
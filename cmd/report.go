@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// minFilesForSlowDetection is the smallest batch for which a median is meaningful
+const minFilesForSlowDetection = 3
+
+// summarySlowestFiles is the number of slowest files listed in the summary
+const summarySlowestFiles = 5
+
+// fileResult records the outcome of processing one file
+type fileResult struct {
+	processor.Result
+	path     string
+	duration time.Duration
+	err      error
+}
+
+// medianDuration returns the median processing time of successful results,
+// leaving out kept outputs of earlier runs
+func medianDuration(results []fileResult) time.Duration {
+	var durations []time.Duration
+	for _, r := range results {
+		if r.err == nil && !r.Skipped {
+			durations = append(durations, r.duration)
+		}
+	}
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	mid := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return (durations[mid-1] + durations[mid]) / 2
+	}
+	return durations[mid]
+}
+
+// findSlowFiles returns the results whose processing time exceeds factor
+// times the median, slowest first. A factor of 0 disables detection.
+func findSlowFiles(results []fileResult, factor float64) []fileResult {
+	if factor <= 0 || len(results) < minFilesForSlowDetection {
+		return nil
+	}
+
+	median := medianDuration(results)
+	if median <= 0 {
+		return nil
+	}
+	threshold := time.Duration(float64(median) * factor)
+
+	var slow []fileResult
+	for _, r := range results {
+		if r.duration > threshold {
+			slow = append(slow, r)
+		}
+	}
+	sort.Slice(slow, func(i, j int) bool { return slow[i].duration > slow[j].duration })
+	return slow
+}
+
+// printSlowFiles prints the slow files found by findSlowFiles to w
+func printSlowFiles(w io.Writer, slow []fileResult, factor float64) {
+	if len(slow) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "%d file(s) took more than %gx the median processing time:\n", len(slow), factor)
+	for _, r := range slow {
+		fmt.Fprintf(w, "  %s (%s)\n", r.path, r.duration.Round(time.Millisecond))
+	}
+}
+
+// findClippedFiles returns the results whose outputs have more than
+// threshold percent of their pixels clipped to black or white, most
+// clipped first. A threshold of 0 disables detection.
+func findClippedFiles(results []fileResult, threshold float64) []fileResult {
+	if threshold <= 0 {
+		return nil
+	}
+
+	var clipped []fileResult
+	for _, r := range results {
+		if r.err == nil && r.Histogram != nil && clippedPercent(r) > threshold {
+			clipped = append(clipped, r)
+		}
+	}
+	sort.SliceStable(clipped, func(i, j int) bool { return clippedPercent(clipped[i]) > clippedPercent(clipped[j]) })
+	return clipped
+}
+
+// clippedPercent returns the larger of the shadow and highlight clipping
+func clippedPercent(r fileResult) float64 {
+	return 100 * max(r.Histogram.Shadows(), r.Histogram.Highlights())
+}
+
+// printClippedFiles prints the clipped files found by findClippedFiles to w
+func printClippedFiles(w io.Writer, clipped []fileResult, threshold float64) {
+	if len(clipped) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "%d file(s) have more than %g%% of pixels clipped:\n", len(clipped), threshold)
+	for _, r := range clipped {
+		h := r.Histogram
+		fmt.Fprintf(w, "  %s (shadows %.1f%%, highlights %.1f%%, mean %.0f)\n", r.path, 100*h.Shadows(), 100*h.Highlights(), h.Mean())
+	}
+}
+
+// countFailures returns the number of failed results
+func countFailures(results []fileResult) int {
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// runSummary totals a run for the summary printed at its end
+type runSummary struct {
+	succeeded  int
+	failed     int
+	skipped    int
+	inputSize  int64
+	outputSize int64
+	wall       time.Duration
+	slowest    []fileResult
+}
+
+// summarizeRun totals results, the files skipped for a later run and the
+// wall time of the run. Files whose earlier output was kept count as
+// skipped. Sizes only count successfully processed files.
+func summarizeRun(results []fileResult, skipped int, wall time.Duration) runSummary {
+	summary := runSummary{skipped: skipped, wall: wall}
+	var succeeded []fileResult
+	for _, r := range results {
+		if r.err != nil {
+			summary.failed++
+			continue
+		}
+		if r.Skipped {
+			summary.skipped++
+			continue
+		}
+		summary.succeeded++
+		summary.inputSize += r.InputSize
+		summary.outputSize += r.OutputSize
+		succeeded = append(succeeded, r)
+	}
+
+	sort.SliceStable(succeeded, func(i, j int) bool { return succeeded[i].duration > succeeded[j].duration })
+	summary.slowest = succeeded[:min(len(succeeded), summarySlowestFiles)]
+	return summary
+}
+
+// ratio returns the compression ratio, input size per output size
+func (s runSummary) ratio() float64 {
+	if s.outputSize == 0 {
+		return 0
+	}
+	return float64(s.inputSize) / float64(s.outputSize)
+}
+
+// printSummary prints the totals of a run to w
+func printSummary(w io.Writer, s runSummary) {
+	fmt.Fprintln(w, "Summary:")
+	fmt.Fprintf(w, "  Files:      %d succeeded, %d failed, %d skipped\n", s.succeeded, s.failed, s.skipped)
+	saved := groupStats{inputSize: s.inputSize, outputSize: s.outputSize}.savedPercent()
+	fmt.Fprintf(w, "  Size:       %s -> %s (ratio %.2f:1, %.1f%% saved)\n", formatBytes(s.inputSize), formatBytes(s.outputSize), s.ratio(), saved)
+	line := fmt.Sprintf("  Wall time:  %s", s.wall.Round(time.Millisecond))
+	if seconds := s.wall.Seconds(); seconds > 0 {
+		line += fmt.Sprintf(" (%.1f files/s)", float64(s.succeeded+s.failed)/seconds)
+	}
+	fmt.Fprintln(w, line)
+	if len(s.slowest) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "  Slowest:")
+	for _, r := range s.slowest {
+		fmt.Fprintf(w, "    %s (%s)\n", r.path, r.duration.Round(time.Millisecond))
+	}
+}
+
+// groupStats aggregates the results of one group of files
+type groupStats struct {
+	key        string
+	files      int
+	failed     int
+	inputSize  int64
+	outputSize int64
+}
+
+// savedPercent returns how much smaller the outputs are than the inputs
+func (g groupStats) savedPercent() float64 {
+	if g.inputSize == 0 {
+		return 0
+	}
+	return 100 * float64(g.inputSize-g.outputSize) / float64(g.inputSize)
+}
+
+// formatKey groups results by lower-case source file extension
+func formatKey(r fileResult) string {
+	ext := strings.ToLower(filepath.Ext(r.path))
+	if ext == "" {
+		return "(none)"
+	}
+	return ext
+}
+
+// directoryKey groups results by source directory relative to root
+func directoryKey(root string) func(fileResult) string {
+	return func(r fileResult) string {
+		dir := filepath.Dir(r.path)
+		if rel, err := filepath.Rel(root, dir); err == nil {
+			dir = rel
+		}
+		return filepath.ToSlash(dir)
+	}
+}
+
+// groupResults aggregates results by key, ordered by key. Sizes only count
+// successfully processed files.
+func groupResults(results []fileResult, key func(fileResult) string) []groupStats {
+	groups := make(map[string]*groupStats)
+	for _, r := range results {
+		k := key(r)
+		g, ok := groups[k]
+		if !ok {
+			g = &groupStats{key: k}
+			groups[k] = g
+		}
+		g.files++
+		if r.err != nil {
+			g.failed++
+			continue
+		}
+		g.inputSize += r.InputSize
+		g.outputSize += r.OutputSize
+	}
+
+	stats := make([]groupStats, 0, len(groups))
+	for _, g := range groups {
+		stats = append(stats, *g)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].key < stats[j].key })
+	return stats
+}
+
+// printBreakdown prints aggregated statistics under a title to w
+func printBreakdown(w io.Writer, title string, groups []groupStats) {
+	if len(groups) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, g := range groups {
+		line := fmt.Sprintf("  %-20s %5d files  %10s -> %10s (%.1f%% saved)", g.key, g.files, formatBytes(g.inputSize), formatBytes(g.outputSize), g.savedPercent())
+		if g.failed > 0 {
+			line += fmt.Sprintf(", %d failed", g.failed)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// formatBytes renders a byte count in human readable binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// runReadme renders a plain text summary of a run for delivery with the outputs
+func runReadme(results []fileResult, config processor.Config) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Processed with picture-resize-tools %s\n\n", version)
+
+	format := config.OutputFormat
+	if config.KeepFormat {
+		format = "original format"
+	}
+	fmt.Fprintf(&b, "Settings: %s, maximum %dx%d, quality %d\n", format, config.MaxWidth, config.MaxHeight, config.Quality)
+
+	var succeeded []fileResult
+	for _, r := range results {
+		if r.err == nil {
+			succeeded = append(succeeded, r)
+		}
+	}
+	fmt.Fprintf(&b, "Files: %d, total size %s\n", len(succeeded), formatBytes(totalOutputSize(succeeded)))
+	if failed := len(results) - len(succeeded); failed > 0 {
+		fmt.Fprintf(&b, "Failed: %d\n", failed)
+	}
+
+	b.WriteString("\nVerify the files with: sha256sum -c SHA256SUMS\n")
+	return b.String()
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestMedianDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  []fileResult
+		expected time.Duration
+	}{
+		{"Empty", nil, 0},
+		{"Odd count", []fileResult{{duration: 3}, {duration: 1}, {duration: 2}}, 2},
+		{"Even count", []fileResult{{duration: 4}, {duration: 1}, {duration: 2}, {duration: 3}}, 2},
+		{"Failures ignored", []fileResult{{duration: 1}, {duration: 100, err: errors.New("x")}, {duration: 3}}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := medianDuration(test.results); result != test.expected {
+				t.Errorf("medianDuration() = %v, expected %v", result, test.expected)
+			}
+		})
+	}
+}
+
+func TestFindSlowFiles(t *testing.T) {
+	results := []fileResult{
+		{path: "a.jpg", duration: 100 * time.Millisecond},
+		{path: "b.jpg", duration: 110 * time.Millisecond},
+		{path: "c.jpg", duration: 90 * time.Millisecond},
+		{path: "huge.tiff", duration: 2 * time.Second},
+		{path: "big.tiff", duration: time.Second},
+	}
+
+	slow := findSlowFiles(results, 5)
+	if len(slow) != 2 {
+		t.Fatalf("findSlowFiles() = %d files, expected 2", len(slow))
+	}
+	if slow[0].path != "huge.tiff" || slow[1].path != "big.tiff" {
+		t.Errorf("findSlowFiles() = %s, %s, expected huge.tiff, big.tiff", slow[0].path, slow[1].path)
+	}
+
+	if slow := findSlowFiles(results, 0); slow != nil {
+		t.Errorf("findSlowFiles() with factor 0 = %v, expected nil", slow)
+	}
+	if slow := findSlowFiles(results[:2], 5); slow != nil {
+		t.Errorf("findSlowFiles() with too few files = %v, expected nil", slow)
+	}
+}
+
+func TestFindClippedFiles(t *testing.T) {
+	// histogram puts shadows and highlights percent of 100 pixels at the
+	// ends of the range and the rest in the middle
+	histogram := func(shadows, highlights int) *processor.Histogram {
+		h := &processor.Histogram{Pixels: 100}
+		h.Luma[0] = shadows
+		h.Luma[255] = highlights
+		h.Luma[128] = 100 - shadows - highlights
+		return h
+	}
+	results := []fileResult{
+		{path: "fine.jpg", Result: processor.Result{Histogram: histogram(1, 2)}},
+		{path: "dark.jpg", Result: processor.Result{Histogram: histogram(30, 0)}},
+		{path: "blown.jpg", Result: processor.Result{Histogram: histogram(0, 60)}},
+		{path: "failed.jpg", Result: processor.Result{Histogram: histogram(90, 0)}, err: errors.New("failed")},
+		{path: "unmeasured.jpg"},
+	}
+
+	clipped := findClippedFiles(results, 5)
+	if len(clipped) != 2 {
+		t.Fatalf("findClippedFiles() = %d files, expected 2", len(clipped))
+	}
+	if clipped[0].path != "blown.jpg" || clipped[1].path != "dark.jpg" {
+		t.Errorf("findClippedFiles() = %s, %s, expected blown.jpg, dark.jpg", clipped[0].path, clipped[1].path)
+	}
+
+	if clipped := findClippedFiles(results, 0); clipped != nil {
+		t.Errorf("findClippedFiles() with threshold 0 = %v, expected nil", clipped)
+	}
+}
+
+func TestGroupResults(t *testing.T) {
+	results := []fileResult{
+		{path: "/in/a.HEIC", Result: processor.Result{InputSize: 1000, OutputSize: 200}},
+		{path: "/in/album/b.heic", Result: processor.Result{InputSize: 3000, OutputSize: 800}},
+		{path: "/in/album/c.png", Result: processor.Result{InputSize: 500, OutputSize: 400}},
+		{path: "/in/album/d.png", Result: processor.Result{InputSize: 999}, err: errors.New("failed")},
+	}
+
+	byFormat := groupResults(results, formatKey)
+	if len(byFormat) != 2 {
+		t.Fatalf("groupResults(formatKey) = %d groups, expected 2", len(byFormat))
+	}
+	heic := byFormat[0]
+	if heic.key != ".heic" || heic.files != 2 || heic.inputSize != 4000 || heic.outputSize != 1000 {
+		t.Errorf("heic group = %+v, expected 2 files 4000 -> 1000", heic)
+	}
+	if heic.savedPercent() != 75 {
+		t.Errorf("heic savedPercent() = %g, expected 75", heic.savedPercent())
+	}
+	png := byFormat[1]
+	if png.files != 2 || png.failed != 1 || png.inputSize != 500 {
+		t.Errorf("png group = %+v, expected 2 files with 1 failure and 500 input bytes", png)
+	}
+
+	byDir := groupResults(results, directoryKey("/in"))
+	if len(byDir) != 2 || byDir[0].key != "." || byDir[1].key != "album" {
+		t.Errorf("groupResults(directoryKey) = %+v, expected groups . and album", byDir)
+	}
+}
+
+func TestSummarizeRun(t *testing.T) {
+	var results []fileResult
+	for i := 1; i <= 7; i++ {
+		results = append(results, fileResult{
+			path:     fmt.Sprintf("%d.jpg", i),
+			duration: time.Duration(i) * time.Second,
+			Result:   processor.Result{InputSize: 1000, OutputSize: 250},
+		})
+	}
+	results = append(results, fileResult{path: "bad.jpg", duration: time.Hour, Result: processor.Result{InputSize: 999}, err: errors.New("failed")})
+	results = append(results, fileResult{path: "kept.jpg", Result: processor.Result{InputSize: 999, OutputSize: 99, Skipped: true}})
+
+	summary := summarizeRun(results, 3, 4*time.Second)
+	if summary.succeeded != 7 || summary.failed != 1 || summary.skipped != 4 {
+		t.Errorf("summarizeRun() counts = %d/%d/%d, expected 7/1/4", summary.succeeded, summary.failed, summary.skipped)
+	}
+	if summary.inputSize != 7000 || summary.outputSize != 1750 || summary.ratio() != 4 {
+		t.Errorf("summarizeRun() sizes = %d -> %d (ratio %g), expected 7000 -> 1750 (ratio 4)", summary.inputSize, summary.outputSize, summary.ratio())
+	}
+
+	// The slowest successful files, slowest first
+	if len(summary.slowest) != summarySlowestFiles || summary.slowest[0].path != "7.jpg" || summary.slowest[4].path != "3.jpg" {
+		t.Errorf("summarizeRun().slowest = %+v, expected 7.jpg down to 3.jpg", summary.slowest)
+	}
+
+	if empty := summarizeRun(nil, 0, 0); empty.ratio() != 0 || len(empty.slowest) != 0 {
+		t.Errorf("summarizeRun(nil) = %+v, expected an empty summary", empty)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n        int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+	}
+
+	for _, test := range tests {
+		if result := formatBytes(test.n); result != test.expected {
+			t.Errorf("formatBytes(%d) = %s, expected %s", test.n, result, test.expected)
+		}
+	}
+}
+
+func TestRunReadme(t *testing.T) {
+	results := []fileResult{
+		{path: "a.heic", Result: processor.Result{OutputSize: 2048}},
+		{path: "b.heic", err: errors.New("failed")},
+	}
+	config := processor.Config{OutputFormat: "jpg", MaxWidth: 1600, MaxHeight: 1200, Quality: 80}
+
+	readme := runReadme(results, config)
+	for _, expected := range []string{"jpg, maximum 1600x1200, quality 80", "Files: 1, total size 2.0 KiB", "Failed: 1", "sha256sum -c SHA256SUMS"} {
+		if !strings.Contains(readme, expected) {
+			t.Errorf("runReadme() missing %q in:\n%s", expected, readme)
+		}
+	}
+}
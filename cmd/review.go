@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// failuresFileName is the file in the output directory that records failed
+// files and the decisions taken for them during review
+const failuresFileName = ".picture-resize-failures.json"
+
+// Failure statuses
+const (
+	failureFailed  = "failed"
+	failureIgnored = "ignored"
+)
+
+// failuresDocument is the failures file, see schema/failures.v1.json
+type failuresDocument struct {
+	Version  int       `json:"version"`
+	Failures []failure `json:"failures"`
+}
+
+// failure is a file that could not be processed
+type failure struct {
+	File       string `json:"file"`
+	Reason     string `json:"reason"`
+	KeepFormat bool   `json:"keep_format"`
+	Status     string `json:"status"`
+}
+
+var reviewCmd = &cobra.Command{
+	Use:   "review",
+	Short: "Step through files that failed in previous runs",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runReview(cmd.InOrStdin(), cmd.OutOrStdout()); err != nil {
+			logger.Error("Review failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reviewCmd)
+}
+
+// loadFailures reads the failures file from dir
+func loadFailures(dir string) ([]failure, error) {
+	data, err := os.ReadFile(filepath.Join(dir, failuresFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Files of earlier releases are bare arrays
+	version, err := documentVersion(data, "failures file", failuresSchemaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid failures file: %v", err)
+	}
+	if version == 0 {
+		var failures []failure
+		if err := json.Unmarshal(data, &failures); err != nil {
+			return nil, fmt.Errorf("invalid failures file: %v", err)
+		}
+		return failures, nil
+	}
+	var doc failuresDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid failures file: %v", err)
+	}
+	return doc.Failures, nil
+}
+
+// saveFailures writes the failures file to dir, or removes it when empty
+func saveFailures(dir string, failures []failure) error {
+	path := filepath.Join(dir, failuresFileName)
+	if len(failures) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(failuresDocument{Version: failuresSchemaVersion, Failures: failures}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// recordFailures stores the failures of a run. Files that were ignored
+// during an earlier review stay ignored if they fail again.
+func recordFailures(dir string, results []fileResult, keepFormat bool) error {
+	previous, err := loadFailures(dir)
+	if err != nil {
+		return err
+	}
+	ignored := make(map[string]bool)
+	for _, f := range previous {
+		if f.Status == failureIgnored {
+			ignored[f.File] = true
+		}
+	}
+
+	var failures []failure
+	for _, r := range results {
+		if r.err == nil {
+			continue
+		}
+		status := failureFailed
+		if ignored[r.path] {
+			status = failureIgnored
+		}
+		failures = append(failures, failure{File: r.path, Reason: r.err.Error(), KeepFormat: keepFormat, Status: status})
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].File < failures[j].File })
+	return saveFailures(dir, failures)
+}
+
+// runReview steps through the pending failures in the output directory,
+// reading decisions from in. Decisions are saved after every file.
+func runReview(in io.Reader, out io.Writer) error {
+	failures, err := loadFailures(outputDir)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(in)
+	pending := 0
+	for i := 0; i < len(failures); i++ {
+		f := failures[i]
+		if f.Status != failureFailed {
+			continue
+		}
+		pending++
+
+		fmt.Fprintf(out, "\n%s\n  Reason: %s\n", f.File, f.Reason)
+		if info, err := os.Stat(f.File); err == nil {
+			fmt.Fprintf(out, "  Size:   %s, modified %s\n", formatBytes(info.Size()), info.ModTime().Format("2006-01-02 15:04"))
+		} else {
+			fmt.Fprintf(out, "  File is no longer accessible: %v\n", err)
+		}
+
+		for done := false; !done; {
+			answer, eof := prompt(reader, out, "[v]iew, [r]etry, retry with [a]djusted settings, [i]gnore, [s]kip, [q]uit: ")
+			switch answer {
+			case "v":
+				if err := previewFile(out, f.File, detectProtocol(protocolAuto), 256); err != nil {
+					fmt.Fprintf(out, "  Preview failed: %v\n", err)
+				}
+			case "r", "a":
+				config := processor.Config{
+					OutputFormat: outputFormat,
+					MaxWidth:     maxWidth,
+					MaxHeight:    maxHeight,
+					Quality:      quality,
+					OutputDir:    outputDir,
+					KeepFormat:   f.KeepFormat,
+					AutoOrient:   autoOrient,
+					Logger:       logger,
+				}
+				if answer == "a" {
+					config = adjustSettings(reader, out, config)
+				}
+				if _, err := processor.Process(f.File, config); err != nil {
+					fmt.Fprintf(out, "  Still failing: %v\n", err)
+					failures[i].Reason = err.Error()
+					continue
+				}
+				fmt.Fprintln(out, "  Processed successfully")
+				failures = append(failures[:i], failures[i+1:]...)
+				i--
+				done = true
+			case "i":
+				failures[i].Status = failureIgnored
+				done = true
+			case "s":
+				done = true
+			case "q":
+				return saveFailures(outputDir, failures)
+			default:
+				if eof {
+					return saveFailures(outputDir, failures)
+				}
+			}
+		}
+
+		if err := saveFailures(outputDir, failures); err != nil {
+			return err
+		}
+	}
+
+	if pending == 0 {
+		fmt.Fprintln(out, "No failed files to review")
+	}
+	return nil
+}
+
+// adjustSettings asks for a new quality and maximum size, keeping the
+// current values on empty answers
+func adjustSettings(reader *bufio.Reader, out io.Writer, config processor.Config) processor.Config {
+	answer, _ := prompt(reader, out, fmt.Sprintf("  Quality [%d]: ", config.Quality))
+	if q, err := strconv.Atoi(answer); err == nil && q >= 1 && q <= 100 {
+		config.Quality = q
+	}
+
+	answer, _ = prompt(reader, out, fmt.Sprintf("  Maximum size [%dx%d]: ", config.MaxWidth, config.MaxHeight))
+	if w, h, ok := strings.Cut(answer, "x"); ok {
+		width, errW := strconv.Atoi(w)
+		height, errH := strconv.Atoi(h)
+		if errW == nil && errH == nil && width > 0 && height > 0 {
+			config.MaxWidth, config.MaxHeight = width, height
+		}
+	}
+	return config
+}
+
+// prompt prints a question and returns the trimmed, lower-case answer and
+// whether the input is exhausted
+func prompt(reader *bufio.Reader, out io.Writer, question string) (string, bool) {
+	fmt.Fprint(out, question)
+	line, err := reader.ReadString('\n')
+	return strings.ToLower(strings.TrimSpace(line)), err != nil
+}
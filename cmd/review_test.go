@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestRecordFailures(t *testing.T) {
+	tempDir := t.TempDir()
+
+	results := []fileResult{
+		{path: "b.jpg", err: errors.New("decode error")},
+		{path: "a.jpg", err: errors.New("truncated")},
+		{path: "ok.jpg"},
+	}
+	if err := recordFailures(tempDir, results, true); err != nil {
+		t.Fatalf("recordFailures() error = %v", err)
+	}
+
+	failures, err := loadFailures(tempDir)
+	if err != nil {
+		t.Fatalf("loadFailures() error = %v", err)
+	}
+	if len(failures) != 2 || failures[0].File != "a.jpg" || failures[0].Reason != "truncated" || !failures[0].KeepFormat {
+		t.Fatalf("loadFailures() = %+v, expected a.jpg and b.jpg", failures)
+	}
+
+	// An ignored file stays ignored when it fails again
+	failures[0].Status = failureIgnored
+	if err := saveFailures(tempDir, failures); err != nil {
+		t.Fatalf("saveFailures() error = %v", err)
+	}
+	if err := recordFailures(tempDir, results[:2], true); err != nil {
+		t.Fatalf("recordFailures() error = %v", err)
+	}
+	failures, _ = loadFailures(tempDir)
+	if failures[0].Status != failureIgnored || failures[1].Status != failureFailed {
+		t.Errorf("statuses = %s, %s, expected ignored, failed", failures[0].Status, failures[1].Status)
+	}
+
+	// A clean run removes the file
+	if err := recordFailures(tempDir, results[2:], true); err != nil {
+		t.Fatalf("recordFailures() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, failuresFileName)); !os.IsNotExist(err) {
+		t.Error("recordFailures() without failures should remove the file")
+	}
+}
+
+func TestLoadFailuresLegacy(t *testing.T) {
+	tempDir := t.TempDir()
+	legacy := `[{"file": "a.jpg", "reason": "truncated", "keep_format": true, "status": "failed"}]`
+	if err := os.WriteFile(filepath.Join(tempDir, failuresFileName), []byte(legacy), 0644); err != nil {
+		t.Fatalf("Failed to create failures file: %v", err)
+	}
+
+	failures, err := loadFailures(tempDir)
+	if err != nil {
+		t.Fatalf("loadFailures() error = %v", err)
+	}
+	if len(failures) != 1 || failures[0].File != "a.jpg" || failures[0].Status != failureFailed {
+		t.Fatalf("loadFailures() = %+v", failures)
+	}
+
+	// Saving writes the current version
+	if err := saveFailures(tempDir, failures); err != nil {
+		t.Fatalf("saveFailures() error = %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(tempDir, failuresFileName))
+	if !strings.HasPrefix(string(data), "{\n  \"version\": 1,") {
+		t.Errorf("saved failures file = %s", data)
+	}
+}
+
+func TestRunReview(t *testing.T) {
+	tempDir := t.TempDir()
+	oldOutput, oldFormat, oldWidth, oldHeight, oldQuality := outputDir, outputFormat, maxWidth, maxHeight, quality
+	defer func() {
+		outputDir, outputFormat, maxWidth, maxHeight, quality = oldOutput, oldFormat, oldWidth, oldHeight, oldQuality
+	}()
+	outputDir = filepath.Join(tempDir, "out")
+	outputFormat, maxWidth, maxHeight, quality = "jpg", 100, 100, 90
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	// A file that now decodes, and one that still does not
+	fixed := filepath.Join(tempDir, "fixed.png")
+	if err := imaging.Save(image.NewRGBA(image.Rect(0, 0, 200, 100)), fixed); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+	broken := filepath.Join(tempDir, "broken.jpg")
+	if err := os.WriteFile(broken, []byte("not an image"), 0644); err != nil {
+		t.Fatalf("Failed to create broken file: %v", err)
+	}
+	failures := []failure{
+		{File: broken, Reason: "decode error", Status: failureFailed},
+		{File: fixed, Reason: "decode error", Status: failureFailed},
+	}
+	if err := saveFailures(outputDir, failures); err != nil {
+		t.Fatalf("saveFailures() error = %v", err)
+	}
+
+	// Retry the broken file, then ignore it; retry the fixed one with a smaller size
+	input := strings.NewReader("r\ni\na\n75\n50x50\n")
+	var out bytes.Buffer
+	if err := runReview(input, &out); err != nil {
+		t.Fatalf("runReview() error = %v", err)
+	}
+
+	if !strings.Contains(out.String(), "Still failing") || !strings.Contains(out.String(), "Processed successfully") {
+		t.Errorf("runReview() output missing retry results:\n%s", out.String())
+	}
+
+	remaining, _ := loadFailures(outputDir)
+	if len(remaining) != 1 || remaining[0].File != broken || remaining[0].Status != failureIgnored {
+		t.Errorf("remaining failures = %+v, expected broken.jpg ignored", remaining)
+	}
+
+	img, err := imaging.Open(filepath.Join(outputDir, "fixed.jpg"))
+	if err != nil {
+		t.Fatalf("Failed to open retried output: %v", err)
+	}
+	if img.Bounds().Dx() != 50 {
+		t.Errorf("retried output width = %d, expected 50", img.Bounds().Dx())
+	}
+}
@@ -1,25 +1,116 @@
 package cmd
 
 import (
+	"runtime"
+	"strings"
+
 	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
 )
 
 var (
-	inputDir     string
-	outputDir    string
-	outputFormat string
-	maxWidth     int
-	maxHeight    int
-	quality      int
-	recursive    bool
-	workers      int
+	inputDir        string
+	outputDir       string
+	outputFormat    string
+	maxWidth        int
+	maxHeight       int
+	quality         int
+	recursive       bool
+	workers         int
+	deterministic   bool
+	verbose         bool
+	quiet           bool
+	progressMode    string
+	slowFactor      float64
+	maxOutputSize   string
+	resume          bool
+	presetName      string
+	attachLimit     string
+	forceConvert    bool
+	zipOutput       string
+	zipLayout       string
+	zipManifest     bool
+	zipRecipient    []string
+	zipPassEnv      string
+	anonymize       bool
+	anonymizeMap    string
+	stampCSV        string
+	manifestPath    string
+	adaptiveWorkers bool
+	minWorkers      int
+	batteryWorkers  int
+	pauseOnBattery  bool
+	maxTemperature  float64
+	checkpointSize  int
+	chmodMode       string
+	chownOwner      string
+	speed           int
+	effort          int
+	resizeMode      string
+	padColor        string
+	gravity         string
+	assumeProfile   string
+	pageMode        string
+	whiteBalance    string
+	exposureLevel   int
+	clipThreshold   float64
+	pdfDPI          int
+	processingLog   bool
+	htmlReport      string
+	htmlReportPage  int
+	jsonOutput      bool
+	cameraPreset    []string
+	shiftTime       string
+	setTimezone     string
+	splitEvents     string
+	flatten         bool
+	keepStructure   bool
+	onCollision     string
+	nameTemplate    string
+	safeNames       string
+	skipExisting    bool
+	overwrite       bool
+	ifNewer         bool
+	contrast        float64
+	watermark       string
+	watermarkPos    string
+	watermarkScale  float64
+	watermarkMargin float64
+	watermarkAlpha  float64
+	watermarkText   string
+	watermarkFont   string
+	watermarkSize   float64
+	watermarkColor  string
+	grayscale       bool
+	ditherMethod    string
+	grayLevels      int
+	mipmaps         string
+	colorTag        string
+	linearResize    bool
+	preserveAttrs   bool
+	autoOrient      bool
+	keepEXIF        bool
+	keepCatalog     bool
+	stripGPS        bool
+	setArtist       string
+	setCopyright    string
+	copySidecars    bool
+	splitSpreads    bool
+	deskew          bool
+	stripMetadata   bool
+	document        string
+	logLevel        string
+	logFormat       string
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "picture-resize-tools",
 	Short: "Batch image format conversion and resize tool",
-	Long: `Supports batch conversion of JPG/PNG/BMP/TIFF formats, export to JPG/PNG format,
+	Long: `Supports batch conversion of JPG/PNG/BMP/TIFF/HEIC/WebP/AVIF/GIF formats, export to
+JPG/PNG/AVIF/HEIC/GIF/WebP/TIFF format (and JPEG XL in builds with the jxl tag),
 intelligent resize maintains aspect ratio, maximum side resize to specified resolution`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return setupLogging(cmd) },
 }
 
 func Execute() error {
@@ -29,10 +120,94 @@ func Execute() error {
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&inputDir, "input", "i", ".", "Input directory path")
 	rootCmd.PersistentFlags().StringVarP(&outputDir, "output", "o", "./output", "Output directory path")
-	rootCmd.PersistentFlags().StringVarP(&outputFormat, "format", "f", "jpg", "Output format (jpg, png)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "format", "f", "jpg", "Output format ("+strings.Join(processor.OutputFormats(), ", ")+")")
 	rootCmd.PersistentFlags().IntVarP(&maxWidth, "width", "W", 1920, "Maximum width")
 	rootCmd.PersistentFlags().IntVarP(&maxHeight, "height", "H", 1920, "Maximum height")
+	rootCmd.PersistentFlags().StringVar(&resizeMode, "mode", "fit", "Resize mode: fit within the maximum size, fill it by cropping around the focal point, carve (experimental) to its aspect ratio by removing the least noticeable seams, stretch to exactly that size, or pad to it with --pad-color around the fitted image")
+	rootCmd.PersistentFlags().StringVar(&padColor, "pad-color", "#ffffff", "Color of the padding of --mode pad as #rrggbb")
+	rootCmd.PersistentFlags().BoolVar(&autoOrient, "auto-orient", true, "Turn photos upright by their EXIF orientation; --auto-orient=false keeps the stored pixels")
+	rootCmd.PersistentFlags().BoolVar(&linearResize, "linear-resize", false, "Resize in linear light instead of on sRGB values, keeping fine patterns from darkening or showing moiré (slower)")
+	rootCmd.PersistentFlags().StringVar(&gravity, "gravity", "center", "Fill crop anchor without a focal point (top, bottom, left, right, center, smart)")
+	rootCmd.PersistentFlags().StringVar(&pageMode, "pages", "first", "Pages of multi-page TIFFs to process: first, or all into numbered outputs (one multi-page file when writing TIFF)")
+	rootCmd.PersistentFlags().IntVar(&pdfDPI, "pdf-dpi", 0, "Render the pages of PDF inputs at this DPI and process them as doc_p001.jpg, ... (0 skips PDFs, needs pdftoppm)")
+	rootCmd.PersistentFlags().StringVar(&whiteBalance, "white-balance", "", "Neutral reference for white balance: auto (gray world), x,y or x,y,width,height in source pixels")
+	rootCmd.PersistentFlags().IntVar(&exposureLevel, "exposure-level", 0, "Gray level (1-255) the white balance reference is brought to, 0 keeps the exposure")
+	rootCmd.PersistentFlags().StringVar(&document, "document", "", "Turn phone photos of paper into scans: find the page, straighten it and even out the lighting, then bw (black on white), gray or color (sharpened)")
+	rootCmd.PersistentFlags().BoolVar(&splitSpreads, "split-spreads", false, "Split scans of two-page spreads at their gutter into name_p001 (left) and name_p002 (right) before any other step")
+	rootCmd.PersistentFlags().BoolVar(&deskew, "deskew", false, "Straighten scans whose lines of text are skewed by up to 15 degrees, keeping their size; the angle is reported per file")
+	rootCmd.PersistentFlags().StringVar(&colorTag, "color-tag", processor.ColorTagSRGB, "Mark PNG and WebP outputs with sRGB pixels as sRGB without embedding a full profile: srgb (sRGB, gAMA and cHRM chunks, a compact profile for WebP), cicp (also a cICP chunk) or none")
+	rootCmd.PersistentFlags().StringVar(&assumeProfile, "assume-profile", "", "Color profile of images without one, converted to sRGB: srgb, adobergb, displayp3, prophoto or an ICC file")
+	rootCmd.PersistentFlags().StringVar(&watermark, "watermark", "", "Image, usually a PNG logo with transparency, composited onto every output after resizing")
+	rootCmd.PersistentFlags().StringVar(&watermarkPos, "watermark-position", "bottom-right", "Watermark anchor ("+strings.Join(processor.WatermarkPositions(), ", ")+")")
+	rootCmd.PersistentFlags().Float64Var(&watermarkScale, "watermark-scale", 20, "Watermark width as a percentage of the output width, 0 for its own size")
+	rootCmd.PersistentFlags().Float64Var(&watermarkMargin, "watermark-margin", 2, "Watermark distance to the edges as a percentage of the shorter side of the output")
+	rootCmd.PersistentFlags().Float64Var(&watermarkAlpha, "watermark-opacity", 100, "Watermark opacity in percent, on top of its own transparency")
+	rootCmd.PersistentFlags().StringVar(&watermarkText, "watermark-text", "", "Text composited onto every output after resizing, {year}, {date} and {name} are replaced for each input")
+	rootCmd.PersistentFlags().StringVar(&watermarkFont, "watermark-font", "", "TrueType or OpenType font of the watermark text (default Go Medium)")
+	rootCmd.PersistentFlags().Float64Var(&watermarkSize, "watermark-size", 4, "Watermark text height as a percentage of the shorter side of the output")
+	rootCmd.PersistentFlags().StringVar(&watermarkColor, "watermark-color", "#ffffff", "Watermark text color as #rrggbb")
+	rootCmd.PersistentFlags().Float64Var(&contrast, "contrast", 0, "Raise (positive) or lower (negative) the contrast by this percentage, from -100 to 100")
+	rootCmd.PersistentFlags().BoolVar(&grayscale, "grayscale", false, "Convert outputs to shades of gray, transparent areas become white")
+	rootCmd.PersistentFlags().StringVar(&ditherMethod, "dither", "", "Reduce outputs to --gray-levels shades of gray for e-ink screens: "+strings.Join(processor.Dithers(), " or ")+" (line art)")
+	rootCmd.PersistentFlags().IntVar(&grayLevels, "gray-levels", 16, "Shades of gray --dither reduces to, from 2 to 256")
+	rootCmd.PersistentFlags().StringVar(&mipmaps, "mipmaps", "", "Write a power-of-two mipmap chain per texture: images (name_mip0.png, ...), or one uncompressed "+processor.MipmapDDS+" or "+processor.MipmapKTX2+" file")
 	rootCmd.PersistentFlags().IntVarP(&quality, "quality", "q", 90, "Output quality (1-100)")
+	rootCmd.PersistentFlags().IntVar(&speed, "speed", 0, "AVIF encoder speed from 1 (slowest, smallest) to 9 (fastest), 0 keeps the encoder default")
+	rootCmd.PersistentFlags().IntVar(&effort, "effort", 0, "JPEG XL encoder effort from 1 (fastest) to 10 (slowest, smallest), 0 keeps the encoder default")
 	rootCmd.PersistentFlags().BoolVarP(&recursive, "recursive", "r", false, "Recursively process subdirectories")
-	rootCmd.PersistentFlags().IntVarP(&workers, "workers", "w", 4, "Number of concurrent workers")
+	rootCmd.PersistentFlags().IntVarP(&workers, "workers", "w", runtime.NumCPU(), "Number of concurrent workers, by default the number of CPUs")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Lowest level of logged messages: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logFormatText, "Format of the logs on standard error: text or json")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show per-worker progress, per-file timing with decode/encode details and files that take long to process (debug logs)")
+	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "Only log errors, without progress or summary, e.g. for cron jobs")
+	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "Write a JSON line per file and one with the summary to standard output, other messages go to standard error")
+	rootCmd.PersistentFlags().StringVar(&progressMode, "progress", progressModeAuto, "Progress output: bar (processed/total, throughput, ETA), lines (one per file) or auto (bar on terminals unless --verbose)")
+	rootCmd.PersistentFlags().Float64Var(&slowFactor, "slow-factor", 5, "Report files taking longer than this multiple of the median time (0 disables)")
+	rootCmd.PersistentFlags().StringVar(&htmlReport, "html-report", "", "Write an HTML report with before/after thumbnails, sizes and SSIM per file to this file")
+	rootCmd.PersistentFlags().IntVar(&htmlReportPage, "html-report-page-size", 50, "Files per page of --html-report, later pages are numbered report-2.html, ...")
+	rootCmd.PersistentFlags().Float64Var(&clipThreshold, "clip-threshold", 5, "Report outputs with more than this percentage of pixels clipped to black or white (0 disables)")
+	rootCmd.PersistentFlags().StringVar(&maxOutputSize, "max-output-size", "", "Stop once outputs reach this total size, e.g. 15GB (remaining files are recorded for --resume)")
+	rootCmd.PersistentFlags().BoolVar(&resume, "resume", false, "Process only the files left over by a previous run that hit --max-output-size")
+	rootCmd.PersistentFlags().StringVar(&presetName, "preset", "", "Use a built-in preset ("+strings.Join(presetNames(), ", ")+")")
+	rootCmd.PersistentFlags().StringArrayVar(&cameraPreset, "camera-preset", nil, "Apply a preset to the files of a camera by EXIF model as MODEL=PRESET, e.g. 'iPhone 15*=email' (may be repeated, the first match wins)")
+	rootCmd.PersistentFlags().StringVar(&shiftTime, "shift-time", "", "Shift EXIF capture times by this duration, e.g. +8h or -1h30m, for cameras with a wrong clock")
+	rootCmd.PersistentFlags().StringVar(&setTimezone, "set-timezone", "", "Time zone the camera clock was set to, as an offset (+08:00) or zone name (Asia/Shanghai)")
+	rootCmd.PersistentFlags().StringVar(&splitEvents, "split-events", "", "Group outputs into event folders named by date range, starting a new event after a capture time gap longer than this, e.g. 4h")
+	rootCmd.PersistentFlags().BoolVar(&flatten, "flatten", false, "Prefix outputs with their relative directory (vacation_day1_IMG01.jpg) so a recursive tree fits into one folder")
+	rootCmd.PersistentFlags().BoolVar(&keepStructure, "preserve-structure", false, "Recreate the subdirectories of the input under the output directory, so same-named files in different folders do not overwrite each other")
+	rootCmd.PersistentFlags().StringVar(&onCollision, "on-collision", collisionSuffix, "Naming of outputs that would replace another output of the run, such as x.png and x.heic both becoming x.jpg: suffix (x_1.jpg), hash (x_1a2b3c4d.jpg), path (a_x.jpg after the relative directory) or overwrite")
+	rootCmd.PersistentFlags().StringVar(&nameTemplate, "name-template", "", "Name outputs after a template such as holiday_{counter:04}_{width}x{height}.jpg with {name}, {ext}, {width}, {height}, {date}, {counter} and {parent}; numbers are padded as in {counter:04}")
+	rootCmd.PersistentFlags().StringVar(&safeNames, "safe-names", "", "Sanitize output names for devices: ascii, or 8.3 (at most 8 characters, converts all images)")
+	rootCmd.PersistentFlags().BoolVar(&skipExisting, "skip-existing", false, "Keep outputs left by an earlier run without reading their inputs")
+	rootCmd.PersistentFlags().BoolVar(&ifNewer, "if-newer", false, "Keep outputs left by an earlier run unless their input was modified after them")
+	rootCmd.PersistentFlags().BoolVar(&overwrite, "overwrite", false, "Replace outputs left by an earlier run without warning")
+	rootCmd.PersistentFlags().StringVar(&attachLimit, "limit-attachment", "", "Lower the quality until all outputs together fit this size, e.g. 25MB")
+	rootCmd.PersistentFlags().StringVar(&zipOutput, "zip-output", "", "Also write the processed images into this zip file")
+	rootCmd.PersistentFlags().StringVar(&zipLayout, "zip-layout", "flat", "Layout inside the zip: flat, or tree to keep source subdirectories")
+	rootCmd.PersistentFlags().BoolVar(&zipManifest, "zip-manifest", false, "Add SHA256SUMS and a README summary of the run to the zip")
+	rootCmd.PersistentFlags().StringSliceVar(&zipRecipient, "zip-recipient", nil, "Encrypt the zip with age to this public key (age1...), may be repeated")
+	rootCmd.PersistentFlags().StringVar(&zipPassEnv, "zip-passphrase-env", "", "Encrypt the zip with age using the passphrase in this environment variable")
+	rootCmd.PersistentFlags().BoolVar(&keepEXIF, "keep-exif", false, "Copy the EXIF data of JPEG and HEIC/AVIF inputs (capture time, camera, lens, GPS location) into JPEG outputs; by default it is dropped")
+	rootCmd.PersistentFlags().BoolVar(&keepCatalog, "keep-catalog", true, "Carry the title, description, keywords and rating of XMP and IPTC metadata into JPEG, PNG, GIF, WebP and TIFF outputs; --keep-catalog=false drops them")
+	rootCmd.PersistentFlags().BoolVar(&stripGPS, "strip-gps", false, "With --keep-exif, remove the location (GPS) tags of the EXIF data, reporting the tags scrubbed from each file")
+	rootCmd.PersistentFlags().StringVar(&setArtist, "set-artist", "", "Write this artist (photographer) into the EXIF data of JPEG, PNG, WebP and TIFF outputs")
+	rootCmd.PersistentFlags().StringVar(&setCopyright, "set-copyright", "", "Write this copyright notice into the EXIF data of JPEG, PNG, WebP and TIFF outputs, e.g. \"© 2026 Jane Doe\"")
+	rootCmd.PersistentFlags().BoolVar(&copySidecars, "copy-sidecars", false, "Copy the .xmp, .aae and Google Takeout .json sidecars of inputs next to their outputs, renamed after them")
+	rootCmd.PersistentFlags().BoolVar(&stripMetadata, "strip-metadata", false, "Guarantee outputs carry no EXIF, XMP, IPTC, ICC or color tag data, e.g. for the public web; each output is checked after writing")
+	rootCmd.PersistentFlags().BoolVar(&processingLog, "processing-log", false, "Record the applied operations and tool version in the XMP metadata of each output (not AVIF/HEIC/JXL)")
+	rootCmd.PersistentFlags().BoolVar(&anonymize, "anonymize", false, "Name outputs by opaque IDs; outputs never carry metadata")
+	rootCmd.PersistentFlags().StringVar(&anonymizeMap, "anonymize-map", "", "Private CSV file mapping opaque IDs to original paths")
+	rootCmd.PersistentFlags().StringVar(&stampCSV, "stamp-csv", "", "CSV of filename,text[,...] rows; the text is burned into the matching images")
+	rootCmd.PersistentFlags().StringVar(&manifestPath, "manifest", "", "CSV or JSON file with per-file overrides (crop, size, quality, output name)")
+	rootCmd.PersistentFlags().BoolVar(&adaptiveWorkers, "adaptive-workers", false, "Scale workers between --min-workers and --workers based on CPU load, memory and I/O wait (Linux)")
+	rootCmd.PersistentFlags().IntVar(&minWorkers, "min-workers", 1, "Lower bound for --adaptive-workers")
+	rootCmd.PersistentFlags().IntVar(&batteryWorkers, "battery-workers", 0, "Limit workers to this number while running on battery (0 disables)")
+	rootCmd.PersistentFlags().BoolVar(&pauseOnBattery, "pause-on-battery", false, "Pause while running on battery")
+	rootCmd.PersistentFlags().Float64Var(&maxTemperature, "max-temperature", 0, "Drop to one worker when the CPU is hotter than this many degrees Celsius or throttled (0 disables)")
+	rootCmd.PersistentFlags().IntVar(&checkpointSize, "checkpoint", 0, "Flush and verify outputs every N files and record a checkpoint for --resume (0 disables)")
+	rootCmd.PersistentFlags().StringVar(&chmodMode, "chmod", "", "Permission mode for outputs, e.g. 0644")
+	rootCmd.PersistentFlags().BoolVar(&preserveAttrs, "preserve-attrs", false, "Give outputs the modification and access times and the permission bits of their input (--chmod and --shift-time take precedence)")
+	rootCmd.PersistentFlags().StringVar(&chownOwner, "chown", "", "Owner of outputs as user:group, user or :group (requires permission to change ownership)")
+	rootCmd.PersistentFlags().StringVar(&controlSocket, "control-socket", "", "Unix domain socket for controlling a run (status, pause, resume, reload, drain)")
+	rootCmd.PersistentFlags().BoolVar(&deterministic, "deterministic", false, "Produce byte-identical outputs with fixed timestamps (honors SOURCE_DATE_EPOCH)")
 }
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// Values of --safe-names
+const (
+	safeNamesASCII = "ascii"
+	safeNames83    = "8.3"
+)
+
+// shortNameLength is the length of 8.3 names without extension
+const shortNameLength = 8
+
+// outputNames maps input paths to sanitized output names; nil keeps the
+// names
+var outputNames map[string]string
+
+// validateSafeNames checks the --safe-names mode against the output
+// format: 8.3 names need a three letter extension
+func validateSafeNames(mode, format string) error {
+	switch mode {
+	case "", safeNamesASCII:
+		return nil
+	case safeNames83:
+		if format != "jpg" && format != "png" && format != "gif" {
+			return fmt.Errorf("8.3 names need the jpg, png or gif format, got: %s", format)
+		}
+		return nil
+	}
+	return fmt.Errorf("safe names must be %s or %s, got: %s", safeNamesASCII, safeNames83, mode)
+}
+
+// asciiName replaces accented letters by their base letter and every other
+// character outside A-Z, a-z, 0-9, '-', '_' and '.' by '_'
+func asciiName(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Accents decomposed from their letter
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.'):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "image"
+	}
+	return b.String()
+}
+
+// shortName returns the first eight characters of the ASCII name without
+// dots, as required for 8.3 names
+func shortName(name string) string {
+	name = strings.ReplaceAll(asciiName(name), ".", "")
+	if name == "" {
+		name = "image"
+	}
+	return name[:min(len(name), shortNameLength)]
+}
+
+// planSafeNames names the outputs of files under root in mode. Files are
+// named in sorted order, and names that clash, ignoring case, are
+// numbered: name_2, ... for ASCII names and NAME~1, ... for 8.3 names.
+// With flat the names carry their relative directory, like --flatten.
+func planSafeNames(files []string, root, mode string, flat bool) map[string]string {
+	sorted := append([]string(nil), files...)
+	sort.Strings(sorted)
+
+	names := make(map[string]string, len(files))
+	used := make(map[string]bool)
+	for _, path := range sorted {
+		base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if flat {
+			base = flatName(root, path)
+		}
+
+		ascii, short := asciiName(base), shortName(base)
+		name := ascii
+		if mode == safeNames83 {
+			name = short
+		}
+		for n := 1; used[strings.ToLower(name)]; n++ {
+			if mode == safeNames83 {
+				suffix := fmt.Sprintf("~%d", n)
+				name = short[:min(len(short), shortNameLength-len(suffix))] + suffix
+			} else {
+				name = fmt.Sprintf("%s_%d", ascii, n+1)
+			}
+		}
+		used[strings.ToLower(name)] = true
+		names[path] = name
+	}
+	return names
+}
+
+// safeNameProcessor wraps process to name the output of each file as
+// planned by planSafeNames
+func safeNameProcessor(names map[string]string, process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		if name, ok := names[path]; ok {
+			config.OutputName = name
+		}
+		return process(path, config)
+	}
+}
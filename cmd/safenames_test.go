@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAsciiName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"IMG_0001", "IMG_0001"},
+		{"Café Zürich", "Cafe_Zurich"},
+		{"北京 2024", "___2024"},
+		{"a.b-c", "a.b-c"},
+		{"", "image"},
+	}
+
+	for _, test := range tests {
+		if got := asciiName(test.name); got != test.expected {
+			t.Errorf("asciiName(%q) = %q, expected %q", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestPlanSafeNames(t *testing.T) {
+	root := "in"
+	files := []string{
+		filepath.Join(root, "Café.jpg"),
+		filepath.Join(root, "Cafe.png"),
+		filepath.Join(root, "holiday photo 1.jpg"),
+		filepath.Join(root, "holiday photo 2.jpg"),
+		filepath.Join(root, "trip", "DSC01.jpg"),
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		flat     bool
+		expected map[string]string
+	}{
+		{
+			name: "ASCII",
+			mode: safeNamesASCII,
+			expected: map[string]string{
+				"Cafe.png":            "Cafe",
+				"Café.jpg":            "Cafe_2",
+				"holiday photo 1.jpg": "holiday_photo_1",
+				"trip/DSC01.jpg":      "DSC01",
+			},
+		},
+		{
+			name: "8.3",
+			mode: safeNames83,
+			expected: map[string]string{
+				"Cafe.png":            "Cafe",
+				"Café.jpg":            "Cafe~1",
+				"holiday photo 1.jpg": "holiday_",
+				"holiday photo 2.jpg": "holida~1",
+				"trip/DSC01.jpg":      "DSC01",
+			},
+		},
+		{
+			name: "8.3 flattened",
+			mode: safeNames83,
+			flat: true,
+			expected: map[string]string{
+				"trip/DSC01.jpg": "trip_DSC",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := planSafeNames(files, root, test.mode, test.flat)
+			for file, expected := range test.expected {
+				if got := names[filepath.Join(root, filepath.FromSlash(file))]; got != expected {
+					t.Errorf("name of %s = %q, expected %q", file, got, expected)
+				}
+			}
+		})
+	}
+}
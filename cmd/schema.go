@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Schema versions of the JSON files read and written, published in
+// schema/<kind>.v<version>.json. Files from before versioning are bare
+// arrays and read as version 0.
+const (
+	manifestSchemaVersion = 1
+	failuresSchemaVersion = 1
+)
+
+// schemaVersions lists the current schema version of each file kind
+func schemaVersions() map[string]int {
+	return map[string]int{
+		"manifest": manifestSchemaVersion,
+		"failures": failuresSchemaVersion,
+	}
+}
+
+// documentVersion returns the schema version of the JSON document data of
+// kind: 0 for the bare arrays of earlier releases, otherwise its version
+// field, which must be one this release knows
+func documentVersion(data []byte, kind string, latest int) (int, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return 0, nil
+	}
+	var header struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+	if header.Version == nil {
+		return 0, fmt.Errorf("%s has no version", kind)
+	}
+	if *header.Version < 1 || *header.Version > latest {
+		return 0, fmt.Errorf("%s version %d is not supported, this release reads up to version %d", kind, *header.Version, latest)
+	}
+	return *header.Version, nil
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDocumentVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr string
+	}{
+		{"Bare array", ` [{"file": "a.jpg"}]`, 0, ""},
+		{"Current", `{"version": 1, "files": []}`, 1, ""},
+		{"No version", `{"files": []}`, 0, "manifest has no version"},
+		{"Zero version", `{"version": 0}`, 0, "manifest version 0 is not supported"},
+		{"Newer version", `{"version": 2}`, 0, "manifest version 2 is not supported, this release reads up to version 1"},
+		{"Invalid JSON", `{`, 0, "unexpected end of JSON input"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := documentVersion([]byte(test.data), "manifest", 1)
+			if test.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+					t.Fatalf("documentVersion() error = %v, expected %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("documentVersion() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("documentVersion() = %d, expected %d", got, test.want)
+			}
+		})
+	}
+}
+
+// TestSchemaFiles checks that the published schemas describe the fields the
+// documents are written with
+func TestSchemaFiles(t *testing.T) {
+	tests := []struct {
+		kind     string
+		version  int
+		document any
+	}{
+		{"manifest", manifestSchemaVersion, manifestDocument{}},
+		{"failures", failuresSchemaVersion, failuresDocument{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			path := filepath.Join("..", "schema", fmt.Sprintf("%s.v%d.json", test.kind, test.version))
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read schema: %v", err)
+			}
+			var schema map[string]any
+			if err := json.Unmarshal(data, &schema); err != nil {
+				t.Fatalf("Invalid schema %s: %v", path, err)
+			}
+
+			version := schema["properties"].(map[string]any)["version"].(map[string]any)["const"]
+			if version != float64(test.version) {
+				t.Errorf("schema version = %v, expected %d", version, test.version)
+			}
+			checkSchemaProperties(t, test.kind, schema, reflect.TypeOf(test.document))
+		})
+	}
+}
+
+// checkSchemaProperties compares the properties of the object schema with
+// the JSON fields of typ, descending into nested structs and slices
+func checkSchemaProperties(t *testing.T, path string, schema map[string]any, typ reflect.Type) {
+	t.Helper()
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+		if items, ok := schema["items"].(map[string]any); ok {
+			schema = items
+		}
+	}
+	if typ.Kind() != reflect.Struct {
+		return
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	fields := map[string]bool{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = true
+		property, ok := properties[name].(map[string]any)
+		if !ok {
+			t.Errorf("%s.%s is missing from the schema", path, name)
+			continue
+		}
+		checkSchemaProperties(t, path+"."+name, property, field.Type)
+	}
+	for name := range properties {
+		if !fields[name] {
+			t.Errorf("%s.%s in the schema is not a field", path, name)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// latestReleaseURL is the GitHub API endpoint of the latest release
+var latestReleaseURL = "https://api.github.com/repos/fengz63/picture-process-tools/releases/latest"
+
+// releaseChecksums is the asset listing the SHA-256 of the other assets of
+// a release, in sha256sum format, and the version of the release on a
+// line of its own, see signedVersion
+const releaseChecksums = "SHA256SUMS"
+
+// releaseSignature is the asset holding the raw 64-byte Ed25519 signature
+// of releaseChecksums, made with the key of releaseKey
+const releaseSignature = "SHA256SUMS.sig"
+
+// releaseKey is the base64 Ed25519 public key releases are signed with. It
+// is set when release binaries are built, with
+// -ldflags "-X picture-resize-tools/cmd.releaseKey=...", so that whoever can
+// replace the assets of a release cannot sign them too.
+var releaseKey = ""
+
+// maxReleaseAsset bounds the download of a release asset
+const maxReleaseAsset = 256 << 20
+
+var updateCheck bool
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Replace this binary with the latest release",
+	Long: `Looks up the latest release on GitHub and, if it is newer than this binary, downloads
+the binary for this system, verifies it against the SHA256SUMS of the release, whose
+signature is checked with the release key built into this binary and whose version
+must match the release, and replaces the running executable with it. Development builds are never replaced.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		exe, err := os.Executable()
+		if err == nil {
+			exe, err = filepath.EvalSymlinks(exe)
+		}
+		if err == nil {
+			err = runSelfUpdate(version, exe, updateCheck, cmd.OutOrStdout())
+		}
+		if err != nil {
+			logger.Error("Failed to update", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	selfUpdateCmd.Flags().BoolVar(&updateCheck, "check", false, "Only report whether a newer release is available")
+	rootCmd.AddCommand(selfUpdateCmd)
+}
+
+// githubRelease is the part of a GitHub release the update needs
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the download URL of the asset called name
+func (r githubRelease) assetURL(name string) (string, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL, nil
+		}
+	}
+	return "", fmt.Errorf("release %s has no asset %s", r.TagName, name)
+}
+
+// releaseAsset returns the name of the release binary for this system
+func releaseAsset() string {
+	name := fmt.Sprintf("picture-resize-tools_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// runSelfUpdate replaces the executable at exe, built as version current,
+// with the latest release if it is newer, or only reports it with check
+func runSelfUpdate(current, exe string, check bool, out io.Writer) error {
+	if _, err := parseVersion(current); err != nil {
+		return fmt.Errorf("development build %s cannot be updated, install a release", current)
+	}
+	client := &http.Client{Timeout: 5 * time.Minute}
+	var release githubRelease
+	data, err := fetchAsset(client, latestReleaseURL)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &release); err != nil {
+		return fmt.Errorf("release is not readable: %v", err)
+	}
+	newer, err := newerVersion(current, release.TagName)
+	if err != nil {
+		return err
+	}
+	if !newer {
+		fmt.Fprintf(out, "picture-resize-tools %s is up to date\n", current)
+		return nil
+	}
+	if check {
+		fmt.Fprintf(out, "picture-resize-tools %s is available, this is %s\n", release.TagName, current)
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(releaseKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("build %s has no release key to verify updates with, install a release", current)
+	}
+	name := releaseAsset()
+	sumsURL, err := release.assetURL(releaseChecksums)
+	if err != nil {
+		return err
+	}
+	signatureURL, err := release.assetURL(releaseSignature)
+	if err != nil {
+		return err
+	}
+	binaryURL, err := release.assetURL(name)
+	if err != nil {
+		return err
+	}
+	sums, err := fetchAsset(client, sumsURL)
+	if err != nil {
+		return err
+	}
+	signature, err := fetchAsset(client, signatureURL)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), sums, signature) {
+		return fmt.Errorf("%s of release %s is not signed with the release key", releaseChecksums, release.TagName)
+	}
+	// The tag is not signed, an old release under a new tag would be a
+	// downgrade
+	signed, err := signedVersion(sums)
+	if err != nil {
+		return err
+	}
+	s, _ := parseVersion(signed)
+	if tag, _ := parseVersion(release.TagName); s != tag {
+		return fmt.Errorf("%s of release %s is signed for version %s", releaseChecksums, release.TagName, signed)
+	}
+	expected, err := checksumFor(sums, name)
+	if err != nil {
+		return err
+	}
+	binary, err := fetchAsset(client, binaryURL)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(binary); hex.EncodeToString(sum[:]) != expected {
+		return fmt.Errorf("%s of release %s does not match its SHA256SUMS", name, release.TagName)
+	}
+	if err := replaceExecutable(exe, binary); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Updated %s from %s to %s\n", exe, current, release.TagName)
+	return nil
+}
+
+// fetchAsset downloads url, at most maxReleaseAsset bytes of it
+func fetchAsset(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxReleaseAsset+1))
+	if err == nil && len(data) > maxReleaseAsset {
+		err = fmt.Errorf("%s is larger than %s", url, formatBytes(maxReleaseAsset))
+	}
+	return data, err
+}
+
+// checksumFor returns the hex SHA-256 of the file called name in sums, in
+// sha256sum format
+func checksumFor(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		sum, file, ok := strings.Cut(scanner.Text(), "  ")
+		// A * marks files hashed in binary mode
+		if ok && strings.TrimPrefix(file, "*") == name && len(sum) == sha256.Size*2 {
+			return strings.ToLower(sum), nil
+		}
+	}
+	return "", fmt.Errorf("%s lists no checksum of %s", releaseChecksums, name)
+}
+
+// signedVersion returns the release version in sums, given on a line
+// "version v1.2.3"
+func signedVersion(sums []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "version "); ok {
+			if _, err := parseVersion(v); err != nil {
+				return "", err
+			}
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("%s names no version", releaseChecksums)
+}
+
+// parseVersion parses a release version such as v1.2.3 or 1.2
+func parseVersion(v string) ([3]int, error) {
+	var parts [3]int
+	fields := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(fields) > 3 {
+		return parts, fmt.Errorf("version must be like v1.2.3, got: %s", v)
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, fmt.Errorf("version must be like v1.2.3, got: %s", v)
+		}
+		parts[i] = n
+	}
+	return parts, nil
+}
+
+// newerVersion reports whether the release version latest is newer than
+// current
+func newerVersion(current, latest string) (bool, error) {
+	c, err := parseVersion(current)
+	if err != nil {
+		return false, err
+	}
+	l, err := parseVersion(latest)
+	if err != nil {
+		return false, err
+	}
+	for i := range c {
+		if l[i] != c[i] {
+			return l[i] > c[i], nil
+		}
+	}
+	return false, nil
+}
+
+// replaceExecutable writes binary next to the executable at path and
+// renames it over it. The running executable is moved aside first, which
+// Windows requires, and removed where the system allows it.
+func replaceExecutable(path string, binary []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), ".picture-resize-tools-update-")
+	if err != nil {
+		return fmt.Errorf("cannot write next to %s, run the update with the rights to replace it: %v", path, err)
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(binary); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+
+	old := path + ".old"
+	os.Remove(old)
+	if err := os.Rename(path, old); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		// Put the running executable back
+		os.Rename(old, path)
+		return err
+	}
+	os.Remove(old)
+	return nil
+}
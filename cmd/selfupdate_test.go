@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		current, latest string
+		newer           bool
+		errorMsg        string
+	}{
+		{"v1.2.3", "v1.2.4", true, ""},
+		{"v1.2.3", "v1.10.0", true, ""},
+		{"v1.2.3", "v1.2.3", false, ""},
+		{"v1.2", "v1.2.0", false, ""},
+		{"v2.0.0", "v1.9.9", false, ""},
+		{"dev", "v1.0.0", false, "version must be like v1.2.3"},
+		{"v1.0.0", "nightly", false, "version must be like v1.2.3"},
+	}
+	for _, test := range tests {
+		newer, err := newerVersion(test.current, test.latest)
+		if test.errorMsg != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.errorMsg) {
+				t.Errorf("newerVersion(%q, %q) error = %v, expected %q", test.current, test.latest, err, test.errorMsg)
+			}
+			continue
+		}
+		if err != nil || newer != test.newer {
+			t.Errorf("newerVersion(%q, %q) = %t, %v, expected %t", test.current, test.latest, newer, err, test.newer)
+		}
+	}
+}
+
+func TestChecksumFor(t *testing.T) {
+	sum := strings.Repeat("ab", sha256.Size)
+	sums := []byte(sum + "  picture-resize-tools_linux_amd64\n" + strings.Repeat("cd", sha256.Size) + " *picture-resize-tools_windows_amd64.exe\n")
+	if got, err := checksumFor(sums, "picture-resize-tools_linux_amd64"); err != nil || got != sum {
+		t.Errorf("checksumFor() = %q, %v, expected %q", got, err, sum)
+	}
+	if _, err := checksumFor(sums, "picture-resize-tools_darwin_arm64"); err == nil {
+		t.Error("checksumFor() of an unlisted file succeeded")
+	}
+}
+
+// releaseServer serves a release v1.3.0 with binary and the SHA256SUMS
+// sums signed with signature, and points the update at it
+func releaseServer(t *testing.T, binary, sums, signature []byte) {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			fmt.Fprintf(w, `{"tag_name":"v1.3.0","assets":[{"name":%q,"browser_download_url":%q},{"name":"SHA256SUMS","browser_download_url":%q},{"name":"SHA256SUMS.sig","browser_download_url":%q}]}`,
+				releaseAsset(), server.URL+"/binary", server.URL+"/sums", server.URL+"/sig")
+		case "/binary":
+			w.Write(binary)
+		case "/sums":
+			w.Write(sums)
+		case "/sig":
+			w.Write(signature)
+		}
+	}))
+	t.Cleanup(server.Close)
+	saved := latestReleaseURL
+	t.Cleanup(func() { latestReleaseURL = saved })
+	latestReleaseURL = server.URL + "/latest"
+}
+
+// releaseSigner builds in the key of a new release signer, returning its
+// private key
+func releaseSigner(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	saved := releaseKey
+	t.Cleanup(func() { releaseKey = saved })
+	releaseKey = base64.StdEncoding.EncodeToString(public)
+	return private
+}
+
+func TestRunSelfUpdate(t *testing.T) {
+	binary := []byte("new binary")
+	sum := sha256.Sum256(binary)
+	sums := []byte(fmt.Sprintf("version v1.3.0\n%s  %s\n", hex.EncodeToString(sum[:]), releaseAsset()))
+	signature := ed25519.Sign(releaseSigner(t), sums)
+	releaseServer(t, binary, sums, signature)
+
+	tests := []struct {
+		name     string
+		current  string
+		check    bool
+		binary   string
+		errorMsg string
+	}{
+		{"Development build", "dev", false, "old binary", "development build dev cannot be updated"},
+		{"Up to date", "v1.3.0", false, "old binary", ""},
+		{"Check only", "v1.2.0", true, "old binary", ""},
+		{"Update", "v1.2.0", false, "new binary", ""},
+	}
+	for _, test := range tests {
+		exe := filepath.Join(t.TempDir(), "picture-resize-tools")
+		if err := os.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+			t.Fatalf("Failed to write executable: %v", err)
+		}
+		var out bytes.Buffer
+		err := runSelfUpdate(test.current, exe, test.check, &out)
+		if test.errorMsg == "" && err != nil {
+			t.Errorf("%s: runSelfUpdate() error = %v", test.name, err)
+		}
+		if test.errorMsg != "" && (err == nil || !strings.HasPrefix(err.Error(), test.errorMsg)) {
+			t.Errorf("%s: runSelfUpdate() error = %v, expected %q", test.name, err, test.errorMsg)
+		}
+		if data, _ := os.ReadFile(exe); string(data) != test.binary {
+			t.Errorf("%s: executable = %q, expected %q", test.name, data, test.binary)
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(exe)); len(entries) != 1 {
+			t.Errorf("%s: %d files next to the executable, expected it alone", test.name, len(entries))
+		}
+	}
+}
+
+func TestRunSelfUpdateRejected(t *testing.T) {
+	binary := []byte("new binary")
+	sum := sha256.Sum256(binary)
+	sums := []byte(fmt.Sprintf("version v1.3.0\n%s  %s\n", hex.EncodeToString(sum[:]), releaseAsset()))
+	tampered := []byte(fmt.Sprintf("%s  %s\n", strings.Repeat("00", sha256.Size), releaseAsset()))
+	// A genuinely signed older release replayed under the newer tag
+	replayed := []byte(fmt.Sprintf("version v1.1.0\n%s  %s\n", hex.EncodeToString(sum[:]), releaseAsset()))
+	unversioned := []byte(fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), releaseAsset()))
+
+	_, other, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	key := releaseSigner(t)
+	tests := []struct {
+		name      string
+		binary    []byte
+		sums      []byte
+		signature []byte
+		noKey     bool
+		errorMsg  string
+	}{
+		{"Checksum mismatch", []byte("tampered binary"), sums, ed25519.Sign(key, sums), false, "does not match its SHA256SUMS"},
+		{"Sums signed with another key", binary, sums, ed25519.Sign(other, sums), false, "is not signed with the release key"},
+		{"Sums changed after signing", binary, tampered, ed25519.Sign(key, sums), false, "is not signed with the release key"},
+		{"Older release under a newer tag", binary, replayed, ed25519.Sign(key, replayed), false, "is signed for version v1.1.0"},
+		{"Sums without a version", binary, unversioned, ed25519.Sign(key, unversioned), false, "names no version"},
+		{"Build without a release key", binary, sums, ed25519.Sign(key, sums), true, "has no release key"},
+	}
+	for _, test := range tests {
+		releaseServer(t, test.binary, test.sums, test.signature)
+		if test.noKey {
+			releaseKey = ""
+		}
+		exe := filepath.Join(t.TempDir(), "picture-resize-tools")
+		if err := os.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+			t.Fatalf("Failed to write executable: %v", err)
+		}
+		err := runSelfUpdate("v1.2.0", exe, false, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), test.errorMsg) {
+			t.Errorf("%s: runSelfUpdate() error = %v, expected %q", test.name, err, test.errorMsg)
+		}
+		if data, _ := os.ReadFile(exe); string(data) != "old binary" {
+			t.Errorf("%s: executable = %q, expected it untouched", test.name, data)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+var (
+	sequencePrefix  string
+	sequencePadding int
+	sequenceStart   int
+	sequenceVideo   string
+	sequenceFPS     float64
+)
+
+var sequenceCmd = &cobra.Command{
+	Use:   "sequence",
+	Short: "Convert an image sequence and renumber its frames",
+	Long: `Converts the frames in the input directory in frame number order and names them
+<prefix><number>, e.g. frame_0001.jpg, with the given padding and start index`,
+	Run: func(cmd *cobra.Command, args []string) { runSequence() },
+}
+
+func init() {
+	sequenceCmd.Flags().StringVar(&sequencePrefix, "prefix", "frame_", "File name prefix of the renumbered frames")
+	sequenceCmd.Flags().IntVar(&sequencePadding, "padding", 4, "Number of digits in frame numbers")
+	sequenceCmd.Flags().IntVar(&sequenceStart, "start", 1, "Number of the first frame")
+	sequenceCmd.Flags().StringVar(&sequenceVideo, "video", "", "Assemble the frames into this .mp4 or .webm preview with ffmpeg")
+	sequenceCmd.Flags().Float64Var(&sequenceFPS, "fps", 24, "Frame rate of the --video preview")
+	rootCmd.AddCommand(sequenceCmd)
+}
+
+// validateSequence validates the sequence options
+func validateSequence() error {
+	if sequencePadding < 1 || sequencePadding > 10 {
+		return fmt.Errorf("padding must be between 1 and 10, got: %d", sequencePadding)
+	}
+	if sequenceStart < 0 {
+		return fmt.Errorf("start index must not be negative, got: %d", sequenceStart)
+	}
+	if strings.ContainsAny(sequencePrefix, `/\`) {
+		return fmt.Errorf("prefix must not contain path separators, got: %s", sequencePrefix)
+	}
+	if sequenceVideo != "" {
+		if _, ok := videoCodecs[strings.ToLower(filepath.Ext(sequenceVideo))]; !ok {
+			return fmt.Errorf("video must be an .mp4 or .webm file, got: %s", sequenceVideo)
+		}
+		if outputFormat != "jpg" && outputFormat != "png" {
+			return fmt.Errorf("video requires jpg or png frames, got: %s", outputFormat)
+		}
+		if sequenceFPS <= 0 {
+			return fmt.Errorf("fps must be positive, got: %g", sequenceFPS)
+		}
+	}
+	return nil
+}
+
+func runSequence() {
+	if err := validateInputs(); err != nil {
+		logger.Error("Input validation failed", "error", err)
+		os.Exit(1)
+	}
+	if err := validateSequence(); err != nil {
+		logger.Error("Input validation failed", "error", err)
+		os.Exit(1)
+	}
+
+	// Check for ffmpeg before spending time on the frames
+	var ffmpeg string
+	if sequenceVideo != "" {
+		var err error
+		if ffmpeg, err = exec.LookPath("ffmpeg"); err != nil {
+			logger.Error("ffmpeg not found in PATH, install it to assemble --video previews")
+			os.Exit(1)
+		}
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		logger.Error("Failed to create output directory", "dir", outputDir, "error", err)
+		os.Exit(1)
+	}
+
+	files, err := getImageFiles(inputDir, recursive)
+	if err != nil {
+		logger.Error("Failed to scan image files", "error", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		logger.Info("No image files found", "dir", inputDir)
+		return
+	}
+
+	frames := orderFrames(files)
+	names := frameNames(frames, sequencePrefix, sequencePadding, sequenceStart)
+	logger.Info("Found frames", "frames", len(frames), "first", names[frames[0]], "last", names[frames[len(frames)-1]])
+
+	config := processor.Config{
+		OutputFormat:  outputFormat,
+		MaxWidth:      maxWidth,
+		MaxHeight:     maxHeight,
+		Quality:       quality,
+		Speed:         speed,
+		Effort:        effort,
+		OutputDir:     outputDir,
+		Deterministic: deterministic,
+		Fill:          resizeMode == "fill",
+		Carve:         resizeMode == "carve",
+		Stretch:       resizeMode == "stretch",
+		Pad:           resizeMode == "pad",
+		Gravity:       gravity,
+		AutoOrient:    autoOrient,
+		Logger:        logger,
+	}
+	config.PadColor, _ = parseHexColor(padColor)
+	if whiteBalance != "" {
+		config.WhiteBalance, _ = parseWhiteBalance(whiteBalance, exposureLevel)
+	}
+	if assumeProfile != "" {
+		config.AssumeProfile, _ = processor.OpenColorProfile(assumeProfile)
+	}
+
+	results := processImagesConcurrentlyWithFunc(frames, config, func(path string, config processor.Config) (processor.Result, error) {
+		config.OutputName = names[path]
+		return processor.Process(path, config)
+	})
+
+	if failed := countFailures(results); failed > 0 {
+		logger.Warn("Frames failed, the sequence has gaps", "frames", failed)
+		os.Exit(1)
+	}
+	logger.Info("All frames processed")
+
+	// Hand the frames over to ffmpeg for a preview
+	if sequenceVideo != "" {
+		pattern := framePattern(outputDir, sequencePrefix, sequencePadding, outputFormat)
+		cmd := exec.Command(ffmpeg, ffmpegArgs(pattern, sequenceStart, sequenceFPS, sequenceVideo)...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		logger.Info("Assembling video", "file", sequenceVideo, "fps", sequenceFPS)
+		if err := cmd.Run(); err != nil {
+			logger.Error("ffmpeg failed", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Video written", "file", sequenceVideo)
+	}
+}
+
+// videoCodecs maps preview file extensions to the ffmpeg codec arguments
+var videoCodecs = map[string][]string{
+	".mp4":  {"-c:v", "libx264", "-pix_fmt", "yuv420p"},
+	".webm": {"-c:v", "libvpx-vp9", "-pix_fmt", "yuv420p", "-b:v", "0", "-crf", "32"},
+}
+
+// framePattern returns the printf-style pattern ffmpeg reads the frames with
+func framePattern(dir, prefix string, padding int, format string) string {
+	name := strings.ReplaceAll(prefix, "%", "%%") + fmt.Sprintf("%%0%dd", padding)
+	return filepath.Join(dir, name+"."+format)
+}
+
+// ffmpegArgs returns the ffmpeg arguments that assemble the frames matching
+// pattern, starting at frame start, into output at fps
+func ffmpegArgs(pattern string, start int, fps float64, output string) []string {
+	args := []string{
+		"-y", "-loglevel", "error",
+		"-framerate", strconv.FormatFloat(fps, 'f', -1, 64),
+		"-start_number", strconv.Itoa(start),
+		"-i", pattern,
+		// yuv420p needs even dimensions
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+	}
+	args = append(args, videoCodecs[strings.ToLower(filepath.Ext(output))]...)
+	return append(args, output)
+}
+
+// frameNumber matches the frame number at the end of a file name
+var frameNumber = regexp.MustCompile(`(\d+)$`)
+
+// orderFrames sorts files by the frame number at the end of their names.
+// Files without a number come last, in name order.
+func orderFrames(files []string) []string {
+	type frame struct {
+		path   string
+		number int
+		ok     bool
+	}
+
+	frames := make([]frame, len(files))
+	for i, path := range files {
+		frames[i].path = path
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if m := frameNumber.FindString(name); m != "" {
+			if n, err := strconv.Atoi(m); err == nil {
+				frames[i].number, frames[i].ok = n, true
+			}
+		}
+	}
+
+	sort.SliceStable(frames, func(i, j int) bool {
+		a, b := frames[i], frames[j]
+		if a.ok != b.ok {
+			return a.ok
+		}
+		if a.ok && a.number != b.number {
+			return a.number < b.number
+		}
+		return a.path < b.path
+	})
+
+	ordered := make([]string, len(frames))
+	for i, f := range frames {
+		ordered[i] = f.path
+	}
+	return ordered
+}
+
+// frameNames assigns consecutive frame names to the ordered frames
+func frameNames(frames []string, prefix string, padding, start int) map[string]string {
+	names := make(map[string]string, len(frames))
+	for i, path := range frames {
+		names[path] = fmt.Sprintf("%s%0*d", prefix, padding, start+i)
+	}
+	return names
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrderFrames(t *testing.T) {
+	files := []string{
+		"renders/shot_10.png",
+		"renders/shot_9.png",
+		"renders/cover.png",
+		"renders/shot_100.png",
+		"renders/shot_0001.png",
+	}
+	expected := []string{
+		"renders/shot_0001.png",
+		"renders/shot_9.png",
+		"renders/shot_10.png",
+		"renders/shot_100.png",
+		"renders/cover.png",
+	}
+
+	if ordered := orderFrames(files); !reflect.DeepEqual(ordered, expected) {
+		t.Errorf("orderFrames() = %v, expected %v", ordered, expected)
+	}
+}
+
+func TestFrameNames(t *testing.T) {
+	names := frameNames([]string{"a.exr", "b.exr", "c.exr"}, "frame_", 4, 1001)
+	expected := map[string]string{"a.exr": "frame_1001", "b.exr": "frame_1002", "c.exr": "frame_1003"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("frameNames() = %v, expected %v", names, expected)
+	}
+
+	// Numbers wider than the padding are not truncated
+	if names := frameNames([]string{"a.png"}, "f", 2, 123); names["a.png"] != "f123" {
+		t.Errorf("frameNames() = %v, expected f123", names)
+	}
+}
+
+func TestValidateSequence(t *testing.T) {
+	defer func() {
+		sequencePrefix, sequencePadding, sequenceStart = "frame_", 4, 1
+		sequenceVideo, sequenceFPS, outputFormat = "", 24, "jpg"
+	}()
+
+	tests := []struct {
+		name     string
+		prefix   string
+		padding  int
+		start    int
+		video    string
+		fps      float64
+		format   string
+		errorMsg string
+	}{
+		{"Defaults", "frame_", 4, 1, "", 24, "jpg", ""},
+		{"Zero start", "shot", 6, 0, "", 24, "jpg", ""},
+		{"Zero padding", "frame_", 0, 1, "", 24, "jpg", "padding must be between 1 and 10"},
+		{"Negative start", "frame_", 4, -1, "", 24, "jpg", "start index must not be negative"},
+		{"Prefix with directory", "out/frame_", 4, 1, "", 24, "jpg", "prefix must not contain path separators"},
+		{"WebM preview", "frame_", 4, 1, "review.webm", 12.5, "png", ""},
+		{"Unknown video type", "frame_", 4, 1, "review.gif", 24, "jpg", "video must be an .mp4 or .webm file"},
+		{"AVIF frames", "frame_", 4, 1, "review.mp4", 24, "avif", "video requires jpg or png frames"},
+		{"Zero fps", "frame_", 4, 1, "review.mp4", 0, "jpg", "fps must be positive"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sequencePrefix, sequencePadding, sequenceStart = test.prefix, test.padding, test.start
+			sequenceVideo, sequenceFPS, outputFormat = test.video, test.fps, test.format
+			err := validateSequence()
+			if test.errorMsg == "" {
+				if err != nil {
+					t.Errorf("validateSequence() error = %v, expected nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), test.errorMsg) {
+				t.Errorf("validateSequence() error = %v, expected %q", err, test.errorMsg)
+			}
+		})
+	}
+}
+
+func TestFfmpegArgs(t *testing.T) {
+	pattern := framePattern("out", "shot%1_", 4, "png")
+	if expected := filepath.Join("out", "shot%%1_%04d.png"); pattern != expected {
+		t.Errorf("framePattern() = %s, expected %s", pattern, expected)
+	}
+
+	args := strings.Join(ffmpegArgs(pattern, 1001, 23.976, "review.mp4"), " ")
+	for _, expected := range []string{"-framerate 23.976", "-start_number 1001", "-i " + pattern, "-c:v libx264", "review.mp4"} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("ffmpegArgs() = %q, expected it to contain %q", args, expected)
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package cmd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+var (
+	serveListen string
+	secretEnv   string
+	proxyHosts  []string
+	cacheDir    string
+	negotiate   bool
+	proxyWidths []int
+	rateLimit   int
+	maxBody     string
+	maxArchive  string
+	maxDownload string
+	proxyCache  string
+	maxSourceMP float64
+	maxOutSide  int
+	allowComics bool
+)
+
+// downloadTimeout bounds the download of a source
+const downloadTimeout = 2 * time.Minute
+
+// errSourceTooLarge is returned for sources beyond the limits of serve
+var errSourceTooLarge = errors.New("source is too large")
+
+// signatureHeader carries the HMAC-SHA256 of a webhook request, keyed with
+// the webhook secret, as sha256=<hex>
+const signatureHeader = "X-Signature-256"
+
+// timestampHeader carries the Unix time a webhook request was signed at.
+// The signature covers it, a dot and then the body.
+const timestampHeader = "X-Signature-Timestamp"
+
+// signatureWindow is how far the signing time of a request may be from the
+// time it arrives, so that captured requests cannot be replayed later
+const signatureWindow = 5 * time.Minute
+
+// shutdownTimeout bounds how long serve waits for in-flight requests once
+// it is told to stop
+const shutdownTimeout = 5 * time.Minute
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Process images pushed by webhooks or proxy remote images",
+	Long: `Listens for POST /process requests naming a source image, a path in the input
+directory or an http(s) URL, and optionally a preset. Requests are verified with an
+HMAC-SHA256 signature of their X-Signature-Timestamp header and body, then processed with
+the settings of the command line and stored in a folder of their own in the output
+directory. The response is the result as written by --json.
+
+POST /batch?preset=... takes a zip archive of images, signed the same way, and streams
+back a zip of their outputs, in the folders of the archive, with results.json holding
+the result of each image as written by --json. Nothing is kept in the output directory.
+
+With --proxy-hosts, GET /proxy?url=...&w=... fetches images from those hosts on demand,
+resizes them within w and the maximum height (at most the maximum width) and serves them
+from a cache.
+Without w, the Width client hint picks the width, and w is scaled by the DPR hint.
+Widths are rounded up to those of --proxy-widths, or of a built-in ladder up to the
+maximum width, and h is not accepted. With --negotiate, the format
+follows the Accept header of each request: AVIF, WebP or JPEG.
+
+SIGINT or SIGTERM stops taking requests and lets those in flight finish; a second one
+exits at once.`,
+	Run: func(cmd *cobra.Command, args []string) { runServe() },
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", "127.0.0.1:8080", "Address to listen on")
+	serveCmd.Flags().StringVar(&secretEnv, "secret-env", "PICTURE_WEBHOOK_SECRET", "Environment variable holding the secret webhook signatures are keyed with")
+	serveCmd.Flags().StringSliceVar(&proxyHosts, "proxy-hosts", nil, "Hosts /proxy may fetch images from, such as cdn.example.com or *.example.com for its subdomains (default none, no proxy)")
+	serveCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Directory proxied images are cached in (default proxy-cache in the output directory)")
+	serveCmd.Flags().BoolVar(&negotiate, "negotiate", false, "Serve /proxy images as AVIF or WebP to browsers whose Accept header allows it and as JPEG otherwise, rather than in --format")
+	serveCmd.Flags().IntSliceVar(&proxyWidths, "proxy-widths", nil, "The only widths /proxy renders, such as 320,640,1280: requests get the smallest at least as wide as they ask for (default 160 to 3840 in common screen widths, and the maximum)")
+	serveCmd.Flags().IntVar(&rateLimit, "rate-limit", 60, "Requests a minute each client address may make, in bursts of as many (0 for no limit)")
+	serveCmd.Flags().StringVar(&maxBody, "max-body", "1MB", "Largest webhook request body")
+	serveCmd.Flags().StringVar(&maxArchive, "max-archive", "1GB", "Largest zip archive POSTed to /batch")
+	serveCmd.Flags().StringVar(&maxDownload, "max-download", "256MB", "Largest source image downloaded from a URL")
+	serveCmd.Flags().StringVar(&proxyCache, "proxy-cache-size", "1GB", "Most disk space the /proxy cache may take, the oldest images are removed beyond it")
+	serveCmd.Flags().Float64Var(&maxSourceMP, "max-source-pixels", 100, "Most megapixels a source image, page or archive entry may have, checked before it is decoded (0 for the built-in limit)")
+	serveCmd.Flags().IntVar(&maxOutSide, "max-output-side", 4096, "Longest side of outputs whatever the maximum size or the preset of a request say (0 for no limit)")
+	serveCmd.Flags().BoolVar(&allowComics, "allow-comics", false, "Accept comic archives (.cbz, .cbr) as sources, which unpack to many pages")
+	rootCmd.AddCommand(serveCmd)
+}
+
+// webhookRequest is the JSON body of a POST to /process
+type webhookRequest struct {
+	// Source is a path relative to the input directory or an http(s) URL
+	Source string `json:"source"`
+	Preset string `json:"preset,omitempty"`
+}
+
+// validateServe validates the serve options
+func validateServe() error {
+	if os.Getenv(secretEnv) == "" && len(proxyHosts) == 0 {
+		return fmt.Errorf("serve requires a webhook secret in $%s or --proxy-hosts", secretEnv)
+	}
+	if err := validateProxyHosts(proxyHosts); err != nil {
+		return err
+	}
+	for _, width := range proxyWidths {
+		if width < 1 || width > maxWidth {
+			return fmt.Errorf("proxy widths must be between 1 and the maximum width %d, got: %d", maxWidth, width)
+		}
+	}
+	if rateLimit < 0 {
+		return fmt.Errorf("rate limit must be 0 or more requests a minute, got: %d", rateLimit)
+	}
+	for _, limit := range []struct{ name, value string }{{"max body", maxBody}, {"max archive", maxArchive}, {"max download", maxDownload}, {"proxy cache size", proxyCache}} {
+		if size, err := parseSize(limit.value); err != nil || size < 1 {
+			return fmt.Errorf("%s must be a size such as 1MB, got: %s", limit.name, limit.value)
+		}
+	}
+	if maxSourceMP < 0 || maxOutSide < 0 {
+		return fmt.Errorf("max source pixels and max output side must be 0 or more, got: %g and %d", maxSourceMP, maxOutSide)
+	}
+	if _, _, err := net.SplitHostPort(serveListen); err != nil {
+		return fmt.Errorf("listen address is invalid: %v", err)
+	}
+	return nil
+}
+
+func runServe() {
+	if err := validateInputs(); err != nil {
+		logger.Error("Input validation failed", "error", err)
+		os.Exit(1)
+	}
+	if err := validateServe(); err != nil {
+		logger.Error("Input validation failed", "error", err)
+		os.Exit(1)
+	}
+	applyPreset(presetName)
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		logger.Error("Failed to create output directory", "dir", outputDir, "error", err)
+		os.Exit(1)
+	}
+
+	// Webhooks only with a secret to verify them
+	mux := http.NewServeMux()
+	var endpoints []string
+	if secret := os.Getenv(secretEnv); secret != "" {
+		webhook := newWebhookHandler(inputDir, []byte(secret), processConfig())
+		archiveLimit, _ := parseSize(maxArchive)
+		mux.Handle("/process", webhook)
+		mux.Handle("/batch", newBatchHandler(webhook, archiveLimit))
+		endpoints = append(endpoints, "/process", "/batch")
+	}
+	if len(proxyHosts) > 0 {
+		dir := cacheDir
+		if dir == "" {
+			dir = filepath.Join(outputDir, "proxy-cache")
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			logger.Error("Failed to create cache directory", "dir", dir, "error", err)
+			os.Exit(1)
+		}
+		proxy := newProxyHandler(proxyHosts, dir, processConfig())
+		proxy.negotiate = negotiate
+		proxy.cacheLimit, _ = parseSize(proxyCache)
+		proxy.widths = proxyWidthLadder(proxyWidths, proxy.config.MaxWidth)
+		mux.Handle("/proxy", proxy)
+		endpoints = append(endpoints, "/proxy")
+	}
+	var handler http.Handler = mux
+	if rateLimit > 0 {
+		handler = newRateLimiter(rateLimit, mux)
+	}
+	server := &http.Server{Addr: serveListen, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	logger.Info("Listening", "address", serveListen, "endpoints", strings.Join(endpoints, ", "))
+	stopped := shutdownOnSignal(server)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
+	<-stopped
+}
+
+// shutdownOnSignal shuts server down on the first SIGINT or SIGTERM,
+// letting in-flight requests finish, and exits on the second. The returned
+// channel is closed once the shutdown is done.
+func shutdownOnSignal(server *http.Server) <-chan struct{} {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		sig := <-signals
+		logger.Info("Shutting down, in-flight requests will finish", "reason", fmt.Sprintf("Received %v", sig))
+		go func() {
+			<-signals
+			logger.Warn("Interrupted again, exiting without finishing in-flight requests")
+			os.Exit(130)
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Error("In-flight requests did not finish", "error", err)
+		}
+	}()
+	return stopped
+}
+
+// serveLimits bound what a single request may cost the server
+type serveLimits struct {
+	// body is the largest webhook body and download the largest source
+	// fetched from a URL, in bytes
+	body, download int64
+	// sourcePixels is the most pixels of a source image, page or archive
+	// entry, 0 for the limit of the processor
+	sourcePixels int64
+	// outputSide is the longest side of outputs, 0 for no limit
+	outputSide int
+}
+
+// currentServeLimits returns the limits of the command line
+func currentServeLimits() serveLimits {
+	body, _ := parseSize(maxBody)
+	download, _ := parseSize(maxDownload)
+	return serveLimits{body: body, download: download, sourcePixels: int64(maxSourceMP * 1e6), outputSide: maxOutSide}
+}
+
+// clamp returns config with sources and outputs no larger than allowed.
+// The processor checks the pixels of every page and archive entry.
+func (l serveLimits) clamp(config processor.Config) processor.Config {
+	config.MaxPixels = l.sourcePixels
+	if l.outputSide > 0 {
+		config.MaxWidth, config.MaxHeight = min(config.MaxWidth, l.outputSide), min(config.MaxHeight, l.outputSide)
+	}
+	return config
+}
+
+// webhookHandler processes the sources named by signed webhook requests
+type webhookHandler struct {
+	root    string
+	secret  []byte
+	config  processor.Config
+	process func(string, processor.Config) (processor.Result, error)
+	client  *http.Client
+	limits  serveLimits
+	// slots limits the requests processed at once to --workers
+	slots chan struct{}
+}
+
+// newWebhookHandler returns a handler for sources under root, verified with
+// secret and processed with config
+func newWebhookHandler(root string, secret []byte, config processor.Config) *webhookHandler {
+	return &webhookHandler{
+		root:    root,
+		secret:  secret,
+		config:  config,
+		process: recoverPanics(processor.Process),
+		client:  &http.Client{Timeout: downloadTimeout},
+		limits:  currentServeLimits(),
+		slots:   make(chan struct{}, max(workers, 1)),
+	}
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.limits.body))
+	if err != nil {
+		http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := verifySignature(h.secret, body, r.Header.Get(timestampHeader), r.Header.Get(signatureHeader), time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var req webhookRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.Source == "" {
+		http.Error(w, "body must be a JSON object with a source", http.StatusBadRequest)
+		return
+	}
+	if err := validatePreset(req.Preset); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
+	h.slots <- struct{}{}
+	defer func() { <-h.slots }()
+
+	source, err := h.fetch(r.Context(), req.Source)
+	if err != nil {
+		logger.Error("Failed to fetch pushed source", "source", req.Source, "error", err)
+		status := http.StatusBadRequest
+		if errors.Is(err, errSourceTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer source.cleanup()
+
+	// Each request gets a folder of its own, so that sources of the same
+	// name do not overwrite each other's outputs
+	outDir, err := os.MkdirTemp(h.config.OutputDir, time.Now().Format("20060102-150405-"))
+	if err == nil {
+		err = os.Chmod(outDir, 0755)
+	}
+	if err != nil {
+		logger.Error("Failed to create request directory", "error", err)
+		http.Error(w, "output directory cannot be created", http.StatusInternalServerError)
+		return
+	}
+
+	// A single file keeps its format like a run without HEIC files
+	config := h.config
+	config.OutputDir = outDir
+	ext := strings.ToLower(filepath.Ext(source.path))
+	config.KeepFormat = !forceConvert && ext != ".heic" && ext != ".heif"
+	if p, ok := presets[req.Preset]; ok {
+		config = p.applyConfig(config)
+	}
+	result, err := h.process(source.path, h.limits.clamp(config))
+	if err != nil {
+		// Only removed if the failure left nothing in it
+		os.Remove(outDir)
+	}
+
+	status := http.StatusOK
+	if errors.Is(err, processor.ErrTooManyPixels) {
+		status = http.StatusRequestEntityTooLarge
+		logger.Error("Processing failed", "source", req.Source, "error", err)
+	} else if err != nil {
+		status = http.StatusInternalServerError
+		logger.Error("Processing failed", "source", req.Source, "error", err)
+	} else {
+		logger.Info("Processed pushed image", "source", req.Source, "output", result.OutputPath)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(newJSONFile(fileResult{Result: result, path: req.Source, duration: time.Since(start), err: err}))
+}
+
+// sourceFile is a source ready to be processed, to be cleaned up after
+type sourceFile struct {
+	path    string
+	cleanup func()
+}
+
+// fetch resolves the source of a request: URLs are downloaded into a
+// temporary directory, paths must name an image in the input directory
+func (h *webhookHandler) fetch(ctx context.Context, source string) (sourceFile, error) {
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return download(ctx, h.client, u, h.limits.download)
+	}
+	path, err := sourcePath(h.root, source)
+	return sourceFile{path: path, cleanup: func() {}}, err
+}
+
+// sourcePath returns the path of the image source under root, rejecting
+// paths that lead out of it, also through symbolic links
+func sourcePath(root, source string) (string, error) {
+	if !isInputExtension(filepath.Ext(source)) {
+		return "", fmt.Errorf("source %s is not a supported image", source)
+	}
+	clean := filepath.Clean(filepath.FromSlash(source))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("source %s is outside the input directory", source)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(root, clean))
+	if err != nil {
+		return "", fmt.Errorf("source %s not found", source)
+	}
+	if rel, err := filepath.Rel(realRoot, real); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("source %s is outside the input directory", source)
+	}
+	return real, nil
+}
+
+// download fetches the image at u with client into a temporary directory,
+// keeping its name for the output. Images larger than limit bytes fail
+// with errSourceTooLarge.
+func download(ctx context.Context, client *http.Client, u *url.URL, limit int64) (sourceFile, error) {
+	name := path.Base(u.Path)
+	if !isInputExtension(path.Ext(name)) {
+		return sourceFile{}, fmt.Errorf("source URL %s does not name a supported image", u.Redacted())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return sourceFile{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return sourceFile{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return sourceFile{}, fmt.Errorf("source URL %s returned %s", u.Redacted(), resp.Status)
+	}
+
+	dir, err := os.MkdirTemp("", "picture-resize-serve-")
+	if err != nil {
+		return sourceFile{}, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		cleanup()
+		return sourceFile{}, err
+	}
+	n, err := io.Copy(file, io.LimitReader(resp.Body, limit+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > limit {
+		err = fmt.Errorf("%w: %s is larger than %s", errSourceTooLarge, u.Redacted(), formatBytes(limit))
+	}
+	if err != nil {
+		cleanup()
+		return sourceFile{}, err
+	}
+	return sourceFile{path: file.Name(), cleanup: cleanup}, nil
+}
+
+// isInputExtension reports whether files with extension ext are processed
+// by serve. Comic archives are only with --allow-comics.
+func isInputExtension(ext string) bool {
+	ext = strings.ToLower(ext)
+	if !allowComics && slices.Contains(processor.ComicExtensions(), ext) {
+		return false
+	}
+	for _, e := range processor.InputExtensions() {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// newRequestMAC returns the HMAC-SHA256 keyed with secret of a request
+// signed at timestamp, ready for its body, or an error if timestamp is not
+// a Unix time within signatureWindow of now
+func newRequestMAC(secret []byte, timestamp string, now time.Time) (hash.Hash, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be the Unix time the request was signed at", timestampHeader)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > signatureWindow || age < -signatureWindow {
+		return nil, fmt.Errorf("request was signed more than %v from now", signatureWindow)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	return mac, nil
+}
+
+// verifySignature returns an error unless signature is sha256= followed by
+// the hex HMAC-SHA256 of timestamp, a dot and body keyed with secret,
+// signed within signatureWindow of now
+func verifySignature(secret, body []byte, timestamp, signature string, now time.Time) error {
+	mac, err := newRequestMAC(secret, timestamp, now)
+	if err != nil {
+		return err
+	}
+	mac.Write(body)
+	if !matchesSignature(mac.Sum(nil), signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// matchesSignature reports whether signature is sha256= followed by the
+// hex of sum
+func matchesSignature(sum []byte, signature string) bool {
+	value, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(value)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, sum)
+}
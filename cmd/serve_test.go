@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// sign returns the signature header value of body signed at timestamp
+// with secret
+func sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// signRequest signs req with body and secret now
+func signRequest(req *http.Request, secret, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, sign(secret, timestamp, body))
+}
+
+func TestVerifySignature(t *testing.T) {
+	secret, body := []byte("secret"), []byte(`{"source":"a.jpg"}`)
+	now := time.Unix(1700000000, 0)
+	signed, late, early := "1700000000", "1699999000", "1700000600"
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		valid     bool
+	}{
+		{"Signed with the secret", signed, sign(secret, signed, body), true},
+		{"Signed a minute ago", "1699999940", sign(secret, "1699999940", body), true},
+		{"Signed with another secret", signed, sign([]byte("other"), signed, body), false},
+		{"Signature of another body", signed, sign(secret, signed, []byte("{}")), false},
+		{"Signature of another time", "1699999999", sign(secret, signed, body), false},
+		{"Replayed after the window", late, sign(secret, late, body), false},
+		{"Signed in the future", early, sign(secret, early, body), false},
+		{"Missing timestamp", "", sign(secret, "", body), false},
+		{"Missing prefix", signed, strings.TrimPrefix(sign(secret, signed, body), "sha256="), false},
+		{"Not hex", signed, "sha256=zz", false},
+		{"Missing", signed, "", false},
+	}
+	for _, test := range tests {
+		if err := verifySignature(secret, body, test.timestamp, test.signature, now); (err == nil) != test.valid {
+			t.Errorf("%s: verifySignature() = %v, expected valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestSourcePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for _, path := range []string{filepath.Join(root, "a.jpg"), filepath.Join(outside, "b.jpg")} {
+		if err := os.WriteFile(path, []byte("jpg"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "b.jpg"), filepath.Join(root, "link.jpg")); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		errorMsg string
+	}{
+		{"Image in the input directory", "a.jpg", ""},
+		{"Not an image", "notes.txt", "not a supported image"},
+		{"Comic archive without --allow-comics", "volume1.cbz", "not a supported image"},
+		{"Parent directory", "../b.jpg", "outside the input directory"},
+		{"Absolute path", filepath.Join(outside, "b.jpg"), "outside the input directory"},
+		{"Link out of the input directory", "link.jpg", "outside the input directory"},
+		{"Missing", "c.jpg", "not found"},
+	}
+	for _, test := range tests {
+		_, err := sourcePath(root, test.source)
+		if test.errorMsg == "" && err != nil {
+			t.Errorf("%s: sourcePath() error = %v, expected nil", test.name, err)
+		}
+		if test.errorMsg != "" && (err == nil || !strings.Contains(err.Error(), test.errorMsg)) {
+			t.Errorf("%s: sourcePath() error = %v, expected %q", test.name, err, test.errorMsg)
+		}
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	root, outDir := t.TempDir(), t.TempDir()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewNRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "local.png"), img.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write PNG: %v", err)
+	}
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/remote.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(img.Bytes())
+	}))
+	defer origin.Close()
+
+	secret := []byte("secret")
+	config := processor.Config{OutputFormat: "jpg", MaxWidth: 100, MaxHeight: 100, Quality: 90, OutputDir: outDir}
+	handler := newWebhookHandler(root, secret, config)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		signed bool
+		status int
+		output string
+	}{
+		{"Local path", http.MethodPost, `{"source":"local.png"}`, true, http.StatusOK, "local.png"},
+		{"Local path again", http.MethodPost, `{"source":"local.png"}`, true, http.StatusOK, "local.png"},
+		{"Remote URL with a preset", http.MethodPost, `{"source":"` + origin.URL + `/images/remote.png","preset":"email"}`, true, http.StatusOK, "remote.jpg"},
+		{"Unsigned", http.MethodPost, `{"source":"local.png"}`, false, http.StatusUnauthorized, ""},
+		{"Unknown preset", http.MethodPost, `{"source":"local.png","preset":"poster"}`, true, http.StatusBadRequest, ""},
+		{"Outside the input directory", http.MethodPost, `{"source":"../local.png"}`, true, http.StatusBadRequest, ""},
+		{"Missing remote image", http.MethodPost, `{"source":"` + origin.URL + `/gone.png"}`, true, http.StatusBadRequest, ""},
+		{"Not JSON", http.MethodPost, `source=local.png`, true, http.StatusBadRequest, ""},
+		{"GET", http.MethodGet, ``, true, http.StatusMethodNotAllowed, ""},
+	}
+	outputs := make(map[string]bool)
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/process", strings.NewReader(test.body))
+		if test.signed {
+			signRequest(req, secret, []byte(test.body))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s: status = %d, expected %d (%s)", test.name, rec.Code, test.status, rec.Body.String())
+			continue
+		}
+		if test.output == "" {
+			continue
+		}
+		var file jsonFile
+		if err := json.Unmarshal(rec.Body.Bytes(), &file); err != nil {
+			t.Fatalf("%s: response is not JSON: %v", test.name, err)
+		}
+		// Each request writes into a folder of its own
+		if filepath.Dir(filepath.Dir(file.Output)) != outDir || filepath.Base(file.Output) != test.output || outputs[file.Output] || file.Error != "" {
+			t.Errorf("%s: output = %q error %q, expected a new %s in a folder of %s", test.name, file.Output, file.Error, test.output, outDir)
+		}
+		outputs[file.Output] = true
+		if _, err := os.Stat(file.Output); err != nil {
+			t.Errorf("%s: output not written: %v", test.name, err)
+		}
+	}
+}
+
+func TestServeLimits(t *testing.T) {
+	root, outDir := t.TempDir(), t.TempDir()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewNRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "local.png"), img.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write PNG: %v", err)
+	}
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(img.Bytes()) }))
+	defer origin.Close()
+
+	secret := []byte("secret")
+	config := processor.Config{OutputFormat: "jpg", MaxWidth: 100, MaxHeight: 100, Quality: 90, OutputDir: outDir}
+	generous := serveLimits{body: 1 << 20, download: 1 << 20}
+	local, remote := `{"source":"local.png"}`, `{"source":"`+origin.URL+`/remote.png"}`
+
+	tests := []struct {
+		name   string
+		limits serveLimits
+		body   string
+		status int
+		width  int
+	}{
+		{"Within the limits", generous, local, http.StatusOK, 40},
+		{"Body too large", serveLimits{body: 10, download: 1 << 20}, local, http.StatusRequestEntityTooLarge, 0},
+		{"Download too large", serveLimits{body: 1 << 20, download: 10}, remote, http.StatusRequestEntityTooLarge, 0},
+		{"Too many pixels", serveLimits{body: 1 << 20, download: 1 << 20, sourcePixels: 400}, local, http.StatusRequestEntityTooLarge, 0},
+		{"Output side", serveLimits{body: 1 << 20, download: 1 << 20, outputSide: 10}, local, http.StatusOK, 10},
+	}
+	for _, test := range tests {
+		handler := newWebhookHandler(root, secret, config)
+		handler.limits = test.limits
+		req := httptest.NewRequest(http.MethodPost, "/process", strings.NewReader(test.body))
+		signRequest(req, secret, []byte(test.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s: status = %d, expected %d (%s)", test.name, rec.Code, test.status, rec.Body.String())
+			continue
+		}
+		if test.width == 0 {
+			continue
+		}
+		var file jsonFile
+		if err := json.Unmarshal(rec.Body.Bytes(), &file); err != nil {
+			t.Fatalf("%s: response is not JSON: %v", test.name, err)
+		}
+		if file.Width != test.width {
+			t.Errorf("%s: width = %d, expected %d", test.name, file.Width, test.width)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(2, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	limiter.now = func() time.Time { return now }
+	get := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		limiter.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		addr    string
+		status  int
+	}{
+		{"First of the burst", 0, "192.0.2.1:1000", http.StatusOK},
+		{"Second of the burst, another port", 0, "192.0.2.1:1001", http.StatusOK},
+		{"Burst used up", 0, "192.0.2.1:1002", http.StatusTooManyRequests},
+		{"Another client", 0, "192.0.2.2:1000", http.StatusOK},
+		{"Too early for another", 20 * time.Second, "192.0.2.1:1000", http.StatusTooManyRequests},
+		{"One more after half a minute", 10 * time.Second, "192.0.2.1:1000", http.StatusOK},
+	}
+	for _, test := range tests {
+		now = now.Add(test.advance)
+		rec := get(test.addr)
+		if rec.Code != test.status {
+			t.Errorf("%s: status = %d, expected %d", test.name, rec.Code, test.status)
+		}
+		if test.status == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: no Retry-After", test.name)
+		}
+	}
+}
+
+func TestRateLimiterForget(t *testing.T) {
+	defer func(n int) { maxRateClients = n }(maxRateClients)
+	maxRateClients = 3
+
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(2, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	limiter.now = func() time.Time { return now }
+	for _, client := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		limiter.take(client)
+		now = now.Add(time.Second)
+	}
+
+	// None is idle, the one seen longest ago makes room
+	limiter.take("192.0.2.4")
+	if _, ok := limiter.clients["192.0.2.1"]; ok || len(limiter.clients) != 3 {
+		t.Errorf("clients = %d, expected 3 without the oldest", len(limiter.clients))
+	}
+
+	// Idle clients are dropped first
+	now = now.Add(time.Minute)
+	limiter.take("192.0.2.2")
+	limiter.take("192.0.2.5")
+	if _, ok := limiter.clients["192.0.2.2"]; !ok || len(limiter.clients) != 2 {
+		t.Errorf("clients = %d, expected 2 with the active one kept", len(limiter.clients))
+	}
+}
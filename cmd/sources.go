@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"path/filepath"
+)
+
+// sourceSet holds the inputs of a run by resolved absolute path, so that
+// no output replaces one of them
+type sourceSet map[string]bool
+
+// newSourceSet returns the set of paths
+func newSourceSet(paths []string) sourceSet {
+	set := make(sourceSet, len(paths))
+	for _, path := range paths {
+		set[resolvePath(path)] = true
+	}
+	return set
+}
+
+// contains reports whether path is one of the set, also through relative
+// paths and symbolic links
+func (s sourceSet) contains(path string) bool {
+	return s[resolvePath(path)]
+}
+
+// resolvePath returns path as a clean absolute path with its symbolic
+// links resolved. Paths that do not exist yet resolve their directory.
+func resolvePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs))
+	}
+	return abs
+}
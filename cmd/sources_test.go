@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceSet(t *testing.T) {
+	tempDir := t.TempDir()
+	input := filepath.Join(tempDir, "a.jpg")
+	if err := os.WriteFile(input, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+	link := filepath.Join(tempDir, "link")
+	if err := os.Symlink(tempDir, link); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	sources := newSourceSet([]string{input})
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{input, true},
+		{filepath.Join(tempDir, "sub", "..", "a.jpg"), true},
+		{filepath.Join(link, "a.jpg"), true},
+		{filepath.Join(tempDir, "a.png"), false},
+		{filepath.Join(link, "b.jpg"), false},
+	}
+	for _, test := range tests {
+		if got := sources.contains(test.path); got != test.expected {
+			t.Errorf("contains(%q) = %v, expected %v", test.path, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// stamps maps input file names to burned-in text; nil means no stamping
+var stamps map[string]string
+
+// loadStampCSV reads rows of "filename,text[,more text...]". Additional
+// columns, such as a timestamp, are appended to the text separated by two
+// spaces. File names are matched without their directory.
+func loadStampCSV(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	result := make(map[string]string)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected filename and text", line)
+		}
+		result[filepath.Base(record[0])] = strings.Join(record[1:], "  ")
+	}
+	return result, nil
+}
+
+// stampProcessor returns a processing function that burns in the text
+// mapped to each file
+func stampProcessor(texts map[string]string, process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		if text, ok := texts[filepath.Base(path)]; ok {
+			config.StampText = text
+		}
+		return process(path, config)
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestLoadStampCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stamps.csv")
+	content := "IMG_0001.jpg,CASE-1,2024-05-01 10:22\nsub/IMG_0002.heic,CASE-2\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+
+	texts, err := loadStampCSV(path)
+	if err != nil {
+		t.Fatalf("loadStampCSV() error = %v", err)
+	}
+	if texts["IMG_0001.jpg"] != "CASE-1  2024-05-01 10:22" {
+		t.Errorf("IMG_0001.jpg text = %q, expected 'CASE-1  2024-05-01 10:22'", texts["IMG_0001.jpg"])
+	}
+	if texts["IMG_0002.heic"] != "CASE-2" {
+		t.Errorf("IMG_0002.heic text = %q, expected 'CASE-2'", texts["IMG_0002.heic"])
+	}
+
+	if err := os.WriteFile(path, []byte("only-a-name\n"), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+	if _, err := loadStampCSV(path); err == nil {
+		t.Error("loadStampCSV() with missing text expected error, got nil")
+	}
+}
+
+func TestStampProcessor(t *testing.T) {
+	var seen string
+	process := stampProcessor(map[string]string{"a.jpg": "CASE-1"}, func(path string, config processor.Config) (processor.Result, error) {
+		seen = config.StampText
+		return processor.Result{}, nil
+	})
+
+	process("/in/a.jpg", processor.Config{})
+	if seen != "CASE-1" {
+		t.Errorf("stampProcessor() text for a.jpg = %q, expected CASE-1", seen)
+	}
+	process("/in/b.jpg", processor.Config{})
+	if seen != "" {
+		t.Errorf("stampProcessor() text for b.jpg = %q, expected none", seen)
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// structureDir returns the directory of the input at path relative to
+// root, such as vacation/day1 for vacation/day1/IMG01.jpg, or "" for inputs
+// directly in root. With a --safe-names mode the directory names are
+// sanitized like the file names.
+func structureDir(root, path, names string) string {
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, part := range parts {
+		switch names {
+		case safeNamesASCII:
+			parts[i] = asciiName(part)
+		case safeNames83:
+			parts[i] = shortName(part)
+		}
+	}
+	return filepath.Join(parts...)
+}
+
+// structureProcessor wraps process to write the outputs of files in
+// subdirectories of root into the same subdirectories of the output
+// directory, so that files of the same name in different folders do not
+// replace each other
+func structureProcessor(root, names string, process func(string, processor.Config) (processor.Result, error)) func(string, processor.Config) (processor.Result, error) {
+	return func(path string, config processor.Config) (processor.Result, error) {
+		if dir := structureDir(root, path, names); dir != "" {
+			config.OutputDir = filepath.Join(config.OutputDir, dir)
+			if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+				return processor.Result{InputPath: path}, err
+			}
+		}
+		return process(path, config)
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestStructureDir(t *testing.T) {
+	tests := []struct {
+		path     string
+		names    string
+		expected string
+	}{
+		{"albums/IMG01.jpg", "", ""},
+		{"albums/vacation/IMG01.jpg", "", "vacation"},
+		{"albums/vacation/day1/IMG01.jpg", "", filepath.Join("vacation", "day1")},
+		{"albums/Été à Nice/IMG01.jpg", safeNamesASCII, "Ete_a_Nice"},
+		{"albums/vacation 2024/IMG01.jpg", safeNames83, "vacation"},
+		{"elsewhere/IMG01.jpg", "", ""},
+	}
+
+	for _, test := range tests {
+		if got := structureDir("albums", test.path, test.names); got != test.expected {
+			t.Errorf("structureDir(%q, %q) = %q, expected %q", test.path, test.names, got, test.expected)
+		}
+	}
+}
+
+func TestStructureProcessor(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var outputDirs []string
+	process := structureProcessor("albums", "", func(path string, config processor.Config) (processor.Result, error) {
+		outputDirs = append(outputDirs, config.OutputDir)
+		return processor.Result{InputPath: path}, nil
+	})
+
+	for _, path := range []string{"albums/day1/IMG01.jpg", "albums/IMG01.jpg"} {
+		if _, err := process(path, processor.Config{OutputDir: tempDir}); err != nil {
+			t.Fatalf("process(%s) error = %v", path, err)
+		}
+	}
+	if outputDirs[0] != filepath.Join(tempDir, "day1") || outputDirs[1] != tempDir {
+		t.Errorf("output directories = %v", outputDirs)
+	}
+	if info, err := os.Stat(outputDirs[0]); err != nil || !info.IsDir() {
+		t.Errorf("subdirectory not created: %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+var (
+	pdfOutput   string
+	pdfPageSize string
+	pdfOrder    string
+	pdfMargin   float64
+)
+
+var topdfCmd = &cobra.Command{
+	Use:   "topdf",
+	Short: "Combine the images into a single PDF",
+	Long: `Resizes the images in the input directory and assembles them into one multi-page
+PDF, one image per page, centered on pages of the given size`,
+	Run: func(cmd *cobra.Command, args []string) { runToPDF() },
+}
+
+func init() {
+	topdfCmd.Flags().StringVar(&pdfOutput, "pdf", "", "PDF file to write (default images.pdf in the output directory)")
+	topdfCmd.Flags().StringVar(&pdfPageSize, "page-size", "a4", "Page size: a3, a4, a5, letter, legal, or fit to make each page the size of its image")
+	topdfCmd.Flags().StringVar(&pdfOrder, "order", "name", "Page order: name, number (trailing number in the file name) or date (modification time)")
+	topdfCmd.Flags().Float64Var(&pdfMargin, "margin", 10, "Page margin in millimeters")
+	rootCmd.AddCommand(topdfCmd)
+}
+
+// pdfPageSizes are the page sizes in points, portrait
+var pdfPageSizes = map[string][2]float64{
+	"a3":     {841.89, 1190.55},
+	"a4":     {595.28, 841.89},
+	"a5":     {419.53, 595.28},
+	"letter": {612, 792},
+	"legal":  {612, 1008},
+	"fit":    {0, 0},
+}
+
+// validateToPDF validates the topdf options
+func validateToPDF() error {
+	if _, ok := pdfPageSizes[pdfPageSize]; !ok {
+		return fmt.Errorf("page size must be a3, a4, a5, letter, legal or fit, got: %s", pdfPageSize)
+	}
+	if pdfOrder != "name" && pdfOrder != "number" && pdfOrder != "date" {
+		return fmt.Errorf("order must be name, number or date, got: %s", pdfOrder)
+	}
+	if pdfMargin < 0 || pdfMargin > 100 {
+		return fmt.Errorf("margin must be between 0 and 100 mm, got: %g", pdfMargin)
+	}
+	return nil
+}
+
+func runToPDF() {
+	if err := validateInputs(); err != nil {
+		logger.Error("Input validation failed", "error", err)
+		os.Exit(1)
+	}
+	if err := validateToPDF(); err != nil {
+		logger.Error("Input validation failed", "error", err)
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		logger.Error("Failed to create output directory", "dir", outputDir, "error", err)
+		os.Exit(1)
+	}
+	output := pdfOutput
+	if output == "" {
+		output = filepath.Join(outputDir, "images.pdf")
+	}
+
+	files, err := getImageFiles(inputDir, recursive)
+	if err != nil {
+		logger.Error("Failed to scan image files", "error", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		logger.Info("No image files found", "dir", inputDir)
+		return
+	}
+	files = orderPages(files, pdfOrder)
+
+	// Pages are embedded as JPEG, which PDF can show without re-encoding
+	tempDir, err := os.MkdirTemp("", "picture-resize-topdf-")
+	if err != nil {
+		logger.Error("Failed to create temporary directory", "error", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := processor.Config{
+		OutputFormat: "jpg",
+		MaxWidth:     maxWidth,
+		MaxHeight:    maxHeight,
+		Quality:      quality,
+		OutputDir:    tempDir,
+		Fill:         resizeMode == "fill",
+		Carve:        resizeMode == "carve",
+		Stretch:      resizeMode == "stretch",
+		Pad:          resizeMode == "pad",
+		Gravity:      gravity,
+		AutoOrient:   autoOrient,
+		Document:     document,
+		Deskew:       deskew,
+		Logger:       logger,
+	}
+	config.PadColor, _ = parseHexColor(padColor)
+	names := frameNames(files, "page_", 6, 1)
+
+	logger.Info("Found images, combining them into a PDF", "files", len(files), "file", output)
+	results := processImagesConcurrentlyWithFunc(files, config, func(path string, config processor.Config) (processor.Result, error) {
+		config.OutputName = names[path]
+		return processor.Process(path, config)
+	})
+	if failed := countFailures(results); failed > 0 {
+		logger.Error("Images failed, the PDF was not written", "files", failed)
+		os.Exit(1)
+	}
+
+	// Results arrive in completion order
+	pages := make([]string, len(files))
+	for _, r := range results {
+		for i, path := range files {
+			if path == r.path {
+				pages[i] = r.OutputPath
+			}
+		}
+	}
+
+	size := pdfPageSizes[pdfPageSize]
+	if err := writePDFFile(output, pages, size, pdfMargin*72/25.4); err != nil {
+		logger.Error("Failed to write PDF", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("PDF written", "file", output, "pages", len(pages))
+}
+
+// orderPages orders files by name, trailing number or modification time
+func orderPages(files []string, order string) []string {
+	ordered := append([]string(nil), files...)
+	switch order {
+	case "number":
+		return orderFrames(ordered)
+	case "date":
+		modTimes := make(map[string]int64, len(files))
+		for _, path := range files {
+			if info, err := os.Stat(path); err == nil {
+				modTimes[path] = info.ModTime().UnixNano()
+			}
+		}
+		sort.SliceStable(ordered, func(i, j int) bool {
+			if modTimes[ordered[i]] != modTimes[ordered[j]] {
+				return modTimes[ordered[i]] < modTimes[ordered[j]]
+			}
+			return ordered[i] < ordered[j]
+		})
+	default:
+		sort.Strings(ordered)
+	}
+	return ordered
+}
+
+// pdfLayout places an image of w x h pixels on a page of size points,
+// turned to the image's orientation, within margin. A zero size makes the
+// page fit the image, one point per pixel.
+func pdfLayout(w, h int, size [2]float64, margin float64) (page, rect [4]float64) {
+	if size[0] == 0 {
+		return [4]float64{0, 0, float64(w) + 2*margin, float64(h) + 2*margin}, [4]float64{margin, margin, float64(w), float64(h)}
+	}
+
+	pageW, pageH := size[0], size[1]
+	if w > h {
+		pageW, pageH = pageH, pageW
+	}
+	scale := math.Min((pageW-2*margin)/float64(w), (pageH-2*margin)/float64(h))
+	drawW, drawH := float64(w)*scale, float64(h)*scale
+	return [4]float64{0, 0, pageW, pageH}, [4]float64{(pageW - drawW) / 2, (pageH - drawH) / 2, drawW, drawH}
+}
+
+// writePDFFile writes the JPEG files as the pages of a PDF at path
+func writePDFFile(path string, jpegs []string, size [2]float64, margin float64) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writePDF(file, jpegs, size, margin); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	return file.Close()
+}
+
+// pdfWriter writes numbered PDF objects and remembers their offsets
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int64
+	offsets map[int]int64
+}
+
+func (p *pdfWriter) printf(format string, args ...interface{}) {
+	n, _ := fmt.Fprintf(p.w, format, args...)
+	p.offset += int64(n)
+}
+
+func (p *pdfWriter) write(data []byte) {
+	n, _ := p.w.Write(data)
+	p.offset += int64(n)
+}
+
+// object starts object id
+func (p *pdfWriter) object(id int) {
+	p.offsets[id] = p.offset
+	p.printf("%d 0 obj\n", id)
+}
+
+// writePDF writes a PDF with one JPEG image per page. Objects 1 and 2 are
+// the catalog and page tree, then every page takes three objects: the
+// page, its image and its content stream.
+func writePDF(w io.Writer, jpegs []string, size [2]float64, margin float64) error {
+	p := &pdfWriter{w: bufio.NewWriter(w), offsets: make(map[int]int64)}
+	p.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	p.object(1)
+	p.printf("<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	var kids []string
+	for i, path := range jpegs {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %v", filepath.Base(path), err)
+		}
+		colorSpace := "/DeviceRGB"
+		if cfg.ColorModel == color.GrayModel {
+			colorSpace = "/DeviceGray"
+		}
+
+		page, rect := pdfLayout(cfg.Width, cfg.Height, size, margin)
+		pageID, imageID, contentID := 3+3*i, 4+3*i, 5+3*i
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+
+		p.object(pageID)
+		p.printf("<< /Type /Page /Parent 2 0 R /MediaBox [%s] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>\nendobj\n", pdfNumbers(page[:]), imageID, contentID)
+
+		p.object(imageID)
+		p.printf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n", cfg.Width, cfg.Height, colorSpace, len(data))
+		p.write(data)
+		p.printf("\nendstream\nendobj\n")
+
+		content := fmt.Sprintf("q %s 0 0 %s %s cm /Im0 Do Q", pdfNumber(rect[2]), pdfNumber(rect[3]), pdfNumbers(rect[:2]))
+		p.object(contentID)
+		p.printf("<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content)
+	}
+
+	p.object(2)
+	p.printf("<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(kids))
+
+	// Cross-reference table
+	count := 3 + 3*len(jpegs)
+	xref := p.offset
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", count)
+	for id := 1; id < count; id++ {
+		p.printf("%010d 00000 n \n", p.offsets[id])
+	}
+	p.printf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", count, xref)
+	return p.w.Flush()
+}
+
+// pdfNumber formats a coordinate with at most two decimals
+func pdfNumber(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// pdfNumbers formats coordinates separated by spaces
+func pdfNumbers(values []float64) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = pdfNumber(v)
+	}
+	return strings.Join(parts, " ")
+}
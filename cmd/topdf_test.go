@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateToPDF(t *testing.T) {
+	defer func() { pdfPageSize, pdfOrder, pdfMargin = "a4", "name", 10 }()
+
+	tests := []struct {
+		name     string
+		size     string
+		order    string
+		margin   float64
+		errorMsg string
+	}{
+		{"Defaults", "a4", "name", 10, ""},
+		{"Fit pages by date", "fit", "date", 0, ""},
+		{"Unknown page size", "b5", "name", 10, "page size must be a3, a4, a5, letter, legal or fit"},
+		{"Unknown order", "letter", "size", 10, "order must be name, number or date"},
+		{"Negative margin", "a4", "name", -1, "margin must be between 0 and 100 mm"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pdfPageSize, pdfOrder, pdfMargin = test.size, test.order, test.margin
+			err := validateToPDF()
+			if test.errorMsg == "" {
+				if err != nil {
+					t.Errorf("validateToPDF() error = %v, expected nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), test.errorMsg) {
+				t.Errorf("validateToPDF() error = %v, expected %q", err, test.errorMsg)
+			}
+		})
+	}
+}
+
+func TestOrderPages(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i, name := range []string{"scan_10.jpg", "scan_2.jpg", "cover.jpg"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Date(2024, 1, 3-i, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{"name", []string{"cover.jpg", "scan_10.jpg", "scan_2.jpg"}},
+		{"number", []string{"scan_2.jpg", "scan_10.jpg", "cover.jpg"}},
+		{"date", []string{"cover.jpg", "scan_2.jpg", "scan_10.jpg"}},
+	}
+
+	for _, test := range tests {
+		var names []string
+		for _, path := range orderPages(files, test.order) {
+			names = append(names, filepath.Base(path))
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("orderPages(%s) = %v, expected %v", test.order, names, test.expected)
+		}
+	}
+}
+
+func TestPDFLayout(t *testing.T) {
+	a4 := pdfPageSizes["a4"]
+	tests := []struct {
+		name string
+		w, h int
+		size [2]float64
+		page [4]float64
+		rect [4]float64
+	}{
+		{"Portrait on A4", 100, 200, a4, [4]float64{0, 0, 595.28, 841.89}, [4]float64{87.17, 0, 420.95, 841.89}},
+		{"Landscape turns the page", 400, 100, pdfPageSizes["letter"], [4]float64{0, 0, 792, 612}, [4]float64{0, 207, 792, 198}},
+		{"Fit", 300, 200, pdfPageSizes["fit"], [4]float64{0, 0, 300, 200}, [4]float64{0, 0, 300, 200}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, rect := pdfLayout(test.w, test.h, test.size, 0)
+			if pdfNumbers(page[:]) != pdfNumbers(test.page[:]) {
+				t.Errorf("page = %v, expected %v", page, test.page)
+			}
+			if pdfNumbers(rect[:]) != pdfNumbers(test.rect[:]) {
+				t.Errorf("rect = %v, expected %v", rect, test.rect)
+			}
+		})
+	}
+
+	// Margins shrink the image and keep it centered
+	page, rect := pdfLayout(100, 100, a4, 20)
+	if rect[2] != page[2]-40 || rect[0] != 20 || rect[1] != (page[3]-rect[3])/2 {
+		t.Errorf("rect = %v, expected a centered square within 20pt margins", rect)
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	dir := t.TempDir()
+	var pages []string
+	for i, img := range []image.Image{image.NewRGBA(image.Rect(0, 0, 40, 20)), image.NewGray(image.Rect(0, 0, 10, 30))} {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("page_%d.jpg", i+1))
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, path)
+	}
+
+	var buf bytes.Buffer
+	if err := writePDF(&buf, pages, pdfPageSizes["fit"], 0); err != nil {
+		t.Fatalf("writePDF() error = %v", err)
+	}
+	pdf := buf.String()
+
+	for _, expected := range []string{
+		"%PDF-1.4",
+		"/Type /Pages /Kids [3 0 R 6 0 R] /Count 2",
+		"/MediaBox [0 0 40 20]",
+		"/Width 10 /Height 30 /ColorSpace /DeviceGray",
+		"/ColorSpace /DeviceRGB",
+		"q 40 0 0 20 0 0 cm /Im0 Do Q",
+		"trailer\n<< /Size 9 /Root 1 0 R >>",
+	} {
+		if !strings.Contains(pdf, expected) {
+			t.Errorf("PDF does not contain %q", expected)
+		}
+	}
+
+	// Every xref entry points at its object
+	xref := pdf[strings.LastIndex(pdf, "\nxref\n")+1:]
+	lines := strings.Split(xref, "\n")[3:11]
+	for i, line := range lines {
+		var offset int
+		if _, err := fmt.Sscanf(line, "%d", &offset); err != nil {
+			t.Fatal(err)
+		}
+		if prefix := strconv.Itoa(i+1) + " 0 obj"; !strings.HasPrefix(pdf[offset:], prefix) {
+			t.Errorf("xref entry %d points at %q, expected %q", i+1, pdf[offset:offset+8], prefix)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// version is set at build time with -ldflags "-X picture-resize-tools/cmd.version=v1.2.3"
+var version = "dev"
+
+var versionJSON bool
+
+// versionInfo describes the build and the capabilities of this binary
+type versionInfo struct {
+	Version       string   `json:"version"`
+	Commit        string   `json:"commit,omitempty"`
+	GoVersion     string   `json:"go_version"`
+	OS            string   `json:"os"`
+	Arch          string   `json:"arch"`
+	CGO           bool     `json:"cgo"`
+	BuildTags     []string `json:"build_tags"`
+	Libheif       string   `json:"libheif"`
+	InputFormats  []string `json:"input_formats"`
+	OutputFormats []string `json:"output_formats"`
+	// Schemas are the versions of the JSON files read and written
+	Schemas map[string]int `json:"schemas"`
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version and capability information",
+	Run:   func(cmd *cobra.Command, args []string) { runVersion() },
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&versionJSON, "json", false, "Print as JSON")
+	rootCmd.AddCommand(versionCmd)
+}
+
+func runVersion() {
+	info := getVersionInfo()
+
+	if versionJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(info); err != nil {
+			fmt.Printf("Failed to encode version info: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Printf("picture-resize-tools %s\n", info.Version)
+	if info.Commit != "" {
+		fmt.Printf("Commit:         %s\n", info.Commit)
+	}
+	fmt.Printf("Go:             %s %s/%s (cgo: %t)\n", info.GoVersion, info.OS, info.Arch, info.CGO)
+	fmt.Printf("Build tags:     %s\n", strings.Join(info.BuildTags, ", "))
+	fmt.Printf("libheif:        %s\n", info.Libheif)
+	fmt.Printf("Input formats:  %s\n", strings.Join(info.InputFormats, ", "))
+	fmt.Printf("Output formats: %s\n", strings.Join(info.OutputFormats, ", "))
+	fmt.Printf("Schemas:        manifest v%d, failures v%d\n", info.Schemas["manifest"], info.Schemas["failures"])
+}
+
+// getVersionInfo collects version details from the embedded build information
+func getVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:       version,
+		GoVersion:     runtime.Version(),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		BuildTags:     []string{},
+		Libheif:       processor.HeifVersion(),
+		InputFormats:  processor.InputExtensions(),
+		OutputFormats: processor.OutputFormats(),
+		Schemas:       schemaVersions(),
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Commit = setting.Value
+		case "CGO_ENABLED":
+			info.CGO = setting.Value == "1"
+		case "-tags":
+			info.BuildTags = strings.Split(setting.Value, ",")
+		}
+	}
+	return info
+}
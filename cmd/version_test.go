@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetVersionInfo(t *testing.T) {
+	info := getVersionInfo()
+
+	if info.Version != version {
+		t.Errorf("getVersionInfo().Version = %s, expected %s", info.Version, version)
+	}
+	if info.BuildTags == nil {
+		t.Error("getVersionInfo().BuildTags should be an empty list, not nil")
+	}
+	if len(info.InputFormats) == 0 || len(info.OutputFormats) == 0 {
+		t.Error("getVersionInfo() should report supported formats")
+	}
+	if info.Schemas["manifest"] != manifestSchemaVersion || info.Schemas["failures"] != failuresSchemaVersion {
+		t.Errorf("getVersionInfo().Schemas = %v", info.Schemas)
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	for _, key := range []string{"version", "go_version", "cgo", "build_tags", "libheif", "input_formats", "output_formats", "schemas"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("version JSON missing key %s", key)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+// whiteBalancePointSize is the side of the patch sampled around a single
+// reference point, so one noisy pixel does not set the balance
+const whiteBalancePointSize = 9
+
+// parseWhiteBalance parses a white balance reference: auto for gray world,
+// x,y for a point or x,y,width,height for a patch, in source pixels. A
+// level from 1 to 255 also corrects exposure to that gray level.
+func parseWhiteBalance(s string, level int) (*processor.WhiteBalance, error) {
+	wb := &processor.WhiteBalance{Level: float64(level) / 255}
+	if s == "auto" {
+		return wb, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 && len(parts) != 4 {
+		return nil, fmt.Errorf("expected auto, x,y or x,y,width,height: %s", s)
+	}
+	values := make([]int, len(parts))
+	for i, part := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid coordinate: %s", part)
+		}
+		values[i] = v
+	}
+
+	if len(values) == 2 {
+		half := whiteBalancePointSize / 2
+		wb.Patch = image.Rect(max(0, values[0]-half), max(0, values[1]-half), values[0]+half+1, values[1]+half+1)
+		return wb, nil
+	}
+	if values[2] == 0 || values[3] == 0 {
+		return nil, fmt.Errorf("patch must not be empty: %s", s)
+	}
+	wb.Patch = image.Rect(values[0], values[1], values[0]+values[2], values[1]+values[3])
+	return wb, nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"image"
+	"testing"
+
+	"picture-resize-tools/pkg/processor"
+)
+
+func TestParseWhiteBalance(t *testing.T) {
+	tests := []struct {
+		input       string
+		level       int
+		expected    processor.WhiteBalance
+		expectError bool
+	}{
+		{"auto", 0, processor.WhiteBalance{}, false},
+		{"auto", 255, processor.WhiteBalance{Level: 1}, false},
+		{"100,50,20,10", 0, processor.WhiteBalance{Patch: image.Rect(100, 50, 120, 60)}, false},
+		{"100, 50", 0, processor.WhiteBalance{Patch: image.Rect(96, 46, 105, 55)}, false},
+		{"2,2", 0, processor.WhiteBalance{Patch: image.Rect(0, 0, 7, 7)}, false},
+		{"100,50,0,10", 0, processor.WhiteBalance{}, true},
+		{"100,-50", 0, processor.WhiteBalance{}, true},
+		{"100", 0, processor.WhiteBalance{}, true},
+		{"gray", 0, processor.WhiteBalance{}, true},
+	}
+
+	for _, test := range tests {
+		wb, err := parseWhiteBalance(test.input, test.level)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("parseWhiteBalance(%q) expected error, got %+v", test.input, *wb)
+			}
+			continue
+		}
+		if err != nil || *wb != test.expected {
+			t.Errorf("parseWhiteBalance(%q) = %+v, %v, expected %+v", test.input, wb, err, test.expected)
+		}
+	}
+}
@@ -1,15 +1,23 @@
 module picture-resize-tools
 
-go 1.21
+go 1.22.0
 
 require (
+	filippo.io/age v1.1.1
+	github.com/chai2010/webp v1.4.0
 	github.com/disintegration/imaging v1.6.2
+	github.com/gen2brain/jpegxl v0.4.0
 	github.com/spf13/cobra v1.8.0
 	github.com/strukturag/libheif v1.18.2
+	golang.org/x/image v0.10.0
+	golang.org/x/text v0.11.0
 )
 
 require (
+	github.com/ebitengine/purego v0.8.1 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/image v0.10.0 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
+	golang.org/x/crypto v0.4.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 )
@@ -0,0 +1,132 @@
+// Package golden compares images with reference ("golden") files using a
+// perceptual color difference, so that codec and conversion tests can allow
+// for the loss of lossy formats without hiding real regressions.
+//
+// Run the tests with -update to rewrite the golden files from the current
+// output after an intended change, and review the new images before
+// committing them.
+package golden
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden images instead of comparing against them")
+
+// Tolerance bounds the color difference between an image and its golden
+// file, as CIE76 ΔE in CIELAB. A ΔE around 2 is barely visible; lossless
+// paths should stay below 1.
+type Tolerance struct {
+	// Mean is the largest average difference over all pixels
+	Mean float64
+	// Max is the largest difference of any pixel
+	Max float64
+}
+
+// Add returns the tolerance of two lossy steps applied one after the other
+func (t Tolerance) Add(other Tolerance) Tolerance {
+	return Tolerance{Mean: t.Mean + other.Mean, Max: t.Max + other.Max}
+}
+
+// Diff is the color difference between two images
+type Diff struct {
+	Mean float64
+	Max  float64
+	// Worst is the position of the pixel that differs most, relative to
+	// the top-left corner
+	Worst image.Point
+}
+
+// Within reports whether the difference is within tolerance
+func (d Diff) Within(tol Tolerance) bool {
+	return d.Mean <= tol.Mean && d.Max <= tol.Max
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("mean ΔE %.2f, max ΔE %.2f at %d,%d", d.Mean, d.Max, d.Worst.X, d.Worst.Y)
+}
+
+// Compare returns the color difference between images of the same size.
+// Translucent pixels are compared over both black and white, so that
+// differences in alpha count as much as differences in color.
+func Compare(a, b image.Image) (Diff, error) {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Size() != bb.Size() {
+		return Diff{}, fmt.Errorf("size %dx%d differs from %dx%d", ab.Dx(), ab.Dy(), bb.Dx(), bb.Dy())
+	}
+
+	var diff Diff
+	var sum float64
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			ca, cb := a.At(ab.Min.X+x, ab.Min.Y+y), b.At(bb.Min.X+x, bb.Min.Y+y)
+			d := math.Max(deltaE(ca, cb, 0), deltaE(ca, cb, 1))
+			sum += d
+			if d > diff.Max {
+				diff.Max, diff.Worst = d, image.Pt(x, y)
+			}
+		}
+	}
+	if n := ab.Dx() * ab.Dy(); n > 0 {
+		diff.Mean = sum / float64(n)
+	}
+	return diff, nil
+}
+
+// Assert compares got with the golden PNG file at path, or writes it there
+// when the tests run with -update
+func Assert(t testing.TB, path string, got image.Image, tol Tolerance) {
+	t.Helper()
+
+	if *update {
+		if err := Write(path, got); err != nil {
+			t.Fatalf("golden: %v", err)
+		}
+		return
+	}
+
+	want, err := Read(path)
+	if err != nil {
+		t.Fatalf("golden: %v (run the tests with -update to create it)", err)
+	}
+	diff, err := Compare(got, want)
+	if err != nil {
+		t.Fatalf("golden %s: %v", filepath.Base(path), err)
+	}
+	if !diff.Within(tol) {
+		t.Errorf("golden %s: %v, tolerance mean %.2f, max %.2f", filepath.Base(path), diff, tol.Mean, tol.Max)
+	}
+}
+
+// Read decodes the golden PNG file at path
+func Read(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
+
+// Write stores img as a golden PNG file at path
+func Write(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
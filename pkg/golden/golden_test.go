@@ -0,0 +1,97 @@
+package golden
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	uniform := func(c color.Color) image.Image {
+		img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				img.Set(x, y, c)
+			}
+		}
+		return img
+	}
+
+	tests := []struct {
+		name     string
+		a, b     image.Image
+		min, max float64
+	}{
+		{"Identical", uniform(color.NRGBA{200, 100, 50, 255}), uniform(color.NRGBA{200, 100, 50, 255}), 0, 0},
+		{"Black and white", uniform(color.Black), uniform(color.White), 99.9, 100.1},
+		{"Barely visible", uniform(color.NRGBA{128, 128, 128, 255}), uniform(color.NRGBA{129, 128, 128, 255}), 0.1, 1},
+		{"Alpha counts", uniform(color.NRGBA{255, 255, 255, 255}), uniform(color.NRGBA{255, 255, 255, 0}), 99.9, 100.1},
+		{"Hidden color does not", uniform(color.NRGBA{255, 0, 0, 0}), uniform(color.NRGBA{0, 0, 255, 0}), 0, 0},
+		{"Color models", uniform(color.Gray{90}), uniform(color.NRGBA{90, 90, 90, 255}), 0, 0.01},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff, err := Compare(test.a, test.b)
+			if err != nil {
+				t.Fatalf("Compare() error = %v", err)
+			}
+			if diff.Mean < test.min || diff.Mean > test.max {
+				t.Errorf("Compare() = %v, expected a mean between %g and %g", diff, test.min, test.max)
+			}
+		})
+	}
+
+	// The worst pixel is reported relative to the top-left corner
+	a := image.NewGray(image.Rect(10, 10, 20, 20))
+	b := image.NewGray(image.Rect(0, 0, 10, 10))
+	b.SetGray(3, 7, color.Gray{255})
+	if diff, _ := Compare(a, b); diff.Worst != image.Pt(3, 7) {
+		t.Errorf("Compare() worst = %v, expected (3,7)", diff.Worst)
+	}
+
+	if _, err := Compare(a, image.NewGray(image.Rect(0, 0, 10, 9))); err == nil {
+		t.Error("Compare() of different sizes returned no error")
+	}
+}
+
+func TestAssert(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.NRGBA{10, 200, 30, 255})
+	path := filepath.Join(t.TempDir(), "golden", "img.png")
+	if err := Write(path, img); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// Close enough passes, too different is reported
+	near := image.NewNRGBA(img.Rect)
+	copy(near.Pix, img.Pix)
+	near.Pix[near.PixOffset(1, 1)]++
+	Assert(t, path, near, Tolerance{Mean: 0.5, Max: 2})
+
+	far := image.NewNRGBA(img.Rect)
+	rec := &recorder{TB: t}
+	Assert(rec, path, far, Tolerance{Mean: 0.5, Max: 2})
+	if !rec.failed {
+		t.Error("Assert() accepted an image far from the golden file")
+	}
+}
+
+func TestToleranceAdd(t *testing.T) {
+	if sum := (Tolerance{Mean: 1, Max: 4}).Add(Tolerance{Mean: 2.5, Max: 14}); sum != (Tolerance{Mean: 3.5, Max: 18}) {
+		t.Errorf("Add() = %+v", sum)
+	}
+}
+
+// recorder notes failures instead of failing the test
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) { r.failed = true }
+
+func (r *recorder) Fatalf(format string, args ...interface{}) { r.failed = true }
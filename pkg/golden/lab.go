@@ -0,0 +1,52 @@
+package golden
+
+import (
+	"image/color"
+	"math"
+)
+
+// D65 white point in XYZ
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+// deltaE returns the CIE76 difference of two colors composited over a gray
+// background of the given level, from 0 (black) to 1 (white)
+func deltaE(a, b color.Color, background float64) float64 {
+	l1, a1, b1 := lab(a, background)
+	l2, a2, b2 := lab(b, background)
+	return math.Sqrt((l1-l2)*(l1-l2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+}
+
+// lab converts c, composited over background, to CIELAB
+func lab(c color.Color, background float64) (l, a, b float64) {
+	r, g, bl, alpha := c.RGBA()
+	over := func(v uint32) float64 {
+		// Premultiplied color plus the background showing through
+		return linear(float64(v)/0xffff + background*(1-float64(alpha)/0xffff))
+	}
+	lr, lg, lb := over(r), over(g), over(bl)
+
+	x := (0.4124*lr + 0.3576*lg + 0.1805*lb) / whiteX
+	y := (0.2126*lr + 0.7152*lg + 0.0722*lb) / whiteY
+	z := (0.0193*lr + 0.1192*lg + 0.9505*lb) / whiteZ
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// linear decodes an sRGB value
+func linear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27*t + 16) / 116
+}
@@ -0,0 +1,177 @@
+// Package pool runs tasks on a fixed number of worker goroutines. Tasks are
+// taken in order and their errors are returned in the same order, however
+// the tasks interleave, so batch results do not depend on scheduling.
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Limiter bounds the number of tasks that run at once and numbers the
+// workers running them
+type Limiter interface {
+	// Acquire blocks until a task may start and returns the ID of the
+	// worker that runs it
+	Acquire() int
+	// Release returns the worker ID of a finished task
+	Release(id int)
+}
+
+// Progress describes a finished task
+type Progress struct {
+	// Index is the position of the task
+	Index int
+	// Err is the error of the task
+	Err error
+	// Done and Failed count the finished and failed tasks so far, out of
+	// Total
+	Done, Failed, Total int
+}
+
+// Task runs the task at index on the worker with ID worker. It should
+// return early when ctx is cancelled.
+type Task func(ctx context.Context, worker, index int) error
+
+// Pool runs tasks on a fixed set of worker goroutines. The zero value runs
+// one task at a time.
+type Pool struct {
+	// Workers is the number of worker goroutines, at least one
+	Workers int
+	// Limiter, if set, bounds the workers running tasks at once below
+	// Workers, for example to change their number while tasks run, and
+	// numbers them
+	Limiter Limiter
+	// Progress is called after each task, never concurrently
+	Progress func(Progress)
+}
+
+// Errors are the errors of a run, one per task in task order. Tasks that
+// succeeded have nil errors.
+type Errors []error
+
+// Failed returns the number of failed tasks
+func (e Errors) Failed() int {
+	failed := 0
+	for _, err := range e {
+		if err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Err returns the errors of the failed tasks joined into one, or nil if
+// none failed
+func (e Errors) Err() error {
+	var errs []error
+	for i, err := range e {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("task %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// taskError is the error of the task at index
+type taskError struct {
+	index int
+	err   error
+}
+
+// Run runs task for each index from 0 to n-1 and returns once every worker
+// has stopped. Workers take tasks in index order from a queue that holds
+// one task per worker, so no more than that waits at any time. Once ctx is
+// cancelled no more tasks start, and those not started fail with the error
+// of ctx.
+func (p *Pool) Run(ctx context.Context, n int, task Task) Errors {
+	workers := max(1, min(p.Workers, n))
+
+	var mu sync.Mutex
+	done, failed := 0, 0
+	report := func(index int, err error) {
+		if p.Progress == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		if err != nil {
+			failed++
+		}
+		p.Progress(Progress{Index: index, Err: err, Done: done, Failed: failed, Total: n})
+	}
+
+	// Each worker collects its own errors, merged once all have stopped
+	jobs := make(chan int, workers)
+	collected := make([][]taskError, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for index := range jobs {
+				err := p.runTask(ctx, w+1, index, task)
+				if err != nil {
+					collected[w] = append(collected[w], taskError{index, err})
+				}
+				report(index, err)
+			}
+		}(w)
+	}
+
+	// Queue the tasks until cancelled; the queue blocks while it is full
+	queued := 0
+queue:
+	for ; queued < n; queued++ {
+		select {
+		case jobs <- queued:
+		case <-ctx.Done():
+			break queue
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	errs := make(Errors, n)
+	for _, worker := range collected {
+		for _, e := range worker {
+			errs[e.index] = e.err
+		}
+	}
+	for index := queued; index < n; index++ {
+		errs[index] = ctx.Err()
+		report(index, errs[index])
+	}
+	return errs
+}
+
+// runTask runs the task at index on worker unless ctx is cancelled
+func (p *Pool) runTask(ctx context.Context, worker, index int, task Task) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.Limiter != nil {
+		worker = p.Limiter.Acquire()
+		defer p.Limiter.Release(worker)
+		// Cancelled while waiting for the limiter
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return task(ctx, worker, index)
+}
+
+// Map calls fn for each of items on the pool and returns the results and
+// errors in the order of items
+func Map[T, R any](ctx context.Context, p *Pool, items []T, fn func(ctx context.Context, worker int, item T) (R, error)) ([]R, Errors) {
+	results := make([]R, len(items))
+	errs := p.Run(ctx, len(items), func(ctx context.Context, worker, index int) error {
+		result, err := fn(ctx, worker, items[index])
+		results[index] = result
+		return err
+	})
+	return results, errs
+}
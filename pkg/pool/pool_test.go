@@ -0,0 +1,247 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunErrorsInOrder(t *testing.T) {
+	p := &Pool{Workers: 4}
+	errs := p.Run(context.Background(), 10, func(ctx context.Context, worker, index int) error {
+		// Later tasks finish first
+		time.Sleep(time.Duration(10-index) * time.Millisecond)
+		if index%3 == 0 {
+			return errors.New("multiple of three")
+		}
+		return nil
+	})
+
+	if len(errs) != 10 {
+		t.Fatalf("Run() returned %d errors, expected 10", len(errs))
+	}
+	for i, err := range errs {
+		if (err != nil) != (i%3 == 0) {
+			t.Errorf("error %d = %v", i, err)
+		}
+	}
+	if errs.Failed() != 4 {
+		t.Errorf("Failed() = %d, expected 4", errs.Failed())
+	}
+	if err := errs.Err(); err == nil || !strings.HasPrefix(err.Error(), "task 0: multiple of three\ntask 3:") {
+		t.Errorf("Err() = %v", err)
+	}
+	if err := (Errors{nil, nil}).Err(); err != nil {
+		t.Errorf("Err() without failures = %v, expected nil", err)
+	}
+}
+
+func TestRunBoundsWorkers(t *testing.T) {
+	tests := []struct {
+		workers  int
+		expected int
+	}{
+		{0, 1},
+		{1, 1},
+		{3, 3},
+	}
+
+	for _, test := range tests {
+		var running, peak atomic.Int32
+		var mu sync.Mutex
+		ids := map[int]bool{}
+		p := &Pool{Workers: test.workers}
+		p.Run(context.Background(), 12, func(ctx context.Context, worker, index int) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			mu.Lock()
+			ids[worker] = true
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		})
+
+		if int(peak.Load()) != test.expected {
+			t.Errorf("Workers %d: %d tasks ran at once, expected %d", test.workers, peak.Load(), test.expected)
+		}
+		for id := range ids {
+			if id < 1 || id > test.expected {
+				t.Errorf("Workers %d: worker ID %d out of range", test.workers, id)
+			}
+		}
+	}
+}
+
+func TestRunStartsInOrder(t *testing.T) {
+	var mu sync.Mutex
+	var started []int
+	p := &Pool{Workers: 1}
+	p.Run(context.Background(), 5, func(ctx context.Context, worker, index int) error {
+		mu.Lock()
+		started = append(started, index)
+		mu.Unlock()
+		return nil
+	})
+	for i, index := range started {
+		if index != i {
+			t.Fatalf("tasks started in order %v", started)
+		}
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var ran atomic.Int32
+	p := &Pool{Workers: 1}
+	errs := p.Run(ctx, 10, func(ctx context.Context, worker, index int) error {
+		ran.Add(1)
+		if index == 3 {
+			cancel()
+		}
+		return nil
+	})
+
+	if ran.Load() != 4 {
+		t.Errorf("%d tasks ran, expected none after cancelling in the fourth", ran.Load())
+	}
+	for i := 4; i < 10; i++ {
+		if !errors.Is(errs[i], context.Canceled) {
+			t.Errorf("error %d = %v, expected context.Canceled", i, errs[i])
+		}
+	}
+}
+
+func TestRunProgress(t *testing.T) {
+	var calls []Progress
+	inCallback := false
+	p := &Pool{
+		Workers: 4,
+		Progress: func(progress Progress) {
+			if inCallback {
+				t.Error("Progress called concurrently")
+			}
+			inCallback = true
+			calls = append(calls, progress)
+			time.Sleep(time.Millisecond)
+			inCallback = false
+		},
+	}
+	p.Run(context.Background(), 8, func(ctx context.Context, worker, index int) error {
+		if index == 5 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	if len(calls) != 8 {
+		t.Fatalf("Progress called %d times, expected 8", len(calls))
+	}
+	seen := map[int]bool{}
+	for i, call := range calls {
+		if call.Done != i+1 || call.Total != 8 {
+			t.Errorf("call %d: %d/%d done", i, call.Done, call.Total)
+		}
+		if (call.Err != nil) != (call.Index == 5) {
+			t.Errorf("call %d: task %d error = %v", i, call.Index, call.Err)
+		}
+		seen[call.Index] = true
+	}
+	if len(seen) != 8 || calls[7].Failed != 1 {
+		t.Errorf("Progress saw %d tasks and %d failures, expected 8 and 1", len(seen), calls[7].Failed)
+	}
+}
+
+// countingLimiter hands out IDs 1 and 2 and counts the workers acquired
+type countingLimiter struct {
+	ids      chan int
+	acquired atomic.Int32
+}
+
+func newCountingLimiter() *countingLimiter {
+	l := &countingLimiter{ids: make(chan int, 2)}
+	l.ids <- 1
+	l.ids <- 2
+	return l
+}
+
+func (l *countingLimiter) Acquire() int {
+	l.acquired.Add(1)
+	return <-l.ids
+}
+
+func (l *countingLimiter) Release(id int) {
+	l.ids <- id
+}
+
+func TestRunLimiter(t *testing.T) {
+	limiter := newCountingLimiter()
+	p := &Pool{Workers: 100, Limiter: limiter}
+	p.Run(context.Background(), 6, func(ctx context.Context, worker, index int) error {
+		if worker < 1 || worker > 2 {
+			t.Errorf("worker ID %d not from the limiter", worker)
+		}
+		return nil
+	})
+	if limiter.acquired.Load() != 6 {
+		t.Errorf("limiter acquired %d workers, expected 6", limiter.acquired.Load())
+	}
+}
+
+func TestRunFixedWorkers(t *testing.T) {
+	before := runtime.NumGoroutine()
+	var peak atomic.Int32
+	p := &Pool{Workers: 4}
+	errs := p.Run(context.Background(), 10000, func(ctx context.Context, worker, index int) error {
+		if n := int32(runtime.NumGoroutine()); n > peak.Load() {
+			peak.Store(n)
+		}
+		return nil
+	})
+
+	if errs.Failed() != 0 {
+		t.Fatalf("Run() failed %d tasks", errs.Failed())
+	}
+	// The workers, nothing per task
+	if extra := int(peak.Load()) - before; extra > 4 {
+		t.Errorf("%d goroutines besides the test ran 10000 tasks, expected the 4 workers", extra)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines left after Run(), expected %d", after, before)
+	}
+}
+
+func TestMap(t *testing.T) {
+	p := &Pool{Workers: 3}
+	words := []string{"a", "bb", "", "dddd"}
+	lengths, errs := Map(context.Background(), p, words, func(ctx context.Context, worker int, word string) (int, error) {
+		if word == "" {
+			return 0, errors.New("empty")
+		}
+		return len(word), nil
+	})
+
+	expected := []int{1, 2, 0, 4}
+	for i := range expected {
+		if lengths[i] != expected[i] {
+			t.Errorf("Map() = %v, expected %v", lengths, expected)
+			break
+		}
+	}
+	if errs.Failed() != 1 || errs[2] == nil {
+		t.Errorf("Map() errors = %v, expected only the third to fail", errs)
+	}
+}
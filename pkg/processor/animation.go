@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// animation is a decoded animation with every frame composited onto the
+// full canvas, so frames can be transformed like still images
+type animation struct {
+	frames []image.Image
+	delays []time.Duration
+	// loopCount follows GIF: 0 loops forever, -1 plays once and n > 0
+	// repeats n times
+	loopCount int
+}
+
+// isAnimated reports whether path may hold an animation: any GIF, or a
+// WebP with the animation flag set
+func isAnimated(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		return true
+	case ".webp":
+		file, err := os.OpenFile(path, os.O_RDONLY, 0)
+		if err != nil {
+			return false
+		}
+		defer file.Close()
+		header := make([]byte, 21)
+		if _, err := io.ReadFull(file, header); err != nil {
+			return false
+		}
+		return isAnimatedWebP(header)
+	}
+	return false
+}
+
+// canAnimate reports whether format can be written as an animation
+func canAnimate(format string) bool {
+	return format == "gif" || format == "webp"
+}
+
+// processAnimation transforms every frame of the animation at inputPath
+// and writes them to outputPath, keeping delays and loop count
+func processAnimation(inputPath, outputPath, format string, config Config) error {
+	config.progress.stage(StageDecode)
+	anim, err := decodeAnimation(inputPath, config.progress, config.MaxPixels)
+	if err != nil {
+		return err
+	}
+
+	// Smart crops follow the first frame so the crop does not jump around
+	config.progress.stage(StageTransform)
+	if config.Carve {
+		config.Carve, config.Fill = false, true
+	}
+	if config.Fill && config.Focus == nil && len(anim.frames) > 0 {
+		config.Focus = smartFocalPoint(anim.frames[0], config)
+	}
+	for i, frame := range anim.frames {
+		if anim.frames[i], err = transformImage(frame, config); err != nil {
+			return err
+		}
+	}
+
+	config.progress.stage(StageEncode)
+	if config.BeforeWrite != nil {
+		if err := config.BeforeWrite(outputPath); err != nil {
+			return err
+		}
+	}
+	return encodeAnimation(anim, outputPath, format, config.Quality)
+}
+
+// decodeAnimation reads the animation at path, reporting the bytes read to
+// progress
+func decodeAnimation(path string, progress *fileProgress, limit int64) (*animation, error) {
+	file, err := openInput(path, progress)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		return decodeGIF(file, limit)
+	case ".webp":
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		return decodeWebP(data, limit)
+	}
+	return nil, fmt.Errorf("%s cannot hold an animation", filepath.Base(path))
+}
+
+// encodeAnimation writes anim to path in format
+func encodeAnimation(anim *animation, path, format string, quality int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch format {
+	case "gif":
+		return encodeGIF(file, anim)
+	case "webp":
+		return encodeWebP(file, anim, quality)
+	}
+	return fmt.Errorf("%s cannot be written as an animation", format)
+}
@@ -0,0 +1,204 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProcessAnimatedGIF(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Three frames: a full first frame, then two smaller patches that rely
+	// on the previous frame being kept
+	palette := color.Palette{color.RGBA{0, 0, 0, 255}, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	src := &gif.GIF{LoopCount: 3}
+	for i, rect := range []image.Rectangle{
+		image.Rect(0, 0, 200, 100),
+		image.Rect(0, 0, 100, 100),
+		image.Rect(100, 0, 200, 100),
+	} {
+		frame := image.NewPaletted(rect, palette)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				frame.SetColorIndex(x, y, uint8(i))
+			}
+		}
+		src.Image = append(src.Image, frame)
+		src.Delay = append(src.Delay, 10*(i+1))
+		src.Disposal = append(src.Disposal, gif.DisposalNone)
+	}
+
+	inputPath := filepath.Join(tempDir, "anim.gif")
+	file, err := os.Create(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to create GIF fixture: %v", err)
+	}
+	if err := gif.EncodeAll(file, src); err != nil {
+		t.Fatalf("Failed to write GIF fixture: %v", err)
+	}
+	file.Close()
+
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	result, err := Process(inputPath, Config{OutputFormat: "jpg", MaxWidth: 100, MaxHeight: 100, OutputDir: outputDir, KeepFormat: true})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	file, err = os.Open(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	defer file.Close()
+	out, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatalf("Output is not a GIF: %v", err)
+	}
+
+	if len(out.Image) != 3 {
+		t.Fatalf("frames = %d, expected 3", len(out.Image))
+	}
+	if out.LoopCount != 3 {
+		t.Errorf("loop count = %d, expected 3", out.LoopCount)
+	}
+	for i, delay := range out.Delay {
+		if delay != 10*(i+1) {
+			t.Errorf("frame %d delay = %d, expected %d", i, delay, 10*(i+1))
+		}
+	}
+	if out.Config.Width != 100 || out.Config.Height != 50 {
+		t.Errorf("size = %dx%d, expected 100x50", out.Config.Width, out.Config.Height)
+	}
+
+	// The last frame keeps the red left half drawn by the second frame
+	last := out.Image[2]
+	if r, g, b, _ := last.At(10, 25).RGBA(); r>>8 < 250 || g>>8 > 5 || b>>8 > 5 {
+		t.Errorf("left half of last frame = %v, expected red", last.At(10, 25))
+	}
+	if r, g, b, _ := last.At(90, 25).RGBA(); r>>8 > 5 || g>>8 > 5 || b>>8 < 250 {
+		t.Errorf("right half of last frame = %v, expected blue", last.At(90, 25))
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.NRGBA{255, 0, 0, 255})
+	img.Set(1, 0, color.NRGBA{255, 0, 0, 255})
+	img.Set(2, 0, color.NRGBA{0, 255, 0, 255})
+	img.Set(3, 0, color.NRGBA{})
+
+	paletted := quantize(img)
+	if len(paletted.Palette) != 3 {
+		t.Fatalf("palette size = %d, expected 3", len(paletted.Palette))
+	}
+	if _, _, _, a := paletted.At(3, 0).RGBA(); a != 0 {
+		t.Errorf("transparent pixel = %v, expected transparent", paletted.At(3, 0))
+	}
+	if paletted.At(0, 0) != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("red pixel = %v, expected red", paletted.At(0, 0))
+	}
+}
+
+func TestProcessAnimatedWebP(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Three solid frames of different colors
+	src := &animation{loopCount: 2}
+	for i, c := range []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}} {
+		frame := image.NewRGBA(image.Rect(0, 0, 120, 60))
+		for y := 0; y < 60; y++ {
+			for x := 0; x < 120; x++ {
+				frame.Set(x, y, c)
+			}
+		}
+		src.frames = append(src.frames, frame)
+		src.delays = append(src.delays, time.Duration(100*(i+1))*time.Millisecond)
+	}
+
+	inputPath := filepath.Join(tempDir, "anim.webp")
+	file, err := os.Create(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to create WebP fixture: %v", err)
+	}
+	if err := encodeWebP(file, src, 90); err != nil {
+		t.Fatalf("Failed to write WebP fixture: %v", err)
+	}
+	file.Close()
+
+	if !isAnimated(inputPath) {
+		t.Fatal("isAnimated() = false, expected true")
+	}
+
+	// Single frames load as stills
+	img, err := loadImage(inputPath)
+	if err != nil {
+		t.Fatalf("loadImage() error = %v", err)
+	}
+	if img.Bounds().Size() != image.Pt(120, 60) {
+		t.Errorf("loadImage() size = %v, expected 120x60", img.Bounds().Size())
+	}
+
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	result, err := Process(inputPath, Config{MaxWidth: 60, MaxHeight: 60, Quality: 80, OutputDir: outputDir, KeepFormat: true})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	data, err := os.ReadFile(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	out, err := decodeWebP(data, 0)
+	if err != nil {
+		t.Fatalf("Output is not an animated WebP: %v", err)
+	}
+
+	if len(out.frames) != 3 {
+		t.Fatalf("frames = %d, expected 3", len(out.frames))
+	}
+	if out.loopCount != 2 {
+		t.Errorf("loop count = %d, expected 2", out.loopCount)
+	}
+	for i, frame := range out.frames {
+		if out.delays[i] != src.delays[i] {
+			t.Errorf("frame %d delay = %v, expected %v", i, out.delays[i], src.delays[i])
+		}
+		if frame.Bounds().Size() != image.Pt(60, 30) {
+			t.Errorf("frame %d size = %v, expected 60x30", i, frame.Bounds().Size())
+		}
+	}
+	if r, g, b, _ := out.frames[1].At(30, 15).RGBA(); r>>8 > 60 || g>>8 < 200 || b>>8 > 60 {
+		t.Errorf("second frame = %v, expected green", out.frames[1].At(30, 15))
+	}
+}
+
+func TestWebPLoopCount(t *testing.T) {
+	tests := []struct {
+		gif  int
+		webp int
+	}{
+		{0, 0},
+		{-1, 1},
+		{1, 2},
+		{5, 6},
+	}
+
+	for _, test := range tests {
+		if result := webpLoopCount(test.gif); result != test.webp {
+			t.Errorf("webpLoopCount(%d) = %d, expected %d", test.gif, result, test.webp)
+		}
+		if result := gifLoopCount(test.webp); result != test.gif {
+			t.Errorf("gifLoopCount(%d) = %d, expected %d", test.webp, result, test.gif)
+		}
+	}
+}
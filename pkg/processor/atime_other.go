@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package processor
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns the modification time of info on systems whose access
+// time is not read
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,205 @@
+package processor
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// maxCarve is the share of the width or height seam carving may remove;
+// beyond it seams run through the subject, so the rest is cropped
+const maxCarve = 0.25
+
+// carveTarget returns the size carveImage gives an image of size for the
+// maximum size: that of a fill crop, fitted or, with upscale, enlarged to
+// exactly width x height
+func carveTarget(size image.Point, width, height int, upscale bool) image.Point {
+	if upscale {
+		return image.Pt(width, height)
+	}
+	return fitSize(fillSize(size, width, height), width, height)
+}
+
+// carveImage changes the aspect ratio of img to that of target by removing
+// the seams of least contrast instead of cropping, so that the subject
+// keeps its place and shape. img is first scaled so that its other side
+// matches target, in linear light when linear, and anything beyond
+// maxCarve is cropped evenly from both sides.
+func carveImage(img image.Image, target image.Point, linear bool) image.Image {
+	size := img.Bounds().Size()
+	if size == target {
+		return img
+	}
+
+	// Carve columns; rows are carved as the columns of the transpose
+	columns := size.X*target.Y >= size.Y*target.X
+	if !columns {
+		img = imaging.Transpose(img)
+		size, target = image.Pt(size.Y, size.X), image.Pt(target.Y, target.X)
+	}
+
+	width := max(target.X, int(math.Round(float64(size.X)*float64(target.Y)/float64(size.Y))))
+	var src *image.NRGBA
+	if size == image.Pt(width, target.Y) {
+		src = imaging.Clone(img)
+	} else {
+		src = resample(img, image.Pt(width, target.Y), imaging.Lanczos, linear)
+	}
+	if limit := target.X + int(float64(width)*maxCarve); width > limit {
+		x := (width - limit) / 2
+		src = imaging.Crop(src, image.Rect(x, 0, x+limit, target.Y))
+	}
+
+	out := removeSeams(src, src.Rect.Dx()-target.X)
+	if !columns {
+		return imaging.Transpose(out)
+	}
+	return out
+}
+
+// seamBatch is the share of the width whose seams are removed per pass
+// over the image; seams of a pass do not share pixels
+const seamBatch = 1.0 / 64
+
+// removeSeams removes n vertical seams of img, each the connected path of
+// one pixel per row with the least luma gradient. Seams are found in
+// batches of disjoint paths, which is close to removing them one by one
+// for a fraction of the time.
+func removeSeams(img *image.NRGBA, n int) *image.NRGBA {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	stride := width
+	pix := append([]uint8(nil), img.Pix...)
+	luma := make([]float32, width*height)
+	for i := range luma {
+		p := pix[i*4:]
+		luma[i] = 0.299*float32(p[0]) + 0.587*float32(p[1]) + 0.114*float32(p[2])
+	}
+
+	energy := make([]float32, width*height)
+	cost := make([]float32, width*height)
+	used := make([]bool, width*height)
+	order := make([]int, 0, width)
+	seam := make([]int, height)
+	for n > 0 && width > 1 {
+		seamEnergy(energy, luma, width, height, stride)
+
+		// Cheapest path to each pixel from the top row
+		copy(cost[:width], energy[:width])
+		for y := 1; y < height; y++ {
+			row := cost[y*stride : y*stride+width]
+			above := cost[(y-1)*stride : (y-1)*stride+width]
+			e := energy[y*stride : y*stride+width]
+			row[0] = e[0] + min32(above[0], above[1])
+			for x := 1; x < width-1; x++ {
+				row[x] = e[x] + min32(min32(above[x-1], above[x]), above[x+1])
+			}
+			row[width-1] = e[width-1] + min32(above[width-2], above[width-1])
+		}
+
+		// Follow paths back up from the cheapest bottom pixels, each
+		// around the pixels taken by the paths before it
+		last := cost[(height-1)*stride:]
+		order = order[:0]
+		for x := 0; x < width; x++ {
+			order = append(order, x)
+		}
+		sort.Slice(order, func(i, j int) bool { return last[order[i]] < last[order[j]] })
+		batch := min(n, max(1, int(float64(width)*seamBatch)), width-1)
+		found := 0
+		for _, x := range order {
+			if found == batch {
+				break
+			}
+			seam[height-1] = x
+			ok := !used[(height-1)*stride+x]
+			for y := height - 2; y >= 0 && ok; y-- {
+				row, below := cost[y*stride:], seam[y+1]
+				best := -1
+				for c := max(below-1, 0); c <= min(below+1, width-1); c++ {
+					if !used[y*stride+c] && (best < 0 || row[c] < row[best]) {
+						best = c
+					}
+				}
+				seam[y], ok = best, best >= 0
+			}
+			if !ok {
+				continue
+			}
+			for y, x := range seam {
+				used[y*stride+x] = true
+			}
+			found++
+		}
+
+		// Close the gaps in each row
+		for y := 0; y < height; y++ {
+			start := y * stride
+			to := start
+			for from := start; from < start+width; from++ {
+				if used[from] {
+					used[from] = false
+					continue
+				}
+				if to != from {
+					copy(pix[to*4:to*4+4], pix[from*4:from*4+4])
+					luma[to] = luma[from]
+				}
+				to++
+			}
+		}
+		width -= found
+		n -= found
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		copy(out.Pix[y*out.Stride:], pix[y*stride*4:(y*stride+width)*4])
+	}
+	return out
+}
+
+// seamEnergy sets energy to the luma gradient of the width x height pixels
+// of luma, rows stride apart
+func seamEnergy(energy, luma []float32, width, height, stride int) {
+	at := func(x, y int) float32 {
+		return luma[min(max(y, 0), height-1)*stride+min(max(x, 0), width-1)]
+	}
+	edge := func(x, y int) {
+		dx, dy := at(x+1, y)-at(x-1, y), at(x, y+1)-at(x, y-1)
+		energy[y*stride+x] = abs32(dx) + abs32(dy)
+	}
+	for y := 0; y < height; y++ {
+		if y == 0 || y == height-1 || width < 3 {
+			for x := 0; x < width; x++ {
+				edge(x, y)
+			}
+			continue
+		}
+		// Inside the image every neighbour exists
+		row, up, down := luma[y*stride:y*stride+width], luma[(y-1)*stride:], luma[(y+1)*stride:]
+		e := energy[y*stride : y*stride+width]
+		for x := 1; x < width-1; x++ {
+			e[x] = abs32(row[x+1]-row[x-1]) + abs32(down[x]-up[x])
+		}
+		edge(0, y)
+		edge(width-1, y)
+	}
+}
+
+// min32 returns the smaller of a and b, without the NaN handling of min
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// abs32 returns the absolute value of v
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestRemoveSeams(t *testing.T) {
+	// Two red columns on a plain background survive as the seams go around
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.White)
+		}
+		img.Set(10, y, color.NRGBA{R: 255, A: 255})
+		img.Set(11, y, color.NRGBA{R: 255, A: 255})
+	}
+
+	out := removeSeams(img, 20)
+	if size := out.Rect.Size(); size != image.Pt(20, 10) {
+		t.Fatalf("removeSeams() size = %v, expected 20x10", size)
+	}
+	for y := 0; y < 10; y++ {
+		red := 0
+		for x := 0; x < 20; x++ {
+			if c := out.NRGBAAt(x, y); c.G == 0 {
+				red++
+			}
+		}
+		if red != 2 {
+			t.Errorf("removeSeams() row %d has %d red pixels, expected 2", y, red)
+		}
+	}
+}
+
+func TestCarveImage(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   image.Point
+		target image.Point
+	}{
+		{"Narrower", image.Pt(80, 60), image.Pt(60, 60)},
+		{"Wider, carving rows", image.Pt(80, 60), image.Pt(80, 45)},
+		{"Scaled first", image.Pt(160, 120), image.Pt(64, 36)},
+		// Beyond maxCarve the rest is cropped
+		{"Square from panorama", image.Pt(300, 50), image.Pt(50, 50)},
+	}
+	for _, test := range tests {
+		img := imaging.New(test.size.X, test.size.Y, color.NRGBA{G: 128, A: 255})
+		if size := carveImage(img, test.target, false).Bounds().Size(); size != test.target {
+			t.Errorf("%s: carveImage() size = %v, expected %v", test.name, size, test.target)
+		}
+	}
+}
+
+func TestProcessCarve(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "banner.png")
+	if err := imaging.Save(imaging.New(400, 300, color.White), inputPath); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+	outputDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	for _, upscale := range []bool{false, true} {
+		config := Config{OutputFormat: "png", MaxWidth: 1600, MaxHeight: 900, Quality: 90, OutputDir: outputDir, Carve: true, Upscale: upscale}
+		result, err := Process(inputPath, config)
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		expected, err := OutputSize(inputPath, config)
+		if err != nil {
+			t.Fatalf("OutputSize() error = %v", err)
+		}
+		if size := image.Pt(result.Width, result.Height); size != expected || size.X*9 != size.Y*16 {
+			t.Errorf("Process() with upscale %t size = %v, expected 16:9 %v", upscale, size, expected)
+		}
+	}
+}
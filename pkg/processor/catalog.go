@@ -0,0 +1,340 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// XMP namespaces of cataloging properties
+const (
+	rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	dcNS  = "http://purl.org/dc/elements/1.1/"
+	xmpNS = "http://ns.adobe.com/xap/1.0/"
+)
+
+// IPTC datasets of the application record (2) holding cataloging
+// information, and the coded character set of the envelope record (1)
+const (
+	iptcTitle       = 5
+	iptcKeywords    = 25
+	iptcDescription = 120
+	iptcCharset     = 90
+)
+
+// Sizes IPTC limits its datasets to, in bytes
+const (
+	maxIPTCTitle       = 64
+	maxIPTCKeyword     = 64
+	maxIPTCDescription = 2000
+)
+
+// errIPTCSize is returned for IPTC records a JPEG segment cannot hold
+var errIPTCSize = errors.New("IPTC records too large for a JPEG segment")
+
+// photoshopHeader starts JPEG APP13 segments holding Photoshop image
+// resources, among them the IPTC records
+var photoshopHeader = []byte("Photoshop 3.0\x00")
+
+// iptcResource is the Photoshop image resource holding IPTC records
+const iptcResource = 0x0404
+
+// Catalog is the cataloging information of an image, as kept by digital
+// asset managers in its XMP and IPTC metadata
+type Catalog struct {
+	Title       string
+	Description string
+	Keywords    []string
+	// Rating is from 1 to 5 stars, -1 for rejected images and 0 if unrated
+	Rating int
+}
+
+// empty reports whether c holds nothing
+func (c Catalog) empty() bool {
+	return c.Title == "" && c.Description == "" && len(c.Keywords) == 0 && c.Rating == 0
+}
+
+// ReadCatalog returns the cataloging information of the image at path
+// from its XMP metadata, completed by its IPTC records: JPEG APP13
+// segments and the IPTC tag of TIFF files
+func ReadCatalog(path string) (Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Catalog{}, err
+	}
+	var catalog Catalog
+	if start := bytes.Index(data, []byte("<x:xmpmeta")); start >= 0 {
+		if end := bytes.Index(data[start:], []byte("</x:xmpmeta>")); end >= 0 {
+			catalog = parseXMPCatalog(data[start : start+end+len("</x:xmpmeta>")])
+		}
+	}
+
+	var records []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		records = jpegIPTC(data)
+	case ".tif", ".tiff":
+		if order := tiffOrder(data); order != nil {
+			for _, kind := range []uint16{typeByte, typeUndefined, typeLong} {
+				if records = tiffValue(data, order, int(order.Uint32(data[4:])), tagIPTC, kind); records != nil {
+					break
+				}
+			}
+		}
+	}
+	iptc := parseIPTC(records)
+	if catalog.Title == "" {
+		catalog.Title = iptc.Title
+	}
+	if catalog.Description == "" {
+		catalog.Description = iptc.Description
+	}
+	if len(catalog.Keywords) == 0 {
+		catalog.Keywords = iptc.Keywords
+	}
+	return catalog, nil
+}
+
+// parseXMPCatalog reads the title, description, keywords and rating of
+// an XMP packet
+func parseXMPCatalog(packet []byte) Catalog {
+	var catalog Catalog
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+
+	// The property being read is the innermost element outside the RDF
+	// namespace, its values are the text of its rdf:li elements
+	var stack []xml.Name
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name)
+			for _, attr := range t.Attr {
+				if attr.Name.Space == xmpNS && attr.Name.Local == "Rating" {
+					catalog.Rating = parseRating(attr.Value)
+				}
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			value := strings.TrimSpace(string(t))
+			if value == "" || len(stack) == 0 {
+				continue
+			}
+			var property xml.Name
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].Space != rdfNS {
+					property = stack[i]
+					break
+				}
+			}
+			inList := stack[len(stack)-1].Space == rdfNS && stack[len(stack)-1].Local == "li"
+			switch {
+			case property.Space == dcNS && property.Local == "title" && inList && catalog.Title == "":
+				catalog.Title = value
+			case property.Space == dcNS && property.Local == "description" && inList && catalog.Description == "":
+				catalog.Description = value
+			case property.Space == dcNS && property.Local == "subject" && inList:
+				catalog.Keywords = append(catalog.Keywords, value)
+			case property.Space == xmpNS && property.Local == "Rating":
+				catalog.Rating = parseRating(value)
+			}
+		}
+	}
+	return catalog
+}
+
+// parseRating parses an XMP rating, a real from -1 to 5, as whole stars
+func parseRating(value string) int {
+	rating, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || rating < -1 || rating > 5 {
+		return 0
+	}
+	return int(math.Round(rating))
+}
+
+// jpegIPTC returns the IPTC records of the Photoshop APP13 segments of the
+// JPEG data, or nil
+func jpegIPTC(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	// Resources may be split over several segments
+	var resources []byte
+	for at := 2; at+4 <= len(data) && data[at] == 0xFF; {
+		marker := data[at+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		end := at + 2 + int(binary.BigEndian.Uint16(data[at+2:]))
+		if end > len(data) {
+			break
+		}
+		if segment := data[at+4 : end]; marker == 0xED && bytes.HasPrefix(segment, photoshopHeader) {
+			resources = append(resources, segment[len(photoshopHeader):]...)
+		}
+		at = end
+	}
+
+	// Each resource is 8BIM, its ID, a padded Pascal name, its size and
+	// its padded data
+	for at := 0; at+8 <= len(resources) && string(resources[at:at+4]) == "8BIM"; {
+		id := binary.BigEndian.Uint16(resources[at+4:])
+		at += 6
+		at += (1 + int(resources[at]) + 1) &^ 1
+		if at+4 > len(resources) {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(resources[at:]))
+		at += 4
+		if size < 0 || size > len(resources)-at {
+			break
+		}
+		if id == iptcResource {
+			return resources[at : at+size]
+		}
+		at += (size + 1) &^ 1
+	}
+	return nil
+}
+
+// parseIPTC reads the title, description and keywords of IPTC records.
+// Values are UTF-8 when the records say so or are valid UTF-8, and
+// ISO 8859-1 otherwise.
+func parseIPTC(records []byte) Catalog {
+	var catalog Catalog
+	utf8Records := false
+	for at := 0; at+5 <= len(records) && records[at] == 0x1C; {
+		record, dataset := records[at+1], records[at+2]
+		size := int(binary.BigEndian.Uint16(records[at+3:]))
+		at += 5
+		// Extended datasets are never used for these values
+		if size&0x8000 != 0 || size > len(records)-at {
+			break
+		}
+		value := records[at : at+size]
+		at += size
+
+		if record == 1 && dataset == iptcCharset {
+			utf8Records = bytes.Equal(value, []byte("\x1b%G"))
+			continue
+		}
+		if record != 2 {
+			continue
+		}
+		text := strings.TrimSpace(iptcString(value, utf8Records))
+		switch dataset {
+		case iptcTitle:
+			catalog.Title = text
+		case iptcDescription:
+			catalog.Description = text
+		case iptcKeywords:
+			if text != "" {
+				catalog.Keywords = append(catalog.Keywords, text)
+			}
+		}
+	}
+	return catalog
+}
+
+// iptcString decodes an IPTC value
+func iptcString(value []byte, utf8Records bool) string {
+	if utf8Records || utf8.Valid(value) {
+		return string(value)
+	}
+	runes := make([]rune, len(value))
+	for i, b := range value {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// iptcRecords returns the IPTC records of catalog in UTF-8, cut to the
+// sizes IPTC allows
+func iptcRecords(catalog Catalog) []byte {
+	var records []byte
+	add := func(record, dataset byte, value string, limit int) {
+		value = truncateUTF8(value, limit)
+		records = append(records, 0x1C, record, dataset)
+		records = binary.BigEndian.AppendUint16(records, uint16(len(value)))
+		records = append(records, value...)
+	}
+	add(1, iptcCharset, "\x1b%G", 3)
+	// Record version 4
+	add(2, 0, "\x00\x04", 2)
+	if catalog.Title != "" {
+		add(2, iptcTitle, catalog.Title, maxIPTCTitle)
+	}
+	for _, keyword := range catalog.Keywords {
+		add(2, iptcKeywords, keyword, maxIPTCKeyword)
+	}
+	if catalog.Description != "" {
+		add(2, iptcDescription, catalog.Description, maxIPTCDescription)
+	}
+	return records
+}
+
+// truncateUTF8 cuts s to at most limit bytes without splitting a character
+func truncateUTF8(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
+
+// jpegWithIPTC inserts a Photoshop APP13 segment with the IPTC records
+// after the SOI marker and any JFIF header
+func jpegWithIPTC(data, records []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("not a JPEG file")
+	}
+
+	// One resource without a name
+	resource := binary.BigEndian.AppendUint16([]byte("8BIM"), iptcResource)
+	resource = append(resource, 0, 0)
+	resource = binary.BigEndian.AppendUint32(resource, uint32(len(records)))
+	resource = append(resource, records...)
+	if len(records)%2 == 1 {
+		resource = append(resource, 0)
+	}
+	if 2+len(photoshopHeader)+len(resource) > 0xFFFF {
+		return nil, errIPTCSize
+	}
+
+	at := 2
+	if data[2] == 0xFF && data[3] == 0xE0 && len(data) >= 6 {
+		at += 2 + int(binary.BigEndian.Uint16(data[4:6]))
+	}
+
+	segment := []byte{0xFF, 0xED, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+len(photoshopHeader)+len(resource)))
+	segment = append(append(segment, photoshopHeader...), resource...)
+	return splice(data, at, segment), nil
+}
+
+// embedIPTC adds the IPTC records of catalog to the JPEG output at path
+func embedIPTC(path string, catalog Catalog) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if data, err = jpegWithIPTC(data, iptcRecords(catalog)); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
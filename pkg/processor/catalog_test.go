@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseXMPCatalog(t *testing.T) {
+	lightroom := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmp:Rating="4">
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">Harbor at dusk</rdf:li><rdf:li xml:lang="de">Hafen</rdf:li></rdf:Alt></dc:title>
+   <dc:subject><rdf:Bag><rdf:li>harbor</rdf:li><rdf:li>boats &amp; sea</rdf:li></rdf:Bag></dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`)
+	element := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/"><xmp:Rating>-1</xmp:Rating></rdf:Description></rdf:RDF></x:xmpmeta>`)
+	catalog := Catalog{Title: `"Q" <1>`, Description: "A & B", Keywords: []string{"one", "two"}, Rating: 5}
+
+	tests := []struct {
+		name     string
+		packet   []byte
+		expected Catalog
+	}{
+		{"Attribute rating and alternatives", lightroom, Catalog{Title: "Harbor at dusk", Keywords: []string{"harbor", "boats & sea"}, Rating: 4}},
+		{"Element rating", element, Catalog{Rating: -1}},
+		{"Written by outputXMP", outputXMP(catalog, []string{"encode jpg"}, "tools", time.Now(), time.Time{}), catalog},
+		{"Processing log only", outputXMP(Catalog{}, []string{"encode jpg"}, "tools", time.Now(), time.Time{}), Catalog{}},
+	}
+	for _, test := range tests {
+		if got := parseXMPCatalog(test.packet); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: parseXMPCatalog() = %+v, expected %+v", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestParseIPTC(t *testing.T) {
+	catalog := Catalog{Title: "Küste", Description: strings.Repeat("d", 3000), Keywords: []string{"sea", strings.Repeat("ü", 40)}}
+	got := parseIPTC(iptcRecords(catalog))
+	if got.Title != "Küste" || len(got.Description) != maxIPTCDescription {
+		t.Errorf("parseIPTC() = %q with a %d byte description, expected Küste and %d bytes", got.Title, len(got.Description), maxIPTCDescription)
+	}
+	if len(got.Keywords) != 2 || got.Keywords[1] != strings.Repeat("ü", 32) {
+		t.Errorf("parseIPTC() keywords = %q, expected the second cut to 32 characters", got.Keywords)
+	}
+
+	// Records without a character set in ISO 8859-1
+	latin1 := []byte{0x1C, 2, iptcTitle, 0, 5, 'K', 0xFC, 's', 't', 'e'}
+	if got := parseIPTC(latin1); got.Title != "Küste" {
+		t.Errorf("parseIPTC() of ISO 8859-1 = %q, expected Küste", got.Title)
+	}
+	if got := parseIPTC([]byte{0x1C, 2, iptcTitle, 0, 9, 'x'}); !got.empty() {
+		t.Errorf("parseIPTC() of truncated records = %+v, expected nothing", got)
+	}
+}
+
+func TestProcessKeepCatalog(t *testing.T) {
+	tempDir := t.TempDir()
+	outDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	// Keywords from IPTC, the title and rating from XMP
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 40, 20)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	data, err := jpegWithIPTC(buf.Bytes(), iptcRecords(Catalog{Title: "IPTC title", Keywords: []string{"alps", "snow"}}))
+	if err != nil {
+		t.Fatalf("jpegWithIPTC() error = %v", err)
+	}
+	if data, err = jpegWithXMP(data, outputXMP(Catalog{Title: "XMP title", Rating: 3}, nil, "", time.Time{}, time.Time{})); err != nil {
+		t.Fatalf("jpegWithXMP() error = %v", err)
+	}
+	inputPath := filepath.Join(tempDir, "photo.jpg")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+	expected := Catalog{Title: "XMP title", Keywords: []string{"alps", "snow"}, Rating: 3}
+	if got, err := ReadCatalog(inputPath); err != nil || !reflect.DeepEqual(got, expected) {
+		t.Fatalf("ReadCatalog() = %+v, %v, expected %+v", got, err, expected)
+	}
+
+	tests := []struct {
+		name     string
+		options  []Option
+		expected Catalog
+	}{
+		{"JPEG", nil, expected},
+		{"PNG", []Option{WithFormat("png")}, expected},
+		{"JPEG with a processing log", []Option{WithMetadataPolicy(MetadataProcessingLog, "tools")}, expected},
+		{"Stripped", []Option{WithMetadataPolicy(MetadataStrip, "")}, Catalog{}},
+	}
+	for _, test := range tests {
+		p, err := New(append([]Option{WithOutputDir(outDir), WithExistingPolicy(ExistingOverwrite)}, test.options...)...)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		result, err := p.Process(inputPath)
+		if err != nil {
+			t.Fatalf("%s: Process() error = %v", test.name, err)
+		}
+		if got, _ := ReadCatalog(result.OutputPath); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: output catalog = %+v, expected %+v", test.name, got, test.expected)
+		}
+	}
+
+	// JPEG outputs also carry the IPTC records for readers without XMP
+	p, _ := New(WithOutputDir(outDir), WithExistingPolicy(ExistingOverwrite))
+	result, err := p.Process(inputPath)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	out, _ := os.ReadFile(result.OutputPath)
+	if got := parseIPTC(jpegIPTC(out)); got.Title != "XMP title" || len(got.Keywords) != 2 {
+		t.Errorf("output IPTC = %+v, expected the catalog", got)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("output no longer decodes: %v", err)
+	}
+}
@@ -0,0 +1,478 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ColorProfile is an RGB color space defined by primaries and tone curves,
+// as in a matrix/TRC ICC profile
+type ColorProfile struct {
+	Name string
+	// toXYZ maps linear RGB to D50 XYZ, the ICC connection space
+	toXYZ [3][3]float64
+	// decode maps encoded channel values to linear light, per channel
+	decode [3]func(float64) float64
+}
+
+// srgbDecode is the sRGB tone curve
+func srgbDecode(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// srgbEncode is the inverse of srgbDecode
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func gammaDecode(gamma float64) func(float64) float64 {
+	return func(v float64) float64 { return math.Pow(v, gamma) }
+}
+
+func sameCurves(f func(float64) float64) [3]func(float64) float64 {
+	return [3]func(float64) float64{f, f, f}
+}
+
+// srgbProfile is the output color space
+var srgbProfile = &ColorProfile{
+	Name: "srgb",
+	toXYZ: [3][3]float64{
+		{0.4360747, 0.3850649, 0.1430804},
+		{0.2225045, 0.7168786, 0.0606169},
+		{0.0139322, 0.0971045, 0.7141733},
+	},
+	decode: sameCurves(srgbDecode),
+}
+
+// namedProfiles are the built-in color spaces, with D50 adapted primaries
+var namedProfiles = map[string]*ColorProfile{
+	"srgb": srgbProfile,
+	"adobergb": {
+		Name: "adobergb",
+		toXYZ: [3][3]float64{
+			{0.6097559, 0.2052401, 0.1492240},
+			{0.3111242, 0.6256560, 0.0632197},
+			{0.0194811, 0.0608902, 0.7448387},
+		},
+		decode: sameCurves(gammaDecode(563.0 / 256)),
+	},
+	"displayp3": {
+		Name: "displayp3",
+		toXYZ: [3][3]float64{
+			{0.5151187, 0.2919778, 0.1571035},
+			{0.2411892, 0.6922441, 0.0665668},
+			{-0.0010505, 0.0418791, 0.7840713},
+		},
+		decode: sameCurves(srgbDecode),
+	},
+	"prophoto": {
+		Name: "prophoto",
+		toXYZ: [3][3]float64{
+			{0.7976749, 0.1351917, 0.0313534},
+			{0.2880402, 0.7118741, 0.0000857},
+			{0.0000000, 0.0000000, 0.8252100},
+		},
+		decode: sameCurves(gammaDecode(1.8)),
+	},
+}
+
+// ColorProfileNames returns the names of the built-in color profiles
+func ColorProfileNames() []string {
+	return []string{"srgb", "adobergb", "displayp3", "prophoto"}
+}
+
+// OpenColorProfile returns the built-in profile called name, or else loads
+// the ICC profile file at name
+func OpenColorProfile(name string) (*ColorProfile, error) {
+	if profile, ok := namedProfiles[strings.ToLower(name)]; ok {
+		return profile, nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("not a built-in profile or readable ICC file: %s", name)
+	}
+	profile, err := parseICCProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(name), err)
+	}
+	profile.Name = filepath.Base(name)
+	return profile, nil
+}
+
+// parseICCProfile reads a matrix/TRC RGB ICC profile
+func parseICCProfile(data []byte) (*ColorProfile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, errors.New("not an ICC profile")
+	}
+	if string(data[16:20]) != "RGB " {
+		return nil, errors.New("not an RGB profile")
+	}
+
+	// Index the tag table
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(data[128:132]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(data) {
+			return nil, errors.New("truncated tag table")
+		}
+		offset := int(binary.BigEndian.Uint32(data[entry+4:]))
+		size := int(binary.BigEndian.Uint32(data[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, errors.New("tag outside profile")
+		}
+		tags[string(data[entry:entry+4])] = data[offset : offset+size]
+	}
+
+	profile := &ColorProfile{}
+	for i, prefix := range []string{"r", "g", "b"} {
+		xyz, ok := tags[prefix+"XYZ"]
+		if !ok || len(xyz) < 20 || string(xyz[0:4]) != "XYZ " {
+			return nil, errors.New("only matrix/TRC profiles are supported")
+		}
+		for row := 0; row < 3; row++ {
+			profile.toXYZ[row][i] = s15Fixed16(xyz[8+row*4:])
+		}
+
+		curve, err := parseICCCurve(tags[prefix+"TRC"])
+		if err != nil {
+			return nil, err
+		}
+		profile.decode[i] = curve
+	}
+	return profile, nil
+}
+
+// parseICCCurve reads a curv or para tone curve
+func parseICCCurve(tag []byte) (func(float64) float64, error) {
+	if len(tag) < 12 {
+		return nil, errors.New("only matrix/TRC profiles are supported")
+	}
+
+	switch string(tag[0:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:12]))
+		if len(tag) < 12+2*n {
+			return nil, errors.New("truncated tone curve")
+		}
+		switch n {
+		case 0:
+			return func(v float64) float64 { return v }, nil
+		case 1:
+			return gammaDecode(float64(binary.BigEndian.Uint16(tag[12:])) / 256), nil
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+		}
+		return func(v float64) float64 {
+			pos := v * float64(n-1)
+			i := int(pos)
+			if i >= n-1 {
+				return table[n-1]
+			}
+			return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+		}, nil
+
+	case "para":
+		// Parameter counts of function types 0 to 4
+		counts := []int{1, 3, 4, 5, 7}
+		kind := int(binary.BigEndian.Uint16(tag[8:10]))
+		if kind >= len(counts) || len(tag) < 12+4*counts[kind] {
+			return nil, errors.New("unsupported parametric curve")
+		}
+		p := make([]float64, 7)
+		for i := 0; i < counts[kind]; i++ {
+			p[i] = s15Fixed16(tag[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		return func(v float64) float64 {
+			switch kind {
+			case 0:
+				return math.Pow(v, g)
+			case 1:
+				if v >= -b/a {
+					return math.Pow(a*v+b, g)
+				}
+				return 0
+			case 2:
+				if v >= -b/a {
+					return math.Pow(a*v+b, g) + c
+				}
+				return c
+			case 3:
+				if v >= d {
+					return math.Pow(a*v+b, g)
+				}
+				return c * v
+			}
+			if v >= d {
+				return math.Pow(a*v+b, g) + e
+			}
+			return c*v + f
+		}, nil
+	}
+	return nil, errors.New("only matrix/TRC profiles are supported")
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// convertToSRGB converts img, whose pixels are in profile, to sRGB
+func convertToSRGB(img image.Image, profile *ColorProfile) image.Image {
+	if profile == srgbProfile {
+		return img
+	}
+
+	// Linear profile RGB to linear sRGB through XYZ
+	m := mulMatrix(invertMatrix(srgbProfile.toXYZ), profile.toXYZ)
+
+	// Lookup tables for 8-bit channels and for encoding linear values
+	var decode [3][256]float64
+	for c := 0; c < 3; c++ {
+		for i := 0; i < 256; i++ {
+			decode[c][i] = profile.decode[c](float64(i) / 255)
+		}
+	}
+	const encodeSize = 4096
+	var encode [encodeSize + 1]uint8
+	for i := range encode {
+		encode[i] = uint8(math.Round(srgbEncode(float64(i)/encodeSize) * 255))
+	}
+
+	bounds := img.Bounds()
+	out := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			r, g, b := decode[0][c.R], decode[1][c.G], decode[2][c.B]
+			var px [3]uint8
+			for i := 0; i < 3; i++ {
+				v := m[i][0]*r + m[i][1]*g + m[i][2]*b
+				px[i] = encode[int(math.Round(math.Max(0, math.Min(1, v))*encodeSize))]
+			}
+			out.SetNRGBA(x, y, color.NRGBA{px[0], px[1], px[2], c.A})
+		}
+	}
+	return out
+}
+
+func mulMatrix(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func invertMatrix(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	var inv [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// Cofactor of m[j][i]
+			r1, r2 := (j+1)%3, (j+2)%3
+			c1, c2 := (i+1)%3, (i+2)%3
+			inv[i][j] = (m[r1][c1]*m[r2][c2] - m[r1][c2]*m[r2][c1]) / det
+		}
+	}
+	return inv
+}
+
+// hasEmbeddedProfile reports whether the file at path declares its color
+// space, through an ICC profile or a format-specific tag
+func hasEmbeddedProfile(path string) bool {
+	file, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return bytes.Contains(data, []byte("ICC_PROFILE\x00"))
+	case ".png":
+		return pngHasProfile(data)
+	case ".webp":
+		return len(data) >= 21 && string(data[12:16]) == "VP8X" && data[20]&0x20 != 0
+	case ".heic", ".heif", ".avif":
+		// Color information box, either an ICC profile or nclx
+		return bytes.Contains(data, []byte("colr"))
+	case ".gif":
+		return bytes.Contains(data, []byte("ICCRGBG1012"))
+	case ".tif", ".tiff":
+		return tiffHasProfile(data)
+	}
+	return false
+}
+
+// embeddedProfile returns the matrix/TRC ICC profile embedded in the JPEG
+// or PNG file at path, or nil if it has none or another kind of profile
+func embeddedProfile(path string) *ColorProfile {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var icc []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		icc = jpegICCProfile(data)
+	case ".png":
+		icc = pngICCProfile(data)
+	}
+	if icc == nil {
+		return nil
+	}
+	profile, err := parseICCProfile(icc)
+	if err != nil {
+		return nil
+	}
+	profile.Name = "embedded"
+	return profile
+}
+
+// jpegICCProfile joins the chunks of the ICC profile in the APP2 segments
+// of a JPEG, or returns nil
+func jpegICCProfile(data []byte) []byte {
+	const marker = "ICC_PROFILE\x00"
+	chunks := make(map[byte][]byte)
+	var count byte
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		// Segments end at the start of the scan
+		kind := data[pos+1]
+		if kind == 0xDA {
+			break
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if size < 2 || pos+2+size > len(data) {
+			return nil
+		}
+		segment := data[pos+4 : pos+2+size]
+		if kind == 0xE2 && len(segment) > len(marker)+2 && string(segment[:len(marker)]) == marker {
+			chunks[segment[len(marker)]] = segment[len(marker)+2:]
+			count = segment[len(marker)+1]
+		}
+		pos += 2 + size
+	}
+
+	// Chunks are numbered from 1
+	var icc []byte
+	for i := byte(1); i <= count && count > 0; i++ {
+		chunk, ok := chunks[i]
+		if !ok {
+			return nil
+		}
+		icc = append(icc, chunk...)
+	}
+	return icc
+}
+
+// pngICCProfile returns the decompressed profile of the iCCP chunk of a
+// PNG, or nil
+func pngICCProfile(data []byte) []byte {
+	for pos := 8; pos+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		if size < 0 || pos+12+size > len(data) {
+			return nil
+		}
+		switch string(data[pos+4 : pos+8]) {
+		case "iCCP":
+			// Profile name, a NUL, the compression method and zlib data
+			chunk := data[pos+8 : pos+8+size]
+			name := bytes.IndexByte(chunk, 0)
+			if name < 0 || name+2 > len(chunk) {
+				return nil
+			}
+			r, err := zlib.NewReader(bytes.NewReader(chunk[name+2:]))
+			if err != nil {
+				return nil
+			}
+			defer r.Close()
+			icc, err := io.ReadAll(r)
+			if err != nil {
+				return nil
+			}
+			return icc
+		case "IDAT":
+			return nil
+		}
+		pos += 12 + size
+	}
+	return nil
+}
+
+// pngHasProfile reports whether a PNG has an iCCP or sRGB chunk before its
+// image data
+func pngHasProfile(data []byte) bool {
+	for pos := 8; pos+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		switch string(data[pos+4 : pos+8]) {
+		case "iCCP", "sRGB":
+			return true
+		case "IDAT":
+			return false
+		}
+		pos += 12 + size
+	}
+	return false
+}
+
+// tiffHasProfile reports whether the first image of a TIFF has an ICC
+// profile tag
+func tiffHasProfile(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	var order binary.ByteOrder
+	switch string(data[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+	ifd := int(order.Uint32(data[4:]))
+	if ifd < 0 || ifd+2 > len(data) {
+		return false
+	}
+	count := int(order.Uint16(data[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+2 > len(data) {
+			return false
+		}
+		if order.Uint16(data[entry:]) == 34675 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertToSRGB(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.NRGBA{255, 255, 255, 255})
+	img.Set(1, 0, color.NRGBA{0, 0, 0, 255})
+	img.Set(2, 0, color.NRGBA{0, 255, 0, 255})
+	img.Set(3, 0, color.NRGBA{128, 128, 128, 128})
+
+	profile, err := OpenColorProfile("adobergb")
+	if err != nil {
+		t.Fatalf("OpenColorProfile() error = %v", err)
+	}
+	out := convertToSRGB(img, profile)
+
+	tests := []struct {
+		name     string
+		x        int
+		expected color.NRGBA
+	}{
+		{"White stays white", 0, color.NRGBA{255, 255, 255, 255}},
+		{"Black stays black", 1, color.NRGBA{0, 0, 0, 255}},
+		{"AdobeRGB green is out of sRGB gamut", 2, color.NRGBA{0, 255, 0, 255}},
+		{"Gray stays gray and keeps alpha", 3, color.NRGBA{128, 128, 128, 128}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := color.NRGBAModel.Convert(out.At(test.x, 0)).(color.NRGBA)
+			for i, v := range []uint8{c.R - test.expected.R, c.G - test.expected.G, c.B - test.expected.B} {
+				if v > 2 && v < 254 {
+					t.Errorf("channel %d of %v, expected %v", i, c, test.expected)
+				}
+			}
+			if c.A != test.expected.A {
+				t.Errorf("alpha = %d, expected %d", c.A, test.expected.A)
+			}
+		})
+	}
+
+	// A muted AdobeRGB red becomes more saturated in sRGB
+	img.Set(0, 0, color.NRGBA{180, 60, 60, 255})
+	c := color.NRGBAModel.Convert(convertToSRGB(img, profile).At(0, 0)).(color.NRGBA)
+	if int(c.R)-int(c.G) <= 120 {
+		t.Errorf("converted red = %v, expected more saturated than the source", c)
+	}
+
+	if convertToSRGB(img, srgbProfile) != image.Image(img) {
+		t.Error("convertToSRGB() to sRGB changed the image")
+	}
+}
+
+func TestInvertMatrix(t *testing.T) {
+	m := mulMatrix(srgbProfile.toXYZ, invertMatrix(srgbProfile.toXYZ))
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			expected := 0.0
+			if i == j {
+				expected = 1
+			}
+			if math.Abs(m[i][j]-expected) > 1e-9 {
+				t.Fatalf("m * inverse(m) = %v, expected identity", m)
+			}
+		}
+	}
+}
+
+// iccProfile builds a minimal matrix/TRC profile with the primaries of p
+// and a gamma curve
+func iccProfile(p *ColorProfile, gamma float64) []byte {
+	var tags bytes.Buffer
+	type entry struct {
+		sig  string
+		data []byte
+	}
+	var entries []entry
+	for i, prefix := range []string{"r", "g", "b"} {
+		xyz := make([]byte, 20)
+		copy(xyz, "XYZ ")
+		for row := 0; row < 3; row++ {
+			binary.BigEndian.PutUint32(xyz[8+row*4:], uint32(int32(math.Round(p.toXYZ[row][i]*65536))))
+		}
+		curv := make([]byte, 14)
+		copy(curv, "curv")
+		binary.BigEndian.PutUint32(curv[8:], 1)
+		binary.BigEndian.PutUint16(curv[12:], uint16(gamma*256))
+		entries = append(entries, entry{prefix + "XYZ", xyz}, entry{prefix + "TRC", curv})
+	}
+
+	header := make([]byte, 128)
+	copy(header[16:], "RGB ")
+	copy(header[36:], "acsp")
+	table := make([]byte, 4+12*len(entries))
+	binary.BigEndian.PutUint32(table, uint32(len(entries)))
+	offset := len(header) + len(table)
+	for i, e := range entries {
+		copy(table[4+i*12:], e.sig)
+		binary.BigEndian.PutUint32(table[8+i*12:], uint32(offset+tags.Len()))
+		binary.BigEndian.PutUint32(table[12+i*12:], uint32(len(e.data)))
+		tags.Write(e.data)
+		for tags.Len()%4 != 0 {
+			tags.WriteByte(0)
+		}
+	}
+	return append(append(header, table...), tags.Bytes()...)
+}
+
+func TestOpenColorProfile(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "AdobeRGB1998.icc")
+	adobe := namedProfiles["adobergb"]
+	if err := os.WriteFile(path, iccProfile(adobe, 2.2), 0644); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	notICC := filepath.Join(tempDir, "notes.icc")
+	if err := os.WriteFile(notICC, []byte("not a profile"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	profile, err := OpenColorProfile(path)
+	if err != nil {
+		t.Fatalf("OpenColorProfile() error = %v", err)
+	}
+	if profile.Name != "AdobeRGB1998.icc" {
+		t.Errorf("Name = %s, expected AdobeRGB1998.icc", profile.Name)
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(profile.toXYZ[i][j]-adobe.toXYZ[i][j]) > 1e-4 {
+				t.Errorf("toXYZ[%d][%d] = %g, expected %g", i, j, profile.toXYZ[i][j], adobe.toXYZ[i][j])
+			}
+		}
+	}
+	if v := profile.decode[0](0.5); math.Abs(v-math.Pow(0.5, 2.2)) > 1e-3 {
+		t.Errorf("decode(0.5) = %g, expected %g", v, math.Pow(0.5, 2.2))
+	}
+
+	for _, name := range []string{notICC, filepath.Join(tempDir, "missing.icc"), "rec2020"} {
+		if _, err := OpenColorProfile(name); err == nil {
+			t.Errorf("OpenColorProfile(%s) expected error, got nil", name)
+		}
+	}
+}
+
+func TestHasEmbeddedProfile(t *testing.T) {
+	tempDir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	untagged := filepath.Join(tempDir, "untagged.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	if err := os.WriteFile(untagged, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write PNG: %v", err)
+	}
+
+	// Insert an sRGB chunk after IHDR
+	data := buf.Bytes()
+	ihdrEnd := 8 + 12 + int(binary.BigEndian.Uint32(data[8:]))
+	srgb := []byte{0, 0, 0, 1, 's', 'R', 'G', 'B', 0, 0, 0, 0, 0}
+	tagged := filepath.Join(tempDir, "tagged.png")
+	taggedData := append(append(append([]byte(nil), data[:ihdrEnd]...), srgb...), data[ihdrEnd:]...)
+	if err := os.WriteFile(tagged, taggedData, 0644); err != nil {
+		t.Fatalf("Failed to write PNG: %v", err)
+	}
+
+	taggedJPG := filepath.Join(tempDir, "tagged.jpg")
+	if err := os.WriteFile(taggedJPG, []byte("\xff\xd8\xff\xe2\x00\x10ICC_PROFILE\x00\x01\x01"), 0644); err != nil {
+		t.Fatalf("Failed to write JPG: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{untagged, false},
+		{tagged, true},
+		{taggedJPG, true},
+		{filepath.Join(tempDir, "missing.jpg"), false},
+	}
+
+	for _, test := range tests {
+		if result := hasEmbeddedProfile(test.path); result != test.expected {
+			t.Errorf("hasEmbeddedProfile(%s) = %v, expected %v", filepath.Base(test.path), result, test.expected)
+		}
+	}
+}
+
+func TestEmbeddedProfile(t *testing.T) {
+	tempDir := t.TempDir()
+	icc := iccProfile(namedProfiles["adobergb"], 2.2)
+
+	// The profile split over two APP2 segments, in reverse order
+	app2 := func(seq byte, chunk []byte) []byte {
+		segment := []byte{0xFF, 0xE2, 0, 0}
+		binary.BigEndian.PutUint16(segment[2:], uint16(2+14+len(chunk)))
+		segment = append(append(segment, "ICC_PROFILE\x00"...), seq, 2)
+		return append(segment, chunk...)
+	}
+	half := len(icc) / 2
+	jpg := append([]byte{0xFF, 0xD8}, app2(2, icc[half:])...)
+	jpg = append(jpg, app2(1, icc[:half])...)
+	jpg = append(jpg, 0xFF, 0xDA, 0, 2)
+	partial := append(append([]byte{0xFF, 0xD8}, app2(2, icc[half:])...), 0xFF, 0xDA, 0, 2)
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(icc)
+	zw.Close()
+	chunk := append([]byte("AdobeRGB\x00\x00"), compressed.Bytes()...)
+	pngData := []byte("\x89PNG\r\n\x1a\n")
+	pngData = binary.BigEndian.AppendUint32(pngData, uint32(len(chunk)))
+	pngData = append(append(append(pngData, "iCCP"...), chunk...), 0, 0, 0, 0)
+
+	tests := []struct {
+		file     string
+		data     []byte
+		expected bool
+	}{
+		{"tagged.jpg", jpg, true},
+		{"partial.jpg", partial, false},
+		{"tagged.png", pngData, true},
+		{"untagged.jpg", []byte("\xff\xd8\xff\xd9"), false},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(tempDir, test.file)
+		if err := os.WriteFile(path, test.data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		profile := embeddedProfile(path)
+		if (profile != nil) != test.expected {
+			t.Errorf("embeddedProfile(%s) = %v, expected a profile %t", test.file, profile, test.expected)
+			continue
+		}
+		if profile != nil && math.Abs(profile.toXYZ[0][0]-namedProfiles["adobergb"].toXYZ[0][0]) > 1e-4 {
+			t.Errorf("embeddedProfile(%s) primaries = %v", test.file, profile.toXYZ)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Color space tags of Config.ColorTag
+const (
+	ColorTagSRGB = "srgb"
+	ColorTagCICP = "cicp"
+	ColorTagNone = "none"
+)
+
+// colorTags are the color space tags
+var colorTags = []string{ColorTagSRGB, ColorTagCICP, ColorTagNone}
+
+// ColorTags returns the color space tags
+func ColorTags() []string {
+	return append([]string(nil), colorTags...)
+}
+
+// IsSupportedColorTag reports whether tag is a color space tag
+func IsSupportedColorTag(tag string) bool {
+	for _, t := range colorTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// canTagColor reports whether outputs of format are tagged by ColorTag.
+// JPEG and GIF readers take untagged files as sRGB, AVIF and HEIC carry
+// the color space libheif writes.
+func canTagColor(format string) bool {
+	return format == "png" || format == "webp"
+}
+
+// srgbOutput reports whether the outputs of inputPath with config hold
+// sRGB pixels: inputs without a profile are taken as sRGB, like browsers
+// do, and tagged inputs keep their pixels unless converted
+func srgbOutput(inputPath string, config Config) bool {
+	if config.embedded != nil || config.AssumeProfile != nil || !hasEmbeddedProfile(inputPath) {
+		return true
+	}
+	if profile := embeddedProfile(inputPath); profile != nil {
+		return profile.isSRGB()
+	}
+	// PNGs declare sRGB by a chunk instead of a profile
+	if strings.ToLower(filepath.Ext(inputPath)) == ".png" {
+		data, err := os.ReadFile(inputPath)
+		return err == nil && pngICCProfile(data) == nil && pngHasProfile(data)
+	}
+	return false
+}
+
+// isSRGB reports whether p has the primaries and tone curve of sRGB, to
+// the precision of ICC profiles
+func (p *ColorProfile) isSRGB() bool {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(p.toXYZ[i][j]-srgbProfile.toXYZ[i][j]) > 0.001 {
+				return false
+			}
+		}
+		for _, v := range []float64{0.02, 0.2, 0.5, 0.8} {
+			if math.Abs(p.decode[i](v)-srgbDecode(v)) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// tagOutputs marks the outputs of inputPath as sRGB as config.ColorTag
+// selects. Outputs whose pixels keep another color space stay untagged, as
+// do comic archives, whose pages are packed already.
+func tagOutputs(inputPath string, outputs []string, format string, config Config) error {
+	if config.ColorTag == "" || config.ColorTag == ColorTagNone || !canTagColor(format) || isComicArchive(inputPath) {
+		return nil
+	}
+	if !srgbOutput(inputPath, config) {
+		config.logger().Debug("Color space not tagged, the embedded profile is kept", "input", inputPath)
+		return nil
+	}
+	for _, output := range outputs {
+		if err := tagColorSpace(output, format, config.ColorTag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagColorSpace marks the output file at path as sRGB: PNGs with sRGB,
+// gAMA and cHRM chunks, and a cICP chunk for ColorTagCICP, and WebPs,
+// which have no such chunk, with a compact sRGB ICC profile
+func tagColorSpace(path, format, tag string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "png":
+		data, err = pngWithColorTag(data, tag == ColorTagCICP)
+	case "webp":
+		data, err = webpWithICC(data, srgbICC())
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// pngWithColorTag inserts the chunks that declare sRGB after the IHDR
+// chunk: sRGB with the perceptual intent, and gAMA and cHRM with its gamma
+// and primaries for readers that ignore it, as the PNG specification
+// recommends. With cicp a cICP chunk names the BT.709 primaries and the
+// sRGB transfer function.
+func pngWithColorTag(data []byte, cicp bool) ([]byte, error) {
+	const ihdrEnd = 8 + 8 + 13 + 4
+	if len(data) < ihdrEnd || string(data[12:16]) != "IHDR" {
+		return nil, errors.New("not a PNG file")
+	}
+
+	var chunks []byte
+	if cicp {
+		chunks = append(chunks, pngChunk("cICP", []byte{1, 13, 0, 1})...)
+	}
+	chunks = append(chunks, pngChunk("sRGB", []byte{0})...)
+	chunks = append(chunks, pngChunk("gAMA", binary.BigEndian.AppendUint32(nil, 45455))...)
+	var chrm []byte
+	// White point, then red, green and blue, as x and y times 100000
+	for _, v := range []uint32{31270, 32900, 64000, 33000, 30000, 60000, 15000, 6000} {
+		chrm = binary.BigEndian.AppendUint32(chrm, v)
+	}
+	chunks = append(chunks, pngChunk("cHRM", chrm)...)
+	return splice(data, ihdrEnd, chunks), nil
+}
+
+// pngChunk returns a PNG chunk of kind with data and its CRC
+func pngChunk(kind string, data []byte) []byte {
+	body := append([]byte(kind), data...)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, body...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body))
+}
+
+// webpWithICC adds an ICCP chunk with the profile icc after the VP8X chunk,
+// where the format requires it
+func webpWithICC(data, icc []byte) ([]byte, error) {
+	chunks, err := extendedWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	chunks[0].data[0] |= webpICCFlag
+
+	var body bytes.Buffer
+	writeWebPChunk(&body, chunks[0].id, chunks[0].data)
+	writeWebPChunk(&body, "ICCP", icc)
+	for _, chunk := range chunks[1:] {
+		if chunk.id != "ICCP" {
+			writeWebPChunk(&body, chunk.id, chunk.data)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeWebPFile(&out, body.Bytes()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// srgbICC returns a compact ICC v4 display profile of sRGB: its D50
+// adapted primaries, the parametric sRGB tone curve shared by the three
+// channels, and the chromatic adaptation from its D65 white
+func srgbICC() []byte {
+	xyz := func(x, y, z float64) []byte {
+		return appendS15Fixed16([]byte("XYZ \x00\x00\x00\x00"), x, y, z)
+	}
+	m := srgbProfile.toXYZ
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", iccText("sRGB")},
+		{"cprt", iccText("No copyright, use freely")},
+		{"wtpt", xyz(0.9642, 1, 0.8249)},
+		{"chad", appendS15Fixed16([]byte("sf32\x00\x00\x00\x00"),
+			1.0478112, 0.0228866, -0.0501270,
+			0.0295424, 0.9904844, -0.0170491,
+			-0.0092345, 0.0150436, 0.7521316)},
+		{"rXYZ", xyz(m[0][0], m[1][0], m[2][0])},
+		{"gXYZ", xyz(m[0][1], m[1][1], m[2][1])},
+		{"bXYZ", xyz(m[0][2], m[1][2], m[2][2])},
+		// Function type 3 with g, a, b, c and d of the sRGB curve
+		{"rTRC", appendS15Fixed16([]byte("para\x00\x00\x00\x00\x00\x03\x00\x00"), 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)},
+		{"gTRC", nil},
+		{"bTRC", nil},
+	}
+
+	// Header, tag table, then the tag data 4-byte aligned. The green and
+	// blue curves point at the red one.
+	table := 128 + 4 + 12*len(tags)
+	profile := make([]byte, table)
+	binary.BigEndian.PutUint32(profile[128:], uint32(len(tags)))
+	var trc [2]uint32
+	for i, tag := range tags {
+		entry := profile[132+12*i:]
+		copy(entry, tag.sig)
+		if tag.data == nil {
+			binary.BigEndian.PutUint32(entry[4:], trc[0])
+			binary.BigEndian.PutUint32(entry[8:], trc[1])
+			continue
+		}
+		offset := uint32(len(profile))
+		binary.BigEndian.PutUint32(entry[4:], offset)
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(tag.data)))
+		if tag.sig == "rTRC" {
+			trc = [2]uint32{offset, uint32(len(tag.data))}
+		}
+		profile = append(profile, tag.data...)
+		for len(profile)%4 != 0 {
+			profile = append(profile, 0)
+		}
+	}
+
+	binary.BigEndian.PutUint32(profile[0:], uint32(len(profile)))
+	binary.BigEndian.PutUint32(profile[8:], 0x04300000)
+	copy(profile[12:], "mntrRGB XYZ ")
+	// A fixed creation date keeps outputs reproducible
+	for i, v := range []uint16{2024, 1, 1} {
+		binary.BigEndian.PutUint16(profile[24+2*i:], v)
+	}
+	copy(profile[36:], "acsp")
+	// Perceptual intent and the D50 illuminant of the connection space
+	appendS15Fixed16(profile[68:68], 0.9642, 1, 0.8249)
+	return profile
+}
+
+// iccText returns a multiLocalizedUnicodeType tag with text in English
+func iccText(text string) []byte {
+	tag := []byte("mluc\x00\x00\x00\x00")
+	tag = binary.BigEndian.AppendUint32(tag, 1)
+	tag = binary.BigEndian.AppendUint32(tag, 12)
+	tag = append(tag, "enUS"...)
+	tag = binary.BigEndian.AppendUint32(tag, uint32(2*len(text)))
+	tag = binary.BigEndian.AppendUint32(tag, 28)
+	for _, r := range text {
+		tag = binary.BigEndian.AppendUint16(tag, uint16(r))
+	}
+	return tag
+}
+
+// appendS15Fixed16 appends values to b as ICC s15Fixed16Number
+func appendS15Fixed16(b []byte, values ...float64) []byte {
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+	}
+	return b
+}
@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+func TestSRGBICC(t *testing.T) {
+	profile, err := parseICCProfile(srgbICC())
+	if err != nil {
+		t.Fatalf("parseICCProfile(srgbICC()) error = %v", err)
+	}
+	if !profile.isSRGB() {
+		t.Errorf("srgbICC() primaries = %v, expected those of sRGB", profile.toXYZ)
+	}
+
+	adobe, err := parseICCProfile(iccProfile(namedProfiles["adobergb"], 2.2))
+	if err != nil {
+		t.Fatalf("parseICCProfile() error = %v", err)
+	}
+	if adobe.isSRGB() {
+		t.Error("isSRGB() of Adobe RGB = true, expected false")
+	}
+}
+
+// pngChunkTypes returns the chunk types of a PNG in order
+func pngChunkTypes(data []byte) []string {
+	var kinds []string
+	for pos := 8; pos+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		kinds = append(kinds, string(data[pos+4:pos+8]))
+		pos += 12 + size
+	}
+	return kinds
+}
+
+func TestProcessColorTag(t *testing.T) {
+	tempDir := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	untagged := filepath.Join(tempDir, "untagged.png")
+	if err := os.WriteFile(untagged, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write PNG: %v", err)
+	}
+
+	// The same image with an Adobe RGB profile
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(iccProfile(namedProfiles["adobergb"], 2.2))
+	zw.Close()
+	iccp := pngChunk("iCCP", append([]byte("AdobeRGB\x00\x00"), compressed.Bytes()...))
+	adobe := filepath.Join(tempDir, "adobe.png")
+	if err := os.WriteFile(adobe, splice(buf.Bytes(), 8+8+13+4, iccp), 0644); err != nil {
+		t.Fatalf("Failed to write PNG: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		format   string
+		tag      string
+		toSRGB   bool
+		expected []string
+	}{
+		{"sRGB chunks", untagged, "png", ColorTagSRGB, false, []string{"IHDR", "sRGB", "gAMA", "cHRM", "IDAT", "IEND"}},
+		{"cICP chunk", untagged, "png", ColorTagCICP, false, []string{"IHDR", "cICP", "sRGB", "gAMA", "cHRM", "IDAT", "IEND"}},
+		{"Untagged", untagged, "png", ColorTagNone, false, []string{"IHDR", "IDAT", "IEND"}},
+		// Adobe RGB pixels are not sRGB unless converted
+		{"Kept profile", adobe, "png", ColorTagSRGB, false, []string{"IHDR", "IDAT", "IEND"}},
+		{"Converted profile", adobe, "png", ColorTagSRGB, true, []string{"IHDR", "sRGB", "gAMA", "cHRM", "IDAT", "IEND"}},
+		{"WebP profile", untagged, "webp", ColorTagSRGB, false, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			config := Config{OutputFormat: test.format, MaxWidth: 1920, MaxHeight: 1920, Quality: 90, OutputDir: outputDir, ColorTag: test.tag, ToSRGB: test.toSRGB}
+			result, err := Process(test.input, config)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			data, err := os.ReadFile(result.OutputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+
+			if test.format == "webp" {
+				if !hasEmbeddedProfile(result.OutputPath) {
+					t.Error("Process() WebP output has no ICC profile")
+				}
+				if _, err := xwebp.Decode(bytes.NewReader(data)); err != nil {
+					t.Errorf("Tagged WebP does not decode: %v", err)
+				}
+				return
+			}
+			kinds := pngChunkTypes(data)
+			if len(kinds) != len(test.expected) {
+				t.Fatalf("Process() chunks = %v, expected %v", kinds, test.expected)
+			}
+			for i := range kinds {
+				if kinds[i] != test.expected[i] {
+					t.Fatalf("Process() chunks = %v, expected %v", kinds, test.expected)
+				}
+			}
+			if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+				t.Errorf("Tagged PNG does not decode: %v", err)
+			}
+		})
+	}
+}
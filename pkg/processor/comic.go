@@ -0,0 +1,417 @@
+package processor
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// comicExtensions lists the extensions of comic archives, which hold
+// images as pages
+var comicExtensions = []string{".cbz", ".cbr"}
+
+// maxComicEntry is the most bytes a page of a CBZ may unpack to
+const maxComicEntry = 256 << 20
+
+// maxComicPages and maxComicSize bound the files a comic archive unpacks
+// to and their bytes, so that a small archive cannot fill the disk
+var (
+	maxComicPages       = 10000
+	maxComicSize  int64 = 4 << 30
+)
+
+// comicPollInterval is how often the files unpacked from a CBR are
+// counted while it is extracted
+const comicPollInterval = 100 * time.Millisecond
+
+// errComicTooLarge is returned for comic archives beyond maxComicPages or
+// maxComicSize
+var errComicTooLarge = errors.New("comic archive is too large")
+
+// errEntryTooLarge is returned by copyEntry for entries beyond its limit
+var errEntryTooLarge = errors.New("entry is too large")
+
+// comicExtractors are the tools that can unpack CBR (RAR) archives, in
+// order of preference, with the arguments that extract archive into dir
+var comicExtractors = []struct {
+	name string
+	args func(archive, dir string) []string
+}{
+	{"unrar", func(archive, dir string) []string { return []string{"x", "-o+", "-inul", archive, dir + "/"} }},
+	{"7z", func(archive, dir string) []string { return []string{"x", "-y", "-o" + dir, archive} }},
+	{"bsdtar", func(archive, dir string) []string { return []string{"-xf", archive, "-C", dir} }},
+}
+
+// isComicArchive reports whether path is a CBZ or CBR comic archive
+func isComicArchive(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, comic := range comicExtensions {
+		if ext == comic {
+			return true
+		}
+	}
+	return false
+}
+
+// comicOutputPath returns outputPath with the .cbz extension, as comic
+// archives are always written as CBZ
+func comicOutputPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".cbz"
+}
+
+// ComicExtractor returns the path of the tool that unpacks CBR archives
+func ComicExtractor() (string, error) {
+	for _, tool := range comicExtractors {
+		if path, err := exec.LookPath(tool.name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("reading CBR archives needs unrar, 7z or bsdtar")
+}
+
+// comicPages are the pages of a comic archive unpacked into a temporary
+// directory, in reading order
+type comicPages struct {
+	dir   string
+	files []string
+	// limit is the most pixels of a page, 0 for maxPixels
+	limit int64
+}
+
+// openComic unpacks the pages of the CBZ or CBR archive at path
+func openComic(path string) (*comicPages, error) {
+	dir, err := os.MkdirTemp("", "picture-resize-comic-")
+	if err != nil {
+		return nil, err
+	}
+	comic := &comicPages{dir: dir}
+	if strings.ToLower(filepath.Ext(path)) == ".cbr" {
+		err = comic.extract(path)
+	} else {
+		err = comic.unzip(path)
+	}
+	if err == nil && len(comic.files) == 0 {
+		err = errors.New("comic archive has no pages")
+	}
+	if err != nil {
+		comic.close()
+		return nil, err
+	}
+	sort.Slice(comic.files, func(i, j int) bool {
+		return naturalLess(comic.name(i), comic.name(j))
+	})
+	return comic, nil
+}
+
+// name returns the name of page i inside the archive
+func (c *comicPages) name(i int) string {
+	rel, _ := filepath.Rel(c.dir, c.files[i])
+	return filepath.ToSlash(rel)
+}
+
+// unzip writes the image entries of the CBZ at path into the temporary
+// directory under their archive names
+func (c *comicPages) unzip(path string) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	// Names that clean to the same path, or differ only in case, would
+	// overwrite each other's page
+	used := make(map[string]bool)
+	var total int64
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || !isComicPage(entry.Name) {
+			continue
+		}
+		if len(c.files) == maxComicPages {
+			return fmt.Errorf("%w: more than %d pages", errComicTooLarge, maxComicPages)
+		}
+		name := filepath.Join(c.dir, filepath.FromSlash(uniqueEntryName(cleanEntryName(entry.Name), used)))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		n, err := copyEntry(entry, name, min(maxComicEntry, maxComicSize-total))
+		switch {
+		case errors.Is(err, errEntryTooLarge) && total+maxComicEntry > maxComicSize:
+			return fmt.Errorf("%w: pages of more than %d MiB", errComicTooLarge, maxComicSize>>20)
+		case errors.Is(err, errEntryTooLarge):
+			return fmt.Errorf("%s: page is larger than %d MiB", entry.Name, maxComicEntry>>20)
+		case err != nil:
+			return fmt.Errorf("%s: %v", entry.Name, err)
+		}
+		total += n
+		c.files = append(c.files, name)
+	}
+	return nil
+}
+
+// cleanEntryName returns the archive name of an entry without any part
+// that would leave the directory it is unpacked into
+func cleanEntryName(name string) string {
+	var parts []string
+	for _, part := range strings.Split(strings.ReplaceAll(name, "\\", "/"), "/") {
+		if part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// uniqueEntryName returns name, or name with a -2, -3, ... suffix before
+// its extension if used already holds it regardless of case, and adds the
+// result to used
+func uniqueEntryName(name string, used map[string]bool) string {
+	unique := name
+	ext := filepath.Ext(name)
+	for i := 2; used[strings.ToLower(unique)]; i++ {
+		unique = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+// copyEntry writes the content of entry to path and returns its size,
+// failing with errEntryTooLarge if it holds more than limit bytes whatever
+// its header says
+func copyEntry(entry *zip.File, path string, limit int64) (int64, error) {
+	r, err := entry.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	w, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(w, io.LimitReader(r, limit+1))
+	if err == nil && n > limit {
+		err = errEntryTooLarge
+	}
+	if err != nil {
+		w.Close()
+		return n, err
+	}
+	return n, w.Close()
+}
+
+// extract unpacks the CBR at path with the first available extractor
+func (c *comicPages) extract(path string) error {
+	for _, tool := range comicExtractors {
+		bin, err := exec.LookPath(tool.name)
+		if err != nil {
+			continue
+		}
+		if err := c.run(tool.name, exec.Command(bin, tool.args(path, c.dir)...)); err != nil {
+			return err
+		}
+		return filepath.WalkDir(c.dir, func(name string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(c.dir, name)
+			if d.Type().IsRegular() && isComicPage(filepath.ToSlash(rel)) {
+				c.files = append(c.files, name)
+			}
+			return nil
+		})
+	}
+	_, err := ComicExtractor()
+	return err
+}
+
+// run runs the extractor cmd named tool, stopping it once the temporary
+// directory holds more than maxComicPages files or maxComicSize bytes
+func (c *comicPages) run(tool string, cmd *exec.Cmd) error {
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	ticker := time.NewTicker(comicPollInterval)
+	defer ticker.Stop()
+	for finished := false; ; {
+		select {
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("%s failed: %v: %s", tool, err, bytes.TrimSpace(output.Bytes()))
+			}
+			finished = true
+		case <-ticker.C:
+		}
+		// Checked once more after the extractor is done, for quick ones
+		if files, size := dirUsage(c.dir); files > maxComicPages || size > maxComicSize {
+			if !finished {
+				cmd.Process.Kill()
+				<-done
+			}
+			return fmt.Errorf("%w: more than %d files or %d MiB unpacked", errComicTooLarge, maxComicPages, maxComicSize>>20)
+		}
+		if finished {
+			return nil
+		}
+	}
+}
+
+// dirUsage returns the number of files under dir and their total size
+func dirUsage(dir string) (int, int64) {
+	files, size := 0, int64(0)
+	filepath.WalkDir(dir, func(_ string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		files++
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return files, size
+}
+
+// isComicPage reports whether the archive entry name is an image page,
+// leaving out hidden files and macOS resource forks
+func isComicPage(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return false
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, supported := range inputExtensions {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *comicPages) count() int {
+	return len(c.files)
+}
+
+func (c *comicPages) page(i int) (image.Image, error) {
+	return loadInput(c.files[i], nil, c.limit)
+}
+
+// close removes the unpacked pages
+func (c *comicPages) close() error {
+	return os.RemoveAll(c.dir)
+}
+
+// naturalLess orders names as people number pages, with runs of digits
+// compared by value and letters ignoring case: page2 before page10
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		ra, rb := unicode.ToLower(rune(a[0])), unicode.ToLower(rune(b[0]))
+		if ra != rb {
+			return ra < rb
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// leadingDigits returns the run of ASCII digits s starts with
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// processComic transforms the pages of comic in reading order and writes
+// them into a CBZ at outputPath as 001.jpg, 002.jpg, ... in format. Each
+// page is turned upright and color converted on its own.
+func processComic(comic *comicPages, outputPath, format string, config Config) error {
+	config.progress.stage(StageEncode)
+	if config.BeforeWrite != nil {
+		if err := config.BeforeWrite(outputPath); err != nil {
+			return err
+		}
+	}
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	modified := time.Now()
+	if config.Deterministic {
+		modified = deterministicTime()
+	}
+	archive := zip.NewWriter(file)
+	width := max(3, len(fmt.Sprint(comic.count())))
+	ext := filepath.Ext(generateOutputPath("page", "", format))
+	// Hidden, so it is never taken for a page
+	encoded := filepath.Join(comic.dir, ".encoded"+ext)
+	for i, page := range comic.files {
+		pageConfig := sourceConfig(page, config)
+		config.progress.stage(StageDecode)
+		img, err := loadInput(page, nil, config.MaxPixels)
+		if err != nil {
+			return fmt.Errorf("page %s: %w", comic.name(i), err)
+		}
+		config.progress.stage(StageTransform)
+		if img, err = transformImage(img, pageConfig); err != nil {
+			return fmt.Errorf("page %s: %v", comic.name(i), err)
+		}
+
+		// Pages are encoded to a file first, as some encoders write one
+		config.progress.stage(StageEncode)
+		if err := saveImage(img, encoded, format, config.Quality, config.Speed, config.Effort); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%0*d%s", width, i+1, ext)
+		if err := addComicPage(archive, name, encoded, modified); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// addComicPage stores the file at path in archive as name. Pages are
+// compressed images, so they are stored as they are.
+func addComicPage(archive *zip.Writer, name, path string, modified time.Time) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"archive/zip"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"page2.jpg", "page10.jpg", true},
+		{"page10.jpg", "page2.jpg", false},
+		{"002.jpg", "10.jpg", true},
+		{"Chapter 1/01.jpg", "chapter 2/01.jpg", true},
+		{"cover.jpg", "page1.jpg", true},
+		{"a.jpg", "a.jpg", false},
+	}
+
+	for _, test := range tests {
+		if got := naturalLess(test.a, test.b); got != test.expected {
+			t.Errorf("naturalLess(%q, %q) = %t, expected %t", test.a, test.b, got, test.expected)
+		}
+	}
+}
+
+func TestCleanEntryName(t *testing.T) {
+	tests := map[string]string{
+		"ch1/001.jpg":       "ch1/001.jpg",
+		"../../evil.jpg":    "evil.jpg",
+		"/abs/./001.jpg":    "abs/001.jpg",
+		`ch1\..\..\001.jpg`: "ch1/001.jpg",
+	}
+	for name, expected := range tests {
+		if got := cleanEntryName(name); got != expected {
+			t.Errorf("cleanEntryName(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestUniqueEntryName(t *testing.T) {
+	used := make(map[string]bool)
+	var got []string
+	for _, name := range []string{"ch1/001.jpg", "ch1/001.jpg", "CH1/001.JPG", "ch1/001-2.jpg", "002.png"} {
+		got = append(got, uniqueEntryName(name, used))
+	}
+	expected := []string{"ch1/001.jpg", "ch1/001-2.jpg", "CH1/001-3.JPG", "ch1/001-2-2.jpg", "002.png"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("uniqueEntryName() = %v, expected %v", got, expected)
+	}
+}
+
+// writeComic writes a CBZ at path with a page of the given width for each
+// name, in the order given, and a few entries that are not pages
+func writeComic(t *testing.T, path string, pages map[string]int, order []string) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	for _, name := range append(order, "ComicInfo.xml", "__MACOSX/._p1.png") {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width, ok := pages[name]; ok {
+			if err := png.Encode(w, image.NewGray(image.Rect(0, 0, width, 20))); err != nil {
+				t.Fatal(err)
+			}
+		} else if _, err := w.Write([]byte("not a page")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readComicWidths returns the entry names of the CBZ at path and the widths
+// of its pages
+func readComicWidths(t *testing.T, path string) ([]string, []int) {
+	t.Helper()
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	defer archive.Close()
+	var names []string
+	var widths []int
+	for _, entry := range archive.File {
+		r, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("page %s: %v", entry.Name, err)
+		}
+		names = append(names, entry.Name)
+		widths = append(widths, img.Bounds().Dx())
+	}
+	return names, widths
+}
+
+func TestProcessComic(t *testing.T) {
+	tempDir := t.TempDir()
+	pages := map[string]int{"ch1/p10.png": 30, "ch1/p2.png": 20, "ch1/p1.png": 10}
+	inputPath := filepath.Join(tempDir, "volume1.cbz")
+	writeComic(t, inputPath, pages, []string{"ch1/p10.png", "ch1/p2.png", "ch1/p1.png"})
+
+	for _, keep := range []bool{false, true} {
+		outputDir := t.TempDir()
+		result, err := Process(inputPath, Config{OutputFormat: "png", MaxWidth: 100, MaxHeight: 100, Quality: 90, OutputDir: outputDir, KeepFormat: keep})
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		if result.OutputPath != filepath.Join(outputDir, "volume1.cbz") || result.Width != 10 {
+			t.Errorf("Process() = %s %dx%d, expected volume1.cbz with the 10px first page", result.OutputPath, result.Width, result.Height)
+		}
+		if keep {
+			// Pages are written as JPEG when keeping the format
+			continue
+		}
+
+		// Pages keep their reading order, without the entries that are not pages
+		names, widths := readComicWidths(t, result.OutputPath)
+		expected := []int{10, 20, 30}
+		if len(names) != 3 || names[0] != "001.png" || names[2] != "003.png" {
+			t.Fatalf("output entries = %v, expected 001.png to 003.png", names)
+		}
+		for i, width := range expected {
+			if widths[i] != width {
+				t.Errorf("page %d width = %d, expected %d", i+1, widths[i], width)
+			}
+		}
+	}
+}
+
+func TestProcessComicMaxPixels(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "volume1.cbz")
+	writeComic(t, inputPath, map[string]int{"p1.png": 10, "p2.png": 30}, []string{"p1.png", "p2.png"})
+
+	// The archive is no image, only its second page is too large
+	config := Config{OutputFormat: "png", MaxWidth: 100, MaxHeight: 100, Quality: 90, MaxPixels: 500}
+	config.OutputDir = t.TempDir()
+	if _, err := Process(inputPath, config); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("Process() error = %v, expected ErrTooManyPixels", err)
+	}
+	config.MaxPixels, config.OutputDir = 600, t.TempDir()
+	if _, err := Process(inputPath, config); err != nil {
+		t.Errorf("Process() error = %v, expected pages within the limit", err)
+	}
+}
+
+func TestProcessCBR(t *testing.T) {
+	if _, err := ComicExtractor(); err != nil {
+		t.Skip(err)
+	}
+	// The extractors also unpack ZIP files, as found in misnamed CBRs
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "volume2.cbr")
+	writeComic(t, inputPath, map[string]int{"b.png": 20, "a.png": 10}, []string{"b.png", "a.png"})
+
+	result, err := Process(inputPath, Config{OutputFormat: "png", MaxWidth: 100, MaxHeight: 100, Quality: 90, OutputDir: tempDir})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if result.OutputPath != filepath.Join(tempDir, "volume2.cbz") {
+		t.Errorf("Process() OutputPath = %s, expected volume2.cbz", result.OutputPath)
+	}
+	if _, widths := readComicWidths(t, result.OutputPath); len(widths) != 2 || widths[0] != 10 {
+		t.Errorf("page widths = %v, expected [10 20]", widths)
+	}
+}
+
+func TestProcessComicLimits(t *testing.T) {
+	defer func(pages int, size int64) { maxComicPages, maxComicSize = pages, size }(maxComicPages, maxComicSize)
+	tempDir := t.TempDir()
+	pages := map[string]int{"p1.png": 10, "p2.png": 20}
+	cbz := filepath.Join(tempDir, "volume1.cbz")
+	writeComic(t, cbz, pages, []string{"p1.png", "p2.png"})
+	inputs := []string{cbz}
+	if _, err := ComicExtractor(); err == nil {
+		cbr := filepath.Join(tempDir, "volume2.cbr")
+		writeComic(t, cbr, pages, []string{"p1.png", "p2.png"})
+		inputs = append(inputs, cbr)
+	}
+
+	tests := []struct {
+		name  string
+		pages int
+		size  int64
+	}{
+		{"Too many pages", 1, 1 << 20},
+		{"Too many bytes", 10, 100},
+	}
+	for _, test := range tests {
+		for _, input := range inputs {
+			t.Run(test.name+" "+filepath.Ext(input), func(t *testing.T) {
+				maxComicPages, maxComicSize = test.pages, test.size
+				_, err := Process(input, Config{OutputFormat: "png", MaxWidth: 100, MaxHeight: 100, Quality: 90, OutputDir: t.TempDir()})
+				if !errors.Is(err, errComicTooLarge) {
+					t.Errorf("Process() error = %v, expected errComicTooLarge", err)
+				}
+			})
+		}
+	}
+}
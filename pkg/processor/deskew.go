@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// maxSkew is the largest skew in degrees, either way, Deskew corrects
+const maxSkew = 15
+
+// deskewDetectSize is the longest side of the copy skew is found in
+const deskewDetectSize = 1024
+
+// maxSkewPoints is the number of ink pixels skew is scored on, larger
+// images are sampled
+const maxSkewPoints = 100000
+
+// minSkewGain is how much sharper the rows of text must be at the skew
+// found than at none for the image to be turned
+const minSkewGain = 1.1
+
+// findSkew returns the angle in degrees, up to maxSkew either way, by which
+// the lines of text in img run down to the right, or 0 if it has no lines
+// to measure. The angle is the one whose rows of ink pixels are the most
+// uneven, as rows then fall either on lines or between them.
+func findSkew(img image.Image) float64 {
+	small := imaging.Grayscale(imaging.Fit(img, deskewDetectSize, deskewDetectSize, imaging.Box))
+	width, height := small.Rect.Dx(), small.Rect.Dy()
+	if width < 8 || height < 8 {
+		return 0
+	}
+	var histogram [256]int
+	for i := 0; i < len(small.Pix); i += 4 {
+		histogram[small.Pix[i]]++
+	}
+	threshold := otsuThreshold(histogram, width*height)
+
+	var points []image.Point
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if small.Pix[y*small.Stride+x*4] <= threshold {
+				points = append(points, image.Pt(x, y))
+			}
+		}
+	}
+	// Text is a small part of a page, an image mostly dark is no page
+	if ink := float64(len(points)) / float64(width*height); ink < 0.002 || ink > 0.4 {
+		return 0
+	}
+	if step := len(points)/maxSkewPoints + 1; step > 1 {
+		sampled := points[:0]
+		for i := 0; i < len(points); i += step {
+			sampled = append(sampled, points[i])
+		}
+		points = sampled
+	}
+
+	rows := make([]float64, height+2*width)
+	score := func(angle float64) float64 {
+		clear(rows)
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		for _, p := range points {
+			rows[int(float64(p.Y)*cos-float64(p.X)*sin)+width]++
+		}
+		var sum float64
+		for _, n := range rows {
+			sum += n * n
+		}
+		return sum
+	}
+
+	// Coarse steps, then fine ones around the best of them
+	best, bestScore := 0.0, score(0)
+	level := bestScore
+	for angle := -float64(maxSkew); angle <= maxSkew; angle += 0.5 {
+		if s := score(angle); s > bestScore {
+			best, bestScore = angle, s
+		}
+	}
+	coarse := best
+	for angle := coarse - 0.5; angle <= coarse+0.5; angle += 0.05 {
+		if s := score(angle); s > bestScore {
+			best, bestScore = angle, s
+		}
+	}
+	if bestScore < minSkewGain*level {
+		return 0
+	}
+	return math.Round(best*100) / 100
+}
+
+// deskew turns img counter-clockwise by angle degrees, keeping its size
+// and filling the corners with the color of its edges
+func deskew(img image.Image, angle float64) image.Image {
+	bounds := img.Bounds()
+	rotated := imaging.Rotate(img, angle, edgeColor(img))
+	size := rotated.Rect.Size()
+	x, y := (size.X-bounds.Dx())/2, (size.Y-bounds.Dy())/2
+	return imaging.Crop(rotated, image.Rect(x, y, x+bounds.Dx(), y+bounds.Dy()))
+}
+
+// edgeColor returns the average color of the outermost pixels of img, the
+// paper or scanner lid around a scanned page
+func edgeColor(img image.Image) color.NRGBA {
+	bounds := img.Bounds()
+	var r, g, b, n int
+	add := func(x, y int) {
+		c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+		r, g, b, n = r+int(c.R), g+int(c.G), b+int(c.B), n+1
+	}
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		add(x, bounds.Min.Y)
+		add(x, bounds.Max.Y-1)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		add(bounds.Min.X, y)
+		add(bounds.Max.X-1, y)
+	}
+	return color.NRGBA{uint8(r / n), uint8(g / n), uint8(b / n), 255}
+}
@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// skewedPage returns a portrait page of lines of text turned clockwise by
+// angle degrees
+func skewedPage(angle float64) *image.NRGBA {
+	img := imaging.New(1000, 1400, color.White)
+	for y := 120; y < 1280; y += 30 {
+		for dy := 0; dy < 10; dy++ {
+			for x := 100; x < 900; x++ {
+				if x%50 < 40 {
+					img.SetNRGBA(x, y+dy, color.NRGBA{30, 30, 30, 255})
+				}
+			}
+		}
+	}
+	return imaging.Rotate(img, -angle, color.White)
+}
+
+func TestFindSkew(t *testing.T) {
+	tests := []struct {
+		name  string
+		img   image.Image
+		angle float64
+	}{
+		{"Straight page", skewedPage(0), 0},
+		{"Turned clockwise", skewedPage(3.5), 3.5},
+		{"Turned counter-clockwise", skewedPage(-8), -8},
+		{"Blank page", imaging.New(800, 1000, color.White), 0},
+		{"Dark photo", imaging.New(800, 600, color.NRGBA{20, 40, 60, 255}), 0},
+	}
+
+	for _, test := range tests {
+		if got := findSkew(test.img); math.Abs(got-test.angle) > 0.2 {
+			t.Errorf("%s: findSkew() = %.2f, expected %.2f", test.name, got, test.angle)
+		}
+	}
+}
+
+func TestProcessDeskew(t *testing.T) {
+	tempDir := t.TempDir()
+	outDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	inputPath := filepath.Join(tempDir, "scan.png")
+	page := skewedPage(4)
+	if err := imaging.Save(page, inputPath); err != nil {
+		t.Fatalf("Failed to save scan: %v", err)
+	}
+
+	p, err := New(WithFormat("png"), WithOutputDir(outDir), WithMaxSize(2000, 2000), WithDeskew())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	result, err := p.Process(inputPath)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if math.Abs(result.Skew-4) > 0.2 {
+		t.Errorf("Process() skew = %.2f, expected about 4", result.Skew)
+	}
+	img, err := imaging.Open(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	if img.Bounds().Size() != page.Rect.Size() {
+		t.Errorf("output size = %v, expected %v", img.Bounds().Size(), page.Rect.Size())
+	}
+	if angle := findSkew(img); math.Abs(angle) > 0.2 {
+		t.Errorf("output skew = %.2f, expected straight", angle)
+	}
+}
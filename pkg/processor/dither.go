@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Dithering methods of Config.Dither
+const (
+	DitherFloydSteinberg = "floyd-steinberg"
+	DitherOrdered        = "ordered"
+)
+
+// dithers are the dithering methods
+var dithers = []string{DitherFloydSteinberg, DitherOrdered}
+
+// defaultGrayLevels is the number of shades most e-ink screens show
+const defaultGrayLevels = 16
+
+// Dithers returns the dithering methods
+func Dithers() []string {
+	return append([]string(nil), dithers...)
+}
+
+// IsSupportedDither reports whether dither is a dithering method
+func IsSupportedDither(dither string) bool {
+	for _, d := range dithers {
+		if d == dither {
+			return true
+		}
+	}
+	return false
+}
+
+// bayer8 is the 8x8 Bayer threshold matrix of ordered dithering
+var bayer8 = [8][8]int{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// grayscale converts img to shades of gray. Transparent areas become white,
+// the background of e-ink screens.
+func grayscale(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Over)
+	return gray
+}
+
+// clampGray rounds v to a gray value
+func clampGray(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(255, v))))
+}
+
+// quantizeGray returns the nearest of levels evenly spaced shades to v
+func quantizeGray(v float64, levels int) uint8 {
+	step := 255 / float64(levels-1)
+	return clampGray(math.Round(math.Max(0, math.Min(255, v))/step) * step)
+}
+
+// dither reduces img to levels shades of gray with method
+func dither(img *image.Gray, method string, levels int) *image.Gray {
+	if method == DitherOrdered {
+		return ditherOrdered(img, levels)
+	}
+	return ditherFloydSteinberg(img, levels)
+}
+
+// ditherFloydSteinberg reduces img to levels shades, diffusing the error of
+// each pixel to its unvisited neighbours
+func ditherFloydSteinberg(img *image.Gray, levels int) *image.Gray {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	out := image.NewGray(bounds)
+
+	// Errors of the current and next row, padded by a pixel on each side
+	cur, next := make([]float64, w+2), make([]float64, w+2)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*img.Stride + x
+			v := float64(img.Pix[i]) + cur[x+1]
+			q := quantizeGray(v, levels)
+			out.Pix[y*out.Stride+x] = q
+			e := v - float64(q)
+			cur[x+2] += e * 7 / 16
+			next[x] += e * 3 / 16
+			next[x+1] += e * 5 / 16
+			next[x+2] += e * 1 / 16
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+	return out
+}
+
+// ditherOrdered reduces img to levels shades, offsetting each pixel by the
+// Bayer matrix so that the pattern does not depend on its neighbours
+func ditherOrdered(img *image.Gray, levels int) *image.Gray {
+	bounds := img.Bounds()
+	out := image.NewGray(bounds)
+	step := 255 / float64(levels-1)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			threshold := (float64(bayer8[y%8][x%8])+0.5)/64 - 0.5
+			v := float64(img.Pix[y*img.Stride+x]) + threshold*step
+			out.Pix[y*out.Stride+x] = quantizeGray(v, levels)
+		}
+	}
+	return out
+}
+
+// grayLevels returns the number of shades Dither reduces to
+func (c Config) grayLevels() int {
+	if c.GrayLevels == 0 {
+		return defaultGrayLevels
+	}
+	return c.GrayLevels
+}
@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestGrayscale(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(10, 10, 13, 11))
+	img.Set(10, 10, color.NRGBA{R: 255, A: 255})
+	img.Set(11, 10, color.NRGBA{G: 255, B: 255, A: 255})
+	// Transparent pixels become the white of the screen
+	img.Set(12, 10, color.NRGBA{})
+
+	gray := grayscale(img)
+	if gray.Bounds() != image.Rect(0, 0, 3, 1) {
+		t.Fatalf("grayscale() bounds = %v, expected 3x1 at the origin", gray.Bounds())
+	}
+	expected := []uint8{76, 179, 255}
+	for x, v := range expected {
+		if got := gray.GrayAt(x, 0).Y; got != v {
+			t.Errorf("grayscale() at %d = %d, expected %d", x, got, v)
+		}
+	}
+}
+
+func TestDither(t *testing.T) {
+	tests := []struct {
+		method string
+		levels int
+	}{
+		{DitherFloydSteinberg, 2},
+		{DitherFloydSteinberg, 16},
+		{DitherOrdered, 2},
+		{DitherOrdered, 4},
+	}
+
+	// A flat mid gray between the shades of every level count
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = 100
+	}
+
+	for _, test := range tests {
+		out := dither(img, test.method, test.levels)
+		step := 255 / (test.levels - 1)
+		total := 0
+		for _, v := range out.Pix {
+			if int(v)%step != 0 {
+				t.Fatalf("dither(%s, %d) produced shade %d", test.method, test.levels, v)
+			}
+			total += int(v)
+		}
+		// The pattern keeps the average tone
+		if mean := float64(total) / float64(len(out.Pix)); mean < 96 || mean > 104 {
+			t.Errorf("dither(%s, %d) mean = %.1f, expected about 100", test.method, test.levels, mean)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package processor
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Document modes of Config.Document
+const (
+	DocumentBW    = "bw"
+	DocumentGray  = "gray"
+	DocumentColor = "color"
+)
+
+// documentModes are the document modes
+var documentModes = []string{DocumentBW, DocumentGray, DocumentColor}
+
+// DocumentModes returns the document modes
+func DocumentModes() []string {
+	return append([]string(nil), documentModes...)
+}
+
+// IsSupportedDocument reports whether mode is a document mode
+func IsSupportedDocument(mode string) bool {
+	for _, m := range documentModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// documentDetectSize is the longest side of the copy pages are found in
+const documentDetectSize = 512
+
+// minPageArea is the smallest share of the photo a page must cover to be
+// taken for one
+const minPageArea = 0.2
+
+// findPage returns the corners of the paper in a photo of a document, top
+// left, top right, bottom right and bottom left, in pixels of img. Paper
+// is the largest bright region; ok is false if there is none large enough.
+func findPage(img image.Image) (corners [4]image.Point, ok bool) {
+	bounds := img.Bounds()
+	small := imaging.Grayscale(imaging.Fit(img, documentDetectSize, documentDetectSize, imaging.Box))
+	width, height := small.Rect.Dx(), small.Rect.Dy()
+
+	// Paper is brighter than the Otsu threshold of the photo
+	var histogram [256]int
+	for i := 0; i < len(small.Pix); i += 4 {
+		histogram[small.Pix[i]]++
+	}
+	threshold := otsuThreshold(histogram, width*height)
+	bright := func(i int) bool { return small.Pix[i*4] > threshold }
+
+	// Keep the largest connected bright region
+	label := make([]int32, width*height)
+	var best, bestSize int32
+	queue := make([]int, 0, width*height)
+	for start := range label {
+		if label[start] != 0 || !bright(start) {
+			continue
+		}
+		id := int32(start + 1)
+		label[start] = id
+		queue = append(queue[:0], start)
+		for head := 0; head < len(queue); head++ {
+			i := queue[head]
+			x := i % width
+			for _, next := range [4]int{i - 1, i + 1, i - width, i + width} {
+				if (next == i-1 && x == 0) || (next == i+1 && x == width-1) || (next < 0 || next >= len(label)) {
+					continue
+				}
+				if label[next] == 0 && bright(next) {
+					label[next] = id
+					queue = append(queue, next)
+				}
+			}
+		}
+		if int32(len(queue)) > bestSize {
+			best, bestSize = id, int32(len(queue))
+		}
+	}
+	if float64(bestSize) < minPageArea*float64(width*height) {
+		return corners, false
+	}
+
+	// The extremes of x+y and x-y are the corners of a tilted rectangle
+	var extremes [4]int
+	first := true
+	for i, l := range label {
+		if l != best {
+			continue
+		}
+		x, y := i%width, i/width
+		p := [4]int{x + y, x - y, x + y, x - y}
+		if first {
+			for c := range corners {
+				corners[c] = image.Pt(x, y)
+				extremes[c] = p[c]
+			}
+			first = false
+			continue
+		}
+		// Top left and bottom left minimize, the others maximize
+		if p[0] < extremes[0] {
+			corners[0], extremes[0] = image.Pt(x, y), p[0]
+		}
+		if p[1] > extremes[1] {
+			corners[1], extremes[1] = image.Pt(x, y), p[1]
+		}
+		if p[2] > extremes[2] {
+			corners[2], extremes[2] = image.Pt(x, y), p[2]
+		}
+		if p[3] < extremes[3] {
+			corners[3], extremes[3] = image.Pt(x, y), p[3]
+		}
+	}
+
+	// Back to the pixels of img, to the outer edge of corner pixels
+	sx, sy := float64(bounds.Dx())/float64(width), float64(bounds.Dy())/float64(height)
+	for c, corner := range corners {
+		x, y := float64(corner.X), float64(corner.Y)
+		if c == 1 || c == 2 {
+			x++
+		}
+		if c >= 2 {
+			y++
+		}
+		corners[c] = image.Pt(bounds.Min.X+int(math.Round(x*sx)), bounds.Min.Y+int(math.Round(y*sy)))
+	}
+	return corners, true
+}
+
+// otsuThreshold returns the level that best splits the count values of
+// histogram into dark and bright
+func otsuThreshold(histogram [256]int, count int) uint8 {
+	var sum float64
+	for level, n := range histogram {
+		sum += float64(level * n)
+	}
+	var darkSum float64
+	var dark int
+	var best float64
+	var threshold uint8
+	for level, n := range histogram {
+		dark += n
+		if dark == 0 || dark == count {
+			continue
+		}
+		darkSum += float64(level * n)
+		bright := count - dark
+		darkMean, brightMean := darkSum/float64(dark), (sum-darkSum)/float64(bright)
+		if between := float64(dark) * float64(bright) * (darkMean - brightMean) * (darkMean - brightMean); between > best {
+			best, threshold = between, uint8(level)
+		}
+	}
+	return threshold
+}
+
+// pageSize returns the size of the rectangle the page with corners is
+// straightened to, its longest opposite edges
+func pageSize(corners [4]image.Point) image.Point {
+	length := func(a, b image.Point) float64 {
+		return math.Hypot(float64(b.X-a.X), float64(b.Y-a.Y))
+	}
+	width := math.Max(length(corners[0], corners[1]), length(corners[3], corners[2]))
+	height := math.Max(length(corners[0], corners[3]), length(corners[1], corners[2]))
+	return image.Pt(max(1, int(math.Round(width))), max(1, int(math.Round(height))))
+}
+
+// homography returns the projective transform that maps the corners of a
+// width x height rectangle, in the order of findPage, to corners
+func homography(width, height int, corners [4]image.Point) ([9]float64, bool) {
+	from := [4][2]float64{{0, 0}, {float64(width), 0}, {float64(width), float64(height)}, {0, float64(height)}}
+
+	// Two equations per corner for h0..h7, with h8 = 1
+	var a [8][9]float64
+	for i, c := range corners {
+		x, y, u, v := from[i][0], from[i][1], float64(c.X), float64(c.Y)
+		a[2*i] = [9]float64{x, y, 1, 0, 0, 0, -u * x, -u * y, u}
+		a[2*i+1] = [9]float64{0, 0, 0, x, y, 1, -v * x, -v * y, v}
+	}
+
+	// Gaussian elimination with partial pivoting
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for row := col + 1; row < 8; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return [9]float64{}, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := 0; row < 8; row++ {
+			if row == col {
+				continue
+			}
+			f := a[row][col] / a[col][col]
+			for k := col; k < 9; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+		}
+	}
+
+	var h [9]float64
+	for i := 0; i < 8; i++ {
+		h[i] = a[i][8] / a[i][i]
+	}
+	h[8] = 1
+	return h, true
+}
+
+// warpPage straightens the page with corners in img into a rectangle of
+// size, sampling img bilinearly
+func warpPage(img image.Image, corners [4]image.Point, size image.Point) (*image.NRGBA, bool) {
+	h, ok := homography(size.X, size.Y, corners)
+	if !ok {
+		return nil, false
+	}
+	src := imaging.Clone(img)
+	origin := img.Bounds().Min
+	out := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	sample := func(x, y int, channel int) float64 {
+		x = min(max(x, 0), src.Rect.Dx()-1)
+		y = min(max(y, 0), src.Rect.Dy()-1)
+		return float64(src.Pix[y*src.Stride+x*4+channel])
+	}
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			// Sample at the center of the output pixel
+			fx, fy := float64(x)+0.5, float64(y)+0.5
+			w := h[6]*fx + h[7]*fy + h[8]
+			u := (h[0]*fx+h[1]*fy+h[2])/w - float64(origin.X) - 0.5
+			v := (h[3]*fx+h[4]*fy+h[5])/w - float64(origin.Y) - 0.5
+			x0, y0 := int(math.Floor(u)), int(math.Floor(v))
+			tx, ty := u-float64(x0), v-float64(y0)
+			px := out.Pix[y*out.Stride+x*4:]
+			for c := 0; c < 4; c++ {
+				top := sample(x0, y0, c)*(1-tx) + sample(x0+1, y0, c)*tx
+				bottom := sample(x0, y0+1, c)*(1-tx) + sample(x0+1, y0+1, c)*tx
+				px[c] = uint8(math.Round(top*(1-ty) + bottom*ty))
+			}
+		}
+	}
+	return out, true
+}
+
+// enhanceDocument evens out the lighting of a straightened page so that
+// paper turns white, then for DocumentBW binarizes it and otherwise
+// sharpens it, in gray for DocumentGray. DocumentColor evens out each
+// channel, which also takes the tint off the paper.
+func enhanceDocument(img image.Image, mode string) *image.NRGBA {
+	src := imaging.Clone(img)
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	channels := 1
+	if mode == DocumentColor {
+		channels = 3
+	}
+
+	// Gray modes work on luma, color on each channel
+	planes := make([][]float64, channels)
+	for c := range planes {
+		planes[c] = make([]float64, width*height)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := src.Pix[y*src.Stride+x*4:]
+			i := y*width + x
+			if channels == 1 {
+				planes[0][i] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+				continue
+			}
+			for c := range planes {
+				planes[c][i] = float64(p[c])
+			}
+		}
+	}
+	backgrounds := make([]func(x, y int) float64, channels)
+	for c, plane := range planes {
+		backgrounds[c] = paperLevel(plane, width, height)
+	}
+
+	out := image.NewNRGBA(src.Rect)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			px := out.Pix[y*out.Stride+x*4:]
+			px[3] = 255
+			if channels == 3 {
+				for c := range planes {
+					px[c] = evenPaper(planes[c][i], backgrounds[c](x, y))
+				}
+				continue
+			}
+			v := evenPaper(planes[0][i], backgrounds[0](x, y))
+			if mode == DocumentBW {
+				// Ink is markedly darker than the paper around it
+				v = 255
+				if planes[0][i] < 0.75*backgrounds[0](x, y) {
+					v = 0
+				}
+			}
+			px[0], px[1], px[2] = v, v, v
+		}
+	}
+	if mode == DocumentBW {
+		return out
+	}
+	return imaging.Sharpen(out, 1)
+}
+
+// documentCells is the number of cells along the longer side of a page
+// its paper level is measured in
+const documentCells = 16
+
+// paperLevel returns the brightness of the paper around each pixel of the
+// width x height values: the upper percentile of each cell of a coarse
+// grid, taken from the brightest neighbouring cell so that large dark
+// areas like photos keep their paper, interpolated between cell centers
+func paperLevel(values []float64, width, height int) func(x, y int) float64 {
+	cell := max(8, (max(width, height)+documentCells-1)/documentCells)
+	columns, rows := (width+cell-1)/cell, (height+cell-1)/cell
+
+	levels := make([]float64, columns*rows)
+	var histogram [256]int
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			histogram = [256]int{}
+			count := 0
+			for y := row * cell; y < min((row+1)*cell, height); y++ {
+				for x := column * cell; x < min((column+1)*cell, width); x++ {
+					histogram[min(max(int(values[y*width+x]), 0), 255)]++
+					count++
+				}
+			}
+			// The 95th percentile skips noise and highlights
+			level, seen := 255, 0
+			for ; level > 0; level-- {
+				if seen += histogram[level]; seen*20 >= count {
+					break
+				}
+			}
+			levels[row*columns+column] = float64(level)
+		}
+	}
+
+	spread := make([]float64, len(levels))
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			var level float64
+			for r := max(row-1, 0); r <= min(row+1, rows-1); r++ {
+				for c := max(column-1, 0); c <= min(column+1, columns-1); c++ {
+					level = math.Max(level, levels[r*columns+c])
+				}
+			}
+			spread[row*columns+column] = math.Max(level, 1)
+		}
+	}
+
+	at := func(column, row int) float64 {
+		return spread[min(max(row, 0), rows-1)*columns+min(max(column, 0), columns-1)]
+	}
+	return func(x, y int) float64 {
+		fx, fy := (float64(x)+0.5)/float64(cell)-0.5, (float64(y)+0.5)/float64(cell)-0.5
+		column, row := int(math.Floor(fx)), int(math.Floor(fy))
+		tx, ty := fx-float64(column), fy-float64(row)
+		top := at(column, row)*(1-tx) + at(column+1, row)*tx
+		bottom := at(column, row+1)*(1-tx) + at(column+1, row+1)*tx
+		return top*(1-ty) + bottom*ty
+	}
+}
+
+// evenPaper scales v so that the paper, at the brightness of background,
+// turns white
+func evenPaper(v, background float64) uint8 {
+	return uint8(math.Round(math.Min(v/background*255, 255)))
+}
+
+// processDocument turns a photo of a document into a scan in mode: the
+// page is found, straightened and enhanced. Photos without a page found
+// are only enhanced. It returns the image and the applied operation.
+func processDocument(img image.Image, mode string) (image.Image, string) {
+	operation := "document " + mode
+	if corners, ok := findPage(img); ok {
+		if page, ok := warpPage(img, corners, pageSize(corners)); ok {
+			img = page
+			operation += " page"
+		}
+	}
+	return enhanceDocument(img, mode), operation
+}
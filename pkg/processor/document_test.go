@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// documentPhoto returns a photo of a white page with corners on a dark
+// table, with a black bar across the middle of the page
+func documentPhoto(width, height int, corners [4]image.Point) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	inside := func(x, y float64) bool {
+		for i := range corners {
+			a, b := corners[i], corners[(i+1)%4]
+			if (float64(b.X-a.X))*(y-float64(a.Y))-(float64(b.Y-a.Y))*(x-float64(a.X)) < 0 {
+				return false
+			}
+		}
+		return true
+	}
+	h, _ := homography(1000, 1000, corners)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{40, 45, 50, 255}
+			if inside(float64(x)+0.5, float64(y)+0.5) {
+				c = color.NRGBA{220, 215, 205, 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	// The bar covers the middle tenth of the page's height
+	for v := 400.0; v < 600; v++ {
+		for u := 450.0; u < 550; u++ {
+			w := h[6]*u + h[7]*v + h[8]
+			x, y := (h[0]*u+h[1]*v+h[2])/w, (h[3]*u+h[4]*v+h[5])/w
+			img.SetNRGBA(int(x), int(y), color.NRGBA{30, 30, 30, 255})
+		}
+	}
+	return img
+}
+
+func TestFindPage(t *testing.T) {
+	corners := [4]image.Point{{120, 80}, {700, 140}, {660, 560}, {90, 500}}
+	found, ok := findPage(documentPhoto(800, 600, corners))
+	if !ok {
+		t.Fatal("findPage() found no page")
+	}
+	for i := range corners {
+		if d := math.Hypot(float64(found[i].X-corners[i].X), float64(found[i].Y-corners[i].Y)); d > 6 {
+			t.Errorf("findPage() corner %d = %v, expected about %v", i, found[i], corners[i])
+		}
+	}
+
+	// A photo without a page
+	if _, ok := findPage(image.NewNRGBA(image.Rect(0, 0, 300, 200))); ok {
+		t.Error("findPage() of a blank photo found a page")
+	}
+}
+
+func TestHomography(t *testing.T) {
+	corners := [4]image.Point{{10, 20}, {300, 5}, {320, 240}, {0, 200}}
+	h, ok := homography(400, 300, corners)
+	if !ok {
+		t.Fatal("homography() failed")
+	}
+	for i, p := range [4][2]float64{{0, 0}, {400, 0}, {400, 300}, {0, 300}} {
+		w := h[6]*p[0] + h[7]*p[1] + h[8]
+		x, y := (h[0]*p[0]+h[1]*p[1]+h[2])/w, (h[3]*p[0]+h[4]*p[1]+h[5])/w
+		if math.Abs(x-float64(corners[i].X)) > 1e-6 || math.Abs(y-float64(corners[i].Y)) > 1e-6 {
+			t.Errorf("homography() maps corner %d to %.2f,%.2f, expected %v", i, x, y, corners[i])
+		}
+	}
+
+	// Corners on a line have no transform
+	if _, ok := homography(10, 10, [4]image.Point{{0, 0}, {1, 1}, {2, 2}, {3, 3}}); ok {
+		t.Error("homography() of collinear corners succeeded")
+	}
+}
+
+func TestProcessDocument(t *testing.T) {
+	corners := [4]image.Point{{120, 80}, {700, 140}, {660, 560}, {90, 500}}
+	photo := documentPhoto(800, 600, corners)
+
+	tests := []struct {
+		mode string
+		gray bool
+	}{
+		{DocumentBW, true},
+		{DocumentGray, true},
+		{DocumentColor, false},
+	}
+	for _, test := range tests {
+		img, operation := processDocument(photo, test.mode)
+		if operation != "document "+test.mode+" page" {
+			t.Errorf("%s operation = %q, expected the page straightened", test.mode, operation)
+		}
+		size := img.Bounds().Size()
+		if math.Abs(float64(size.X-pageSize(corners).X)) > 12 || math.Abs(float64(size.Y-pageSize(corners).Y)) > 12 {
+			t.Errorf("%s size = %v, expected about %v", test.mode, size, pageSize(corners))
+		}
+
+		// Paper turns white, the bar stays dark, the table is gone
+		paper := color.NRGBAModel.Convert(img.At(size.X/10, size.Y/10)).(color.NRGBA)
+		bar := color.NRGBAModel.Convert(img.At(size.X/2, size.Y/2)).(color.NRGBA)
+		if paper.R < 230 || paper.G < 230 || paper.B < 230 {
+			t.Errorf("%s paper = %v, expected white", test.mode, paper)
+		}
+		if bar.R > 80 || bar.G > 80 || bar.B > 80 {
+			t.Errorf("%s bar = %v, expected dark", test.mode, bar)
+		}
+		if test.gray && (paper.R != paper.G || paper.G != paper.B) {
+			t.Errorf("%s paper = %v, expected gray", test.mode, paper)
+		}
+		if test.mode == DocumentBW && (bar.R != 0 || paper.R != 255) {
+			t.Errorf("%s values = %d and %d, expected 0 and 255", test.mode, bar.R, paper.R)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// EXIF tags of the first directory and of the Exif directory it points to
+const (
+	tagModel              = 272
+	tagOrientation        = 274
+	tagDateTime           = 306
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTime         = 0x9010
+	tagOffsetTimeOriginal = 0x9011
+)
+
+// exifTimeLayout is the format of EXIF date and time values
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// exifHeader starts the EXIF data of JPEG APP1 segments and HEIF items
+var exifHeader = []byte("Exif\x00\x00")
+
+// CameraModel returns the camera model recorded in the EXIF data of the
+// image at path, such as "iPhone 15 Pro", or "" if it has none
+func CameraModel(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return tiffString(exifTIFF(data, strings.ToLower(filepath.Ext(path))), tagModel), nil
+}
+
+// exifTIFF returns the TIFF structure holding the EXIF data of an image
+// file with extension ext, or nil
+func exifTIFF(data []byte, ext string) []byte {
+	switch ext {
+	case ".tif", ".tiff":
+		return data
+	case ".png":
+		// The eXIf chunk holds the TIFF structure without a header
+		if i := bytes.Index(data, []byte("eXIf")); i >= 0 {
+			return data[i+4:]
+		}
+		return nil
+	case ".webp":
+		// The EXIF chunk, after its size, sometimes with the JPEG header
+		i := bytes.Index(data, []byte("EXIF"))
+		if i < 0 || i+8 > len(data) {
+			return nil
+		}
+		return bytes.TrimPrefix(data[i+8:], exifHeader)
+	}
+	// JPEG APP1 segments and the Exif items of HEIF containers
+	if i := bytes.Index(data, exifHeader); i >= 0 {
+		return data[i+len(exifHeader):]
+	}
+	return nil
+}
+
+// CaptureTime returns when the image at path was taken according to its
+// EXIF data: DateTimeOriginal, or else DateTime, in the zone of the offset
+// recorded with it or else the local zone. The zero time means it has none.
+func CaptureTime(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	tiff := exifTIFF(data, strings.ToLower(filepath.Ext(path)))
+	if value := exifString(tiff, tagDateTimeOriginal); value != "" {
+		return parseEXIFTime(value, exifString(tiff, tagOffsetTimeOriginal)), nil
+	}
+	return parseEXIFTime(tiffString(tiff, tagDateTime), exifString(tiff, tagOffsetTime)), nil
+}
+
+// parseEXIFTime parses an EXIF date and time with its offset such as
+// "+08:00", returning the zero time for empty or invalid values
+func parseEXIFTime(value, offset string) time.Time {
+	location := time.Local
+	if zone, err := time.Parse("-07:00", offset); err == nil {
+		_, seconds := zone.Zone()
+		location = time.FixedZone(offset, seconds)
+	}
+	t, err := time.ParseInLocation(exifTimeLayout, value, location)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// tiffString returns the ASCII value of tag in the first directory of the
+// TIFF structure data, or ""
+func tiffString(data []byte, tag uint16) string {
+	order := tiffOrder(data)
+	if order == nil {
+		return ""
+	}
+	return asciiValue(tiffValue(data, order, int(order.Uint32(data[4:])), tag, typeASCII))
+}
+
+// readOrientation returns the EXIF orientation of the image at path, from
+// 1 (upright) to 8, or 1 if it has none. HEIF decoding already applies its
+// transformations, so HEIF files are upright.
+func readOrientation(path string) int {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".heic", ".heif", ".avif":
+		return 1
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 1
+	}
+	tiff := exifTIFF(data, ext)
+	order := tiffOrder(tiff)
+	if order == nil {
+		return 1
+	}
+	value := tiffValue(tiff, order, int(order.Uint32(tiff[4:])), tagOrientation, typeShort)
+	if len(value) != 2 {
+		return 1
+	}
+	if orientation := int(order.Uint16(value)); orientation >= 1 && orientation <= 8 {
+		return orientation
+	}
+	return 1
+}
+
+// orient turns img, stored with the EXIF orientation, upright
+func orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// exifString returns the ASCII value of tag in the Exif directory of the
+// TIFF structure data, or ""
+func exifString(data []byte, tag uint16) string {
+	order := tiffOrder(data)
+	if order == nil {
+		return ""
+	}
+	pointer := tiffValue(data, order, int(order.Uint32(data[4:])), tagExifIFD, typeLong)
+	if len(pointer) != 4 {
+		return ""
+	}
+	return asciiValue(tiffValue(data, order, int(order.Uint32(pointer)), tag, typeASCII))
+}
+
+// asciiValue trims the terminating NULs and spaces of an ASCII value
+func asciiValue(value []byte) string {
+	return strings.TrimSpace(string(bytes.TrimRight(value, "\x00")))
+}
+
+// tiffOrder returns the byte order of the TIFF structure data, or nil if
+// it is not one
+func tiffOrder(data []byte) binary.ByteOrder {
+	if len(data) < 8 {
+		return nil
+	}
+	switch string(data[0:2]) {
+	case "II":
+		return binary.LittleEndian
+	case "MM":
+		return binary.BigEndian
+	}
+	return nil
+}
+
+// tiffValue returns the bytes of the value of tag with type kind in the
+// directory at offset ifd of the TIFF structure data, or nil
+func tiffValue(data []byte, order binary.ByteOrder, ifd int, tag, kind uint16) []byte {
+	if ifd < 0 || ifd+2 > len(data) {
+		return nil
+	}
+	count := int(order.Uint16(data[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(data) {
+			return nil
+		}
+		if order.Uint16(data[entry:]) != tag || order.Uint16(data[entry+2:]) != kind {
+			continue
+		}
+		size := int(order.Uint32(data[entry+4:]))
+		switch kind {
+		case typeShort:
+			size *= 2
+		case typeLong:
+			size *= 4
+		}
+		// Values of up to four bytes are stored in the entry itself
+		offset := entry + 8
+		if size > 4 {
+			offset = int(order.Uint32(data[entry+8:]))
+		}
+		if size < 0 || offset < 0 || offset+size > len(data) {
+			return nil
+		}
+		return data[offset : offset+size]
+	}
+	return nil
+}
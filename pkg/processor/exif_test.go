@@ -0,0 +1,309 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// exifWithModel returns a TIFF structure whose only field is the model
+func exifWithModel(order binary.AppendByteOrder, model string) []byte {
+	value := append([]byte(model), 0)
+	header := []byte("MM\x00*")
+	if order == binary.AppendByteOrder(binary.LittleEndian) {
+		header = []byte("II*\x00")
+	}
+	data := order.AppendUint32(header, 8)
+	data = order.AppendUint16(data, 1)
+	data = order.AppendUint16(data, tagModel)
+	data = order.AppendUint16(data, typeASCII)
+	data = order.AppendUint32(data, uint32(len(value)))
+	if len(value) <= 4 {
+		data = append(data, value...)
+		data = append(data, make([]byte, 4-len(value))...)
+		return order.AppendUint32(data, 0)
+	}
+	data = order.AppendUint32(data, 26)
+	data = order.AppendUint32(data, 0)
+	return append(data, value...)
+}
+
+// tiffField is an ASCII field of a test TIFF structure, longer than four
+// bytes so that it is stored after the directories
+type tiffField struct {
+	tag   uint16
+	value string
+}
+
+// exifWithFields returns a TIFF structure with the fields of the first
+// directory and of the Exif directory it points to
+func exifWithFields(order binary.AppendByteOrder, first, exif []tiffField) []byte {
+	header := []byte("MM\x00*")
+	if order == binary.AppendByteOrder(binary.LittleEndian) {
+		header = []byte("II*\x00")
+	}
+	exifIFD := 8 + 2 + 12*(len(first)+1) + 4
+	values := exifIFD + 2 + 12*len(exif) + 4
+
+	var tail []byte
+	appendFields := func(data []byte, fields []tiffField) []byte {
+		for _, f := range fields {
+			value := append([]byte(f.value), 0)
+			data = order.AppendUint16(data, f.tag)
+			data = order.AppendUint16(data, typeASCII)
+			data = order.AppendUint32(data, uint32(len(value)))
+			data = order.AppendUint32(data, uint32(values+len(tail)))
+			tail = append(tail, value...)
+		}
+		return data
+	}
+
+	data := order.AppendUint32(header, 8)
+	data = order.AppendUint16(data, uint16(len(first)+1))
+	data = appendFields(data, first)
+	data = order.AppendUint16(data, tagExifIFD)
+	data = order.AppendUint16(data, typeLong)
+	data = order.AppendUint32(data, 1)
+	data = order.AppendUint32(data, uint32(exifIFD))
+	data = order.AppendUint32(data, 0)
+	data = order.AppendUint16(data, uint16(len(exif)))
+	data = appendFields(data, exif)
+	data = order.AppendUint32(data, 0)
+	return append(data, tail...)
+}
+
+func TestCaptureTime(t *testing.T) {
+	tempDir := t.TempDir()
+	beijing := time.FixedZone("+08:00", 8*3600)
+
+	tests := []struct {
+		name     string
+		order    binary.AppendByteOrder
+		first    []tiffField
+		exif     []tiffField
+		expected time.Time
+	}{
+		{
+			name:     "Original with offset",
+			order:    binary.LittleEndian,
+			exif:     []tiffField{{tagDateTimeOriginal, "2024:05:01 09:30:00"}, {tagOffsetTimeOriginal, "+08:00"}},
+			expected: time.Date(2024, 5, 1, 9, 30, 0, 0, beijing),
+		},
+		{
+			name:     "Original without offset",
+			order:    binary.BigEndian,
+			exif:     []tiffField{{tagDateTimeOriginal, "2024:05:01 09:30:00"}},
+			expected: time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local),
+		},
+		{
+			name:     "Original before modification",
+			order:    binary.LittleEndian,
+			first:    []tiffField{{tagDateTime, "2024:06:01 10:00:00"}},
+			exif:     []tiffField{{tagDateTimeOriginal, "2024:05:01 09:30:00"}, {tagOffsetTimeOriginal, "+08:00"}},
+			expected: time.Date(2024, 5, 1, 9, 30, 0, 0, beijing),
+		},
+		{
+			name:     "Modification only",
+			order:    binary.BigEndian,
+			first:    []tiffField{{tagDateTime, "2024:06:01 10:00:00"}},
+			exif:     []tiffField{{tagOffsetTime, "-05:00"}},
+			expected: time.Date(2024, 6, 1, 10, 0, 0, 0, time.FixedZone("-05:00", -5*3600)),
+		},
+		{
+			name:  "Unset",
+			order: binary.LittleEndian,
+			exif:  []tiffField{{tagDateTimeOriginal, "0000:00:00 00:00:00"}},
+		},
+		{
+			name:  "None",
+			order: binary.LittleEndian,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := append(append([]byte("\xff\xd8\xff\xe1\x00\x40"), exifHeader...), exifWithFields(test.order, test.first, test.exif)...)
+			path := filepath.Join(tempDir, "photo.jpg")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", path, err)
+			}
+			captured, err := CaptureTime(path)
+			if err != nil {
+				t.Fatalf("CaptureTime() error = %v", err)
+			}
+			if !captured.Equal(test.expected) || captured.Format(time.RFC3339) != test.expected.Format(time.RFC3339) {
+				t.Errorf("CaptureTime() = %v, expected %v", captured, test.expected)
+			}
+		})
+	}
+}
+
+func TestCameraModel(t *testing.T) {
+	tempDir := t.TempDir()
+	le := exifWithModel(binary.LittleEndian, "iPhone 15 Pro")
+	be := exifWithModel(binary.BigEndian, "Perfection V600 ")
+
+	tests := []struct {
+		file     string
+		data     []byte
+		expected string
+	}{
+		{"photo.jpg", append(append([]byte("\xff\xd8\xff\xe1\x00\x40"), exifHeader...), le...), "iPhone 15 Pro"},
+		{"photo.heic", append(append([]byte("\x00\x00\x00\x06"), exifHeader...), be...), "Perfection V600"},
+		{"scan.tiff", be, "Perfection V600"},
+		{"image.png", append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x20eXIf"), le...), "iPhone 15 Pro"},
+		{"image.webp", append([]byte("RIFF\x00\x00\x00\x00WEBPEXIF\x20\x00\x00\x00"), le...), "iPhone 15 Pro"},
+		{"short.jpg", append(append([]byte("\xff\xd8"), exifHeader...), exifWithModel(binary.LittleEndian, "X1")...), "X1"},
+		{"none.jpg", []byte("\xff\xd8\xff\xd9"), ""},
+		{"truncated.jpg", append(append([]byte("\xff\xd8"), exifHeader...), le[:20]...), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			path := filepath.Join(tempDir, test.file)
+			if err := os.WriteFile(path, test.data, 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", path, err)
+			}
+			model, err := CameraModel(path)
+			if err != nil {
+				t.Fatalf("CameraModel() error = %v", err)
+			}
+			if model != test.expected {
+				t.Errorf("CameraModel() = %q, expected %q", model, test.expected)
+			}
+		})
+	}
+
+	if _, err := CameraModel(filepath.Join(tempDir, "missing.jpg")); err == nil {
+		t.Error("CameraModel() of a missing file expected error, got nil")
+	}
+}
+
+func TestReadOrientation(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A first directory whose only field is the orientation
+	exif := func(order binary.AppendByteOrder, header string, orientation uint16) []byte {
+		data := order.AppendUint32([]byte(header), 8)
+		data = order.AppendUint16(data, 1)
+		data = order.AppendUint16(data, tagOrientation)
+		data = order.AppendUint16(data, typeShort)
+		data = order.AppendUint32(data, 1)
+		data = order.AppendUint16(data, orientation)
+		data = order.AppendUint16(data, 0)
+		return order.AppendUint32(data, 0)
+	}
+
+	tests := []struct {
+		file     string
+		data     []byte
+		expected int
+	}{
+		{"rotated.jpg", append(append([]byte("\xff\xd8\xff\xe1\x00\x40"), exifHeader...), exif(binary.LittleEndian, "II*\x00", 6)...), 6},
+		{"mirrored.jpg", append(append([]byte("\xff\xd8\xff\xe1\x00\x40"), exifHeader...), exif(binary.BigEndian, "MM\x00*", 2)...), 2},
+		{"invalid.jpg", append(append([]byte("\xff\xd8\xff\xe1\x00\x40"), exifHeader...), exif(binary.LittleEndian, "II*\x00", 9)...), 1},
+		{"none.jpg", []byte("\xff\xd8\xff\xd9"), 1},
+		{"applied.heic", append(append([]byte("\x00\x00\x00\x06"), exifHeader...), exif(binary.BigEndian, "MM\x00*", 6)...), 1},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(tempDir, test.file)
+		if err := os.WriteFile(path, test.data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		if got := readOrientation(path); got != test.expected {
+			t.Errorf("readOrientation(%s) = %d, expected %d", test.file, got, test.expected)
+		}
+	}
+}
+
+func TestProcessAutoOrient(t *testing.T) {
+	tempDir := t.TempDir()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 40, 20)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+
+	// Shot in portrait: an APP1 segment with orientation 6 after SOI
+	tiff := binary.LittleEndian.AppendUint32([]byte("II*\x00"), 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, tagOrientation)
+	tiff = binary.LittleEndian.AppendUint16(tiff, typeShort)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 6)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xff, 0xe1}, uint16(2+len(exifHeader)+len(tiff)))
+	app1 = append(append(app1, exifHeader...), tiff...)
+	inputPath := filepath.Join(tempDir, "portrait.jpg")
+	if err := os.WriteFile(inputPath, append(append(buf.Bytes()[:2:2], app1...), buf.Bytes()[2:]...), 0644); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(tempDir, "out"), 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		options  []Option
+		expected image.Point
+	}{
+		{"Upright by default", nil, image.Pt(20, 40)},
+		{"Stored pixels", []Option{FromConfig(Config{OutputFormat: "png", MaxWidth: 100, MaxHeight: 100, Quality: 90, OutputDir: "out"})}, image.Pt(40, 20)},
+	}
+	for _, test := range tests {
+		p, err := New(append(test.options, WithFormat("png"), WithOutputDir(filepath.Join(tempDir, "out")))...)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		result, err := p.Process(inputPath)
+		if err != nil {
+			t.Fatalf("%s: Process() error = %v", test.name, err)
+		}
+		if size := image.Pt(result.Width, result.Height); size != test.expected {
+			t.Errorf("%s: Process() size = %v, expected %v", test.name, size, test.expected)
+		}
+	}
+
+	thumb, err := Thumbnail(inputPath, 10)
+	if err != nil || thumb.Bounds().Size() != image.Pt(5, 10) {
+		t.Errorf("Thumbnail() = %v, %v, expected upright 5x10", thumb.Bounds(), err)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image marked in its top-left corner
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.White)
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		marker      image.Point
+	}{
+		{1, image.Pt(3, 2), image.Pt(0, 0)},
+		{2, image.Pt(3, 2), image.Pt(2, 0)},
+		{3, image.Pt(3, 2), image.Pt(2, 1)},
+		{4, image.Pt(3, 2), image.Pt(0, 1)},
+		{5, image.Pt(2, 3), image.Pt(0, 0)},
+		{6, image.Pt(2, 3), image.Pt(1, 0)},
+		{7, image.Pt(2, 3), image.Pt(1, 2)},
+		{8, image.Pt(2, 3), image.Pt(0, 2)},
+	}
+
+	for _, test := range tests {
+		out := orient(img, test.orientation)
+		if size := out.Bounds().Size(); size != test.size {
+			t.Errorf("orient(%d) size = %v, expected %v", test.orientation, size, test.size)
+			continue
+		}
+		if r, _, _, _ := out.At(test.marker.X, test.marker.Y).RGBA(); r != 0xffff {
+			t.Errorf("orient(%d) moved the corner away from %v", test.orientation, test.marker)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EXIF tags of the Exif directory describing the stored pixels
+const (
+	tagPixelXDimension = 0xA002
+	tagPixelYDimension = 0xA003
+)
+
+// EXIF tags of the first directory naming who made and owns an image
+const (
+	tagArtist    = 315
+	tagCopyright = 0x8298
+)
+
+// gpsTagNames names the tags of the GPS directory by number
+var gpsTagNames = []string{
+	"GPSVersionID", "GPSLatitudeRef", "GPSLatitude", "GPSLongitudeRef", "GPSLongitude",
+	"GPSAltitudeRef", "GPSAltitude", "GPSTimeStamp", "GPSSatellites", "GPSStatus",
+	"GPSMeasureMode", "GPSDOP", "GPSSpeedRef", "GPSSpeed", "GPSTrackRef", "GPSTrack",
+	"GPSImgDirectionRef", "GPSImgDirection", "GPSMapDatum", "GPSDestLatitudeRef",
+	"GPSDestLatitude", "GPSDestLongitudeRef", "GPSDestLongitude", "GPSDestBearingRef",
+	"GPSDestBearing", "GPSDestDistanceRef", "GPSDestDistance", "GPSProcessingMethod",
+	"GPSAreaInformation", "GPSDateStamp", "GPSDifferential", "GPSHPositioningError",
+}
+
+// tiffTypeSizes are the sizes in bytes of the values of each TIFF field
+// type, from BYTE to DOUBLE
+var tiffTypeSizes = []int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+// maxJPEGEXIF is the largest TIFF structure a JPEG APP1 segment holds
+// after its length and EXIF header
+const maxJPEGEXIF = 0xFFFF - 2 - 6
+
+// sourceEXIF returns the TIFF structure holding the EXIF data of the JPEG
+// or HEIF input at path, or nil if it has none
+func sourceEXIF(path string) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return jpegEXIF(data), nil
+	case ".heic", ".heif", ".avif":
+		return heifEXIF(path)
+	}
+	return nil, nil
+}
+
+// jpegEXIF returns the TIFF structure of the EXIF APP1 segment of the JPEG
+// data, or nil
+func jpegEXIF(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	// Segments up to the image data
+	for at := 2; at+4 <= len(data) && data[at] == 0xFF; {
+		marker := data[at+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		end := at + 2 + int(binary.BigEndian.Uint16(data[at+2:]))
+		if end > len(data) {
+			break
+		}
+		if segment := data[at+4 : end]; marker == 0xE1 && len(segment) > len(exifHeader) && string(segment[:len(exifHeader)]) == string(exifHeader) {
+			return segment[len(exifHeader):]
+		}
+		at = end
+	}
+	return nil
+}
+
+// outputEXIF returns a copy of the EXIF data tiff of an input fit for its
+// outputs of size: the orientation is reset if the pixels are upright, the
+// pixel dimensions are updated, a CaptureTime replaces the recorded one and
+// the thumbnail, which shows the source, is dropped. It returns nil if tiff
+// is not a TIFF structure.
+func outputEXIF(tiff []byte, size image.Point, upright bool, config Config) []byte {
+	order := tiffOrder(tiff)
+	if order == nil {
+		return nil
+	}
+	tiff = append([]byte(nil), tiff...)
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return nil
+	}
+
+	if value := tiffValue(tiff, order, ifd, tagOrientation, typeShort); upright && len(value) == 2 {
+		order.PutUint16(value, 1)
+	}
+
+	// Without a pointer to the next directory there is no thumbnail
+	if next := ifd + 2 + int(order.Uint16(tiff[ifd:]))*12; next+4 <= len(tiff) {
+		order.PutUint32(tiff[next:], 0)
+	}
+
+	pointer := tiffValue(tiff, order, ifd, tagExifIFD, typeLong)
+	if len(pointer) != 4 {
+		return tiff
+	}
+	exif := int(order.Uint32(pointer))
+	for tag, n := range map[uint16]int{tagPixelXDimension: size.X, tagPixelYDimension: size.Y} {
+		if value := tiffValue(tiff, order, exif, tag, typeLong); len(value) == 4 {
+			order.PutUint32(value, uint32(n))
+		} else if value := tiffValue(tiff, order, exif, tag, typeShort); len(value) == 2 && n <= 0xFFFF {
+			order.PutUint16(value, uint16(n))
+		}
+	}
+
+	// Corrected times replace values of the same length
+	if !config.CaptureTime.IsZero() {
+		if value := tiffValue(tiff, order, exif, tagDateTimeOriginal, typeASCII); len(value) == len(exifTimeLayout)+1 {
+			copy(value, config.CaptureTime.Format(exifTimeLayout))
+		}
+		if value := tiffValue(tiff, order, exif, tagOffsetTimeOriginal, typeASCII); len(value) == len("-07:00")+1 {
+			copy(value, config.CaptureTime.Format("-07:00"))
+		}
+	}
+	return tiff
+}
+
+// scrubGPS removes the GPS directory from the EXIF data tiff in place and
+// returns the names of the tags it held, or nil if it had none. The
+// directory and its values are zeroed rather than just unlinked, so that
+// the location cannot be read back from the bytes left behind.
+func scrubGPS(tiff []byte) []string {
+	order := tiffOrder(tiff)
+	if order == nil {
+		return nil
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return nil
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	end := ifd + 2 + count*12 + 4
+	if end > len(tiff) {
+		return nil
+	}
+	entry := -1
+	for i := 0; i < count; i++ {
+		if order.Uint16(tiff[ifd+2+i*12:]) == tagGPS {
+			entry = ifd + 2 + i*12
+		}
+	}
+	if entry < 0 {
+		return nil
+	}
+
+	var tags []string
+	if gps := int(order.Uint32(tiff[entry+8:])); gps >= 8 && gps+2 <= len(tiff) {
+		n := int(order.Uint16(tiff[gps:]))
+		if size := 2 + n*12 + 4; gps+size <= len(tiff) {
+			for i := 0; i < n; i++ {
+				field := gps + 2 + i*12
+				tag, kind := int(order.Uint16(tiff[field:])), int(order.Uint16(tiff[field+2:]))
+				if tag < len(gpsTagNames) {
+					tags = append(tags, gpsTagNames[tag])
+				} else {
+					tags = append(tags, fmt.Sprintf("GPS tag %d", tag))
+				}
+				if kind >= len(tiffTypeSizes) {
+					continue
+				}
+				// Values of more than four bytes are stored elsewhere
+				length := int(order.Uint32(tiff[field+4:])) * tiffTypeSizes[kind]
+				if offset := int(order.Uint32(tiff[field+8:])); length > 4 && offset >= 8 && length <= len(tiff)-offset {
+					clear(tiff[offset : offset+length])
+				}
+			}
+			clear(tiff[gps : gps+size])
+		}
+	}
+	if tags == nil {
+		tags = []string{"GPSInfo"}
+	}
+
+	// Unlink the directory, moving the entries after it and the pointer to
+	// the next directory up
+	copy(tiff[entry:], tiff[entry+12:end])
+	clear(tiff[end-12 : end])
+	order.PutUint16(tiff[ifd:], uint16(count-1))
+	return tags
+}
+
+// writeEXIF writes EXIF data into the outputs of format: that of the
+// input at inputPath into JPEG outputs with config.KeepEXIF, without its
+// location with config.StripGPS, and config.Artist and config.Copyright
+// into JPEG, PNG, WebP and TIFF outputs
+func writeEXIF(inputPath string, outputs []string, format string, config Config) error {
+	var tiff []byte
+	if config.KeepEXIF && format == "jpg" {
+		var err error
+		if tiff, err = keptEXIF(inputPath, config); err != nil {
+			return err
+		}
+	}
+	owner := config.Artist != "" || config.Copyright != ""
+	if owner && format != "tiff" {
+		var err error
+		if tiff, err = exifWithOwner(tiff, config.Artist, config.Copyright); err != nil {
+			return err
+		}
+	}
+	if tiff == nil && !owner {
+		return nil
+	}
+
+	for _, output := range outputs {
+		data, err := os.ReadFile(output)
+		if err != nil {
+			return err
+		}
+		switch format {
+		case "jpg":
+			data, err = jpegWithEXIF(data, tiff)
+		case "png":
+			data, err = pngWithEXIF(data, tiff)
+		case "webp":
+			data, err = webpWithEXIF(data, tiff)
+		case "tiff":
+			// TIFF files are TIFF structures of their own
+			data, err = exifWithOwner(data, config.Artist, config.Copyright)
+		default:
+			config.logger().Debug("Artist and copyright not written, the format holds no EXIF data", "output", output)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(output, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keptEXIF returns the EXIF data of the input at inputPath fit for its
+// JPEG outputs, without its location with config.StripGPS, or nil if it
+// has none that can be kept
+func keptEXIF(inputPath string, config Config) ([]byte, error) {
+	tiff, err := sourceEXIF(inputPath)
+	if err != nil || tiff == nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(inputPath))
+	upright := config.AutoOrient || ext == ".heic" || ext == ".heif" || ext == ".avif"
+	if tiff = outputEXIF(tiff, *config.size, upright, config); tiff == nil {
+		config.logger().Debug("EXIF data not kept, it is malformed", "input", inputPath)
+		return nil, nil
+	}
+	if config.StripGPS {
+		if tags := scrubGPS(tiff); tags != nil && config.scrubbed != nil {
+			*config.scrubbed = tags
+		}
+	}
+	// Leaving room for the artist and copyright
+	if len(tiff)+len(config.Artist)+len(config.Copyright)+64 > maxJPEGEXIF {
+		config.logger().Debug("EXIF data not kept, it is too large for a JPEG segment", "input", inputPath, "size", len(tiff))
+		return nil, nil
+	}
+	return tiff, nil
+}
+
+// exifWithOwner returns a copy of the TIFF structure tiff whose first
+// directory records artist and copyright, those not empty replacing the
+// values it holds. The directory is copied to the end with the new entries
+// and the header pointed at it, leaving the original unreferenced. A nil
+// tiff gets a structure of its own.
+func exifWithOwner(tiff []byte, artist, copyright string) ([]byte, error) {
+	if tiff == nil {
+		tiff = []byte("II*\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	}
+	order := tiffOrder(tiff)
+	if order == nil {
+		return nil, errors.New("not a TIFF structure")
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return nil, errors.New("truncated TIFF structure")
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	end := ifd + 2 + count*12
+	if end+4 > len(tiff) {
+		return nil, errors.New("truncated TIFF structure")
+	}
+
+	out := append([]byte(nil), tiff...)
+	var entries [][]byte
+	for i := 0; i < count; i++ {
+		entry := tiff[ifd+2+i*12 : ifd+14+i*12]
+		if tag := order.Uint16(entry); (tag == tagArtist && artist != "") || (tag == tagCopyright && copyright != "") {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	add := func(tag uint16, value string) {
+		if value == "" {
+			return
+		}
+		data := append([]byte(value), 0)
+		entry := make([]byte, 12)
+		order.PutUint16(entry, tag)
+		order.PutUint16(entry[2:], typeASCII)
+		order.PutUint32(entry[4:], uint32(len(data)))
+		// Values of up to four bytes are stored in the entry itself
+		if len(data) <= 4 {
+			copy(entry[8:], data)
+		} else {
+			if len(out)%2 == 1 {
+				out = append(out, 0)
+			}
+			order.PutUint32(entry[8:], uint32(len(out)))
+			out = append(out, data...)
+		}
+		entries = append(entries, entry)
+	}
+	add(tagArtist, artist)
+	add(tagCopyright, copyright)
+	sort.SliceStable(entries, func(i, j int) bool { return order.Uint16(entries[i]) < order.Uint16(entries[j]) })
+
+	if len(out)%2 == 1 {
+		out = append(out, 0)
+	}
+	newIFD := len(out)
+	out = append(out, 0, 0)
+	order.PutUint16(out[newIFD:], uint16(len(entries)))
+	for _, entry := range entries {
+		out = append(out, entry...)
+	}
+	out = append(out, tiff[end:end+4]...)
+	order.PutUint32(out[4:], uint32(newIFD))
+	return out, nil
+}
+
+// pngWithEXIF inserts an eXIf chunk with the TIFF structure tiff after the
+// IHDR chunk
+func pngWithEXIF(data, tiff []byte) ([]byte, error) {
+	const ihdrEnd = 8 + 8 + 13 + 4
+	if len(data) < ihdrEnd || string(data[12:16]) != "IHDR" {
+		return nil, errors.New("not a PNG file")
+	}
+	return splice(data, ihdrEnd, pngChunk("eXIf", tiff)), nil
+}
+
+// webpWithEXIF adds an EXIF chunk with the TIFF structure tiff before any
+// XMP chunk, turning a simple WebP into an extended one when needed
+func webpWithEXIF(data, tiff []byte) ([]byte, error) {
+	chunks, err := extendedWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	chunks[0].data[0] |= webpEXIFFlag
+
+	var body bytes.Buffer
+	written := false
+	for _, chunk := range chunks {
+		if chunk.id == "XMP " && !written {
+			writeWebPChunk(&body, "EXIF", tiff)
+			written = true
+		}
+		if chunk.id != "EXIF" {
+			writeWebPChunk(&body, chunk.id, chunk.data)
+		}
+	}
+	if !written {
+		writeWebPChunk(&body, "EXIF", tiff)
+	}
+
+	var out bytes.Buffer
+	if err := writeWebPFile(&out, body.Bytes()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// jpegWithEXIF inserts an APP1 EXIF segment with the TIFF structure tiff
+// after the SOI marker and any JFIF header
+func jpegWithEXIF(data, tiff []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("not a JPEG file")
+	}
+
+	at := 2
+	if data[2] == 0xFF && data[3] == 0xE0 && len(data) >= 6 {
+		at += 2 + int(binary.BigEndian.Uint16(data[4:6]))
+	}
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+len(exifHeader)+len(tiff)))
+	segment = append(append(segment, exifHeader...), tiff...)
+	return splice(data, at, segment), nil
+}
@@ -0,0 +1,283 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// jpegWithAPP1 returns a 40x20 JPEG with the TIFF structure tiff in an
+// EXIF segment after SOI
+func jpegWithAPP1(t *testing.T, tiff []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 40, 20)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	data, err := jpegWithEXIF(buf.Bytes(), tiff)
+	if err != nil {
+		t.Fatalf("jpegWithEXIF() error = %v", err)
+	}
+	return data
+}
+
+// exifWithGPS returns a TIFF structure with the camera model and a GPS
+// directory holding the map datum and date stamp
+func exifWithGPS(order binary.ByteOrder) []byte {
+	tiff := exifWithFields(order.(binary.AppendByteOrder), []tiffField{{tagModel, "Test Camera"}},
+		[]tiffField{{18, "WGS-84"}, {29, "2024:05:01"}})
+	// The Exif directory becomes the GPS directory
+	order.PutUint16(tiff[8+2+12:], tagGPS)
+	return tiff
+}
+
+func TestProcessKeepEXIF(t *testing.T) {
+	tempDir := t.TempDir()
+	outDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	beijing := time.FixedZone("+08:00", 8*3600)
+
+	tiff := exifWithFields(binary.BigEndian,
+		[]tiffField{{tagModel, "Test Camera"}},
+		[]tiffField{{tagDateTimeOriginal, "2024:05:01 10:20:30"}, {tagOffsetTimeOriginal, "+08:00"}})
+	inputPath := filepath.Join(tempDir, "photo.jpg")
+	if err := os.WriteFile(inputPath, jpegWithAPP1(t, tiff), 0644); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		options  []Option
+		model    string
+		captured time.Time
+	}{
+		{"Dropped by default", nil, "", time.Time{}},
+		{"Kept", []Option{WithKeepEXIF()}, "Test Camera", time.Date(2024, 5, 1, 10, 20, 30, 0, beijing)},
+		{"Corrected capture time", []Option{WithKeepEXIF(), func(c *Config) { c.CaptureTime = time.Date(2024, 5, 1, 18, 20, 30, 0, beijing) }}, "Test Camera", time.Date(2024, 5, 1, 18, 20, 30, 0, beijing)},
+		{"Stripped", []Option{WithKeepEXIF(), WithMetadataPolicy(MetadataStrip, "")}, "", time.Time{}},
+		{"PNG outputs", []Option{WithKeepEXIF(), WithFormat("png")}, "", time.Time{}},
+	}
+	for _, test := range tests {
+		p, err := New(append([]Option{WithOutputDir(outDir), WithExistingPolicy(ExistingOverwrite)}, test.options...)...)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		result, err := p.Process(inputPath)
+		if err != nil {
+			t.Fatalf("%s: Process() error = %v", test.name, err)
+		}
+		if model, _ := CameraModel(result.OutputPath); model != test.model {
+			t.Errorf("%s: camera model = %q, expected %q", test.name, model, test.model)
+		}
+		if captured, _ := CaptureTime(result.OutputPath); !captured.Equal(test.captured) {
+			t.Errorf("%s: capture time = %v, expected %v", test.name, captured, test.captured)
+		}
+		if data, err := os.ReadFile(result.OutputPath); err == nil && bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+			if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+				t.Errorf("%s: output no longer decodes: %v", test.name, err)
+			}
+		}
+	}
+}
+
+func TestOutputEXIF(t *testing.T) {
+	// Orientation 6 and a thumbnail directory after the first
+	tiff := binary.LittleEndian.AppendUint32([]byte("II*\x00"), 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, tagOrientation)
+	tiff = binary.LittleEndian.AppendUint16(tiff, typeShort)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 6)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 26)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+
+	tests := []struct {
+		name        string
+		upright     bool
+		orientation uint16
+	}{
+		{"Upright pixels", true, 1},
+		{"Stored pixels", false, 6},
+	}
+	for _, test := range tests {
+		out := outputEXIF(tiff, image.Pt(20, 40), test.upright, Config{})
+		if got := binary.LittleEndian.Uint16(out[18:]); got != test.orientation {
+			t.Errorf("%s: orientation = %d, expected %d", test.name, got, test.orientation)
+		}
+		if next := binary.LittleEndian.Uint32(out[22:]); next != 0 {
+			t.Errorf("%s: next directory = %d, expected the thumbnail dropped", test.name, next)
+		}
+	}
+	if binary.LittleEndian.Uint16(tiff[18:]) != 6 {
+		t.Error("outputEXIF() changed its input")
+	}
+
+	if out := outputEXIF([]byte("not a TIFF"), image.Pt(1, 1), true, Config{}); out != nil {
+		t.Errorf("outputEXIF() of garbage = %v, expected nil", out)
+	}
+}
+
+func TestScrubGPS(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		tiff := exifWithGPS(order)
+		tags := scrubGPS(tiff)
+		if expected := []string{"GPSMapDatum", "GPSDateStamp"}; !reflect.DeepEqual(tags, expected) {
+			t.Errorf("%v: scrubGPS() = %v, expected %v", order, tags, expected)
+		}
+		if bytes.Contains(tiff, []byte("WGS-84")) || bytes.Contains(tiff, []byte("2024:05:01")) {
+			t.Errorf("%v: location values left in the data", order)
+		}
+		if model := tiffString(tiff, tagModel); model != "Test Camera" {
+			t.Errorf("%v: camera model = %q, expected it kept", order, model)
+		}
+		if value := tiffValue(tiff, order, 8, tagGPS, typeLong); value != nil {
+			t.Errorf("%v: GPS directory still linked", order)
+		}
+	}
+
+	if tags := scrubGPS(exifWithModel(binary.LittleEndian, "Phone")); tags != nil {
+		t.Errorf("scrubGPS() without location = %v, expected nil", tags)
+	}
+}
+
+func TestProcessStripGPS(t *testing.T) {
+	tempDir := t.TempDir()
+	outDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	inputPath := filepath.Join(tempDir, "photo.jpg")
+	if err := os.WriteFile(inputPath, jpegWithAPP1(t, exifWithGPS(binary.BigEndian)), 0644); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+
+	p, err := New(WithOutputDir(outDir), WithStripGPS())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	result, err := p.Process(inputPath)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if expected := []string{"GPSMapDatum", "GPSDateStamp"}; !reflect.DeepEqual(result.Scrubbed, expected) {
+		t.Errorf("Process() scrubbed = %v, expected %v", result.Scrubbed, expected)
+	}
+	if model, _ := CameraModel(result.OutputPath); model != "Test Camera" {
+		t.Errorf("camera model = %q, expected it kept", model)
+	}
+	if data, _ := os.ReadFile(result.OutputPath); bytes.Contains(data, []byte("WGS-84")) {
+		t.Error("output still holds the location")
+	}
+}
+
+func TestJPEGEXIF(t *testing.T) {
+	tiff := exifWithModel(binary.LittleEndian, "Phone")
+	data := jpegWithAPP1(t, tiff)
+	if got := jpegEXIF(data); !bytes.Equal(got, tiff) {
+		t.Errorf("jpegEXIF() = %q, expected %q", got, tiff)
+	}
+
+	// An XMP segment before it and none at all
+	xmp, err := jpegWithXMP(data, []byte("<x:xmpmeta/>"))
+	if err != nil {
+		t.Fatalf("jpegWithXMP() error = %v", err)
+	}
+	if got := jpegEXIF(xmp); !bytes.Equal(got, tiff) {
+		t.Errorf("jpegEXIF() after XMP = %q, expected %q", got, tiff)
+	}
+	if got := jpegEXIF([]byte("\xff\xd8\xff\xd9")); got != nil {
+		t.Errorf("jpegEXIF() without EXIF = %q, expected nil", got)
+	}
+}
+
+func TestExifWithOwner(t *testing.T) {
+	tests := []struct {
+		name      string
+		tiff      []byte
+		artist    string
+		copyright string
+		model     string
+	}{
+		{"New structure", nil, "Jane Doe", "© 2026 Jane Doe", ""},
+		{"Added to the camera's", exifWithModel(binary.BigEndian, "Test Camera"), "Jane Doe", "© 2026 Jane Doe", "Test Camera"},
+		{"Short values", exifWithModel(binary.LittleEndian, "Test Camera"), "JD", "", "Test Camera"},
+		{"Replacing the camera's", exifWithFields(binary.LittleEndian, []tiffField{{tagModel, "Test Camera"}, {tagArtist, "Camera Owner"}}, nil), "Jane Doe", "", "Test Camera"},
+	}
+	for _, test := range tests {
+		tiff, err := exifWithOwner(test.tiff, test.artist, test.copyright)
+		if err != nil {
+			t.Fatalf("%s: exifWithOwner() error = %v", test.name, err)
+		}
+		if artist := tiffString(tiff, tagArtist); artist != test.artist {
+			t.Errorf("%s: artist = %q, expected %q", test.name, artist, test.artist)
+		}
+		if copyright := tiffString(tiff, tagCopyright); copyright != test.copyright {
+			t.Errorf("%s: copyright = %q, expected %q", test.name, copyright, test.copyright)
+		}
+		if model := tiffString(tiff, tagModel); model != test.model {
+			t.Errorf("%s: camera model = %q, expected %q", test.name, model, test.model)
+		}
+	}
+	if _, err := exifWithOwner([]byte("not a TIFF"), "Jane Doe", ""); err == nil {
+		t.Error("exifWithOwner() of no TIFF structure succeeded")
+	}
+}
+
+func TestProcessOwner(t *testing.T) {
+	tempDir := t.TempDir()
+	outDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	inputPath := filepath.Join(tempDir, "photo.jpg")
+	if err := os.WriteFile(inputPath, jpegWithAPP1(t, exifWithModel(binary.BigEndian, "Test Camera")), 0644); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+
+	tests := []struct {
+		format string
+		model  string
+	}{
+		{"jpg", "Test Camera"},
+		{"png", ""},
+		{"webp", ""},
+		{"tiff", ""},
+	}
+	for _, test := range tests {
+		p, err := New(WithOutputDir(outDir), WithFormat(test.format), WithKeepEXIF(), WithOwner("Jane Doe", "© 2026 Jane Doe"),
+			WithMetadataPolicy(MetadataProcessingLog, "test"))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		result, err := p.Process(inputPath)
+		if err != nil {
+			t.Fatalf("%s: Process() error = %v", test.format, err)
+		}
+		data, err := os.ReadFile(result.OutputPath)
+		if err != nil {
+			t.Fatalf("%s: Failed to read output: %v", test.format, err)
+		}
+		tiff := exifTIFF(data, filepath.Ext(result.OutputPath))
+		if artist := tiffString(tiff, tagArtist); artist != "Jane Doe" {
+			t.Errorf("%s: artist = %q, expected Jane Doe", test.format, artist)
+		}
+		if copyright := tiffString(tiff, tagCopyright); copyright != "© 2026 Jane Doe" {
+			t.Errorf("%s: copyright = %q, expected it written", test.format, copyright)
+		}
+		if model := tiffString(tiff, tagModel); model != test.model {
+			t.Errorf("%s: camera model = %q, expected %q", test.format, model, test.model)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: output no longer decodes: %v", test.format, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package processor
+
+import "os"
+
+// ExistingPolicy selects what Process does when an output already exists,
+// such as when a batch is run again
+type ExistingPolicy int
+
+const (
+	// ExistingOverwrite replaces existing outputs
+	ExistingOverwrite ExistingPolicy = iota
+	// ExistingSkip keeps existing outputs without reading the input
+	ExistingSkip
+	// ExistingIfNewer keeps existing outputs unless the input was modified
+	// after them
+	ExistingIfNewer
+)
+
+// String returns the name of the policy
+func (p ExistingPolicy) String() string {
+	switch p {
+	case ExistingSkip:
+		return "skip"
+	case ExistingIfNewer:
+		return "if-newer"
+	}
+	return "overwrite"
+}
+
+// existingOutput returns the output of an earlier run at outputPath, or at
+// its first page or mipmap level when the input was split into those, and
+// its file info. The info is nil when there is none.
+func existingOutput(outputPath string) (string, os.FileInfo) {
+	for _, path := range []string{outputPath, pagePaths(outputPath, 1)[0], mipmapPaths(outputPath, 1)[0]} {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, info
+		}
+	}
+	return outputPath, nil
+}
+
+// keeps reports whether p keeps an existing output for the input
+func (p ExistingPolicy) keeps(input, output os.FileInfo) bool {
+	switch p {
+	case ExistingSkip:
+		return true
+	case ExistingIfNewer:
+		return !input.ModTime().After(output.ModTime())
+	}
+	return false
+}
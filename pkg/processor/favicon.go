@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+)
+
+// FaviconSizes are the sizes of the PNG favicons: the browser tab sizes,
+// the Apple touch icon and the web app manifest icons
+var FaviconSizes = []int{16, 32, 48, 180, 192, 512}
+
+// faviconICOSizes are the sizes packed into favicon.ico
+var faviconICOSizes = []int{16, 32, 48}
+
+// faviconName returns the file name of the PNG favicon of size
+func faviconName(size int) string {
+	return fmt.Sprintf("favicon-%dx%d.png", size, size)
+}
+
+// Favicon renders the image at inputPath as favicon.ico and a PNG for each
+// of FaviconSizes in config.OutputDir, and returns the written paths. The
+// image is cropped to a square around its focal point with config.Fill,
+// otherwise centered on a transparent square; MaxWidth and MaxHeight are
+// ignored.
+func Favicon(inputPath string, config Config) ([]string, error) {
+	outputs := []string{filepath.Join(config.OutputDir, "favicon.ico")}
+	for _, size := range FaviconSizes {
+		outputs = append(outputs, filepath.Join(config.OutputDir, faviconName(size)))
+	}
+	if err := checkOverwrite(inputPath, outputs); err != nil {
+		return nil, err
+	}
+
+	square, err := loadSquare(inputPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var icons []image.Image
+	for _, size := range faviconICOSizes {
+		icons = append(icons, imaging.Resize(square, size, size, imaging.Lanczos))
+	}
+	file, err := os.Create(outputs[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := encodeICO(file, icons); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	for i, size := range FaviconSizes {
+		icon := imaging.Resize(square, size, size, imaging.Lanczos)
+		if err := saveImage(icon, outputs[i+1], "png", config.Quality, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, output := range outputs {
+		if err := finishOutput(output, config); err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
+
+// checkOverwrite returns ErrOverwritesInput if one of outputs is the file
+// at inputPath
+func checkOverwrite(inputPath string, outputs []string) error {
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return err
+	}
+	for _, output := range outputs {
+		if outInfo, err := os.Stat(output); err == nil && os.SameFile(info, outInfo) {
+			return ErrOverwritesInput
+		}
+	}
+	return nil
+}
+
+// loadSquare loads the image at inputPath, transforms it like Process at
+// full size and makes it square: cropped around its focal point with
+// config.Fill, otherwise centered on a transparent square
+func loadSquare(inputPath string, config Config) (image.Image, error) {
+	img, err := loadInput(inputPath, nil, config.MaxPixels)
+	if err != nil {
+		return nil, err
+	}
+
+	// A square target makes Fill crop to a square, and is large enough
+	// that nothing is resized
+	size := img.Bounds().Size()
+	config = sourceConfig(inputPath, config)
+	config.MaxWidth = max(size.X, size.Y)
+	config.MaxHeight = config.MaxWidth
+	img, err = transformImage(img, config)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() == bounds.Dy() {
+		return img, nil
+	}
+	side := max(bounds.Dx(), bounds.Dy())
+	square := image.NewNRGBA(image.Rect(0, 0, side, side))
+	offset := image.Pt((side-bounds.Dx())/2, (side-bounds.Dy())/2)
+	draw.Draw(square, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Src)
+	return square, nil
+}
@@ -0,0 +1,158 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// icoEntry is a parsed ICONDIRENTRY with its image data
+type icoEntry struct {
+	width, height int
+	data          []byte
+}
+
+func readICO(t *testing.T, data []byte) []icoEntry {
+	t.Helper()
+	if len(data) < 6 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		t.Fatalf("not an ICO file")
+	}
+	var entries []icoEntry
+	for i := 0; i < int(binary.LittleEndian.Uint16(data[4:])); i++ {
+		entry := data[6+16*i:]
+		width, height := int(entry[0]), int(entry[1])
+		if width == 0 {
+			width = 256
+		}
+		if height == 0 {
+			height = 256
+		}
+		size := binary.LittleEndian.Uint32(entry[8:])
+		offset := binary.LittleEndian.Uint32(entry[12:])
+		if int(offset+size) > len(data) {
+			t.Fatalf("entry %d outside the file", i)
+		}
+		entries = append(entries, icoEntry{width, height, data[offset : offset+size]})
+	}
+	return entries
+}
+
+func TestEncodeICO(t *testing.T) {
+	small := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	small.Set(0, 0, color.NRGBA{10, 20, 30, 255})
+	small.Set(2, 1, color.NRGBA{40, 50, 60, 128})
+	large := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+
+	var buf bytes.Buffer
+	if err := encodeICO(&buf, []image.Image{small, large}); err != nil {
+		t.Fatalf("encodeICO() error = %v", err)
+	}
+	entries := readICO(t, buf.Bytes())
+	if len(entries) != 2 {
+		t.Fatalf("ICO has %d entries, expected 2", len(entries))
+	}
+
+	bitmap := entries[0]
+	if bitmap.width != 3 || bitmap.height != 2 {
+		t.Errorf("entry size = %dx%d, expected 3x2", bitmap.width, bitmap.height)
+	}
+	if h := binary.LittleEndian.Uint32(bitmap.data[8:]); h != 4 {
+		t.Errorf("bitmap height = %d, expected twice the image height", h)
+	}
+	// Rows are bottom-up BGRA: the top-left pixel starts the second row
+	pixels := bitmap.data[40:]
+	if got := pixels[3*4 : 3*4+4]; !bytes.Equal(got, []byte{30, 20, 10, 255}) {
+		t.Errorf("top-left pixel = %v, expected BGRA 30 20 10 255", got)
+	}
+	if got := pixels[2*4 : 2*4+4]; !bytes.Equal(got, []byte{60, 50, 40, 128}) {
+		t.Errorf("bottom-right pixel = %v, expected BGRA 60 50 40 128", got)
+	}
+	// Mask rows are padded to 32 bits; only the transparent pixels are set
+	mask := pixels[3*2*4:]
+	if mask[0] != 0b11000000 || mask[4] != 0b01100000 {
+		t.Errorf("mask rows = %08b %08b, expected 11000000 01100000", mask[0], mask[4])
+	}
+
+	if entries[1].width != 256 {
+		t.Errorf("large entry width = %d, expected 256", entries[1].width)
+	}
+	if _, err := png.Decode(bytes.NewReader(entries[1].data)); err != nil {
+		t.Errorf("256 pixel entry is not a PNG: %v", err)
+	}
+
+	if err := encodeICO(&buf, []image.Image{image.NewNRGBA(image.Rect(0, 0, 512, 512))}); err == nil {
+		t.Error("encodeICO() accepted a 512 pixel entry")
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	// A wide image: red left half, blue right half
+	src := image.NewNRGBA(image.Rect(0, 0, 120, 60))
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 120; x++ {
+			c := color.NRGBA{255, 0, 0, 255}
+			if x >= 60 {
+				c = color.NRGBA{0, 0, 255, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	inputPath := filepath.Join(t.TempDir(), "logo.png")
+	if err := encodePNG(src)(inputPath); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		fill bool
+		// corner is the expected alpha of the top-left corner of the icons
+		corner uint8
+	}{
+		{"fit pads with transparency", false, 0},
+		{"fill crops to a square", true, 255},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			outputs, err := Favicon(inputPath, Config{OutputDir: dir, Fill: test.fill})
+			if err != nil {
+				t.Fatalf("Favicon() error = %v", err)
+			}
+			if len(outputs) != len(FaviconSizes)+1 {
+				t.Errorf("Favicon() wrote %d files, expected %d", len(outputs), len(FaviconSizes)+1)
+			}
+
+			for _, size := range FaviconSizes {
+				img, err := loadImage(filepath.Join(dir, faviconName(size)))
+				if err != nil {
+					t.Fatalf("size %d: %v", size, err)
+				}
+				if got := img.Bounds().Size(); got != image.Pt(size, size) {
+					t.Errorf("size %d: got %dx%d", size, got.X, got.Y)
+				}
+				if _, _, _, a := img.At(0, 0).RGBA(); uint8(a>>8) != test.corner {
+					t.Errorf("size %d: corner alpha = %d, expected %d", size, a>>8, test.corner)
+				}
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "favicon.ico"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries := readICO(t, data)
+			if len(entries) != len(faviconICOSizes) {
+				t.Fatalf("favicon.ico has %d entries, expected %d", len(entries), len(faviconICOSizes))
+			}
+			for i, size := range faviconICOSizes {
+				if entries[i].width != size || entries[i].height != size {
+					t.Errorf("entry %d is %dx%d, expected %dx%d", i, entries[i].width, entries[i].height, size, size)
+				}
+			}
+		})
+	}
+}
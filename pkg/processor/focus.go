@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// XMP namespaces of Metadata Working Group image regions
+const (
+	mwgRegionsNS = "http://www.metadataworkinggroup.com/schemas/regions/"
+	stAreaNS     = "http://ns.adobe.com/xmp/sType/Area#"
+)
+
+// FocalPoint is the point of interest of an image, as fractions of its
+// width and height from the top-left corner
+type FocalPoint struct {
+	X float64
+	Y float64
+}
+
+// focusRegion is an image region read from XMP
+type focusRegion struct {
+	kind       string
+	x, y       float64
+	hasX, hasY bool
+}
+
+// readXMPFocus returns the focal point stored in the XMP metadata of the
+// file at path: the center of the first region of type Focus, or else of
+// the first region
+func readXMPFocus(path string) (*FocalPoint, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	start := bytes.Index(data, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return nil, false
+	}
+	end := bytes.Index(data[start:], []byte("</x:xmpmeta>"))
+	if end < 0 {
+		return nil, false
+	}
+	return parseXMPFocus(data[start : start+end+len("</x:xmpmeta>")])
+}
+
+// parseXMPFocus finds the focal point in an XMP packet
+func parseXMPFocus(packet []byte) (*FocalPoint, bool) {
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+
+	// Every rdf:li may be a region; attributes and fields apply to the
+	// innermost one
+	var stack []*focusRegion
+	var regions []focusRegion
+	var field xml.Name
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "li" {
+				stack = append(stack, &focusRegion{})
+			}
+			field = t.Name
+			if len(stack) > 0 {
+				for _, attr := range t.Attr {
+					setRegionField(stack[len(stack)-1], attr.Name, attr.Value)
+				}
+			}
+		case xml.CharData:
+			if len(stack) > 0 && field.Space != "" {
+				setRegionField(stack[len(stack)-1], field, string(t))
+			}
+		case xml.EndElement:
+			field = xml.Name{}
+			if t.Name.Local == "li" && len(stack) > 0 {
+				r := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if r.hasX && r.hasY {
+					regions = append(regions, *r)
+				}
+			}
+		}
+	}
+
+	if len(regions) == 0 {
+		return nil, false
+	}
+	chosen := regions[0]
+	for _, r := range regions {
+		if strings.EqualFold(r.kind, "Focus") {
+			chosen = r
+			break
+		}
+	}
+	return &FocalPoint{X: chosen.x, Y: chosen.y}, true
+}
+
+// setRegionField records an XMP property of a region
+func setRegionField(r *focusRegion, name xml.Name, value string) {
+	value = strings.TrimSpace(value)
+	switch {
+	case name.Space == mwgRegionsNS && name.Local == "Type":
+		r.kind = value
+	case name.Space == stAreaNS && (name.Local == "x" || name.Local == "y"):
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || n < 0 || n > 1 {
+			return
+		}
+		if name.Local == "x" {
+			r.x, r.hasX = n, true
+		} else {
+			r.y, r.hasY = n, true
+		}
+	}
+}
+
+// fillCrop crops img to the aspect ratio of width x height, keeping the
+// crop as close to centered on focus, in pixels of img, as the image allows
+func fillCrop(img image.Image, width, height int, focus image.Point) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	crop := fillSize(bounds.Size(), width, height)
+	cropW, cropH := crop.X, crop.Y
+	if cropW == w && cropH == h {
+		return img
+	}
+
+	x := clamp(focus.X-bounds.Min.X-cropW/2, 0, w-cropW)
+	y := clamp(focus.Y-bounds.Min.Y-cropH/2, 0, h-cropH)
+	rect := image.Rect(x, y, x+cropW, y+cropH).Add(bounds.Min)
+	return imaging.Crop(img, rect)
+}
+
+// fillSize returns the largest part of an image of size with the aspect
+// ratio of width x height, the size fillCrop crops to
+func fillSize(size image.Point, width, height int) image.Point {
+	aspect := float64(width) / float64(height)
+	crop := size
+	if float64(size.X)/float64(size.Y) > aspect {
+		crop.X = int(math.Round(float64(size.Y) * aspect))
+	} else {
+		crop.Y = int(math.Round(float64(size.X) / aspect))
+	}
+	return image.Pt(max(1, crop.X), max(1, crop.Y))
+}
+
+// clamp limits v to the range lo to hi
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
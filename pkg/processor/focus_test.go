@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseXMPFocus(t *testing.T) {
+	const attributes = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:mwg-rs="http://www.metadataworkinggroup.com/schemas/regions/" xmlns:stArea="http://ns.adobe.com/xmp/sType/Area#">
+<mwg-rs:Regions rdf:parseType="Resource">
+<mwg-rs:RegionList><rdf:Bag>
+<rdf:li><rdf:Description mwg-rs:Name="Ann" mwg-rs:Type="Face"><mwg-rs:Area stArea:x="0.2" stArea:y="0.3" stArea:w="0.1" stArea:h="0.1"/></rdf:Description></rdf:li>
+<rdf:li><rdf:Description mwg-rs:Type="Focus"><mwg-rs:Area stArea:x="0.75" stArea:y="0.25"/></rdf:Description></rdf:li>
+</rdf:Bag></mwg-rs:RegionList>
+</mwg-rs:Regions>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>`
+
+	const elements = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:mwg-rs="http://www.metadataworkinggroup.com/schemas/regions/" xmlns:stArea="http://ns.adobe.com/xmp/sType/Area#">
+<mwg-rs:Regions><rdf:Description><mwg-rs:RegionList><rdf:Bag>
+<rdf:li><rdf:Description>
+<mwg-rs:Type>Face</mwg-rs:Type>
+<mwg-rs:Area><rdf:Description><stArea:x>0.4</stArea:x><stArea:y>0.6</stArea:y></rdf:Description></mwg-rs:Area>
+</rdf:Description></rdf:li>
+</rdf:Bag></mwg-rs:RegionList></rdf:Description></mwg-rs:Regions>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>`
+
+	tests := []struct {
+		name     string
+		packet   string
+		expected *FocalPoint
+	}{
+		{"Focus region preferred", attributes, &FocalPoint{X: 0.75, Y: 0.25}},
+		{"First region as elements", elements, &FocalPoint{X: 0.4, Y: 0.6}},
+		{"No regions", `<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			point, ok := parseXMPFocus([]byte(test.packet))
+			if test.expected == nil {
+				if ok {
+					t.Errorf("parseXMPFocus() = %+v, expected none", point)
+				}
+				return
+			}
+			if !ok || *point != *test.expected {
+				t.Errorf("parseXMPFocus() = %+v, %t, expected %+v", point, ok, *test.expected)
+			}
+		})
+	}
+
+	// The packet is found inside any file, e.g. a JPEG APP1 segment
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, []byte("\xff\xd8\xff\xe1junk"+attributes+"\xff\xd9"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if point, ok := readXMPFocus(path); !ok || *point != (FocalPoint{X: 0.75, Y: 0.25}) {
+		t.Errorf("readXMPFocus() = %+v, %t, expected {0.75 0.25}", point, ok)
+	}
+}
+
+func TestFillCrop(t *testing.T) {
+	// Encode the position in each pixel so the crop position can be checked
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			img.Set(x, y, color.RGBA{uint8(x / 2), uint8(y), 0, 255})
+		}
+	}
+
+	tests := []struct {
+		name     string
+		width    int
+		height   int
+		focus    image.Point
+		expected image.Rectangle
+	}{
+		{"Square around center", 100, 100, image.Pt(200, 100), image.Rect(100, 0, 300, 200)},
+		{"Square around right side", 100, 100, image.Pt(260, 50), image.Rect(160, 0, 360, 200)},
+		{"Square clamped to right edge", 100, 100, image.Pt(380, 50), image.Rect(200, 0, 400, 200)},
+		{"Square clamped to left edge", 100, 100, image.Pt(20, 100), image.Rect(0, 0, 200, 200)},
+		{"Wide crop around top", 400, 100, image.Pt(200, 10), image.Rect(0, 0, 400, 100)},
+		{"Same aspect ratio", 800, 400, image.Pt(0, 0), image.Rect(0, 0, 400, 200)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := fillCrop(img, test.width, test.height, test.focus)
+			if result.Bounds().Size() != test.expected.Size() {
+				t.Fatalf("fillCrop() size = %v, expected %v", result.Bounds().Size(), test.expected.Size())
+			}
+			r, g, _, _ := result.At(result.Bounds().Min.X, result.Bounds().Min.Y).RGBA()
+			if origin := image.Pt(int(r>>8)*2, int(g>>8)); origin != test.expected.Min {
+				t.Errorf("fillCrop() starts at %v, expected %v", origin, test.expected.Min)
+			}
+		})
+	}
+}
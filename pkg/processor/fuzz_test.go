@@ -0,0 +1,183 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The fuzz targets feed malformed files to the decoders, which must return
+// errors rather than panic or hang: the tool is pointed at untrusted photo
+// dumps. Run one with e.g.
+//
+//	go test ./pkg/processor -run '^$' -fuzz FuzzLoadImage -fuzztime 1m
+//
+// Without -fuzz they run their seeds as regular tests.
+
+// fuzzLimit lowers maxPixels for the duration of a fuzz target, so that
+// the inputs it finds with large sizes fail fast instead of allocating
+// gigabytes in each worker
+func fuzzLimit(f *testing.F) {
+	saved := maxPixels
+	maxPixels = 1 << 22
+	f.Cleanup(func() { maxPixels = saved })
+}
+
+// fuzzSeed returns img encoded by encode, for seeding a fuzz target
+func fuzzSeed(f *testing.F, ext string, encode func(path string) error) []byte {
+	path := filepath.Join(f.TempDir(), "seed"+ext)
+	if err := encode(path); err != nil {
+		f.Fatalf("Failed to write %s seed: %v", ext, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		f.Fatal(err)
+	}
+	return data
+}
+
+// fuzzImage is a small image with alpha and enough colors to exercise the
+// encoders
+var fuzzImage = func() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 12, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 12; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 20), uint8(y * 30), 128, uint8(255 - x*10)})
+		}
+	}
+	return img
+}()
+
+// fuzzFile writes data to a file with extension ext in dir, as the
+// decoders pick their format by extension
+func fuzzFile(t *testing.T, dir, ext string, data []byte) string {
+	file, err := os.CreateTemp(dir, "fuzz-*"+ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func FuzzLoadImage(f *testing.F) {
+	fuzzLimit(f)
+	seeds := []struct {
+		ext    string
+		encode func(string) error
+	}{
+		{".png", encodePNG(fuzzImage)},
+		{".jpg", encodeJPEG(fuzzImage)},
+		{".gif", encodeGrayGIF(fuzzImage)},
+		{".bmp", encodeBMP(fuzzImage)},
+		{".tiff", encodeTIFFFile(fuzzImage)},
+		{".webp", encodeLosslessWebP(fuzzImage)},
+		{".webp", encodeWith(fuzzImage, "webp")},
+	}
+	for i, seed := range seeds {
+		f.Add(fuzzSeed(f, seed.ext, seed.encode), uint8(i))
+	}
+	dir := f.TempDir()
+
+	f.Fuzz(func(t *testing.T, data []byte, format uint8) {
+		ext := seeds[int(format)%len(seeds)].ext
+		img, err := loadImage(fuzzFile(t, dir, ext, data))
+		if err == nil && img == nil {
+			t.Fatal("loadImage() returned neither an image nor an error")
+		}
+	})
+}
+
+// FuzzLoadHEIF covers the libheif path of loadImage, for HEIC and AVIF
+func FuzzLoadHEIF(f *testing.F) {
+	fuzzLimit(f)
+	for _, format := range []string{"heic", "avif"} {
+		f.Add(fuzzSeed(f, "."+format, encodeWith(fuzzImage, format)), format == "avif")
+	}
+	dir := f.TempDir()
+
+	f.Fuzz(func(t *testing.T, data []byte, avif bool) {
+		ext := ".heic"
+		if avif {
+			ext = ".avif"
+		}
+		loadImage(fuzzFile(t, dir, ext, data))
+	})
+}
+
+func FuzzDecodeAnimation(f *testing.F) {
+	fuzzLimit(f)
+	anim := &animation{frames: []image.Image{fuzzImage, image.NewNRGBA(fuzzImage.Bounds())}, delays: []time.Duration{50 * time.Millisecond, 70 * time.Millisecond}, loopCount: 2}
+	for _, format := range []string{"gif", "webp"} {
+		var buf bytes.Buffer
+		var err error
+		if format == "gif" {
+			err = encodeGIF(&buf, anim)
+		} else {
+			err = encodeWebP(&buf, anim, 80)
+		}
+		if err != nil {
+			f.Fatalf("Failed to encode %s seed: %v", format, err)
+		}
+		f.Add(buf.Bytes(), format == "webp")
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, webp bool) {
+		var anim *animation
+		var err error
+		if webp {
+			anim, err = decodeWebP(data, 0)
+		} else {
+			anim, err = decodeGIF(bytes.NewReader(data), 0)
+		}
+		if err != nil {
+			return
+		}
+		if len(anim.frames) == 0 || len(anim.frames) != len(anim.delays) {
+			t.Fatalf("decoded %d frames and %d delays", len(anim.frames), len(anim.delays))
+		}
+	})
+}
+
+func FuzzReadTIFF(f *testing.F) {
+	fuzzLimit(f)
+	var buf bytes.Buffer
+	if err := encodeTIFF(&buf, []image.Image{fuzzImage, fuzzImage}); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+	f.Add(fuzzSeed(f, ".tiff", encodeTIFFFile(fuzzImage)))
+	dir := f.TempDir()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tf, err := readTIFF(fuzzFile(t, dir, ".tiff", data), nil)
+		if err != nil {
+			return
+		}
+		for i := 0; i < tf.count(); i++ {
+			tf.page(i)
+		}
+	})
+}
+
+func FuzzParseICCProfile(f *testing.F) {
+	for _, name := range []string{"adobergb", "displayp3"} {
+		profile, _ := OpenColorProfile(name)
+		f.Add(iccProfile(profile, 2.2))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		profile, err := parseICCProfile(data)
+		if err != nil {
+			return
+		}
+		convertToSRGB(fuzzImage, profile)
+	})
+}
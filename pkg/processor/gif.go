@@ -0,0 +1,234 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"sort"
+	"time"
+)
+
+// gifDelayUnit is the unit of GIF frame delays
+const gifDelayUnit = 10 * time.Millisecond
+
+// decodeGIF reads all frames of a GIF, applying each frame's disposal so
+// that every frame is a complete picture
+func decodeGIF(r io.Reader, limit int64) (*animation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPixels(cfg.Width, cfg.Height, limit); err != nil {
+		return nil, err
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	anim := &animation{loopCount: g.LoopCount}
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	for i, frame := range g.Image {
+		if err := checkPixels(cfg.Width, cfg.Height*(i+1), limit); err != nil {
+			return nil, err
+		}
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		anim.frames = append(anim.frames, cloneRGBA(canvas))
+		anim.delays = append(anim.delays, time.Duration(g.Delay[i])*gifDelayUnit)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return anim, nil
+}
+
+// encodeGIF writes anim as a GIF with a palette chosen per frame
+func encodeGIF(w io.Writer, anim *animation) error {
+	out := &gif.GIF{LoopCount: anim.loopCount}
+	for i, frame := range anim.frames {
+		out.Image = append(out.Image, quantize(frame))
+		out.Delay = append(out.Delay, int(anim.delays[i]/gifDelayUnit))
+		out.Disposal = append(out.Disposal, gif.DisposalNone)
+	}
+	return gif.EncodeAll(w, out)
+}
+
+// quantize converts img to at most 256 colors, plus a transparent color if
+// img has transparent pixels. Colors are counted at 5 bits per channel and,
+// when there are more than fit, reduced by median cut. It is deterministic
+// and does not dither, so animations do not flicker.
+func quantize(img image.Image) *image.Paletted {
+	bounds := img.Bounds()
+
+	// Count colors in 15-bit buckets
+	buckets := make([]colorBucket, 1<<15)
+	transparent := false
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 0x80 {
+				transparent = true
+				continue
+			}
+			b := &buckets[colorKey(c)]
+			b.count++
+			b.sum[0] += int(c.R)
+			b.sum[1] += int(c.G)
+			b.sum[2] += int(c.B)
+		}
+	}
+	var colors []colorBucket
+	for key, b := range buckets {
+		if b.count > 0 {
+			b.key = key
+			colors = append(colors, b)
+		}
+	}
+
+	size := 256
+	var palette color.Palette
+	if transparent {
+		palette = append(palette, color.NRGBA{})
+		size--
+	}
+	for _, box := range medianCut(colors, size) {
+		var total colorBucket
+		for _, b := range box {
+			total.count += b.count
+			for ch := range total.sum {
+				total.sum[ch] += b.sum[ch]
+			}
+		}
+		palette = append(palette, color.NRGBA{uint8(total.mean(0)), uint8(total.mean(1)), uint8(total.mean(2)), 0xff})
+	}
+	if len(palette) == 0 {
+		palette = append(palette, color.NRGBA{})
+	}
+
+	// Map every pixel, finding the nearest palette color once per bucket
+	lookup := make([]int, 1<<15)
+	for _, b := range colors {
+		lookup[b.key] = nearestOpaque(palette, color.NRGBA{uint8(b.mean(0)), uint8(b.mean(1)), uint8(b.mean(2)), 0xff})
+	}
+	paletted := image.NewPaletted(bounds, palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 0x80 {
+				paletted.SetColorIndex(x, y, 0)
+				continue
+			}
+			paletted.SetColorIndex(x, y, uint8(lookup[colorKey(c)]))
+		}
+	}
+	return paletted
+}
+
+// colorBucket counts the pixels of a 15-bit color bucket
+type colorBucket struct {
+	key   int
+	count int
+	sum   [3]int
+}
+
+// mean returns the average value of a channel in the bucket
+func (b colorBucket) mean(ch int) int {
+	return b.sum[ch] / b.count
+}
+
+// medianCut groups colors into at most n boxes, each becoming a palette
+// color. The box with the widest channel, weighted by its pixels, is split
+// at its median until there are n boxes or none can be split.
+func medianCut(colors []colorBucket, n int) [][]colorBucket {
+	if len(colors) == 0 {
+		return nil
+	}
+	boxes := [][]colorBucket{colors}
+	for len(boxes) < n {
+		best, bestChannel, bestScore := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			count := 0
+			for _, b := range box {
+				count += b.count
+			}
+			for ch := 0; ch < 3; ch++ {
+				lo, hi := 255, 0
+				for _, b := range box {
+					lo, hi = min(lo, b.mean(ch)), max(hi, b.mean(ch))
+				}
+				if score := (hi - lo) * count; score > bestScore {
+					best, bestChannel, bestScore = i, ch, score
+				}
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.SliceStable(box, func(i, j int) bool { return box[i].mean(bestChannel) < box[j].mean(bestChannel) })
+		total := 0
+		for _, b := range box {
+			total += b.count
+		}
+		cut, seen := 1, box[0].count
+		for cut < len(box)-1 && seen*2 < total {
+			seen += box[cut].count
+			cut++
+		}
+		boxes[best] = box[:cut]
+		boxes = append(boxes, box[cut:])
+	}
+	return boxes
+}
+
+// colorKey returns the 15-bit bucket of c
+func colorKey(c color.NRGBA) int {
+	return int(c.R>>3)<<10 | int(c.G>>3)<<5 | int(c.B>>3)
+}
+
+// nearestOpaque returns the index of the opaque palette color closest to c
+func nearestOpaque(palette color.Palette, c color.NRGBA) int {
+	best, bestDist := 0, -1
+	for i, p := range palette {
+		pc := p.(color.NRGBA)
+		if pc.A == 0 {
+			continue
+		}
+		dr, dg, db := int(pc.R)-int(c.R), int(pc.G)-int(c.G), int(pc.B)-int(c.B)
+		if dist := dr*dr + dg*dg + db*db; bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// cloneRGBA returns a copy of img
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	clone := image.NewRGBA(img.Rect)
+	copy(clone.Pix, img.Pix)
+	return clone
+}
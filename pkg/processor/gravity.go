@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// gravities are the named anchors of fill-mode crops
+var gravities = []string{"center", "top", "bottom", "left", "right", "smart"}
+
+// Gravities returns the named anchors of fill-mode crops
+func Gravities() []string {
+	return append([]string(nil), gravities...)
+}
+
+// IsSupportedGravity reports whether gravity is a named anchor
+func IsSupportedGravity(gravity string) bool {
+	for _, g := range gravities {
+		if g == gravity {
+			return true
+		}
+	}
+	return false
+}
+
+// gravityFocus returns the focal point of a named anchor. Smart gravity has
+// no fixed focal point and returns nil.
+func gravityFocus(gravity string) *FocalPoint {
+	switch gravity {
+	case "top":
+		return &FocalPoint{X: 0.5, Y: 0}
+	case "bottom":
+		return &FocalPoint{X: 0.5, Y: 1}
+	case "left":
+		return &FocalPoint{X: 0, Y: 0.5}
+	case "right":
+		return &FocalPoint{X: 1, Y: 0.5}
+	case "smart":
+		return nil
+	}
+	return &FocalPoint{X: 0.5, Y: 0.5}
+}
+
+// smartSampleSize is the longest side images are scaled to when scoring
+// smart crops
+const smartSampleSize = 64
+
+// smartFocalPoint finds the focal point of img for smart gravity, as
+// fractions of img, looking only within config.Crop if it is set
+func smartFocalPoint(img image.Image, config Config) *FocalPoint {
+	bounds := img.Bounds()
+	region := bounds
+	if !config.Crop.Empty() {
+		region = config.Crop.Add(bounds.Min).Intersect(bounds)
+	}
+	p := smartFocus(img, region, config.MaxWidth, config.MaxHeight)
+	return &FocalPoint{
+		X: float64(p.X-bounds.Min.X) / float64(bounds.Dx()),
+		Y: float64(p.Y-bounds.Min.Y) / float64(bounds.Dy()),
+	}
+}
+
+// smartFocus returns the center of the width x height crop of region that
+// holds the most detail, saturated color and skin tones, so that subjects
+// and faces are kept. Ties go to the top or left crop.
+func smartFocus(img image.Image, region image.Rectangle, width, height int) image.Point {
+	center := image.Pt((region.Min.X+region.Max.X)/2, (region.Min.Y+region.Max.Y)/2)
+	w, h := region.Dx(), region.Dy()
+	if w < 2 || h < 2 {
+		return center
+	}
+
+	// Score a small copy of the region
+	scale := float64(smartSampleSize) / math.Max(float64(w), float64(h))
+	if scale > 1 {
+		scale = 1
+	}
+	sw, sh := max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale)))
+	sample := imaging.Resize(imaging.Crop(img, region), sw, sh, imaging.Box)
+	score := scoreSample(sample)
+
+	// Size of the crop in sample pixels
+	aspect := float64(width) / float64(height)
+	cropW, cropH := sw, sh
+	if float64(w)/float64(h) > aspect {
+		cropW = max(1, int(math.Round(float64(sh)*aspect)))
+	} else {
+		cropH = max(1, int(math.Round(float64(sw)/aspect)))
+	}
+
+	// Slide the crop along the free axis
+	best, bestX, bestY := -1.0, 0, 0
+	for y := 0; y <= sh-cropH; y++ {
+		for x := 0; x <= sw-cropW; x++ {
+			var total float64
+			for cy := y; cy < y+cropH; cy++ {
+				for cx := x; cx < x+cropW; cx++ {
+					total += score[cy*sw+cx]
+				}
+			}
+			if total > best {
+				best, bestX, bestY = total, x, y
+			}
+		}
+	}
+	if best <= 0 {
+		return center
+	}
+
+	return image.Pt(
+		region.Min.X+int((float64(bestX)+float64(cropW)/2)/scale),
+		region.Min.Y+int((float64(bestY)+float64(cropH)/2)/scale),
+	)
+}
+
+// scoreSample rates every pixel of img by its edge strength, saturation
+// and likeness to skin
+func scoreSample(img *image.NRGBA) []float64 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	luma := make([]float64, w*h)
+	score := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.NRGBAAt(x, y)
+			yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+			luma[y*w+x] = float64(yy)
+
+			hi := math.Max(float64(c.R), math.Max(float64(c.G), float64(c.B)))
+			lo := math.Min(float64(c.R), math.Min(float64(c.G), float64(c.B)))
+			s := (hi - lo) / 255 * 0.5
+			if cb >= 77 && cb <= 127 && cr >= 133 && cr <= 173 {
+				s += 1
+			}
+			score[y*w+x] = s * float64(c.A) / 255
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var edge float64
+			if x > 0 {
+				edge += math.Abs(luma[y*w+x] - luma[y*w+x-1])
+			}
+			if y > 0 {
+				edge += math.Abs(luma[y*w+x] - luma[(y-1)*w+x])
+			}
+			score[y*w+x] += edge / 255
+		}
+	}
+	return score
+}
@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestGravityFocus(t *testing.T) {
+	tests := []struct {
+		gravity  string
+		expected *FocalPoint
+	}{
+		{"", &FocalPoint{X: 0.5, Y: 0.5}},
+		{"center", &FocalPoint{X: 0.5, Y: 0.5}},
+		{"top", &FocalPoint{X: 0.5, Y: 0}},
+		{"bottom", &FocalPoint{X: 0.5, Y: 1}},
+		{"left", &FocalPoint{X: 0, Y: 0.5}},
+		{"right", &FocalPoint{X: 1, Y: 0.5}},
+		{"smart", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.gravity, func(t *testing.T) {
+			result := gravityFocus(test.gravity)
+			if (result == nil) != (test.expected == nil) || result != nil && *result != *test.expected {
+				t.Errorf("gravityFocus(%q) = %v, expected %v", test.gravity, result, test.expected)
+			}
+		})
+	}
+
+	if IsSupportedGravity("north") {
+		t.Error("IsSupportedGravity(north) = true, expected false")
+	}
+}
+
+func TestSmartFocus(t *testing.T) {
+	// A flat gray image with a checkered patch near one corner
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			img.Set(x, y, color.RGBA{128, 128, 128, 255})
+			if x >= 300 && x < 360 && y >= 20 && y < 80 && (x/4+y/4)%2 == 0 {
+				img.Set(x, y, color.RGBA{255, 255, 255, 255})
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		region image.Rectangle
+		width  int
+		height int
+		check  func(image.Point) bool
+	}{
+		{"Square crop moves to the patch", img.Bounds(), 100, 100, func(p image.Point) bool { return p.X >= 230 }},
+		{"Matching aspect ratio keeps the center", img.Bounds(), 200, 100, func(p image.Point) bool { return p == image.Pt(200, 100) }},
+		{"Flat region keeps the center", image.Rect(0, 100, 200, 200), 100, 100, func(p image.Point) bool { return p == image.Pt(100, 150) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if p := smartFocus(img, test.region, test.width, test.height); !test.check(p) {
+				t.Errorf("smartFocus() = %v", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package processor
+
+/*
+#cgo pkg-config: libheif
+#include <stdlib.h>
+#include <libheif/heif.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"unsafe"
+
+	"github.com/disintegration/imaging"
+)
+
+// heifError converts a libheif error into a Go error
+func heifError(err C.struct_heif_error) error {
+	if err.code == C.heif_error_Ok {
+		return nil
+	}
+	return fmt.Errorf("libheif: %s", C.GoString(err.message))
+}
+
+// encodeHeif writes img to path as a HEIF file using compression. A speed
+// of 0 keeps the encoder default.
+func encodeHeif(img image.Image, path string, compression C.enum_heif_compression_format, quality, speed int) error {
+	ctx := C.heif_context_alloc()
+	if ctx == nil {
+		return fmt.Errorf("libheif: failed to allocate context")
+	}
+	defer C.heif_context_free(ctx)
+
+	// Configure the encoder
+	var encoder *C.struct_heif_encoder
+	if err := heifError(C.heif_context_get_encoder_for_format(ctx, compression, &encoder)); err != nil {
+		return err
+	}
+	defer C.heif_encoder_release(encoder)
+
+	if err := heifError(C.heif_encoder_set_lossy_quality(encoder, C.int(quality))); err != nil {
+		return err
+	}
+	if speed > 0 {
+		name := C.CString("speed")
+		defer C.free(unsafe.Pointer(name))
+		if err := heifError(C.heif_encoder_set_parameter_integer(encoder, name, C.int(speed))); err != nil {
+			return err
+		}
+	}
+
+	// Copy the pixels into an interleaved RGBA image
+	src := imaging.Clone(img)
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+
+	var himg *C.struct_heif_image
+	if err := heifError(C.heif_image_create(C.int(width), C.int(height), C.heif_colorspace_RGB, C.heif_chroma_interleaved_RGBA, &himg)); err != nil {
+		return err
+	}
+	defer C.heif_image_release(himg)
+
+	if err := heifError(C.heif_image_add_plane(himg, C.heif_channel_interleaved, C.int(width), C.int(height), 8)); err != nil {
+		return err
+	}
+	var stride C.int
+	plane := C.heif_image_get_plane(himg, C.heif_channel_interleaved, &stride)
+	if plane == nil {
+		return fmt.Errorf("libheif: failed to get image plane")
+	}
+	dst := unsafe.Slice((*byte)(unsafe.Pointer(plane)), int(stride)*height)
+	for y := 0; y < height; y++ {
+		copy(dst[y*int(stride):y*int(stride)+width*4], src.Pix[y*src.Stride:y*src.Stride+width*4])
+	}
+
+	// Encode and write the file
+	var handle *C.struct_heif_image_handle
+	if err := heifError(C.heif_context_encode_image(ctx, himg, encoder, nil, &handle)); err != nil {
+		return err
+	}
+	C.heif_image_handle_release(handle)
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	return heifError(C.heif_context_write_to_file(ctx, cpath))
+}
+
+// encodeAVIF writes img to path as an AVIF file
+func encodeAVIF(img image.Image, path string, quality, speed int) error {
+	return encodeHeif(img, path, C.heif_compression_AV1, quality, speed)
+}
+
+// encodeHEIC writes img to path as a HEIC file
+func encodeHEIC(img image.Image, path string, quality int) error {
+	return encodeHeif(img, path, C.heif_compression_HEVC, quality, 0)
+}
+
+// HasHeifEncoder reports whether the linked libheif can encode format,
+// "heic" with an HEVC encoder or "avif" with an AV1 encoder. libheif may be
+// built without either.
+func HasHeifEncoder(format string) bool {
+	switch format {
+	case "heic":
+		return C.heif_have_encoder_for_format(C.heif_compression_HEVC) != 0
+	case "avif":
+		return C.heif_have_encoder_for_format(C.heif_compression_AV1) != 0
+	}
+	return false
+}
+
+// heifEXIF returns the TIFF structure of the EXIF block of the primary
+// image of the HEIF file at path, or nil if it has none
+func heifEXIF(path string) ([]byte, error) {
+	ctx := C.heif_context_alloc()
+	if ctx == nil {
+		return nil, fmt.Errorf("libheif: failed to allocate context")
+	}
+	defer C.heif_context_free(ctx)
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	if err := heifError(C.heif_context_read_from_file(ctx, cpath, nil)); err != nil {
+		return nil, err
+	}
+	var handle *C.struct_heif_image_handle
+	if err := heifError(C.heif_context_get_primary_image_handle(ctx, &handle)); err != nil {
+		return nil, err
+	}
+	defer C.heif_image_handle_release(handle)
+
+	filter := C.CString("Exif")
+	defer C.free(unsafe.Pointer(filter))
+	var id C.heif_item_id
+	if C.heif_image_handle_get_list_of_metadata_block_IDs(handle, filter, &id, 1) == 0 {
+		return nil, nil
+	}
+	size := int(C.heif_image_handle_get_metadata_size(handle, id))
+	if size < 4 {
+		return nil, nil
+	}
+	data := make([]byte, size)
+	if err := heifError(C.heif_image_handle_get_metadata(handle, id, unsafe.Pointer(&data[0]))); err != nil {
+		return nil, err
+	}
+
+	// The block starts with the offset of the TIFF header after it
+	offset := 4 + int(binary.BigEndian.Uint32(data))
+	if offset < 4 || offset >= len(data) {
+		return nil, nil
+	}
+	return data[offset:], nil
+}
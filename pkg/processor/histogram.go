@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+)
+
+// Luma levels at or beyond which pixels count as clipped
+const (
+	shadowClipLevel    = 2
+	highlightClipLevel = 253
+)
+
+// Histogram is the luma histogram of an output, over all of its frames
+// or pages
+type Histogram struct {
+	Luma   [256]int
+	Pixels int
+}
+
+// add counts the pixels of img
+func (h *Histogram) add(img image.Image) {
+	if h == nil {
+		return
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			// Rec. 601 luma, as used by JPEG
+			h.Luma[(299*int(c.R)+587*int(c.G)+114*int(c.B)+500)/1000]++
+		}
+	}
+	h.Pixels += bounds.Dx() * bounds.Dy()
+}
+
+// Mean returns the average luma, from 0 to 255
+func (h *Histogram) Mean() float64 {
+	if h.Pixels == 0 {
+		return 0
+	}
+	var sum int
+	for i, n := range h.Luma {
+		sum += i * n
+	}
+	return float64(sum) / float64(h.Pixels)
+}
+
+// Shadows returns the fraction of pixels clipped to black
+func (h *Histogram) Shadows() float64 {
+	return h.fraction(0, shadowClipLevel)
+}
+
+// Highlights returns the fraction of pixels clipped to white
+func (h *Histogram) Highlights() float64 {
+	return h.fraction(highlightClipLevel, 255)
+}
+
+// fraction returns the fraction of pixels with luma from lo to hi
+func (h *Histogram) fraction(lo, hi int) float64 {
+	if h.Pixels == 0 {
+		return 0
+	}
+	var n int
+	for i := lo; i <= hi; i++ {
+		n += h.Luma[i]
+	}
+	return float64(n) / float64(h.Pixels)
+}
@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	// A quarter black, a quarter white and half mid gray
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.NRGBA{128, 128, 128, 255}
+			if y == 0 {
+				c = color.NRGBA{0, 0, 0, 255}
+			} else if y == 3 {
+				c = color.NRGBA{255, 255, 255, 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	h := &Histogram{}
+	h.add(img)
+	if h.Pixels != 16 {
+		t.Fatalf("Pixels = %d, expected 16", h.Pixels)
+	}
+	if h.Shadows() != 0.25 || h.Highlights() != 0.25 {
+		t.Errorf("Shadows() = %g, Highlights() = %g, expected 0.25", h.Shadows(), h.Highlights())
+	}
+	if mean := h.Mean(); math.Abs(mean-(255+2*128)/4.0) > 0.01 {
+		t.Errorf("Mean() = %g, expected %g", mean, (255+2*128)/4.0)
+	}
+
+	// A nil histogram ignores images
+	var none *Histogram
+	none.add(img)
+}
+
+func TestProcessHistogram(t *testing.T) {
+	tempDir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	inputPath := filepath.Join(tempDir, "white.png")
+	if err := saveImage(img, inputPath, "png", 90, 0, 0); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	result, err := Process(inputPath, Config{OutputFormat: "jpg", MaxWidth: 50, MaxHeight: 50, Quality: 90, OutputDir: outputDir, Histogram: true})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if result.Histogram == nil || result.Histogram.Pixels != 2500 || result.Histogram.Highlights() != 1 {
+		t.Errorf("Histogram = %+v, expected 2500 white pixels", result.Histogram)
+	}
+
+	result, err = Process(inputPath, Config{OutputFormat: "jpg", MaxWidth: 50, MaxHeight: 50, Quality: 90, OutputDir: outputDir})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if result.Histogram != nil {
+		t.Error("Histogram computed without Config.Histogram")
+	}
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// icoPNGSize is the smallest entry size stored as PNG. Smaller entries are
+// 32-bit bitmaps, which every ICO reader supports.
+const icoPNGSize = 256
+
+// encodeICO writes imgs as an ICO file with one entry per image, each at
+// most 256 pixels on a side
+func encodeICO(w io.Writer, imgs []image.Image) error {
+	entries := make([][]byte, len(imgs))
+	for i, img := range imgs {
+		size := img.Bounds().Size()
+		if size.X > icoPNGSize || size.Y > icoPNGSize {
+			return fmt.Errorf("ICO entry %dx%d is larger than %dx%d", size.X, size.Y, icoPNGSize, icoPNGSize)
+		}
+		if size.X < icoPNGSize && size.Y < icoPNGSize {
+			entries[i] = icoBitmap(img)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		entries[i] = buf.Bytes()
+	}
+
+	// ICONDIR, then one ICONDIRENTRY per image, then the image data
+	header := make([]byte, 6+16*len(imgs))
+	binary.LittleEndian.PutUint16(header[2:], 1)
+	binary.LittleEndian.PutUint16(header[4:], uint16(len(imgs)))
+	offset := len(header)
+	for i, img := range imgs {
+		size := img.Bounds().Size()
+		entry := header[6+16*i:]
+		// A size of 256 is stored as 0
+		entry[0], entry[1] = uint8(size.X), uint8(size.Y)
+		binary.LittleEndian.PutUint16(entry[4:], 1)
+		binary.LittleEndian.PutUint16(entry[6:], 32)
+		binary.LittleEndian.PutUint32(entry[8:], uint32(len(entries[i])))
+		binary.LittleEndian.PutUint32(entry[12:], uint32(offset))
+		offset += len(entries[i])
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := w.Write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// icoBitmap returns img as an ICO bitmap: a BITMAPINFOHEADER of double
+// height, bottom-up BGRA rows and a 1-bit mask that is set where img is
+// fully transparent, for readers that ignore alpha
+func icoBitmap(img image.Image) []byte {
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	width, height := nrgba.Rect.Dx(), nrgba.Rect.Dy()
+	maskStride := (width + 31) / 32 * 4
+
+	data := make([]byte, 40+width*height*4+maskStride*height)
+	binary.LittleEndian.PutUint32(data[0:], 40)
+	binary.LittleEndian.PutUint32(data[4:], uint32(width))
+	binary.LittleEndian.PutUint32(data[8:], uint32(2*height))
+	binary.LittleEndian.PutUint16(data[12:], 1)
+	binary.LittleEndian.PutUint16(data[14:], 32)
+	binary.LittleEndian.PutUint32(data[20:], uint32(len(data)-40))
+
+	pixels := data[40:]
+	mask := pixels[width*height*4:]
+	for y := 0; y < height; y++ {
+		row := height - 1 - y
+		for x := 0; x < width; x++ {
+			src := nrgba.Pix[y*nrgba.Stride+x*4:]
+			dst := pixels[(row*width+x)*4:]
+			dst[0], dst[1], dst[2], dst[3] = src[2], src[1], src[0], src[3]
+			if src[3] == 0 {
+				mask[row*maskStride+x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	return data
+}
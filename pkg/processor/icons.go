@@ -0,0 +1,223 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// appIcon is a file of an icon set
+type appIcon struct {
+	// name is the path of the file within its set
+	name string
+	// size is the width and height in pixels
+	size int
+	// idiom, points and scale describe iOS icons in Contents.json
+	idiom  string
+	points float64
+	scale  int
+}
+
+// iconSet is the icons a platform needs
+type iconSet struct {
+	// dir is the directory of the set in the output directory
+	dir   string
+	icons []appIcon
+	// opaque sets are flattened onto the background, as the App Store
+	// rejects icons with transparency
+	opaque bool
+}
+
+// iosIcon returns the icon of idiom at points and scale, named like Xcode
+// names them
+func iosIcon(idiom string, points float64, scale int) appIcon {
+	pt := strconv.FormatFloat(points, 'f', -1, 64)
+	return appIcon{
+		name:   fmt.Sprintf("Icon-App-%sx%s@%dx.png", pt, pt, scale),
+		size:   int(points * float64(scale)),
+		idiom:  idiom,
+		points: points,
+		scale:  scale,
+	}
+}
+
+var iconSets = map[string]iconSet{
+	"ios": {
+		dir:    "AppIcon.appiconset",
+		opaque: true,
+		icons: []appIcon{
+			iosIcon("iphone", 20, 2), iosIcon("iphone", 20, 3),
+			iosIcon("iphone", 29, 2), iosIcon("iphone", 29, 3),
+			iosIcon("iphone", 40, 2), iosIcon("iphone", 40, 3),
+			iosIcon("iphone", 60, 2), iosIcon("iphone", 60, 3),
+			iosIcon("ipad", 20, 1), iosIcon("ipad", 20, 2),
+			iosIcon("ipad", 29, 1), iosIcon("ipad", 29, 2),
+			iosIcon("ipad", 40, 1), iosIcon("ipad", 40, 2),
+			iosIcon("ipad", 76, 1), iosIcon("ipad", 76, 2),
+			iosIcon("ipad", 83.5, 2),
+			iosIcon("ios-marketing", 1024, 1),
+		},
+	},
+	"android": {
+		dir: "android",
+		icons: []appIcon{
+			{name: "mipmap-mdpi/ic_launcher.png", size: 48},
+			{name: "mipmap-hdpi/ic_launcher.png", size: 72},
+			{name: "mipmap-xhdpi/ic_launcher.png", size: 96},
+			{name: "mipmap-xxhdpi/ic_launcher.png", size: 144},
+			{name: "mipmap-xxxhdpi/ic_launcher.png", size: 192},
+			{name: "playstore-icon.png", size: 512},
+		},
+	},
+	"pwa": {
+		dir: "pwa",
+		icons: []appIcon{
+			{name: "icon-192x192.png", size: 192},
+			{name: "icon-512x512.png", size: 512},
+		},
+	},
+}
+
+// IconPlatforms returns the platforms Icons can write icon sets for
+func IconPlatforms() []string {
+	platforms := make([]string, 0, len(iconSets))
+	for platform := range iconSets {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+// IconOptions selects the icon sets Icons writes
+type IconOptions struct {
+	// Platforms are the sets to write, see IconPlatforms
+	Platforms []string
+	// ContentsJSON adds the Contents.json Xcode reads to the iOS set
+	ContentsJSON bool
+	// Background fills the transparent parts of icons that must be opaque.
+	// Nil is white.
+	Background color.Color
+}
+
+// Icons renders the image at inputPath as the app icon sets of
+// options.Platforms, each in its own directory in config.OutputDir, and
+// returns the written paths. The image is made square like by Favicon.
+func Icons(inputPath string, options IconOptions, config Config) ([]string, error) {
+	var outputs []string
+	for _, platform := range options.Platforms {
+		set, ok := iconSets[platform]
+		if !ok {
+			return nil, fmt.Errorf("unknown icon platform %q", platform)
+		}
+		for _, icon := range set.icons {
+			outputs = append(outputs, filepath.Join(config.OutputDir, set.dir, icon.name))
+		}
+	}
+	if err := checkOverwrite(inputPath, outputs); err != nil {
+		return nil, err
+	}
+
+	square, err := loadSquare(inputPath, config)
+	if err != nil {
+		return nil, err
+	}
+	background := options.Background
+	if background == nil {
+		background = color.White
+	}
+
+	var written []string
+	for _, platform := range options.Platforms {
+		set := iconSets[platform]
+		src := square
+		if set.opaque {
+			src = flatten(square, background)
+		}
+
+		dir := filepath.Join(config.OutputDir, set.dir)
+		done := map[string]bool{}
+		for _, icon := range set.icons {
+			// iPhone and iPad share some files
+			if done[icon.name] {
+				continue
+			}
+			done[icon.name] = true
+			path := filepath.Join(dir, icon.name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return nil, err
+			}
+			img := imaging.Resize(src, icon.size, icon.size, imaging.Lanczos)
+			if err := saveImage(img, path, "png", config.Quality, 0, 0); err != nil {
+				return nil, err
+			}
+			written = append(written, path)
+		}
+
+		if platform == "ios" && options.ContentsJSON {
+			path := filepath.Join(dir, "Contents.json")
+			if err := writeContentsJSON(path, set.icons); err != nil {
+				return nil, err
+			}
+			written = append(written, path)
+		}
+	}
+
+	for _, output := range written {
+		if err := finishOutput(output, config); err != nil {
+			return nil, err
+		}
+	}
+	return written, nil
+}
+
+// flatten composites img onto an opaque background
+func flatten(img image.Image, background color.Color) image.Image {
+	bounds := img.Bounds()
+	flat := image.NewNRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, img, bounds.Min, draw.Over)
+	return flat
+}
+
+// writeContentsJSON writes the Contents.json that describes an Xcode
+// asset catalog app icon set
+func writeContentsJSON(path string, icons []appIcon) error {
+	type image struct {
+		Size     string `json:"size"`
+		Idiom    string `json:"idiom"`
+		Filename string `json:"filename"`
+		Scale    string `json:"scale"`
+	}
+	var contents struct {
+		Images []image `json:"images"`
+		Info   struct {
+			Version int    `json:"version"`
+			Author  string `json:"author"`
+		} `json:"info"`
+	}
+	for _, icon := range icons {
+		pt := strconv.FormatFloat(icon.points, 'f', -1, 64)
+		contents.Images = append(contents.Images, image{
+			Size:     pt + "x" + pt,
+			Idiom:    icon.idiom,
+			Filename: icon.name,
+			Scale:    fmt.Sprintf("%dx", icon.scale),
+		})
+	}
+	contents.Info.Version = 1
+	contents.Info.Author = "xcode"
+
+	data, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
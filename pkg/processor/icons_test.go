@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIcons(t *testing.T) {
+	// A transparent image with an opaque red square in the middle
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	for y := 25; y < 75; y++ {
+		for x := 25; x < 75; x++ {
+			src.Set(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+	inputPath := filepath.Join(t.TempDir(), "logo.png")
+	if err := encodePNG(src)(inputPath); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	options := IconOptions{
+		Platforms:    IconPlatforms(),
+		ContentsJSON: true,
+		Background:   color.NRGBA{0, 0, 255, 255},
+	}
+	outputs, err := Icons(inputPath, options, Config{OutputDir: dir})
+	if err != nil {
+		t.Fatalf("Icons() error = %v", err)
+	}
+	// 18 iOS entries share 15 files; Contents.json adds one
+	if expected := 15 + 1 + 6 + 2; len(outputs) != expected {
+		t.Errorf("Icons() wrote %d files, expected %d", len(outputs), expected)
+	}
+
+	tests := []struct {
+		name string
+		size int
+		// corner is the expected color of the top-left corner
+		corner color.NRGBA
+	}{
+		{"AppIcon.appiconset/Icon-App-20x20@2x.png", 40, color.NRGBA{0, 0, 255, 255}},
+		{"AppIcon.appiconset/Icon-App-83.5x83.5@2x.png", 167, color.NRGBA{0, 0, 255, 255}},
+		{"AppIcon.appiconset/Icon-App-1024x1024@1x.png", 1024, color.NRGBA{0, 0, 255, 255}},
+		{"android/mipmap-mdpi/ic_launcher.png", 48, color.NRGBA{}},
+		{"android/mipmap-xxxhdpi/ic_launcher.png", 192, color.NRGBA{}},
+		{"android/playstore-icon.png", 512, color.NRGBA{}},
+		{"pwa/icon-192x192.png", 192, color.NRGBA{}},
+		{"pwa/icon-512x512.png", 512, color.NRGBA{}},
+	}
+	for _, test := range tests {
+		img, err := loadImage(filepath.Join(dir, test.name))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := img.Bounds().Size(); got != image.Pt(test.size, test.size) {
+			t.Errorf("%s: got %dx%d, expected %dx%d", test.name, got.X, got.Y, test.size, test.size)
+		}
+		corner := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA)
+		if corner.A != test.corner.A || (corner.A != 0 && corner != test.corner) {
+			t.Errorf("%s: corner = %v, expected %v", test.name, corner, test.corner)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "AppIcon.appiconset", "Contents.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents struct {
+		Images []struct {
+			Size, Idiom, Filename, Scale string
+		}
+		Info struct {
+			Version int
+			Author  string
+		}
+	}
+	if err := json.Unmarshal(data, &contents); err != nil {
+		t.Fatalf("Contents.json: %v", err)
+	}
+	if len(contents.Images) != len(iconSets["ios"].icons) || contents.Info.Author != "xcode" {
+		t.Errorf("Contents.json has %d images by %q", len(contents.Images), contents.Info.Author)
+	}
+	for _, entry := range contents.Images {
+		if _, err := os.Stat(filepath.Join(dir, "AppIcon.appiconset", entry.Filename)); err != nil {
+			t.Errorf("Contents.json refers to missing %s", entry.Filename)
+		}
+	}
+	first := contents.Images[0]
+	if first.Size != "20x20" || first.Idiom != "iphone" || first.Scale != "2x" {
+		t.Errorf("first image = %+v, expected 20x20 iphone 2x", first)
+	}
+
+	if _, err := Icons(inputPath, IconOptions{Platforms: []string{"windows"}}, Config{OutputDir: dir}); err == nil {
+		t.Error("Icons() accepted an unknown platform")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build jxl
+
+package processor
+
+import (
+	"image"
+	"io"
+
+	// Registers the JPEG XL decoder with the image package, which
+	// loadImage falls back to
+	"github.com/gen2brain/jpegxl"
+)
+
+func init() {
+	inputExtensions = append(inputExtensions, ".jxl")
+	outputFormats = append(outputFormats, "jxl")
+}
+
+// encodeJXL writes img to w as JPEG XL. Quality 100 is lossless, and an
+// effort of 0 keeps the encoder default.
+func encodeJXL(w io.Writer, img image.Image, quality, effort int) error {
+	return jpegxl.Encode(w, img, jpegxl.Options{Quality: quality, Effort: effort})
+}
@@ -0,0 +1,15 @@
+//go:build !jxl
+
+package processor
+
+import (
+	"errors"
+	"image"
+	"io"
+)
+
+// encodeJXL is unavailable without the jxl build tag, which keeps the
+// JPEG XL codec out of default builds
+func encodeJXL(w io.Writer, img image.Image, quality, effort int) error {
+	return errors.New("JPEG XL support requires building with -tags jxl")
+}
@@ -0,0 +1,15 @@
+//go:build jxl
+
+package processor
+
+import "picture-resize-tools/pkg/golden"
+
+func init() {
+	matrixInputs = append(matrixInputs,
+		matrixInput{name: "jxl", ext: ".jxl", content: "rgba", encode: encodeWith(matrixRGBA, "jxl"), loss: lossy},
+	)
+	matrixOutputs = append(matrixOutputs,
+		// VarDCT rings at the hard edges of the pattern
+		matrixOutput{format: "jxl", alpha: true, loss: golden.Tolerance{Mean: 2.5, Max: 24}},
+	)
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// resample scales img to size with filter, in linear light when linear
+func resample(img image.Image, size image.Point, filter imaging.ResampleFilter, linear bool) *image.NRGBA {
+	if linear {
+		return linearResize(img, size.X, size.Y, filter)
+	}
+	return imaging.Resize(img, size.X, size.Y, filter)
+}
+
+// linearWeight is the share of a source pixel in a resampled one
+type linearWeight struct {
+	index  int
+	weight float32
+}
+
+// resampleWeights returns the source pixels and their weights for each of
+// dst pixels resampled from src with filter, widened when shrinking so
+// that every source pixel counts
+func resampleWeights(dst, src int, filter imaging.ResampleFilter) [][]linearWeight {
+	scale := float64(src) / float64(dst)
+	widen := math.Max(scale, 1)
+	support := filter.Support * widen
+
+	weights := make([][]linearWeight, dst)
+	for i := range weights {
+		center := (float64(i)+0.5)*scale - 0.5
+		from, to := int(math.Ceil(center-support)), int(math.Floor(center+support))
+		var sum float64
+		for j := max(from, 0); j <= min(to, src-1); j++ {
+			w := filter.Kernel((float64(j) - center) / widen)
+			if w != 0 {
+				weights[i] = append(weights[i], linearWeight{j, float32(w)})
+				sum += w
+			}
+		}
+		if sum == 0 {
+			// Kernels narrower than a pixel, like Box at small scales
+			nearest := min(max(int(math.Round(center)), 0), src-1)
+			weights[i] = []linearWeight{{nearest, 1}}
+			continue
+		}
+		for j := range weights[i] {
+			weights[i][j].weight /= float32(sum)
+		}
+	}
+	return weights
+}
+
+// linearResize scales img to width x height with filter like
+// imaging.Resize, but averages linear light instead of sRGB values, so
+// fine patterns keep their brightness instead of darkening and beating.
+// Colors are weighted by their alpha to keep transparent ones from
+// bleeding.
+func linearResize(img image.Image, width, height int, filter imaging.ResampleFilter) *image.NRGBA {
+	src := imaging.Clone(img)
+	srcW, srcH := src.Rect.Dx(), src.Rect.Dy()
+
+	var decode [256]float32
+	for i := range decode {
+		decode[i] = float32(srgbDecode(float64(i) / 255))
+	}
+	const encodeSize = 4096
+	var encode [encodeSize + 1]uint8
+	for i := range encode {
+		encode[i] = uint8(math.Round(srgbEncode(float64(i)/encodeSize) * 255))
+	}
+
+	// Rows first, into premultiplied linear RGBA
+	columns := resampleWeights(width, srcW, filter)
+	rows := make([]float32, srcH*width*4)
+	for y := 0; y < srcH; y++ {
+		line := src.Pix[y*src.Stride:]
+		out := rows[y*width*4:]
+		for x, weights := range columns {
+			var r, g, b, a float32
+			for _, w := range weights {
+				px := line[w.index*4:]
+				alpha := float32(px[3]) / 255 * w.weight
+				r += decode[px[0]] * alpha
+				g += decode[px[1]] * alpha
+				b += decode[px[2]] * alpha
+				a += alpha
+			}
+			out[x*4], out[x*4+1], out[x*4+2], out[x*4+3] = r, g, b, a
+		}
+	}
+
+	// Then columns, back to sRGB with straight alpha
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	encodeValue := func(v, a float32) uint8 {
+		v /= a
+		return encode[int(math.Round(float64(min(max(v, 0), 1))*encodeSize))]
+	}
+	for y, weights := range resampleWeights(height, srcH, filter) {
+		out := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			var r, g, b, a float32
+			for _, w := range weights {
+				px := rows[(w.index*width+x)*4:]
+				r += px[0] * w.weight
+				g += px[1] * w.weight
+				b += px[2] * w.weight
+				a += px[3] * w.weight
+			}
+			if a <= 0 {
+				continue
+			}
+			out[x*4] = encodeValue(r, a)
+			out[x*4+1] = encodeValue(g, a)
+			out[x*4+2] = encodeValue(b, a)
+			out[x*4+3] = uint8(math.Round(float64(min(a, 1)) * 255))
+		}
+	}
+	return dst
+}
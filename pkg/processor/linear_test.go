@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestLinearResize(t *testing.T) {
+	// One-pixel black and white stripes average to half the light, which
+	// is 188 in sRGB, not 128
+	stripes := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			if x%2 == 0 {
+				stripes.Set(x, y, color.White)
+			} else {
+				stripes.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter imaging.ResampleFilter
+		linear bool
+		lo, hi uint8
+	}{
+		{"Linear Lanczos", imaging.Lanczos, true, 184, 192},
+		{"Linear box", imaging.Box, true, 186, 190},
+		{"sRGB box", imaging.Box, false, 125, 130},
+	}
+	for _, test := range tests {
+		resized := resample(stripes, image.Pt(16, 16), test.filter, test.linear)
+		if size := resized.Rect.Size(); size != image.Pt(16, 16) {
+			t.Fatalf("%s size = %v, expected 16x16", test.name, size)
+		}
+		if v := resized.NRGBAAt(8, 8).R; v < test.lo || v > test.hi {
+			t.Errorf("%s stripes = %d, expected %d to %d", test.name, v, test.lo, test.hi)
+		}
+	}
+
+	// Transparent pixels add no color
+	edge := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	edge.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	edge.Set(1, 0, color.NRGBA{B: 255})
+	c := linearResize(edge, 1, 1, imaging.Box).NRGBAAt(0, 0)
+	if c.R != 255 || c.B != 0 || c.A < 126 || c.A > 129 {
+		t.Errorf("linearResize() of half transparent = %v, expected red at half alpha", c)
+	}
+}
@@ -0,0 +1,324 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+
+	"picture-resize-tools/pkg/golden"
+)
+
+// Every output is decoded and compared with the golden image of its input's
+// content, so a conversion is checked against what it should look like
+// rather than against the bytes some encoder version happened to write.
+// Adding a codec means adding its input cases or output tolerance here;
+// formats without either fail TestConversionMatrixCoverage.
+
+// matrixSize is the size of the generated inputs, processed to half of it
+var matrixSize = image.Pt(256, 192)
+
+// matrixInput is an input file of the conversion matrix
+type matrixInput struct {
+	name string
+	// ext is the file extension the input is written with
+	ext string
+	// content names the golden image the input should process into
+	content string
+	// encode writes the reference pattern in the input's format
+	encode func(path string) error
+	// assume is passed as Config.AssumeProfile
+	assume string
+	// loss is the difference the input's own encoding introduces
+	loss golden.Tolerance
+}
+
+// matrixOutput is an output format of the conversion matrix
+type matrixOutput struct {
+	format string
+	// alpha reports whether the format keeps translucency
+	alpha bool
+	loss  golden.Tolerance
+}
+
+var (
+	lossless = golden.Tolerance{Mean: 0.5, Max: 2}
+	lossy    = golden.Tolerance{Mean: 1, Max: 4}
+)
+
+var matrixInputs = []matrixInput{
+	{name: "png-rgb8", ext: ".png", content: "rgb", encode: encodePNG(matrixRGB), loss: lossless},
+	{name: "png-rgb16", ext: ".png", content: "rgb", encode: encodePNG(toNRGBA64(matrixRGB)), loss: lossless},
+	{name: "png-rgba8", ext: ".png", content: "rgba", encode: encodePNG(matrixRGBA), loss: lossless},
+	{name: "png-gray8", ext: ".png", content: "gray", encode: encodePNG(toGray(matrixRGB)), loss: lossless},
+	{name: "png-gray16", ext: ".png", content: "gray", encode: encodePNG(toGray16(matrixRGB)), loss: lossless},
+	{name: "png-untagged-adobergb", ext: ".png", content: "adobergb", encode: encodePNG(matrixRGB), assume: "adobergb", loss: lossless},
+	{name: "png-tagged-srgb", ext: ".png", content: "rgb", encode: encodeTaggedPNG(matrixRGB), assume: "adobergb", loss: lossless},
+	{name: "jpg", ext: ".jpg", content: "rgb", encode: encodeJPEG(matrixRGB), loss: lossy},
+	{name: "jpg-gray", ext: ".jpeg", content: "gray", encode: encodeJPEG(toGray(matrixRGB)), loss: lossy},
+	{name: "gif-gray", ext: ".gif", content: "gray", encode: encodeGrayGIF(matrixRGB), loss: lossless},
+	{name: "bmp", ext: ".bmp", content: "rgb", encode: encodeBMP(matrixRGB), loss: lossless},
+	{name: "tiff-rgb8", ext: ".tif", content: "rgb", encode: encodeTIFFFile(matrixRGB), loss: lossless},
+	{name: "tiff-rgba16", ext: ".tiff", content: "rgba", encode: encodeTIFFFile(toNRGBA64(matrixRGBA)), loss: lossless},
+	{name: "webp-lossless", ext: ".webp", content: "rgba", encode: encodeLosslessWebP(matrixRGBA), loss: lossless},
+	{name: "avif", ext: ".avif", content: "rgb", encode: encodeWith(matrixRGB, "avif"), loss: lossy},
+	{name: "heic", ext: ".heic", content: "rgb", encode: encodeWith(matrixRGB, "heic"), loss: lossy},
+	{name: "heif", ext: ".heif", content: "gray", encode: encodeWith(toGray(matrixRGB), "heic"), loss: lossy},
+}
+
+var matrixOutputs = []matrixOutput{
+	{format: "jpg", loss: golden.Tolerance{Mean: 2.5, Max: 14}},
+	{format: "png", alpha: true, loss: lossless},
+	{format: "gif", loss: golden.Tolerance{Mean: 5, Max: 24}},
+	// VP8 keeps little chroma detail, and the Go decoder upsamples chroma
+	// without interpolation
+	{format: "webp", alpha: true, loss: golden.Tolerance{Mean: 9, Max: 22}},
+	{format: "tiff", alpha: true, loss: lossless},
+	{format: "avif", alpha: true, loss: golden.Tolerance{Mean: 2.5, Max: 14}},
+	{format: "heic", alpha: true, loss: golden.Tolerance{Mean: 2.5, Max: 14}},
+}
+
+func TestConversionMatrixCoverage(t *testing.T) {
+	inputs := map[string]bool{}
+	for _, in := range matrixInputs {
+		inputs[in.ext] = true
+	}
+	for _, ext := range inputExtensions {
+		if !inputs[ext] {
+			t.Errorf("input extension %s has no conversion matrix input", ext)
+		}
+	}
+
+	outputs := map[string]bool{}
+	for _, out := range matrixOutputs {
+		outputs[out.format] = true
+	}
+	for _, format := range outputFormats {
+		if !outputs[format] {
+			t.Errorf("output format %s has no conversion matrix output", format)
+		}
+	}
+}
+
+func TestConversionMatrix(t *testing.T) {
+	tempDir := t.TempDir()
+	half := matrixSize.Div(2)
+
+	// The golden images are the lossless processing of each content
+	t.Run("golden", func(t *testing.T) {
+		for _, content := range []struct {
+			name   string
+			img    image.Image
+			assume string
+		}{
+			{"rgb", matrixRGB, ""},
+			{"rgba", matrixRGBA, ""},
+			{"gray", toGray(matrixRGB), ""},
+			{"adobergb", matrixRGB, "adobergb"},
+		} {
+			config := Config{MaxWidth: half.X, MaxHeight: half.Y}
+			if content.assume != "" {
+				config.AssumeProfile, _ = OpenColorProfile(content.assume)
+			}
+			img, err := transformImage(content.img, config)
+			if err != nil {
+				t.Fatalf("transformImage() error = %v", err)
+			}
+			golden.Assert(t, goldenPath(content.name), img, lossless)
+		}
+	})
+
+	for _, in := range matrixInputs {
+		inputPath := filepath.Join(tempDir, in.name+in.ext)
+		if err := in.encode(inputPath); err != nil {
+			t.Fatalf("Failed to write %s input: %v", in.name, err)
+		}
+		want, err := golden.Read(goldenPath(in.content))
+		if err != nil {
+			t.Fatalf("Failed to read golden image: %v (run the tests with -update)", err)
+		}
+
+		for _, out := range matrixOutputs {
+			if in.content == "rgba" && !out.alpha {
+				continue
+			}
+			t.Run(in.name+"_to_"+out.format, func(t *testing.T) {
+				outputDir := filepath.Join(tempDir, in.name, out.format)
+				if err := os.MkdirAll(outputDir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				config := Config{OutputFormat: out.format, MaxWidth: half.X, MaxHeight: half.Y, Quality: 90, OutputDir: outputDir}
+				if in.assume != "" {
+					config.AssumeProfile, _ = OpenColorProfile(in.assume)
+				}
+				result, err := Process(inputPath, config)
+				if err != nil {
+					t.Fatalf("Process() error = %v", err)
+				}
+
+				got, err := loadImage(result.OutputPath)
+				if err != nil {
+					t.Fatalf("loadImage() error = %v", err)
+				}
+				diff, err := golden.Compare(got, want)
+				if err != nil {
+					t.Fatalf("golden %s: %v", in.content, err)
+				}
+				if tol := in.loss.Add(out.loss); !diff.Within(tol) {
+					t.Errorf("golden %s: %v, tolerance mean %.2f, max %.2f", in.content, diff, tol.Mean, tol.Max)
+				}
+			})
+		}
+	}
+}
+
+// goldenPath returns the path of the golden image of a content
+func goldenPath(content string) string {
+	return filepath.Join("testdata", "golden", content+".png")
+}
+
+// matrixRGB is the opaque reference pattern: gradients for banding and
+// color shifts, with hard-edged blocks for ringing
+var matrixRGB = func() image.Image {
+	img := image.NewNRGBA(image.Rectangle{Max: matrixSize})
+	for y := 0; y < matrixSize.Y; y++ {
+		for x := 0; x < matrixSize.X; x++ {
+			b := uint8(60)
+			if (x/32+y/32)%2 == 0 {
+				b = 200
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 255 / (matrixSize.X - 1)), uint8(y * 255 / (matrixSize.Y - 1)), b, 255})
+		}
+	}
+	return img
+}()
+
+// matrixRGBA is the reference pattern fading out to the right, fully
+// transparent in the last columns
+var matrixRGBA = func() image.Image {
+	img := imaging.Clone(matrixRGB)
+	for y := 0; y < matrixSize.Y; y++ {
+		for x := 0; x < matrixSize.X; x++ {
+			i := img.PixOffset(x, y)
+			img.Pix[i+3] = uint8(max(0, 255-x*255/(matrixSize.X-16)))
+		}
+	}
+	return img
+}()
+
+func toNRGBA64(img image.Image) image.Image {
+	return convertImage(image.NewNRGBA64(img.Bounds()), img)
+}
+
+func toGray(img image.Image) image.Image {
+	return convertImage(image.NewGray(img.Bounds()), img)
+}
+
+func toGray16(img image.Image) image.Image {
+	return convertImage(image.NewGray16(img.Bounds()), img)
+}
+
+// convertImage draws img into dst, converting it to dst's color model
+func convertImage(dst draw.Image, img image.Image) image.Image {
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	return dst
+}
+
+// writeEncoded writes what encode produces to path
+func writeEncoded(path string, encode func(*bytes.Buffer) error) error {
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func encodePNG(img image.Image) func(string) error {
+	return func(path string) error {
+		return writeEncoded(path, func(buf *bytes.Buffer) error { return png.Encode(buf, img) })
+	}
+}
+
+// encodeTaggedPNG writes a PNG with an sRGB chunk, which marks it as
+// carrying a color profile
+func encodeTaggedPNG(img image.Image) func(string) error {
+	return func(path string) error {
+		return writeEncoded(path, func(buf *bytes.Buffer) error {
+			if err := png.Encode(buf, img); err != nil {
+				return err
+			}
+			chunk := []byte{0, 0, 0, 1, 's', 'R', 'G', 'B', 0}
+			chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+			data := splice(buf.Bytes(), 33, chunk)
+			buf.Reset()
+			buf.Write(data)
+			return nil
+		})
+	}
+}
+
+func encodeJPEG(img image.Image) func(string) error {
+	return func(path string) error {
+		return writeEncoded(path, func(buf *bytes.Buffer) error { return jpeg.Encode(buf, img, &jpeg.Options{Quality: 95}) })
+	}
+}
+
+// encodeGrayGIF writes the grays of img with a palette holding all of them
+func encodeGrayGIF(img image.Image) func(string) error {
+	return func(path string) error {
+		palette := make(color.Palette, 256)
+		for i := range palette {
+			palette[i] = color.Gray{uint8(i)}
+		}
+		paletted := image.NewPaletted(img.Bounds(), palette)
+		gray := toGray(img).(*image.Gray)
+		copy(paletted.Pix, gray.Pix)
+		return writeEncoded(path, func(buf *bytes.Buffer) error { return gif.Encode(buf, paletted, nil) })
+	}
+}
+
+func encodeBMP(img image.Image) func(string) error {
+	return func(path string) error {
+		return writeEncoded(path, func(buf *bytes.Buffer) error { return bmp.Encode(buf, img) })
+	}
+}
+
+func encodeTIFFFile(img image.Image) func(string) error {
+	return func(path string) error {
+		return writeEncoded(path, func(buf *bytes.Buffer) error {
+			return tiff.Encode(buf, img, &tiff.Options{Compression: tiff.Deflate})
+		})
+	}
+}
+
+func encodeLosslessWebP(img image.Image) func(string) error {
+	return func(path string) error {
+		return writeEncoded(path, func(buf *bytes.Buffer) error {
+			// libwebp takes straight alpha, which the encoder reads from RGBA pixels
+			nrgba := imaging.Clone(img)
+			data, err := webp.EncodeExactLosslessRGBA(&image.RGBA{Pix: nrgba.Pix, Stride: nrgba.Stride, Rect: nrgba.Rect})
+			buf.Write(data)
+			return err
+		})
+	}
+}
+
+// encodeWith writes img with the processor's own encoder for format
+func encodeWith(img image.Image, format string) func(string) error {
+	return func(path string) error {
+		return saveImage(img, path, format, 95, 0, 0)
+	}
+}
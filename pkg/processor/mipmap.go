@@ -0,0 +1,307 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Mipmap outputs of Config.Mipmaps
+const (
+	MipmapImages = "images"
+	MipmapDDS    = "dds"
+	MipmapKTX2   = "ktx2"
+)
+
+// mipmapModes are the mipmap outputs
+var mipmapModes = []string{MipmapImages, MipmapDDS, MipmapKTX2}
+
+// errMipmapPages is returned for inputs with pages, which have no single
+// texture to build a mipmap chain from
+var errMipmapPages = errors.New("mipmaps need a single image, not one with pages")
+
+// MipmapModes returns the mipmap outputs
+func MipmapModes() []string {
+	return append([]string(nil), mipmapModes...)
+}
+
+// IsSupportedMipmaps reports whether mode is a mipmap output
+func IsSupportedMipmaps(mode string) bool {
+	for _, m := range mipmapModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// isMipmapContainer reports whether mode writes the whole chain into one
+// texture container instead of an image per level
+func isMipmapContainer(mode string) bool {
+	return mode == MipmapDDS || mode == MipmapKTX2
+}
+
+// mipmapPaths returns the outputs of count mipmap levels, such as
+// stone_mip0.png and stone_mip1.png for outputPath stone.png
+func mipmapPaths(outputPath string, count int) []string {
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("%s_mip%d%s", base, i, ext)
+	}
+	return paths
+}
+
+// powerOfTwo returns the power of two nearest to n, the larger one on a
+// tie, but at most the largest one within limit
+func powerOfTwo(n, limit int) int {
+	p := 1
+	for p*2 <= n {
+		p *= 2
+	}
+	if n-p >= p*2-n {
+		p *= 2
+	}
+	for p > 1 && p > limit {
+		p /= 2
+	}
+	return p
+}
+
+// mipmapChain resizes img to power-of-two sides within maxWidth x
+// maxHeight and halves it level by level down to 1x1, in linear light when
+// linear
+func mipmapChain(img image.Image, maxWidth, maxHeight int, linear bool) []*image.NRGBA {
+	bounds := img.Bounds()
+	width, height := powerOfTwo(bounds.Dx(), maxWidth), powerOfTwo(bounds.Dy(), maxHeight)
+	var level *image.NRGBA
+	if bounds.Dx() == width && bounds.Dy() == height {
+		level = imaging.Clone(img)
+	} else {
+		level = resample(img, image.Pt(width, height), imaging.Lanczos, linear)
+	}
+
+	levels := []*image.NRGBA{level}
+	for width > 1 || height > 1 {
+		width, height = max(1, width/2), max(1, height/2)
+		// Each pixel averages the 2x2 (or 2x1) block above it
+		level = resample(level, image.Pt(width, height), imaging.Box, linear)
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// processMipmaps transforms the image at inputPath and writes its mipmap
+// chain as config.Mipmaps selects: numbered images in format after
+// outputPath, or a single DDS or KTX2 texture at outputPath. It returns the
+// written paths.
+func processMipmaps(inputPath, outputPath, format string, config Config) ([]string, error) {
+	config.progress.stage(StageDecode)
+	img, err := loadInput(inputPath, config.progress, config.MaxPixels)
+	if err != nil {
+		return nil, err
+	}
+
+	config.progress.stage(StageTransform)
+	if img, err = transformImage(img, config); err != nil {
+		return nil, err
+	}
+	levels := mipmapChain(img, config.MaxWidth, config.MaxHeight, config.LinearResize)
+	*config.size = levels[0].Rect.Size()
+	if config.log != nil {
+		config.log.operations = append(config.log.operations, fmt.Sprintf("mipmaps %dx%d %d levels", config.size.X, config.size.Y, len(levels)))
+	}
+
+	config.progress.stage(StageEncode)
+	if isMipmapContainer(config.Mipmaps) {
+		if config.BeforeWrite != nil {
+			if err := config.BeforeWrite(outputPath); err != nil {
+				return nil, err
+			}
+		}
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if config.Mipmaps == MipmapKTX2 {
+			err = encodeKTX2(file, levels)
+		} else {
+			err = encodeDDS(file, levels)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []string{outputPath}, file.Close()
+	}
+
+	outputs := mipmapPaths(outputPath, len(levels))
+	for i, level := range levels {
+		if config.BeforeWrite != nil {
+			if err := config.BeforeWrite(outputs[i]); err != nil {
+				return nil, err
+			}
+		}
+		if err := saveImage(level, outputs[i], format, config.Quality, config.Speed, config.Effort); err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
+
+// mipmapPixels returns the pixels of level as tightly packed RGBA rows
+func mipmapPixels(level *image.NRGBA) []byte {
+	width, height := level.Rect.Dx(), level.Rect.Dy()
+	if level.Stride == width*4 && level.Rect.Min == (image.Point{}) {
+		return level.Pix[:width*height*4]
+	}
+	packed := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(packed, packed.Rect, level, level.Rect.Min, draw.Src)
+	return packed.Pix
+}
+
+// DDS header flags of the uncompressed RGBA textures encodeDDS writes
+const (
+	ddsCaps        = 0x1
+	ddsHeight      = 0x2
+	ddsWidth       = 0x4
+	ddsPitch       = 0x8
+	ddsPixelFormat = 0x1000
+	ddsMipmapCount = 0x20000
+
+	ddsAlphaPixels = 0x1
+	ddsRGB         = 0x40
+
+	ddsCapsComplex = 0x8
+	ddsCapsTexture = 0x1000
+	ddsCapsMipmap  = 0x400000
+)
+
+// encodeDDS writes levels, largest first, as an uncompressed 32-bit RGBA
+// DirectDraw Surface with a mipmap chain
+func encodeDDS(w io.Writer, levels []*image.NRGBA) error {
+	width, height := levels[0].Rect.Dx(), levels[0].Rect.Dy()
+
+	// Magic, then DDS_HEADER with its DDS_PIXELFORMAT at offset 76
+	header := make([]byte, 4+124)
+	copy(header, "DDS ")
+	h := header[4:]
+	binary.LittleEndian.PutUint32(h[0:], 124)
+	binary.LittleEndian.PutUint32(h[4:], ddsCaps|ddsHeight|ddsWidth|ddsPitch|ddsPixelFormat|ddsMipmapCount)
+	binary.LittleEndian.PutUint32(h[8:], uint32(height))
+	binary.LittleEndian.PutUint32(h[12:], uint32(width))
+	binary.LittleEndian.PutUint32(h[16:], uint32(width*4))
+	binary.LittleEndian.PutUint32(h[24:], uint32(len(levels)))
+	pf := h[72:]
+	binary.LittleEndian.PutUint32(pf[0:], 32)
+	binary.LittleEndian.PutUint32(pf[4:], ddsRGB|ddsAlphaPixels)
+	binary.LittleEndian.PutUint32(pf[12:], 32)
+	binary.LittleEndian.PutUint32(pf[16:], 0x000000ff)
+	binary.LittleEndian.PutUint32(pf[20:], 0x0000ff00)
+	binary.LittleEndian.PutUint32(pf[24:], 0x00ff0000)
+	binary.LittleEndian.PutUint32(pf[28:], 0xff000000)
+	caps := uint32(ddsCapsTexture)
+	if len(levels) > 1 {
+		caps |= ddsCapsComplex | ddsCapsMipmap
+	}
+	binary.LittleEndian.PutUint32(h[104:], caps)
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, level := range levels {
+		if _, err := w.Write(mipmapPixels(level)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ktx2Identifier starts every KTX2 file
+var ktx2Identifier = []byte{0xab, 'K', 'T', 'X', ' ', '2', '0', 0xbb, '\r', '\n', 0x1a, '\n'}
+
+// ktx2FormatRGBA8SRGB is VK_FORMAT_R8G8B8A8_SRGB, the format of the
+// textures encodeKTX2 writes
+const ktx2FormatRGBA8SRGB = 43
+
+// ktx2DFD returns the data format descriptor of 8-bit sRGB RGBA texels
+// with straight alpha
+func ktx2DFD() []byte {
+	const samples = 4
+	dfd := make([]byte, 4+24+16*samples)
+	binary.LittleEndian.PutUint32(dfd[0:], uint32(len(dfd)))
+	block := dfd[4:]
+	// Khronos basic descriptor block, version 2
+	binary.LittleEndian.PutUint32(block[4:], 2|uint32(24+16*samples)<<16)
+	// RGBSDA color model, BT.709 primaries, sRGB transfer
+	block[8], block[9], block[10] = 1, 1, 2
+	// 4 bytes per texel in plane 0
+	block[16] = 4
+	for i, channel := range []byte{0, 1, 2, 15} {
+		sample := block[24+16*i:]
+		binary.LittleEndian.PutUint16(sample[0:], uint16(8*i))
+		sample[2] = 7
+		sample[3] = channel
+		if channel == 15 {
+			// Alpha is linear in sRGB textures
+			sample[3] |= 0x10
+		}
+		binary.LittleEndian.PutUint32(sample[12:], 255)
+	}
+	return dfd
+}
+
+// encodeKTX2 writes levels, largest first, as an uncompressed sRGB RGBA
+// KTX2 texture. Levels are stored smallest first, as the format requires.
+func encodeKTX2(w io.Writer, levels []*image.NRGBA) error {
+	dfd := ktx2DFD()
+	const headerSize = 12 + 9*4 + 4*4 + 2*8
+	indexSize := 24 * len(levels)
+	dfdOffset := headerSize + indexSize
+	dataOffset := dfdOffset + len(dfd)
+
+	header := make([]byte, headerSize+indexSize)
+	copy(header, ktx2Identifier)
+	binary.LittleEndian.PutUint32(header[12:], ktx2FormatRGBA8SRGB)
+	binary.LittleEndian.PutUint32(header[16:], 1)
+	binary.LittleEndian.PutUint32(header[20:], uint32(levels[0].Rect.Dx()))
+	binary.LittleEndian.PutUint32(header[24:], uint32(levels[0].Rect.Dy()))
+	binary.LittleEndian.PutUint32(header[36:], 1)
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(levels)))
+	binary.LittleEndian.PutUint32(header[48:], uint32(dfdOffset))
+	binary.LittleEndian.PutUint32(header[52:], uint32(len(dfd)))
+
+	// RGBA texels keep every level 4-byte aligned
+	pixels := make([][]byte, len(levels))
+	offset := uint64(dataOffset)
+	for i := len(levels) - 1; i >= 0; i-- {
+		pixels[i] = mipmapPixels(levels[i])
+		entry := header[headerSize+24*i:]
+		binary.LittleEndian.PutUint64(entry[0:], offset)
+		binary.LittleEndian.PutUint64(entry[8:], uint64(len(pixels[i])))
+		binary.LittleEndian.PutUint64(entry[16:], uint64(len(pixels[i])))
+		offset += uint64(len(pixels[i]))
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(dfd); err != nil {
+		return err
+	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		if _, err := w.Write(pixels[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestPowerOfTwo(t *testing.T) {
+	tests := []struct {
+		n, limit int
+		expected int
+	}{
+		{1, 1920, 1},
+		{512, 1920, 512},
+		{1000, 1920, 1024},
+		{700, 1920, 512},
+		{768, 1920, 1024},
+		// Never above the maximum size
+		{1920, 1920, 1024},
+		{1500, 1000, 512},
+	}
+	for _, test := range tests {
+		if got := powerOfTwo(test.n, test.limit); got != test.expected {
+			t.Errorf("powerOfTwo(%d, %d) = %d, expected %d", test.n, test.limit, got, test.expected)
+		}
+	}
+}
+
+func TestMipmapChain(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 250, 60))
+	levels := mipmapChain(img, 1920, 1920, false)
+	expected := []image.Point{{256, 64}, {128, 32}, {64, 16}, {32, 8}, {16, 4}, {8, 2}, {4, 1}, {2, 1}, {1, 1}}
+	if len(levels) != len(expected) {
+		t.Fatalf("mipmapChain() has %d levels, expected %d", len(levels), len(expected))
+	}
+	for i, level := range levels {
+		if size := level.Rect.Size(); size != expected[i] {
+			t.Errorf("mipmapChain() level %d = %v, expected %v", i, size, expected[i])
+		}
+	}
+
+	// Levels average the pixels of the one above
+	checker := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if (x+y)%2 == 0 {
+				checker.Set(x, y, color.White)
+			} else {
+				checker.Set(x, y, color.Black)
+			}
+		}
+	}
+	levels = mipmapChain(checker, 4, 4, false)
+	if v := levels[2].NRGBAAt(0, 0).R; v < 126 || v > 129 {
+		t.Errorf("mipmapChain() 1x1 level = %d, expected mid gray", v)
+	}
+}
+
+func TestMipmapPaths(t *testing.T) {
+	paths := mipmapPaths(filepath.Join("out", "stone.png"), 3)
+	expected := []string{filepath.Join("out", "stone_mip0.png"), filepath.Join("out", "stone_mip1.png"), filepath.Join("out", "stone_mip2.png")}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Errorf("mipmapPaths()[%d] = %s, expected %s", i, paths[i], expected[i])
+		}
+	}
+}
+
+func TestEncodeDDS(t *testing.T) {
+	levels := mipmapChain(image.NewNRGBA(image.Rect(0, 0, 8, 4)), 8, 4, false)
+	var buf bytes.Buffer
+	if err := encodeDDS(&buf, levels); err != nil {
+		t.Fatalf("encodeDDS() error = %v", err)
+	}
+	data := buf.Bytes()
+	if string(data[:4]) != "DDS " {
+		t.Fatalf("encodeDDS() magic = %q", data[:4])
+	}
+	header := data[4:]
+	width, height := binary.LittleEndian.Uint32(header[12:]), binary.LittleEndian.Uint32(header[8:])
+	count := binary.LittleEndian.Uint32(header[24:])
+	if width != 8 || height != 4 || count != 4 {
+		t.Errorf("encodeDDS() header = %dx%d with %d levels, expected 8x4 with 4", width, height, count)
+	}
+	// 8x4, 4x2, 2x1 and 1x1 RGBA texels after the header
+	if expected := 128 + (32+8+2+1)*4; len(data) != expected {
+		t.Errorf("encodeDDS() wrote %d bytes, expected %d", len(data), expected)
+	}
+}
+
+func TestEncodeKTX2(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	levels := mipmapChain(img, 4, 4, false)
+	var buf bytes.Buffer
+	if err := encodeKTX2(&buf, levels); err != nil {
+		t.Fatalf("encodeKTX2() error = %v", err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, ktx2Identifier) {
+		t.Fatalf("encodeKTX2() identifier = %x", data[:12])
+	}
+	if format := binary.LittleEndian.Uint32(data[12:]); format != ktx2FormatRGBA8SRGB {
+		t.Errorf("encodeKTX2() format = %d, expected %d", format, ktx2FormatRGBA8SRGB)
+	}
+	if count := binary.LittleEndian.Uint32(data[40:]); count != 3 {
+		t.Fatalf("encodeKTX2() levels = %d, expected 3", count)
+	}
+
+	dfdOffset, dfdLength := binary.LittleEndian.Uint32(data[48:]), binary.LittleEndian.Uint32(data[52:])
+	if dfdOffset != 80+3*24 || dfdLength != binary.LittleEndian.Uint32(data[dfdOffset:]) {
+		t.Errorf("encodeKTX2() DFD at %d of %d bytes", dfdOffset, dfdLength)
+	}
+
+	// Each level index entry points at the pixels of that level, the
+	// smallest stored first
+	end := uint64(len(data))
+	for i, level := range levels {
+		entry := data[80+24*i:]
+		offset, length := binary.LittleEndian.Uint64(entry), binary.LittleEndian.Uint64(entry[8:])
+		if length != uint64(len(level.Pix)) || offset+length != end || offset%4 != 0 {
+			t.Errorf("encodeKTX2() level %d at %d of %d bytes, expected %d bytes ending at %d", i, offset, length, len(level.Pix), end)
+		}
+		if !bytes.Equal(data[offset:offset+length], level.Pix) {
+			t.Errorf("encodeKTX2() level %d pixels differ", i)
+		}
+		end = offset
+	}
+	if end != uint64(dfdOffset+dfdLength) {
+		t.Errorf("encodeKTX2() pixels start at %d, expected %d after the DFD", end, dfdOffset+dfdLength)
+	}
+}
+
+func TestProcessMipmaps(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "stone.png")
+	if err := imaging.Save(image.NewNRGBA(image.Rect(0, 0, 300, 120)), inputPath); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+	outputDir := filepath.Join(tempDir, "textures")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	config := Config{OutputFormat: "png", MaxWidth: 1920, MaxHeight: 1920, Quality: 90, OutputDir: outputDir, Mipmaps: MipmapImages}
+	result, err := Process(inputPath, config)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	// 256x128 down to 1x1
+	if len(result.Pages) != 9 || result.OutputPath != filepath.Join(outputDir, "stone_mip0.png") {
+		t.Fatalf("Process() outputs = %v, expected stone_mip0.png to stone_mip8.png", result.Outputs())
+	}
+	if result.Width != 256 || result.Height != 128 {
+		t.Errorf("Process() dimensions = %dx%d, expected 256x128", result.Width, result.Height)
+	}
+	last, err := imaging.Open(result.Pages[8])
+	if err != nil || last.Bounds().Size() != (image.Point{1, 1}) {
+		t.Errorf("Process() last level = %v, %v, expected 1x1", last, err)
+	}
+
+	// The earlier chain is found by its first level
+	config.Existing = ExistingSkip
+	if result, err = Process(inputPath, config); err != nil || !result.Skipped {
+		t.Errorf("Process() rerun = %+v, %v, expected the chain kept", result, err)
+	}
+
+	for _, mode := range []string{MipmapDDS, MipmapKTX2} {
+		config := Config{OutputFormat: "png", MaxWidth: 1920, MaxHeight: 1920, Quality: 90, OutputDir: outputDir, Mipmaps: mode}
+		result, err := Process(inputPath, config)
+		if err != nil {
+			t.Fatalf("Process() with %s error = %v", mode, err)
+		}
+		if expected := filepath.Join(outputDir, "stone."+mode); result.OutputPath != expected || len(result.Pages) != 0 {
+			t.Errorf("Process() with %s outputs = %v, expected %s", mode, result.Outputs(), expected)
+		}
+		if OutputPath(inputPath, config) != result.OutputPath {
+			t.Errorf("OutputPath() with %s = %s, expected %s", mode, OutputPath(inputPath, config), result.OutputPath)
+		}
+		if info, err := os.Stat(result.OutputPath); err != nil || info.Size() != result.OutputSize {
+			t.Errorf("Process() with %s OutputSize = %d, expected the file size", mode, result.OutputSize)
+		}
+	}
+}
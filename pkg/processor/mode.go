@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// resizeMode is how an image is brought to the maximum size
+type resizeMode int
+
+const (
+	// modeFit scales the whole image to fit within the maximum size
+	modeFit resizeMode = iota
+	// modeFill and modeCarve have already brought the image to the aspect
+	// ratio of the maximum size, by cropping or by removing seams
+	modeFill
+	modeCarve
+	// modeStretch scales the image to exactly the maximum size
+	modeStretch
+	// modePad fits the image, then centers it on a canvas of exactly the
+	// maximum size
+	modePad
+)
+
+// resizeMode returns the mode the settings of c select
+func (c Config) resizeMode() resizeMode {
+	switch {
+	case c.Fill:
+		return modeFill
+	case c.Carve:
+		return modeCarve
+	case c.Stretch:
+		return modeStretch
+	case c.Pad:
+		return modePad
+	}
+	return modeFit
+}
+
+// exact reports whether outputs of mode are exactly the maximum size when
+// they are enlarged
+func (m resizeMode) exact() bool {
+	return m == modeFill || m == modeCarve || m == modeStretch
+}
+
+// resizeSize returns the size resizeImage scales an image of size to,
+// before a padded image is placed on its canvas
+func resizeSize(size image.Point, maxWidth, maxHeight int, mode resizeMode, upscale bool) image.Point {
+	if mode == modeStretch || upscale && mode.exact() {
+		return image.Pt(maxWidth, maxHeight)
+	}
+	if upscale {
+		scale := min(float64(maxWidth)/float64(size.X), float64(maxHeight)/float64(size.Y))
+		return image.Pt(max(1, int(math.Round(float64(size.X)*scale))), max(1, int(math.Round(float64(size.Y)*scale))))
+	}
+	return fitSize(size, maxWidth, maxHeight)
+}
+
+// outputSize returns the size of the output resizeImage makes of an image
+// of size
+func outputSize(size image.Point, config Config) image.Point {
+	if config.resizeMode() == modePad {
+		return image.Pt(config.MaxWidth, config.MaxHeight)
+	}
+	return resizeSize(size, config.MaxWidth, config.MaxHeight, config.resizeMode(), config.Upscale)
+}
+
+// resizeImage brings img to the maximum size of config in its resize mode
+func resizeImage(img image.Image, config Config) image.Image {
+	mode := config.resizeMode()
+	size := resizeSize(img.Bounds().Size(), config.MaxWidth, config.MaxHeight, mode, config.Upscale)
+	if size != img.Bounds().Size() {
+		img = resample(img, size, imaging.Lanczos, config.LinearResize)
+	}
+	if mode == modePad && size != image.Pt(config.MaxWidth, config.MaxHeight) {
+		img = padImage(img, config.MaxWidth, config.MaxHeight, config.PadColor)
+	}
+	return img
+}
+
+// padImage centers img on a canvas of width x height filled with
+// background, white if nil
+func padImage(img image.Image, width, height int, background color.Color) image.Image {
+	if background == nil {
+		background = color.White
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	bounds := img.Bounds()
+	at := image.Pt((width-bounds.Dx())/2, (height-bounds.Dy())/2)
+	draw.Draw(dst, image.Rectangle{at, at.Add(bounds.Size())}, img, bounds.Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestResizeSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		size     image.Point
+		expected image.Point
+	}{
+		{"Fit shrinks to the width", Config{}, image.Pt(400, 200), image.Pt(100, 50)},
+		{"Fit shrinks to the height", Config{}, image.Pt(100, 400), image.Pt(25, 100)},
+		{"Fit keeps smaller images", Config{}, image.Pt(60, 30), image.Pt(60, 30)},
+		{"Fit enlarges with upscale", Config{Upscale: true}, image.Pt(60, 30), image.Pt(100, 50)},
+		{"Fill of a cropped image", Config{Fill: true}, image.Pt(300, 300), image.Pt(100, 100)},
+		{"Fill enlarges exactly with upscale", Config{Fill: true, Upscale: true}, image.Pt(61, 60), image.Pt(100, 100)},
+		{"Stretch shrinks regardless of the aspect ratio", Config{Stretch: true}, image.Pt(400, 200), image.Pt(100, 100)},
+		{"Stretch enlarges without upscale", Config{Stretch: true}, image.Pt(20, 60), image.Pt(100, 100)},
+		{"Pad canvas of a wide image", Config{Pad: true}, image.Pt(400, 200), image.Pt(100, 100)},
+		{"Pad canvas of a small image", Config{Pad: true}, image.Pt(20, 60), image.Pt(100, 100)},
+	}
+	for _, test := range tests {
+		test.config.MaxWidth, test.config.MaxHeight = 100, 100
+		if size := outputSize(test.size, test.config); size != test.expected {
+			t.Errorf("%s: outputSize(%v) = %v, expected %v", test.name, test.size, size, test.expected)
+		}
+		img := image.NewNRGBA(image.Rectangle{Max: test.size})
+		if size := resizeImage(img, test.config).Bounds().Size(); size != test.expected {
+			t.Errorf("%s: resizeImage() of %v = %v, expected %v", test.name, test.size, size, test.expected)
+		}
+	}
+}
+
+func TestPadImage(t *testing.T) {
+	img := imaging.New(400, 200, color.NRGBA{255, 0, 0, 255})
+	config := Config{MaxWidth: 100, MaxHeight: 100, Pad: true, PadColor: color.NRGBA{0, 0, 255, 255}}
+	out := resizeImage(img, config)
+
+	// 100x50 centered between bands of 25 pixels
+	tests := []struct {
+		at       image.Point
+		expected color.NRGBA
+	}{
+		{image.Pt(50, 10), color.NRGBA{0, 0, 255, 255}},
+		{image.Pt(50, 50), color.NRGBA{255, 0, 0, 255}},
+		{image.Pt(50, 90), color.NRGBA{0, 0, 255, 255}},
+	}
+	for _, test := range tests {
+		if c := color.NRGBAModel.Convert(out.At(test.at.X, test.at.Y)).(color.NRGBA); c != test.expected {
+			t.Errorf("pixel %v = %v, expected %v", test.at, c, test.expected)
+		}
+	}
+	if c := color.NRGBAModel.Convert(padImage(imaging.New(1, 1, color.Black), 3, 1, nil).At(0, 0)).(color.NRGBA); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("default padding = %v, expected white", c)
+	}
+}
@@ -0,0 +1,307 @@
+package processor
+
+import (
+	"fmt"
+	"image/color"
+	"log/slog"
+	"strings"
+)
+
+// MetadataPolicy selects the metadata written to outputs. Outputs are
+// always re-encoded, so of the source's metadata only the EXIF data of
+// Config.KeepEXIF and the catalog of Config.KeepCatalog are kept.
+type MetadataPolicy int
+
+const (
+	// MetadataStrip writes outputs without metadata, like
+	// Config.StripMetadata
+	MetadataStrip MetadataPolicy = iota
+	// MetadataProcessingLog records the applied operations in the XMP
+	// metadata of outputs that can hold it, like Config.ProcessingLog
+	MetadataProcessingLog
+)
+
+// Option changes the Config a Processor is built with
+type Option func(*Config)
+
+// FromConfig starts from config, replacing the defaults and the options
+// before it, so code that builds a Config keeps working with New
+func FromConfig(config Config) Option {
+	return func(c *Config) { *c = config }
+}
+
+// WithFormat converts outputs to format, one of OutputFormats
+func WithFormat(format string) Option {
+	return func(c *Config) {
+		c.OutputFormat = format
+		c.KeepFormat = false
+	}
+}
+
+// WithKeepFormat keeps the format and file name of each input
+func WithKeepFormat() Option {
+	return func(c *Config) { c.KeepFormat = true }
+}
+
+// WithQuality sets the quality of lossy outputs, from 1 to 100
+func WithQuality(quality int) Option {
+	return func(c *Config) { c.Quality = quality }
+}
+
+// WithMaxSize fits outputs within width x height
+func WithMaxSize(width, height int) Option {
+	return func(c *Config) { c.MaxWidth, c.MaxHeight = width, height }
+}
+
+// WithFill crops outputs to the aspect ratio of the maximum size around
+// their focal point, or gravity without one
+func WithFill(gravity string) Option {
+	return func(c *Config) { c.Fill, c.Gravity = true, gravity }
+}
+
+// WithCarve reaches the aspect ratio of the maximum size by seam carving
+// instead of cropping
+func WithCarve() Option {
+	return func(c *Config) { c.Carve = true }
+}
+
+// WithStretch scales outputs to exactly the maximum size, whatever the
+// aspect ratio of the image
+func WithStretch() Option {
+	return func(c *Config) { c.Stretch = true }
+}
+
+// WithPad fits outputs within the maximum size and centers them on a
+// canvas of exactly that size filled with background, white if nil
+func WithPad(background color.Color) Option {
+	return func(c *Config) { c.Pad, c.PadColor = true, background }
+}
+
+// WithUpscale enlarges images smaller than the maximum size, so that
+// filled outputs are exactly that size
+func WithUpscale() Option {
+	return func(c *Config) { c.Upscale = true }
+}
+
+// WithLinearResize scales images in linear light
+func WithLinearResize() Option {
+	return func(c *Config) { c.LinearResize = true }
+}
+
+// WithAutoOrient turns images upright according to their EXIF orientation
+func WithAutoOrient() Option {
+	return func(c *Config) { c.AutoOrient = true }
+}
+
+// WithSRGB converts inputs with an embedded matrix/TRC ICC profile to sRGB
+func WithSRGB() Option {
+	return func(c *Config) { c.ToSRGB = true }
+}
+
+// WithOutputDir writes outputs into dir
+func WithOutputDir(dir string) Option {
+	return func(c *Config) { c.OutputDir = dir }
+}
+
+// WithSpeed sets the AVIF encoder speed, from 1 (slowest, smallest) to 9
+func WithSpeed(speed int) Option {
+	return func(c *Config) { c.Speed = speed }
+}
+
+// WithEffort sets the JPEG XL encoder effort, from 1 (fastest) to 10
+// (slowest, smallest)
+func WithEffort(effort int) Option {
+	return func(c *Config) { c.Effort = effort }
+}
+
+// WithMetadataPolicy selects the metadata of outputs. software names the
+// tool in the processing log.
+func WithMetadataPolicy(policy MetadataPolicy, software string) Option {
+	return func(c *Config) {
+		c.ProcessingLog = policy == MetadataProcessingLog
+		c.StripMetadata = policy == MetadataStrip
+		c.Software = software
+	}
+}
+
+// WithContrast raises (positive) or lowers (negative) the contrast by
+// percent
+func WithContrast(percent float64) Option {
+	return func(c *Config) { c.Contrast = percent }
+}
+
+// WithGrayscale converts outputs to shades of gray
+func WithGrayscale() Option {
+	return func(c *Config) { c.Grayscale = true }
+}
+
+// WithDither reduces outputs to levels shades of gray with method, for
+// e-ink screens. A levels of 0 means 16.
+func WithDither(method string, levels int) Option {
+	return func(c *Config) { c.Dither, c.GrayLevels = method, levels }
+}
+
+// WithMipmaps writes a power-of-two mipmap chain of each input as mode
+// selects: MipmapImages, MipmapDDS or MipmapKTX2
+func WithMipmaps(mode string) Option {
+	return func(c *Config) { c.Mipmaps = mode }
+}
+
+// WithColorTag marks PNG and WebP outputs as sRGB with tag, one of
+// ColorTags
+func WithColorTag(tag string) Option {
+	return func(c *Config) { c.ColorTag = tag }
+}
+
+// WithDocument turns photos of paper into scans in mode, one of
+// DocumentModes
+func WithDocument(mode string) Option {
+	return func(c *Config) { c.Document = mode }
+}
+
+// WithSplitSpreads splits scans of two-page spreads into their pages
+func WithSplitSpreads() Option {
+	return func(c *Config) { c.SplitSpreads = true }
+}
+
+// WithDeskew straightens the lines of text of scans
+func WithDeskew() Option {
+	return func(c *Config) { c.Deskew = true }
+}
+
+// WithKeepEXIF copies the EXIF data of JPEG and HEIF inputs, including
+// their location, into JPEG outputs
+func WithKeepEXIF() Option {
+	return func(c *Config) { c.KeepEXIF = true }
+}
+
+// WithStripGPS keeps the EXIF data of inputs in outputs without their
+// location
+func WithStripGPS() Option {
+	return func(c *Config) { c.KeepEXIF, c.StripGPS = true, true }
+}
+
+// WithWatermark composites watermark onto outputs after resizing
+func WithWatermark(watermark *Watermark) Option {
+	return func(c *Config) { c.Watermark = watermark }
+}
+
+// WithOwner writes artist and copyright, where not empty, into the EXIF
+// data of outputs
+func WithOwner(artist, copyright string) Option {
+	return func(c *Config) { c.Artist, c.Copyright = artist, copyright }
+}
+
+// WithSidecars copies the sidecars of inputs next to their outputs
+func WithSidecars() Option {
+	return func(c *Config) { c.CopySidecars = true }
+}
+
+// WithExistingPolicy selects what happens to outputs of an earlier run
+func WithExistingPolicy(policy ExistingPolicy) Option {
+	return func(c *Config) { c.Existing = policy }
+}
+
+// WithDeterministic makes repeated runs over identical inputs produce
+// byte-identical outputs
+func WithDeterministic() Option {
+	return func(c *Config) { c.Deterministic = true }
+}
+
+// WithLogger sends debug records of the steps taken for each input to
+// logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Config) { c.Logger = logger }
+}
+
+// Processor processes images with a validated Config
+type Processor struct {
+	config Config
+}
+
+// New returns a Processor with options applied to the defaults. Images are
+// written as JPEG at quality 90 within 1920x1920 into the output directory.
+// They are turned upright by their EXIF orientation and lose their EXIF
+// data, which may hold where they were taken. PNG and WebP outputs are
+// tagged as sRGB. Invalid settings fail here instead of on the first file.
+func New(options ...Option) (*Processor, error) {
+	config := Config{
+		OutputFormat: "jpg",
+		MaxWidth:     1920,
+		MaxHeight:    1920,
+		Quality:      90,
+		OutputDir:    "output",
+		AutoOrient:   true,
+		KeepCatalog:  true,
+		ColorTag:     ColorTagSRGB,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Processor{config: config}, nil
+}
+
+// Config returns the settings of p
+func (p *Processor) Config() Config {
+	return p.config
+}
+
+// Process processes the image at inputPath like the function Process
+func (p *Processor) Process(inputPath string) (Result, error) {
+	return Process(inputPath, p.config)
+}
+
+// Validate reports the first setting of c that Process cannot work with
+func (c Config) Validate() error {
+	if !c.KeepFormat && !IsSupportedOutputFormat(c.OutputFormat) {
+		return fmt.Errorf("output format must be one of %s, got: %s", strings.Join(outputFormats, ", "), c.OutputFormat)
+	}
+	if c.Quality < 1 || c.Quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100, got: %d", c.Quality)
+	}
+	if c.MaxWidth <= 0 || c.MaxHeight <= 0 {
+		return fmt.Errorf("maximum dimensions must be positive, got: %dx%d", c.MaxWidth, c.MaxHeight)
+	}
+	if c.Speed < 0 || c.Speed > 9 {
+		return fmt.Errorf("speed must be between 0 (encoder default) and 9, got: %d", c.Speed)
+	}
+	if c.Effort < 0 || c.Effort > 10 {
+		return fmt.Errorf("effort must be between 0 (encoder default) and 10, got: %d", c.Effort)
+	}
+	if c.Gravity != "" && !IsSupportedGravity(c.Gravity) {
+		return fmt.Errorf("gravity must be one of %s, got: %s", strings.Join(gravities, ", "), c.Gravity)
+	}
+	if c.Contrast < -100 || c.Contrast > 100 {
+		return fmt.Errorf("contrast must be between -100 and 100, got: %g", c.Contrast)
+	}
+	if c.Dither != "" && !IsSupportedDither(c.Dither) {
+		return fmt.Errorf("dither must be one of %s, got: %s", strings.Join(dithers, ", "), c.Dither)
+	}
+	if c.GrayLevels != 0 && (c.GrayLevels < 2 || c.GrayLevels > 256) {
+		return fmt.Errorf("gray levels must be between 2 and 256, got: %d", c.GrayLevels)
+	}
+	if c.Mipmaps != "" && !IsSupportedMipmaps(c.Mipmaps) {
+		return fmt.Errorf("mipmaps must be one of %s, got: %s", strings.Join(mipmapModes, ", "), c.Mipmaps)
+	}
+	if c.ColorTag != "" && !IsSupportedColorTag(c.ColorTag) {
+		return fmt.Errorf("color tag must be one of %s, got: %s", strings.Join(colorTags, ", "), c.ColorTag)
+	}
+	if c.Document != "" && !IsSupportedDocument(c.Document) {
+		return fmt.Errorf("document must be one of %s, got: %s", strings.Join(documentModes, ", "), c.Document)
+	}
+	if c.Watermark != nil {
+		if err := c.Watermark.validate(); err != nil {
+			return err
+		}
+	}
+	if c.StripMetadata && c.ProcessingLog {
+		return fmt.Errorf("strip metadata cannot be combined with the processing log")
+	}
+	if c.OutputDir == "" {
+		return fmt.Errorf("output directory is required")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []Option
+		errorMsg string
+	}{
+		{"Defaults", nil, ""},
+		{"All options", []Option{WithFormat("png"), WithQuality(75), WithMaxSize(800, 600), WithFill("top"), WithCarve(), WithOutputDir("thumbs"), WithSpeed(6), WithEffort(9), WithMetadataPolicy(MetadataProcessingLog, "tool 1.0"), WithDeterministic(), WithUpscale(), WithLinearResize(), WithAutoOrient(), WithSRGB(), WithExistingPolicy(ExistingIfNewer), WithContrast(15), WithGrayscale(), WithDither(DitherOrdered, 4), WithMipmaps(MipmapKTX2), WithColorTag(ColorTagCICP), WithDocument(DocumentBW), WithSplitSpreads()}, ""},
+		{"Stretch", []Option{WithStretch()}, ""},
+		{"Pad", []Option{WithPad(nil)}, ""},
+		{"Keep format ignores the format", []Option{WithFormat("bmp"), WithKeepFormat()}, ""},
+		{"Unknown format", []Option{WithFormat("bmp")}, "output format must be one of"},
+		{"Quality too high", []Option{WithQuality(101)}, "quality must be between 1 and 100"},
+		{"Zero width", []Option{WithMaxSize(0, 600)}, "maximum dimensions must be positive"},
+		{"Speed too high", []Option{WithSpeed(10)}, "speed must be between 0 (encoder default) and 9"},
+		{"Negative effort", []Option{WithEffort(-1)}, "effort must be between 0 (encoder default) and 10"},
+		{"Unknown gravity", []Option{WithFill("north")}, "gravity must be one of"},
+		{"Contrast too high", []Option{WithContrast(150)}, "contrast must be between -100 and 100"},
+		{"Unknown dither", []Option{WithDither("atkinson", 0)}, "dither must be one of"},
+		{"One gray level", []Option{WithDither(DitherFloydSteinberg, 1)}, "gray levels must be between 2 and 256"},
+		{"Unknown mipmaps", []Option{WithMipmaps("pvr")}, "mipmaps must be one of"},
+		{"Unknown color tag", []Option{WithColorTag("p3")}, "color tag must be one of"},
+		{"Unknown document", []Option{WithDocument("sepia")}, "document must be one of"},
+		{"No output directory", []Option{WithOutputDir("")}, "output directory is required"},
+		{"Config without quality", []Option{FromConfig(Config{OutputFormat: "jpg", MaxWidth: 100, MaxHeight: 100, OutputDir: "out"})}, "quality must be between 1 and 100"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.options...)
+			if test.errorMsg == "" {
+				if err != nil {
+					t.Errorf("New() error = %v, expected nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), test.errorMsg) {
+				t.Errorf("New() error = %v, expected %q", err, test.errorMsg)
+			}
+		})
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	p, err := New(
+		FromConfig(Config{OutputFormat: "webp", MaxWidth: 640, MaxHeight: 480, Quality: 70, OutputDir: "old", Histogram: true}),
+		WithQuality(85),
+		WithMetadataPolicy(MetadataProcessingLog, "tool 1.0"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	config := p.Config()
+	// Options after FromConfig change its settings, the rest is kept
+	if config.Quality != 85 || config.OutputFormat != "webp" || config.MaxWidth != 640 || !config.Histogram {
+		t.Errorf("Config() = %+v, expected the webp config at quality 85", config)
+	}
+	if !config.ProcessingLog || config.Software != "tool 1.0" {
+		t.Errorf("processing log = %v by %q, expected on by tool 1.0", config.ProcessingLog, config.Software)
+	}
+
+	p, err = New(WithMetadataPolicy(MetadataProcessingLog, ""), WithMetadataPolicy(MetadataStrip, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Config().ProcessingLog {
+		t.Error("MetadataStrip left the processing log on")
+	}
+}
+
+func TestProcessorProcess(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "photo.png")
+	if err := encodePNG(image.NewNRGBA(image.Rect(0, 0, 400, 200)))(inputPath); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	p, err := New(WithFormat("png"), WithMaxSize(100, 100), WithOutputDir(t.TempDir()), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.Process(inputPath)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	img, err := loadImage(result.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(100, 50) {
+		t.Errorf("output is %dx%d, expected 100x50", got.X, got.Y)
+	}
+
+	// The injected logger receives the steps
+	for _, want := range []string{"msg=Processing input=" + inputPath, "msg=Decoded", "width=400 height=200", "msg=Processed", "width=100 height=50", " decode=", " encode="} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs are missing %q:\n%s", want, logs.String())
+		}
+	}
+}
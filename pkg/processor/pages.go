@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"image"
+	"path/filepath"
+	"strings"
+)
+
+// pageSource is an input with pages, such as a multi-page TIFF, a PDF or a
+// comic archive
+type pageSource interface {
+	count() int
+	page(i int) (image.Image, error)
+	close() error
+}
+
+// openPages opens the pages of inputPath when they are all to be
+// processed: PDFs and comic archives always, multi-page TIFFs with
+// config.AllPages and two-page spreads with config.SplitSpreads. It
+// returns nil for other inputs.
+func openPages(inputPath string, config Config) (pageSource, error) {
+	switch strings.ToLower(filepath.Ext(inputPath)) {
+	case ".pdf":
+		config.progress.stage(StageDecode)
+		pages, err := rasterizePDF(inputPath, config.PDFDPI)
+		if err != nil {
+			return nil, err
+		}
+		pages.limit = config.MaxPixels
+		return pages, nil
+	case ".cbz", ".cbr":
+		config.progress.stage(StageDecode)
+		pages, err := openComic(inputPath)
+		if err != nil {
+			return nil, err
+		}
+		pages.limit = config.MaxPixels
+		return pages, nil
+	case ".tif", ".tiff":
+		if !config.AllPages {
+			break
+		}
+		// Unreadable files fail when decoded as a single image
+		config.progress.stage(StageDecode)
+		f, err := readTIFF(inputPath, config.progress)
+		if err != nil {
+			return nil, nil
+		}
+		if len(f.pages) >= 2 {
+			f.limit = config.MaxPixels
+			return f, nil
+		}
+	}
+	if config.SplitSpreads {
+		return openSpread(inputPath, config)
+	}
+	return nil, nil
+}
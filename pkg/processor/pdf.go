@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// pdfRasterizer renders PDF pages to images, from poppler-utils
+const pdfRasterizer = "pdftoppm"
+
+// PDFRasterizer returns the path of the tool that renders PDF pages
+func PDFRasterizer() (string, error) {
+	path, err := exec.LookPath(pdfRasterizer)
+	if err != nil {
+		return "", fmt.Errorf("rendering PDF pages needs %s (install poppler-utils)", pdfRasterizer)
+	}
+	return path, nil
+}
+
+// pdfPages are the pages of a PDF rendered to PNG files in a temporary
+// directory
+type pdfPages struct {
+	dir   string
+	files []string
+	// limit is the most pixels of a page, 0 for maxPixels
+	limit int64
+}
+
+// rasterizePDF renders every page of the PDF at path at dpi
+func rasterizePDF(path string, dpi int) (*pdfPages, error) {
+	if dpi <= 0 {
+		return nil, errors.New("PDF input needs a DPI to render pages at")
+	}
+	tool, err := PDFRasterizer()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "picture-resize-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(tool, "-r", strconv.Itoa(dpi), "-png", path, filepath.Join(dir, "page"))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s failed: %v: %s", pdfRasterizer, err, bytes.TrimSpace(output))
+	}
+
+	// Page numbers are zero-padded to the same width
+	files, _ := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	sort.Strings(files)
+	if len(files) == 0 {
+		os.RemoveAll(dir)
+		return nil, errors.New("PDF has no pages")
+	}
+	return &pdfPages{dir: dir, files: files}, nil
+}
+
+func (p *pdfPages) count() int {
+	return len(p.files)
+}
+
+func (p *pdfPages) page(i int) (image.Image, error) {
+	return loadInput(p.files[i], nil, p.limit)
+}
+
+// close removes the rendered pages
+func (p *pdfPages) close() error {
+	return os.RemoveAll(p.dir)
+}
@@ -0,0 +1,88 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeRasterizer puts a pdftoppm on PATH that writes pages copies of a
+// PNG, recording the DPI it was asked for
+func fakeRasterizer(t *testing.T, pages int) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake rasterizer is a shell script")
+	}
+	binDir := t.TempDir()
+
+	img := image.NewRGBA(image.Rect(0, 0, 850, 1100))
+	for y := 0; y < 1100; y++ {
+		for x := 0; x < 850; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	pagePath := filepath.Join(binDir, "page.png")
+	if err := saveImage(img, pagePath, "png", 90, 0, 0); err != nil {
+		t.Fatalf("Failed to write page fixture: %v", err)
+	}
+
+	// Arguments are: -r dpi -png input root
+	script := "#!/bin/sh\necho \"$2\" > " + filepath.Join(binDir, "dpi") + "\n"
+	for i := 1; i <= pages; i++ {
+		script += fmt.Sprintf("cp %s \"$5-%02d.png\"\n", pagePath, i)
+	}
+	if err := os.WriteFile(filepath.Join(binDir, pdfRasterizer), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake rasterizer: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return binDir
+}
+
+func TestProcessPDF(t *testing.T) {
+	binDir := fakeRasterizer(t, 12)
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "doc.pdf")
+	if err := os.WriteFile(inputPath, []byte("%PDF-1.4\n"), 0644); err != nil {
+		t.Fatalf("Failed to write PDF fixture: %v", err)
+	}
+
+	config := Config{OutputFormat: "jpg", MaxWidth: 200, MaxHeight: 200, Quality: 90, OutputDir: tempDir, PDFDPI: 100}
+	result, err := Process(inputPath, config)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if len(result.Pages) != 12 {
+		t.Fatalf("Pages = %d, expected 12", len(result.Pages))
+	}
+	if filepath.Base(result.OutputPath) != "doc_p001.jpg" || filepath.Base(result.Pages[11]) != "doc_p012.jpg" {
+		t.Errorf("outputs = %s to %s, expected doc_p001.jpg to doc_p012.jpg", filepath.Base(result.OutputPath), filepath.Base(result.Pages[11]))
+	}
+	img, err := loadImage(result.Pages[11])
+	if err != nil {
+		t.Fatalf("loadImage() error = %v", err)
+	}
+	if img.Bounds().Dy() != 200 {
+		t.Errorf("page height = %d, expected 200", img.Bounds().Dy())
+	}
+	if dpi, _ := os.ReadFile(filepath.Join(binDir, "dpi")); string(dpi) != "100\n" {
+		t.Errorf("rendered at %q DPI, expected 100", dpi)
+	}
+
+	// Without a DPI PDFs are not processed
+	config.PDFDPI = 0
+	if _, err := Process(inputPath, config); err == nil {
+		t.Error("Process() without a DPI expected error, got nil")
+	}
+}
+
+func TestPDFRasterizerMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := PDFRasterizer(); err == nil {
+		t.Error("PDFRasterizer() expected error without pdftoppm, got nil")
+	}
+}
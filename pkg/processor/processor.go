@@ -1,72 +1,861 @@
 package processor
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"image"
+	"image/color"
 	"image/jpeg"
 	"image/png"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/strukturag/libheif/go/heif"
+	"golang.org/x/image/tiff"
+	xwebp "golang.org/x/image/webp"
 )
 
+// inputExtensions lists the file extensions that can be decoded
+var inputExtensions = []string{".heic", ".heif", ".avif", ".jpg", ".jpeg", ".png", ".bmp", ".tiff", ".tif", ".webp", ".gif"}
+
+// outputFormats lists the formats that can be encoded
+var outputFormats = []string{"jpg", "png", "avif", "heic", "gif", "webp", "tiff"}
+
 type Config struct {
 	OutputFormat string
 	MaxWidth     int
 	MaxHeight    int
 	Quality      int
 	OutputDir    string
+	// Speed trades encoding time for size with AVIF, from 1 (slowest,
+	// smallest) to 9 (fastest). 0 keeps the encoder default.
+	Speed int
+	// Effort trades encoding time for size with JPEG XL, from 1 (fastest)
+	// to 10 (slowest, smallest). 0 keeps the encoder default.
+	Effort int
+	// Deterministic makes repeated runs over identical inputs produce
+	// byte-identical outputs with a fixed modification time
+	Deterministic bool
+
+	// KeepFormat keeps the input's format and file name instead of
+	// converting to OutputFormat
+	KeepFormat bool
+	// Existing decides whether outputs of an earlier run are replaced. It
+	// is checked before the input is decoded.
+	Existing ExistingPolicy
+	// OutputName replaces the output file name, keeping its extension
+	OutputName string
+	// StampText is burned into the bottom-left corner after resizing
+	StampText string
+	// Watermark, if set, is composited onto outputs after resizing
+	Watermark *Watermark
+	// Crop selects a region of the source image, relative to its top-left
+	// corner, before resizing. An empty rectangle keeps the whole image.
+	Crop image.Rectangle
+	// Fill crops the image to the aspect ratio of MaxWidth x MaxHeight
+	// around its focal point before resizing, instead of fitting the whole
+	// image within them
+	Fill bool
+	// Focus is the focal point used by Fill. Nil uses the focal point in
+	// the image's XMP metadata, or else Gravity.
+	Focus *FocalPoint
+	// Gravity anchors Fill crops without a focal point: center, top,
+	// bottom, left, right or smart. Empty means center.
+	Gravity string
+	// Carve reaches the aspect ratio of MaxWidth x MaxHeight by removing
+	// the seams of least contrast instead of cropping, for modest changes
+	// such as 4:3 to 16:9. Experimental and slower than Fill; animations
+	// are filled instead, as seams differ from frame to frame.
+	Carve bool
+	// Stretch scales images to exactly MaxWidth x MaxHeight, distorting
+	// them if their aspect ratio differs. Fill and Carve take precedence
+	// over Stretch, and Stretch over Pad.
+	Stretch bool
+	// Pad fits images within MaxWidth x MaxHeight and centers them on a
+	// canvas of exactly that size filled with PadColor, white if nil
+	Pad      bool
+	PadColor color.Color
+	// Upscale enlarges images smaller than MaxWidth x MaxHeight, so that
+	// Fill and Carve outputs are always exactly that size
+	Upscale bool
+	// LinearResize scales in linear light instead of on sRGB values, which
+	// keeps fine patterns from darkening or beating. Slower.
+	LinearResize bool
+	// Contrast raises (positive) or lowers (negative) the contrast of
+	// outputs by this percentage, from -100 to 100
+	Contrast float64
+	// Grayscale converts outputs to shades of gray, with transparent areas
+	// turned white
+	Grayscale bool
+	// Dither reduces grayscale outputs to GrayLevels shades, as e-ink
+	// screens show them: DitherFloydSteinberg diffuses the error to
+	// neighbouring pixels, DitherOrdered uses a fixed pattern that suits
+	// line art. It implies Grayscale. Empty keeps every shade.
+	Dither string
+	// GrayLevels is the number of shades Dither reduces to, from 2 to 256.
+	// 0 means 16, the shades of most e-ink screens.
+	GrayLevels int
+	// Mipmaps writes a power-of-two mipmap chain for game textures instead
+	// of a single output, the base level resized to the nearest power of
+	// two within MaxWidth x MaxHeight: MipmapImages as numbered outputs
+	// after the output path, MipmapDDS or MipmapKTX2 as one uncompressed
+	// texture. Empty writes no mipmaps.
+	Mipmaps string
+	// AutoOrient turns images upright according to their EXIF orientation
+	// before any other step. HEIF images are decoded upright by libheif
+	// either way.
+	AutoOrient bool
+	// orientation is the EXIF orientation of the current input
+	orientation int
+	// AllPages processes every page of multi-page TIFFs: into one
+	// multi-page output when writing TIFF, otherwise into numbered outputs.
+	// By default only the first page is processed.
+	AllPages bool
+	// SplitSpreads splits scans of two-page spreads at their gutter into
+	// a left and a right page before any other step, processed like the
+	// pages of AllPages. Other images, animations and the pages of PDFs,
+	// comic archives and AllPages TIFFs are left whole.
+	SplitSpreads bool
+	// PDFDPI is the resolution PDF pages are rendered at. PDFs are always
+	// processed page by page, like AllPages.
+	PDFDPI int
+	// MaxPixels is the most pixels an image, each page of a PDF, comic
+	// archive or multi-page TIFF, and all frames of an animation together
+	// may have, read from their headers before they are decoded. Larger
+	// ones fail with ErrTooManyPixels. 0 leaves the built-in limit of 2^28.
+	MaxPixels int64
+	// WhiteBalance corrects color cast and exposure from a neutral
+	// reference before cropping. Nil leaves colors unchanged.
+	WhiteBalance *WhiteBalance
+	// Document turns photos of paper into scans: the page is found,
+	// straightened and its lighting evened out, then DocumentBW binarizes
+	// it and DocumentGray or DocumentColor sharpen it. Empty leaves photos
+	// as they are.
+	Document string
+	// Deskew finds the skew of the lines of text of scans, up to 15
+	// degrees either way, and turns them straight, keeping their size. The
+	// angle is reported in Result.Skew.
+	Deskew bool
+	// skew receives the angle the first transformed image of the current
+	// output was turned by
+	skew *float64
+	// Histogram computes the luma histogram of outputs into
+	// Result.Histogram
+	Histogram bool
+	// histogram receives the transformed images of the current output
+	histogram *Histogram
+	// size receives the size of the first transformed image of the
+	// current output
+	size *image.Point
+	// AssumeProfile is the color space of inputs without an embedded
+	// profile, whose pixels are converted from it to sRGB. Nil leaves them
+	// unchanged.
+	AssumeProfile *ColorProfile
+	// ToSRGB converts JPEG and PNG inputs with an embedded matrix/TRC ICC
+	// profile to sRGB. Other profiles are left as they are.
+	ToSRGB bool
+	// embedded is the profile of the current input converted by ToSRGB
+	embedded *ColorProfile
+	// ColorTag marks PNG and WebP outputs holding sRGB pixels as sRGB, so
+	// viewers agree on their colors: ColorTagSRGB or ColorTagCICP. Empty
+	// or ColorTagNone leaves them untagged.
+	ColorTag string
+	// KeepEXIF copies the EXIF data of JPEG and HEIF inputs, such as the
+	// capture time, camera, lens and location, into JPEG outputs. The
+	// orientation is reset for upright pixels, the pixel dimensions follow
+	// the output and the thumbnail of the source is dropped.
+	KeepEXIF bool
+	// KeepCatalog carries the title, description, keywords and rating of
+	// the XMP and IPTC metadata of inputs into the XMP metadata of JPEG,
+	// PNG, GIF, WebP and TIFF outputs, and into IPTC records of JPEG ones
+	KeepCatalog bool
+	// StripGPS removes the location from the EXIF data KeepEXIF copies,
+	// keeping the rest, and lists the tags removed in Result.Scrubbed
+	StripGPS bool
+	// scrubbed receives the tags StripGPS removed from the current output
+	scrubbed *[]string
+	// CopySidecars copies the XMP, Apple AAE and Google Takeout JSON
+	// sidecars of inputs next to their outputs, renamed after them
+	CopySidecars bool
+	// Artist and Copyright are written into the EXIF data of JPEG, PNG,
+	// WebP and TIFF outputs, replacing those of the input
+	Artist    string
+	Copyright string
+	// StripMetadata writes outputs without any metadata: no EXIF data,
+	// processing log, color tags or sidecars, whatever the options adding
+	// them say. Outputs are checked after writing,
+	// and any EXIF, XMP, IPTC, ICC or comment data left fails the file.
+	StripMetadata bool
+	// ProcessingLog records the applied operations and Software in the
+	// XMP metadata of JPEG, PNG, GIF, WebP and TIFF outputs
+	ProcessingLog bool
+	Software      string
+	// log receives the operations applied to the current output
+	log *operationLog
+	// CaptureTime, if set, is when the input was taken. It is recorded in
+	// the processing log and as the modification time of outputs.
+	CaptureTime time.Time
+
+	// Mode sets the permission bits of outputs; 0 keeps the default
+	Mode os.FileMode
+	// Owner changes the owner of outputs; nil keeps the current user
+	Owner *Owner
+	// PreserveAttrs gives outputs the access and modification times and
+	// the permission bits of their input, like cp -p. Mode and CaptureTime
+	// take precedence.
+	PreserveAttrs bool
+	// source is the current input, whose attributes PreserveAttrs copies
+	source os.FileInfo
+
+	// BeforeWrite, if set, is called with the output path before anything
+	// is written to it. An error aborts processing of the file.
+	BeforeWrite func(outputPath string) error
+	// IsSource, if set, reports whether a path is one of the other inputs
+	// of a run. Outputs at such paths fail with ErrOverwritesInput, like
+	// outputs that would replace their own input, so converting a.png
+	// next to a.jpg cannot replace a.jpg.
+	IsSource func(path string) bool
+
+	// OnStart, OnProgress and OnComplete, if set, follow each input of
+	// Process: OnStart before it is read, OnProgress as it is read and as
+	// each stage begins, and OnComplete with the outcome. They run on the
+	// goroutine that called Process.
+	OnStart    func(Event)
+	OnProgress func(Event)
+	OnComplete func(Result, error)
+	// progress reports the current input to OnProgress
+	progress *fileProgress
+
+	// Logger receives debug records of the steps taken for each input.
+	// Nil discards them.
+	Logger *slog.Logger
+}
+
+// Owner identifies the user and group that own an output. An ID of -1
+// leaves that part unchanged.
+type Owner struct {
+	UID int
+	GID int
+}
+
+// Result describes the files involved in processing one image
+type Result struct {
+	InputPath  string
+	OutputPath string
+	InputSize  int64
+	OutputSize int64
+	// Width and Height are the size of the output, of its first frame or
+	// page if it has several
+	Width  int
+	Height int
+	// Pages lists the numbered outputs of an input split into pages or
+	// mipmap levels, the first being OutputPath. OutputSize is their total.
+	Pages []string
+	// Histogram describes the tones of the outputs when Config.Histogram
+	// is set
+	Histogram *Histogram
+	// Skew is the angle in degrees Config.Deskew turned the first image or
+	// page counter-clockwise by, 0 if it was straight
+	Skew float64
+	// Scrubbed lists the GPS tags Config.StripGPS removed from the EXIF
+	// data of the input before copying it into the outputs
+	Scrubbed []string
+	// Sidecars lists the sidecars of the input Config.CopySidecars copied
+	// next to OutputPath
+	Sidecars []string
+	// Skipped is set when Config.Existing kept the output of an earlier
+	// run. OutputPath and OutputSize describe that output and nothing was
+	// written.
+	Skipped bool
+	// Replaced is set when an output of an earlier run was overwritten
+	Replaced bool
+}
+
+// Outputs returns every file written for the input, its sidecars last
+func (r Result) Outputs() []string {
+	if len(r.Pages) > 0 {
+		return append(append([]string(nil), r.Pages...), r.Sidecars...)
+	}
+	return append([]string{r.OutputPath}, r.Sidecars...)
 }
 
 func ProcessImage(inputPath string, config Config) error {
-	// Load image
-	img, err := loadImage(inputPath)
+	config.KeepFormat = false
+	_, err := Process(inputPath, config)
+	return err
+}
+
+// ProcessImageWithSameFormat processes image and keeps the same format
+func ProcessImageWithSameFormat(inputPath string, config Config) error {
+	config.KeepFormat = true
+	_, err := Process(inputPath, config)
+	return err
+}
+
+// ErrOverwritesInput is returned when an output would replace its input
+// or, with Config.IsSource, another input of the run
+var ErrOverwritesInput = errors.New("output would overwrite the input file")
+
+// Process resizes a single image according to config and reports the
+// input and output files. The input is only ever opened read-only: Process
+// never writes, renames or removes it and refuses outputs that would
+// replace it with ErrOverwritesInput.
+func Process(inputPath string, config Config) (Result, error) {
+	result, err := process(inputPath, config)
+	if config.OnComplete != nil {
+		config.OnComplete(result, err)
+	}
+	return result, err
+}
+
+// process implements Process without OnComplete
+func process(inputPath string, config Config) (Result, error) {
+	result := Result{InputPath: inputPath}
+
+	info, err := os.Stat(inputPath)
 	if err != nil {
-		return err
+		return result, err
+	}
+	result.InputSize = info.Size()
+	if config.OnStart != nil {
+		config.OnStart(Event{InputPath: inputPath, InputSize: result.InputSize})
 	}
+	config.progress = newFileProgress(inputPath, result.InputSize, config.OnProgress, config.logger().Enabled(context.Background(), slog.LevelDebug))
 
-	// Resize image
-	img = resizeImage(img, config.MaxWidth, config.MaxHeight)
+	// Generate output path and pick the output format
+	var format string
+	result.OutputPath, format = outputPath(inputPath, config)
+	config.logger().Debug("Processing", "input", inputPath, "output", result.OutputPath, "format", format, "quality", config.Quality)
 
-	// Generate output path
-	outputPath := generateOutputPath(inputPath, config.OutputDir, config.OutputFormat)
+	// Never replace the source file, or another one of the run
+	if outInfo, err := os.Stat(result.OutputPath); err == nil && os.SameFile(info, outInfo) {
+		return result, ErrOverwritesInput
+	}
+	if config.IsSource != nil {
+		if config.IsSource(result.OutputPath) {
+			return result, ErrOverwritesInput
+		}
+		// Pages and mipmap levels are checked as they are written
+		before := config.BeforeWrite
+		config.BeforeWrite = func(outputPath string) error {
+			if config.IsSource(outputPath) {
+				return ErrOverwritesInput
+			}
+			if before != nil {
+				return before(outputPath)
+			}
+			return nil
+		}
+	}
 
-	// Save image
-	return saveImage(img, outputPath, config.OutputFormat, config.Quality)
+	// Check for an earlier output before decoding, so reruns are cheap
+	if existing, outInfo := existingOutput(result.OutputPath); outInfo != nil {
+		if config.Existing.keeps(info, outInfo) {
+			config.logger().Debug("Keeping existing output", "input", inputPath, "output", existing, "policy", config.Existing.String())
+			result.OutputPath, result.OutputSize, result.Skipped = existing, outInfo.Size(), true
+			return result, nil
+		}
+		result.Replaced = true
+	}
+
+	if config.StripMetadata {
+		config.KeepEXIF, config.KeepCatalog, config.ProcessingLog, config.ColorTag = false, false, false, ColorTagNone
+		config.Artist, config.Copyright, config.CopySidecars = "", "", false
+	}
+	config = sourceConfig(inputPath, config)
+	config.source = info
+	if config.Watermark != nil && config.Watermark.Text != "" {
+		config.Watermark = expandWatermark(config.Watermark, inputPath, takenTime(inputPath, info, config))
+	}
+
+	if config.Histogram {
+		result.Histogram = &Histogram{}
+		config.histogram = result.Histogram
+	}
+
+	if config.ProcessingLog {
+		config.log = &operationLog{}
+	}
+	config.size = &image.Point{}
+	config.skew = &result.Skew
+	config.scrubbed = &result.Scrubbed
+
+	pages, err := openPages(inputPath, config)
+	if err != nil {
+		return result, err
+	}
+	if _, ok := pages.(*spreadPages); ok {
+		// Spreads are split upright
+		config.orientation = 0
+	}
+
+	outputs := []string{result.OutputPath}
+	switch {
+	case config.Mipmaps != "":
+		if pages != nil {
+			pages.close()
+			return result, errMipmapPages
+		}
+		if outputs, err = processMipmaps(inputPath, result.OutputPath, format, config); err == nil && !isMipmapContainer(config.Mipmaps) {
+			result.OutputPath = outputs[0]
+			result.Pages = outputs
+		}
+	case pages != nil:
+		defer pages.close()
+		if comic, ok := pages.(*comicPages); ok {
+			err = processComic(comic, result.OutputPath, format, config)
+			break
+		}
+		// Pages go into one output when the format can hold them
+		if !canHoldPages(format) {
+			outputs = pagePaths(result.OutputPath, pages.count())
+			result.OutputPath = outputs[0]
+			result.Pages = outputs
+		}
+		err = processPages(pages, outputs, format, config)
+	case isAnimated(inputPath) && canAnimate(format):
+		// Animations keep all frames when written in a format that can animate
+		err = processAnimation(inputPath, result.OutputPath, format, config)
+	default:
+		err = processStill(inputPath, result.OutputPath, format, config)
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Width, result.Height = config.size.X, config.size.Y
+
+	config.progress.stage(StageFinish)
+	if err := tagOutputs(inputPath, outputs, format, config); err != nil {
+		return result, err
+	}
+	embeddable := canEmbedXMP(format) && !isComicArchive(inputPath)
+	if config.log != nil && !embeddable {
+		config.logger().Debug("Processing log not embedded, the format cannot hold XMP", "output", result.OutputPath, "format", format)
+	}
+	var catalog Catalog
+	if config.KeepCatalog && embeddable {
+		if catalog, err = ReadCatalog(inputPath); err != nil {
+			return result, err
+		}
+	}
+	// Before the XMP packet, so that it comes first
+	if !catalog.empty() && format == "jpg" {
+		for _, output := range outputs {
+			if err := embedIPTC(output, catalog); errors.Is(err, errIPTCSize) {
+				config.logger().Debug("IPTC records not written, they are too large for a JPEG segment", "output", output)
+			} else if err != nil {
+				return result, err
+			}
+		}
+	}
+	if (config.log != nil || !catalog.empty()) && embeddable {
+		var operations []string
+		if config.log != nil {
+			operations = append(config.log.operations, encodeOperation(format, config))
+		}
+		when := time.Now()
+		if config.Deterministic {
+			when = deterministicTime()
+		}
+		packet := outputXMP(catalog, operations, config.Software, when, config.CaptureTime)
+		for _, output := range outputs {
+			if err := embedXMP(output, format, packet); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// After the XMP packet, so that EXIF comes first
+	if (config.KeepEXIF && format == "jpg" || config.Artist != "" || config.Copyright != "") && !isComicArchive(inputPath) {
+		if err := writeEXIF(inputPath, outputs, format, config); err != nil {
+			return result, err
+		}
+	}
+
+	if config.StripMetadata && !isComicArchive(inputPath) {
+		for _, output := range outputs {
+			if err := checkStripped(output, format); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	for _, output := range outputs {
+		if err := finishOutput(output, config); err != nil {
+			return result, err
+		}
+		info, err := os.Stat(output)
+		if err != nil {
+			return result, err
+		}
+		result.OutputSize += info.Size()
+	}
+
+	if config.CopySidecars {
+		sidecars, err := copySidecars(inputPath, result.OutputPath, config)
+		result.Sidecars = sidecars
+		if err != nil {
+			return result, err
+		}
+	}
+
+	attrs := []any{"input", inputPath, "output", result.OutputPath, "width", result.Width, "height", result.Height, "output_size", result.OutputSize}
+	config.logger().Debug("Processed", append(attrs, config.progress.stageTimes()...)...)
+	return result, nil
 }
 
-// ProcessImageWithSameFormat processes image and keeps the same format
-func ProcessImageWithSameFormat(inputPath string, config Config) error {
+// OutputPath returns the path Process writes the output of inputPath to
+// with config. Inputs split into pages or mipmap levels are written to
+// numbered paths after it, such as doc_p001.jpg for doc.jpg.
+func OutputPath(inputPath string, config Config) string {
+	path, _ := outputPath(inputPath, config)
+	return path
+}
+
+// outputPath implements OutputPath and also returns the output format
+func outputPath(inputPath string, config Config) (string, string) {
+	var path string
+	format := config.OutputFormat
+	if config.KeepFormat {
+		path = generateOutputPathWithSameFormat(inputPath, config.OutputDir)
+		format = getImageFormat(inputPath)
+	} else {
+		path = generateOutputPath(inputPath, config.OutputDir, format)
+	}
+	if config.OutputName != "" {
+		path = renameOutputPath(path, config.OutputName)
+	}
+	if isComicArchive(inputPath) {
+		// Comic pages go back into a CBZ in the output format
+		path = comicOutputPath(path)
+	}
+	if isMipmapContainer(config.Mipmaps) {
+		// The chain goes into one texture in the container format
+		format = config.Mipmaps
+		path = strings.TrimSuffix(path, filepath.Ext(path)) + "." + format
+	}
+	return path, format
+}
+
+// sourceConfig adapts config to the input at path: tagged inputs keep
+// their pixels unless converted to sRGB, and the orientation and focal
+// point are found once, as they apply to every frame and page
+func sourceConfig(inputPath string, config Config) Config {
+	if config.ToSRGB {
+		config.embedded = embeddedProfile(inputPath)
+	}
+	if config.AssumeProfile != nil && hasEmbeddedProfile(inputPath) {
+		if config.embedded == nil {
+			config.logger().Debug("Keeping the embedded color profile", "input", inputPath)
+		}
+		config.AssumeProfile = nil
+	}
+	if config.AutoOrient {
+		config.orientation = readOrientation(inputPath)
+	}
+	if config.Fill && config.Focus == nil {
+		config.Focus, _ = readXMPFocus(inputPath)
+		if config.Focus == nil {
+			config.Focus = gravityFocus(config.Gravity)
+		}
+	}
+	return config
+}
+
+// processStill converts a single image
+func processStill(inputPath, outputPath, format string, config Config) error {
 	// Load image
-	img, err := loadImage(inputPath)
+	config.progress.stage(StageDecode)
+	img, err := loadInput(inputPath, config.progress, config.MaxPixels)
+	if err != nil {
+		return err
+	}
+	config.logger().Debug("Decoded", "input", inputPath, "width", img.Bounds().Dx(), "height", img.Bounds().Dy(), "pixels", fmt.Sprintf("%T", img))
+
+	config.progress.stage(StageTransform)
+	img, err = transformImage(img, config)
 	if err != nil {
 		return err
 	}
 
+	config.progress.stage(StageEncode)
+	if config.BeforeWrite != nil {
+		if err := config.BeforeWrite(outputPath); err != nil {
+			return err
+		}
+	}
+
+	// Save image
+	return saveImage(img, outputPath, format, config.Quality, config.Speed, config.Effort)
+}
+
+// transformImage converts, balances, crops, resizes, watermarks and
+// stamps img according to config
+func transformImage(img image.Image, config Config) (image.Image, error) {
+	var err error
+	var operations []string
+
+	// Turn the image upright
+	if config.orientation > 1 {
+		img = orient(img, config.orientation)
+		operations = append(operations, fmt.Sprintf("orient %d", config.orientation))
+	}
+
+	// Convert the embedded color profile
+	if config.embedded != nil {
+		img = convertToSRGB(img, config.embedded)
+		operations = append(operations, "convert-profile srgb")
+	}
+
+	// Assign the assumed color profile
+	if config.AssumeProfile != nil {
+		img = convertToSRGB(img, config.AssumeProfile)
+		operations = append(operations, "assume-profile "+config.AssumeProfile.Name)
+	}
+
+	// Neutralize the color cast
+	if config.WhiteBalance != nil {
+		if img, err = applyWhiteBalance(img, config.WhiteBalance); err != nil {
+			return nil, err
+		}
+		operations = append(operations, whiteBalanceOperation(config.WhiteBalance))
+	}
+
+	// Straighten and clean up the page
+	if config.Document != "" {
+		var operation string
+		img, operation = processDocument(img, config.Document)
+		operations = append(operations, operation)
+	}
+
+	// Straighten the lines of text
+	if config.Deskew {
+		angle := findSkew(img)
+		if angle != 0 {
+			img = deskew(img, angle)
+			operations = append(operations, fmt.Sprintf("deskew %.2f", angle))
+		}
+		if config.skew != nil && config.size != nil && *config.size == (image.Point{}) {
+			*config.skew = angle
+		}
+	}
+
+	// Find the focal point in source pixels
+	var focus image.Point
+	if config.Fill {
+		if config.Focus == nil {
+			config.Focus = smartFocalPoint(img, config)
+		}
+		bounds := img.Bounds()
+		focus = image.Pt(bounds.Min.X+int(config.Focus.X*float64(bounds.Dx())), bounds.Min.Y+int(config.Focus.Y*float64(bounds.Dy())))
+	}
+
+	// Crop image
+	if !config.Crop.Empty() {
+		origin := img.Bounds().Min
+		img, err = cropImage(img, config.Crop)
+		if err != nil {
+			return nil, err
+		}
+		focus = focus.Sub(origin.Add(config.Crop.Min)).Add(img.Bounds().Min)
+		operations = append(operations, fmt.Sprintf("crop %d,%d,%d,%d", config.Crop.Min.X, config.Crop.Min.Y, config.Crop.Dx(), config.Crop.Dy()))
+	}
+
+	// Crop to the target aspect ratio around the focal point
+	if config.Fill {
+		img = fillCrop(img, config.MaxWidth, config.MaxHeight, focus)
+		operations = append(operations, fmt.Sprintf("fill %dx%d focus %.2f,%.2f", config.MaxWidth, config.MaxHeight, config.Focus.X, config.Focus.Y))
+	}
+
+	// Remove the least noticeable seams down to the target aspect ratio
+	if config.Carve {
+		target := carveTarget(img.Bounds().Size(), config.MaxWidth, config.MaxHeight, config.Upscale)
+		if img.Bounds().Size() != target {
+			img = carveImage(img, target, config.LinearResize)
+			operations = append(operations, fmt.Sprintf("carve %dx%d", target.X, target.Y))
+		}
+	}
+
 	// Resize image
-	img = resizeImage(img, config.MaxWidth, config.MaxHeight)
+	before := img.Bounds().Size()
+	img = resizeImage(img, config)
+	if after := img.Bounds().Size(); after != before {
+		operation := fmt.Sprintf("resize %dx%d to %dx%d", before.X, before.Y, after.X, after.Y)
+		switch config.resizeMode() {
+		case modeStretch:
+			operation += " stretch"
+		case modePad:
+			operation += " pad"
+		}
+		if config.LinearResize {
+			operation += " linear"
+		}
+		operations = append(operations, operation)
+	}
+
+	// Composite the watermark at the output size, so that it stays sharp
+	if config.Watermark != nil {
+		if img, err = applyWatermark(img, config.Watermark); err != nil {
+			return nil, err
+		}
+		operations = append(operations, "watermark "+config.Watermark.Name)
+	}
 
-	// Generate output path with same format
-	outputPath := generateOutputPathWithSameFormat(inputPath, config.OutputDir)
+	// Adjust the tones for the screen
+	if config.Contrast != 0 {
+		img = imaging.AdjustContrast(img, config.Contrast)
+		operations = append(operations, fmt.Sprintf("contrast %g", config.Contrast))
+	}
+	if config.Grayscale || config.Dither != "" {
+		img = grayscale(img)
+		operations = append(operations, "grayscale")
+	}
 
-	// Get original format
-	format := getImageFormat(inputPath)
+	// Burn in text
+	if config.StampText != "" {
+		img, err = stampText(img, config.StampText)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, "stamp")
+	}
 
-	// Save image
-	return saveImage(img, outputPath, format, config.Quality)
+	// Reduce the shades last, so that they are exactly those of the screen
+	if config.Dither != "" {
+		img = dither(grayscale(img), config.Dither, config.grayLevels())
+		operations = append(operations, fmt.Sprintf("dither %s %d", config.Dither, config.grayLevels()))
+	}
+
+	config.log.record(operations)
+	config.histogram.add(img)
+	if config.size != nil && *config.size == (image.Point{}) {
+		*config.size = img.Bounds().Size()
+	}
+	return img, nil
+}
+
+// finishOutput applies post-save adjustments to a written output file
+func finishOutput(outputPath string, config Config) error {
+	preserve := config.PreserveAttrs && config.source != nil
+	mode := config.Mode
+	if mode == 0 && preserve {
+		mode = config.source.Mode().Perm()
+	}
+	if mode != 0 {
+		if err := os.Chmod(outputPath, mode); err != nil {
+			return err
+		}
+	}
+	if config.Owner != nil {
+		if err := os.Chown(outputPath, config.Owner.UID, config.Owner.GID); err != nil {
+			return err
+		}
+	}
+	switch {
+	case !config.CaptureTime.IsZero():
+		return os.Chtimes(outputPath, config.CaptureTime, config.CaptureTime)
+	case preserve:
+		return os.Chtimes(outputPath, accessTime(config.source), config.source.ModTime())
+	case config.Deterministic:
+		mtime := deterministicTime()
+		return os.Chtimes(outputPath, mtime, mtime)
+	}
+	return nil
+}
+
+// deterministicTime returns the timestamp used for outputs in deterministic
+// mode: SOURCE_DATE_EPOCH when set, otherwise the Unix epoch
+func deterministicTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Unix(0, 0).UTC()
 }
 
+// maxPixels bounds the size an image may declare before it is decoded, so
+// that a corrupt header fails instead of exhausting memory. The frames of an
+// animation count together.
+var maxPixels = 1 << 28
+
+// ErrTooManyPixels is returned for images, pages or animations declaring
+// more pixels than Config.MaxPixels allows
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+// checkPixels returns an error if an image of width by height pixels is
+// empty or larger than limit, or than maxPixels if limit is 0 or above it
+func checkPixels(width, height int, limit int64) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+	if limit <= 0 || limit > int64(maxPixels) {
+		limit = int64(maxPixels)
+	}
+	if int64(width)*int64(height) > limit {
+		return fmt.Errorf("%w: image size %dx%d exceeds the limit of %d pixels", ErrTooManyPixels, width, height, limit)
+	}
+	return nil
+}
+
+// decodeConfigured checks the size in the header of r against limit
+// before decoding it with decode
+func decodeConfigured(r io.ReadSeeker, decodeConfig func(io.Reader) (image.Config, error), decode func(io.Reader) (image.Image, error), limit int64) (image.Image, error) {
+	cfg, err := decodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPixels(cfg.Width, cfg.Height, limit); err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return decode(r)
+}
+
+// loadImage decodes the image at path, which is opened read-only
 func loadImage(path string) (image.Image, error) {
+	return loadInput(path, nil, 0)
+}
+
+// loadInput decodes the image at path like loadImage, reporting the bytes
+// read to progress and failing for images of more than limit pixels
+func loadInput(path string, progress *fileProgress, limit int64) (image.Image, error) {
+	file, err := openInput(path, progress)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
 	ext := filepath.Ext(strings.ToLower(path))
-	if ext == ".heic" || ext == ".heif" {
-		// Handle HEIC/HEIF format
-		file, err := os.Open(path)
+	if ext == ".webp" {
+		if isAnimated(path) {
+			// The WebP decoder reads stills only, use the first frame
+			anim, err := decodeAnimation(path, progress, limit)
+			if err != nil {
+				return nil, err
+			}
+			return anim.frames[0], nil
+		}
+		// Not image.Decode: the decoder the libwebp encoder registers
+		// returns straight alpha as premultiplied RGBA
+		return decodeConfigured(file, xwebp.DecodeConfig, xwebp.Decode, limit)
+	}
+	if ext == ".heic" || ext == ".heif" || ext == ".avif" {
+		// Handle HEIC/HEIF and AVIF, which share the HEIF container
+		data, err := io.ReadAll(file)
 		if err != nil {
 			return nil, err
 		}
-		defer file.Close()
+		if len(data) == 0 {
+			return nil, errors.New("empty HEIF file")
+		}
 
 		// Create a new context
 		ctx, err := heif.NewContext()
@@ -75,7 +864,7 @@ func loadImage(path string) (image.Image, error) {
 		}
 
 		// Read the file into the context
-		err = ctx.ReadFromFile(path)
+		err = ctx.ReadFromMemory(data)
 		if err != nil {
 			return nil, err
 		}
@@ -85,29 +874,57 @@ func loadImage(path string) (image.Image, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := checkPixels(hdl.GetWidth(), hdl.GetHeight(), limit); err != nil {
+			return nil, err
+		}
 
-		// Decode the image
-		img, err := hdl.DecodeImage(heif.ColorspaceUndefined, heif.ChromaUndefined, nil)
+		// Decode the image, as RGBA when it has alpha
+		colorspace, chroma := heif.Colorspace(heif.ColorspaceUndefined), heif.Chroma(heif.ChromaUndefined)
+		if hdl.HasAlphaChannel() {
+			colorspace, chroma = heif.ColorspaceRGB, heif.ChromaInterleavedRGBA
+		}
+		img, err := hdl.DecodeImage(colorspace, chroma, nil)
 		if err != nil {
 			return nil, err
 		}
 
-		// Convert to go image
-		return img.GetImage()
+		// Convert to go image. libheif's alpha is straight, not
+		// premultiplied as image.RGBA holds it.
+		decoded, err := img.GetImage()
+		if rgba, ok := decoded.(*image.RGBA); ok && hdl.HasAlphaChannel() {
+			return &image.NRGBA{Pix: rgba.Pix, Stride: rgba.Stride, Rect: rgba.Rect}, nil
+		}
+		return decoded, err
 	}
 
-	// Handle other common formats
-	return imaging.Open(path)
+	// Handle other common formats. TIFF is read from the file itself: through
+	// image.Decode its decoder buffers up to any offset a directory names.
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(file, header); err == nil && isTIFF(header) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return decodeConfigured(file, tiff.DecodeConfig, tiff.Decode, limit)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return decodeConfigured(file, func(r io.Reader) (image.Config, error) {
+		cfg, _, err := image.DecodeConfig(r)
+		return cfg, err
+	}, func(r io.Reader) (image.Image, error) {
+		return imaging.Decode(r)
+	}, limit)
 }
 
-func resizeImage(img image.Image, maxWidth, maxHeight int) image.Image {
-	bounds := img.Bounds()
-	width := bounds.Max.X - bounds.Min.X
-	height := bounds.Max.Y - bounds.Min.Y
+// fitSize returns the size an image of size is shrunk to, to fit within
+// maxWidth x maxHeight
+func fitSize(size image.Point, maxWidth, maxHeight int) image.Point {
+	width, height := size.X, size.Y
 
 	// If the image is already smaller than the maximum size, no adjustment is made
 	if width <= maxWidth && height <= maxHeight {
-		return img
+		return size
 	}
 
 	// Calculate scaling ratio
@@ -125,7 +942,18 @@ func resizeImage(img image.Image, maxWidth, maxHeight int) image.Image {
 	newWidth := int(float64(width) * scale)
 	newHeight := int(float64(height) * scale)
 
-	return imaging.Resize(img, newWidth, newHeight, imaging.Lanczos)
+	return image.Pt(newWidth, newHeight)
+}
+
+// cropImage returns the part of img inside rect, given relative to the
+// image's top-left corner
+func cropImage(img image.Image, rect image.Rectangle) (image.Image, error) {
+	bounds := img.Bounds()
+	rect = rect.Add(bounds.Min).Intersect(bounds)
+	if rect.Empty() {
+		return nil, fmt.Errorf("crop rectangle lies outside the %dx%d image", bounds.Dx(), bounds.Dy())
+	}
+	return imaging.Crop(img, rect), nil
 }
 
 func generateOutputPath(inputPath, outputDir, format string) string {
@@ -139,6 +967,18 @@ func generateOutputPath(inputPath, outputDir, format string) string {
 		newExt = ".jpg"
 	case "png":
 		newExt = ".png"
+	case "avif":
+		newExt = ".avif"
+	case "heic":
+		newExt = ".heic"
+	case "gif":
+		newExt = ".gif"
+	case "webp":
+		newExt = ".webp"
+	case "tiff":
+		newExt = ".tiff"
+	case "jxl":
+		newExt = ".jxl"
 	default:
 		newExt = ".jpg"
 	}
@@ -152,6 +992,11 @@ func generateOutputPathWithSameFormat(inputPath, outputDir string) string {
 	return filepath.Join(outputDir, filename)
 }
 
+// renameOutputPath replaces the file name of path, keeping directory and extension
+func renameOutputPath(path, name string) string {
+	return filepath.Join(filepath.Dir(path), name+filepath.Ext(path))
+}
+
 // getImageFormat determines the image format from file extension
 func getImageFormat(path string) string {
 	ext := filepath.Ext(strings.ToLower(path))
@@ -165,6 +1010,14 @@ func getImageFormat(path string) string {
 		return "bmp"
 	case ".tiff", ".tif":
 		return "tiff"
+	case ".avif":
+		return "avif"
+	case ".gif":
+		return "gif"
+	case ".webp":
+		return "webp"
+	case ".jxl":
+		return "jxl"
 	case ".heic", ".heif":
 		return "jpg" // Convert HEIC to JPG by default
 	default:
@@ -172,7 +1025,17 @@ func getImageFormat(path string) string {
 	}
 }
 
-func saveImage(img image.Image, path, format string, quality int) error {
+func saveImage(img image.Image, path, format string, quality, speed, effort int) error {
+	// libheif writes the file itself
+	switch format {
+	case "avif":
+		return encodeAVIF(img, path, quality, speed)
+	case "heic":
+		return encodeHEIC(img, path, quality)
+	case "gif", "webp":
+		return encodeAnimation(&animation{frames: []image.Image{img}, delays: []time.Duration{0}}, path, format, quality)
+	}
+
 	file, err := os.Create(path)
 	if err != nil {
 		return err
@@ -183,7 +1046,13 @@ func saveImage(img image.Image, path, format string, quality int) error {
 	case "jpg":
 		options := &jpeg.Options{Quality: quality}
 		return jpeg.Encode(file, img, options)
+	case "tiff":
+		return encodeTIFF(file, []image.Image{img})
+	case "jxl":
+		return encodeJXL(file, img, quality, effort)
 	case "png":
+		// The standard encoders write no timestamps, and fixed settings keep
+		// the output stable across runs
 		encoder := png.Encoder{CompressionLevel: png.DefaultCompression}
 		return encoder.Encode(file, img)
 	default:
@@ -191,3 +1060,45 @@ func saveImage(img image.Image, path, format string, quality int) error {
 		return jpeg.Encode(file, img, options)
 	}
 }
+
+// InputExtensions returns the lower-case file extensions that can be
+// processed: images and comic archives
+func InputExtensions() []string {
+	return append(append([]string(nil), inputExtensions...), comicExtensions...)
+}
+
+// ComicExtensions returns the lower-case file extensions of comic
+// archives, which InputExtensions includes
+func ComicExtensions() []string {
+	return append([]string(nil), comicExtensions...)
+}
+
+// OutputFormats returns the formats that can be encoded
+func OutputFormats() []string {
+	return append([]string(nil), outputFormats...)
+}
+
+// IsSupportedOutputFormat reports whether format can be encoded
+func IsSupportedOutputFormat(format string) bool {
+	for _, f := range outputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// HeifVersion returns the version of the linked libheif library
+func HeifVersion() string {
+	return heif.GetVersion()
+}
+
+// Thumbnail loads the image at path, upright as viewers show it, and
+// scales it to fit within size x size
+func Thumbnail(path string, size int) (image.Image, error) {
+	img, err := loadImage(path)
+	if err != nil {
+		return nil, err
+	}
+	return resizeImage(orient(img, readOrientation(path)), Config{MaxWidth: size, MaxHeight: size}), nil
+}
@@ -1,11 +1,16 @@
 package processor
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
 	"image"
 	"image/color"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/disintegration/imaging"
 )
@@ -25,6 +30,10 @@ func TestGetImageFormat(t *testing.T) {
 		{"test.tif", "tiff"},
 		{"test.heic", "jpg"},
 		{"test.heif", "jpg"},
+		{"test.avif", "avif"},
+		{"test.webp", "webp"},
+		{"test.gif", "gif"},
+		{"test.jxl", "jxl"},
 		{"test.unknown", "jpg"},
 		{"test", "jpg"},
 	}
@@ -85,7 +94,7 @@ func TestResizeImage(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			result := resizeImage(img, test.maxWidth, test.maxHeight)
+			result := resizeImage(img, Config{MaxWidth: test.maxWidth, MaxHeight: test.maxHeight})
 
 			bounds := result.Bounds()
 			width := bounds.Max.X - bounds.Min.X
@@ -100,6 +109,66 @@ func TestResizeImage(t *testing.T) {
 	}
 }
 
+func TestUpscaleImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+
+	tests := []struct {
+		name      string
+		maxWidth  int
+		maxHeight int
+		exact     bool
+		expected  image.Point
+	}{
+		{"Enlarged to fit", 400, 400, false, image.Pt(400, 200)},
+		{"Reduced to fit", 40, 40, false, image.Pt(40, 20)},
+		{"Already fits", 100, 80, false, image.Pt(100, 50)},
+		{"Exact", 1921, 1080, true, image.Pt(1921, 1080)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{MaxWidth: test.maxWidth, MaxHeight: test.maxHeight, Fill: test.exact, Upscale: true}
+			if size := resizeImage(img, config).Bounds().Size(); size != test.expected {
+				t.Errorf("resizeImage() size = %v, expected %v", size, test.expected)
+			}
+		})
+	}
+}
+
+func TestCropImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+
+	tests := []struct {
+		name        string
+		rect        image.Rectangle
+		expWidth    int
+		expHeight   int
+		expectError bool
+	}{
+		{"Inside", image.Rect(10, 10, 40, 30), 30, 20, false},
+		{"Clipped to bounds", image.Rect(80, 40, 200, 200), 20, 10, false},
+		{"Outside", image.Rect(200, 200, 300, 300), 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := cropImage(img, test.rect)
+			if test.expectError {
+				if err == nil {
+					t.Error("cropImage() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cropImage() error = %v", err)
+			}
+			if result.Bounds().Dx() != test.expWidth || result.Bounds().Dy() != test.expHeight {
+				t.Errorf("cropImage() size = %dx%d, expected %dx%d", result.Bounds().Dx(), result.Bounds().Dy(), test.expWidth, test.expHeight)
+			}
+		})
+	}
+}
+
 func TestGenerateOutputPath(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -124,6 +193,41 @@ func TestGenerateOutputPath(t *testing.T) {
 			format:    "png",
 			expected:  filepath.Join(tempDir, "image.png"),
 		},
+		{
+			name:      "AVIF format conversion",
+			inputPath: "/path/to/image.heic",
+			outputDir: tempDir,
+			format:    "avif",
+			expected:  filepath.Join(tempDir, "image.avif"),
+		},
+		{
+			name:      "HEIC format conversion",
+			inputPath: "/path/to/image.jpg",
+			outputDir: tempDir,
+			format:    "heic",
+			expected:  filepath.Join(tempDir, "image.heic"),
+		},
+		{
+			name:      "GIF format conversion",
+			inputPath: "/path/to/image.jpg",
+			outputDir: tempDir,
+			format:    "gif",
+			expected:  filepath.Join(tempDir, "image.gif"),
+		},
+		{
+			name:      "WebP format conversion",
+			inputPath: "/path/to/image.png",
+			outputDir: tempDir,
+			format:    "webp",
+			expected:  filepath.Join(tempDir, "image.webp"),
+		},
+		{
+			name:      "JPEG XL format conversion",
+			inputPath: "/path/to/image.png",
+			outputDir: tempDir,
+			format:    "jxl",
+			expected:  filepath.Join(tempDir, "image.jxl"),
+		},
 		{
 			name:      "Complex path",
 			inputPath: "/very/complex/path/to/my/image.jpeg",
@@ -176,6 +280,14 @@ func TestGenerateOutputPathWithSameFormat(t *testing.T) {
 	}
 }
 
+func TestRenameOutputPath(t *testing.T) {
+	result := renameOutputPath(filepath.Join("out", "IMG_0001.jpg"), "a1b2c3")
+	expected := filepath.Join("out", "a1b2c3.jpg")
+	if result != expected {
+		t.Errorf("renameOutputPath() = %s, expected %s", result, expected)
+	}
+}
+
 func TestSaveImage(t *testing.T) {
 	// Create a test image
 	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
@@ -204,6 +316,31 @@ func TestSaveImage(t *testing.T) {
 			format: "png",
 			path:   filepath.Join(tempDir, "test.png"),
 		},
+		{
+			name:   "Save AVIF",
+			format: "avif",
+			path:   filepath.Join(tempDir, "test.avif"),
+		},
+		{
+			name:   "Save HEIC",
+			format: "heic",
+			path:   filepath.Join(tempDir, "test.heic"),
+		},
+		{
+			name:   "Save GIF",
+			format: "gif",
+			path:   filepath.Join(tempDir, "test.gif"),
+		},
+		{
+			name:   "Save WebP",
+			format: "webp",
+			path:   filepath.Join(tempDir, "test.webp"),
+		},
+		{
+			name:   "Save TIFF",
+			format: "tiff",
+			path:   filepath.Join(tempDir, "test.tiff"),
+		},
 		{
 			name:   "Default format",
 			format: "unknown",
@@ -213,7 +350,7 @@ func TestSaveImage(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			err := saveImage(img, test.path, test.format, 90)
+			err := saveImage(img, test.path, test.format, 90, 0, 0)
 			if err != nil {
 				t.Errorf("saveImage() error = %v", err)
 				return
@@ -319,9 +456,457 @@ func TestProcessImageWithSameFormat(t *testing.T) {
 	}
 }
 
+func TestLoadWebPAndAVIF(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A 1x1 lossless WebP
+	webpData, err := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	if err != nil {
+		t.Fatalf("Failed to decode WebP fixture: %v", err)
+	}
+	webpPath := filepath.Join(tempDir, "pixel.webp")
+	if err := os.WriteFile(webpPath, webpData, 0644); err != nil {
+		t.Fatalf("Failed to write WebP fixture: %v", err)
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			src.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), 100, 255})
+		}
+	}
+	avifPath := filepath.Join(tempDir, "photo.avif")
+	if err := saveImage(src, avifPath, "avif", 80, 0, 0); err != nil {
+		t.Fatalf("Failed to write AVIF fixture: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		width  int
+		height int
+	}{
+		{webpPath, 1, 1},
+		{avifPath, 64, 48},
+	}
+
+	for _, test := range tests {
+		t.Run(filepath.Base(test.path), func(t *testing.T) {
+			img, err := loadImage(test.path)
+			if err != nil {
+				t.Fatalf("loadImage() error = %v", err)
+			}
+			if img.Bounds().Dx() != test.width || img.Bounds().Dy() != test.height {
+				t.Errorf("loadImage() size = %v, expected %dx%d", img.Bounds().Size(), test.width, test.height)
+			}
+		})
+	}
+
+	// Kept WebP files are written as WebP
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	result, err := Process(webpPath, Config{KeepFormat: true, MaxWidth: 10, MaxHeight: 10, Quality: 90, OutputDir: outputDir})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if result.OutputPath != filepath.Join(outputDir, "pixel.webp") {
+		t.Errorf("Process() output = %s, expected pixel.webp", result.OutputPath)
+	}
+}
+
 func TestLoadImageInvalidPath(t *testing.T) {
 	_, err := loadImage("/nonexistent/path/image.jpg")
 	if err == nil {
 		t.Error("loadImage() expected error for invalid path, got nil")
 	}
 }
+
+func TestLoadImageTooLarge(t *testing.T) {
+	saved := maxPixels
+	maxPixels = 50
+	defer func() { maxPixels = saved }()
+
+	dir := t.TempDir()
+	for _, ext := range []string{".png", ".jpg", ".webp", ".tiff", ".gif", ".heic"} {
+		path := filepath.Join(dir, "large"+ext)
+		if err := encodeWith(fuzzImage, ext[1:])(path); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		_, err := loadImage(path)
+		if err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+			t.Errorf("loadImage(%s) error = %v, expected size limit error", ext, err)
+		}
+	}
+}
+
+func TestIsSupportedOutputFormat(t *testing.T) {
+	for _, format := range OutputFormats() {
+		if !IsSupportedOutputFormat(format) {
+			t.Errorf("IsSupportedOutputFormat(%s) = false, expected true", format)
+		}
+	}
+	if IsSupportedOutputFormat("xyz") {
+		t.Error("IsSupportedOutputFormat(xyz) = true, expected false")
+	}
+}
+
+func TestDeterministicOutput(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 2), uint8(y * 3), uint8(x + y), 255})
+		}
+	}
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.png")
+	if err := imaging.Save(img, inputPath); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	for _, format := range []string{"jpg", "png"} {
+		t.Run(format, func(t *testing.T) {
+			var outputs [][]byte
+			for run := 0; run < 2; run++ {
+				outputDir := filepath.Join(tempDir, format, string(rune('a'+run)))
+				if err := os.MkdirAll(outputDir, 0755); err != nil {
+					t.Fatalf("Failed to create output directory: %v", err)
+				}
+
+				config := Config{OutputFormat: format, MaxWidth: 60, MaxHeight: 60, Quality: 85, OutputDir: outputDir, Deterministic: true}
+				if err := ProcessImage(inputPath, config); err != nil {
+					t.Fatalf("ProcessImage() error = %v", err)
+				}
+
+				outputPath := filepath.Join(outputDir, "input."+format)
+				data, err := os.ReadFile(outputPath)
+				if err != nil {
+					t.Fatalf("Failed to read output: %v", err)
+				}
+				outputs = append(outputs, data)
+
+				info, err := os.Stat(outputPath)
+				if err != nil {
+					t.Fatalf("Failed to stat output: %v", err)
+				}
+				if info.ModTime().Unix() != 1700000000 {
+					t.Errorf("output mtime = %d, expected 1700000000", info.ModTime().Unix())
+				}
+			}
+
+			if string(outputs[0]) != string(outputs[1]) {
+				t.Error("deterministic runs produced different output bytes")
+			}
+		})
+	}
+}
+
+func TestCaptureTimeOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.png")
+	if err := imaging.Save(image.NewRGBA(image.Rect(0, 0, 40, 30)), inputPath); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	// The capture time replaces the deterministic modification time
+	captured := time.Date(2024, 5, 1, 9, 30, 0, 0, time.FixedZone("+08:00", 8*3600))
+	config := Config{OutputFormat: "png", MaxWidth: 60, MaxHeight: 60, Quality: 85, OutputDir: filepath.Join(tempDir, "out"), Deterministic: true, CaptureTime: captured}
+	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	result, err := Process(inputPath, config)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	info, err := os.Stat(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat output: %v", err)
+	}
+	if !info.ModTime().Equal(captured) {
+		t.Errorf("output mtime = %v, expected %v", info.ModTime(), captured)
+	}
+}
+
+func TestExistingPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ExistingPolicy
+		// age of the existing output relative to the input
+		age  time.Duration
+		kept bool
+	}{
+		{"Overwrite", ExistingOverwrite, time.Hour, false},
+		{"Skip older output", ExistingSkip, -time.Hour, true},
+		{"Skip newer output", ExistingSkip, time.Hour, true},
+		{"If newer with older output", ExistingIfNewer, -time.Hour, false},
+		{"If newer with newer output", ExistingIfNewer, time.Hour, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.png")
+			if err := imaging.Save(image.NewRGBA(image.Rect(0, 0, 40, 30)), inputPath); err != nil {
+				t.Fatalf("Failed to save test image: %v", err)
+			}
+			info, err := os.Stat(inputPath)
+			if err != nil {
+				t.Fatalf("Failed to stat input: %v", err)
+			}
+
+			// An earlier output that is not even an image, so keeping it
+			// shows the input was never decoded into it
+			outputPath := filepath.Join(tempDir, "input.jpg")
+			if err := os.WriteFile(outputPath, []byte("old"), 0644); err != nil {
+				t.Fatalf("Failed to write existing output: %v", err)
+			}
+			when := info.ModTime().Add(test.age)
+			if err := os.Chtimes(outputPath, when, when); err != nil {
+				t.Fatalf("Failed to set output time: %v", err)
+			}
+
+			result, err := Process(inputPath, Config{OutputFormat: "jpg", MaxWidth: 60, MaxHeight: 60, Quality: 85, OutputDir: tempDir, Existing: test.policy})
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			data, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if kept := string(data) == "old"; kept != test.kept {
+				t.Errorf("output kept = %t, expected %t", kept, test.kept)
+			}
+			if result.Skipped != test.kept || result.Replaced == test.kept {
+				t.Errorf("Process() Skipped = %t, Replaced = %t with kept %t", result.Skipped, result.Replaced, test.kept)
+			}
+			if test.kept && result.OutputSize != 3 {
+				t.Errorf("Process() OutputSize = %d, expected the existing 3 bytes", result.OutputSize)
+			}
+		})
+	}
+}
+
+func TestProcessResult(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.png")
+	if err := imaging.Save(img, inputPath); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	result, err := Process(inputPath, Config{OutputFormat: "jpg", MaxWidth: 50, MaxHeight: 50, Quality: 90, OutputDir: outputDir})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if result.OutputPath != filepath.Join(outputDir, "input.jpg") {
+		t.Errorf("Process() OutputPath = %s, expected %s", result.OutputPath, filepath.Join(outputDir, "input.jpg"))
+	}
+	if result.InputSize <= 0 || result.OutputSize <= 0 {
+		t.Errorf("Process() sizes = %d -> %d, expected both positive", result.InputSize, result.OutputSize)
+	}
+	if result.Width != 50 || result.Height != 50 {
+		t.Errorf("Process() dimensions = %dx%d, expected 50x50", result.Width, result.Height)
+	}
+
+	result, err = Process(inputPath, Config{OutputFormat: "jpg", MaxWidth: 50, MaxHeight: 50, Quality: 90, OutputDir: outputDir, KeepFormat: true})
+	if err != nil {
+		t.Fatalf("Process() with KeepFormat error = %v", err)
+	}
+	if result.OutputPath != filepath.Join(outputDir, "input.png") {
+		t.Errorf("Process() with KeepFormat OutputPath = %s, expected %s", result.OutputPath, filepath.Join(outputDir, "input.png"))
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "input.png")
+	if err := imaging.Save(image.NewRGBA(image.Rect(0, 0, 400, 200)), inputPath); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	thumb, err := Thumbnail(inputPath, 100)
+	if err != nil {
+		t.Fatalf("Thumbnail() error = %v", err)
+	}
+	if thumb.Bounds().Dx() != 100 || thumb.Bounds().Dy() != 50 {
+		t.Errorf("Thumbnail() size = %dx%d, expected 100x50", thumb.Bounds().Dx(), thumb.Bounds().Dy())
+	}
+}
+
+func TestProcessLeavesInputUntouched(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+
+	tests := []struct {
+		name        string
+		input       string
+		config      Config
+		expectError error
+	}{
+		{"Convert to other directory", "input.png", Config{OutputFormat: "jpg", OutputDir: "output"}, nil},
+		{"Keep format in other directory", "input.png", Config{KeepFormat: true, OutputDir: "output"}, nil},
+		{"Keep format in input directory", "input.png", Config{KeepFormat: true}, ErrOverwritesInput},
+		{"Convert to same name", "input.jpg", Config{OutputFormat: "jpg"}, ErrOverwritesInput},
+		{"Rename onto input", "input.png", Config{OutputFormat: "png", OutputName: "input"}, ErrOverwritesInput},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, test.input)
+			if err := imaging.Save(img, inputPath); err != nil {
+				t.Fatalf("Failed to save test image: %v", err)
+			}
+			// Inputs on read-only media must still be processed
+			if err := os.Chmod(inputPath, 0444); err != nil {
+				t.Fatalf("Failed to make input read-only: %v", err)
+			}
+			mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			if err := os.Chtimes(inputPath, mtime, mtime); err != nil {
+				t.Fatalf("Failed to set input time: %v", err)
+			}
+			before, err := os.ReadFile(inputPath)
+			if err != nil {
+				t.Fatalf("Failed to read input: %v", err)
+			}
+
+			config := test.config
+			config.MaxWidth, config.MaxHeight, config.Quality = 50, 50, 90
+			config.OutputDir = filepath.Join(tempDir, config.OutputDir)
+			if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+				t.Fatalf("Failed to create output directory: %v", err)
+			}
+
+			_, err = Process(inputPath, config)
+			if !errors.Is(err, test.expectError) {
+				t.Fatalf("Process() error = %v, expected %v", err, test.expectError)
+			}
+
+			after, err := os.ReadFile(inputPath)
+			if err != nil {
+				t.Fatalf("Input is gone after Process(): %v", err)
+			}
+			if !bytes.Equal(before, after) {
+				t.Error("Process() changed the content of the input")
+			}
+			info, err := os.Stat(inputPath)
+			if err != nil {
+				t.Fatalf("Failed to stat input: %v", err)
+			}
+			if !info.ModTime().Equal(mtime) || info.Mode().Perm() != 0444 {
+				t.Errorf("Process() changed the input to %v %v, expected %v %v", info.ModTime(), info.Mode().Perm(), mtime, os.FileMode(0444))
+			}
+		})
+	}
+}
+
+func TestProcessLeavesOtherSourcesUntouched(t *testing.T) {
+	tempDir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	pngPath, jpgPath := filepath.Join(tempDir, "a.png"), filepath.Join(tempDir, "a.jpg")
+	for _, path := range []string{pngPath, jpgPath} {
+		if err := imaging.Save(img, path); err != nil {
+			t.Fatalf("Failed to save test image: %v", err)
+		}
+	}
+	before, err := os.ReadFile(jpgPath)
+	if err != nil {
+		t.Fatalf("Failed to read input: %v", err)
+	}
+
+	// a.png converts to a.jpg, another input of the run, whatever the
+	// existing-output policy says
+	for _, policy := range []ExistingPolicy{ExistingOverwrite, ExistingSkip} {
+		config := Config{OutputFormat: "jpg", MaxWidth: 50, MaxHeight: 50, Quality: 90, OutputDir: tempDir, Existing: policy}
+		config.IsSource = func(path string) bool { return path == jpgPath || path == pngPath }
+		if _, err := Process(pngPath, config); !errors.Is(err, ErrOverwritesInput) {
+			t.Errorf("Process() with %v error = %v, expected %v", policy, err, ErrOverwritesInput)
+		}
+	}
+
+	after, err := os.ReadFile(jpgPath)
+	if err != nil {
+		t.Fatalf("Input is gone after Process(): %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("Process() changed the content of another input")
+	}
+}
+
+func TestFinishOutputPermissions(t *testing.T) {
+	tempDir := t.TempDir()
+	outputPath := filepath.Join(tempDir, "output.jpg")
+	if err := os.WriteFile(outputPath, []byte("data"), 0600); err != nil {
+		t.Fatalf("Failed to write output: %v", err)
+	}
+
+	owner := &Owner{UID: os.Getuid(), GID: os.Getgid()}
+	if err := finishOutput(outputPath, Config{Mode: 0644, Owner: owner}); err != nil {
+		t.Fatalf("finishOutput() error = %v", err)
+	}
+
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat output: %v", err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("finishOutput() mode = %v, expected %v", info.Mode().Perm(), os.FileMode(0644))
+	}
+}
+
+func TestPreserveAttrs(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "photo.png")
+	if err := imaging.Save(image.NewNRGBA(image.Rect(0, 0, 20, 10)), inputPath); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+	if err := os.Chmod(inputPath, 0640); err != nil {
+		t.Fatalf("Failed to change input mode: %v", err)
+	}
+	atime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(inputPath, atime, mtime); err != nil {
+		t.Fatalf("Failed to set input time: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		mode   os.FileMode
+		mtime  time.Time
+	}{
+		{"Input attributes", Config{PreserveAttrs: true}, 0640, mtime},
+		{"Mode wins", Config{PreserveAttrs: true, Mode: 0604}, 0604, mtime},
+		{"Capture time wins", Config{PreserveAttrs: true, CaptureTime: atime}, 0640, atime},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			config.OutputFormat, config.MaxWidth, config.MaxHeight, config.Quality = "jpg", 50, 50, 90
+			config.OutputDir = t.TempDir()
+			result, err := Process(inputPath, config)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			info, err := os.Stat(result.OutputPath)
+			if err != nil {
+				t.Fatalf("Failed to stat output: %v", err)
+			}
+			if info.Mode().Perm() != test.mode || !info.ModTime().Equal(test.mtime) {
+				t.Errorf("Process() output = %v %v, expected %v %v", info.Mode().Perm(), info.ModTime(), test.mode, test.mtime)
+			}
+		})
+	}
+}
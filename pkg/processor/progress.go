@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"os"
+	"time"
+)
+
+// Stage is a step of processing one input
+type Stage string
+
+const (
+	// StageDecode reads and decodes the input
+	StageDecode Stage = "decode"
+	// StageTransform converts, crops and resizes the decoded image
+	StageTransform Stage = "transform"
+	// StageEncode writes the output
+	StageEncode Stage = "encode"
+	// StageFinish embeds metadata and sets permissions of the outputs
+	StageFinish Stage = "finish"
+)
+
+// Event describes the state of processing one input
+type Event struct {
+	InputPath string
+	Stage     Stage
+	// BytesRead is how much of the input has been read, out of InputSize.
+	// Decoders that seek may read parts twice; BytesRead stays at most
+	// InputSize.
+	BytesRead int64
+	InputSize int64
+}
+
+// fileProgress reports the processing of one input to Config.OnProgress
+// and times its stages. A nil fileProgress reports nothing.
+type fileProgress struct {
+	event    Event
+	callback func(Event)
+	// durations adds up the time spent in each stage, nil when not timed.
+	// Pages and frames go through the stages several times.
+	durations map[Stage]time.Duration
+	entered   time.Time
+}
+
+// newFileProgress returns the progress of the input at inputPath of size,
+// or nil without a callback or timing
+func newFileProgress(inputPath string, size int64, callback func(Event), timed bool) *fileProgress {
+	if callback == nil && !timed {
+		return nil
+	}
+	p := &fileProgress{event: Event{InputPath: inputPath, InputSize: size}, callback: callback}
+	if timed {
+		p.durations = make(map[Stage]time.Duration)
+	}
+	return p
+}
+
+// stage reports that processing entered stage
+func (p *fileProgress) stage(stage Stage) {
+	if p == nil {
+		return
+	}
+	p.endStage()
+	p.event.Stage = stage
+	if p.callback != nil {
+		p.callback(p.event)
+	}
+}
+
+// endStage adds the time since the current stage was entered to it
+func (p *fileProgress) endStage() {
+	if p.durations == nil {
+		return
+	}
+	now := time.Now()
+	if p.event.Stage != "" {
+		p.durations[p.event.Stage] += now.Sub(p.entered)
+	}
+	p.entered = now
+}
+
+// stageTimes ends the current stage and returns the time spent in each
+// stage as log attributes, none when not timed
+func (p *fileProgress) stageTimes() []any {
+	if p == nil || p.durations == nil {
+		return nil
+	}
+	p.endStage()
+	var attrs []any
+	for _, stage := range []Stage{StageDecode, StageTransform, StageEncode, StageFinish} {
+		if d, ok := p.durations[stage]; ok {
+			attrs = append(attrs, string(stage), d.Round(time.Microsecond))
+		}
+	}
+	return attrs
+}
+
+// read reports n more bytes read from the input
+func (p *fileProgress) read(n int) {
+	if p == nil || p.callback == nil || n <= 0 {
+		return
+	}
+	p.event.BytesRead = min(p.event.BytesRead+int64(n), p.event.InputSize)
+	p.callback(p.event)
+}
+
+// inputFile is an input opened read-only that reports what is read from
+// it. It does not embed the file so that every read goes through it.
+type inputFile struct {
+	file     *os.File
+	progress *fileProgress
+}
+
+// openInput opens the input at path read-only
+func openInput(path string, progress *fileProgress) (*inputFile, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &inputFile{file: file, progress: progress}, nil
+}
+
+func (f *inputFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	f.progress.read(n)
+	return n, err
+}
+
+func (f *inputFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.file.ReadAt(p, off)
+	f.progress.read(n)
+	return n, err
+}
+
+func (f *inputFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *inputFile) Close() error {
+	return f.file.Close()
+}
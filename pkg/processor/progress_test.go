@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestProcessCallbacks(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "photo.png")
+	if err := encodePNG(image.NewNRGBA(image.Rect(0, 0, 300, 200)))(inputPath); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var started []Event
+	var events []Event
+	var completed []Result
+	config := Config{
+		OutputFormat: "jpg",
+		MaxWidth:     100,
+		MaxHeight:    100,
+		Quality:      80,
+		OutputDir:    t.TempDir(),
+		OnStart:      func(event Event) { started = append(started, event) },
+		OnProgress:   func(event Event) { events = append(events, event) },
+		OnComplete: func(result Result, err error) {
+			if err != nil {
+				t.Errorf("OnComplete() error = %v", err)
+			}
+			completed = append(completed, result)
+		},
+	}
+	result, err := Process(inputPath, config)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if len(started) != 1 || started[0].InputPath != inputPath || started[0].InputSize != info.Size() {
+		t.Errorf("OnStart() calls = %+v, expected one for %s of %d bytes", started, inputPath, info.Size())
+	}
+	if len(completed) != 1 || completed[0].OutputPath != result.OutputPath {
+		t.Errorf("OnComplete() calls = %+v, expected one with the result", completed)
+	}
+
+	var stages []Stage
+	var read int64
+	for _, event := range events {
+		if len(stages) == 0 || stages[len(stages)-1] != event.Stage {
+			stages = append(stages, event.Stage)
+		}
+		if event.BytesRead < read || event.InputSize != info.Size() {
+			t.Errorf("event %+v after %d bytes read", event, read)
+		}
+		read = event.BytesRead
+	}
+	expected := []Stage{StageDecode, StageTransform, StageEncode, StageFinish}
+	if !slices.Equal(stages, expected) {
+		t.Errorf("stages = %v, expected %v", stages, expected)
+	}
+	if read != info.Size() {
+		t.Errorf("read %d bytes, expected all %d", read, info.Size())
+	}
+}
+
+func TestProcessCallbacksOnError(t *testing.T) {
+	var completed int
+	var completeErr error
+	config := Config{
+		OutputFormat: "jpg",
+		OutputDir:    t.TempDir(),
+		OnStart:      func(Event) { t.Error("OnStart() called for a missing input") },
+		OnComplete: func(result Result, err error) {
+			completed++
+			completeErr = err
+		},
+	}
+	if _, err := Process(filepath.Join(t.TempDir(), "missing.png"), config); err == nil {
+		t.Fatal("Process() of a missing input succeeded")
+	}
+	if completed != 1 || completeErr == nil {
+		t.Errorf("OnComplete() called %d times with %v, expected once with the error", completed, completeErr)
+	}
+}
@@ -0,0 +1,100 @@
+package processor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sidecarKind is a kind of file kept next to an image by the tools that
+// edit or export it
+type sidecarKind struct {
+	// suffix is the extension of the sidecar, tried as written and in
+	// upper case
+	suffix string
+	// replaces is set for sidecars named like the image without its
+	// extension, IMG_1234.xmp, rather than after it, IMG_1234.JPG.xmp
+	replaces bool
+}
+
+// sidecarKinds are the sidecars CopySidecars copies: XMP edits of
+// Lightroom and Capture One, of darktable and digiKam, Apple Photos
+// adjustments and the metadata of Google Takeout exports
+var sidecarKinds = []sidecarKind{
+	{".xmp", true},
+	{".xmp", false},
+	{".aae", true},
+	{".json", false},
+	{".supplemental-metadata.json", false},
+}
+
+// findSidecars returns the sidecars of the input at path with the kind
+// each was found as
+func findSidecars(path string) ([]string, []sidecarKind) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	var paths []string
+	var kinds []sidecarKind
+	for _, kind := range sidecarKinds {
+		stem := path
+		if kind.replaces {
+			stem = base
+		}
+		for _, suffix := range []string{kind.suffix, strings.ToUpper(kind.suffix)} {
+			if info, err := os.Stat(stem + suffix); err == nil && info.Mode().IsRegular() {
+				paths = append(paths, stem+suffix)
+				kinds = append(kinds, kind)
+				break
+			}
+		}
+	}
+	return paths, kinds
+}
+
+// copySidecars copies the sidecars of the input at inputPath next to its
+// output at outputPath, renamed after it, and returns their paths
+func copySidecars(inputPath, outputPath string, config Config) ([]string, error) {
+	sources, kinds := findSidecars(inputPath)
+	var copied []string
+	for i, source := range sources {
+		stem := outputPath
+		if kinds[i].replaces {
+			stem = strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+		}
+		// The suffix keeps the case it was found in
+		target := stem + source[len(source)-len(kinds[i].suffix):]
+
+		// Outputs written next to their inputs may share the sidecar
+		if sourceInfo, err := os.Stat(source); err == nil {
+			if targetInfo, err := os.Stat(target); err == nil && os.SameFile(sourceInfo, targetInfo) {
+				continue
+			}
+		}
+		if err := copyFile(source, target); err != nil {
+			return copied, err
+		}
+		if err := finishOutput(target, config); err != nil {
+			return copied, err
+		}
+		copied = append(copied, target)
+	}
+	return copied, nil
+}
+
+// copyFile copies the file at source to target
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
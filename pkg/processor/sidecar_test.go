@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProcessCopySidecars(t *testing.T) {
+	tempDir := t.TempDir()
+	outDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 40, 20)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	inputPath := filepath.Join(tempDir, "IMG_1234.JPG")
+	if err := os.WriteFile(inputPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+	sidecars := map[string]string{
+		"IMG_1234.xmp":      "lightroom",
+		"IMG_1234.JPG.xmp":  "darktable",
+		"IMG_1234.AAE":      "photos",
+		"IMG_1234.JPG.json": "takeout",
+		// Of another image
+		"IMG_1235.xmp": "other",
+	}
+	for name, content := range sidecars {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write sidecar: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		options  []Option
+		expected map[string]string
+	}{
+		{"Not copied by default", nil, nil},
+		{"Renamed after the output", []Option{WithSidecars()}, map[string]string{
+			"IMG_1234.xmp":       "lightroom",
+			"IMG_1234.webp.xmp":  "darktable",
+			"IMG_1234.AAE":       "photos",
+			"IMG_1234.webp.json": "takeout",
+		}},
+		{"Stripped", []Option{WithSidecars(), WithMetadataPolicy(MetadataStrip, "")}, nil},
+	}
+	for _, test := range tests {
+		p, err := New(append([]Option{WithOutputDir(outDir), WithFormat("webp"), WithExistingPolicy(ExistingOverwrite)}, test.options...)...)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		result, err := p.Process(inputPath)
+		if err != nil {
+			t.Fatalf("%s: Process() error = %v", test.name, err)
+		}
+		if len(result.Sidecars) != len(test.expected) {
+			t.Errorf("%s: sidecars = %v, expected %d", test.name, result.Sidecars, len(test.expected))
+		}
+		copied := map[string]string{}
+		for _, sidecar := range result.Sidecars {
+			content, err := os.ReadFile(sidecar)
+			if err != nil {
+				t.Fatalf("%s: Failed to read sidecar: %v", test.name, err)
+			}
+			copied[filepath.Base(sidecar)] = string(content)
+		}
+		if len(test.expected) > 0 && !reflect.DeepEqual(copied, test.expected) {
+			t.Errorf("%s: copied %v, expected %v", test.name, copied, test.expected)
+		}
+		if outputs := result.Outputs(); len(outputs) != 1+len(test.expected) || outputs[0] != result.OutputPath {
+			t.Errorf("%s: Outputs() = %v, expected the output then its sidecars", test.name, outputs)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/strukturag/libheif/go/heif"
+	"golang.org/x/image/tiff"
+	xwebp "golang.org/x/image/webp"
+)
+
+// errNoSingleSize is returned by OutputSize for inputs whose pages are
+// only known once they are unpacked or rendered
+var errNoSingleSize = errors.New("the output size of PDFs and comic archives is only known once their pages are read")
+
+// errDocumentSize is returned by OutputSize in document mode, where the
+// size is that of the page found in the pixels
+var errDocumentSize = errors.New("the output size of documents is only known once their page is found")
+
+// errSpreadSize is returned by OutputSize when splitting spreads, whose
+// pages are only known once their gutter is found
+var errSpreadSize = errors.New("the output size of spreads is only known once their gutter is found")
+
+// OutputSize returns the size Process gives the output of inputPath with
+// config, of its first frame or page if it has several. It reads the
+// header of the input and its EXIF orientation, not the pixels.
+func OutputSize(inputPath string, config Config) (image.Point, error) {
+	if ext := strings.ToLower(filepath.Ext(inputPath)); ext == ".pdf" || isComicArchive(inputPath) {
+		return image.Point{}, errNoSingleSize
+	}
+	if config.Document != "" {
+		return image.Point{}, errDocumentSize
+	}
+	if config.SplitSpreads {
+		return image.Point{}, errSpreadSize
+	}
+	size, err := inputSize(inputPath)
+	if err != nil {
+		return image.Point{}, err
+	}
+
+	// Follow the steps of transformImage that change the size
+	if config.AutoOrient && readOrientation(inputPath) >= 5 {
+		size.X, size.Y = size.Y, size.X
+	}
+	if !config.Crop.Empty() {
+		rect := config.Crop.Intersect(image.Rectangle{Max: size})
+		if rect.Empty() {
+			return image.Point{}, errors.New("crop rectangle lies outside the image")
+		}
+		size = rect.Size()
+	}
+	if config.Fill || config.Carve {
+		size = fillSize(size, config.MaxWidth, config.MaxHeight)
+	}
+	size = outputSize(size, config)
+	if config.Mipmaps != "" {
+		size = image.Pt(powerOfTwo(size.X, config.MaxWidth), powerOfTwo(size.Y, config.MaxHeight))
+	}
+	return size, nil
+}
+
+// inputSize returns the size in the header of the image at path, decoded
+// by the readers loadInput uses
+func inputSize(path string) (image.Point, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".heic" || ext == ".heif" || ext == ".avif" {
+		ctx, err := heif.NewContext()
+		if err != nil {
+			return image.Point{}, err
+		}
+		if err := ctx.ReadFromFile(path); err != nil {
+			return image.Point{}, err
+		}
+		hdl, err := ctx.GetPrimaryImageHandle()
+		if err != nil {
+			return image.Point{}, err
+		}
+		return image.Pt(hdl.GetWidth(), hdl.GetHeight()), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return image.Point{}, err
+	}
+	defer file.Close()
+
+	var cfg image.Config
+	if ext == ".webp" {
+		cfg, err = xwebp.DecodeConfig(file)
+	} else {
+		// TIFF is told by its byte order mark, like in loadInput
+		header := make([]byte, 4)
+		_, readErr := io.ReadFull(file, header)
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return image.Point{}, err
+		}
+		if readErr == nil && isTIFF(header) {
+			cfg, err = tiff.DecodeConfig(file)
+		} else {
+			cfg, _, err = image.DecodeConfig(file)
+		}
+	}
+	if err != nil {
+		return image.Point{}, err
+	}
+	return image.Pt(cfg.Width, cfg.Height), nil
+}
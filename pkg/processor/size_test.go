@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestOutputSize(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.png")
+	if err := imaging.Save(image.NewNRGBA(image.Rect(0, 0, 300, 200)), inputPath); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"Unchanged", Config{MaxWidth: 1920, MaxHeight: 1920}},
+		{"Fit", Config{MaxWidth: 100, MaxHeight: 100}},
+		{"Fill", Config{MaxWidth: 100, MaxHeight: 100, Fill: true}},
+		{"Upscale", Config{MaxWidth: 1000, MaxHeight: 1000, Upscale: true}},
+		{"Fill and upscale", Config{MaxWidth: 640, MaxHeight: 480, Fill: true, Upscale: true}},
+		{"Crop", Config{MaxWidth: 1920, MaxHeight: 1920, Crop: image.Rect(250, 0, 400, 50)}},
+		{"Mipmaps", Config{MaxWidth: 1920, MaxHeight: 1920, Mipmaps: MipmapImages}},
+	}
+
+	// The size is the one Process gives the output
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			config.OutputFormat, config.Quality, config.OutputDir = "png", 90, outputDir
+			size, err := OutputSize(inputPath, config)
+			if err != nil {
+				t.Fatalf("OutputSize() error = %v", err)
+			}
+			result, err := Process(inputPath, config)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if size != image.Pt(result.Width, result.Height) {
+				t.Errorf("OutputSize() = %v, expected %dx%d", size, result.Width, result.Height)
+			}
+		})
+	}
+
+	if _, err := OutputSize(filepath.Join(tempDir, "book.cbz"), Config{MaxWidth: 100, MaxHeight: 100}); err == nil {
+		t.Error("OutputSize() of a comic archive error = nil, expected an error")
+	}
+}
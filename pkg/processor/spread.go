@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"image"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// minSpreadAspect is the smallest width to height ratio of a two-page
+// spread; two portrait pages side by side are about 1.4
+const minSpreadAspect = 1.15
+
+// spreadDetectWidth is the width of the copy gutters are found in
+const spreadDetectWidth = 512
+
+// spreadPages are the left and right pages of a two-page spread, split
+// at its gutter
+type spreadPages struct {
+	halves [2]image.Image
+}
+
+func (s *spreadPages) count() int { return len(s.halves) }
+
+func (s *spreadPages) page(i int) (image.Image, error) { return s.halves[i], nil }
+
+func (s *spreadPages) close() error { return nil }
+
+// openSpread decodes the still image at inputPath and, if it is a two-page
+// spread, returns its pages, upright. It returns nil for other images,
+// which are decoded again as stills.
+func openSpread(inputPath string, config Config) (pageSource, error) {
+	switch strings.ToLower(filepath.Ext(inputPath)) {
+	case ".gif", ".webp":
+		if isAnimated(inputPath) {
+			return nil, nil
+		}
+	}
+	config.progress.stage(StageDecode)
+	img, err := loadInput(inputPath, config.progress, config.MaxPixels)
+	if err != nil {
+		return nil, err
+	}
+	if config.orientation > 1 {
+		img = orient(img, config.orientation)
+	}
+	gutter, ok := findGutter(img)
+	if !ok {
+		return nil, nil
+	}
+	config.logger().Debug("Splitting two-page spread", "input", inputPath, "gutter", gutter)
+	bounds := img.Bounds()
+	return &spreadPages{halves: [2]image.Image{
+		imaging.Crop(img, image.Rect(bounds.Min.X, bounds.Min.Y, gutter, bounds.Max.Y)),
+		imaging.Crop(img, image.Rect(gutter, bounds.Min.Y, bounds.Max.X, bounds.Max.Y)),
+	}}, nil
+}
+
+// findGutter returns the x coordinate of the gutter of a scan of a
+// two-page spread in img, and whether img is one. A gutter is either the
+// shadow of a bound book, a narrow valley of brightness near the middle,
+// or a band of blank paper between two pages with content.
+func findGutter(img image.Image) (int, bool) {
+	bounds := img.Bounds()
+	if float64(bounds.Dx()) < minSpreadAspect*float64(bounds.Dy()) {
+		return 0, false
+	}
+	small := imaging.Grayscale(imaging.Resize(img, spreadDetectWidth, 0, imaging.Box))
+	width, height := small.Rect.Dx(), small.Rect.Dy()
+	if height < 8 {
+		return 0, false
+	}
+	var histogram [256]int
+	for i := 0; i < len(small.Pix); i += 4 {
+		histogram[small.Pix[i]]++
+	}
+	threshold := otsuThreshold(histogram, width*height)
+
+	// Columns over the middle rows, clear of headers and page edges
+	top, bottom := height/10, height-height/10
+	brightness := make([]float64, width)
+	ink := make([]float64, width)
+	for x := 0; x < width; x++ {
+		for y := top; y < bottom; y++ {
+			v := small.Pix[y*small.Stride+x*4]
+			brightness[x] += float64(v)
+			if v <= threshold {
+				ink[x]++
+			}
+		}
+		brightness[x] /= float64(bottom - top)
+		ink[x] /= float64(bottom - top)
+	}
+	scale := float64(bounds.Dx()) / float64(width)
+	at := func(x int) int { return bounds.Min.X + int(float64(x)*scale+0.5) }
+
+	// A shadow: the darkest column near the middle of bright paper, a
+	// valley well below the columns on both sides of it
+	from, to := width*2/5, width*3/5
+	darkest := from
+	for x := from; x < to; x++ {
+		if brightness[x] < brightness[darkest] {
+			darkest = x
+		}
+	}
+	middle := append([]float64(nil), brightness[width*3/10:width*7/10]...)
+	sort.Float64s(middle)
+	if median := middle[len(middle)/2]; median >= 128 && brightness[darkest] < 0.85*median {
+		var leftPeak, rightPeak float64
+		for x := max(darkest-width/10, 0); x < darkest; x++ {
+			leftPeak = max(leftPeak, brightness[x])
+		}
+		for x := darkest + 1; x <= min(darkest+width/10, width-1); x++ {
+			rightPeak = max(rightPeak, brightness[x])
+		}
+		if brightness[darkest] < 0.85*min(leftPeak, rightPeak) {
+			return at(darkest), true
+		}
+	}
+
+	// A blank band: the widest run of columns without ink near the middle,
+	// with content on both sides
+	const blank = 0.005
+	bestStart, bestLength := 0, 0
+	for x := width * 7 / 20; x < width*13/20; {
+		if ink[x] >= blank {
+			x++
+			continue
+		}
+		start := x
+		for x < width*13/20 && ink[x] < blank {
+			x++
+		}
+		if x-start > bestLength {
+			bestStart, bestLength = start, x-start
+		}
+	}
+	if bestLength < max(2, width/50) {
+		return 0, false
+	}
+	var left, right float64
+	for x := 0; x < bestStart; x++ {
+		left += ink[x]
+	}
+	for x := bestStart + bestLength; x < width; x++ {
+		right += ink[x]
+	}
+	if left/float64(width) < 0.01 || right/float64(width) < 0.01 {
+		return 0, false
+	}
+	return at(bestStart + bestLength/2), true
+}
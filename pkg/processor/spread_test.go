@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// spreadScan returns a 1400x1000 scan of white pages with lines of text,
+// split at x by a gutter of shadow when shadow, or else by blank paper
+func spreadScan(x int, shadow bool) *image.NRGBA {
+	img := imaging.New(1400, 1000, color.NRGBA{245, 245, 240, 255})
+	for y := 100; y < 900; y += 24 {
+		for _, column := range [2][2]int{{100, x - 80}, {x + 80, 1300}} {
+			for dy := 0; dy < 8; dy++ {
+				for cx := column[0]; cx < column[1]; cx++ {
+					if cx%40 < 32 {
+						img.SetNRGBA(cx, y+dy, color.NRGBA{20, 20, 20, 255})
+					}
+				}
+			}
+		}
+	}
+	if shadow {
+		for y := 0; y < 1000; y++ {
+			for dx := -12; dx <= 12; dx++ {
+				v := uint8(90 + 6*abs(dx))
+				img.SetNRGBA(x+dx, y, color.NRGBA{v, v, v, 255})
+			}
+		}
+	}
+	return img
+}
+
+// textAcross returns a landscape page with lines of text running across
+// the middle
+func textAcross() *image.NRGBA {
+	img := imaging.New(1400, 1000, color.White)
+	for y := 100; y < 900; y += 24 {
+		for dy := 0; dy < 8; dy++ {
+			for x := 100; x < 1300; x++ {
+				if x%40 < 32 {
+					img.SetNRGBA(x, y+dy, color.NRGBA{20, 20, 20, 255})
+				}
+			}
+		}
+	}
+	return img
+}
+
+// abs returns the absolute value of v
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func TestFindGutter(t *testing.T) {
+	tests := []struct {
+		name   string
+		img    image.Image
+		spread bool
+		gutter int
+	}{
+		{"Shadow of a bound book", spreadScan(720, true), true, 720},
+		{"Blank paper between pages", spreadScan(680, false), true, 680},
+		{"Single portrait page", imaging.Crop(spreadScan(700, true), image.Rect(0, 0, 700, 1000)), false, 0},
+		{"Blank landscape", imaging.New(1400, 1000, color.White), false, 0},
+		{"Text across the page", textAcross(), false, 0},
+	}
+
+	for _, test := range tests {
+		gutter, ok := findGutter(test.img)
+		if ok != test.spread {
+			t.Errorf("%s: findGutter() spread = %v, expected %v", test.name, ok, test.spread)
+			continue
+		}
+		if ok && abs(gutter-test.gutter) > 8 {
+			t.Errorf("%s: findGutter() = %d, expected about %d", test.name, gutter, test.gutter)
+		}
+	}
+}
+
+func TestProcessSplitSpreads(t *testing.T) {
+	tempDir := t.TempDir()
+	outDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	inputPath := filepath.Join(tempDir, "book.png")
+	if err := imaging.Save(spreadScan(720, true), inputPath); err != nil {
+		t.Fatalf("Failed to save spread: %v", err)
+	}
+
+	p, err := New(WithFormat("png"), WithOutputDir(outDir), WithSplitSpreads())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	result, err := p.Process(inputPath)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	expected := []string{filepath.Join(outDir, "book_p001.png"), filepath.Join(outDir, "book_p002.png")}
+	if len(result.Pages) != 2 || result.Pages[0] != expected[0] || result.Pages[1] != expected[1] {
+		t.Fatalf("Process() pages = %v, expected %v", result.Pages, expected)
+	}
+	for i, width := range []int{720, 680} {
+		img, err := imaging.Open(result.Pages[i])
+		if err != nil {
+			t.Fatalf("Failed to open page %d: %v", i+1, err)
+		}
+		if size := img.Bounds().Size(); abs(size.X-width) > 8 || size.Y != 1000 {
+			t.Errorf("page %d size = %v, expected about %dx1000", i+1, size, width)
+		}
+	}
+}
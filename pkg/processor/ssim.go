@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+)
+
+// ssimWindow is the side of the square windows SSIM compares, which step
+// by half their size
+const ssimWindow = 8
+
+// Stabilizing constants of SSIM for 8-bit values
+const (
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// SSIM returns the structural similarity of the luma of a and b, which
+// must have the same size: 1 for identical images, lower the more visible
+// their differences are. Scale an original to the size of its output to
+// judge the loss of quality.
+func SSIM(a, b image.Image) (float64, error) {
+	width, height := a.Bounds().Dx(), a.Bounds().Dy()
+	if b.Bounds().Dx() != width || b.Bounds().Dy() != height {
+		return 0, fmt.Errorf("images differ in size: %dx%d and %dx%d", width, height, b.Bounds().Dx(), b.Bounds().Dy())
+	}
+	if width == 0 || height == 0 {
+		return 0, fmt.Errorf("images are empty")
+	}
+
+	la, lb := luma(a), luma(b)
+	windowWidth, windowHeight := min(ssimWindow, width), min(ssimWindow, height)
+	const step = ssimWindow / 2
+
+	total, windows := 0.0, 0
+	for y := 0; y+windowHeight <= height; y += step {
+		for x := 0; x+windowWidth <= width; x += step {
+			total += windowSSIM(la, lb, width, x, y, windowWidth, windowHeight)
+			windows++
+		}
+	}
+	return total / float64(windows), nil
+}
+
+// luma returns the Rec. 601 luma of img row by row
+func luma(img image.Image) []float64 {
+	bounds := img.Bounds()
+	values := make([]float64, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			values = append(values, (0.299*float64(r)+0.587*float64(g)+0.114*float64(b))/257)
+		}
+	}
+	return values
+}
+
+// windowSSIM returns the SSIM of one window of the luma planes a and b
+func windowSSIM(a, b []float64, stride, x0, y0, width, height int) float64 {
+	n := float64(width * height)
+	var sumA, sumB float64
+	for y := y0; y < y0+height; y++ {
+		for x := x0; x < x0+width; x++ {
+			sumA += a[y*stride+x]
+			sumB += b[y*stride+x]
+		}
+	}
+	meanA, meanB := sumA/n, sumB/n
+
+	var varA, varB, covariance float64
+	for y := y0; y < y0+height; y++ {
+		for x := x0; x < x0+width; x++ {
+			da, db := a[y*stride+x]-meanA, b[y*stride+x]-meanB
+			varA += da * da
+			varB += db * db
+			covariance += da * db
+		}
+	}
+	varA, varB, covariance = varA/n, varB/n, covariance/n
+
+	return (2*meanA*meanB + ssimC1) * (2*covariance + ssimC2) /
+		((meanA*meanA + meanB*meanB + ssimC1) * (varA + varB + ssimC2))
+}
@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestSSIM(t *testing.T) {
+	gradient := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	noisy := image.NewRGBA(gradient.Bounds())
+	flat := image.NewRGBA(gradient.Bounds())
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			v := uint8(x * 8)
+			gradient.Set(x, y, color.RGBA{v, v, v, 255})
+			noisy.Set(x, y, color.RGBA{v ^ uint8((x*7+y*13)%64), v, v, 255})
+			flat.Set(x, y, color.RGBA{128, 128, 128, 255})
+		}
+	}
+
+	tests := []struct {
+		name     string
+		a, b     image.Image
+		min, max float64
+	}{
+		{"Identical", gradient, gradient, 1, 1},
+		{"Noisy", gradient, noisy, 0.3, 0.99},
+		{"Flat", gradient, flat, 0, 0.3},
+		{"Smaller than a window", gradient.SubImage(image.Rect(0, 0, 5, 3)), gradient.SubImage(image.Rect(0, 0, 5, 3)), 1, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := SSIM(test.a, test.b)
+			if err != nil {
+				t.Fatalf("SSIM() error = %v", err)
+			}
+			if got < test.min-1e-9 || got > test.max+1e-9 {
+				t.Errorf("SSIM() = %g, expected between %g and %g", got, test.min, test.max)
+			}
+			if reverse, _ := SSIM(test.b, test.a); math.Abs(reverse-got) > 1e-9 {
+				t.Errorf("SSIM() is not symmetric: %g and %g", got, reverse)
+			}
+		})
+	}
+
+	if _, err := SSIM(gradient, image.NewRGBA(image.Rect(0, 0, 16, 24))); err == nil {
+		t.Error("SSIM() of images of different sizes expected error, got nil")
+	}
+}
@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	stampFontOnce sync.Once
+	stampFont     *opentype.Font
+	stampFontErr  error
+)
+
+// loadStampFont parses the embedded font used for burned-in text
+func loadStampFont() (*opentype.Font, error) {
+	stampFontOnce.Do(func() {
+		stampFont, stampFontErr = opentype.Parse(gomedium.TTF)
+	})
+	return stampFont, stampFontErr
+}
+
+// stampText burns text into the bottom-left corner of img, white on a
+// translucent dark box. The font size follows the image height so the
+// text stays legible at any resolution. Lines are separated by "\n".
+func stampText(img image.Image, text string) (image.Image, error) {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		return img, nil
+	}
+
+	bounds := img.Bounds()
+	size := float64(bounds.Dy()) / 30
+	if size < 12 {
+		size = 12
+	}
+
+	f, err := loadStampFont()
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	padding := lineHeight / 3
+
+	textWidth := 0
+	for _, line := range lines {
+		if w := font.MeasureString(face, line).Ceil(); w > textWidth {
+			textWidth = w
+		}
+	}
+
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+
+	box := image.Rect(
+		bounds.Min.X+padding,
+		bounds.Max.Y-padding-len(lines)*lineHeight-2*padding,
+		bounds.Min.X+3*padding+textWidth,
+		bounds.Max.Y-padding,
+	).Intersect(bounds)
+	draw.Draw(dst, box, image.NewUniform(color.NRGBA{0, 0, 0, 160}), image.Point{}, draw.Over)
+
+	drawer := &font.Drawer{Dst: dst, Src: image.White, Face: face}
+	for i, line := range lines {
+		drawer.Dot = fixed.P(box.Min.X+padding, box.Min.Y+padding+i*lineHeight+metrics.Ascent.Ceil())
+		drawer.DrawString(line)
+	}
+	return dst, nil
+}
@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestStampText(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			img.Set(x, y, color.RGBA{200, 200, 200, 255})
+		}
+	}
+
+	result, err := stampText(img, "CASE-1234\n2024-05-01 10:22")
+	if err != nil {
+		t.Fatalf("stampText() error = %v", err)
+	}
+	if result.Bounds() != img.Bounds() {
+		t.Errorf("stampText() bounds = %v, expected %v", result.Bounds(), img.Bounds())
+	}
+
+	// The bottom-left corner is darkened by the box, the top-right is untouched
+	r, _, _, _ := result.At(7, 293).RGBA()
+	if r>>8 >= 200 {
+		t.Errorf("stampText() bottom-left pixel red = %d, expected darker than 200", r>>8)
+	}
+	r, _, _, _ = result.At(390, 10).RGBA()
+	if r>>8 != 200 {
+		t.Errorf("stampText() top-right pixel red = %d, expected 200", r>>8)
+	}
+
+	// Empty text leaves the image alone
+	same, err := stampText(img, "  ")
+	if err != nil || same != image.Image(img) {
+		t.Errorf("stampText() with empty text should return the input image")
+	}
+}
@@ -0,0 +1,157 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Kinds of metadata outputMetadata finds
+const (
+	metadataEXIF    = "EXIF"
+	metadataXMP     = "XMP"
+	metadataIPTC    = "IPTC"
+	metadataICC     = "ICC"
+	metadataColor   = "color tag"
+	metadataComment = "comment"
+)
+
+// TIFF tags holding metadata, besides tagXMP and tagExifIFD
+const (
+	tagIPTC = 33723
+	tagICC  = 34675
+	tagGPS  = 34853
+)
+
+// outputMetadata returns the kinds of metadata in the output data of
+// format, in the order they are found, or nil if it has none. Formats
+// whose encoders write no metadata, such as AVIF, HEIC and JPEG XL, are
+// not read.
+func outputMetadata(data []byte, format string) []string {
+	var kinds []string
+	found := func(kind string) {
+		for _, k := range kinds {
+			if k == kind {
+				return
+			}
+		}
+		kinds = append(kinds, kind)
+	}
+
+	switch format {
+	case "jpg":
+		if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+			return nil
+		}
+		for at := 2; at+4 <= len(data) && data[at] == 0xFF; {
+			marker := data[at+1]
+			if marker == 0xDA || marker == 0xD9 {
+				break
+			}
+			end := at + 2 + int(binary.BigEndian.Uint16(data[at+2:]))
+			if end > len(data) {
+				break
+			}
+			segment := data[at+4 : end]
+			switch {
+			case marker == 0xE1 && bytes.HasPrefix(segment, exifHeader):
+				found(metadataEXIF)
+			case marker == 0xE1 && bytes.HasPrefix(segment, []byte("http://ns.adobe.com/")):
+				found(metadataXMP)
+			case marker == 0xE2 && bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")):
+				found(metadataICC)
+			case marker == 0xED:
+				found(metadataIPTC)
+			case marker == 0xFE:
+				found(metadataComment)
+			}
+			at = end
+		}
+	case "png":
+		if len(data) < 8 || string(data[1:4]) != "PNG" {
+			return nil
+		}
+		for at := 8; at+8 <= len(data); {
+			size := int(binary.BigEndian.Uint32(data[at:]))
+			kind := string(data[at+4 : at+8])
+			switch kind {
+			case "eXIf":
+				found(metadataEXIF)
+			case "iCCP":
+				found(metadataICC)
+			case "sRGB", "gAMA", "cHRM", "cICP":
+				found(metadataColor)
+			case "iTXt", "tEXt", "zTXt":
+				if body := data[at+8:]; bytes.HasPrefix(body, []byte("XML:com.adobe.xmp\x00")) {
+					found(metadataXMP)
+				} else {
+					found(metadataComment)
+				}
+			}
+			if size < 0 || size > len(data)-at-12 {
+				break
+			}
+			at += 12 + size
+		}
+	case "webp":
+		chunks, err := readWebPChunks(data)
+		if err != nil {
+			return nil
+		}
+		for _, chunk := range chunks {
+			switch chunk.id {
+			case "EXIF":
+				found(metadataEXIF)
+			case "XMP ":
+				found(metadataXMP)
+			case "ICCP":
+				found(metadataICC)
+			}
+		}
+	case "gif":
+		if bytes.Contains(data, []byte("\x21\xFF\x0BXMP DataXMP")) {
+			found(metadataXMP)
+		}
+	case "tiff":
+		order := tiffOrder(data)
+		if order == nil {
+			return nil
+		}
+		// Every directory, guarding against loops
+		for ifd, n := int(order.Uint32(data[4:])), 0; ifd >= 8 && ifd+2 <= len(data) && n < 1024; n++ {
+			count := int(order.Uint16(data[ifd:]))
+			if ifd+2+count*12+4 > len(data) {
+				break
+			}
+			for i := 0; i < count; i++ {
+				switch order.Uint16(data[ifd+2+i*12:]) {
+				case tagExifIFD, tagGPS:
+					found(metadataEXIF)
+				case tagXMP:
+					found(metadataXMP)
+				case tagIPTC:
+					found(metadataIPTC)
+				case tagICC:
+					found(metadataICC)
+				}
+			}
+			ifd = int(order.Uint32(data[ifd+2+count*12:]))
+		}
+	}
+	return kinds
+}
+
+// checkStripped returns an error if the output at path of format holds
+// metadata
+func checkStripped(path, format string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if kinds := outputMetadata(data, format); len(kinds) > 0 {
+		return fmt.Errorf("%s still holds %s metadata after stripping", path, strings.Join(kinds, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOutputMetadata(t *testing.T) {
+	var jpg, pngData bytes.Buffer
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	if err := jpeg.Encode(&jpg, img, nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	packet := outputXMP(Catalog{}, []string{"resize 8x8"}, "tool", deterministicTime(), deterministicTime())
+	withEXIF, _ := jpegWithEXIF(jpg.Bytes(), exifWithModel(binary.LittleEndian, "Phone"))
+	withXMP, _ := jpegWithXMP(withEXIF, packet)
+	pngXMP, _ := pngWithXMP(pngData.Bytes(), packet)
+	pngTagged, _ := pngWithColorTag(pngData.Bytes(), false)
+	comment := splice(jpg.Bytes(), 2, []byte("\xff\xfe\x00\x07hello"))
+	tiffXMP, _ := tiffWithXMP(exifWithModel(binary.LittleEndian, "Scanner"), packet)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		format   string
+		expected []string
+	}{
+		{"Plain JPEG", jpg.Bytes(), "jpg", nil},
+		{"JPEG with EXIF and XMP", withXMP, "jpg", []string{metadataXMP, metadataEXIF}},
+		{"JPEG comment", comment, "jpg", []string{metadataComment}},
+		{"Plain PNG", pngData.Bytes(), "png", nil},
+		{"PNG with XMP", pngXMP, "png", []string{metadataXMP}},
+		{"PNG color tags", pngTagged, "png", []string{metadataColor}},
+		{"TIFF with XMP", tiffXMP, "tiff", []string{metadataXMP}},
+		{"Unchecked format", withXMP, "avif", nil},
+	}
+	for _, test := range tests {
+		if got := outputMetadata(test.data, test.format); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: outputMetadata() = %v, expected %v", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestProcessStripMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 40, 20)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	data, _ := jpegWithEXIF(buf.Bytes(), exifWithModel(binary.BigEndian, "Test Camera"))
+	inputPath := filepath.Join(tempDir, "photo.jpg")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+
+	outDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	for _, format := range []string{"jpg", "png", "webp", "gif", "tiff"} {
+		config := Config{OutputFormat: format, MaxWidth: 100, MaxHeight: 100, Quality: 90, OutputDir: outDir, KeepEXIF: true, ColorTag: ColorTagCICP, StripMetadata: true}
+		result, err := Process(inputPath, config)
+		if err != nil {
+			t.Fatalf("%s: Process() error = %v", format, err)
+		}
+		out, err := os.ReadFile(result.OutputPath)
+		if err != nil {
+			t.Fatalf("%s: Failed to read output: %v", format, err)
+		}
+		if kinds := outputMetadata(out, format); kinds != nil {
+			t.Errorf("%s: output metadata = %v, expected none", format, kinds)
+		}
+	}
+
+	if _, err := New(WithMetadataPolicy(MetadataStrip, ""), func(c *Config) { c.ProcessingLog = true }); err == nil {
+		t.Error("New() with a stripped processing log expected error, got nil")
+	}
+}
@@ -0,0 +1,310 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/tiff"
+)
+
+// maxTIFFPages bounds the IFD chain walk, so a looping chain ends
+const maxTIFFPages = 10000
+
+// TIFF tags written by encodeTIFF
+const (
+	tagNewSubfileType  = 254
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagPhotometric     = 262
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagPlanarConfig    = 284
+	tagPageNumber      = 297
+	tagExtraSamples    = 338
+	tagXMP             = 700
+)
+
+// TIFF field types
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeUndefined = 7
+)
+
+// tiffFile is a TIFF read into memory with the offsets of its pages
+type tiffFile struct {
+	data  []byte
+	order binary.ByteOrder
+	pages []uint32
+	// limit is the most pixels of a page, 0 for maxPixels
+	limit int64
+}
+
+// canHoldPages reports whether format can be written with several pages
+func canHoldPages(format string) bool {
+	return format == "tiff"
+}
+
+// isTIFF reports whether header starts with a TIFF byte order mark
+func isTIFF(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("II*\x00")) || bytes.HasPrefix(header, []byte("MM\x00*"))
+}
+
+// readTIFF reads the TIFF at path and finds its pages, reporting the bytes
+// read to progress
+func readTIFF(path string, progress *fileProgress) (*tiffFile, error) {
+	file, err := openInput(path, progress)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 8 || !isTIFF(data) {
+		return nil, errors.New("not a TIFF file")
+	}
+	f := &tiffFile{data: data, order: binary.BigEndian}
+	if data[0] == 'I' {
+		f.order = binary.LittleEndian
+	}
+
+	// Follow the chain of image file directories
+	offset := f.order.Uint32(data[4:])
+	for offset != 0 && len(f.pages) < maxTIFFPages {
+		if int64(offset)+2 > int64(len(data)) {
+			return nil, errors.New("TIFF directory outside file")
+		}
+		f.pages = append(f.pages, offset)
+		next := int64(offset) + 2 + 12*int64(f.order.Uint16(data[offset:]))
+		if next+4 > int64(len(data)) {
+			break
+		}
+		offset = f.order.Uint32(data[next:])
+	}
+	if len(f.pages) == 0 {
+		return nil, errors.New("TIFF file has no pages")
+	}
+	return f, nil
+}
+
+func (f *tiffFile) count() int {
+	return len(f.pages)
+}
+
+func (f *tiffFile) close() error {
+	return nil
+}
+
+// page decodes page i by presenting the file to the TIFF decoder with
+// that page's directory first
+func (f *tiffFile) page(i int) (image.Image, error) {
+	r := &pageReader{data: f.data}
+	copy(r.header[:], f.data[:8])
+	f.order.PutUint32(r.header[4:], f.pages[i])
+	img, err := decodeConfigured(io.NewSectionReader(r, 0, int64(len(f.data))), tiff.DecodeConfig, tiff.Decode, f.limit)
+	if err != nil {
+		return nil, fmt.Errorf("page %d: %w", i+1, err)
+	}
+	return img, nil
+}
+
+// pageReader reads data with its header replaced
+type pageReader struct {
+	data   []byte
+	header [8]byte
+}
+
+func (r *pageReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if off < int64(len(r.header)) {
+		copy(p, r.header[off:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// pagePaths returns the numbered outputs of count pages, such as
+// doc_p001.jpg and doc_p002.jpg for outputPath doc.jpg
+func pagePaths(outputPath string, count int) []string {
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
+	width := max(3, len(fmt.Sprint(count)))
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("%s_p%0*d%s", base, width, i+1, ext)
+	}
+	return paths
+}
+
+// processPages transforms every page of src into a single multi-page
+// output when format can hold pages, or else into the numbered outputs
+func processPages(src pageSource, outputs []string, format string, config Config) error {
+	combine := canHoldPages(format)
+	var pages []image.Image
+	for i := 0; i < src.count(); i++ {
+		config.progress.stage(StageDecode)
+		img, err := src.page(i)
+		if err != nil {
+			return err
+		}
+		config.progress.stage(StageTransform)
+		if img, err = transformImage(img, config); err != nil {
+			return err
+		}
+		if combine {
+			pages = append(pages, img)
+			continue
+		}
+
+		// Write numbered outputs as they are done
+		config.progress.stage(StageEncode)
+		if config.BeforeWrite != nil {
+			if err := config.BeforeWrite(outputs[i]); err != nil {
+				return err
+			}
+		}
+		if err := saveImage(img, outputs[i], format, config.Quality, config.Speed, config.Effort); err != nil {
+			return err
+		}
+	}
+	if !combine {
+		return nil
+	}
+
+	config.progress.stage(StageEncode)
+	if config.BeforeWrite != nil {
+		if err := config.BeforeWrite(outputs[0]); err != nil {
+			return err
+		}
+	}
+	file, err := os.Create(outputs[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return encodeTIFF(file, pages)
+}
+
+// tiffEntry is a directory entry with its value, or the offset of its
+// values when they do not fit
+type tiffEntry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	value uint32
+}
+
+// encodeTIFF writes pages as a little-endian, deflate-compressed TIFF with
+// one directory per page
+func encodeTIFF(w io.Writer, pages []image.Image) error {
+	var buf bytes.Buffer
+	buf.WriteString("II*\x00")
+	buf.Write(make([]byte, 4))
+	// Position of the offset that points at the next directory
+	link := 4
+
+	for i, page := range pages {
+		img := imaging.Clone(page)
+		width, height := img.Rect.Dx(), img.Rect.Dy()
+		samples := 4
+		if img.Opaque() {
+			samples = 3
+		}
+
+		// Pixel data as a single deflated strip
+		var strip bytes.Buffer
+		zw := zlib.NewWriter(&strip)
+		row := make([]byte, width*samples)
+		for y := 0; y < height; y++ {
+			pix := img.Pix[y*img.Stride : y*img.Stride+width*4]
+			if samples == 4 {
+				copy(row, pix)
+			} else {
+				for x := 0; x < width; x++ {
+					copy(row[x*3:x*3+3], pix[x*4:x*4+3])
+				}
+			}
+			if _, err := zw.Write(row); err != nil {
+				return err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		stripOffset := buf.Len()
+		buf.Write(strip.Bytes())
+		padTIFF(&buf)
+
+		// Bits per sample do not fit in the entry
+		bitsOffset := buf.Len()
+		for s := 0; s < samples; s++ {
+			binary.Write(&buf, binary.LittleEndian, uint16(8))
+		}
+		padTIFF(&buf)
+
+		entries := []tiffEntry{
+			{tagNewSubfileType, typeLong, 1, 2},
+			{tagImageWidth, typeLong, 1, uint32(width)},
+			{tagImageLength, typeLong, 1, uint32(height)},
+			{tagBitsPerSample, typeShort, uint32(samples), uint32(bitsOffset)},
+			{tagCompression, typeShort, 1, 8},
+			{tagPhotometric, typeShort, 1, 2},
+			{tagStripOffsets, typeLong, 1, uint32(stripOffset)},
+			{tagSamplesPerPixel, typeShort, 1, uint32(samples)},
+			{tagRowsPerStrip, typeLong, 1, uint32(height)},
+			{tagStripByteCounts, typeLong, 1, uint32(strip.Len())},
+			{tagPlanarConfig, typeShort, 1, 1},
+			{tagPageNumber, typeShort, 2, uint32(i) | uint32(len(pages))<<16},
+		}
+		if samples == 4 {
+			// Unassociated alpha
+			entries = append(entries, tiffEntry{tagExtraSamples, typeShort, 1, 2})
+		}
+
+		ifd := buf.Len()
+		binary.LittleEndian.PutUint32(buf.Bytes()[link:], uint32(ifd))
+		binary.Write(&buf, binary.LittleEndian, uint16(len(entries)))
+		for _, e := range entries {
+			binary.Write(&buf, binary.LittleEndian, e.tag)
+			binary.Write(&buf, binary.LittleEndian, e.kind)
+			binary.Write(&buf, binary.LittleEndian, e.count)
+			// Short values sit in the first bytes of the field
+			binary.Write(&buf, binary.LittleEndian, e.value)
+		}
+		link = buf.Len()
+		buf.Write(make([]byte, 4))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// padTIFF aligns buf to a word boundary
+func padTIFF(buf *bytes.Buffer) {
+	if buf.Len()%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
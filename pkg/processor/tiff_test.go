@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeMultiPageTIFF writes a TIFF whose pages are solid colors of
+// different sizes
+func writeMultiPageTIFF(t *testing.T, path string, colors []color.NRGBA) {
+	t.Helper()
+	var pages []image.Image
+	for i, c := range colors {
+		page := image.NewNRGBA(image.Rect(0, 0, 200+100*i, 100))
+		for y := 0; y < page.Rect.Dy(); y++ {
+			for x := 0; x < page.Rect.Dx(); x++ {
+				page.SetNRGBA(x, y, c)
+			}
+		}
+		pages = append(pages, page)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create TIFF fixture: %v", err)
+	}
+	defer file.Close()
+	if err := encodeTIFF(file, pages); err != nil {
+		t.Fatalf("Failed to write TIFF fixture: %v", err)
+	}
+}
+
+func TestTIFFPages(t *testing.T) {
+	tempDir := t.TempDir()
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 128}}
+	path := filepath.Join(tempDir, "scan.tif")
+	writeMultiPageTIFF(t, path, colors)
+
+	if src, err := openPages(path, Config{AllPages: true}); err != nil || src == nil || src.count() != 3 {
+		t.Fatalf("openPages() = %v, %v, expected 3 pages", src, err)
+	}
+	if src, _ := openPages(path, Config{}); src != nil {
+		t.Error("openPages() without AllPages opened the pages")
+	}
+
+	f, err := readTIFF(path, nil)
+	if err != nil {
+		t.Fatalf("readTIFF() error = %v", err)
+	}
+	if len(f.pages) != 3 {
+		t.Fatalf("pages = %d, expected 3", len(f.pages))
+	}
+	for i, c := range colors {
+		img, err := f.page(i)
+		if err != nil {
+			t.Fatalf("page(%d) error = %v", i, err)
+		}
+		if img.Bounds().Dx() != 200+100*i {
+			t.Errorf("page %d width = %d, expected %d", i, img.Bounds().Dx(), 200+100*i)
+		}
+		if got := color.NRGBAModel.Convert(img.At(10, 10)); got != c {
+			t.Errorf("page %d color = %v, expected %v", i, got, c)
+		}
+	}
+
+	// The first page is what single-page decoding sees
+	img, err := loadImage(path)
+	if err != nil {
+		t.Fatalf("loadImage() error = %v", err)
+	}
+	if img.Bounds().Dx() != 200 {
+		t.Errorf("loadImage() width = %d, expected 200", img.Bounds().Dx())
+	}
+}
+
+func TestProcessAllPages(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "scan.tif")
+	writeMultiPageTIFF(t, inputPath, []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}})
+
+	tests := []struct {
+		name     string
+		config   Config
+		expected []string
+	}{
+		{"First page only", Config{OutputFormat: "jpg", MaxWidth: 100, MaxHeight: 100, Quality: 90}, []string{"scan.jpg"}},
+		{"Numbered pages", Config{OutputFormat: "jpg", MaxWidth: 100, MaxHeight: 100, Quality: 90, AllPages: true}, []string{"scan_p001.jpg", "scan_p002.jpg", "scan_p003.jpg"}},
+		{"Multi-page TIFF", Config{MaxWidth: 100, MaxHeight: 100, KeepFormat: true, AllPages: true}, []string{"scan.tif"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.OutputDir = t.TempDir()
+			result, err := Process(inputPath, test.config)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+
+			outputs := result.Outputs()
+			if len(outputs) != len(test.expected) {
+				t.Fatalf("Outputs() = %v, expected %v", outputs, test.expected)
+			}
+			var total int64
+			for i, output := range outputs {
+				if filepath.Base(output) != test.expected[i] {
+					t.Errorf("output %d = %s, expected %s", i, filepath.Base(output), test.expected[i])
+				}
+				info, err := os.Stat(output)
+				if err != nil {
+					t.Fatalf("output %s was not created", output)
+				}
+				total += info.Size()
+			}
+			if result.OutputSize != total {
+				t.Errorf("OutputSize = %d, expected %d", result.OutputSize, total)
+			}
+		})
+	}
+
+	// The multi-page output keeps every page, resized
+	outputDir := t.TempDir()
+	result, err := Process(inputPath, Config{MaxWidth: 100, MaxHeight: 100, OutputDir: outputDir, KeepFormat: true, AllPages: true})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	f, err := readTIFF(result.OutputPath, nil)
+	if err != nil {
+		t.Fatalf("readTIFF() error = %v", err)
+	}
+	if len(f.pages) != 3 {
+		t.Fatalf("output pages = %d, expected 3", len(f.pages))
+	}
+	page, err := f.page(2)
+	if err != nil {
+		t.Fatalf("page() error = %v", err)
+	}
+	if page.Bounds().Size() != image.Pt(100, 25) {
+		t.Errorf("last page size = %v, expected 100x25", page.Bounds().Size())
+	}
+}
+
+func TestPagePaths(t *testing.T) {
+	paths := pagePaths(filepath.Join("out", "doc.jpg"), 12)
+	if filepath.Base(paths[0]) != "doc_p001.jpg" || filepath.Base(paths[11]) != "doc_p012.jpg" {
+		t.Errorf("pagePaths() = %v, expected doc_p001.jpg to doc_p012.jpg", paths)
+	}
+	paths = pagePaths("doc.png", 1200)
+	if paths[0] != "doc_p0001.png" {
+		t.Errorf("pagePaths() = %s, expected doc_p0001.png", paths[0])
+	}
+}
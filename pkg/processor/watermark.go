@@ -0,0 +1,243 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// watermarkPositions are the anchors of watermarks
+var watermarkPositions = []string{
+	"top-left", "top", "top-right",
+	"left", "center", "right",
+	"bottom-left", "bottom", "bottom-right",
+}
+
+// WatermarkPositions returns the anchors of watermarks
+func WatermarkPositions() []string {
+	return append([]string(nil), watermarkPositions...)
+}
+
+// IsSupportedWatermarkPosition reports whether position is an anchor of
+// watermarks
+func IsSupportedWatermarkPosition(position string) bool {
+	for _, p := range watermarkPositions {
+		if p == position {
+			return true
+		}
+	}
+	return false
+}
+
+// watermarkFields are the placeholders of watermark texts
+var watermarkFields = []string{"year", "date", "name"}
+
+// watermarkPlaceholder matches a placeholder of a watermark text
+var watermarkPlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// Watermark is an image, usually a logo with transparency, or a line of
+// text composited onto outputs after resizing so that it stays sharp
+type Watermark struct {
+	Name  string
+	image image.Image
+	// Text, if set, is drawn rather than an image, with {year} and {date}
+	// replaced by when the input was taken and {name} by its file name
+	// without extension. Lines are separated by "\n".
+	Text string
+	// Size is the height of a line of Text as a fraction of the shorter
+	// side of the output
+	Size float64
+	// Color is that of Text
+	Color color.Color
+	font  *opentype.Font
+	// Position anchors it to a corner, an edge or the center of outputs.
+	// Empty means bottom-right.
+	Position string
+	// Scale is the width of an image as a fraction of the output width.
+	// 0 keeps its own size.
+	Scale float64
+	// Margin is its distance to the edges it is anchored to, as a fraction
+	// of the shorter side of the output
+	Margin float64
+	// Opacity from 0 to 1 multiplies its own transparency
+	Opacity float64
+}
+
+// OpenWatermark loads the image file at path as a fully opaque watermark
+// in the bottom-right corner at its own size
+func OpenWatermark(path string) (*Watermark, error) {
+	img, err := imaging.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("not a readable image: %s", path)
+	}
+	return &Watermark{Name: filepath.Base(path), image: img, Position: "bottom-right", Opacity: 1}, nil
+}
+
+// NewTextWatermark returns a watermark of text in white in the bottom-right
+// corner, set in the TrueType or OpenType font file at fontPath, or in Go
+// Medium if it is ""
+func NewTextWatermark(text, fontPath string) (*Watermark, error) {
+	var f *opentype.Font
+	var err error
+	if fontPath == "" {
+		f, err = loadStampFont()
+	} else {
+		var data []byte
+		if data, err = os.ReadFile(fontPath); err == nil {
+			f, err = opentype.Parse(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a readable TrueType or OpenType font: %s", fontPath)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Watermark{Name: strconv.Quote(text), Text: text, Size: 0.04, Color: color.White, font: f, Position: "bottom-right", Opacity: 1}, nil
+}
+
+// validate reports the first setting of w that cannot be applied
+func (w *Watermark) validate() error {
+	if w.image == nil && w.font == nil {
+		return fmt.Errorf("watermark %s has no image or font, create it with OpenWatermark or NewTextWatermark", w.Name)
+	}
+	if w.font != nil {
+		if strings.TrimSpace(w.Text) == "" {
+			return fmt.Errorf("watermark text is empty")
+		}
+		for _, m := range watermarkPlaceholder.FindAllStringSubmatch(w.Text, -1) {
+			if !slices.Contains(watermarkFields, m[1]) {
+				return fmt.Errorf("watermark text placeholder must be {year}, {date} or {name}, got: %s", m[0])
+			}
+		}
+		if w.Size <= 0 || w.Size > 0.5 {
+			return fmt.Errorf("watermark text size must be above 0 and at most 0.5, got: %g", w.Size)
+		}
+	}
+	if w.Position != "" && !IsSupportedWatermarkPosition(w.Position) {
+		return fmt.Errorf("watermark position must be one of %s, got: %s", strings.Join(watermarkPositions, ", "), w.Position)
+	}
+	if w.Scale < 0 || w.Scale > 1 {
+		return fmt.Errorf("watermark scale must be between 0 and 1, got: %g", w.Scale)
+	}
+	if w.Margin < 0 || w.Margin >= 0.5 {
+		return fmt.Errorf("watermark margin must be at least 0 and below 0.5, got: %g", w.Margin)
+	}
+	if w.Opacity <= 0 || w.Opacity > 1 {
+		return fmt.Errorf("watermark opacity must be above 0 and at most 1, got: %g", w.Opacity)
+	}
+	return nil
+}
+
+// expandWatermark returns a copy of w with the placeholders of its text
+// replaced for the input at path, taken at taken
+func expandWatermark(w *Watermark, path string, taken time.Time) *Watermark {
+	expanded := *w
+	expanded.Text = watermarkPlaceholder.ReplaceAllStringFunc(w.Text, func(placeholder string) string {
+		switch placeholder {
+		case "{year}":
+			return taken.Format("2006")
+		case "{date}":
+			return taken.Format("2006-01-02")
+		case "{name}":
+			name := filepath.Base(path)
+			return strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		return placeholder
+	})
+	return &expanded
+}
+
+// takenTime returns when the input at path with info was taken: the
+// CaptureTime of config, or that of its EXIF data, or its modification time
+func takenTime(path string, info os.FileInfo, config Config) time.Time {
+	if !config.CaptureTime.IsZero() {
+		return config.CaptureTime
+	}
+	if taken, err := CaptureTime(path); err == nil && !taken.IsZero() {
+		return taken
+	}
+	return info.ModTime()
+}
+
+// renderText draws the text of w with lines height pixels apart, on a
+// transparent image just large enough to hold it
+func (w *Watermark) renderText(height int) (image.Image, error) {
+	face, err := opentype.NewFace(w.font, &opentype.FaceOptions{Size: float64(height), DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	lines := strings.Split(strings.TrimSpace(w.Text), "\n")
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	width := 1
+	for _, line := range lines {
+		width = max(width, font.MeasureString(face, line).Ceil())
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, len(lines)*lineHeight))
+	drawer := &font.Drawer{Dst: dst, Src: image.NewUniform(w.Color), Face: face}
+	for i, line := range lines {
+		drawer.Dot = fixed.P(0, i*lineHeight+metrics.Ascent.Ceil())
+		drawer.DrawString(line)
+	}
+	return dst, nil
+}
+
+// applyWatermark composites w onto img
+func applyWatermark(img image.Image, w *Watermark) (image.Image, error) {
+	bounds := img.Bounds()
+	mark := w.image
+	if w.font != nil {
+		var err error
+		height := max(int(math.Round(float64(min(bounds.Dx(), bounds.Dy()))*w.Size)), 1)
+		if mark, err = w.renderText(height); err != nil {
+			return nil, err
+		}
+	} else if w.Scale > 0 {
+		width := max(int(math.Round(float64(bounds.Dx())*w.Scale)), 1)
+		mark = imaging.Resize(mark, width, 0, imaging.Lanczos)
+	}
+	size := mark.Bounds().Size()
+	margin := int(math.Round(float64(min(bounds.Dx(), bounds.Dy())) * w.Margin))
+
+	position := w.Position
+	if position == "" {
+		position = "bottom-right"
+	}
+	x, y := (bounds.Dx()-size.X)/2, (bounds.Dy()-size.Y)/2
+	switch position {
+	case "top-left", "left", "bottom-left":
+		x = margin
+	case "top-right", "right", "bottom-right":
+		x = bounds.Dx() - size.X - margin
+	}
+	switch position {
+	case "top-left", "top", "top-right":
+		y = margin
+	case "bottom-left", "bottom", "bottom-right":
+		y = bounds.Dy() - size.Y - margin
+	}
+
+	dst := image.NewNRGBA(bounds)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+	at := bounds.Min.Add(image.Pt(x, y))
+	opacity := image.NewUniform(color.Alpha{uint8(math.Round(w.Opacity * 255))})
+	draw.DrawMask(dst, image.Rectangle{at, at.Add(size)}, mark, mark.Bounds().Min, opacity, image.Point{}, draw.Over)
+	return dst, nil
+}
@@ -0,0 +1,207 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font/opentype"
+)
+
+// redWatermark returns a 10x10 opaque red watermark
+func redWatermark() *Watermark {
+	return &Watermark{Name: "logo.png", image: imaging.New(10, 10, color.NRGBA{255, 0, 0, 255}), Opacity: 1}
+}
+
+func TestApplyWatermark(t *testing.T) {
+	img := imaging.New(100, 50, color.NRGBA{255, 255, 255, 255})
+	tests := []struct {
+		name     string
+		position string
+		scale    float64
+		margin   float64
+		opacity  float64
+		// inside is a pixel the watermark covers, outside one it leaves
+		inside, outside image.Point
+		red             uint8
+	}{
+		{"Bottom-right by default", "", 0, 0, 1, image.Pt(95, 45), image.Pt(85, 45), 255},
+		{"Top-left with a margin", "top-left", 0, 0.1, 1, image.Pt(5, 5), image.Pt(2, 2), 255},
+		{"Centered", "center", 0, 0, 1, image.Pt(50, 25), image.Pt(40, 25), 255},
+		{"Right edge", "right", 0, 0, 1, image.Pt(95, 25), image.Pt(95, 15), 255},
+		{"Scaled to the width", "top", 0.5, 0, 1, image.Pt(30, 45), image.Pt(20, 5), 255},
+		{"Half opaque", "bottom-left", 0, 0, 0.5, image.Pt(5, 45), image.Pt(15, 45), 255},
+	}
+	for _, test := range tests {
+		w := redWatermark()
+		w.Position, w.Scale, w.Margin, w.Opacity = test.position, test.scale, test.margin, test.opacity
+		out, err := applyWatermark(img, w)
+		if err != nil {
+			t.Fatalf("%s: applyWatermark() error = %v", test.name, err)
+		}
+		if out.Bounds() != img.Bounds() {
+			t.Fatalf("%s: bounds = %v, expected %v", test.name, out.Bounds(), img.Bounds())
+		}
+		r, g, _, _ := out.At(test.inside.X, test.inside.Y).RGBA()
+		if r>>8 != uint32(test.red) || g>>8 == 255 {
+			t.Errorf("%s: pixel %v = %v, expected the watermark", test.name, test.inside, out.At(test.inside.X, test.inside.Y))
+		}
+		if test.opacity < 1 && (g>>8 < 100 || g>>8 > 155) {
+			t.Errorf("%s: pixel %v = %v, expected half of the watermark", test.name, test.inside, out.At(test.inside.X, test.inside.Y))
+		}
+		if _, g, _, _ := out.At(test.outside.X, test.outside.Y).RGBA(); g>>8 != 255 {
+			t.Errorf("%s: pixel %v = %v, expected the image", test.name, test.outside, out.At(test.outside.X, test.outside.Y))
+		}
+	}
+}
+
+func TestWatermarkValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(*Watermark)
+		errorMsg string
+	}{
+		{"Valid", func(*Watermark) {}, ""},
+		{"Unknown position", func(w *Watermark) { w.Position = "middle" }, "watermark position must be one of"},
+		{"Wider than the output", func(w *Watermark) { w.Scale = 1.5 }, "watermark scale must be between 0 and 1"},
+		{"Margin beyond the center", func(w *Watermark) { w.Margin = 0.5 }, "watermark margin must be at least 0"},
+		{"Invisible", func(w *Watermark) { w.Opacity = 0 }, "watermark opacity must be above 0"},
+		{"Not opened", func(w *Watermark) { w.image = nil }, "watermark logo.png has no image"},
+		{"Empty text", func(w *Watermark) { w.font, w.Size = defaultFont(t), 0.04 }, "watermark text is empty"},
+		{"Unknown placeholder", func(w *Watermark) { w.font, w.Text, w.Size = defaultFont(t), "© {author}", 0.04 }, "watermark text placeholder must be"},
+		{"Text taller than half", func(w *Watermark) { w.font, w.Text, w.Size = defaultFont(t), "© {year}", 0.6 }, "watermark text size must be above 0"},
+	}
+	for _, test := range tests {
+		w := redWatermark()
+		test.change(w)
+		err := w.validate()
+		if test.errorMsg == "" && err != nil {
+			t.Errorf("%s: validate() error = %v, expected nil", test.name, err)
+		}
+		if test.errorMsg != "" && (err == nil || !strings.HasPrefix(err.Error(), test.errorMsg)) {
+			t.Errorf("%s: validate() error = %v, expected %q", test.name, err, test.errorMsg)
+		}
+	}
+}
+
+// defaultFont returns the font of text watermarks by default
+func defaultFont(t *testing.T) *opentype.Font {
+	f, err := loadStampFont()
+	if err != nil {
+		t.Fatalf("loadStampFont() error = %v", err)
+	}
+	return f
+}
+
+func TestExpandWatermark(t *testing.T) {
+	taken := time.Date(2023, 7, 14, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"© {year} Jane Doe", "© 2023 Jane Doe"},
+		{"{name}, {date}", "IMG_0042, 2023-07-14"},
+		{"No placeholders", "No placeholders"},
+	}
+	for _, test := range tests {
+		w := &Watermark{Text: test.text}
+		if got := expandWatermark(w, "/photos/IMG_0042.JPG", taken).Text; got != test.expected {
+			t.Errorf("expandWatermark(%q) = %q, expected %q", test.text, got, test.expected)
+		}
+		if w.Text != test.text {
+			t.Errorf("expandWatermark(%q) changed the watermark to %q", test.text, w.Text)
+		}
+	}
+}
+
+func TestTextWatermark(t *testing.T) {
+	w, err := NewTextWatermark("© 2023", "")
+	if err != nil {
+		t.Fatalf("NewTextWatermark() error = %v", err)
+	}
+	w.Color, w.Size = color.NRGBA{255, 0, 0, 255}, 0.1
+	if err := w.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+	img := imaging.New(400, 200, color.NRGBA{255, 255, 255, 255})
+	out, err := applyWatermark(img, w)
+	if err != nil {
+		t.Fatalf("applyWatermark() error = %v", err)
+	}
+	// Text 20 pixels high in the bottom-right corner, red where it is drawn
+	var red, elsewhere int
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			if c := color.NRGBAModel.Convert(out.At(x, y)).(color.NRGBA); c.R > 200 && c.G < 100 {
+				if x < 300 || y < 170 {
+					elsewhere++
+				} else {
+					red++
+				}
+			}
+		}
+	}
+	if red == 0 || elsewhere > 0 {
+		t.Errorf("red pixels in the corner = %d and elsewhere = %d, expected only in the corner", red, elsewhere)
+	}
+
+	if _, err := NewTextWatermark("©", filepath.Join(t.TempDir(), "missing.ttf")); err == nil || !strings.HasPrefix(err.Error(), "not a readable TrueType or OpenType font") {
+		t.Errorf("NewTextWatermark() of a missing font error = %v", err)
+	}
+}
+
+func TestProcessWatermark(t *testing.T) {
+	tempDir := t.TempDir()
+	outDir := filepath.Join(tempDir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	logoPath := filepath.Join(tempDir, "logo.png")
+	logo, err := os.Create(logoPath)
+	if err != nil {
+		t.Fatalf("Failed to create logo: %v", err)
+	}
+	if err := png.Encode(logo, imaging.New(40, 20, color.NRGBA{255, 0, 0, 255})); err != nil {
+		t.Fatalf("Failed to encode logo: %v", err)
+	}
+	logo.Close()
+	inputPath := filepath.Join(tempDir, "photo.png")
+	if err := imaging.Save(imaging.New(800, 400, color.NRGBA{255, 255, 255, 255}), inputPath); err != nil {
+		t.Fatalf("Failed to save input: %v", err)
+	}
+
+	watermark, err := OpenWatermark(logoPath)
+	if err != nil {
+		t.Fatalf("OpenWatermark() error = %v", err)
+	}
+	watermark.Scale = 0.5
+	p, err := New(WithOutputDir(outDir), WithFormat("png"), WithMaxSize(200, 200), WithWatermark(watermark))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	result, err := p.Process(inputPath)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	out, err := imaging.Open(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	// 100x50 at the output size of 200x100, not 400x200 scaled down
+	if c := color.NRGBAModel.Convert(out.At(150, 75)).(color.NRGBA); c != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("pixel in the watermark = %v, expected red", c)
+	}
+	if c := color.NRGBAModel.Convert(out.At(95, 75)).(color.NRGBA); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("pixel beside the watermark = %v, expected white", c)
+	}
+
+	if _, err := OpenWatermark(filepath.Join(tempDir, "missing.png")); err == nil {
+		t.Error("OpenWatermark() of a missing file succeeded")
+	}
+}
@@ -0,0 +1,312 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"time"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+	xwebp "golang.org/x/image/webp"
+)
+
+// VP8X feature flags
+const (
+	webpAnimationFlag = 0x02
+	webpXMPFlag       = 0x04
+	webpEXIFFlag      = 0x08
+	webpAlphaFlag     = 0x10
+	webpICCFlag       = 0x20
+)
+
+// ANMF frame flags
+const (
+	webpDisposeFlag = 0x01
+	webpNoBlendFlag = 0x02
+)
+
+// webpChunk is a chunk of a WebP RIFF container
+type webpChunk struct {
+	id   string
+	data []byte
+}
+
+// isAnimatedWebP reports whether data is a WebP file holding an animation
+func isAnimatedWebP(data []byte) bool {
+	return len(data) >= 21 && string(data[0:4]) == "RIFF" && string(data[8:16]) == "WEBPVP8X" && data[20]&webpAnimationFlag != 0
+}
+
+// readWebPChunks splits a WebP file into its chunks
+func readWebPChunks(data []byte) ([]webpChunk, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("not a WebP file")
+	}
+	return splitWebPChunks(data[12:])
+}
+
+// extendedWebPChunks splits a WebP file into its chunks, starting with a
+// VP8X chunk that is added to simple WebPs so that features can be flagged
+func extendedWebPChunks(data []byte) ([]webpChunk, error) {
+	chunks, err := readWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) > 0 && chunks[0].id == "VP8X" {
+		return chunks, nil
+	}
+	cfg, err := xwebp.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	vp8x := make([]byte, 10)
+	putUint24(vp8x[4:], cfg.Width-1)
+	putUint24(vp8x[7:], cfg.Height-1)
+	return append([]webpChunk{{id: "VP8X", data: vp8x}}, chunks...), nil
+}
+
+// splitWebPChunks splits a run of RIFF chunks
+func splitWebPChunks(data []byte) ([]webpChunk, error) {
+	var chunks []webpChunk
+	for len(data) >= 8 {
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if size < 0 || size > len(data)-8 {
+			return nil, errors.New("truncated WebP chunk")
+		}
+		chunks = append(chunks, webpChunk{id: string(data[0:4]), data: data[8 : 8+size]})
+
+		// Chunks are padded to an even size
+		next := 8 + size + size&1
+		if next > len(data) {
+			break
+		}
+		data = data[next:]
+	}
+	return chunks, nil
+}
+
+// writeWebPChunk appends a chunk to buf
+func writeWebPChunk(buf *bytes.Buffer, id string, data []byte) {
+	var header [8]byte
+	copy(header[:4], id)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(data)))
+	buf.Write(header[:])
+	buf.Write(data)
+	if len(data)&1 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+// writeWebPFile writes chunks as a WebP file
+func writeWebPFile(w io.Writer, chunks []byte) error {
+	var header [12]byte
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(4+len(chunks)))
+	copy(header[8:12], "WEBP")
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(chunks)
+	return err
+}
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// decodeWebP reads all frames of an animated WebP, blending and disposing
+// each frame so that every frame is a complete picture
+func decodeWebP(data []byte, limit int64) (*animation, error) {
+	chunks, err := readWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	anim := &animation{}
+	var canvas *image.RGBA
+	for _, chunk := range chunks {
+		switch chunk.id {
+		case "VP8X":
+			if len(chunk.data) < 10 {
+				return nil, errors.New("invalid WebP VP8X chunk")
+			}
+			width, height := uint24(chunk.data[4:])+1, uint24(chunk.data[7:])+1
+			if err := checkPixels(width, height, limit); err != nil {
+				return nil, err
+			}
+			canvas = image.NewRGBA(image.Rect(0, 0, width, height))
+		case "ANIM":
+			if len(chunk.data) < 6 {
+				return nil, errors.New("invalid WebP ANIM chunk")
+			}
+			anim.loopCount = gifLoopCount(int(binary.LittleEndian.Uint16(chunk.data[4:6])))
+		case "ANMF":
+			if canvas == nil || len(chunk.data) < 16 {
+				return nil, errors.New("invalid WebP ANMF chunk")
+			}
+			x, y := uint24(chunk.data[0:])*2, uint24(chunk.data[3:])*2
+			width, height := uint24(chunk.data[6:])+1, uint24(chunk.data[9:])+1
+			flags := chunk.data[15]
+			rect := image.Rect(x, y, x+width, y+height)
+			if !rect.In(canvas.Bounds()) {
+				return nil, errors.New("WebP frame outside the canvas")
+			}
+			size := canvas.Bounds().Size()
+			if err := checkPixels(size.X, size.Y*(len(anim.frames)+1), limit); err != nil {
+				return nil, err
+			}
+
+			frame, err := decodeWebPFrame(chunk.data[16:], width, height)
+			if err != nil {
+				return nil, err
+			}
+
+			op := draw.Over
+			if flags&webpNoBlendFlag != 0 {
+				op = draw.Src
+			}
+			draw.Draw(canvas, rect, frame, frame.Bounds().Min, op)
+			anim.frames = append(anim.frames, cloneRGBA(canvas))
+			anim.delays = append(anim.delays, time.Duration(uint24(chunk.data[12:]))*time.Millisecond)
+
+			if flags&webpDisposeFlag != 0 {
+				draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+			}
+		}
+	}
+	if len(anim.frames) == 0 {
+		return nil, errors.New("WebP file has no animation frames")
+	}
+	return anim, nil
+}
+
+// decodeWebPFrame decodes the image data of an animation frame by wrapping
+// it in a WebP file of its own
+func decodeWebPFrame(data []byte, width, height int) (image.Image, error) {
+	chunks, err := splitWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	for _, chunk := range chunks {
+		if chunk.id == "ALPH" {
+			// Alpha needs an extended header
+			vp8x := make([]byte, 10)
+			vp8x[0] = webpAlphaFlag
+			putUint24(vp8x[4:], width-1)
+			putUint24(vp8x[7:], height-1)
+			writeWebPChunk(&body, "VP8X", vp8x)
+			break
+		}
+	}
+	for _, chunk := range chunks {
+		writeWebPChunk(&body, chunk.id, chunk.data)
+	}
+
+	var file bytes.Buffer
+	if err := writeWebPFile(&file, body.Bytes()); err != nil {
+		return nil, err
+	}
+	return xwebp.Decode(&file)
+}
+
+// encodeWebP writes anim as a lossy WebP, animated if it has more than one
+// frame
+func encodeWebP(w io.Writer, anim *animation, quality int) error {
+	if len(anim.frames) == 1 {
+		data, err := encodeWebPImage(anim.frames[0], quality)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	var frames bytes.Buffer
+	alpha := false
+	for i, frame := range anim.frames {
+		data, err := encodeWebPImage(frame, quality)
+		if err != nil {
+			return err
+		}
+		chunks, err := readWebPChunks(data)
+		if err != nil {
+			return err
+		}
+
+		// Every frame covers the whole canvas and replaces the previous one
+		header := make([]byte, 16)
+		putUint24(header[6:], frame.Bounds().Dx()-1)
+		putUint24(header[9:], frame.Bounds().Dy()-1)
+		putUint24(header[12:], min(int(anim.delays[i]/time.Millisecond), 1<<24-1))
+		header[15] = webpNoBlendFlag
+		body := bytes.NewBuffer(header)
+		for _, chunk := range chunks {
+			if chunk.id == "VP8X" {
+				continue
+			}
+			if chunk.id == "ALPH" {
+				alpha = true
+			}
+			writeWebPChunk(body, chunk.id, chunk.data)
+		}
+		writeWebPChunk(&frames, "ANMF", body.Bytes())
+	}
+
+	var file bytes.Buffer
+	vp8x := make([]byte, 10)
+	vp8x[0] = webpAnimationFlag
+	if alpha {
+		vp8x[0] |= webpAlphaFlag
+	}
+	bounds := anim.frames[0].Bounds()
+	putUint24(vp8x[4:], bounds.Dx()-1)
+	putUint24(vp8x[7:], bounds.Dy()-1)
+	writeWebPChunk(&file, "VP8X", vp8x)
+
+	// A transparent background and the loop count
+	animChunk := make([]byte, 6)
+	binary.LittleEndian.PutUint16(animChunk[4:], uint16(webpLoopCount(anim.loopCount)))
+	writeWebPChunk(&file, "ANIM", animChunk)
+
+	file.Write(frames.Bytes())
+	return writeWebPFile(w, file.Bytes())
+}
+
+// encodeWebPImage encodes img as a lossy WebP file
+func encodeWebPImage(img image.Image, quality int) ([]byte, error) {
+	// libwebp takes straight alpha, which the encoder reads from RGBA pixels
+	nrgba := imaging.Clone(img)
+	return webp.EncodeRGBA(&image.RGBA{Pix: nrgba.Pix, Stride: nrgba.Stride, Rect: nrgba.Rect}, float32(quality))
+}
+
+// webpLoopCount converts a GIF loop count, which counts repeats, to WebP,
+// which counts plays
+func webpLoopCount(loopCount int) int {
+	switch {
+	case loopCount == 0:
+		return 0
+	case loopCount < 0:
+		return 1
+	}
+	return min(loopCount+1, 1<<16-1)
+}
+
+// gifLoopCount converts a WebP loop count to GIF
+func gifLoopCount(loops int) int {
+	switch loops {
+	case 0:
+		return 0
+	case 1:
+		return -1
+	}
+	return loops - 1
+}
@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// WhiteBalance neutralizes a color cast, and optionally corrects exposure,
+// using a reference that should be gray
+type WhiteBalance struct {
+	// Patch is the neutral reference in source pixels. An empty patch uses
+	// the average of the whole image (gray world).
+	Patch image.Rectangle
+	// Level is the gray level, from 0 to 1, the reference is brought to.
+	// 0 keeps the exposure.
+	Level float64
+}
+
+// applyWhiteBalance scales the channels of img in linear light so that the
+// reference becomes neutral
+func applyWhiteBalance(img image.Image, wb *WhiteBalance) (image.Image, error) {
+	bounds := img.Bounds()
+	ref := bounds
+	if !wb.Patch.Empty() {
+		ref = wb.Patch.Add(bounds.Min)
+		if !ref.In(bounds) {
+			return nil, fmt.Errorf("white balance patch %v is outside the %dx%d image", wb.Patch, bounds.Dx(), bounds.Dy())
+		}
+	}
+
+	var decode [256]float64
+	for i := range decode {
+		decode[i] = srgbDecode(float64(i) / 255)
+	}
+
+	// Average the reference in linear light
+	var sum [3]float64
+	for y := ref.Min.Y; y < ref.Max.Y; y++ {
+		for x := ref.Min.X; x < ref.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			sum[0] += decode[c.R]
+			sum[1] += decode[c.G]
+			sum[2] += decode[c.B]
+		}
+	}
+	n := float64(ref.Dx() * ref.Dy())
+	mean := [3]float64{sum[0] / n, sum[1] / n, sum[2] / n}
+	if mean[0] == 0 || mean[1] == 0 || mean[2] == 0 {
+		return nil, fmt.Errorf("white balance reference %v is black in some channel", wb.Patch)
+	}
+	gray := (mean[0] + mean[1] + mean[2]) / 3
+
+	target := gray
+	if wb.Level > 0 {
+		target = srgbDecode(wb.Level)
+	}
+
+	// Per-channel lookup tables
+	var lut [3][256]uint8
+	for c := 0; c < 3; c++ {
+		gain := target / mean[c]
+		for i := range lut[c] {
+			lut[c][i] = uint8(math.Round(srgbEncode(math.Min(1, decode[i]*gain)) * 255))
+		}
+	}
+
+	out := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			out.SetNRGBA(x, y, color.NRGBA{lut[0][c.R], lut[1][c.G], lut[2][c.B], c.A})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestApplyWhiteBalance(t *testing.T) {
+	// A warm cast over a gray card on the left and a white area on the right
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{140, 118, 90, 255})
+			if x >= 10 {
+				img.SetNRGBA(x, y, color.NRGBA{255, 235, 200, 255})
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		wb    WhiteBalance
+		check func(gray color.NRGBA) bool
+	}{
+		{"Patch becomes neutral", WhiteBalance{Patch: image.Rect(0, 0, 10, 10)}, func(c color.NRGBA) bool {
+			return absDiff(c.R, c.G) <= 1 && absDiff(c.G, c.B) <= 1
+		}},
+		{"Exposure brings the patch to the level", WhiteBalance{Patch: image.Rect(0, 0, 10, 10), Level: 0.5}, func(c color.NRGBA) bool {
+			return absDiff(c.R, 128) <= 1 && absDiff(c.G, 128) <= 1 && absDiff(c.B, 128) <= 1
+		}},
+		{"Gray world reduces the cast", WhiteBalance{}, func(c color.NRGBA) bool {
+			return int(c.R)-int(c.B) < 140-90
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := applyWhiteBalance(img, &test.wb)
+			if err != nil {
+				t.Fatalf("applyWhiteBalance() error = %v", err)
+			}
+			if c := color.NRGBAModel.Convert(out.At(5, 5)).(color.NRGBA); !test.check(c) {
+				t.Errorf("balanced gray = %v", c)
+			}
+		})
+	}
+
+	if _, err := applyWhiteBalance(img, &WhiteBalance{Patch: image.Rect(15, 5, 25, 15)}); err == nil {
+		t.Error("applyWhiteBalance() expected error for a patch outside the image, got nil")
+	}
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
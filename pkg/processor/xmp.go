@@ -0,0 +1,286 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// operationLog collects the operations applied to an output. Frames and
+// pages share their settings, so the first image is recorded.
+type operationLog struct {
+	operations []string
+	recorded   bool
+}
+
+// record keeps the operations of the first transformed image. A nil log
+// records nothing.
+func (l *operationLog) record(operations []string) {
+	if l == nil || l.recorded {
+		return
+	}
+	l.operations, l.recorded = operations, true
+}
+
+// whiteBalanceOperation describes the white balance reference
+func whiteBalanceOperation(wb *WhiteBalance) string {
+	op := "white-balance auto"
+	if !wb.Patch.Empty() {
+		op = fmt.Sprintf("white-balance %d,%d,%d,%d", wb.Patch.Min.X, wb.Patch.Min.Y, wb.Patch.Dx(), wb.Patch.Dy())
+	}
+	if wb.Level > 0 {
+		op += fmt.Sprintf(" level %d", int(math.Round(wb.Level*255)))
+	}
+	return op
+}
+
+// encodeOperation describes how an output is encoded
+func encodeOperation(format string, config Config) string {
+	switch format {
+	case "jpg", "webp", "heic":
+		return fmt.Sprintf("encode %s quality %d", format, config.Quality)
+	case "avif":
+		if config.Speed > 0 {
+			return fmt.Sprintf("encode avif quality %d speed %d", config.Quality, config.Speed)
+		}
+		return fmt.Sprintf("encode avif quality %d", config.Quality)
+	case "jxl":
+		if config.Effort > 0 {
+			return fmt.Sprintf("encode jxl quality %d effort %d", config.Quality, config.Effort)
+		}
+		return fmt.Sprintf("encode jxl quality %d", config.Quality)
+	default:
+		return "encode " + format
+	}
+}
+
+// outputXMP returns the XMP packet of an output: the title, description,
+// keywords and rating of catalog, and, with operations, the capture time
+// unless it is zero and the operations as an xmpMM:History event
+func outputXMP(catalog Catalog, operations []string, software string, when, captured time.Time) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	buf.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	buf.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	buf.WriteString("    xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"")
+	if catalog.Title != "" || catalog.Description != "" || len(catalog.Keywords) > 0 {
+		buf.WriteString("\n    xmlns:dc=\"http://purl.org/dc/elements/1.1/\"")
+	}
+	if catalog.Rating != 0 {
+		fmt.Fprintf(&buf, "\n    xmp:Rating=\"%d\"", catalog.Rating)
+	}
+	if operations != nil {
+		buf.WriteString("\n    xmlns:xmpMM=\"http://ns.adobe.com/xap/1.0/mm/\"")
+		buf.WriteString("\n    xmlns:stEvt=\"http://ns.adobe.com/xap/1.0/sType/ResourceEvent#\"")
+		if !captured.IsZero() {
+			buf.WriteString("\n    xmlns:exif=\"http://ns.adobe.com/exif/1.0/\"")
+			fmt.Fprintf(&buf, "\n    xmp:CreateDate=\"%s\"", captured.Format(time.RFC3339))
+			fmt.Fprintf(&buf, "\n    exif:DateTimeOriginal=\"%s\"", captured.Format(time.RFC3339))
+		}
+		fmt.Fprintf(&buf, "\n    xmp:CreatorTool=\"%s\"", escape(software))
+	}
+	buf.WriteString(">\n")
+
+	// Titles and descriptions are language alternatives, keywords a bag
+	for _, alt := range []struct{ name, value string }{{"dc:title", catalog.Title}, {"dc:description", catalog.Description}} {
+		if alt.value != "" {
+			fmt.Fprintf(&buf, "   <%s>\n    <rdf:Alt>\n     <rdf:li xml:lang=\"x-default\">%s</rdf:li>\n    </rdf:Alt>\n   </%s>\n", alt.name, escape(alt.value), alt.name)
+		}
+	}
+	if len(catalog.Keywords) > 0 {
+		buf.WriteString("   <dc:subject>\n    <rdf:Bag>\n")
+		for _, keyword := range catalog.Keywords {
+			fmt.Fprintf(&buf, "     <rdf:li>%s</rdf:li>\n", escape(keyword))
+		}
+		buf.WriteString("    </rdf:Bag>\n   </dc:subject>\n")
+	}
+
+	if operations != nil {
+		buf.WriteString("   <xmpMM:History>\n    <rdf:Seq>\n     <rdf:li rdf:parseType=\"Resource\">\n")
+		buf.WriteString("      <stEvt:action>converted</stEvt:action>\n")
+		fmt.Fprintf(&buf, "      <stEvt:parameters>%s</stEvt:parameters>\n", escape(strings.Join(operations, "; ")))
+		fmt.Fprintf(&buf, "      <stEvt:softwareAgent>%s</stEvt:softwareAgent>\n", escape(software))
+		fmt.Fprintf(&buf, "      <stEvt:when>%s</stEvt:when>\n", when.Format(time.RFC3339))
+		buf.WriteString("     </rdf:li>\n    </rdf:Seq>\n   </xmpMM:History>\n")
+	}
+	buf.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n")
+	buf.WriteString("<?xpacket end=\"r\"?>")
+	return buf.Bytes()
+}
+
+// escape replaces the XML special characters in s
+var escape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;").Replace
+
+// canEmbedXMP reports whether XMP can be added to outputs of format.
+// libheif writes AVIF and HEIC without it.
+func canEmbedXMP(format string) bool {
+	switch format {
+	case "jpg", "png", "gif", "webp", "tiff":
+		return true
+	}
+	return false
+}
+
+// embedXMP adds the XMP packet to the output file at path
+func embedXMP(path, format string, packet []byte) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "jpg":
+		data, err = jpegWithXMP(data, packet)
+	case "png":
+		data, err = pngWithXMP(data, packet)
+	case "gif":
+		data, err = gifWithXMP(data, packet)
+	case "webp":
+		data, err = webpWithXMP(data, packet)
+	case "tiff":
+		data, err = tiffWithXMP(data, packet)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// jpegWithXMP inserts an APP1 XMP segment after the SOI marker and any
+// JFIF header
+func jpegWithXMP(data, packet []byte) ([]byte, error) {
+	const namespace = "http://ns.adobe.com/xap/1.0/\x00"
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("not a JPEG file")
+	}
+	if len(namespace)+len(packet)+2 > 0xFFFF {
+		return nil, errors.New("XMP packet too large for a JPEG segment")
+	}
+
+	at := 2
+	if data[2] == 0xFF && data[3] == 0xE0 && len(data) >= 6 {
+		at += 2 + int(binary.BigEndian.Uint16(data[4:6]))
+	}
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+len(namespace)+len(packet)))
+	segment = append(append(segment, namespace...), packet...)
+	return splice(data, at, segment), nil
+}
+
+// pngWithXMP inserts an iTXt XMP chunk after the IHDR chunk
+func pngWithXMP(data, packet []byte) ([]byte, error) {
+	// Signature (8 bytes), then IHDR with its 13 bytes of data
+	const ihdrEnd = 8 + 8 + 13 + 4
+	if len(data) < ihdrEnd || string(data[12:16]) != "IHDR" {
+		return nil, errors.New("not a PNG file")
+	}
+
+	// Keyword, null separator, uncompressed, no language or translated keyword
+	body := append([]byte("iTXtXML:com.adobe.xmp\x00\x00\x00\x00\x00"), packet...)
+	chunk := make([]byte, 4, len(body)+8)
+	binary.BigEndian.PutUint32(chunk, uint32(len(body)-4))
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body))
+	return splice(data, ihdrEnd, chunk), nil
+}
+
+// gifWithXMP inserts an XMP application extension before the first block
+// after the global color table
+func gifWithXMP(data, packet []byte) ([]byte, error) {
+	if len(data) < 13 || string(data[0:3]) != "GIF" {
+		return nil, errors.New("not a GIF file")
+	}
+	at := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		at += 3 << (flags&0x07 + 1)
+	}
+	if at > len(data) {
+		return nil, errors.New("truncated GIF file")
+	}
+
+	// The packet is stored raw, followed by the "magic trailer" that makes
+	// readers skipping sub-blocks land on the terminator
+	ext := append([]byte("\x21\xFF\x0BXMP DataXMP"), packet...)
+	ext = append(ext, 0x01)
+	for b := 0xFF; b >= 0; b-- {
+		ext = append(ext, byte(b))
+	}
+	ext = append(ext, 0x00)
+	return splice(data, at, ext), nil
+}
+
+// webpWithXMP adds an XMP chunk, turning a simple WebP into an extended
+// one when needed
+func webpWithXMP(data, packet []byte) ([]byte, error) {
+	chunks, err := extendedWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	chunks[0].data[0] |= webpXMPFlag
+	for _, chunk := range chunks {
+		writeWebPChunk(&body, chunk.id, chunk.data)
+	}
+	writeWebPChunk(&body, "XMP ", packet)
+
+	var out bytes.Buffer
+	if err := writeWebPFile(&out, body.Bytes()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// tiffWithXMP appends a copy of the first directory with an XMP tag and
+// points the header at it. The original directory is left unreferenced.
+func tiffWithXMP(data, packet []byte) ([]byte, error) {
+	if len(data) < 8 || string(data[0:4]) != "II*\x00" {
+		return nil, errors.New("not a little-endian TIFF file")
+	}
+	ifd := int(binary.LittleEndian.Uint32(data[4:8]))
+	if ifd+2 > len(data) {
+		return nil, errors.New("truncated TIFF file")
+	}
+	count := int(binary.LittleEndian.Uint16(data[ifd:]))
+	end := ifd + 2 + count*12
+	if end+4 > len(data) {
+		return nil, errors.New("truncated TIFF file")
+	}
+
+	out := append([]byte(nil), data...)
+	xmpOffset := len(out)
+	out = append(out, packet...)
+	if len(out)%2 == 1 {
+		out = append(out, 0)
+	}
+
+	// Entries are sorted by tag and the XMP tag is the highest we write
+	newIFD := len(out)
+	out = binary.LittleEndian.AppendUint16(out, uint16(count+1))
+	out = append(out, data[ifd+2:end]...)
+	out = binary.LittleEndian.AppendUint16(out, tagXMP)
+	out = binary.LittleEndian.AppendUint16(out, typeByte)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(packet)))
+	out = binary.LittleEndian.AppendUint32(out, uint32(xmpOffset))
+	out = append(out, data[end:end+4]...)
+	binary.LittleEndian.PutUint32(out[4:8], uint32(newIFD))
+	return out, nil
+}
+
+// splice returns data with insert placed at offset at
+func splice(data []byte, at int, insert []byte) []byte {
+	out := make([]byte, 0, len(data)+len(insert))
+	out = append(out, data[:at]...)
+	out = append(out, insert...)
+	return append(out, data[at:]...)
+}
@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestProcessingLog(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 2), uint8(y * 3), 90, 255})
+		}
+	}
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.png")
+	if err := imaging.Save(img, inputPath); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	for _, format := range []string{"jpg", "png", "gif", "webp", "tiff"} {
+		t.Run(format, func(t *testing.T) {
+			config := Config{
+				OutputFormat:  format,
+				MaxWidth:      60,
+				MaxHeight:     60,
+				Quality:       85,
+				OutputDir:     filepath.Join(tempDir, format),
+				Deterministic: true,
+				WhiteBalance:  &WhiteBalance{Level: 0.5},
+				ProcessingLog: true,
+				Software:      "picture-resize-tools v1.2.3",
+			}
+			if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			result, err := Process(inputPath, config)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+
+			data, err := os.ReadFile(result.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, expected := range []string{
+				"<stEvt:parameters>white-balance auto level 128; resize 120x80 to 60x40; encode " + format,
+				"<stEvt:softwareAgent>picture-resize-tools v1.2.3</stEvt:softwareAgent>",
+				"<stEvt:when>2023-11-14T22:13:20Z</stEvt:when>",
+			} {
+				if !bytes.Contains(data, []byte(expected)) {
+					t.Errorf("output does not contain %q", expected)
+				}
+			}
+
+			// The output still decodes
+			out, err := loadImage(result.OutputPath)
+			if err != nil {
+				t.Fatalf("loadImage() error = %v", err)
+			}
+			if size := out.Bounds().Size(); size != image.Pt(60, 40) {
+				t.Errorf("output size = %v, expected 60x40", size)
+			}
+		})
+	}
+}
+
+func TestProcessingLogOperations(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{"Unchanged", Config{MaxWidth: 200, MaxHeight: 200}, ""},
+		{"Crop", Config{MaxWidth: 200, MaxHeight: 200, Crop: image.Rect(10, 20, 50, 60)}, "crop 10,20,40,40"},
+		{"Fill", Config{MaxWidth: 50, MaxHeight: 50, Fill: true, Focus: &FocalPoint{X: 0.5, Y: 0.25}}, "fill 50x50 focus 0.50,0.25; resize 80x80 to 50x50"},
+		{"White balance patch", Config{MaxWidth: 200, MaxHeight: 200, WhiteBalance: &WhiteBalance{Patch: image.Rect(4, 4, 13, 13)}}, "white-balance 4,4,9,9"},
+		{"Orient and upscale", Config{MaxWidth: 160, MaxHeight: 90, Fill: true, Focus: &FocalPoint{X: 0.5, Y: 0.5}, Upscale: true, orientation: 6}, "orient 6; fill 160x90 focus 0.50,0.50; resize 80x45 to 160x90"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := &operationLog{}
+			test.config.log = log
+			img := imaging.New(120, 80, color.Gray{128})
+			if _, err := transformImage(img, test.config); err != nil {
+				t.Fatalf("transformImage() error = %v", err)
+			}
+			if got := strings.Join(log.operations, "; "); got != test.expected {
+				t.Errorf("operations = %q, expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestOutputXMP(t *testing.T) {
+	captured := time.Date(2024, 4, 30, 18, 15, 0, 0, time.FixedZone("+08:00", 8*3600))
+	packet := outputXMP(Catalog{}, []string{"stamp", "encode png"}, `tools "<dev>" & co`, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), captured)
+
+	// The packet is well-formed XML
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("packet is not well-formed: %v\n%s", err, packet)
+		}
+	}
+	if !bytes.Contains(packet, []byte("tools &quot;&lt;dev&gt;&quot; &amp; co")) {
+		t.Errorf("software name is not escaped:\n%s", packet)
+	}
+	if !bytes.Contains(packet, []byte(`exif:DateTimeOriginal="2024-04-30T18:15:00+08:00"`)) {
+		t.Errorf("capture time is not recorded:\n%s", packet)
+	}
+	if packet := outputXMP(Catalog{}, []string{"encode png"}, "tools", time.Now(), time.Time{}); bytes.Contains(packet, []byte("DateTimeOriginal")) {
+		t.Errorf("capture time recorded without one:\n%s", packet)
+	}
+}